@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestName is the name of the file in the save directory that records
+// every list saved by 'goim fetch'.
+const manifestName = "MANIFEST"
+
+// manifestEntry records a list file as it was when it was saved, so that it
+// can be checked later. (See 'goim cache verify'.)
+type manifestEntry struct {
+	name     string // file name, like "movies.list.gz"
+	size     int64
+	checksum string // hex SHA-256
+	fetched  time.Time
+}
+
+// manifest maps file names in the save directory to their entries.
+type manifest map[string]manifestEntry
+
+// manifestMu protects manifests from lists that are saved in parallel.
+var manifestMu sync.Mutex
+
+// readManifest reads the manifest of the save directory given. A directory
+// without a manifest has an empty one.
+//
+// Each line of the manifest is a tab separated name, size, checksum and
+// fetch time (in RFC 3339 format).
+func readManifest(dir string) (manifest, error) {
+	m := make(manifest)
+	f, err := os.Open(path.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		fetched, _ := time.Parse(time.RFC3339, fields[3])
+		m[fields[0]] = manifestEntry{fields[0], size, fields[2], fetched}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ef("Could not read manifest in '%s': %s", dir, err)
+	}
+	return m, nil
+}
+
+// writeManifest replaces the manifest of the save directory given. The
+// manifest is written to a temporary file first, so it's never left half
+// written.
+func writeManifest(dir string, m manifest) error {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tmp, err := ioutil.TempFile(dir, manifestName+".part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly after the rename
+	w := bufio.NewWriter(tmp)
+	for _, name := range names {
+		e := m[name]
+		w.WriteString(sf("%s\t%d\t%s\t%s\n",
+			e.name, e.size, e.checksum, e.fetched.Format(time.RFC3339)))
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path.Join(dir, manifestName))
+}
+
+// updateManifest calls update with the manifest of the save directory given
+// and writes the manifest back if update returns true. Only one manifest is
+// updated at a time.
+func updateManifest(dir string, update func(m manifest) bool) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	m, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	if !update(m) {
+		return nil
+	}
+	return writeManifest(dir, m)
+}
+
+// recordList adds the list file given to the manifest of its directory.
+func recordList(fpath string) error {
+	size, sum, err := fileChecksum(fpath)
+	if err != nil {
+		return err
+	}
+	e := manifestEntry{path.Base(fpath), size, sum, time.Now().UTC()}
+	return updateManifest(path.Dir(fpath), func(m manifest) bool {
+		m[e.name] = e
+		return true
+	})
+}
+
+// fileChecksum returns the size and hex SHA-256 checksum of the file given.
+func fileChecksum(fpath string) (int64, string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"testing"
+)
+
+func TestCheckCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goim-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("a list"))
+	w.Close()
+	write := func(name string, data []byte) string {
+		fpath := path.Join(dir, name)
+		if err := ioutil.WriteFile(fpath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fpath
+	}
+	for _, name := range []string{"movies", "plot", "genres"} {
+		if err := recordList(write(name+".list.gz", gz.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("plot.list.gz", gz.Bytes()[:gz.Len()-4]) // truncated
+	write("quotes.list.gz", gz.Bytes())            // never recorded
+	os.Remove(path.Join(dir, "genres.list.gz"))
+
+	checked, err := checkCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"movies.list.gz": false,
+		"plot.list.gz":   true,
+		"quotes.list.gz": false,
+		"genres.list.gz": false,
+	}
+	if len(checked) != len(want) {
+		t.Fatalf("expected %d lists but got %v", len(want), checked)
+	}
+	for _, list := range checked {
+		corrupt, ok := want[list.name]
+		if !ok || corrupt != list.corrupt {
+			t.Fatalf("unexpected result for %s: %v", list.name, list)
+		}
+		if list.name == "movies.list.gz" && len(list.problem) > 0 {
+			t.Fatalf("movies should be fine but is %s", list.problem)
+		}
+		if list.name == "genres.list.gz" && list.problem != "missing" {
+			t.Fatalf("genres should be missing but is %s", list.problem)
+		}
+	}
+}
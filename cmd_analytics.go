@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/ty/fun"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var flagAnalyticsParquet = ""
+
+// analyticsSkip is the tables that aren't copied to DuckDB databases: the
+// search history belongs to whoever searched, and load checkpoints are only
+// useful while loading.
+var analyticsSkip = []string{"search_history", "load_checkpoint"}
+
+var cmdAnalytics = &command{
+	name:            "analytics",
+	positionalUsage: "dest.duckdb",
+	shortHelp:       "copies the database to DuckDB for aggregate queries",
+	help: `
+The analytics command copies every table of the database into a new DuckDB
+database at the path given. DuckDB stores tables by column, so queries that
+aggregate whole tables (like the average rating of every genre by decade) run
+far faster than they do with SQLite or PostgreSQL, which store tables by row.
+DuckDB is only supported when goim is built with the 'duckdb' build tag (e.g.,
+'go install -tags duckdb').
+
+Tables are staged as Parquet files before they're loaded into DuckDB, which
+reads them in bulk instead of row by row. The Parquet files are deleted
+afterwards, unless a directory to keep them in is given with '-parquet'. (They
+can be read by most data analysis tools too.)
+
+The tables of the database are read with DuckDB's 'sqlite' or 'postgres'
+extension, which DuckDB downloads the first time it's used.
+
+The DuckDB database can be searched like any other database by giving it with
+'-db' (e.g., '-db imdb.duckdb') or by setting 'driver' to 'duckdb' in the
+configuration file. It can't be loaded with 'goim load'. To update it, load
+the original database and run this command again. For example, this finds the
+best rated genres of each decade:
+
+    SELECT floor(m.year / 10) * 10 AS decade, g.name AS genre,
+           avg(r.rank) / 10 AS rating, count(*) AS movies
+    FROM movie AS m
+    JOIN genre AS g ON g.atom_id = m.atom_id
+    JOIN rating AS r ON r.atom_id = m.atom_id
+    WHERE r.votes >= 1000
+    GROUP BY decade, genre
+    ORDER BY decade, rating DESC;
+`,
+	flags: flag.NewFlagSet("analytics", flag.ExitOnError),
+	run:   cmd_analytics,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagAnalyticsParquet, "parquet",
+			flagAnalyticsParquet,
+			"When set, the Parquet files that tables are staged in are\n"+
+				"kept in this directory.")
+	},
+}
+
+func cmd_analytics(c *command) bool {
+	c.assertNArg(1)
+	dest := c.flags.Arg(0)
+
+	driver, dsn := c.dbinfo()
+	if driver == "duckdb" {
+		pef("The database is already a DuckDB database.")
+		return false
+	}
+	if _, err := os.Stat(dest); err == nil {
+		pef("'%s' already exists. Remove it to make a new copy.", dest)
+		return false
+	}
+
+	// The database is opened first so that its schema is up to date, since
+	// its tables are copied column by column.
+	db := openDb(driver, dsn)
+	snap, err := db.Snapshot()
+	closeDb(db)
+	if err != nil {
+		pef("Could not get database generation: %s", err)
+		return false
+	}
+
+	stage := flagAnalyticsParquet
+	if len(stage) == 0 {
+		tmp, err := ioutil.TempDir("", "goim-parquet")
+		if err != nil {
+			pef("Could not create staging directory: %s", err)
+			return false
+		}
+		defer os.RemoveAll(tmp)
+		stage = tmp
+	} else if err := os.MkdirAll(stage, 0755); err != nil {
+		pef("Could not create '%s': %s", stage, err)
+		return false
+	}
+
+	duck := openDb("duckdb", dest)
+	defer closeDb(duck)
+
+	// Extensions and attached databases belong to the connection that
+	// loaded them.
+	duck.SetMaxOpenConns(1)
+	if err := attachSource(duck, driver, dsn); err != nil {
+		pef("%s", err)
+		return false
+	}
+	for _, t := range imdb.Schema() {
+		if fun.In(t.Name, analyticsSkip) {
+			continue
+		}
+		logf("Copying %s...", t.Name)
+		if err := stageTable(duck, t, stage); err != nil {
+			pef("Could not copy %s: %s", t.Name, err)
+			return false
+		}
+	}
+	if _, err := duck.Exec("DETACH src"); err != nil {
+		pef("Could not detach the database: %s", err)
+		return false
+	}
+	if _, err := duck.Exec("CHECKPOINT"); err != nil {
+		pef("Could not write DuckDB database: %s", err)
+		return false
+	}
+	logf("Copied %s to '%s'.", snap, dest)
+	return true
+}
+
+// attachSource attaches the database given to a DuckDB database as 'src',
+// so that its tables can be read by DuckDB.
+func attachSource(duck *imdb.DB, driver, dsn string) error {
+	var ext string
+	switch driver {
+	case "sqlite3":
+		ext = "sqlite"
+	case "postgres":
+		ext = "postgres"
+	default:
+		return ef("A %s database can't be copied to DuckDB.", driver)
+	}
+	for _, q := range []string{
+		sf("INSTALL %s", ext),
+		sf("LOAD %s", ext),
+		sf("ATTACH %s AS src (TYPE %s, READ_ONLY)", sqlQuote(dsn), ext),
+	} {
+		if _, err := duck.Exec(q); err != nil {
+			return ef("Could not attach database with DuckDB's '%s' "+
+				"extension: %s", ext, err)
+		}
+	}
+	return nil
+}
+
+// stageTable copies a table of the attached database to a Parquet file in
+// the directory given, and then replaces the rows of the same table in the
+// DuckDB database with the rows in the file.
+func stageTable(duck *imdb.DB, t imdb.Table, dir string) error {
+	var cols []string
+	for _, c := range t.Columns {
+		cols = append(cols, c.Name)
+	}
+	list := strings.Join(cols, ", ")
+	file := sqlQuote(path.Join(dir, t.Name+".parquet"))
+
+	_, err := duck.Exec(sf("COPY (SELECT %s FROM src.%s) TO %s "+
+		"(FORMAT PARQUET)", list, t.Name, file))
+	if err != nil {
+		return err
+	}
+	tx, err := duck.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The 'generation' table starts with a row.
+	if _, err := tx.Exec(sf("DELETE FROM %s", t.Name)); err != nil {
+		return err
+	}
+	_, err = tx.Exec(sf("INSERT INTO %s (%s) SELECT %s FROM read_parquet(%s)",
+		t.Name, list, list, file))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlQuote returns s as a quoted SQL string literal.
+func sqlQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/online"
+)
+
+var flagArtworkTmdb = false
+
+var cmdArtwork = &command{
+	name:            "artwork",
+	positionalUsage: "[ csv-file ]",
+	shortHelp:       "loads artwork URLs (posters, etc.) for media",
+	help: `
+The artwork command loads URLs of artwork, like posters and photos, into the
+database. Artwork can be loaded from a CSV file or from TMDb.
+
+Each row of the CSV file must have the form:
+
+    entity,kind,url
+
+Where 'entity' is either the IMDb key of an entity (e.g., 'The Matrix (1999)')
+or an IMDb identifier loaded with 'goim xref' (e.g., 'tt0133093'). 'kind' is
+the kind of artwork, usually one of 'poster', 'backdrop' or 'profile' (for
+photos of actors). All artwork loaded from a CSV file replaces all artwork
+previously loaded from CSV files. If no CSV file is given, then it is read from
+stdin.
+
+When -tmdb is set, artwork is retrieved from TMDb for every entity with a
+'tmdb' cross reference (see 'goim xref') that doesn't have artwork from TMDb
+yet. This requires 'online_provider' to be 'tmdb' in the configuration file,
+along with a TMDb API key in 'online_key' (or the GOIM_ONLINE_KEY environment
+variable).
+`,
+	flags: flag.NewFlagSet("artwork", flag.ExitOnError),
+	run:   cmd_artwork,
+	addFlags: func(c *command) {
+		c.flags.BoolVar(&flagArtworkTmdb, "tmdb", flagArtworkTmdb,
+			"When set, artwork is retrieved from TMDb instead of a CSV file.")
+		c.flags.BoolVar(&flagWarnings, "warn", flagWarnings,
+			"When set, warnings about skipped rows will be shown.")
+	},
+}
+
+func cmd_artwork(c *command) bool {
+	if c.flags.NArg() > 1 {
+		c.showUsage()
+	}
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	if flagArtworkTmdb {
+		provider, key, ok := c.onlineConfig()
+		if !ok {
+			return false
+		}
+		if provider != "tmdb" {
+			pef("The online provider must be 'tmdb' to use -tmdb.")
+			return false
+		}
+		if err := loadTmdbArtwork(db, key); err != nil {
+			pef("%s", err)
+			return false
+		}
+		return true
+	}
+
+	rows, err := readCSVFile(c.flags.Arg(0))
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	if err := loadArtwork(db, rows); err != nil {
+		pef("%s", err)
+		return false
+	}
+	return true
+}
+
+// loadArtwork replaces all user provided artwork with the rows given. Each
+// row must have three fields: an entity, the kind of artwork and its URL.
+func loadArtwork(db *imdb.DB, rows [][]string) (err error) {
+	defer csql.Safe(&err)
+
+	logf("Loading atoms...")
+	atoms, err := newAtomizer(db, nil)
+	csql.Panic(err)
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	csql.Exec(tx, "DELETE FROM artwork WHERE source = $1", "user")
+	ins, err := csql.NewInserter(tx, db.Driver, "artwork",
+		"atom_id", "kind", "url", "source")
+	csql.Panic(err)
+
+	added, skipped := 0, 0
+	for i, row := range rows {
+		if len(row) != 3 {
+			csql.Panic(ef("Row %d has %d fields, but artwork must have "+
+				"3 fields: entity,kind,url", i+1, len(row)))
+		}
+		kind := strings.ToLower(strings.TrimSpace(row[1]))
+		uri := strings.TrimSpace(row[2])
+		if len(kind) == 0 || len(uri) == 0 {
+			csql.Panic(ef("Row %d has an empty kind or URL.", i+1))
+		}
+		id, ok, err := resolveEntity(tx, atoms, strings.TrimSpace(row[0]))
+		csql.Panic(err)
+		if !ok {
+			warnf("Could not find entity '%s' (row %d). Skipping.", row[0], i+1)
+			skipped++
+			continue
+		}
+		csql.Panic(ins.Exec(id, kind, uri, "user"))
+		added++
+	}
+	csql.Panic(ins.Exec())
+	csql.Panic(tx.Commit())
+	logf("Done. Added %d artwork URLs (skipped %d).", added, skipped)
+	return
+}
+
+// loadTmdbArtwork retrieves artwork from TMDb for every entity with a TMDb
+// cross reference but without artwork from TMDb.
+func loadTmdbArtwork(db *imdb.DB, apiKey string) (err error) {
+	defer csql.Safe(&err)
+
+	type missing struct {
+		id     imdb.Atom
+		ent    imdb.EntityKind
+		tmdbId string
+	}
+	var todo []missing
+	rs := csql.Query(db, `
+		SELECT x.atom_id, x.id,
+			CASE
+				WHEN m.atom_id IS NOT NULL THEN 'movie'
+				WHEN t.atom_id IS NOT NULL THEN 'tvshow'
+				WHEN a.atom_id IS NOT NULL THEN 'actor'
+				ELSE ''
+			END
+		FROM xref AS x
+		LEFT JOIN movie AS m ON m.atom_id = x.atom_id
+		LEFT JOIN tvshow AS t ON t.atom_id = x.atom_id
+		LEFT JOIN actor AS a ON a.atom_id = x.atom_id
+		WHERE x.source = 'tmdb' AND NOT EXISTS (
+			SELECT 1 FROM artwork AS w
+			WHERE w.atom_id = x.atom_id AND w.source = 'tmdb'
+		)
+		`)
+	csql.ForRow(rs, func(s csql.RowScanner) {
+		var m missing
+		var ent string
+		csql.Scan(s, &m.id, &m.tmdbId, &ent)
+		if len(ent) > 0 {
+			m.ent = imdb.Entities[ent]
+			todo = append(todo, m)
+		}
+	})
+	logf("Retrieving artwork for %d entities from TMDb...", len(todo))
+
+	added := 0
+	for _, m := range todo {
+		arts, err := online.TMDbArtwork(apiKey, m.ent, m.tmdbId)
+		if err != nil {
+			warnf("Could not get artwork for TMDb id %s: %s", m.tmdbId, err)
+			continue
+		}
+		// Each entity is committed separately, so that an interrupted
+		// retrieval doesn't have to start over.
+		tx, err := db.Begin()
+		csql.Panic(err)
+		for kind, uri := range arts {
+			csql.Exec(tx, `
+				INSERT INTO artwork (atom_id, kind, url, source)
+				VALUES ($1, $2, $3, $4)
+				`, m.id, kind, uri, "tmdb")
+			added++
+		}
+		csql.Panic(tx.Commit())
+	}
+	logf("Done. Added %d artwork URLs from TMDb.", added)
+	return
+}
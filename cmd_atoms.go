@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"flag"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var cmdAtoms = &command{
+	name:            "atoms",
+	positionalUsage: "(export | import) [ csv-file ]",
+	shortHelp:       "exports or imports the atom identifiers of entities",
+	help: `
+The atoms command copies the atom identifiers of entities from one database to
+another, so that they keep their identifiers when moving between backends
+(e.g., from SQLite to PostgreSQL) or when merging datasets. Anything that
+refers to entities by atom (saved results, other programs, etc.) keeps
+working. (To copy everything in a database, including its atoms, use 'goim
+copy' instead.)
+
+'goim atoms export' writes every atom in the database as a CSV file, and
+'goim atoms import' assigns the atoms in a CSV file to the database. Each row
+of the CSV file has the form:
+
+    atom,key
+
+Where 'atom' is an atom identifier and 'key' is the IMDb key of an entity
+exactly as it appears in IMDb's lists (e.g., 'The Matrix (1999)'). Since only
+hashes of keys are stored in the database, an export writes keys as the hash
+of the key instead, in the form 'md5:{32 hexadecimal digits}'. Import accepts
+both forms, so mappings from other sources can be written by hand.
+
+Atoms must be imported before loading the 'movies' and 'actors' lists, which
+then reuse the imported atoms for the entities they add (and give new atoms to
+the rest). For example, to move a SQLite database to PostgreSQL:
+
+    goim atoms export atoms.csv
+    goim -driver postgres -dsn '...' atoms import atoms.csv
+    goim -driver postgres -dsn '...' load -lists all
+
+Rows whose key already has another atom, or whose atom is already used by
+another key, are skipped (and reported with the -warn flag).
+
+If no CSV file is given, then it is written to stdout or read from stdin.
+`,
+	flags: flag.NewFlagSet("atoms", flag.ExitOnError),
+	run:   cmd_atoms,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.BoolVar(&flagWarnings, "warn", flagWarnings,
+			"When set, warnings about skipped rows will be shown.")
+	},
+}
+
+func cmd_atoms(c *command) bool {
+	if c.flags.NArg() < 1 || c.flags.NArg() > 2 {
+		c.showUsage()
+	}
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	fpath := c.flags.Arg(1)
+	switch c.flags.Arg(0) {
+	case "export":
+		var w io.Writer = os.Stdout
+		if len(fpath) > 0 && fpath != "-" {
+			f, err := os.Create(fpath)
+			if err != nil {
+				pef("Could not create '%s': %s", fpath, err)
+				return false
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := exportAtoms(db, w); err != nil {
+			pef("%s", err)
+			return false
+		}
+	case "import":
+		var r io.Reader = os.Stdin
+		if len(fpath) > 0 && fpath != "-" {
+			f, err := os.Open(fpath)
+			if err != nil {
+				pef("Could not open '%s': %s", fpath, err)
+				return false
+			}
+			defer f.Close()
+			r = f
+		}
+		if err := importAtoms(db, r); err != nil {
+			pef("%s", err)
+			return false
+		}
+	default:
+		pef("Unknown action '%s'. Use 'export' or 'import'.", c.flags.Arg(0))
+		return false
+	}
+	return true
+}
+
+// exportAtoms writes every atom in the database as a row of a CSV file, with
+// its key written as a hash (see imdb.ParseAtomKey).
+func exportAtoms(db *imdb.DB, w io.Writer) (err error) {
+	defer csql.Safe(&err)
+
+	csvw := csv.NewWriter(w)
+	rs := csql.Query(db, "SELECT id, hash FROM atom ORDER BY id ASC")
+	csql.ForRow(rs, func(scanner csql.RowScanner) {
+		var id imdb.Atom
+		var hash []byte
+		csql.Scan(scanner, &id, &hash)
+		csql.Panic(csvw.Write([]string{
+			strconv.Itoa(int(id)),
+			"md5:" + hex.EncodeToString(hash),
+		}))
+	})
+	csvw.Flush()
+	csql.Panic(csvw.Error())
+	return
+}
+
+// importAtoms assigns the atoms in the CSV data given to the database. (See
+// imdb.Atomizer.Seed.)
+func importAtoms(db *imdb.DB, r io.Reader) (err error) {
+	defer csql.Safe(&err)
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	logf("Loading atoms...")
+	atoms, err := newAtomizer(db, tx)
+	csql.Panic(err)
+
+	skipped := 0
+	added, existed, err := atoms.Seed(r, func(row int, err error) {
+		warnf("Could not assign the atom of row %d: %s Skipping.", row, err)
+		skipped++
+	})
+	csql.Panic(err)
+	csql.Panic(atoms.Close())
+	csql.Panic(tx.Commit())
+	logf("Done. Added %d atoms (%d already assigned, skipped %d).",
+		added, existed, skipped)
+	return
+}
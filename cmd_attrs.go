@@ -3,10 +3,12 @@ package main
 import (
 	"flag"
 	"sort"
+	"strings"
 
 	"github.com/BurntSushi/ty/fun"
 
 	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/jsonapi"
 	"github.com/BurntSushi/goim/tpl"
 )
 
@@ -30,6 +32,8 @@ var attrCommands = map[string]string{
 	"quotes":             "show quotes for media",
 	"rank":               "show user rank/votes for media",
 	"credits":            "show actor/media credits",
+	"overlays":           "show user overlay tags for media",
+	"xrefs":              "show cross references (TMDb, Wikidata) for media",
 }
 
 func init() {
@@ -96,6 +100,8 @@ func cmd_full(c *command) bool {
 	return true
 }
 
+var flagShortJSON = false
+
 var cmdShort = &command{
 	name:            "short",
 	other:           true,
@@ -104,6 +110,12 @@ var cmdShort = &command{
 	help:            "",
 	flags:           flag.NewFlagSet("short", flag.ExitOnError),
 	run:             cmd_short,
+	addFlags: func(c *command) {
+		c.flags.BoolVar(&flagShortJSON, "json", flagShortJSON,
+			"When set, the entity is printed as one JSON object in the\n"+
+				"stable format of the 'jsonapi' package. Errors are in the\n"+
+				"object too. Ambiguous queries are never prompted for.")
+	},
 }
 
 func cmd_short(c *command) bool {
@@ -114,6 +126,13 @@ func cmd_short(c *command) bool {
 	attrs := fun.Keys(attrCommands).([]string)
 	sort.Sort(sort.StringSlice(attrs))
 
+	if flagShortJSON {
+		query := strings.Join(c.flags.Args(), " ")
+		resp := jsonapi.GetEntity(db, jsonapi.EntityRequest{Query: query},
+			c.configureSearcher)
+		return writeJSON(resp) && len(resp.Error) == 0
+	}
+
 	ent, ok := c.oneEntity(db)
 	if !ok {
 		return false
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
+)
+
+var (
+	flagBenchRuns    = 10
+	flagBenchQueries = ""
+)
+
+// benchQueries is the query suite run by 'goim bench' when no queries are
+// given. It has a query for each kind of search that is expensive in its own
+// way.
+var benchQueries = []struct {
+	name, query string
+}{
+	{"exact", "the matrix {movie} {years:1999}"},
+	{"wildcard", "%matrix% {movie}"},
+	{"fuzzy", "the matirx"},
+	{"sorted", "{movie} {votes:10000-} {sort:bayes} {limit:20}"},
+	{"sub-search", "{show:the simpsons} {seasons:1} {sort:episode asc}"},
+	{"cast", "{cast:keanu reeves} {movie} {sort:year asc}"},
+	{"credits", "{credits:the matrix} {billed:1-10}"},
+	{"genre", "{movie} {genre:sci-fi} {years:1990-1999} {sort:rank}"},
+}
+
+var cmdBench = &command{
+	name:            "bench",
+	positionalUsage: "[ query ... ]",
+	shortHelp:       "measures the latency of searches",
+	help: `
+The bench command runs a suite of searches against the database and reports
+the latency of each one. Each search is run once to warm up caches and then
+run repeatedly (see '-runs'). The minimum, the 50th, 90th and 99th percentile
+and the maximum latencies are reported.
+
+By default, a representative suite of searches is run: exact, wildcard and
+fuzzy text, sorting, sub-searches and credit joins. Queries may instead be
+given as arguments, or in a file with one query per line (see '-queries').
+Since the results depend on what's in the database, measurements are only
+comparable when taken against the same data.
+
+The global '-cpu-prof' flag can be used to write a CPU profile of the
+searches.
+`,
+	flags: flag.NewFlagSet("bench", flag.ExitOnError),
+	run:   cmd_bench,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.IntVar(&flagBenchRuns, "runs", flagBenchRuns,
+			"The number of times each query is run (after warming up).")
+		c.flags.StringVar(&flagBenchQueries, "queries", flagBenchQueries,
+			"When set, queries are read from the file given, one per line.\n"+
+				"Empty lines and lines starting with '#' are ignored.")
+	},
+}
+
+func cmd_bench(c *command) bool {
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	if flagBenchRuns < 1 {
+		flagBenchRuns = 1
+	}
+	var names, queries []string
+	switch {
+	case len(flagBenchQueries) > 0:
+		lines, err := readQueryFile(flagBenchQueries)
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		names, queries = lines, lines
+	case c.flags.NArg() > 0:
+		names, queries = c.flags.Args(), c.flags.Args()
+	default:
+		for _, q := range benchQueries {
+			names = append(names, q.name)
+			queries = append(queries, q.query)
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "query\tresults\tmin\tp50\tp90\tp99\tmax\t\n")
+	ok := true
+	for i, query := range queries {
+		n, times, err := benchQuery(db, query, flagBenchRuns)
+		if err != nil {
+			tw.Flush()
+			pef("Could not run '%s': %s", query, err)
+			ok = false
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t\n", names[i], n,
+			benchDuration(times[0]), benchDuration(percentile(times, 50)),
+			benchDuration(percentile(times, 90)),
+			benchDuration(percentile(times, 99)),
+			benchDuration(times[len(times)-1]))
+	}
+	tw.Flush()
+	return ok
+}
+
+// benchQuery runs the query given once to warm up and then runs more times.
+// The number of results and the latency of each run (sorted in ascending
+// order) are returned.
+func benchQuery(db *imdb.DB, query string, runs int) (int, []time.Duration,
+	error) {
+	run := func() (int, error) {
+		s, err := search.Query(db, query)
+		if err != nil {
+			return 0, err
+		}
+		rs, err := s.Results()
+		return len(rs), err
+	}
+	if _, err := run(); err != nil {
+		return 0, nil, err
+	}
+
+	var n int
+	times := make([]time.Duration, runs)
+	for i := range times {
+		start := time.Now()
+		var err error
+		if n, err = run(); err != nil {
+			return 0, nil, err
+		}
+		times[i] = time.Since(start)
+	}
+	sort.Sort(durations(times))
+	return n, times, nil
+}
+
+// percentile returns the p-th percentile of the sorted durations given, using
+// the nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// benchDuration formats a duration in milliseconds.
+func benchDuration(d time.Duration) string {
+	return sf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+// readQueryFile returns the queries in the file given, one per line.
+func readQueryFile(fpath string) ([]string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, ef("Could not open queries file: %s", err)
+	}
+	defer f.Close()
+
+	var queries []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		queries = append(queries, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, ef("Could not read queries file: %s", err)
+	}
+	return queries, nil
+}
+
+type durations []time.Duration
+
+func (ds durations) Len() int           { return len(ds) }
+func (ds durations) Less(i, j int) bool { return ds[i] < ds[j] }
+func (ds durations) Swap(i, j int)      { ds[i], ds[j] = ds[j], ds[i] }
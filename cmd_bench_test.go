@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	var times []time.Duration
+	for i := 1; i <= 10; i++ {
+		times = append(times, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p    int
+		want time.Duration
+	}{
+		{0, 1 * time.Millisecond},
+		{50, 5 * time.Millisecond},
+		{90, 9 * time.Millisecond},
+		{99, 10 * time.Millisecond},
+		{100, 10 * time.Millisecond},
+	}
+	for _, test := range tests {
+		if got := percentile(times, test.p); got != test.want {
+			t.Errorf("p%d: expected %s but got %s", test.p, test.want, got)
+		}
+	}
+}
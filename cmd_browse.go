@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
+	"github.com/BurntSushi/goim/tpl"
+)
+
+var cmdBrowse = &command{
+	name:            "browse",
+	positionalUsage: "query",
+	shortHelp:       "browse search results, cast and episodes interactively",
+	help: `
+The browse command shows the results of a search query and lets you drill
+down into them interactively. Choosing a result shows its details along with
+a list of related entities: the cast of a movie or episode, the credits of
+an actor, or the seasons of a TV show (and then the episodes of a season).
+
+At each prompt, the following keys are available (followed by Enter):
+
+    N       open the Nth entry in the list
+    >, <    show the next or previous page of the list
+    b       go back to the previous list
+    a NAME  show an attribute of the current entity (e.g., 'a plots')
+    q       quit
+`,
+	flags: flag.NewFlagSet("browse", flag.ExitOnError),
+	run:   cmd_browse,
+}
+
+// browsePageSize is the number of entries shown on each page of a list.
+const browsePageSize = 20
+
+// browseView is a single screen in the browser. It shows the details of an
+// entity (if there is one) followed by a list of entries that can be opened.
+type browseView struct {
+	title string
+	ent   imdb.Entity
+	items []browseItem
+	page  int
+}
+
+// browseItem is a single entry in a list. Opening it returns a new view.
+type browseItem struct {
+	label string
+	open  func() (*browseView, error)
+}
+
+type browser struct {
+	c     *command
+	db    *imdb.DB
+	in    *bufio.Reader
+	stack []*browseView
+}
+
+func cmd_browse(c *command) bool {
+	c.assertLeastNArg(1)
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	b := &browser{c: c, db: db, in: bufio.NewReader(os.Stdin)}
+	searcher, err := search.Query(db, strings.Join(c.flags.Args(), " "))
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	searcher.Chooser(c.chooser)
+	results, err := searcher.Results()
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	if len(results) == 0 {
+		pef("No results found.")
+		return false
+	}
+
+	tpl.SetDB(db)
+	b.stack = append(b.stack, b.resultsView(results))
+	return b.loop()
+}
+
+func (b *browser) loop() bool {
+	for len(b.stack) > 0 {
+		v := b.stack[len(b.stack)-1]
+		b.show(v)
+		pf("[N, >, <, b, a NAME, q]: ")
+		line, err := b.in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			pef("%s", err)
+			return false
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			if err == io.EOF {
+				return true
+			}
+			continue
+		}
+		switch fields[0] {
+		case "q":
+			return true
+		case "b":
+			b.stack = b.stack[:len(b.stack)-1]
+		case ">":
+			if (v.page+1)*browsePageSize < len(v.items) {
+				v.page++
+			}
+		case "<":
+			if v.page > 0 {
+				v.page--
+			}
+		case "a":
+			if v.ent == nil || len(fields) < 2 {
+				pef("There is no entity to show attributes for.")
+			} else if _, ok := attrCommands[fields[1]]; !ok {
+				pef("Unknown attribute '%s'.", fields[1])
+			} else {
+				b.c.showAttr(b.db, v.ent, fields[1])
+				b.pause()
+			}
+		default:
+			n, err := strconv.Atoi(fields[0])
+			if err != nil || n < 1 || n > len(v.items) {
+				pef("Invalid choice '%s'.", fields[0])
+				continue
+			}
+			next, err := v.items[n-1].open()
+			if err != nil {
+				pef("%s", err)
+				continue
+			}
+			b.stack = append(b.stack, next)
+		}
+	}
+	return true
+}
+
+// pause waits for the user to press Enter.
+func (b *browser) pause() {
+	pf("(press Enter to continue)")
+	b.in.ReadString('\n')
+}
+
+func (b *browser) show(v *browseView) {
+	pf("\n%s\n%s\n", v.title, strings.Repeat("=", len(v.title)))
+	if v.ent != nil {
+		tplName := sf("short_%s", v.ent.Type().String())
+		b.c.tplExec(b.c.tpl(tplName), tpl.Args{E: v.ent, A: nil})
+	}
+	if len(v.items) == 0 {
+		return
+	}
+	start := v.page * browsePageSize
+	end := start + browsePageSize
+	if end > len(v.items) {
+		end = len(v.items)
+	}
+	pf("\n")
+	for i := start; i < end; i++ {
+		pf("%3d. %s\n", i+1, v.items[i].label)
+	}
+	if len(v.items) > browsePageSize {
+		pf("(showing %d-%d of %d)\n", start+1, end, len(v.items))
+	}
+}
+
+func (b *browser) resultsView(results []search.Result) *browseView {
+	v := &browseView{title: "Search results"}
+	for _, r := range results {
+		r := r
+		label := sf("%-8s %s", r.Entity, r.Name)
+		if r.Year > 0 {
+			label += sf(" (%d)", r.Year)
+		}
+		if len(r.Attrs) > 0 {
+			label += " " + r.Attrs
+		}
+		open := func() (*browseView, error) {
+			ent, err := r.GetEntity(b.db)
+			if err != nil {
+				return nil, err
+			}
+			return b.entityView(ent)
+		}
+		v.items = append(v.items, browseItem{label, open})
+	}
+	return v
+}
+
+// entityView shows the details of an entity and lists the entities related
+// to it.
+func (b *browser) entityView(ent imdb.Entity) (*browseView, error) {
+	v := &browseView{title: sf("%s", ent), ent: ent}
+	switch e := ent.(type) {
+	case *imdb.Tvshow:
+		return v, b.addSeasons(v, e)
+	case *imdb.Episode:
+		v.items = append(v.items, browseItem{"(TV show)",
+			func() (*browseView, error) {
+				tv, err := e.Tvshow(b.db)
+				if err != nil {
+					return nil, err
+				}
+				return b.entityView(tv)
+			}})
+		adjacent := []struct {
+			label string
+			get   func(csql.Queryer) (*imdb.Episode, error)
+		}{
+			{"(previous episode)", e.Previous},
+			{"(next episode)", e.Next},
+		}
+		for _, adj := range adjacent {
+			ep, err := adj.get(b.db)
+			if err != nil {
+				return nil, err
+			}
+			if ep != nil {
+				label := sf("%s S%02dE%02d %s",
+					adj.label, ep.Season, ep.EpisodeNum, ep)
+				v.items = append(v.items, browseItem{label,
+					func() (*browseView, error) { return b.entityView(ep) }})
+			}
+		}
+	}
+	return v, b.addCredits(v, ent)
+}
+
+// addCredits adds the credits of an entity to a view. For media, these are
+// the cast. For actors, these are the media they've appeared in.
+func (b *browser) addCredits(v *browseView, ent imdb.Entity) error {
+	var credits imdb.Credits
+	if err := ent.Attrs(b.db, &credits); err != nil {
+		return err
+	}
+	for _, c := range credits {
+		other := imdb.Entity(c.Actor)
+		if ent.Type() == imdb.EntityActor {
+			other = c.Media
+		}
+		v.items = append(v.items, browseItem{
+			sf("%s %s", other, c),
+			func() (*browseView, error) { return b.entityView(other) },
+		})
+	}
+	return nil
+}
+
+// addSeasons adds the seasons of a TV show to a view.
+func (b *browser) addSeasons(v *browseView, tv *imdb.Tvshow) (err error) {
+	defer csql.Safe(&err)
+
+	counts := make(map[int]int)
+	rs := csql.Query(b.db, `
+		SELECT season, COUNT(*)
+		FROM episode
+		WHERE tvshow_atom_id = $1
+		GROUP BY season
+		`, tv.Id)
+	csql.ForRow(rs, func(s csql.RowScanner) {
+		var season, count int
+		csql.Scan(s, &season, &count)
+		counts[season] = count
+	})
+
+	var seasons []int
+	for season := range counts {
+		seasons = append(seasons, season)
+	}
+	sort.Ints(seasons)
+	for _, season := range seasons {
+		season := season
+		label := sf("Season %d (%d episodes)", season, counts[season])
+		if season == 0 {
+			label = sf("Unnumbered (%d episodes)", counts[season])
+		}
+		v.items = append(v.items, browseItem{label,
+			func() (*browseView, error) { return b.seasonView(tv, season) }})
+	}
+	return
+}
+
+// seasonView lists the episodes in a season of a TV show.
+func (b *browser) seasonView(tv *imdb.Tvshow, season int) (
+	v *browseView, err error) {
+
+	defer csql.Safe(&err)
+
+	v = &browseView{title: sf("%s, season %d", tv, season)}
+	rs := csql.Query(b.db, `
+		SELECT e.atom_id, e.tvshow_atom_id, n.name,
+			   e.year, e.season, e.episode_num
+		FROM episode AS e
+		LEFT JOIN name AS n ON n.atom_id = e.atom_id
+		WHERE e.tvshow_atom_id = $1 AND e.season = $2
+		ORDER BY e.episode_num ASC
+		`, tv.Id, season)
+	csql.ForRow(rs, func(s csql.RowScanner) {
+		e := new(imdb.Episode)
+		csql.Panic(e.Scan(s))
+		v.items = append(v.items, browseItem{
+			sf("E%02d %s", e.EpisodeNum, e),
+			func() (*browseView, error) { return b.entityView(e) },
+		})
+	})
+	return
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/ty/fun"
+)
+
+var (
+	flagCacheDir    = ""
+	flagCacheDryRun = false
+)
+
+var cmdCache = &command{
+	name:            "cache",
+	positionalUsage: "( verify | prune )",
+	shortHelp:       "verifies or prunes lists in the save directory",
+	help: `
+The cache command checks the lists that 'goim fetch' saved against the
+manifest in the save directory, which records the size, checksum and fetch
+time of every list saved.
+
+'goim cache verify' reports every list that is corrupt (not a complete gzip
+file), that changed since it was fetched, or that isn't in the manifest, along
+with lists in the manifest that are missing. It fails if any list has a
+problem.
+
+'goim cache prune' deletes what 'verify' would complain about: corrupt and
+changed lists are deleted so that the next fetch downloads them again. It also
+deletes partial downloads left behind by interrupted fetches, versions of
+lists that no longer exist and manifest entries of missing lists. Use
+'-dry-run' to see what would be deleted without deleting anything.
+
+The save directory is the same one that 'goim fetch' uses. See
+'goim help fetch'.
+`,
+	flags: flag.NewFlagSet("cache", flag.ExitOnError),
+	run:   cmd_cache,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagCacheDir, "dir", flagCacheDir,
+			"The save directory. When empty, the save directory in the\n"+
+				"configuration file is used.")
+		c.flags.BoolVar(&flagCacheDryRun, "dry-run", flagCacheDryRun,
+			"When set, 'prune' only shows what it would delete.")
+	},
+}
+
+func cmd_cache(c *command) bool {
+	c.assertNArg(1)
+
+	dir := c.saveDir(flagCacheDir)
+	switch c.flags.Arg(0) {
+	case "verify":
+		return cacheVerify(dir)
+	case "prune":
+		return cachePrune(dir)
+	}
+	pef("Unknown cache command '%s'. Use 'verify' or 'prune'.",
+		c.flags.Arg(0))
+	return false
+}
+
+// cachedList is the result of checking a list file in the save directory.
+type cachedList struct {
+	name    string
+	problem string // empty when the list is fine
+	corrupt bool   // true when the list shouldn't be loaded
+}
+
+// checkCache checks every list file in the save directory against its
+// manifest. Lists in the manifest that are missing are included.
+func checkCache(dir string) ([]cachedList, error) {
+	m, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := dirFetcher(dir).files()
+	if err != nil {
+		return nil, err
+	}
+
+	check := func(f remoteFile) cachedList {
+		fpath := path.Join(dir, f.name)
+		if err := verifyList(fpath); err != nil {
+			return cachedList{f.name, sf("corrupt (%s)", err), true}
+		}
+		e, ok := m[f.name]
+		if !ok {
+			return cachedList{f.name, "not in manifest", false}
+		}
+		size, sum, err := fileChecksum(fpath)
+		if err != nil {
+			return cachedList{f.name, sf("unreadable (%s)", err), true}
+		}
+		if size != e.size || sum != e.checksum {
+			return cachedList{f.name, sf("changed since it was fetched %s",
+				e.fetched.Local().Format("2006-01-02 15:04")), true}
+		}
+		return cachedList{name: f.name}
+	}
+	checked := fun.ParMapN(check, files, flagCpu).([]cachedList)
+
+	have := make(map[string]bool, len(files))
+	for _, f := range files {
+		have[f.name] = true
+	}
+	var missing []string
+	for name := range m {
+		if !have[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		checked = append(checked, cachedList{name, "missing", false})
+	}
+	return checked, nil
+}
+
+func cacheVerify(dir string) bool {
+	checked, err := checkCache(dir)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	ok := true
+	for _, list := range checked {
+		if len(list.problem) == 0 {
+			pf("%s: ok\n", list.name)
+		} else {
+			pf("%s: %s\n", list.name, list.problem)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func cachePrune(dir string) bool {
+	checked, err := checkCache(dir)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+
+	var remove []string
+	dropped := make(map[string]bool)
+	for _, list := range checked {
+		switch {
+		case list.corrupt:
+			pf("%s: %s\n", list.name, list.problem)
+			remove = append(remove, path.Join(dir, list.name))
+			dropped[list.name] = true
+		case list.problem == "missing":
+			dropped[list.name] = true
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		fpath := path.Join(dir, name)
+		switch {
+		case strings.Contains(name, ".part"):
+			// Temporary files of interrupted downloads and manifest writes.
+			remove = append(remove, fpath)
+		case strings.HasPrefix(name, ".") && strings.Contains(name, ".gz"):
+			// Temporary files of interrupted rsync transfers.
+			remove = append(remove, fpath)
+		case strings.HasSuffix(name, ".version"):
+			list := strings.TrimSuffix(name, ".version")
+			if _, err := os.Stat(path.Join(dir, list)); err != nil ||
+				dropped[list] {
+				remove = append(remove, fpath)
+			}
+		}
+	}
+
+	ok := true
+	for _, fpath := range remove {
+		if flagCacheDryRun {
+			pf("Would delete %s\n", fpath)
+			continue
+		}
+		logf("Deleting %s", fpath)
+		if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+			pef("%s", err)
+			ok = false
+		}
+	}
+	if len(dropped) == 0 {
+		return ok
+	}
+	if flagCacheDryRun {
+		for name := range dropped {
+			pf("Would remove %s from the manifest\n", name)
+		}
+		return ok
+	}
+	err = updateManifest(dir, func(m manifest) bool {
+		for name := range dropped {
+			delete(m, name)
+		}
+		return true
+	})
+	if err != nil {
+		pef("Could not update manifest: %s", err)
+		ok = false
+	}
+	return ok
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/csql"
+	"github.com/BurntSushi/ty/fun"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var (
+	flagCopyFrom      = ""
+	flagCopyTo        = ""
+	flagCopyBatch     = 0
+	flagCopyOverwrite = false
+)
+
+// copySkip is the tables that aren't copied to other databases, since load
+// checkpoints are only useful for resuming a load in the same database.
+var copySkip = []string{"load_checkpoint"}
+
+// copyProgress is how often the progress of copying a table is reported.
+var copyProgress = 10 * time.Second
+
+var cmdCopy = &command{
+	name:      "copy",
+	shortHelp: "copies every table of a database to another backend",
+	help: `
+The copy command copies every table of one database to another, which may use
+a different backend. This way, a database can be loaded and tried out with
+SQLite and then moved to PostgreSQL without downloading IMDb's lists again.
+
+Databases are given in the same form as '-db': 'driver:dsn', or the path of a
+SQLite file. A driver of 'sqlite' is the same as 'sqlite3', and a PostgreSQL
+URL (starting with 'postgres://') may be given by itself. When '-from' isn't
+given, the database of '-db' (or the configuration file) is copied. For
+example:
+
+    goim copy -from sqlite:goim.sqlite -to 'postgres:dbname=goim'
+    goim copy -from goim.sqlite -to postgres://goim@localhost/goim
+
+The database copied to is created (and migrated) if it doesn't exist. If it
+already has entities, it's only replaced when '-overwrite' is set. Rows are
+streamed from one database to the other in batches of '-batch' rows, and
+progress is reported while large tables are copied. Indices are dropped while
+copying and created afterwards. Atom identifiers are copied along with
+everything else, so they're the same in both databases.
+
+Copying to DuckDB isn't supported. Use 'goim analytics' instead.
+`,
+	flags: flag.NewFlagSet("copy", flag.ExitOnError),
+	run:   cmd_copy,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagCopyFrom, "from", flagCopyFrom,
+			"The database to copy from. Defaults to the database of '-db'.")
+		c.flags.StringVar(&flagCopyTo, "to", flagCopyTo,
+			"The database to copy to.")
+		c.flags.IntVar(&flagCopyBatch, "batch", flagCopyBatch,
+			"The number of rows in each INSERT statement. When it's 0,\n"+
+				"as many rows as fit in 999 parameters are used.")
+		c.flags.BoolVar(&flagCopyOverwrite, "overwrite", flagCopyOverwrite,
+			"When set, a database that already has entities is replaced.")
+	},
+}
+
+func cmd_copy(c *command) bool {
+	c.assertNArg(0)
+	defer handleSignals()()
+
+	var fromDriver, fromDsn string
+	if len(flagCopyFrom) > 0 {
+		var err error
+		if fromDriver, fromDsn, err = parseDbSpec(flagCopyFrom); err != nil {
+			pef("%s", err)
+			return false
+		}
+	} else {
+		fromDriver, fromDsn = c.dbinfo()
+	}
+	if len(flagCopyTo) == 0 {
+		pef("The database to copy to must be given with '-to'.")
+		return false
+	}
+	toDriver, toDsn, err := parseDbSpec(flagCopyTo)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	if toDriver == "duckdb" {
+		pef("Copying to DuckDB isn't supported. Use 'goim analytics' instead.")
+		return false
+	}
+	if fromDriver == toDriver && fromDsn == toDsn {
+		pef("A database can't be copied to itself.")
+		return false
+	}
+
+	// The source is opened first so that its schema is up to date, since
+	// tables are copied column by column.
+	src := openDb(fromDriver, fromDsn)
+	defer closeDb(src)
+	dbOptions.SQLite = imdb.SQLiteLoad
+	dst := openDb(toDriver, toDsn)
+	defer closeDb(dst)
+
+	if !flagCopyOverwrite {
+		n, err := safeRowCount(dst, "atom")
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		if n > 0 {
+			pef("The database to copy to already has %d atoms. Use "+
+				"'-overwrite' to replace it.", n)
+			return false
+		}
+	}
+
+	var tables []imdb.Table
+	var names []string
+	for _, t := range imdb.Schema() {
+		if !fun.In(t.Name, copySkip) {
+			tables = append(tables, t)
+			names = append(names, t.Name)
+		}
+	}
+	logf("Dropping indices for: %s", strings.Join(names, ", "))
+	if err := dst.DropIndices(names...); err != nil {
+		pef("Could not drop indices: %s", err)
+		return false
+	}
+	defer func() {
+		logf("Creating indices for: %s", strings.Join(names, ", "))
+		if err := dst.CreateIndices(names...); err != nil {
+			pef("Could not create indices: %s", err)
+		}
+	}()
+
+	start := time.Now()
+	total := 0
+	for _, t := range tables {
+		n, err := copyTable(src, dst, t)
+		if err != nil {
+			pef("Could not copy %s: %s", t.Name, err)
+			return false
+		}
+		total += n
+	}
+	logf("Copied %d rows in %d tables from %s to %s in %s.",
+		total, len(tables), fromDriver, toDriver, time.Since(start))
+	return true
+}
+
+// parseDbSpec returns the driver and data source name of a database given as
+// 'driver:dsn', a PostgreSQL URL or the path of a SQLite file.
+func parseDbSpec(spec string) (driver, dsn string, err error) {
+	switch {
+	case strings.HasPrefix(spec, "postgres://"),
+		strings.HasPrefix(spec, "postgresql://"):
+		return "postgres", spec, nil
+	case strings.Contains(spec, ":"):
+		pieces := strings.SplitN(spec, ":", 2)
+		driver, dsn = pieces[0], pieces[1]
+	case strings.HasSuffix(spec, "sqlite"), strings.HasSuffix(spec, "sqlite3"):
+		driver, dsn = "sqlite3", spec
+	case strings.HasSuffix(spec, "duckdb"):
+		driver, dsn = "duckdb", spec
+	default:
+		return "", "", ef("Database '%s' must be of the form 'driver:dsn'.",
+			spec)
+	}
+	if driver == "sqlite" {
+		driver = "sqlite3"
+	}
+	switch driver {
+	case "sqlite3", "postgres", "duckdb":
+	default:
+		return "", "", ef("Unknown driver '%s'. Use 'sqlite3', 'postgres' "+
+			"or 'duckdb'.", driver)
+	}
+	if len(dsn) == 0 {
+		return "", "", ef("Database '%s' has an empty data source.", spec)
+	}
+	return driver, dsn, nil
+}
+
+// copyTable replaces the rows of a table in dst with the rows of the same
+// table in src, and returns the number of rows copied. Rows are read while
+// the previous batch is being inserted.
+func copyTable(src, dst *imdb.DB, t imdb.Table) (n int, err error) {
+	defer csql.Safe(&err)
+
+	var cols []string
+	for _, c := range t.Columns {
+		cols = append(cols, c.Name)
+	}
+	count := rowCount(src, t.Name)
+	logf("Copying %d rows of %s...", count, t.Name)
+
+	tx, err := dst.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	// The 'generation' table starts with a row.
+	csql.Truncate(tx, dst.Driver, t.Name)
+	ins, err := imdb.NewInserter(interruptedCtx, tx, dst.Driver, t.Name,
+		imdb.InsertOptions{BatchSize: flagCopyBatch, Async: true}, cols...)
+	csql.Panic(err)
+
+	rs := csql.Query(src, sf("SELECT %s FROM %s", strings.Join(cols, ", "),
+		t.Name))
+	last := time.Now()
+	csql.ForRow(rs, func(scanner csql.RowScanner) {
+		if stopping() {
+			csql.Panic(errInterrupted)
+		}
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		csql.Scan(scanner, ptrs...)
+		for i, c := range t.Columns {
+			vals[i] = copyValue(c, vals[i])
+		}
+		csql.Panic(ins.Exec(vals...))
+		n++
+		if time.Since(last) >= copyProgress && count > 0 {
+			last = time.Now()
+			logf("Copied %d of %d rows of %s (%d%%).",
+				n, count, t.Name, 100*n/count)
+		}
+	})
+	csql.Panic(ins.Flush())
+	if dst.Driver == "postgres" {
+		resetSequences(tx, t)
+	}
+	csql.Panic(tx.Commit())
+	return
+}
+
+// copyValue converts a value read from one database so that it can be
+// written to the column given in another. SQLite returns text as bytes and
+// booleans as integers, which PostgreSQL won't take for TEXT and BOOLEAN
+// columns.
+func copyValue(c imdb.Column, v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		if c.Type != "BLOB" {
+			return string(v)
+		}
+	case int64:
+		if c.Type == "BOOLEAN" {
+			return v != 0
+		}
+	}
+	return v
+}
+
+// resetSequences makes the sequence of each SERIAL column of a table in a
+// PostgreSQL database continue after the largest value copied, since values
+// inserted explicitly don't advance it.
+func resetSequences(tx csql.Execer, t imdb.Table) {
+	for _, c := range t.Columns {
+		if c.Type != "SERIAL" {
+			continue
+		}
+		csql.Exec(tx, sf(
+			"SELECT setval(pg_get_serial_sequence('%s', '%s'), "+
+				"COALESCE(MAX(%s), 0) + 1, false) FROM %s",
+			t.Name, c.Name, c.Name, t.Name))
+	}
+}
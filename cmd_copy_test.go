@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+func TestParseDbSpec(t *testing.T) {
+	for _, test := range []struct {
+		spec, driver, dsn string
+	}{
+		{"sqlite:goim.sqlite", "sqlite3", "goim.sqlite"},
+		{"sqlite3:/tmp/a:b.db", "sqlite3", "/tmp/a:b.db"},
+		{"goim.sqlite", "sqlite3", "goim.sqlite"},
+		{"imdb.duckdb", "duckdb", "imdb.duckdb"},
+		{"postgres:dbname=goim", "postgres", "dbname=goim"},
+		{"postgres://goim@localhost/goim", "postgres",
+			"postgres://goim@localhost/goim"},
+	} {
+		driver, dsn, err := parseDbSpec(test.spec)
+		if err != nil {
+			t.Errorf("%q: %s", test.spec, err)
+			continue
+		}
+		if driver != test.driver || dsn != test.dsn {
+			t.Errorf("%q: got (%s, %s), want (%s, %s)",
+				test.spec, driver, dsn, test.driver, test.dsn)
+		}
+	}
+	for _, spec := range []string{"goim.db", "mysql:goim", "sqlite:"} {
+		if _, _, err := parseDbSpec(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestCopyValue(t *testing.T) {
+	text := imdb.Column{Name: "name", Type: "TEXT"}
+	blob := imdb.Column{Name: "hash", Type: "BLOB"}
+	boolean := imdb.Column{Name: "tv", Type: "BOOLEAN"}
+	if v, ok := copyValue(text, []byte("Rose")).(string); !ok || v != "Rose" {
+		t.Errorf("text: got %#v", v)
+	}
+	if _, ok := copyValue(blob, []byte{1, 2}).([]byte); !ok {
+		t.Errorf("blob isn't bytes")
+	}
+	if v := copyValue(boolean, int64(1)); v != true {
+		t.Errorf("boolean: got %#v", v)
+	}
+	if v := copyValue(text, nil); v != nil {
+		t.Errorf("null: got %#v", v)
+	}
+}
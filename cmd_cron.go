@@ -0,0 +1,293 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	path "path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	flagCronLists   = "movies"
+	flagCronWebhook = ""
+	flagCronOnce    = false
+)
+
+var cmdCron = &command{
+	name:            "cron",
+	positionalUsage: "schedule [ berlin | digital | funet | uiuc | url ]",
+	shortHelp:       "refreshes the database on a schedule",
+	help: `
+The cron command runs forever, refreshing the database on the schedule given.
+Each refresh fetches the lists given by '-lists' from the source given (see
+'goim help fetch'), and then loads the lists that changed since they were last
+loaded (see 'goim help load'). For example, this refreshes the essential lists
+from the 'berlin' FTP site every Monday at 4am:
+
+    goim cron -lists essential '0 4 * * 1' berlin
+
+The schedule is a cron expression with five fields: minute, hour, day of the
+month, month and day of the week (0 or 7 is Sunday). Each field may be '*', a
+number, a range like '1-5', a step like '*/15' or a comma separated list of
+them. '@hourly', '@daily', '@weekly', '@monthly' and '@yearly' may be used
+instead. Times are in the local time zone.
+
+Refreshes never overlap. If a refresh is still running when the next one is
+due, the next one is skipped. A lock file in the save directory also keeps
+refreshes of other 'goim cron' processes from overlapping with this one.
+
+When '-webhook' is set, a JSON object describing every refresh that fails or
+is skipped is posted to it. The object has the keys 'status' ('failed' or
+'skipped'), 'lists', 'source', 'started', 'finished', 'error' and 'output'
+(the end of the refresh's output).
+
+With '-once', a single refresh is run right away, which is useful when another
+scheduler (like the system's cron) runs goim.
+`,
+	flags: flag.NewFlagSet("cron", flag.ExitOnError),
+	run:   cmd_cron,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagCronLists, "lists", flagCronLists,
+			"A comma separated list of lists to refresh. See 'goim help load'.")
+		c.flags.StringVar(&flagCronWebhook, "webhook", flagCronWebhook,
+			"When set, failed and skipped refreshes are posted to this URL.")
+		c.flags.BoolVar(&flagCronOnce, "once", flagCronOnce,
+			"When set, a single refresh is run right away. The schedule\n"+
+				"may be omitted.")
+		addTLSFlags(c)
+		c.flags.StringVar(&flagLimitRate, "limit-rate", flagLimitRate,
+			"When set, downloads are limited to this many bytes per second\n"+
+				"in total (e.g., '500K' or '2M').")
+	},
+}
+
+func cmd_cron(c *command) bool {
+	defer handleSignals()()
+
+	if _, err := expandLists(flagCronLists); err != nil {
+		pef("%s", err)
+		return false
+	}
+	if flagCronOnce {
+		source := c.flags.Arg(0)
+		if c.flags.NArg() > 1 {
+			source = c.flags.Arg(1)
+		}
+		return c.refresh(source)
+	}
+
+	c.assertLeastNArg(1)
+	sched, err := parseCron(c.flags.Arg(0))
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	source := c.flags.Arg(1)
+	for {
+		next := sched.next(time.Now())
+		if next.IsZero() {
+			pef("The schedule '%s' never runs.", c.flags.Arg(0))
+			return false
+		}
+		logf("Next refresh at %s.", next.Format("2006-01-02 15:04"))
+		select {
+		case <-time.After(next.Sub(time.Now())):
+		case <-interrupted:
+			return true
+		}
+
+		c.refresh(source)
+
+		// Refreshes that were due while this one ran are skipped.
+		skipped := 0
+		for due := sched.next(next); !due.IsZero() && due.Before(time.Now()); {
+			skipped++
+			due = sched.next(due)
+		}
+		if skipped > 0 {
+			msg := sf("Skipped %d refreshes that were due while the refresh "+
+				"at %s was running.", skipped, next.Format("2006-01-02 15:04"))
+			logf("%s", msg)
+			notifyRefresh(refreshEvent{
+				Status: "skipped", Lists: flagCronLists, Source: source,
+				Started: next, Finished: time.Now(), Error: msg,
+			})
+		}
+		if stopping() {
+			return true
+		}
+	}
+}
+
+// refreshEvent is posted to the webhook when a refresh fails or is skipped.
+type refreshEvent struct {
+	Status   string    `json:"status"`
+	Lists    string    `json:"lists"`
+	Source   string    `json:"source"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Error    string    `json:"error"`
+	Output   string    `json:"output"`
+}
+
+// refresh fetches the lists in flagCronLists from the source given and loads
+// the lists that changed, each with a goim process of its own. Failures are
+// posted to the webhook.
+func (c *command) refresh(source string) bool {
+	ev := refreshEvent{
+		Lists:   flagCronLists,
+		Source:  source,
+		Started: time.Now(),
+	}
+	fail := func(status string, err error, out *tailWriter) bool {
+		pef("Refresh %s: %s", status, err)
+		ev.Status, ev.Error, ev.Finished = status, err.Error(), time.Now()
+		if out != nil {
+			ev.Output = out.String()
+		}
+		notifyRefresh(ev)
+		return false
+	}
+
+	dir := c.saveDir("")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fail("failed", ef("Could not create save directory: %s", err),
+			nil)
+	}
+	unlock, err := lockRefresh(dir)
+	if err != nil {
+		return fail("skipped", err, nil)
+	}
+	defer unlock()
+
+	logf("Refreshing lists %s...", flagCronLists)
+	common := []string{"-lists", flagCronLists}
+	if len(flagDb) > 0 {
+		common = append(common, "-db", flagDb)
+	}
+	if flagQuiet {
+		common = append(common, "-quiet")
+	}
+	fetchArgs := append([]string{"fetch"}, common...)
+	fetchArgs = append(fetchArgs, tlsArgs()...)
+	if len(flagLimitRate) > 0 {
+		fetchArgs = append(fetchArgs, "-limit-rate", flagLimitRate)
+	}
+	if len(source) > 0 {
+		fetchArgs = append(fetchArgs, source)
+	}
+	loadArgs := append([]string{"load", "-changed"}, common...)
+	loadArgs = append(loadArgs, "cache")
+
+	out := newTailWriter(4096)
+	for _, args := range [][]string{fetchArgs, loadArgs} {
+		if err := runGoim(args, out); err != nil {
+			return fail("failed", ef("'goim %s' failed: %s", args[0], err),
+				out)
+		}
+	}
+	logf("Refresh finished in %s.", time.Since(ev.Started))
+	return true
+}
+
+// runGoim runs goim with the arguments given and waits for it to finish. Its
+// output is copied to stderr and out. If this process is interrupted, the
+// interrupt is passed on so that it stops gracefully too. (The child is in a
+// process group of its own, so it doesn't get the interrupt twice when it
+// comes from the terminal. See childProcAttr.)
+func runGoim(args []string, out io.Writer) error {
+	goim, err := goimPath()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(goim, args...)
+	cmd.Stdout = io.MultiWriter(os.Stderr, out)
+	cmd.Stderr = cmd.Stdout
+	cmd.SysProcAttr = childProcAttr()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-interrupted:
+			cmd.Process.Signal(interruptedBy)
+		case <-done:
+		}
+	}()
+	return cmd.Wait()
+}
+
+// lockRefresh creates a lock file in the directory given so that refreshes
+// of different processes don't overlap. The lock file has the process ID of
+// its owner, so a lock left behind by a process that died is taken over. The
+// function returned removes the lock.
+func lockRefresh(dir string) (unlock func(), err error) {
+	lock := path.Join(dir, "refresh.lock")
+	for tries := 0; tries < 2; tries++ {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.WriteString(strconv.Itoa(os.Getpid()))
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, ef("Could not create lock file: %s", err)
+		}
+
+		bs, _ := ioutil.ReadFile(lock)
+		pid, err := strconv.Atoi(strings.TrimSpace(string(bs)))
+		if err == nil && processAlive(pid) {
+			return nil, ef("Another refresh (process %d) is still running.",
+				pid)
+		}
+		logf("Removing stale lock file %s.", lock)
+		os.Remove(lock)
+	}
+	return nil, ef("Could not lock %s.", lock)
+}
+
+// processAlive returns true if a process with the ID given is running.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// notifyRefresh posts the event given to the webhook, if one is set.
+func notifyRefresh(ev refreshEvent) {
+	postJSON(splitURLs(flagCronWebhook), ev)
+}
+
+// tailWriter keeps the last bytes written to it.
+type tailWriter struct {
+	buf []byte
+	max int
+}
+
+func newTailWriter(max int) *tailWriter {
+	return &tailWriter{max: max}
+}
+
+func (tw *tailWriter) Write(bs []byte) (int, error) {
+	tw.buf = append(tw.buf, bs...)
+	if len(tw.buf) > tw.max {
+		tw.buf = tw.buf[len(tw.buf)-tw.max:]
+	}
+	return len(bs), nil
+}
+
+func (tw *tailWriter) String() string {
+	return string(tw.buf)
+}
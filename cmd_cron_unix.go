@@ -0,0 +1,12 @@
+// +build !windows
+
+package main
+
+import "syscall"
+
+// childProcAttr puts a child goim in a process group of its own, so that an
+// interrupt from the terminal only reaches it once: when it's passed on by
+// runGoim.
+func childProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,9 @@
+package main
+
+import "syscall"
+
+// childProcAttr has nothing to set on Windows, which has no process groups
+// in the POSIX sense.
+func childProcAttr() *syscall.SysProcAttr {
+	return nil
+}
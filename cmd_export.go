@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	path "path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
+)
+
+var (
+	flagExportFormat = ""
+	flagExportTable  = ""
+	flagExportSearch = ""
+)
+
+// exportFormats maps the formats that 'goim export' writes to the options
+// given to DuckDB's COPY statement.
+var exportFormats = map[string]string{
+	"parquet": "FORMAT PARQUET",
+	"csv":     "FORMAT CSV, HEADER",
+	"json":    "FORMAT JSON",
+}
+
+var cmdExport = &command{
+	name:            "export",
+	positionalUsage: "file",
+	shortHelp:       "writes a table or search results to a Parquet file",
+	help: `
+The export command writes the rows of a table (with '-table') or the results
+of a search (with '-search') to the file given, so that they can be read by
+Spark, pandas, DuckDB and other data analysis tools without converting them
+first.
+
+The format is given with '-format', which is one of 'parquet' (the default),
+'csv' or 'json' (one object per line). If it isn't given, the extension of the
+file is used when it's one of the formats. Parquet files can be read into
+Apache Arrow tables directly (e.g., with pyarrow.parquet.read_table).
+
+Files are written with DuckDB, which reads SQLite and PostgreSQL databases with
+its 'sqlite' and 'postgres' extensions. (DuckDB downloads them the first time
+they're used.) So goim must be built with the 'duckdb' build tag.
+
+Search results have these columns: 'position' (starting at 1), 'entity',
+'atom_id', 'name', 'year', 'attrs', 'votes', 'rank' (out of 100), 'similarity'
+and 'confidence'. For example:
+
+    goim export -table rating ratings.parquet
+    goim export -search '{genre:horror} {votes:1000-}' horror.parquet
+`,
+	flags: flag.NewFlagSet("export", flag.ExitOnError),
+	run:   cmd_export,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagExportFormat, "format", flagExportFormat,
+			"The format of the file: 'parquet', 'csv' or 'json'.")
+		c.flags.StringVar(&flagExportTable, "table", flagExportTable,
+			"The table to export.")
+		c.flags.StringVar(&flagExportSearch, "search", flagExportSearch,
+			"A search query whose results are exported.")
+	},
+}
+
+func cmd_export(c *command) bool {
+	c.assertNArg(1)
+	dest := c.flags.Arg(0)
+
+	format := flagExportFormat
+	if len(format) == 0 {
+		format = strings.TrimPrefix(path.Ext(dest), ".")
+		if _, ok := exportFormats[format]; !ok {
+			format = "parquet"
+		}
+	}
+	opts, ok := exportFormats[format]
+	if !ok {
+		pef("Unknown format '%s'. Use 'parquet', 'csv' or 'json'.", format)
+		return false
+	}
+	if (len(flagExportTable) == 0) == (len(flagExportSearch) == 0) {
+		pef("Exactly one of '-table' or '-search' must be given.")
+		return false
+	}
+	var table imdb.Table
+	if len(flagExportTable) > 0 {
+		found := false
+		for _, t := range imdb.Schema() {
+			if t.Name == flagExportTable {
+				table, found = t, true
+			}
+		}
+		if !found {
+			pef("Unknown table '%s'. See 'goim schema tables'.",
+				flagExportTable)
+			return false
+		}
+	}
+
+	driver, dsn := c.dbinfo()
+	db := openDb(driver, dsn)
+	defer closeDb(db)
+
+	var results []search.Result
+	if len(flagExportSearch) > 0 {
+		if results, ok = c.queryResults(db, flagExportSearch, false); !ok {
+			return false
+		}
+	}
+
+	// Tables are read from the database itself when it's a DuckDB database.
+	// Otherwise, it's attached to an in-memory DuckDB database.
+	duck, from := db, ""
+	if driver != "duckdb" {
+		duck = openDb("duckdb", "")
+		defer closeDb(duck)
+		if len(table.Name) > 0 {
+			if err := attachSource(duck, driver, dsn); err != nil {
+				pef("%s", err)
+				return false
+			}
+			from = "src."
+		}
+	}
+
+	// Attached databases and temporary tables belong to a connection.
+	duck.SetMaxOpenConns(1)
+
+	var q string
+	if len(table.Name) > 0 {
+		var cols []string
+		for _, col := range table.Columns {
+			cols = append(cols, col.Name)
+		}
+		q = sf("SELECT %s FROM %s%s", strings.Join(cols, ", "), from,
+			table.Name)
+	} else {
+		if err := stageResults(duck, results); err != nil {
+			pef("Could not stage search results: %s", err)
+			return false
+		}
+		q = "SELECT * FROM export_results ORDER BY position"
+	}
+	_, err := duck.Exec(sf("COPY (%s) TO %s (%s)", q, sqlQuote(dest), opts))
+	if err != nil {
+		pef("Could not write '%s': %s", dest, err)
+		return false
+	}
+	return true
+}
+
+// stageResults puts the search results given in the 'export_results' table
+// of a DuckDB database, which only lasts as long as its connection.
+func stageResults(duck *imdb.DB, results []search.Result) error {
+	_, err := duck.Exec(`
+		CREATE TEMP TABLE export_results (
+			position INTEGER,
+			entity TEXT,
+			atom_id INTEGER,
+			name TEXT,
+			year INTEGER,
+			attrs TEXT,
+			votes INTEGER,
+			rank INTEGER,
+			similarity DOUBLE,
+			confidence DOUBLE
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	tx, err := duck.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO export_results VALUES ($1, $2, $3, $4, $5, $6, $7, $8,
+			$9, $10)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, r := range results {
+		var votes, rank interface{}
+		if !r.Rank.Unranked() {
+			votes, rank = r.Rank.Votes, r.Rank.Rank
+		}
+		_, err := stmt.Exec(i+1, r.Entity.String(), r.Id, r.Name, r.Year,
+			r.Attrs, votes, rank, r.Similarity, r.Confidence)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
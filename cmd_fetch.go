@@ -0,0 +1,385 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/ty/fun"
+)
+
+var (
+	flagFetchLists = "movies"
+	flagFetchDir   = ""
+	flagFetchForce = false
+	flagFetchList  = false
+)
+
+var cmdFetch = &command{
+	name: "fetch",
+	positionalUsage: "[ berlin | digital | funet | uiuc | " +
+		"ftp://... | http://... | https://... | ftps://... | " +
+		"rsync://... ]",
+	shortHelp: "downloads and verifies lists without loading them",
+	help: `
+The fetch command downloads lists into the save directory and verifies that
+each one is a complete gzip file. It never touches the database. The lists
+can then be loaded without a network connection with 'goim load cache'.
+
+This separates the network and database phases of loading, which is useful
+when the database is on a machine without access to the Internet: fetch the
+lists on a machine that has access, copy the save directory over and load
+from it.
+
+The save directory is the '-dir' flag, or 'save_dir' in the configuration
+file, or $XDG_DATA_HOME/goim/lists if neither is set.
+
+When 'list_store' is set in the configuration file, every list saved is also
+copied there, along with the manifest of the save directory. It may be another
+directory or a bucket in object storage, like 's3://bucket/goim' for Amazon S3
+or 'gs://bucket/goim' for Google Cloud Storage. 'goim load cache' then loads
+lists from the store instead of the save directory, so lists fetched on one
+machine can be loaded on others. Credentials for S3 are read from
+AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, with the region
+in AWS_REGION and other S3 compatible services at AWS_ENDPOINT_URL. Google
+Cloud Storage needs HMAC keys in GCS_ACCESS_KEY_ID and GCS_SECRET_ACCESS_KEY.
+
+Lists that are already in the save directory and are complete are skipped,
+unless '-force' is set. Lists from HTTP servers are downloaded again only if
+they changed since they were saved (according to their ETag or Last-Modified
+date). Lists from rsync servers are always synchronized, which only transfers
+the parts of each list that changed. The '-lists' flag accepts the same list
+names, presets and patterns as 'goim load'.
+
+With '-list', nothing is downloaded. Instead, the list files that the source
+offers are shown with their sizes and dates, along with the lists that goim
+can load but the source doesn't offer. This shows what a mirror has before
+loading from it.
+
+Large lists (like actors and plot) from HTTP servers that support ranges are
+downloaded in several segments at once, which is much faster on links with
+high latency. The segments are written into place in the same file, so the
+list is verified as a whole once they're all done. Use '-segments' to change
+how many segments are used.
+
+On an interrupt (SIGINT or SIGTERM), downloads in progress are abandoned
+without touching the lists already saved, and goim exits with status 130
+(SIGINT) or 143 (SIGTERM).
+`,
+	flags: flag.NewFlagSet("fetch", flag.ExitOnError),
+	run:   cmd_fetch,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagFetchLists, "lists", flagFetchLists,
+			"A comma separated list of lists to fetch. See 'goim help load'.")
+		c.flags.StringVar(&flagFetchDir, "dir", flagFetchDir,
+			"The directory to save lists in. When empty, the save\n"+
+				"directory in the configuration file is used.")
+		c.flags.BoolVar(&flagFetchForce, "force", flagFetchForce,
+			"When set, lists are downloaded even if they're already saved.")
+		c.flags.BoolVar(&flagFetchList, "list", flagFetchList,
+			"When set, the list files offered by the source are shown\n"+
+				"instead of being downloaded.")
+		c.flags.IntVar(&flagSegments, "segments", flagSegments,
+			"The number of connections that each large list is downloaded\n"+
+				"with from HTTP servers that support ranges. Set to 1 to\n"+
+				"download every list with a single connection.")
+		addTLSFlags(c)
+		c.flags.StringVar(&flagLimitRate, "limit-rate", flagLimitRate,
+			"When set, downloads are limited to this many bytes per second\n"+
+				"in total (e.g., '500K' or '2M').")
+	},
+}
+
+func cmd_fetch(c *command) bool {
+	defer handleSignals()()
+	if err := setLimitRate(flagLimitRate); err != nil {
+		pef("%s", err)
+		return false
+	}
+	if flagSegments < 1 {
+		pef("The number of segments must be at least 1.")
+		return false
+	}
+	lists, err := expandLists(flagFetchLists)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	getFrom := c.flags.Arg(0)
+	if len(getFrom) == 0 {
+		getFrom = "berlin"
+	}
+	fetch := newFetcher(getFrom)
+	if fetch == nil {
+		return false
+	}
+	if flagFetchList {
+		return showFiles(fetch)
+	}
+	if publishStore, err = c.listStore(); err != nil {
+		pef("%s", err)
+		return false
+	}
+	dir := c.saveDir(flagFetchDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		pef("Could not create save directory: %s", err)
+		return false
+	}
+
+	conns := maxFtpConns
+	if flagCpu < conns {
+		conns = flagCpu
+	}
+	fetchOne := func(name string) bool {
+		if stopping() {
+			return false
+		}
+		saveto := path.Join(dir, sf("%s.list.gz", name))
+		var old listVersion
+		if !flagFetchForce && verifyList(saveto) == nil {
+			// Lists from HTTP servers are downloaded again only if they've
+			// changed, and rsync only copies what changed. Others can't be
+			// checked, so they're kept.
+			old = readVersion(saveto)
+			_, isHttp := fetch.(httpFetcher)
+			_, isRsync := fetch.(rsyncFetcher)
+			if !isRsync && (!isHttp || old.empty()) {
+				logf("%s is already saved. Skipping.", name)
+				return true
+			}
+		}
+		if err := fetchList(fetch, name, saveto, old); err != nil {
+			pef("%s", err)
+			return false
+		}
+		return true
+	}
+	oks := fun.ParMapN(fetchOne, listFiles(lists), conns).([]bool)
+	return !fun.In(false, oks)
+}
+
+// showFiles prints the list files offered by the fetcher given with their
+// sizes and dates, followed by the lists that goim can load but the source
+// doesn't offer.
+func showFiles(fetch fetcher) bool {
+	lf, ok := fetch.(listingFetcher)
+	if !ok {
+		pef("Files can't be listed for this source.")
+		return false
+	}
+	files, err := lf.files()
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 2, 4, ' ', 0)
+	fmt.Fprintf(tw, "FILE\tSIZE\tMODIFIED\n")
+	for _, f := range files {
+		size, modified := "-", "-"
+		if f.size >= 0 {
+			size = prettyFileSize(f.size)
+		}
+		if !f.modified.IsZero() {
+			modified = f.modified.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.name, size, modified)
+	}
+	tw.Flush()
+
+	if missing := missingFiles(files); len(missing) > 0 {
+		pf("\nNot offered: %s\n", strings.Join(missing, ", "))
+	}
+	return true
+}
+
+// fetchList downloads the list given to a temporary file in the same
+// directory as saveto, verifies it and then renames it to saveto. So saveto
+// only ever has a complete list.
+//
+// Lists from HTTP servers aren't downloaded if they still have the version
+// given, and the version of a list downloaded is stored next to it. Every
+// list saved is added to the manifest of the save directory. Large
+// lists from HTTP servers that support ranges are downloaded in segments.
+func fetchList(fetch fetcher, name, saveto string, old listVersion) error {
+	if rf, ok := fetch.(rsyncFetcher); ok {
+		return rsyncList(rf, name, saveto)
+	}
+	if hf, ok := fetch.(httpFetcher); ok && flagSegments > 1 {
+		size, version, ok := hf.ranges(name)
+		if ok && size >= 2*minSegmentSize {
+			if !old.empty() && old == version {
+				logf("%s hasn't changed since it was saved. Skipping.", name)
+				return nil
+			}
+			logf("Downloading %s to %s in %d segments...",
+				name, saveto, flagSegments)
+			return saveList(name, saveto, version, func(tmp *os.File) error {
+				return hf.segmented(name, size, version, tmp)
+			})
+		}
+	}
+
+	var list io.ReadCloser
+	var version listVersion
+	var err error
+	if hf, ok := fetch.(httpFetcher); ok {
+		list, version, err = hf.listIfChanged(name, old)
+		if err == nil && list == nil {
+			logf("%s hasn't changed since it was saved. Skipping.", name)
+			return nil
+		}
+	} else {
+		list, err = fetch.list(name)
+	}
+	if err != nil {
+		return err
+	}
+	list = interruptible(list)
+	defer list.Close()
+
+	logf("Downloading %s to %s...", name, saveto)
+	return saveList(name, saveto, version, func(tmp *os.File) error {
+		_, err := io.Copy(tmp, list)
+		return err
+	})
+}
+
+// rsyncList copies the list given to saveto with rsync, which only transfers
+// the parts of the list that changed if saveto already exists. A list that
+// isn't complete afterwards is removed.
+func rsyncList(rf rsyncFetcher, name, saveto string) error {
+	logf("Synchronizing %s to %s...", name, saveto)
+	if err := rf.sync(name, saveto); err != nil {
+		return err
+	}
+	if err := verifyList(saveto); err != nil {
+		os.Remove(saveto)
+		return ef("Downloaded '%s' is broken: %s", name, err)
+	}
+	if err := writeVersion(saveto, listVersion{}); err != nil {
+		return ef("Could not save the version of '%s': %s", name, err)
+	}
+	if err := recordList(saveto); err != nil {
+		return ef("Could not add '%s' to the manifest: %s", name, err)
+	}
+	return publishList(saveto)
+}
+
+// saveList calls write with a temporary file in the same directory as saveto,
+// and renames the file to saveto once it's verified. The version given is
+// stored next to it.
+func saveList(
+	name, saveto string,
+	version listVersion,
+	write func(tmp *os.File) error,
+) error {
+	tmp, err := ioutil.TempFile(path.Dir(saveto), name+".part")
+	if err != nil {
+		return ef("Could not create file for '%s': %s", name, err)
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly after the rename
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return ef("Could not save '%s' to disk: %s", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return ef("Could not save '%s' to disk: %s", name, err)
+	}
+	if err := verifyList(tmp.Name()); err != nil {
+		return ef("Downloaded '%s' is broken: %s", name, err)
+	}
+	if err := os.Rename(tmp.Name(), saveto); err != nil {
+		return ef("Could not save '%s' to disk: %s", name, err)
+	}
+	if err := writeVersion(saveto, version); err != nil {
+		return ef("Could not save the version of '%s': %s", name, err)
+	}
+	if err := recordList(saveto); err != nil {
+		return ef("Could not add '%s' to the manifest: %s", name, err)
+	}
+	return publishList(saveto)
+}
+
+// verifyList returns an error if the list file given doesn't exist or isn't
+// a complete gzip file. (The checksum at the end of a gzip file is checked
+// once all of it is read.)
+func verifyList(fpath string) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	_, err = io.Copy(ioutil.Discard, gz)
+	return err
+}
+
+// listFiles returns the names of the list files that the lists given are
+// loaded from. The 'actors' list is loaded from the actors and actresses
+// files, and the 'crew' list from a file for each of its roles.
+func listFiles(lists []string) []string {
+	var files []string
+	for _, name := range lists {
+		switch name {
+		case "actors":
+			files = append(files, "actors", "actresses")
+		case "crew":
+			for _, crew := range crewLists {
+				files = append(files, crew.list)
+			}
+		default:
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// saveDir returns the directory that lists are saved in. The directory given
+// takes precedence, followed by 'save_dir' in the configuration file and
+// then $XDG_DATA_HOME/goim/lists.
+func (c *command) saveDir(dir string) string {
+	if len(dir) > 0 {
+		return dir
+	}
+	if conf, err := c.fetchConfig(); err == nil && len(conf.SaveDir) > 0 {
+		return conf.SaveDir
+	}
+	data := os.Getenv("XDG_DATA_HOME")
+	if len(data) == 0 {
+		data = path.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return path.Join(data, "goim", "lists")
+}
+
+// listStore returns the store that saved lists are copied to, which is
+// 'list_store' in the configuration file. It's nil if lists are only kept in
+// the save directory.
+func (c *command) listStore() (listStore, error) {
+	conf, err := c.fetchConfig()
+	if err != nil || len(conf.ListStore) == 0 {
+		return nil, nil
+	}
+	return newStore(conf.ListStore)
+}
+
+// fetchConfig returns the configuration that the save directory and list
+// store are read from.
+func (c *command) fetchConfig() (config, error) {
+	if strings.HasSuffix(flagDb, "toml") {
+		return c.config(flagDb)
+	}
+	return c.config("")
+}
@@ -15,7 +15,7 @@ const maxFtpConns = 5
 var cmdFtp = &command{
 	name: "ftp",
 	positionalUsage: "list-name ( berlin | digital | funet | uiuc | " +
-		"ftp://... )",
+		"ftp://... | ftps://... | ftpes://... )",
 	shortHelp: "downloads list files from FTP server",
 	help: `
 This is an undocumented command that downloads the given list from the given
@@ -27,9 +27,13 @@ process. I've had major problems closing/killing an FTP connection after a long
 download, so I've chosen to follow Ken Thompson's advice and use brute force.
 
 Here's more of the story: http://goo.gl/43ICUs
+
+FTPS is used for 'ftps://' (implicit TLS, port 990 by default) and 'ftpes://'
+(explicit TLS with AUTH TLS, port 21 by default) URLs.
 `,
-	flags: flag.NewFlagSet("ftp", flag.ExitOnError),
-	run:   cmd_ftp,
+	flags:    flag.NewFlagSet("ftp", flag.ExitOnError),
+	run:      cmd_ftp,
+	addFlags: addTLSFlags,
 }
 
 var namedFtp = map[string]string{
@@ -49,31 +53,10 @@ func ftpUrl(baseUri string, listName string) string {
 func cmd_ftp(c *command) bool {
 	c.assertLeastNArg(2)
 
-	listName, uri := c.flags.Arg(0), c.flags.Arg(1)
-	if v, ok := namedFtp[uri]; ok {
-		uri = v
-	}
-	loc, err := url.Parse(uri)
-	if err != nil {
-		pef("Could not parse URL '%s': %s", uri, err)
-		return false
-	}
-	if loc.User == nil {
-		loc.User = url.UserPassword("anonymous", "anonymous")
-	}
-	if !strings.Contains(loc.Host, ":") {
-		loc.Host += ":21"
-	}
-
-	conn, err := ftp.Connect(loc.Host)
+	listName := c.flags.Arg(0)
+	conn, loc, err := ftpConnect(c.flags.Arg(1))
 	if err != nil {
-		pef("Could not connect to '%s': %s", loc.Host, err)
-		return false
-	}
-
-	pass, _ := loc.User.Password()
-	if err := conn.Login(loc.User.Username(), pass); err != nil {
-		pef("Authentication failed for '%s': %s", loc.Host, err)
+		pef("%s", err)
 		return false
 	}
 
@@ -92,3 +75,53 @@ func cmd_ftp(c *command) bool {
 	// Don't even bother trying to close the connection.
 	return true
 }
+
+// ftpConnect connects and logs in to the FTP server in the URL given, which
+// may also be the name of a preset FTP site. The parsed URL is returned with
+// the connection. Anonymous logins are used when the URL has no user.
+func ftpConnect(uri string) (*ftp.ServerConn, *url.URL, error) {
+	if v, ok := namedFtp[uri]; ok {
+		uri = v
+	}
+	loc, err := url.Parse(uri)
+	if err != nil {
+		return nil, nil, ef("Could not parse URL '%s': %s", uri, err)
+	}
+	if loc.User == nil {
+		loc.User = url.UserPassword("anonymous", "anonymous")
+	}
+	if !strings.Contains(loc.Host, ":") {
+		if loc.Scheme == "ftps" {
+			loc.Host += ":990"
+		} else {
+			loc.Host += ":21"
+		}
+	}
+
+	var conn *ftp.ServerConn
+	switch loc.Scheme {
+	case "ftps", "ftpes":
+		host := loc.Host[:strings.LastIndex(loc.Host, ":")]
+		conf, tlsErr := tlsConfig(host)
+		if tlsErr != nil {
+			return nil, nil, tlsErr
+		}
+		opt := ftp.DialWithTLS(conf)
+		if loc.Scheme == "ftpes" {
+			opt = ftp.DialWithExplicitTLS(conf)
+		}
+		conn, err = ftp.Dial(loc.Host, opt)
+	default:
+		conn, err = ftp.Connect(loc.Host)
+	}
+	if err != nil {
+		return nil, nil, ef("Could not connect to '%s': %s", loc.Host, err)
+	}
+
+	pass, _ := loc.User.Password()
+	if err := conn.Login(loc.User.Username(), pass); err != nil {
+		return nil, nil, ef("Authentication failed for '%s': %s",
+			loc.Host, err)
+	}
+	return conn, loc, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var cmdGaps = &command{
+	name:            "gaps",
+	positionalUsage: "query",
+	shortHelp:       "reports missing and unaired episodes of a TV show",
+	help: `
+The gaps command checks the episodes of the TV show matching the search query
+given (or the TV show of the episode matching it) and reports what's missing or
+incomplete:
+
+    missing seasons     season numbers without episodes between the first
+                        and last seasons
+    missing episodes    episode numbers without episodes in each season, up
+                        to its last episode
+    duplicates          episodes with the same season and episode number as
+                        another episode
+    unnumbered          episodes without a season or episode number
+    unaired             episodes without a year, or with a year after this one
+    unrated             episodes without a rating (load the 'ratings' list)
+
+This is handy for validating a collection of episodes: an episode missing
+from a collection may be missing from IMDb's lists too, or not have aired
+yet. For example, both of these check Doctor Who:
+
+    goim gaps doctor who {tvshow} {years:1963}
+    goim gaps {show:doctor who {years:1963}}
+`,
+	flags: flag.NewFlagSet("gaps", flag.ExitOnError),
+	run:   cmd_gaps,
+	other: true,
+}
+
+func cmd_gaps(c *command) bool {
+	c.assertLeastNArg(1)
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	ent, ok := c.oneEntity(db)
+	if !ok {
+		return false
+	}
+	var tv *imdb.Tvshow
+	var err error
+	switch e := ent.(type) {
+	case *imdb.Tvshow:
+		tv = e
+	case *imdb.Episode:
+		if tv, err = e.Tvshow(db); err != nil {
+			pef("%s", err)
+			return false
+		}
+	default:
+		pef("%s is a %s, not a TV show. (Try adding '{tvshow}' to the "+
+			"query.)", ent, ent.Type())
+		return false
+	}
+	gaps, err := imdb.FindEpisodeGaps(db, tv)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+
+	pf("%s: %d episodes\n", tv, gaps.Episodes)
+	if gaps.Complete() {
+		pf("No gaps found.\n")
+		return true
+	}
+	if len(gaps.MissingSeasons) > 0 {
+		pf("\nMissing seasons: %s\n", joinInts(gaps.MissingSeasons))
+	}
+	if len(gaps.MissingEpisodes) > 0 {
+		pf("\nMissing episodes:\n")
+		for _, sg := range gaps.MissingEpisodes {
+			pf("    season %d: %s\n", sg.Season, joinInts(sg.Episodes))
+		}
+	}
+	printGapEpisodes("Duplicates", gaps.Duplicates)
+	printGapEpisodes("Unnumbered", gaps.Unnumbered)
+	printGapEpisodes("Unaired", gaps.Unaired)
+	printGapEpisodes("Unrated", gaps.Unrated)
+	return true
+}
+
+// printGapEpisodes prints a list of episodes under the heading given, if
+// there are any.
+func printGapEpisodes(heading string, eps []*imdb.Episode) {
+	if len(eps) == 0 {
+		return
+	}
+	pf("\n%s (%d):\n", heading, len(eps))
+	for _, ep := range eps {
+		pf("    S%02dE%02d %s\n", ep.Season, ep.EpisodeNum, ep)
+	}
+}
+
+// joinInts returns the integers given separated by commas.
+func joinInts(ns []int) string {
+	strs := make([]string, len(ns))
+	for i, n := range ns {
+		strs[i] = sf("%d", n)
+	}
+	return strings.Join(strs, ", ")
+}
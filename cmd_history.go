@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/tpl"
+)
+
+var flagHistoryLimit = 20
+
+var cmdHistory = &command{
+	name:            "history",
+	positionalUsage: "[ list | run id | clear ]",
+	shortHelp:       "review and re-run previous search queries",
+	help: `
+The history command lists, re-runs or clears the queries recorded in the
+search history. Each entry has an identifier, the time it was searched, the
+query and the result that was chosen (for commands that pick a single result,
+like 'rename' or 'short').
+
+    goim history
+    goim history run 42
+    goim history clear
+
+The history is only recorded when 'history = true' is set in the
+configuration file. When the '-db' flag is used with anything other than a
+configuration file, nothing is recorded.
+`,
+	flags: flag.NewFlagSet("history", flag.ExitOnError),
+	run:   cmd_history,
+	addFlags: func(c *command) {
+		c.flags.IntVar(&flagHistoryLimit, "limit", flagHistoryLimit,
+			"The maximum number of entries to list. Use -1 to list all\n"+
+				"entries.")
+	},
+}
+
+func cmd_history(c *command) bool {
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	args := c.flags.Args()
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch args[0] {
+	case "list":
+		entries, err := db.History(flagHistoryLimit)
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			pf("%5d  %s  %s", e.Id, e.Searched.Local().Format("2006-01-02 15:04"),
+				e.Query)
+			if e.Chosen > 0 {
+				pf("  => %s", historyChosen(db, e))
+			}
+			pf("\n")
+		}
+	case "run":
+		c.assertNArg(2)
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			pef("'%s' is not a history entry identifier.", args[1])
+			return false
+		}
+		e, err := db.HistoryEntry(id)
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		results, ok := c.queryResults(db, e.Query, false)
+		if !ok {
+			return false
+		}
+		template := c.tpl("search_result")
+		for i, result := range results {
+			attrs := tpl.Attrs{"Index": i + 1}
+			c.tplExec(template, tpl.Args{E: result, A: attrs})
+		}
+	case "clear":
+		if err := db.ClearHistory(); err != nil {
+			pef("%s", err)
+			return false
+		}
+	default:
+		c.showUsage()
+	}
+	return true
+}
+
+// historyChosen returns a description of the result chosen in a history
+// entry. If the entity can no longer be found (e.g., because the database
+// was reloaded), then its atom identifier is used.
+func historyChosen(db *imdb.DB, e imdb.HistoryEntry) string {
+	ent, err := imdb.FromAtom(db, e.Entity, e.Chosen)
+	if err != nil {
+		return sf("%s #%d", e.Entity, e.Chosen)
+	}
+	return sf("%s (%s)", ent, e.Entity)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/ty/fun"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var (
+	flagIndexDrop   = false
+	flagIndexCreate = false
+	flagIndexList   = false
+)
+
+var cmdIndex = &command{
+	name:            "index",
+	positionalUsage: "( -list | -drop | -create ) [ table ... ]",
+	shortHelp:       "lists, drops or creates the indices of tables",
+	help: `
+The index command manages the indices that 'goim load' drops before loading
+lists and creates afterwards. When given table names, only the indices of
+those tables are changed. Otherwise, the indices of every table are changed.
+
+Dropping indices before changing a lot of data (e.g., with your own bulk
+operations) and creating them again afterwards is much faster than changing
+the data with the indices in place:
+
+    goim index -drop credit
+    ... bulk operations on the credit table ...
+    goim index -create credit
+
+The '-list' flag shows every index along with whether it exists in the
+database. Trigram indices (used for fuzzy searching) are only created on
+PostgreSQL databases with the 'pg_trgm' extension.
+`,
+	flags: flag.NewFlagSet("index", flag.ExitOnError),
+	run:   cmd_index,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.BoolVar(&flagIndexList, "list", flagIndexList,
+			"When set, indices are listed.")
+		c.flags.BoolVar(&flagIndexDrop, "drop", flagIndexDrop,
+			"When set, indices are dropped.")
+		c.flags.BoolVar(&flagIndexCreate, "create", flagIndexCreate,
+			"When set, indices are created. (Indices that already exist\n"+
+				"are left alone.)")
+	},
+}
+
+func cmd_index(c *command) bool {
+	n := 0
+	for _, set := range []bool{flagIndexList, flagIndexDrop, flagIndexCreate} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		pef("Exactly one of '-list', '-drop' or '-create' must be given.")
+		return false
+	}
+
+	var tables []imdb.Table
+	for _, t := range imdb.Schema() {
+		if len(t.Indices) == 0 {
+			continue
+		}
+		if c.flags.NArg() == 0 || fun.In(t.Name, c.flags.Args()) {
+			tables = append(tables, t)
+		}
+	}
+	for _, name := range c.flags.Args() {
+		if len(tableIndices(name)) == 0 {
+			pef("Table '%s' doesn't exist or has no indices.", name)
+			return false
+		}
+	}
+
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	switch {
+	case flagIndexList:
+		existing, err := db.IndexNames()
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+		for _, t := range tables {
+			for _, idx := range t.Indices {
+				name := t.IndexName(idx)
+				status := "missing"
+				if fun.In(name, existing) {
+					status = "exists"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t(%s)\t%s\n", t.Name, name,
+					strings.Join(idx.Columns, ", "), status)
+			}
+		}
+		tw.Flush()
+	case flagIndexDrop:
+		for _, t := range tables {
+			logf("Dropping indices for %s...", t.Name)
+			if err := db.DropIndices(t.Name); err != nil {
+				pef("Could not drop indices for %s: %s", t.Name, err)
+				return false
+			}
+		}
+	case flagIndexCreate:
+		for _, t := range tables {
+			logf("Creating indices for %s...", t.Name)
+			start := time.Now()
+			if err := db.CreateIndices(t.Name); err != nil {
+				pef("Could not create indices for %s: %s", t.Name, err)
+				return false
+			}
+			logf("Done with %s in %s.", t.Name, time.Since(start))
+		}
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	uni "unicode"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var cmdKeys = &command{
+	name:            "keys",
+	positionalUsage: "query",
+	shortHelp:       "show every key that can be used to find an entity",
+	help: `
+The keys command shows every string stored for the entity matching the search
+query given that can be used to find it. This includes the IMDb key of the
+entity (the string that IMDb uses in its lists to identify it), its name,
+all AKA titles, normalized forms of those names (as they tend to appear in
+file names) and the years that a search would match.
+
+This is useful to debug why a search (or a file name given to 'goim rename')
+doesn't find the entity you expect.
+`,
+	flags: flag.NewFlagSet("keys", flag.ExitOnError),
+	run:   cmd_keys,
+	other: true,
+}
+
+func cmd_keys(c *command) bool {
+	c.assertLeastNArg(1)
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	ent, ok := c.oneEntity(db)
+	if !ok {
+		return false
+	}
+	keys, err := entityKeys(db, ent)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 2, 4, ' ', 0)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s\t%s\n", k[0], k[1])
+	}
+	tw.Flush()
+	return true
+}
+
+// entityKeys returns a list of pairs, where the first element of each pair
+// describes the second.
+func entityKeys(db *imdb.DB, ent imdb.Entity) (keys [][2]string, err error) {
+	defer csql.Safe(&err)
+
+	add := func(kind, key string) {
+		keys = append(keys, [2]string{kind, key})
+	}
+	add("atom", sf("%d", ent.Ident()))
+
+	imdbKey, err := entityImdbKey(db, ent)
+	csql.Panic(err)
+	var hash []byte
+	csql.Scan(db.QueryRow("SELECT hash FROM atom WHERE id = $1", ent.Ident()),
+		&hash)
+	h := imdb.HashKey([]byte(imdbKey))
+	if bytes.Equal(hash, h[:]) {
+		add("imdb key", imdbKey)
+	} else {
+		add("imdb key", imdbKey+" (reconstructed; does not match atom)")
+	}
+
+	var xrefs imdb.Xrefs
+	csql.Panic(ent.Attrs(db, &xrefs))
+	for _, x := range xrefs {
+		add("xref", x.String())
+	}
+
+	names := []string{ent.Name()}
+	add("name", ent.Name())
+	var akas imdb.AkaTitles
+	if ent.Type() != imdb.EntityActor {
+		csql.Panic(ent.Attrs(db, &akas))
+	}
+	for _, aka := range akas {
+		add("aka", aka.String())
+		names = append(names, aka.Title)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		for _, norm := range normalizedNames(name) {
+			if !seen[norm] {
+				seen[norm] = true
+				add("normalized", norm)
+			}
+		}
+	}
+
+	switch e := ent.(type) {
+	case *imdb.Movie:
+		if e.Year > 0 {
+			add("year", sf("%d", e.Year))
+			add("rename years", sf("%d-%d", e.Year-1, e.Year+1))
+		}
+	case *imdb.Tvshow:
+		if e.Year > 0 {
+			add("year", sf("%d", e.Year))
+		}
+		if e.YearStart > 0 {
+			if e.YearEnd > 0 {
+				add("aired", sf("%d-%d", e.YearStart, e.YearEnd))
+			} else {
+				add("aired", sf("%d-", e.YearStart))
+			}
+		}
+	case *imdb.Episode:
+		if e.Year > 0 {
+			add("year", sf("%d", e.Year))
+		}
+		if e.Season > 0 || e.EpisodeNum > 0 {
+			add("episode", sf("S%02dE%02d", e.Season, e.EpisodeNum))
+		}
+	}
+	return
+}
+
+// entityImdbKey reconstructs the string that IMDb uses to identify the
+// entity given in its lists. It is the string that is hashed to produce the
+// entity's atom.
+func entityImdbKey(db csql.Queryer, ent imdb.Entity) (string, error) {
+	year := func(y int, seq string) string {
+		s := "????"
+		if y > 0 {
+			s = sf("%d", y)
+		}
+		if len(seq) > 0 {
+			s += "/" + seq
+		}
+		return sf("(%s)", s)
+	}
+	switch e := ent.(type) {
+	case *imdb.Movie:
+		key := sf("%s %s", e.Title, year(e.Year, e.Sequence))
+		if e.Tv {
+			key += " (TV)"
+		}
+		if e.Video {
+			key += " (V)"
+		}
+		return key, nil
+	case *imdb.Tvshow:
+		return sf("\"%s\" %s", e.Title, year(e.Year, e.Sequence)), nil
+	case *imdb.Episode:
+		tv, err := e.Tvshow(db)
+		if err != nil {
+			return "", err
+		}
+		tvKey, _ := entityImdbKey(db, tv)
+		inBraces := e.Title
+		if e.Season > 0 || e.EpisodeNum > 0 {
+			inBraces += sf(" (#%d.%d)", e.Season, e.EpisodeNum)
+		}
+		return sf("%s {%s}", tvKey, strings.TrimSpace(inBraces)), nil
+	case *imdb.Actor:
+		// IMDb lists actors as 'Last, First', but Goim stores 'First Last'.
+		// This guess is wrong for last names with more than one word.
+		key := e.FullName
+		if i := strings.LastIndex(key, " "); i > -1 {
+			key = sf("%s, %s", key[i+1:], key[0:i])
+		}
+		if len(e.Sequence) > 0 {
+			key += sf(" (%s)", e.Sequence)
+		}
+		return key, nil
+	}
+	return "", ef("Unrecognized entity %T", ent)
+}
+
+// normalizedNames returns forms of the name given as they are likely to
+// appear in file names: lowercased with punctuation removed, and separated
+// by spaces, dots or underscores.
+func normalizedNames(name string) []string {
+	var buf []rune
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case uni.IsLetter(r) || uni.IsDigit(r):
+			buf = append(buf, r)
+		case uni.IsSpace(r) || r == '-' || r == ':' || r == '.':
+			buf = append(buf, ' ')
+		}
+	}
+	words := strings.Fields(string(buf))
+	if len(words) == 0 {
+		return nil
+	}
+	return []string{
+		strings.Join(words, " "),
+		strings.Join(words, "."),
+		strings.Join(words, "_"),
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	path "path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var flagLetterboxdNamespace = "letterboxd"
+
+var cmdLetterboxd = &command{
+	name:            "letterboxd",
+	positionalUsage: "file [ file ... ]",
+	shortHelp:       "imports the films of a Letterboxd export",
+	help: `
+The letterboxd command imports the CSV files of a Letterboxd export (or the
+whole export, as the ZIP file downloaded from Letterboxd) into an overlay (see
+'goim overlay'), so that they can be searched with the '{list:letterboxd}'
+directive.
+
+Every film in a file gets a tag named after the file, e.g., 'watched',
+'watchlist', 'ratings' or 'diary', or the name of a list (like
+'lists-favorites' for 'lists/favorites.csv' in a ZIP file). The value of the
+tag is the film's rating (from 0.5 to 5), its position in a list or the date
+it was watched or added, whichever the file has. Files without films, like
+'profile.csv', are skipped.
+
+Letterboxd exports don't have IMDb identifiers, so each film is searched for by
+its title, within a year of its year, and the best hit is used. Films that
+can't be found are skipped (and reported with the -warn flag).
+
+Like any overlay, importing replaces every tag in the namespace ('letterboxd',
+unless set with '-namespace'), so all of the files of an export should be
+imported together. For example:
+
+    goim letterboxd letterboxd-user-2024-01-01-00-00-utc.zip
+    goim search '{list:letterboxd} {tag:watchlist} {genre:horror}'
+`,
+	flags: flag.NewFlagSet("letterboxd", flag.ExitOnError),
+	run:   cmd_letterboxd,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagLetterboxdNamespace, "namespace",
+			flagLetterboxdNamespace,
+			"The overlay namespace that films are imported into.")
+		c.flags.BoolVar(&flagWarnings, "warn", flagWarnings,
+			"When set, warnings about films that can't be found will be "+
+				"shown.")
+	},
+}
+
+// letterboxdFilm is a film in a file of a Letterboxd export.
+type letterboxdFilm struct {
+	tag   string
+	name  string
+	year  int
+	value string
+}
+
+func cmd_letterboxd(c *command) bool {
+	c.assertLeastNArg(1)
+	var films []letterboxdFilm
+	for _, fpath := range c.flags.Args() {
+		fs, err := readLetterboxd(fpath)
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		films = append(films, fs...)
+	}
+
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	// Films are in more than one file (e.g., watched and rated), but each is
+	// only searched for once.
+	found := make(map[string]imdb.Atom)
+	var queries []string
+	for _, f := range films {
+		if _, ok := found[f.query()]; !ok {
+			found[f.query()] = 0
+			queries = append(queries, f.query())
+		}
+	}
+	logf("Searching for %d films...", len(queries))
+	for _, b := range c.batchSearch(db, queries) {
+		if b.Err != nil {
+			pef("%s: %s", b.Query, b.Err)
+			continue
+		}
+		if b.Best != nil {
+			found[b.Query] = b.Best.Id
+		}
+	}
+
+	var tags []overlayTag
+	skipped := 0
+	for _, f := range films {
+		id := found[f.query()]
+		if id == 0 {
+			warnf("Could not find film '%s (%d)' in '%s'. Skipping.",
+				f.name, f.year, f.tag)
+			skipped++
+			continue
+		}
+		tags = append(tags, overlayTag{id, f.tag, f.value})
+	}
+	if err := replaceOverlay(db, flagLetterboxdNamespace, tags); err != nil {
+		pef("%s", err)
+		return false
+	}
+	logf("Done. Added %d tags to namespace '%s' (skipped %d).",
+		len(tags), flagLetterboxdNamespace, skipped)
+	return true
+}
+
+// query returns the search query for the film.
+func (f letterboxdFilm) query() string {
+	return titleQuery(f.name, "movie", f.year)
+}
+
+// readLetterboxd reads the films in a CSV file of a Letterboxd export, or in
+// every CSV file of a ZIP file.
+func readLetterboxd(fpath string) ([]letterboxdFilm, error) {
+	if !strings.HasSuffix(strings.ToLower(fpath), ".zip") {
+		rows, err := readCSVFile(fpath)
+		if err != nil {
+			return nil, err
+		}
+		return letterboxdFilms(letterboxdTag(path.Base(fpath)), rows), nil
+	}
+
+	z, err := zip.OpenReader(fpath)
+	if err != nil {
+		return nil, ef("Could not open '%s': %s", fpath, err)
+	}
+	defer z.Close()
+	var films []letterboxdFilm
+	for _, zf := range z.File {
+		if !strings.HasSuffix(strings.ToLower(zf.Name), ".csv") {
+			continue
+		}
+		r, err := zf.Open()
+		if err != nil {
+			return nil, ef("Could not read '%s' in '%s': %s",
+				zf.Name, fpath, err)
+		}
+		rows, err := readCSV(r)
+		r.Close()
+		if err != nil {
+			return nil, ef("Could not read '%s' in '%s': %s",
+				zf.Name, fpath, err)
+		}
+		films = append(films, letterboxdFilms(letterboxdTag(zf.Name), rows)...)
+	}
+	return films, nil
+}
+
+// letterboxdTag returns the tag for the films in the file given, which is its
+// path without its extension (with dashes instead of slashes).
+func letterboxdTag(fname string) string {
+	fname = strings.TrimSuffix(fname, path.Ext(fname))
+	return strings.Replace(path.ToSlash(fname), "/", "-", -1)
+}
+
+// letterboxdFilms returns the films in the rows of a Letterboxd CSV file.
+// Films start after the first row with 'Name' and 'Year' columns, since list
+// exports start with a description of the list. If there's no such row, no
+// films are returned.
+func letterboxdFilms(tag string, rows [][]string) []letterboxdFilm {
+	for i, header := range rows {
+		cols := make(map[string]int)
+		for j, name := range header {
+			cols[strings.TrimSpace(name)] = j
+		}
+		if _, ok := cols["Name"]; !ok {
+			continue
+		}
+		if _, ok := cols["Year"]; !ok {
+			continue
+		}
+		field := func(row []string, name string) string {
+			if j, ok := cols[name]; ok && j < len(row) {
+				return strings.TrimSpace(row[j])
+			}
+			return ""
+		}
+
+		var films []letterboxdFilm
+		for _, row := range rows[i+1:] {
+			f := letterboxdFilm{tag: tag, name: field(row, "Name")}
+			if len(f.name) == 0 {
+				continue
+			}
+			f.year, _ = strconv.Atoi(field(row, "Year"))
+			for _, col := range []string{
+				"Rating", "Position", "Watched Date", "Date",
+			} {
+				if f.value = field(row, col); len(f.value) > 0 {
+					break
+				}
+			}
+			films = append(films, f)
+		}
+		return films
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLetterboxdFilms(t *testing.T) {
+	for _, test := range []struct {
+		tag  string
+		csv  string
+		want []letterboxdFilm
+	}{
+		{
+			"ratings",
+			"Date,Name,Year,Letterboxd URI,Rating\n" +
+				"2020-01-02,The Matrix,1999,https://boxd.it/1,4.5\n" +
+				"2020-01-03,\"Crouching Tiger, Hidden Dragon\",2000,,5\n",
+			[]letterboxdFilm{
+				{"ratings", "The Matrix", 1999, "4.5"},
+				{"ratings", "Crouching Tiger, Hidden Dragon", 2000, "5"},
+			},
+		},
+		{
+			"diary",
+			"Date,Name,Year,Letterboxd URI,Rating,Rewatch,Tags,Watched Date\n" +
+				"2021-05-01,Heat,1995,https://boxd.it/2,,Yes,,2021-04-30\n",
+			[]letterboxdFilm{{"diary", "Heat", 1995, "2021-04-30"}},
+		},
+		{
+			"lists-favorites",
+			"Letterboxd list export v7\n" +
+				"Date,Name,Tags,URL,Description\n" +
+				"2022-01-01,Favorites,,https://boxd.it/3,\"My\nfavorites\"\n" +
+				"\n" +
+				"Position,Name,Year,URL,Description\n" +
+				"1,Brazil,1985,https://boxd.it/4,\n" +
+				"2,Primer,,https://boxd.it/5,\n",
+			[]letterboxdFilm{
+				{"lists-favorites", "Brazil", 1985, "1"},
+				{"lists-favorites", "Primer", 0, "2"},
+			},
+		},
+		{
+			"profile",
+			"Date Joined,Username,Given Name\n2019-01-01,someone,Some\n",
+			nil,
+		},
+	} {
+		rows, err := readCSV(strings.NewReader(test.csv))
+		if err != nil {
+			t.Fatalf("%s: %s", test.tag, err)
+		}
+		got := letterboxdFilms(test.tag, rows)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\n got %#v\nwant %#v", test.tag, got, test.want)
+		}
+	}
+}
+
+func TestLetterboxdTag(t *testing.T) {
+	for fname, want := range map[string]string{
+		"watched.csv":         "watched",
+		"lists/favorites.csv": "lists-favorites",
+		"likes/films.csv":     "likes-films",
+	} {
+		if got := letterboxdTag(fname); got != want {
+			t.Errorf("%s: got %q, want %q", fname, got, want)
+		}
+	}
+}
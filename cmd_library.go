@@ -0,0 +1,254 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
+)
+
+var (
+	flagLibraryFormat = "csv"
+	flagLibraryAll    = false
+)
+
+var cmdLibrary = &command{
+	name:            "library",
+	positionalUsage: "library query",
+	shortHelp:       "compares a Plex or Jellyfin library to a search",
+	help: `
+The library command compares the movies and TV shows in a Plex or Jellyfin
+library with the results of a search, and reports the titles that are only in
+one of them. For example, with a watchlist kept as an overlay tag, this lists
+what's on the watchlist but not in the library yet (and what's in the library
+but not on the watchlist):
+
+    goim library movies.xml '{tag:watchlist} {limit:1000}'
+
+The library is a file (or an HTTP or HTTPS URL) with the response of the
+server's API, which is read directly:
+
+    Plex        the XML of '/library/sections/N/all?includeGuids=1', where
+                N is the section of the library. Give the token with
+                'X-Plex-Token=...' in the URL.
+    Jellyfin    the JSON of '/Items?Recursive=true&Fields=ProviderIds&
+                IncludeItemTypes=Movie,Series'. Give the API key with
+                'api_key=...' in the URL. (This works for Emby too.)
+
+Library items are matched to entities with their IMDb, TMDb or TVDB
+identifiers, which must be loaded as cross references first (see 'goim xref').
+Items without identifiers that are known are searched for by their title and
+year instead. Remember that searches return a limited number of results unless
+the query has a '{limit:N}' directive.
+
+The report is written to stdout as CSV (with a header) or JSON (with '-format
+json'), with these fields: 'status', 'title', 'year', 'entity', 'atom_id' and
+'ids' (the identifiers of library items, e.g., 'imdb:tt0133093'). The status
+is one of:
+
+    library-only    the item is in the library, but not in the search results
+    search-only     the search result is not in the library
+    unmatched       the library item doesn't match any entity
+    both            the item is in both (only reported with '-all')
+`,
+	flags: flag.NewFlagSet("library", flag.ExitOnError),
+	run:   cmd_library,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagLibraryFormat, "format", flagLibraryFormat,
+			"The format of the report: 'csv' or 'json'.")
+		c.flags.BoolVar(&flagLibraryAll, "all", flagLibraryAll,
+			"When set, titles in both the library and the search results\n"+
+				"are reported too.")
+		addTLSFlags(c)
+	},
+}
+
+// libraryDiff is a title reported by 'goim library'.
+type libraryDiff struct {
+	Status string `json:"status"`
+	Title  string `json:"title"`
+	Year   int    `json:"year,omitempty"`
+	Entity string `json:"entity"`
+	AtomId int    `json:"atom_id,omitempty"`
+	Ids    string `json:"ids,omitempty"`
+}
+
+func cmd_library(c *command) bool {
+	c.assertLeastNArg(2)
+	if !checkReportFormat(flagLibraryFormat) {
+		return false
+	}
+	uri := c.flags.Arg(0)
+	r, err := openURL(uri)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	items, err := readLibrary(r)
+	r.Close()
+	if err != nil {
+		pef("%s: %s", uri, err)
+		return false
+	}
+
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	query := strings.Join(c.flags.Args()[1:], " ")
+	results, ok := c.queryResults(db, query, false)
+	if !ok {
+		return false
+	}
+	atoms, err := matchLibrary(c, db, items)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	diffs := diffLibrary(items, atoms, results)
+
+	var report []libraryDiff
+	for _, d := range diffs {
+		if flagLibraryAll || d.Status != "both" {
+			report = append(report, d)
+		}
+	}
+	if err := writeLibraryReport(report, flagLibraryFormat); err != nil {
+		pef("%s", err)
+		return false
+	}
+	return true
+}
+
+// matchLibrary returns the atom identifier of each library item, which is 0
+// for items that don't match any entity. Items are matched by their
+// identifiers first, and the rest are searched for in one batch.
+func matchLibrary(
+	c *command,
+	db *imdb.DB,
+	items []libraryItem,
+) ([]imdb.Atom, error) {
+	atoms := make([]imdb.Atom, len(items))
+	var queries []string
+	var searched []int
+	for i, item := range items {
+		for _, source := range xrefSources {
+			id, ok := item.Ids[source]
+			if !ok {
+				continue
+			}
+			atom, err := imdb.AtomFromXref(db, source, id)
+			if err != nil {
+				return nil, err
+			}
+			if atom > 0 {
+				atoms[i] = atom
+				break
+			}
+		}
+		if atoms[i] == 0 {
+			queries = append(queries, item.query())
+			searched = append(searched, i)
+		}
+	}
+	for j, b := range c.batchSearch(db, queries) {
+		if b.Err != nil {
+			pef("%s: %s", b.Query, b.Err)
+			continue
+		}
+		if b.Best != nil {
+			atoms[searched[j]] = b.Best.Id
+		}
+	}
+	return atoms, nil
+}
+
+// query returns the search query for a library item that isn't matched by
+// its identifiers.
+func (item libraryItem) query() string {
+	return titleQuery(item.Title, item.Entity.String(), item.Year)
+}
+
+// diffLibrary compares the library items (with their atoms) to the search
+// results. Library items come first, in the order given, followed by the
+// search results that aren't in the library.
+func diffLibrary(
+	items []libraryItem,
+	atoms []imdb.Atom,
+	results []search.Result,
+) []libraryDiff {
+	inResults := make(map[imdb.Atom]bool, len(results))
+	for _, r := range results {
+		inResults[r.Id] = true
+	}
+	inLibrary := make(map[imdb.Atom]bool, len(items))
+	var diffs []libraryDiff
+	for i, item := range items {
+		d := libraryDiff{
+			Title:  item.Title,
+			Year:   item.Year,
+			Entity: item.Entity.String(),
+			AtomId: int(atoms[i]),
+			Ids:    item.ids(),
+		}
+		switch {
+		case atoms[i] == 0:
+			d.Status = "unmatched"
+		case inResults[atoms[i]]:
+			d.Status = "both"
+		default:
+			d.Status = "library-only"
+		}
+		inLibrary[atoms[i]] = true
+		diffs = append(diffs, d)
+	}
+	for _, r := range results {
+		if inLibrary[r.Id] {
+			continue
+		}
+		inLibrary[r.Id] = true // search results may repeat
+		diffs = append(diffs, libraryDiff{
+			Status: "search-only",
+			Title:  r.Name,
+			Year:   r.Year,
+			Entity: r.Entity.String(),
+			AtomId: int(r.Id),
+		})
+	}
+	return diffs
+}
+
+// ids returns the identifiers of a library item as a space separated list
+// of 'source:id' pairs, in the order of xrefSources.
+func (item libraryItem) ids() string {
+	var ids []string
+	for _, source := range xrefSources {
+		if id, ok := item.Ids[source]; ok {
+			ids = append(ids, source+":"+id)
+		}
+	}
+	return strings.Join(ids, " ")
+}
+
+// writeLibraryReport writes the titles given to stdout in the format given.
+func writeLibraryReport(diffs []libraryDiff, format string) error {
+	if diffs == nil {
+		diffs = []libraryDiff{}
+	}
+	var rows [][]string
+	for _, d := range diffs {
+		year, atom := "", ""
+		if d.Year > 0 {
+			year = strconv.Itoa(d.Year)
+		}
+		if d.AtomId > 0 {
+			atom = strconv.Itoa(d.AtomId)
+		}
+		rows = append(rows,
+			[]string{d.Status, d.Title, year, d.Entity, atom, d.Ids})
+	}
+	return writeReport(format, diffs,
+		[]string{"status", "title", "year", "entity", "atom_id", "ids"}, rows)
+}
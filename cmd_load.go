@@ -3,14 +3,17 @@ package main
 import (
 	"flag"
 	"io"
+	"os"
 	path "path/filepath"
 	"strings"
+	"time"
 
 	"github.com/kr/text"
 
 	"github.com/BurntSushi/ty/fun"
 
 	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
 )
 
 var (
@@ -18,62 +21,131 @@ var (
 	flagLoadUrls     = false
 	flagLoadLists    = "movies"
 	flagWarnings     = false
+	flagSearchIndex  = false
+	flagFranchises   = false
+	flagRatingHist   = false
+	flagLoadAnalyze  = true
+	flagLoadVacuum   = false
+	flagLoadReindex  = true
+	flagLoadMaxMem   = ""
+	flagLimitRate    = ""
+	flagLoadChanged  = false
+	flagLoadSave     = false
+	flagLoadWebhook  = ""
+
+	flagLoadCheckpoint = 500000
+	flagLoadResume     = false
+	flagLoadMaxBad     = 100
 )
 
 // loadLists is the set of all list names that may be passed on the command
-// line to be updated. Note that this list also specifies the *order* in
-// which lists are updated, which is respected regardless of the order given
-// on the command line. (This is important because tables like 'movies' should
-// always be updated before their corresponding attribute tables.)
-var loadLists = []string{
-	"movies", "actors",
-	"release-dates", "running-times", "aka-titles",
-	"alternate-versions", "color-info", "mpaa-ratings-reasons", "sound-mix",
-	"genres", "taglines", "trivia", "goofs", "language", "literature",
-	"locations", "movie-links", "quotes", "plot", "ratings",
+// line to be updated. Lists are loaded after the lists they depend on (see
+// listDeps), and otherwise in the order of this list, regardless of the order
+// given on the command line.
+//
+// The 'movies', 'actors' and 'crew' lists are always first. The rest are added
+// by RegisterList in the order in which they are registered.
+var loadLists = []string{"movies", "actors", "crew"}
+
+// ListHandler is a function that reads the contents of a single IMDb list
+// and stores it in the database. The atomizer given is read-only and may be
+// used to look up the atom identifiers of existing movies, TV shows, episodes
+// and actors.
+type ListHandler func(*imdb.DB, *imdb.Atomizer, io.ReadCloser) error
+
+// listHandlers maps list names to their loaders. Functions for loading movies
+// and actors are excluded from this map since they require some special
+// attention. (They are the only loaders that add atoms to the database.)
+var listHandlers = map[string]ListHandler{}
+
+// RegisterList makes a list available to 'goim load'. The name given is used
+// both on the command line (with the '-lists' flag) and to find the list
+// file, i.e., 'name.list.gz'. Lists registered this way are loaded after the
+// 'movies' and 'actors' lists, and may be loaded in parallel with other
+// registered lists. They depend on the 'movies' list, unless other
+// dependencies are given in listDeps.
+//
+// Custom lists (like private annotations or supplemental data sets) can be
+// added by including a file in this package that calls RegisterList in an
+// init function.
+//
+// RegisterList panics if a list with the same name has already been
+// registered.
+func RegisterList(name string, handler ListHandler) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if fun.In(name, loadLists) {
+		panic(sf("list '%s' is already registered", name))
+	}
+	loadLists = append(loadLists, name)
+	listHandlers[name] = handler
+	if _, ok := listTables[name]; !ok {
+		listTables[name] = nil
+	}
+	if _, ok := listDeps[name]; !ok {
+		listDeps[name] = []string{"movies"}
+	}
 }
 
-type listHandler func(*imdb.DB, *atomizer, io.ReadCloser) error
-
-var simpleLoaders = map[string]listHandler{
-	"release-dates":        listReleaseDates,
-	"running-times":        listRunningTimes,
-	"aka-titles":           listAkaTitles,
-	"alternate-versions":   listAlternateVersions,
-	"color-info":           listColorInfo,
-	"mpaa-ratings-reasons": listMPAARatings,
-	"sound-mix":            listSoundMixes,
-	"genres":               listGenres,
-	"taglines":             listTaglines,
-	"trivia":               listTrivia,
-	"goofs":                listGoofs,
-	"language":             listLanguages,
-	"literature":           listLiterature,
-	"locations":            listLocations,
-	"movie-links":          listMovieLinks,
-	"quotes":               listQuotes,
-	"plot":                 listPlots,
-	"ratings":              listRatings,
-	// Functions for loading movies and actors are excluded from this list
-	// since they require some special attention.
+func init() {
+	RegisterList("release-dates", listReleaseDates)
+	RegisterList("running-times", listRunningTimes)
+	RegisterList("aka-titles", listAkaTitles)
+	RegisterList("alternate-versions", listAlternateVersions)
+	RegisterList("color-info", listColorInfo)
+	RegisterList("mpaa-ratings-reasons", listMPAARatings)
+	RegisterList("sound-mix", listSoundMixes)
+	RegisterList("genres", listGenres)
+	RegisterList("taglines", listTaglines)
+	RegisterList("trivia", listTrivia)
+	RegisterList("goofs", listGoofs)
+	RegisterList("language", listLanguages)
+	RegisterList("literature", listLiterature)
+	RegisterList("locations", listLocations)
+	RegisterList("movie-links", listMovieLinks)
+	RegisterList("quotes", listQuotes)
+	RegisterList("plot", listPlots)
+	RegisterList("ratings", listRatings)
+	RegisterList("biographies", listBiographies)
 }
 
 var cmdLoad = &command{
 	name: "load",
 	positionalUsage: "[ berlin | digital | funet | uiuc | " +
-		"ftp://... | http://... | dir ]",
+		"ftp://... | http://... | https://... | ftps://... | " +
+		"rsync://... | dir | cache ]",
 	shortHelp: "creates/updates database with IMDb data",
 	help: `
 This command loads the current database with the contents of the IMDb
 database given. It may be a named FTP location, an FTP url, an HTTP url or
 a directory on the local file system. Regardless of how the location is
 specified, it must point to a directory (whether remote or local) containing 
-IMDb gzipped list files.
+IMDb gzipped list files. The special location 'cache' is the save directory of
+'goim fetch', which lets lists be downloaded separately and loaded without a
+network connection. (Every list must have been fetched before loading starts.
+When 'list_store' is set in the configuration file, lists are loaded from
+there instead. See 'goim help fetch'.) With '-save', lists from any other
+location are saved to the save directory as they're downloaded, and then
+loaded from there, so that they can be loaded again later without downloading
+them.
+
+HTTPS and FTPS urls work too (use 'ftps://' for implicit TLS and 'ftpes://'
+for explicit TLS). Extra certificates can be trusted with '-ca-file', or
+certificates can go unverified with '-insecure'.
+
+Some mirrors are only available over rsync ('rsync://...'), which requires the
+'rsync' program to be installed. Lists from rsync mirrors are best fetched
+into the save directory with 'goim fetch', since later fetches only transfer
+the parts of each list that changed.
 
 By default, the 'berlin' public FTP site is used and only the 'movies' table
 is updated. To update more tables, use the '-lists' flag. It is better to
 specify as many lists as possible, since they can be updated in parallel.
 
+Lists are always loaded after the lists they depend on. Every list depends on
+the 'movies' list, since the entities that other lists describe are created by
+it. A list can only be loaded when the lists it depends on are loaded with it
+or have been loaded before. Otherwise, nothing is loaded.
+
 This command can create a database from scratch or it can update an existing
 one. The update procedure is pretty brutish; in most cases, it truncates the
 table it's updating and rebuilds it. The only tables that are immune to this
@@ -82,6 +154,97 @@ are preserved across updating *if and only if* the primary keys provided by
 IMDb don't change. Unfortunately, IMDb primary keys can change (for example,
 by adding a title to an episode). This results in stale rows in the 'atom' and
 'name' tables (but will be hidden from search results).
+
+Lists other than the ones provided by IMDb may be loaded too, as long as
+a loader for them has been registered with RegisterList in Goim's source. Such
+lists are retrieved in the same way as IMDb lists (i.e., 'name.list.gz').
+
+The 'crew' list is special: it loads the lists of directors, writers,
+producers, composers, cinematographers and editors. People in these lists are
+stored along with actors, and their credits are stored with a role (e.g.,
+'director') that can be searched with '{role:...}'. Since actors and crew
+share the same tables, loading 'crew' always reloads the 'actors' list too.
+(And loading 'actors' without 'crew' removes all crew credits.)
+
+The '-search-index' flag builds the search index: a table with a copy of the
+name, year, attributes and rating of every entity. Simple searches (without
+sub-searches, genres, MPAA ratings, tags, roles or episode filters) read from
+this one table instead of joining several tables, which is much faster on
+large databases at the cost of some disk space. Once the index is built, it is
+rebuilt whenever the 'movies', 'actors', 'crew' or 'ratings' lists are loaded.
+
+The '-franchises' flag groups movies into franchises (e.g., every James Bond
+movie), which can then be searched with '{franchise:...}'. Movies are grouped
+when one follows or is a remake of another in the 'movie-links' list, or when
+their titles only differ by a sequel number, part or subtitle (e.g., 'Rocky'
+and 'Rocky II'). Once franchises are built, they're rebuilt whenever the
+'movies' or 'movie-links' lists are loaded.
+
+The '-rating-history' flag copies every rating into the rating history after
+the 'ratings' list is loaded, tagged with the generation of the load. Once
+the history has been recorded, it's recorded again whenever the 'ratings'
+list is loaded. It can be used to chart how the rating of a title changes
+over time. (See imdb.RatingHistory.)
+
+After loading, the database is maintained so that searches are fast right
+away: statistics used to plan queries are updated for every table loaded
+(ANALYZE) and indices that weren't rebuilt during the load are rebuilt
+(REINDEX). Each step can be turned off with a flag. Space left by deleted rows
+is only reclaimed (VACUUM) when '-vacuum' is set, since on SQLite, VACUUM
+rewrites the entire database (no matter how few lists were loaded), which can
+take a while and temporarily needs extra disk space.
+
+While loading lists other than 'movies', 'actors' and 'crew', rows are
+committed in batches (see '-checkpoint') along with how many rows of the list
+have been committed so far. If loading fails part way through a list (say,
+the connection drops or the machine crashes), running the same command again
+with '-resume' skips the rows that were already committed. Lists must be
+resumed from the same files, since rows are skipped by counting them. So a
+list whose version (see '-changed') differs from the version it was being
+loaded from isn't resumed, and fails to load instead.
+
+Searches can run while lists are loaded. On PostgreSQL, the tables of each
+list are rebuilt in shadow tables (e.g., 'movie_shadow'), which replace the
+tables in a single transaction once the list is loaded. Until then, searches
+see the old rows. SQLite databases are opened in WAL mode, so searches see the
+rows committed before they started instead of failing on a locked database.
+
+A row that the database rejects (e.g., because it violates a constraint) is
+logged and skipped, and the rest of the list is still loaded. A list fails to
+load once more than '-max-bad-rows' of its rows have been skipped. Inserts
+that fail because of a deadlock or a locked database are retried.
+
+The version (ETag or Last-Modified date) of every list loaded from an HTTP
+server is recorded. With '-changed', lists whose version is the same as the
+version last loaded are skipped, which makes a regular refresh nearly free
+when nothing changed. Lists fetched from an HTTP server with 'goim fetch' and
+loaded with 'goim load cache' keep their version too.
+
+The '-max-mem' flag sets a rough budget for the memory used while loading
+(e.g., '-max-mem 1.5G'). Buffers and the number of lists loaded at the same
+time are scaled down to fit it, and memory usage is reported periodically.
+The atom identifiers of every entity are always kept in memory, which takes
+a few hundred megabytes for all of IMDb's lists, so very small budgets can't
+be met.
+
+Loading stops gracefully on an interrupt (SIGINT or SIGTERM): no more lists
+are started, lists being loaded are rolled back to their last checkpoint and
+indices are recreated before the database is closed. goim then exits with
+status 130 (SIGINT) or 143 (SIGTERM). A second interrupt exits immediately.
+
+When '-webhook' or 'webhooks' in the configuration file is set, a summary of
+the load is posted to each URL as a JSON object once loading finishes, whether
+it succeeded or not. It has these keys: 'status' ('succeeded', 'partial' when
+some lists failed, 'failed' or 'interrupted'), 'lists', 'failed', 'tables'
+(the rows in each table changed, as 'before', 'after' and 'delta'), 'started',
+'finished', 'duration_seconds', 'errors', 'generation' and 'dataset'. This can
+be used to invalidate caches downstream or to post to a chat room.
+
+Every load that finishes stamps the database with a new generation, the time
+it was loaded and the date of the lists loaded (from the Last-Modified dates
+sent by HTTP servers, when they're known). 'goim size', 'goim search
+-generation' and ':generation' in 'goim repl' show them, so that you can tell
+how fresh results are.
 `,
 	flags: flag.NewFlagSet("load", flag.ExitOnError),
 	run:   cmd_load,
@@ -98,56 +261,111 @@ by adding a title to an episode). This results in stale rows in the 'atom' and
 			"Set to a comma separated list of IMDB movie lists to load, with\n"+
 				"no whitespace. Only lists named here will be loaded. If not\n"+
 				"specified, then only the 'movie' list is loaded.\n"+
-				"Use 'all' to load all lists or 'attr' to load all attribute\n"+
-				"lists (e.g., quotes, running times, etc.).\n"+
+				"Patterns like 'm*' match list names, and a leading '!'\n"+
+				"excludes lists, e.g., 'attr,!quotes,!trivia'.\n"+
+				"Presets may be used in place of (or along with) list names:\n"+
+				presetHelp()+
 				"Available lists: "+lists)
 		c.flags.BoolVar(&flagWarnings, "warn", flagWarnings,
 			"When set, warnings messages about the data will be shown.\n"+
 				"When enabled, this can produce a lot of output saying that\n"+
 				"an identifier could not be found for some entries. This is\n"+
 				"(likely) a result of inconsistent data in IMDb's text files.")
+		c.flags.BoolVar(&flagSearchIndex, "search-index", flagSearchIndex,
+			"When set, the search index is built after loading, even if\n"+
+				"it hasn't been built before.")
+		c.flags.BoolVar(&flagFranchises, "franchises", flagFranchises,
+			"When set, movies are grouped into franchises after loading,\n"+
+				"even if they haven't been grouped before.")
+		c.flags.BoolVar(&flagRatingHist, "rating-history", flagRatingHist,
+			"When set, ratings are copied into the rating history after\n"+
+				"the 'ratings' list is loaded, even if they haven't been\n"+
+				"recorded before.")
+		c.flags.BoolVar(&flagLoadAnalyze, "analyze", flagLoadAnalyze,
+			"When set, query planner statistics are updated for each table\n"+
+				"loaded.")
+		c.flags.BoolVar(&flagLoadVacuum, "vacuum", flagLoadVacuum,
+			"When set, the database is vacuumed after loading.")
+		c.flags.BoolVar(&flagLoadReindex, "reindex", flagLoadReindex,
+			"When set, indices that weren't rebuilt while loading are\n"+
+				"rebuilt after loading.")
+		c.flags.IntVar(&flagLoadCheckpoint, "checkpoint", flagLoadCheckpoint,
+			"The number of rows inserted between each commit. Loading can\n"+
+				"be resumed from the last commit with '-resume'. Set to 0\n"+
+				"to commit only after each list is loaded.")
+		c.flags.BoolVar(&flagLoadResume, "resume", flagLoadResume,
+			"When set, lists that failed to load part way through are\n"+
+				"resumed from their last checkpoint.")
+		c.flags.IntVar(&flagLoadMaxBad, "max-bad-rows", flagLoadMaxBad,
+			"The number of rows of each list that the database may reject\n"+
+				"before the list fails to load. Rejected rows are logged and\n"+
+				"skipped. Set to -1 to skip any number of them.")
+		c.flags.BoolVar(&flagLoadChanged, "changed", flagLoadChanged,
+			"When set, lists that haven't changed since they were last\n"+
+				"loaded are skipped. (Only lists from HTTP servers or\n"+
+				"fetched with 'goim fetch' from them can be checked.)")
+		c.flags.StringVar(&flagLoadWebhook, "webhook", flagLoadWebhook,
+			"A comma separated list of URLs that a JSON summary of the\n"+
+				"load is posted to when it finishes. (Along with 'webhooks'\n"+
+				"in the configuration file.)")
+		c.flags.BoolVar(&flagLoadSave, "save", flagLoadSave,
+			"When set, lists are saved to the save directory (see 'goim\n"+
+				"help fetch') as they're downloaded, and loaded from there.")
+		addTLSFlags(c)
+		c.flags.StringVar(&flagLimitRate, "limit-rate", flagLimitRate,
+			"When set, downloads from HTTP and FTP are limited to this\n"+
+				"many bytes per second in total (e.g., '500K' or '2M').")
+		c.flags.StringVar(&flagLoadMaxMem, "max-mem", flagLoadMaxMem,
+			"When set, memory used while loading is limited to roughly\n"+
+				"this size (e.g., '512M' or '2G') and reported periodically.")
 	},
 }
 
-func cmd_load(c *command) bool {
+func cmd_load(c *command) (ok bool) {
+	defer handleSignals()()
+	if err := setLimitRate(flagLimitRate); err != nil {
+		pef("%s", err)
+		return false
+	}
+	if len(flagLoadMaxMem) > 0 {
+		budget, err := parseSize(flagLoadMaxMem)
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		setMemBudget(budget)
+		defer reportMemory(budget, 30*time.Second)()
+	}
+
+	// With SQLite, loading is much faster without synchronous writes. It is
+	// still safe from application crashes (e.g., bugs in Goim), but not safe
+	// from power failures or operating system crashes.
 	driver, dsn := c.dbinfo()
+	dbOptions.SQLite = imdb.SQLiteLoad
 	db := openDb(driver, dsn)
 	defer closeDb(db)
+	if db.Driver == "duckdb" {
+		pef("DuckDB databases can't be loaded directly. Load a SQLite or " +
+			"PostgreSQL database and copy it with 'goim analytics'.")
+		return false
+	}
 
-	// With SQLite, we can get some performance benefit by disabling
-	// synchronous writes.
-	// It is still safe from application crashes (e.g., bugs in Goim), but
-	// not safe from power failures or operating system crashes.
-	// I think we're OK with that, right?
-	if db.Driver == "sqlite3" {
-		_, err := db.Exec("PRAGMA synchronous = OFF")
-		if err != nil {
-			pef("Could not disable SQLite synchronous mode: %s", err)
-			return false
-		}
+	// Lists that fail to load, which are reported to webhooks along with the
+	// rest of the load.
+	failed := make(map[string]bool)
+	hooks := splitURLs(flagLoadWebhook)
+	if conf, err := c.fetchConfig(); err == nil {
+		hooks = append(hooks, conf.Webhooks...)
 	}
+	report := newLoadReport(hooks)
+	defer func() { report.send(db, ok, failed) }()
 
 	// Figure out which lists we're loading and make sure each list name is
 	// valid before proceeding.
-	var userLoadLists []string
-	if flagLoadLists == "all" {
-		userLoadLists = loadLists
-	} else if flagLoadLists == "attr" {
-		for _, name := range loadLists {
-			if name == "movies" || name == "actors" {
-				continue
-			}
-			userLoadLists = append(userLoadLists, name)
-		}
-	} else {
-		for _, name := range strings.Split(flagLoadLists, ",") {
-			name = strings.ToLower(strings.TrimSpace(name))
-			if !fun.In(name, loadLists) {
-				pef("%s is not a valid list name. See 'goim help load'.", name)
-				return false
-			}
-			userLoadLists = append(userLoadLists, name)
-		}
+	userLoadLists, err := expandLists(flagLoadLists)
+	if err != nil {
+		report.errorf("%s", err)
+		return false
 	}
 
 	// Build the "fetcher" to retrieve lists (whether it be from the file
@@ -157,17 +375,45 @@ func cmd_load(c *command) bool {
 		getFrom = "berlin"
 	}
 
+	// Loading from the cache must not need the network, so make sure every
+	// list is there before doing anything else.
+	if getFrom == "cache" {
+		getFrom = c.saveDir("")
+		if conf, err := c.fetchConfig(); err == nil && len(conf.ListStore) > 0 {
+			getFrom = conf.ListStore
+		}
+		store, err := newStore(getFrom)
+		if err != nil {
+			report.errorf("%s", err)
+			return false
+		}
+		files, err := store.files()
+		if err != nil {
+			report.errorf("%s", err)
+			return false
+		}
+		have := make(map[string]bool, len(files))
+		for _, f := range files {
+			have[f.name] = true
+		}
+		for _, name := range listFiles(userLoadLists) {
+			if !have[sf("%s.list.gz", name)] {
+				report.errorf(
+					"The %s list isn't in %s. Use 'goim fetch' first.",
+					name, getFrom)
+				return false
+			}
+		}
+	}
+
 	// Just print the URLs to download.
 	if flagLoadUrls {
 		fetch := newFetcher(getFrom)
 		if fetch == nil {
 			return false
 		}
-		for _, list := range userLoadLists {
-			pf("%s\n", fetch.location(list))
-			if list == "actors" {
-				pf("%s\n", fetch.location("actresses"))
-			}
+		for _, name := range listFiles(userLoadLists) {
+			pf("%s\n", fetch.location(name))
 		}
 		return true
 	}
@@ -182,12 +428,20 @@ func cmd_load(c *command) bool {
 		}
 
 		download := func(name string) struct{} {
+			if name == "crew" {
+				for _, crew := range crewLists {
+					if err := downloadList(fetch, crew.list); err != nil {
+						report.errorf("%s", err)
+					}
+				}
+				return struct{}{}
+			}
 			if err := downloadList(fetch, name); err != nil {
-				pef("%s", err)
+				report.errorf("%s", err)
 			}
 			if name == "actors" {
 				if err := downloadList(fetch, "actresses"); err != nil {
-					pef("%s", err)
+					report.errorf("%s", err)
 				}
 			}
 			return struct{}{}
@@ -205,16 +459,83 @@ func cmd_load(c *command) bool {
 	if fetch == nil {
 		return false
 	}
+	if flagLoadSave {
+		gf := fetch.(gzipFetcher)
+		if _, ok := gf.fetcher.(dirFetcher); ok {
+			logf("Lists are being loaded from a directory, so they aren't " +
+				"saved again.")
+		} else {
+			dir := c.saveDir("")
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				report.errorf("Could not create save directory: %s", err)
+				return false
+			}
+			if publishStore, err = c.listStore(); err != nil {
+				report.errorf("%s", err)
+				return false
+			}
+			fetch = gzipFetcher{savingFetcher{gf.fetcher, dir}}
+		}
+	}
+
+	// Find the versions of the list files being loaded, so that they can be
+	// recorded once they're loaded. With '-changed', lists that haven't
+	// changed since they were last loaded are skipped.
+	versions := make(map[string]listVersion)
+	var changed []string
+	for _, name := range userLoadLists {
+		if unchangedList(db, fetch, name, versions) && flagLoadChanged {
+			logf("The %s list hasn't changed since it was last loaded. "+
+				"Skipping.", name)
+			continue
+		}
+		changed = append(changed, name)
+	}
+	if len(changed) == 0 {
+		logf("No lists have changed since they were last loaded.")
+		return true
+	}
+	userLoadLists = changed
+	toRecord := append([]string(nil), userLoadLists...)
+	loadingVersions = versions
+
+	// The search index has copies of names, years and ratings.
+	searchStale := false
+	for _, name := range []string{"movies", "actors", "crew", "ratings"} {
+		if loaderIndex(name, userLoadLists) > -1 {
+			searchStale = true
+		}
+	}
+
+	// Franchises are guessed from the titles of movies and their links.
+	franchisesStale := loaderIndex("movies", userLoadLists) > -1 ||
+		loaderIndex("movie-links", userLoadLists) > -1
+
+	// Rating history is only recorded when there are new ratings.
+	ratingsLoaded := loaderIndex("ratings", userLoadLists) > -1
+
+	loaded := loadedTables(userLoadLists)
+
+	// Make sure every list can be loaded before changing anything, and
+	// figure out the order to load them in.
+	userLoadLists, err = orderLists(userLoadLists, func(name string) bool {
+		return listLoaded(db, name)
+	})
+	if err != nil {
+		report.errorf("%s", err)
+		return false
+	}
 
 	// Get the tables with indices corresponding to the lists we're updating.
 	tables, err := tablesFromLists(db, userLoadLists)
 	if err != nil {
-		pef("%s", err)
+		report.errorf("%s", err)
 		return false
 	}
+	report.begin(db, userLoadLists)
 	logf("Dropping indices for: %s", strings.Join(tables, ", "))
 	if err := db.DropIndices(tables...); err != nil {
-		pef("Could not drop indices: %s", err)
+		report.errorf("Could not drop indices: %s", err)
 		return false
 	}
 
@@ -224,17 +545,31 @@ func cmd_load(c *command) bool {
 	// they are the only loaders that *add* atoms to the database.
 	if in := loaderIndex("movies", userLoadLists); in > -1 {
 		if err := loadMovies(driver, dsn, fetch); err != nil {
-			pef("%s", err)
+			report.errorf("%s", err)
+			failed["movies"] = true
+			if stopping() {
+				interruptedLoad(report, db, tables)
+			}
 			return false
 		}
 		userLoadLists = append(userLoadLists[:in], userLoadLists[in+1:]...)
 	}
-	if in := loaderIndex("actors", userLoadLists); in > -1 {
-		if err := loadActors(driver, dsn, fetch); err != nil {
-			pef("%s", err)
+	withCrew := loaderIndex("crew", userLoadLists) > -1
+	if withCrew || loaderIndex("actors", userLoadLists) > -1 {
+		if err := loadActors(driver, dsn, fetch, withCrew); err != nil {
+			report.errorf("%s", err)
+			failed["actors"] = true
+			if stopping() {
+				interruptedLoad(report, db, tables)
+			}
 			return false
 		}
-		userLoadLists = append(userLoadLists[:in], userLoadLists[in+1:]...)
+		for _, name := range []string{"actors", "crew"} {
+			if in := loaderIndex(name, userLoadLists); in > -1 {
+				userLoadLists = append(userLoadLists[:in],
+					userLoadLists[in+1:]...)
+			}
+		}
 	}
 
 	// This must be done after movies/actors are loaded so that we get all
@@ -243,14 +578,17 @@ func cmd_load(c *command) bool {
 		logf("Reading atom identifiers from database...")
 		atoms, err := newAtomizer(db, nil) // read-only
 		if err != nil {
-			pef("%s", err)
+			report.errorf("%s", err)
 			return false
 		}
 		simpleLoad := func(name string) bool {
-			loader := simpleLoaders[name]
+			if stopping() {
+				return false
+			}
+			loader := listHandlers[name]
 			if loader == nil {
 				// This is a bug since we should have verified all list names.
-				logf("BUG: %s does not have a simpler loader.", name)
+				logf("BUG: %s does not have a registered loader.", name)
 				return true
 			}
 
@@ -259,13 +597,13 @@ func cmd_load(c *command) bool {
 
 			list, err := fetch.list(name)
 			if err != nil {
-				pef("%s", err)
+				report.errorf("%s", err)
 				return false
 			}
 			defer list.Close()
 
 			if err := loader(db, atoms, list); err != nil {
-				pef("Could not store %s list: %s", name, err)
+				report.errorf("Could not store %s list: %s", name, err)
 				return false
 			}
 			return true
@@ -283,22 +621,380 @@ func cmd_load(c *command) bool {
 				maxConcurrent = maxFtpConns
 			}
 		}
-		fun.ParMapN(simpleLoad, userLoadLists, maxConcurrent)
+		if maxLoadConcurrent > 0 && maxConcurrent > maxLoadConcurrent {
+			maxConcurrent = maxLoadConcurrent
+		}
+
+		// Lists in the same level don't depend on each other, so they can be
+		// loaded in parallel. Lists that depend on a list that failed to
+		// load are skipped.
+		levels, err := listLevels(userLoadLists)
+		if err != nil {
+			report.errorf("%s", err)
+			return false
+		}
+		for _, level := range levels {
+			if stopping() {
+				for _, name := range level {
+					failed[name] = true
+				}
+				continue
+			}
+			var ready []string
+			for _, name := range level {
+				for _, dep := range listDeps[name] {
+					if failed[dep] {
+						report.errorf("Skipping the %s list since the %s "+
+							"list failed to load.", name, dep)
+						failed[name] = true
+					}
+				}
+				if !failed[name] {
+					ready = append(ready, name)
+				}
+			}
+			oks := fun.ParMapN(simpleLoad, ready, maxConcurrent).([]bool)
+			for i, ok := range oks {
+				if !ok {
+					failed[ready[i]] = true
+				}
+			}
+		}
+	}
+
+	for _, name := range toRecord {
+		if failed[name] {
+			continue
+		}
+		for _, file := range listFiles([]string{name}) {
+			if err := setLoadedVersion(db, file, versions[file]); err != nil {
+				report.errorf("Could not record the version of %s: %s",
+					file, err)
+			}
+		}
 	}
 
 	logf("Creating indices for: %s", strings.Join(tables, ", "))
+	for _, table := range tables {
+		if parts, err := db.Partitions(table); err == nil && len(parts) > 0 {
+			logf("Indexing the %d partitions of %s in parallel.",
+				len(parts), table)
+		}
+	}
 	if err := db.CreateIndices(tables...); err != nil {
-		pef("Could not create indices: %s", err)
+		report.errorf("Could not create indices: %s", err)
+		return false
+	}
+	if stopping() {
+		interruptedLoad(report, db, nil)
+		return false
+	}
+
+	if flagSearchIndex || (searchStale && rowCount(db, "search_index") > 0) {
+		logf("Building search index...")
+		if err := search.BuildIndex(db); err != nil {
+			report.errorf("Could not build search index: %s", err)
+			return false
+		}
+		// Its indices are rebuilt by BuildIndex.
+		loaded = append(loaded, "search_index")
+		tables = append(tables, "search_index")
+	}
+	if flagFranchises ||
+		(franchisesStale && rowCount(db, "franchise") > 0) {
+		logf("Grouping movies into franchises...")
+		n, err := imdb.BuildFranchises(db)
+		if err != nil {
+			report.errorf("Could not build franchises: %s", err)
+			return false
+		}
+		logf("Found %d franchises.", n)
+		// Its indices are rebuilt by BuildFranchises.
+		loaded = append(loaded, "franchise")
+		tables = append(tables, "franchise")
+	}
+	if ratingsLoaded && !failed["ratings"] &&
+		(flagRatingHist || rowCount(db, "rating_history") > 0) {
+		logf("Recording rating history...")
+		// Like changes, ratings are recorded in the generation that's about
+		// to begin.
+		cur, err := db.Generation()
+		if err != nil {
+			report.errorf("Could not record rating history: %s", err)
+			return false
+		}
+		n, err := imdb.RecordRatingHistory(db, cur+1)
+		if err != nil {
+			report.errorf("Could not record rating history: %s", err)
+			return false
+		}
+		logf("Recorded %d ratings.", n)
+		loaded = append(loaded, "rating_history")
+	}
+	if !maintainAfterLoad(report, db, loaded, tables) {
+		return false
+	}
+
+	// Changes to entities are recorded in the generation that's about to
+	// begin, so that they can be found later with imdb.ChangesSince.
+	var kinds []imdb.EntityKind
+	var kindNames []string
+	for _, table := range loaded {
+		if kind, ok := imdb.Entities[table]; ok {
+			kinds = append(kinds, kind)
+			kindNames = append(kindNames, table)
+		}
+	}
+	if len(kinds) > 0 {
+		logf("Recording changes to: %s", strings.Join(kindNames, ", "))
+		cur, err := db.Generation()
+		if err == nil {
+			err = db.RecordChanges(cur+1, kinds...)
+		}
+		if err != nil {
+			report.errorf("Could not record changes: %s", err)
+			return false
+		}
+	}
+
+	var recorded []string
+	for _, name := range toRecord {
+		if !failed[name] {
+			recorded = append(recorded, name)
+		}
+	}
+	gen, err := db.NextGeneration(datasetDate(versions, recorded))
+	if err != nil {
+		report.errorf("Could not update database generation: %s", err)
 		return false
 	}
+	report.Generation = gen
+	err = db.RecordListGenerations(gen, listFiles(recorded)...)
+	if err != nil {
+		report.errorf("Could not record the generation of loaded "+
+			"lists: %s", err)
+	}
+	if snap, err := db.Snapshot(); err == nil {
+		logf("Database is now at %s.", snap)
+		if !snap.Dataset.IsZero() {
+			report.Dataset = snap.Dataset.Format("2006-01-02")
+		}
+	} else {
+		logf("Database is now at generation %d.", gen)
+	}
+	return true
+}
+
+// interruptedLoad finishes a load that was interrupted by recreating the
+// indices of the tables given, so that the database is left usable.
+func interruptedLoad(report *loadReport, db *imdb.DB, tables []string) {
+	if len(tables) > 0 {
+		logf("Creating indices for: %s", strings.Join(tables, ", "))
+		if err := db.CreateIndices(tables...); err != nil {
+			report.errorf("Could not create indices: %s", err)
+		}
+	}
+	report.errorf("Loading was interrupted. Lists that didn't finish " +
+		"loading were rolled back to their last checkpoint, and can be " +
+		"resumed with '-resume'.")
+}
+
+// maintainAfterLoad runs the maintenance enabled by flags on the tables
+// loaded. Indices of tables not in rebuilt are reindexed, since they were
+// updated in place.
+func maintainAfterLoad(
+	report *loadReport,
+	db *imdb.DB,
+	loaded, rebuilt []string,
+) bool {
+	if flagLoadReindex {
+		var reindex []string
+		for _, table := range loaded {
+			if !fun.In(table, rebuilt) && len(tableIndices(table)) > 0 {
+				reindex = append(reindex, table)
+			}
+		}
+		if len(reindex) > 0 {
+			logf("Rebuilding indices for: %s", strings.Join(reindex, ", "))
+			if err := db.Reindex(reindex...); err != nil {
+				report.errorf("Could not rebuild indices: %s", err)
+				return false
+			}
+		}
+	}
+	if flagLoadVacuum {
+		logf("Vacuuming database...")
+		if err := db.Vacuum(); err != nil {
+			report.errorf("Could not vacuum database: %s", err)
+			return false
+		}
+	}
+	if flagLoadAnalyze {
+		logf("Updating statistics for: %s", strings.Join(loaded, ", "))
+		if err := db.Analyze(loaded...); err != nil {
+			report.errorf("Could not update statistics: %s", err)
+			return false
+		}
+	}
 	return true
 }
 
+// loadedTables returns every table changed by loading the lists given.
+func loadedTables(lists []string) []string {
+	var tables []string
+	for _, name := range lists {
+		for _, table := range listTables[name] {
+			if !fun.In(table, tables) {
+				tables = append(tables, table)
+			}
+		}
+	}
+	return tables
+}
+
+// tableIndices returns the indices of the table given.
+func tableIndices(table string) []imdb.Index {
+	for _, t := range imdb.Schema() {
+		if t.Name == table {
+			return t.Indices
+		}
+	}
+	return nil
+}
+
+// listPresets maps names that can be given to '-lists' to the lists they
+// stand for. The 'all' (or 'everything') and 'attr' presets aren't here,
+// since they depend on which lists are registered.
+var listPresets = map[string][]string{
+	"essential": {
+		"movies", "actors", "ratings", "genres", "plot", "release-dates",
+		"running-times", "mpaa-ratings-reasons",
+	},
+	"search-only": {
+		"movies", "actors", "crew", "ratings", "genres",
+		"mpaa-ratings-reasons", "biographies", "aka-titles", "movie-links",
+	},
+	"tv-only": {
+		"movies", "ratings", "genres", "plot", "release-dates",
+	},
+}
+
+// presetDescriptions describes each preset for 'goim help load'.
+var presetDescriptions = []struct{ name, desc string }{
+	{"essential", "what most people need: searching and basic information"},
+	{"search-only", "only what's needed by every search directive"},
+	{"tv-only", "TV shows and episodes with ratings, genres and plots\n" +
+		"(the 'movies' list has movies and TV shows alike)"},
+	{"attr", "every list except 'movies', 'actors', 'crew' and lists\n" +
+		"about people (like 'biographies')"},
+	{"all", "every list (also 'everything')"},
+}
+
+func presetHelp() string {
+	var help string
+	for _, p := range presetDescriptions {
+		desc := strings.Replace(p.desc, "\n", "\n"+strings.Repeat(" ", 15), -1)
+		help += sf("  %-11s  %s\n", p.name, desc)
+	}
+	return help
+}
+
+// presetLists returns the lists of the preset given, and false if there is
+// no such preset.
+func presetLists(name string) ([]string, bool) {
+	switch name {
+	case "all", "everything":
+		return loadLists, true
+	case "attr":
+		var lists []string
+		for _, name := range loadLists {
+			if name == "movies" || name == "actors" || name == "crew" {
+				continue
+			}
+			// Lists about people can't be loaded without people.
+			if fun.In("actors", listDeps[name]) {
+				continue
+			}
+			lists = append(lists, name)
+		}
+		return lists, true
+	}
+	lists, ok := listPresets[name]
+	return lists, ok
+}
+
+// expandLists returns the lists named by the comma separated list names,
+// presets and patterns given. Each list appears at most once.
+//
+// Patterns use the syntax of filepath.Match (e.g., 'm*') and match against
+// the names of every registered list. Names, presets and patterns starting
+// with a '!' exclude lists instead. When only exclusions are given, they
+// exclude lists from every list.
+func expandLists(spec string) ([]string, error) {
+	var include, exclude []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		excluding := strings.HasPrefix(name, "!")
+		name = strings.TrimPrefix(name, "!")
+
+		matched, err := matchLists(name)
+		if err != nil {
+			return nil, err
+		}
+		if excluding {
+			exclude = append(exclude, matched...)
+		} else {
+			include = append(include, matched...)
+		}
+	}
+	if len(include) == 0 && len(exclude) > 0 {
+		include = loadLists
+	}
+
+	var lists []string
+	for _, name := range include {
+		if !fun.In(name, lists) && !fun.In(name, exclude) {
+			lists = append(lists, name)
+		}
+	}
+	if len(lists) == 0 {
+		return nil, ef("'%s' doesn't leave any lists to load.", spec)
+	}
+	return lists, nil
+}
+
+// matchLists returns the lists named by a single list name, preset or
+// pattern. It's an error if nothing matches.
+func matchLists(name string) ([]string, error) {
+	if preset, ok := presetLists(name); ok {
+		return preset, nil
+	}
+	if fun.In(name, loadLists) {
+		return []string{name}, nil
+	}
+	var matched []string
+	for _, list := range loadLists {
+		ok, err := path.Match(name, list)
+		if err != nil {
+			return nil, ef("Invalid list pattern '%s': %s", name, err)
+		}
+		if ok {
+			matched = append(matched, list)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, ef("%s is not a valid list name, preset or pattern. "+
+			"See 'goim help load'.", name)
+	}
+	return matched, nil
+}
+
 func downloadList(fetch fetcher, name string) error {
 	list, err := fetch.list(name)
 	if err != nil {
 		return err
 	}
+	list = interruptible(list)
 	defer list.Close()
 
 	saveto := path.Join(flagLoadDownload, sf("%s.list.gz", name))
@@ -326,7 +1022,7 @@ func loadMovies(driver, dsn string, fetch fetcher) error {
 	return nil
 }
 
-func loadActors(driver, dsn string, fetch fetcher) error {
+func loadActors(driver, dsn string, fetch fetcher, withCrew bool) error {
 	list1, err := fetch.list("actors")
 	if err != nil {
 		return err
@@ -339,10 +1035,22 @@ func loadActors(driver, dsn string, fetch fetcher) error {
 	}
 	defer list2.Close()
 
+	var crew []crewList
+	if withCrew {
+		for _, c := range crewLists {
+			list, err := fetch.list(c.list)
+			if err != nil {
+				return err
+			}
+			defer list.Close()
+			crew = append(crew, crewList{c.role, c.list, list})
+		}
+	}
+
 	db := openDb(driver, dsn)
 	defer closeDb(db)
 
-	if err := listActors(db, list1, list2); err != nil {
+	if err := listActors(db, list1, list2, crew); err != nil {
 		return ef("Could not store actors/actresses list: %s", err)
 	}
 	return nil
@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/BurntSushi/csql"
+	"github.com/BurntSushi/ty/fun"
 
 	"github.com/BurntSushi/goim/imdb"
 )
@@ -52,6 +53,10 @@ func (mf mapFetcher) list(name string) (io.ReadCloser, error) {
 	return readCloser{strings.NewReader(mf[name])}, nil
 }
 
+func (mf mapFetcher) location(name string) string {
+	return name
+}
+
 func init() {
 	var err error
 	testDB, err = imdb.Open(testDriver, testDsn)
@@ -79,4 +84,49 @@ func TestLoadMovies(t *testing.T) {
 	if episodes != exp["episodes"] {
 		t.Fatalf("Expected %d episodes but got %d", exp["episodes"], episodes)
 	}
+
+	// The two Simpsons episodes are numbered absolutely in season order.
+	abs := csql.Count(testDB, "SELECT MAX(abs_num) FROM episode")
+	if abs != 2 {
+		t.Fatalf("Expected a maximum absolute episode number of 2 but got %d",
+			abs)
+	}
+}
+
+func TestExpandLists(t *testing.T) {
+	lists, err := expandLists("quotes, essential,movies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 1+len(listPresets["essential"]) || lists[0] != "quotes" {
+		t.Fatalf("unexpected lists: %v", lists)
+	}
+	if _, err := expandLists("movies,nope"); err == nil {
+		t.Fatal("expected an error for an invalid list name")
+	}
+
+	lists, err = expandLists("m*,!movie-links")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lists, ",") != "movies,mpaa-ratings-reasons" {
+		t.Fatalf("unexpected lists for pattern: %v", lists)
+	}
+	lists, err = expandLists("!actors,!crew")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fun.In("actors", lists) || len(lists) != len(loadLists)-2 {
+		t.Fatalf("unexpected lists for exclusions: %v", lists)
+	}
+	if _, err := expandLists("movies,!movies"); err == nil {
+		t.Fatal("expected an error when no lists are left")
+	}
+	for name, preset := range listPresets {
+		for _, list := range preset {
+			if !fun.In(list, loadLists) {
+				t.Errorf("preset %s has unknown list %s", name, list)
+			}
+		}
+	}
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var (
+	flagOverlayDelete = false
+)
+
+var cmdOverlay = &command{
+	name:            "overlay",
+	positionalUsage: "namespace [ csv-file ]",
+	shortHelp:       "loads user provided tags for media into a namespace",
+	help: `
+The overlay command loads a CSV file of user provided data into the database.
+Each row of the CSV file must have the form:
+
+    entity,tag[,value]
+
+Where 'entity' is the IMDb key of a movie, TV show, episode or actor exactly
+as it appears in IMDb's lists (e.g., 'The Matrix (1999)' or
+'"Firefly" (2002)'), or an IMDb identifier loaded with 'goim xref' (e.g.,
+'tt0133093'). 'tag' is a short name for the data (e.g., 'owned' or
+'my-rating') and 'value' is an optional free form value (e.g., '9' or
+'Netflix').
+
+All tags are stored in the namespace given. Loading a CSV file into a
+namespace replaces all of the tags previously in that namespace, but leaves
+all other namespaces alone. Overlays are never touched by the load command,
+so they survive updates of IMDb's data.
+
+If no CSV file is given, then it is read from stdin.
+
+Rows with entities that cannot be found in the database are skipped (and
+reported with the -warn flag).
+
+Tags can be searched with the {tag:NAME} directive and shown with the
+'overlays' command.
+`,
+	flags: flag.NewFlagSet("overlay", flag.ExitOnError),
+	run:   cmd_overlay,
+	addFlags: func(c *command) {
+		c.flags.BoolVar(&flagOverlayDelete, "delete", flagOverlayDelete,
+			"When set, all tags in the namespace given are deleted and\n"+
+				"no CSV file is read.")
+		c.flags.BoolVar(&flagWarnings, "warn", flagWarnings,
+			"When set, warnings about skipped rows will be shown.")
+	},
+}
+
+func cmd_overlay(c *command) bool {
+	if c.flags.NArg() < 1 || c.flags.NArg() > 2 {
+		c.showUsage()
+	}
+	namespace := strings.TrimSpace(c.flags.Arg(0))
+	if len(namespace) == 0 {
+		pef("The namespace of an overlay cannot be empty.")
+		return false
+	}
+
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	var rows [][]string
+	if !flagOverlayDelete {
+		var err error
+		if rows, err = readCSVFile(c.flags.Arg(1)); err != nil {
+			pef("%s", err)
+			return false
+		}
+	}
+	if err := loadOverlay(db, namespace, rows); err != nil {
+		pef("%s", err)
+		return false
+	}
+	return true
+}
+
+// overlayTag is a tag of an entity in an overlay.
+type overlayTag struct {
+	id         imdb.Atom
+	tag, value string
+}
+
+// loadOverlay replaces all tags in the namespace given with the rows given.
+// Each row must have two or three fields: an entity key string (or an IMDb
+// identifier), a tag name and an optional value.
+func loadOverlay(db *imdb.DB, namespace string, rows [][]string) (err error) {
+	defer csql.Safe(&err)
+
+	var atoms *imdb.Atomizer
+	if len(rows) > 0 {
+		logf("Loading atoms...")
+		atoms, err = newAtomizer(db, nil)
+		csql.Panic(err)
+	}
+
+	var tags []overlayTag
+	skipped := 0
+	for i, row := range rows {
+		if len(row) < 2 || len(row) > 3 {
+			csql.Panic(ef("Row %d has %d fields, but overlays must have "+
+				"2 or 3 fields: entity,tag[,value]", i+1, len(row)))
+		}
+		tag := strings.TrimSpace(row[1])
+		if len(tag) == 0 {
+			csql.Panic(ef("Row %d has an empty tag.", i+1))
+		}
+		var value string
+		if len(row) == 3 {
+			value = strings.TrimSpace(row[2])
+		}
+		id, ok, err := resolveEntity(db, atoms, strings.TrimSpace(row[0]))
+		csql.Panic(err)
+		if !ok {
+			warnf("Could not find entity '%s' (row %d). Skipping.", row[0], i+1)
+			skipped++
+			continue
+		}
+		tags = append(tags, overlayTag{id, tag, value})
+	}
+	csql.Panic(replaceOverlay(db, namespace, tags))
+	logf("Done. Added %d tags to namespace '%s' (skipped %d).",
+		len(tags), namespace, skipped)
+	return
+}
+
+// replaceOverlay replaces all tags in the namespace given with the tags
+// given.
+//
+// The old tags are deleted and the new ones are added in the same
+// transaction, so that a failure leaves the namespace untouched.
+func replaceOverlay(
+	db *imdb.DB,
+	namespace string,
+	tags []overlayTag,
+) (err error) {
+	defer csql.Safe(&err)
+
+	csql.Panic(db.DropIndices("overlay"))
+	defer func() { csql.Panic(db.CreateIndices("overlay")) }()
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	csql.Exec(tx, "DELETE FROM overlay WHERE namespace = $1", namespace)
+	ins, err := csql.NewInserter(tx, db.Driver, "overlay",
+		"namespace", "atom_id", "tag", "value")
+	csql.Panic(err)
+	for _, t := range tags {
+		csql.Panic(ins.Exec(namespace, t.id, t.tag, t.value))
+	}
+	csql.Panic(ins.Exec())
+	csql.Panic(tx.Commit())
+	return
+}
+
+// readCSVFile reads all records from the CSV file at the path given. If the
+// path is empty or "-", then the CSV data is read from stdin.
+// Records may have a varying number of fields and empty lines are ignored.
+func readCSVFile(fpath string) ([][]string, error) {
+	var r io.Reader = os.Stdin
+	if len(fpath) > 0 && fpath != "-" {
+		f, err := os.Open(fpath)
+		if err != nil {
+			return nil, ef("Could not open '%s': %s", fpath, err)
+		}
+		defer f.Close()
+		r = f
+	}
+	return readCSV(r)
+}
+
+// readCSV reads all records from r, like readCSVFile.
+func readCSV(r io.Reader) ([][]string, error) {
+	csvr := csv.NewReader(r)
+	csvr.FieldsPerRecord = -1
+	csvr.TrimLeadingSpace = true
+	rows, err := csvr.ReadAll()
+	if err != nil {
+		return nil, ef("Could not read CSV data: %s", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"time"
+)
+
+var cmdPartition = &command{
+	name:            "partition",
+	positionalUsage: "[ (name | credit) partitions ]",
+	shortHelp:       "partitions large tables on PostgreSQL",
+	help: `
+The partition command splits the 'name' or 'credit' table of a PostgreSQL
+database into the number of partitions given. Rows are assigned to partitions
+by hashing their atom identifiers. Searching and loading work the same way on
+partitioned tables, but their indices are built on every partition in parallel,
+which makes 'goim load' much faster on very large databases. For example:
+
+    goim partition name 8
+    goim partition credit 8
+
+A number of partitions less than 2 turns a partitioned table back into a
+regular table. Existing rows are copied in either case, so this can take a
+while.
+
+With no arguments, the partitions of each table are listed.
+`,
+	flags: flag.NewFlagSet("partition", flag.ExitOnError),
+	run:   cmd_partition,
+	other: true,
+}
+
+func cmd_partition(c *command) bool {
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	if c.flags.NArg() == 0 {
+		for _, table := range []string{"name", "credit"} {
+			parts, err := db.Partitions(table)
+			if err != nil {
+				pef("%s", err)
+				return false
+			}
+			if len(parts) == 0 {
+				pf("%s: not partitioned\n", table)
+			} else {
+				pf("%s: %d partitions\n", table, len(parts))
+			}
+		}
+		return true
+	}
+
+	c.assertNArg(2)
+	table := c.flags.Arg(0)
+	parts, err := strconv.Atoi(c.flags.Arg(1))
+	if err != nil {
+		pef("Could not parse '%s' as a number of partitions.", c.flags.Arg(1))
+		return false
+	}
+
+	logf("Partitioning %s into %d partitions...", table, parts)
+	start := time.Now()
+	if err := db.Partition(table, parts); err != nil {
+		pef("Could not partition %s: %s", table, err)
+		return false
+	}
+	logf("Done with %s in %s.", table, time.Since(start))
+	return true
+}
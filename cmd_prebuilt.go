@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/klauspost/pgzip"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var (
+	flagPrebuiltForce    = false
+	flagPrebuiltDescribe = false
+)
+
+// prebuiltMeta describes a pre-built database that is published for 'goim
+// get-prebuilt'. It's published as JSON next to the database, in a file with
+// the same name plus '.json'.
+type prebuiltMeta struct {
+	SHA256     string    `json:"sha256"`
+	Size       int64     `json:"size"`
+	Generation int       `json:"generation"`
+	Loaded     time.Time `json:"loaded"`
+	Dataset    string    `json:"dataset,omitempty"`
+}
+
+var cmdGetPrebuilt = &command{
+	name:            "get-prebuilt",
+	positionalUsage: "url",
+	shortHelp:       "downloads a pre-built SQLite database",
+	help: `
+The get-prebuilt command downloads a SQLite database that someone else has
+already loaded and puts it in place of the configured database. This is for
+people who just want to search, without spending hours loading lists.
+
+The url is the location of the database file (HTTP, HTTPS or a local path),
+which may be compressed with gzip if its name ends with '.gz'. Next to it must
+be a JSON file with the same name plus '.json', which has the SHA-256 checksum
+('sha256') and 'size' of the database file as published, along with the
+generation of its data ('generation', 'loaded' and 'dataset'). The download is
+only put in place if it matches.
+
+An existing database is only replaced with '-force'. The configured database
+must be a SQLite database.
+
+To publish a database, run this command with '-describe' and the path of the
+database file as it will be published (compressed or not), which writes the
+JSON file next to it. For example:
+
+    gzip -k goim.sqlite
+    goim get-prebuilt -describe goim.sqlite.gz
+`,
+	flags: flag.NewFlagSet("get-prebuilt", flag.ExitOnError),
+	run:   cmd_get_prebuilt,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.BoolVar(&flagPrebuiltForce, "force", flagPrebuiltForce,
+			"When set, an existing database is replaced.")
+		c.flags.BoolVar(&flagPrebuiltDescribe, "describe",
+			flagPrebuiltDescribe,
+			"When set, the JSON file that describes the database file\n"+
+				"given is written next to it, so that it can be published.")
+		c.flags.StringVar(&flagLimitRate, "limit-rate", flagLimitRate,
+			"Limits the download rate, e.g., '2M' for two megabytes per\n"+
+				"second.")
+		addTLSFlags(c)
+	},
+}
+
+func cmd_get_prebuilt(c *command) bool {
+	c.assertNArg(1)
+	if flagPrebuiltDescribe {
+		return describePrebuilt(c.flags.Arg(0))
+	}
+	defer handleSignals()()
+	if err := setLimitRate(flagLimitRate); err != nil {
+		pef("%s", err)
+		return false
+	}
+	uri := c.flags.Arg(0)
+
+	driver, dest := c.dbinfo()
+	if driver != "sqlite3" {
+		pef("Pre-built databases can only replace SQLite databases, but "+
+			"the configured database is a %s database.", driver)
+		return false
+	}
+	if _, err := os.Stat(dest); err == nil && !flagPrebuiltForce {
+		pef("'%s' already exists. Use '-force' to replace it.", dest)
+		return false
+	}
+
+	var meta prebuiltMeta
+	r, err := openURL(uri + ".json")
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	err = json.NewDecoder(r).Decode(&meta)
+	r.Close()
+	if err != nil {
+		pef("Could not read '%s.json': %s", uri, err)
+		return false
+	}
+
+	logf("Downloading %s (%s, generation %d)...",
+		uri, prettyFileSize(meta.Size), meta.Generation)
+	tmp := dest + ".download"
+	defer os.Remove(tmp)
+	r, err = openURL(uri)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	size, sum, err := unpackPrebuilt(r, strings.HasSuffix(uri, ".gz"), tmp)
+	r.Close()
+	if err != nil {
+		pef("Could not download '%s': %s", uri, err)
+		return false
+	}
+	if size != meta.Size || sum != meta.SHA256 {
+		pef("The download doesn't match '%s.json': got %d bytes with "+
+			"checksum %s, but expected %d bytes with checksum %s.",
+			uri, size, sum, meta.Size, meta.SHA256)
+		return false
+	}
+
+	// The database is opened once, which also migrates it if it was built
+	// by an older version of Goim.
+	snap, err := prebuiltSnapshot(tmp, false)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	if snap.Generation != meta.Generation {
+		pef("The downloaded database is at generation %d, but '%s.json' "+
+			"says it's at generation %d.", snap.Generation, uri,
+			meta.Generation)
+		return false
+	}
+
+	// The write-ahead log of the database being replaced must not be
+	// applied to the new one.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dest + suffix); err != nil && !os.IsNotExist(err) {
+			pef("Could not remove '%s%s': %s", dest, suffix, err)
+			return false
+		}
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		pef("Could not move database into place: %s", err)
+		return false
+	}
+	logf("Database '%s' is now at %s.", dest, snap)
+	return true
+}
+
+// describePrebuilt writes the JSON file that describes a pre-built database
+// file, which may be compressed.
+func describePrebuilt(fpath string) bool {
+	size, sum, err := fileChecksum(fpath)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	db := fpath
+	if strings.HasSuffix(fpath, ".gz") {
+		f, err := os.Open(fpath)
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		db = strings.TrimSuffix(fpath, ".gz") + ".describe"
+		defer os.Remove(db)
+		_, _, err = unpackPrebuilt(f, true, db)
+		f.Close()
+		if err != nil {
+			pef("Could not decompress '%s': %s", fpath, err)
+			return false
+		}
+	}
+	// The database is opened read-only, so that its checksum still holds.
+	snap, err := prebuiltSnapshot(db, true)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+
+	meta := prebuiltMeta{
+		SHA256:     sum,
+		Size:       size,
+		Generation: snap.Generation,
+		Loaded:     snap.Loaded,
+	}
+	if !snap.Dataset.IsZero() {
+		meta.Dataset = snap.Dataset.Format("2006-01-02")
+	}
+	bs, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	if err := ioutil.WriteFile(fpath+".json", bs, 0644); err != nil {
+		pef("%s", err)
+		return false
+	}
+	logf("Wrote '%s.json' for %s.", fpath, snap)
+	return true
+}
+
+// openURL opens a file on an HTTP server or in the local file system.
+func openURL(uri string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(uri, "http://") &&
+		!strings.HasPrefix(uri, "https://") {
+		return os.Open(uri)
+	}
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(uri)
+	if err != nil {
+		return nil, ef("Could not download '%s': %s", uri, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, ef("Could not download '%s': %s", uri, resp.Status)
+	}
+	return throttled(interruptible(resp.Body)), nil
+}
+
+// unpackPrebuilt writes the database read from r to the file given, and
+// returns the size and hex SHA-256 checksum of what was read. If gz is true,
+// the database is decompressed first.
+func unpackPrebuilt(r io.Reader, gz bool, dest string) (int64, string, error) {
+	h := sha256.New()
+	counted := &countingReader{r: io.TeeReader(r, h)}
+	var src io.Reader = counted
+	if gz {
+		gzr, err := pgzip.NewReader(counted)
+		if err != nil {
+			return 0, "", err
+		}
+		defer gzr.Close()
+		src = gzr
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return 0, "", err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return 0, "", err
+	}
+	if err := f.Close(); err != nil {
+		return 0, "", err
+	}
+	// Whatever the gzip reader didn't need is still part of the file.
+	if _, err := io.Copy(ioutil.Discard, counted); err != nil {
+		return 0, "", err
+	}
+	return counted.n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(bs []byte) (int, error) {
+	n, err := cr.r.Read(bs)
+	cr.n += int64(n)
+	return n, err
+}
+
+// prebuiltSnapshot returns the generation of the SQLite database given.
+func prebuiltSnapshot(fpath string, readOnly bool) (imdb.Snapshot, error) {
+	db, err := imdb.OpenWith("sqlite3", fpath,
+		imdb.Options{ReadOnly: readOnly})
+	if err != nil {
+		return imdb.Snapshot{}, ef("Could not open '%s': %s", fpath, err)
+	}
+	defer db.Close()
+	return db.Snapshot()
+}
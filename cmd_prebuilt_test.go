@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"testing"
+)
+
+func TestUnpackPrebuilt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goim-prebuilt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte("SQLite format 3\x00"), 1000)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(data)
+	w.Close()
+
+	for _, test := range []struct {
+		published []byte
+		gz        bool
+	}{
+		{data, false},
+		{gz.Bytes(), true},
+	} {
+		dest := path.Join(dir, "goim.sqlite")
+		size, sum, err := unpackPrebuilt(
+			bytes.NewReader(test.published), test.gz, dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := sha256.Sum256(test.published)
+		if size != int64(len(test.published)) {
+			t.Errorf("gz=%v: expected size %d but got %d",
+				test.gz, len(test.published), size)
+		}
+		if sum != hex.EncodeToString(want[:]) {
+			t.Errorf("gz=%v: wrong checksum %s", test.gz, sum)
+		}
+		got, err := ioutil.ReadFile(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("gz=%v: database wasn't written as published", test.gz)
+		}
+	}
+}
@@ -13,21 +13,21 @@ import (
 	"flag"
 	"os"
 	path "path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/BurntSushi/ty/fun"
 
 	"github.com/BurntSushi/goim/imdb"
 	"github.com/BurntSushi/goim/imdb/search"
+	"github.com/BurntSushi/goim/parsefile"
 	"github.com/BurntSushi/goim/tpl"
 )
 
 var (
 	flagRenameTvshow       = ""
-	flagRenameRegexEpisode = `\b[Ss]([0-9]+)[Ee]([0-9]+)\b`
-	flagRenameRegexYear    = `\b([0-9]{4})\b`
+	flagRenameRegexEpisode = parsefile.DefaultEpisode
+	flagRenameRegexMulti   = parsefile.DefaultMultiEpisode
+	flagRenameRegexYear    = parsefile.DefaultYear
 	flagRenameTvshowName   = false
 	flagVotes              = 10000
 )
@@ -61,13 +61,19 @@ If the first argument is a file name (i.e., the query is omitted), then Goim
 will try to be smart and guess what the file corresponds to based on any name
 or year information. This only works with movies or episodes. For movies, a
 big piece of distinguishing information is the year, which is extracted with
-the regular expression in the 'match-year' flag.
+the regular expression in the 'match-year' flag. Quality tags common in scene
+releases (like '1080p.BluRay.x264-GROUP') are ignored.
 
 If you're renaming multiple episodes, use the '-tv' flag to specify the TV show
 and omit the query. This will also be significantly faster, since only one
 search will be performed instead of a search for each file. Goim will try to
 extract episode numbers from the file names. This extraction can be controlled
 with the 'match-episode' flag.
+
+Files containing more than one episode (e.g., 'S01E05E06' or 'S01E05-06') are
+renamed with the 'rename_multi_episode' template, which includes the numbers
+and titles of every episode. The numbers of such files are extracted with the
+'match-multi-episode' flag, which is tried before 'match-episode'.
 `,
 	flags: flag.NewFlagSet("rename", flag.ExitOnError),
 	run:   cmd_rename,
@@ -87,6 +93,12 @@ with the 'match-episode' flag.
 				"numbers in an episode file name. The regex MUST contain two\n"+
 				"capturing groups, where the first is the season number and\n"+
 				"the second is the episode number.")
+		c.flags.StringVar(&flagRenameRegexMulti, "match-multi-episode",
+			flagRenameRegexMulti,
+			"An RE2 regular expression for matching the season and episode\n"+
+				"numbers in a file name with more than one episode. The regex\n"+
+				"MUST contain three capturing groups: the season number, the\n"+
+				"first episode number and the last episode number.")
 		c.flags.StringVar(&flagRenameRegexYear, "match-year",
 			flagRenameRegexYear,
 			"An RE2 regular expression for matching the year in a file name.\n"+
@@ -137,14 +149,10 @@ func cmd_rename(c *command) bool {
 		files = files[0:len(results)]
 	}
 
-	entities := make([]imdb.Entity, len(results))
-	for i, r := range results {
-		e, err := r.GetEntity(db)
-		if err != nil {
-			pef("Could not get entity for '%s': %s", r, err)
-			return false
-		}
-		entities[i] = e
+	entities, err := search.HydrateEntities(db, results)
+	if err != nil {
+		pef("Could not get entities: %s", err)
+		return false
 	}
 	return doRename(c, db, files, entities)
 }
@@ -155,11 +163,16 @@ func cmd_rename_smart(c *command) bool {
 	defer closeDb(db)
 
 	files := fun.Map(path.Clean, c.flags.Args()).([]string)
+	parser, err := renameParser()
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
 
 	var oldNames []string
 	var newNames []imdb.Entity
 	for _, file := range files {
-		e, err := guessEntity(c, db, file)
+		e, err := guessEntity(c, db, parser.Parse(file))
 		if err != nil {
 			pef("Could not guess entity for '%s': %s", file, err)
 			continue
@@ -176,6 +189,11 @@ func cmd_rename_tvshow(c *command, tvQuery string) bool {
 	defer closeDb(db)
 
 	files := fun.Map(path.Clean, c.flags.Args()).([]string)
+	parser, err := renameParser()
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
 	tv, err := searchTvshow(c, db, tvQuery)
 	if err != nil {
 		pef("%s", err)
@@ -190,12 +208,23 @@ func cmd_rename_tvshow(c *command, tvQuery string) bool {
 	var oldNames []string
 	var newNames []imdb.Entity
 	for _, file := range files {
-		baseFile := path.Base(file)
-		s, e, _, _, err := episodeNumbers(baseFile, flagRenameRegexEpisode)
-		if err != nil {
-			pef("Could not find episode numbers in '%s': %s", file, err)
+		name := parser.Parse(file)
+		if name.IsMultiEpisode() {
+			multi, err := episodes.multi(
+				name.Season, name.Episode, name.LastEpisode)
+			if err != nil {
+				pef("Could not find episodes for '%s': %s", file, err)
+				continue
+			}
+			oldNames = append(oldNames, file)
+			newNames = append(newNames, multi)
+			continue
+		}
+		if !name.IsEpisode() {
+			pef("Could not find episode numbers in '%s'.", file)
 			continue
 		}
+		s, e := name.Season, name.Episode
 		if s == 0 || e == 0 {
 			pef("Found numbers, but they look wrong: (s: %d, e: %d)", s, e)
 			continue
@@ -254,6 +283,9 @@ func renames(
 	for i := range files {
 		file, ent := files[i], entities[i]
 		t := c.tpl(sf("rename_%s", ent.Type()))
+		if _, ok := ent.(*multiEpisode); ok {
+			t = c.tpl("rename_multi_episode")
+		}
 
 		// If this file is a directory, don't both with extensions.
 		stat, err := os.Stat(file)
@@ -319,6 +351,49 @@ type episodeKey struct {
 
 type episodeMap map[episodeKey]*imdb.Episode
 
+// multi returns the episodes first through last (inclusive) of the season
+// given as a single entity.
+func (eps episodeMap) multi(season, first, last int) (*multiEpisode, error) {
+	var parts []*imdb.Episode
+	for e := first; e <= last; e++ {
+		ep, ok := eps[episodeKey{season, e}]
+		if !ok {
+			return nil, ef("Could not find episode S%02dE%02d.", season, e)
+		}
+		parts = append(parts, ep)
+	}
+	return newMultiEpisode(parts)
+}
+
+// multiEpisode is a file that contains more than one consecutive episode. It
+// satisfies the imdb.Entity interface through the first episode, so it can be
+// renamed like any other entity (but with the 'rename_multi_episode'
+// template).
+type multiEpisode struct {
+	*imdb.Episode
+	Episodes []*imdb.Episode
+	LastNum  int    // the episode number of the last episode
+	Titles   string // the titles of every episode, separated by ' & '
+}
+
+func newMultiEpisode(eps []*imdb.Episode) (*multiEpisode, error) {
+	if len(eps) == 0 {
+		return nil, ef("No episodes to combine.")
+	}
+	var titles []string
+	for _, ep := range eps {
+		if len(ep.Title) > 0 {
+			titles = append(titles, ep.Title)
+		}
+	}
+	return &multiEpisode{
+		Episode:  eps[0],
+		Episodes: eps,
+		LastNum:  eps[len(eps)-1].EpisodeNum,
+		Titles:   strings.Join(titles, " & "),
+	}, nil
+}
+
 func tvEpisodes(db *imdb.DB, tv *imdb.Tvshow) (episodeMap, error) {
 	episodes := make(episodeMap, 30)
 	epsearch := search.New(db)
@@ -334,55 +409,67 @@ func tvEpisodes(db *imdb.DB, tv *imdb.Tvshow) (episodeMap, error) {
 	if len(results) == 0 {
 		return nil, ef("Could not find any episodes for %s", tv)
 	}
-	for _, r := range results {
-		ent, err := r.GetEntity(db)
-		if err != nil {
-			return nil, err
-		}
+	ents, err := search.HydrateEntities(db, results)
+	if err != nil {
+		return nil, err
+	}
+	for _, ent := range ents {
 		ep := ent.(*imdb.Episode)
 		episodes[episodeKey{ep.Season, ep.EpisodeNum}] = ep
 	}
 	return episodes, nil
 }
 
-func guessEntity(c *command, db *imdb.DB, fname string) (imdb.Entity, error) {
+// renameParser returns a file name parser with the regular expressions given
+// in the flags.
+func renameParser() (*parsefile.Parser, error) {
+	return parsefile.New(
+		flagRenameRegexEpisode, flagRenameRegexMulti, flagRenameRegexYear)
+}
+
+func guessEntity(
+	c *command,
+	db *imdb.DB,
+	name parsefile.Name,
+) (imdb.Entity, error) {
 	// Look for episode numbers. If we can find them, then this is an
 	// episode.
-	fname = path.Base(fname)
-	_, _, _, _, err := episodeNumbers(fname, flagRenameRegexEpisode)
-	if err == nil {
-		return guessEpisode(c, db, fname)
+	if name.IsEpisode() {
+		return guessEpisode(c, db, name)
 	} else {
-		return guessMovie(c, db, fname)
+		return guessMovie(c, db, name)
 	}
 }
 
+// guessEpisode returns either an *imdb.Episode or a *multiEpisode (when the
+// file name contains more than one episode number).
 func guessEpisode(
 	c *command,
 	db *imdb.DB,
-	fname string,
-) (*imdb.Episode, error) {
-	fname = path.Base(fname)
-	s, e, start, _, err := episodeNumbers(fname, flagRenameRegexEpisode)
-	if err != nil {
-		return nil, ef("Could not find episode numbers: %s", err)
-	}
-
-	// A guess at where the TV show name is in the file name.
-	title := strings.TrimSpace(fname[0:start])
+	name parsefile.Name,
+) (imdb.Entity, error) {
+	s, e, last := name.Season, name.Episode, name.LastEpisode
 
-	tvsub, err := search.Query(db, title)
+	tvsub, err := search.Query(db, name.Title)
 	if err != nil {
 		return nil, err
 	}
 	tvsub.Entity(imdb.EntityTvshow)
 	tvsub.Votes(flagVotes, -1)
+	// The year in an episode's file name may be the year the show started
+	// or the year the episode aired, so it only rules out later shows.
+	if name.Year > 0 {
+		tvsub.Years(-1, name.Year)
+	}
 
 	esearch := search.New(db)
 	esearch.Tvshow(tvsub)
 	esearch.Entity(imdb.EntityEpisode)
-	esearch.Seasons(s, s).Episodes(e, e)
+	esearch.Seasons(s, s).Episodes(e, last)
 	esearch.Chooser(c.chooser)
+	if last > e {
+		esearch.CombineEpisodes()
+	}
 
 	results, err := esearch.Results()
 	if err != nil {
@@ -401,6 +488,21 @@ func guessEpisode(
 	if m.Entity != imdb.EntityEpisode {
 		return nil, ef("Expected episode but got %s", m.Entity)
 	}
+	if last > e {
+		if len(m.Parts) != last-e+1 {
+			return nil, ef("Could not find all episodes S%02dE%02d-E%02d.",
+				s, e, last)
+		}
+		var parts []*imdb.Episode
+		for _, id := range m.Parts {
+			ent, err := imdb.FromAtom(db, imdb.EntityEpisode, id)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, ent.(*imdb.Episode))
+		}
+		return newMultiEpisode(parts)
+	}
 	ent, err := m.GetEntity(db)
 	if err != nil {
 		return nil, err
@@ -408,17 +510,17 @@ func guessEpisode(
 	return ent.(*imdb.Episode), nil
 }
 
-func guessMovie(c *command, db *imdb.DB, fname string) (*imdb.Movie, error) {
-	fname = path.Base(fname)
-	year, ystart, _, err := fileNameYear(fname, flagRenameRegexYear)
-	if err != nil {
-		return nil, ef("Could not find year for movie: %s", err)
+func guessMovie(
+	c *command,
+	db *imdb.DB,
+	name parsefile.Name,
+) (*imdb.Movie, error) {
+	year := name.Year
+	if year == 0 {
+		return nil, ef("Could not find year for movie.")
 	}
 
-	// A guess at where the title is in the file name.
-	title := strings.TrimSpace(fname[0:ystart])
-
-	msearch, err := search.Query(db, title)
+	msearch, err := search.Query(db, name.Title)
 	if err != nil {
 		return nil, err
 	}
@@ -450,66 +552,3 @@ func guessMovie(c *command, db *imdb.DB, fname string) (*imdb.Movie, error) {
 	}
 	return ent.(*imdb.Movie), nil
 }
-
-// fileNameYear attempts to extract the year of release for an entity from a
-// file name using the RE2 regular expression provided. If the match is
-// unsuccessful, 0, -1, -1 is returned. The regex must have exactly 1 capturing
-// group, where the group corresponds to the year which must be an integer.
-// The triple of integers returned correspond to the year and the start and end
-// indices of the year in 'fname'.
-//
-// fname should be a base name of a file path.
-func fileNameYear(fname, regex string) (year, start, end int, err error) {
-	reg, err := regexp.Compile(regex)
-	if err != nil {
-		return 0, -1, -1, ef("Could not compile regex '%s': %s", regex, err)
-	}
-	groups := reg.FindStringSubmatchIndex(fname)
-	if len(groups) != 4 || groups[2] == -1 || groups[3] == -1 {
-		return 0, -1, -1, ef("Unsuccessful match.")
-	}
-	start, end = groups[2], groups[3]
-	year64, err := strconv.Atoi(fname[groups[2]:groups[3]])
-	if err != nil {
-		return 0, -1, -1, ef("Could not parse '%s' as int: %s", groups[1], err)
-	}
-	year = int(year64)
-	return
-}
-
-// episodeNumbers attempts to extract the season and episode numbers from
-// a file name. If the match is unsuccessfull, zeroes are returned. The regex
-// must have exactly two capturing groups, where the first is the season and
-// the second is the episode. Both of these capturing groups must correspond
-// to integers.
-//
-// fname should be a base name of a file path.
-func episodeNumbers(
-	fname,
-	regex string,
-) (season, episode, start, end int, err error) {
-	fname = path.Base(fname)
-	reg, err := regexp.Compile(regex)
-	if err != nil {
-		return 0, 0, -1, -1, ef("Could not compile regex '%s': %s", regex, err)
-	}
-	groups := reg.FindStringSubmatchIndex(fname)
-	if len(groups) != 6 || groups[2] == -1 || groups[5] == -1 {
-		return 0, 0, -1, -1, ef("Unsuccessful match.")
-	}
-
-	sstart, send := groups[2], groups[3]
-	estart, eend := groups[4], groups[5]
-	start, end = sstart, eend
-	nseason, err := strconv.Atoi(fname[sstart:send])
-	if err != nil {
-		return 0, 0, -1, -1,
-			ef("Could not parse '%s' as an int: %s", groups[1], err)
-	}
-	nepisode, err := strconv.Atoi(fname[estart:eend])
-	if err != nil {
-		return 0, 0, -1, -1,
-			ef("Could not parse '%s' as an int: %s", groups[2], err)
-	}
-	return int(nseason), int(nepisode), start, end, nil
-}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/ty/fun"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
+	"github.com/BurntSushi/goim/tpl"
+)
+
+var flagReplHistory = ""
+
+var cmdRepl = &command{
+	name:      "repl",
+	shortHelp: "interactive shell for searching",
+	help: `
+The repl command starts an interactive shell where each line is a search query
+(with the same syntax as 'goim search'). The database connection is kept open
+between queries and results of previous queries are remembered, so repeating a
+query is instant.
+
+Lines starting with a ':' are commands for the shell. Use ':help' to see them.
+Previous queries can be repeated with '!!' (the last query) or '!N' (the Nth
+query in ':history').
+
+The history of queries is saved between sessions in the file given by -history.
+
+Remembered results are forgotten automatically when the database is updated
+with 'goim load' while the shell is running. (The shell checks the database's
+generation before each query.)
+`,
+	flags: flag.NewFlagSet("repl", flag.ExitOnError),
+	run:   cmd_repl,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagReplHistory, "history", flagReplHistory,
+			"The file to save query history in. When empty, it is saved\n"+
+				"in $XDG_DATA_HOME/goim/history. Use '-' to disable saving.")
+	},
+}
+
+// repl is the state of an interactive shell.
+type repl struct {
+	c       *command
+	db      *imdb.DB
+	in      *bufio.Reader
+	history []string
+	cache   map[string][]search.Result
+	last    []search.Result
+
+	// generation is the database generation when the cache was filled.
+	generation int
+}
+
+var replCommands = []struct {
+	name, args, help string
+}{
+	{"help", "", "show this help message"},
+	{"quit", "", "leave the shell (so does EOF)"},
+	{"history", "", "list previous queries"},
+	{"complete", "QUERY", "list completions of the directive ending QUERY"},
+	{"directives", "", "list all search directives"},
+	{"show", "N [ATTR]", "show an attribute (default: short) for result N"},
+	{"clear", "", "forget cached results"},
+	{"generation", "", "show the generation and date of the data"},
+}
+
+func cmd_repl(c *command) bool {
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	r := &repl{
+		c:     c,
+		db:    db,
+		in:    bufio.NewReader(os.Stdin),
+		cache: make(map[string][]search.Result),
+	}
+	histFile := r.historyFile()
+	r.history = readHistory(histFile)
+	defer func() { writeHistory(histFile, r.history) }()
+
+	tpl.SetDB(db)
+	for {
+		pf("goim> ")
+		line, err := r.in.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if len(line) > 0 {
+			if !r.eval(line) {
+				return true
+			}
+		}
+		if err == io.EOF {
+			pf("\n")
+			return true
+		} else if err != nil {
+			pef("%s", err)
+			return false
+		}
+	}
+}
+
+// eval evaluates a single line of input. It returns false when the shell
+// should quit.
+func (r *repl) eval(line string) bool {
+	if line == "!!" || (line[0] == '!' && len(line) > 1) {
+		n := len(r.history)
+		if line != "!!" {
+			var err error
+			if n, err = strconv.Atoi(line[1:]); err != nil {
+				pef("Invalid history reference '%s'.", line)
+				return true
+			}
+		}
+		if n < 1 || n > len(r.history) {
+			pef("No query %d in history.", n)
+			return true
+		}
+		line = r.history[n-1]
+		pf("%s\n", line)
+	}
+	if line[0] == ':' {
+		return r.meta(strings.Fields(line[1:]))
+	}
+	if len(r.history) == 0 || r.history[len(r.history)-1] != line {
+		r.history = append(r.history, line)
+	}
+	r.search(line)
+	return true
+}
+
+func (r *repl) search(query string) {
+	r.checkGeneration()
+	results, ok := r.cache[query]
+	if !ok {
+		searcher, err := search.Query(r.db, query)
+		if err != nil {
+			pef("%s", err)
+			return
+		}
+		searcher.Chooser(r.chooser)
+		if results, err = searcher.Results(); err != nil {
+			pef("%s", err)
+			return
+		}
+		r.cache[query] = results
+	}
+	r.last = results
+	if len(results) == 0 {
+		pef("No results found.")
+		return
+	}
+	template := r.c.tpl("search_result")
+	for i, result := range results {
+		attrs := tpl.Attrs{"Index": i + 1}
+		r.c.tplExec(template, tpl.Args{E: result, A: attrs})
+	}
+}
+
+// checkGeneration forgets cached results if the database has been reloaded
+// since they were cached.
+func (r *repl) checkGeneration() {
+	gen, err := r.db.Generation()
+	if err != nil {
+		pef("Could not get database generation: %s", err)
+		return
+	}
+	if gen != r.generation {
+		if len(r.cache) > 0 {
+			logf("The database has been updated. Forgetting cached results.")
+		}
+		r.cache = make(map[string][]search.Result)
+		r.generation = gen
+	}
+}
+
+// meta runs a shell command. It returns false when the shell should quit.
+func (r *repl) meta(args []string) bool {
+	if len(args) == 0 {
+		args = []string{"help"}
+	}
+	switch args[0] {
+	case "q", "quit", "exit":
+		return false
+	case "h", "help":
+		for _, cmd := range replCommands {
+			pf("    :%-20s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args),
+				cmd.help)
+		}
+	case "history":
+		for i, q := range r.history {
+			pf("%4d  %s\n", i+1, q)
+		}
+	case "complete":
+		query := strings.Join(args[1:], " ")
+		if !strings.Contains(query, "{") {
+			query = "{" + query
+		}
+		for _, sug := range search.Complete(query, len(query)) {
+			pf("%s%s\n", query[:sug.Start], sug.Text)
+		}
+	case "directives":
+		for _, name := range completeDirective("") {
+			pf("{%s}\n", name)
+		}
+	case "show":
+		r.show(args[1:])
+	case "clear":
+		r.cache = make(map[string][]search.Result)
+	case "generation":
+		snap, err := r.db.Snapshot()
+		if err != nil {
+			pef("Could not get database generation: %s", err)
+			break
+		}
+		pf("%s\n", snap)
+	default:
+		pef("Unknown command ':%s'. Try ':help'.", args[0])
+	}
+	return true
+}
+
+// show executes an attribute template for one of the results of the last
+// search.
+func (r *repl) show(args []string) {
+	if len(args) == 0 {
+		pef("Usage: :show N [ATTR]")
+		return
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(r.last) {
+		pef("'%s' is not a result of the last search.", args[0])
+		return
+	}
+	name := "short"
+	if len(args) > 1 {
+		name = args[1]
+	}
+	if _, ok := attrCommands[name]; !ok && name != "short" && name != "full" {
+		pef("Unknown attribute '%s'.", name)
+		return
+	}
+	ent, err := r.last[n-1].GetEntity(r.db)
+	if err != nil {
+		pef("%s", err)
+		return
+	}
+	switch name {
+	case "short":
+		tplName := sf("short_%s", ent.Type().String())
+		r.c.tplExec(r.c.tpl(tplName), tpl.Args{E: ent, A: nil})
+	case "full":
+		attrs := fun.Keys(attrCommands).([]string)
+		sort.Sort(sort.StringSlice(attrs))
+		for _, attr := range attrs {
+			r.c.showAttr(r.db, ent, attr)
+		}
+	default:
+		r.c.showAttr(r.db, ent, name)
+	}
+}
+
+// chooser is like command.chooser, except it reads from the shell's input.
+func (r *repl) chooser(results []search.Result, what string) (
+	*search.Result, error) {
+
+	pf("%s is ambiguous. Please choose one:\n", what)
+	template := r.c.tpl("search_result")
+	for i, result := range results {
+		attrs := tpl.Attrs{"Index": i + 1}
+		r.c.tplExec(template, tpl.Args{E: result, A: attrs})
+	}
+	pf("Choice [%d-%d]: ", 1, len(results))
+	line, err := r.in.ReadString('\n')
+	if err != nil {
+		return nil, ef("Error reading from stdin: %s", err)
+	}
+	choice, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		return nil, ef("Invalid choice '%s'", strings.TrimSpace(line))
+	}
+	choice--
+	if choice == -1 {
+		return nil, nil
+	} else if choice < -1 || choice >= len(results) {
+		return nil, ef("Invalid choice %d", choice)
+	}
+	return &results[choice], nil
+}
+
+// completeDirective returns the names (and synonyms) of all search
+// directives that start with the prefix given.
+func completeDirective(prefix string) []string {
+	var names []string
+	for _, cmd := range search.Commands {
+		for _, name := range append([]string{cmd.Name}, cmd.Synonyms...) {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func (r *repl) historyFile() string {
+	if flagReplHistory == "-" {
+		return ""
+	} else if len(flagReplHistory) > 0 {
+		return flagReplHistory
+	}
+	dir := os.Getenv("XDG_DATA_HOME")
+	if len(dir) == 0 {
+		dir = path.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return path.Join(dir, "goim", "history")
+}
+
+// readHistory reads the query history in the file given. Any errors are
+// ignored (since a missing history file is normal).
+func readHistory(fpath string) []string {
+	if len(fpath) == 0 {
+		return nil
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var history []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); len(line) > 0 {
+			history = append(history, line)
+		}
+	}
+	return history
+}
+
+// writeHistory writes the last 1000 queries in the history to the file
+// given.
+func writeHistory(fpath string, history []string) {
+	if len(fpath) == 0 {
+		return
+	}
+	if len(history) > 1000 {
+		history = history[len(history)-1000:]
+	}
+	if err := os.MkdirAll(path.Dir(fpath), 0755); err != nil {
+		pef("Could not save history: %s", err)
+		return
+	}
+	f, err := os.Create(fpath)
+	if err != nil {
+		pef("Could not save history: %s", err)
+		return
+	}
+	defer f.Close()
+	for _, q := range history {
+		fmt.Fprintln(f, q)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/BurntSushi/goim/imdb/search"
+	"github.com/BurntSushi/goim/tpl"
+)
+
+var flagSavedIds = false
+
+var cmdSaved = &command{
+	name:            "saved",
+	positionalUsage: "(add name query | run name [ query ] | list | delete name)",
+	shortHelp:       "store and run named search queries",
+	help: `
+The saved command stores search queries in the database under a name, so that
+recurring queries don't have to be retyped (or dug out of shell history).
+
+    goim saved add weekly-horror '{genre:horror} {years:2014-} {sort:rank desc}'
+    goim saved run weekly-horror
+    goim saved run weekly-horror {limit:5}
+    goim saved list
+    goim saved delete weekly-horror
+
+Adding a search with a name that already exists replaces its query. Queries
+are checked for errors before they are saved.
+
+Any query given to 'run' is appended to the saved query, which makes it easy
+to refine a saved search without changing it.
+
+Saved searches are never touched by the load command.
+`,
+	flags: flag.NewFlagSet("saved", flag.ExitOnError),
+	run:   cmd_saved,
+	addFlags: func(c *command) {
+		c.flags.BoolVar(&flagSavedIds, "ids", flagSavedIds,
+			"When set, only the atom identifiers of each search result\n"+
+				"will be printed by 'run'.")
+	},
+}
+
+func cmd_saved(c *command) bool {
+	c.assertLeastNArg(1)
+	args := c.flags.Args()
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	switch args[0] {
+	case "add":
+		c.assertLeastNArg(3)
+		query := strings.Join(args[2:], " ")
+		if issues := search.Validate(query); len(issues) > 0 {
+			for _, issue := range issues {
+				pef("%s", issue)
+			}
+			return false
+		}
+		if err := db.SaveSearch(args[1], query); err != nil {
+			pef("%s", err)
+			return false
+		}
+	case "run":
+		c.assertLeastNArg(2)
+		query, err := db.SavedSearch(args[1])
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		if len(args) > 2 {
+			query += " " + strings.Join(args[2:], " ")
+		}
+		results, ok := c.queryResults(db, query, false)
+		if !ok {
+			return false
+		}
+		template := c.tpl("search_result")
+		for i, result := range results {
+			if flagSavedIds {
+				pf("%d\n", result.Id)
+			} else {
+				attrs := tpl.Attrs{"Index": i + 1}
+				c.tplExec(template, tpl.Args{E: result, A: attrs})
+			}
+		}
+	case "list":
+		saved, err := db.SavedSearches()
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		for _, s := range saved {
+			pf("%s\t%s\n", s.Name, s.Query)
+		}
+	case "delete":
+		c.assertNArg(2)
+		if err := db.DeleteSavedSearch(args[1]); err != nil {
+			pef("%s", err)
+			return false
+		}
+	default:
+		c.showUsage()
+	}
+	return true
+}
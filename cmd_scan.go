@@ -0,0 +1,266 @@
+package main
+
+import (
+	"flag"
+	"os"
+	path "path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/parsefile"
+)
+
+var (
+	flagScanFormat   = "csv"
+	flagScanProblems = false
+	flagScanVotes    = 0
+	flagScanExts     = "avi,m4v,mkv,mov,mp4,mpg,mpeg,ogm,ts,webm,wmv"
+)
+
+var cmdScan = &command{
+	name:            "scan",
+	positionalUsage: "directory [ directory ... ]",
+	shortHelp:       "matches the media files in a directory to IMDb",
+	help: `
+The scan command finds the media files in the directories given (and their
+sub-directories), guesses the movie or episode that each one is from its file
+name and reports what was found. It's meant for checking a whole collection at
+once, so ambiguous searches are never prompted for: the best hit is used.
+
+File names may follow the usual conventions of scene releases and media
+libraries (e.g., 'The.Matrix.1999.1080p.BluRay.x264-GROUP.mkv' or 'Brazil
+(1985).avi'). Season and episode numbers (e.g., 'S02E05' or '2x05') mean a
+file is an episode of the TV show named before them. Otherwise, the file is a
+movie, and its title is whatever comes before its year or quality tags.
+
+Each file gets one of these statuses:
+
+    matched          the file matches a movie or episode
+    year-mismatch    the file matches a movie, but not within a year of the
+                     year in its name
+    duplicate        the file matches the same movie or episode as another
+                     file (named in 'duplicate_of')
+    unmatched        nothing matches the file
+    error            the search for the file failed
+
+The report is written to stdout as CSV (with a header) or JSON (with
+'-format json'), with these fields: 'file', 'status', 'title', 'year',
+'season', 'episode', 'entity', 'atom_id', 'name', 'match_year', 'duplicate_of',
+'quality' (the quality tags in the file name, e.g., '1080p BluRay x264') and
+'error'. For example, to list the files that don't match anything:
+
+    goim scan -problems /media/movies | grep ',unmatched,'
+`,
+	flags: flag.NewFlagSet("scan", flag.ExitOnError),
+	run:   cmd_scan,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagScanFormat, "format", flagScanFormat,
+			"The format of the report: 'csv' or 'json'.")
+		c.flags.BoolVar(&flagScanProblems, "problems", flagScanProblems,
+			"When set, matched files are left out of the report.")
+		c.flags.IntVar(&flagScanVotes, "votes", flagScanVotes,
+			"The minimum number of votes of a match. For episodes, this\n"+
+				"applies to the TV show.")
+		c.flags.StringVar(&flagScanExts, "ext", flagScanExts,
+			"A comma separated list of the file extensions of media files.")
+	},
+}
+
+// scanFile is a media file found by 'goim scan' and what it matches.
+type scanFile struct {
+	File        string `json:"file"`
+	Status      string `json:"status"`
+	Title       string `json:"title"`
+	Year        int    `json:"year,omitempty"`
+	Season      int    `json:"season,omitempty"`
+	Episode     int    `json:"episode,omitempty"`
+	Entity      string `json:"entity,omitempty"`
+	AtomId      int    `json:"atom_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	MatchYear   int    `json:"match_year,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	Quality     string `json:"quality,omitempty"`
+	Error       string `json:"error,omitempty"`
+
+	name parsefile.Name
+}
+
+func cmd_scan(c *command) bool {
+	c.assertLeastNArg(1)
+	if !checkReportFormat(flagScanFormat) {
+		return false
+	}
+	var files []*scanFile
+	for _, dir := range c.flags.Args() {
+		found, err := scanDir(dir, strings.Split(flagScanExts, ","))
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		files = append(files, found...)
+	}
+
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	// Movies are searched for near the year in their name first. Those that
+	// aren't found are searched for again without it, so that a wrong year
+	// can be told apart from a missing movie.
+	matchScanFiles(c, db, files, true)
+	var retry []*scanFile
+	for _, f := range files {
+		if f.Status == "unmatched" && !f.name.IsEpisode() && f.Year > 0 {
+			retry = append(retry, f)
+		}
+	}
+	matchScanFiles(c, db, retry, false)
+	markDuplicates(files)
+
+	var report []*scanFile
+	for _, f := range files {
+		if !flagScanProblems || f.Status != "matched" {
+			report = append(report, f)
+		}
+	}
+	if err := writeScanReport(report, flagScanFormat); err != nil {
+		pef("%s", err)
+		return false
+	}
+	return true
+}
+
+// scanDir returns the files in dir (and its sub-directories) with one of the
+// extensions given, with the title, year and episode numbers in their names.
+func scanDir(dir string, exts []string) ([]*scanFile, error) {
+	isMedia := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+		isMedia["."+ext] = true
+	}
+	var files []*scanFile
+	walk := func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isMedia[strings.ToLower(path.Ext(fpath))] {
+			return nil
+		}
+		files = append(files, parseScanFile(fpath))
+		return nil
+	}
+	if err := path.Walk(dir, walk); err != nil {
+		return nil, ef("Could not scan '%s': %s", dir, err)
+	}
+	return files, nil
+}
+
+// parseScanFile guesses the title, year and episode numbers of a media file
+// from its name.
+func parseScanFile(fpath string) *scanFile {
+	name := parsefile.Parse(fpath)
+	return &scanFile{
+		File:    fpath,
+		Status:  "unmatched",
+		Title:   name.Title,
+		Year:    name.Year,
+		Season:  name.Season,
+		Episode: name.Episode,
+		Quality: name.Tags.String(),
+		name:    name,
+	}
+}
+
+// query returns the search query for the file. If withYear is true, movies
+// are only searched for within a year of the year in their name.
+func (f *scanFile) query(withYear bool) string {
+	votes := ""
+	if flagScanVotes > 0 {
+		votes = sf(" {votes:%d-}", flagScanVotes)
+	}
+	if f.name.IsEpisode() {
+		show := f.Title + " {tvshow}" + votes
+		if f.Year > 0 {
+			show += sf(" {years:%d}", f.Year)
+		}
+		return sf("{show:%s} {seasons:%d} {episodes:%d-%d}",
+			show, f.Season, f.Episode, f.name.LastEpisode)
+	}
+	year := 0
+	if withYear {
+		year = f.Year
+	}
+	return titleQuery(f.Title, "movie", year) + votes
+}
+
+// matchScanFiles searches for each of the files given in one batch and
+// records what they match.
+func matchScanFiles(c *command, db *imdb.DB, files []*scanFile, year bool) {
+	var queries []string
+	var searched []*scanFile
+	for _, f := range files {
+		if len(f.Title) == 0 {
+			continue
+		}
+		queries = append(queries, f.query(year))
+		searched = append(searched, f)
+	}
+	for i, b := range c.batchSearch(db, queries) {
+		f := searched[i]
+		switch {
+		case b.Err != nil:
+			f.Status, f.Error = "error", b.Err.Error()
+		case b.Best != nil:
+			f.Status = "matched"
+			if !year {
+				f.Status = "year-mismatch"
+			}
+			f.Entity = b.Best.Entity.String()
+			f.AtomId = int(b.Best.Id)
+			f.Name = b.Best.Name
+			f.MatchYear = b.Best.Year
+		}
+	}
+}
+
+// markDuplicates marks every file that matches the same entity as a file
+// before it as a duplicate of that file.
+func markDuplicates(files []*scanFile) {
+	first := make(map[int]*scanFile)
+	for _, f := range files {
+		if f.AtomId == 0 {
+			continue
+		}
+		if dup, ok := first[f.AtomId]; ok {
+			f.Status, f.DuplicateOf = "duplicate", dup.File
+		} else {
+			first[f.AtomId] = f
+		}
+	}
+}
+
+// writeScanReport writes the files given to stdout in the format given.
+func writeScanReport(files []*scanFile, format string) error {
+	if files == nil {
+		files = []*scanFile{}
+	}
+	num := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	var rows [][]string
+	for _, f := range files {
+		rows = append(rows, []string{
+			f.File, f.Status, f.Title, num(f.Year), num(f.Season),
+			num(f.Episode), f.Entity, num(f.AtomId), f.Name,
+			num(f.MatchYear), f.DuplicateOf, f.Quality, f.Error,
+		})
+	}
+	return writeReport(format, files, []string{
+		"file", "status", "title", "year", "season", "episode", "entity",
+		"atom_id", "name", "match_year", "duplicate_of", "quality", "error",
+	}, rows)
+}
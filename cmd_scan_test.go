@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseScanFile(t *testing.T) {
+	for _, test := range []struct {
+		fpath   string
+		title   string
+		year    int
+		season  int
+		episode int
+		query   string
+	}{
+		{
+			"/media/The.Matrix.1999.1080p.BluRay.mkv",
+			"The Matrix", 1999, 0, 0,
+			"The Matrix {movie} {years:1998-2000}",
+		},
+		{
+			"/media/Brazil (1985)/Brazil (1985).avi",
+			"Brazil", 1985, 0, 0,
+			"Brazil {movie} {years:1984-1986}",
+		},
+		{
+			"/media/Primer.mp4",
+			"Primer", 0, 0, 0,
+			"Primer {movie}",
+		},
+		{
+			"/media/tv/The.Simpsons.S02E05.720p.mkv",
+			"The Simpsons", 0, 2, 5,
+			"{show:The Simpsons {tvshow}} {seasons:2} {episodes:5-5}",
+		},
+		{
+			"/media/tv/Doctor_Who_2005_s01e01e02.mkv",
+			"Doctor Who", 2005, 1, 1,
+			"{show:Doctor Who {tvshow} {years:2005}} {seasons:1} " +
+				"{episodes:1-2}",
+		},
+	} {
+		f := parseScanFile(test.fpath)
+		if f.Title != test.title || f.Year != test.year ||
+			f.Season != test.season || f.Episode != test.episode {
+			t.Errorf("%s: got %q (%d) S%02dE%02d, expected %q (%d) S%02dE%02d",
+				test.fpath, f.Title, f.Year, f.Season, f.Episode,
+				test.title, test.year, test.season, test.episode)
+		}
+		if q := f.query(true); q != test.query {
+			t.Errorf("%s: got query %q, expected %q", test.fpath, q, test.query)
+		}
+	}
+}
+
+func TestMarkDuplicates(t *testing.T) {
+	files := []*scanFile{
+		{File: "a.mkv", Status: "matched", AtomId: 1},
+		{File: "b.mkv", Status: "unmatched"},
+		{File: "c.mkv", Status: "unmatched"},
+		{File: "d.mkv", Status: "year-mismatch", AtomId: 1},
+		{File: "e.mkv", Status: "matched", AtomId: 2},
+	}
+	markDuplicates(files)
+	for _, test := range []struct {
+		status, dupOf string
+	}{
+		{"matched", ""},
+		{"unmatched", ""},
+		{"unmatched", ""},
+		{"duplicate", "a.mkv"},
+		{"matched", ""},
+	} {
+		f := files[0]
+		files = files[1:]
+		if f.Status != test.status || f.DuplicateOf != test.dupOf {
+			t.Errorf("%s: got %s (%q), expected %s (%q)",
+				f.File, f.Status, f.DuplicateOf, test.status, test.dupOf)
+		}
+	}
+}
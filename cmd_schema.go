@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var cmdSchema = &command{
+	name:            "schema",
+	positionalUsage: "[ tables | sql | verify ]",
+	shortHelp:       "shows or verifies the database schema",
+	help: `
+The schema command shows the tables that Goim expects in a database, or
+checks a database against them.
+
+'tables' (the default) lists every table with its columns and indices.
+
+'sql' prints the statements that create every table for the database's driver.
+They can be used to create a database outside of Goim (e.g., to export data to
+it). Goim creates and updates the tables of its own databases automatically.
+
+'verify' compares the tables in the database with the tables that Goim
+expects, and prints each difference found. If there are any, the command
+fails. This can catch databases changed by hand or created by a different
+version of Goim.
+`,
+	flags: flag.NewFlagSet("schema", flag.ExitOnError),
+	run:   cmd_schema,
+	other: true,
+}
+
+func cmd_schema(c *command) bool {
+	what := "tables"
+	if c.flags.NArg() > 0 {
+		what = c.flags.Arg(0)
+	}
+	switch what {
+	case "tables":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+		for _, t := range imdb.Schema() {
+			fmt.Fprintf(tw, "%s\n", t.Name)
+			for _, col := range t.Columns {
+				fmt.Fprintf(tw, "  %s\t%s\t%s\n",
+					col.Name, col.Type, schemaColumnNotes(t, col))
+			}
+			for _, idx := range t.Indices {
+				fmt.Fprintf(tw, "  index\t(%s)\t%s\n",
+					strings.Join(idx.Columns, ", "), schemaIndexNotes(idx))
+			}
+		}
+		tw.Flush()
+	case "sql":
+		driver, _ := c.dbinfo()
+		pf("%s\n", imdb.SchemaSQL(driver))
+	case "verify":
+		db := openDb(c.dbinfo())
+		defer closeDb(db)
+
+		problems, err := db.VerifySchema()
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		for _, problem := range problems {
+			pf("%s\n", problem)
+		}
+		if len(problems) > 0 {
+			return false
+		}
+		logf("The database schema is OK.")
+	default:
+		pef("Unknown schema command '%s'. See 'goim help schema'.", what)
+		return false
+	}
+	return true
+}
+
+func schemaColumnNotes(t imdb.Table, col imdb.Column) string {
+	var notes []string
+	for _, pk := range t.PrimaryKey {
+		if pk == col.Name {
+			notes = append(notes, "primary key")
+		}
+	}
+	if col.Null {
+		notes = append(notes, "null")
+	}
+	if len(col.Default) > 0 {
+		notes = append(notes, "default "+col.Default)
+	}
+	return strings.Join(notes, ", ")
+}
+
+func schemaIndexNotes(idx imdb.Index) string {
+	var notes []string
+	if idx.Unique {
+		notes = append(notes, "unique")
+	}
+	if len(idx.Fulltext) > 0 {
+		notes = append(notes, "trigram ("+idx.Fulltext+")")
+	}
+	if len(idx.Where) > 0 {
+		notes = append(notes, "where "+idx.Where)
+	}
+	return strings.Join(notes, ", ")
+}
@@ -1,16 +1,28 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"flag"
+	"os"
 	"strings"
 
 	"github.com/kr/text"
 
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/online"
 	"github.com/BurntSushi/goim/imdb/search"
+	"github.com/BurntSushi/goim/jsonapi"
 	"github.com/BurntSushi/goim/tpl"
 )
 
-var flagSearchIds = false
+var (
+	flagSearchIds    = false
+	flagSearchOnline = false
+	flagSearchBatch  = false
+	flagSearchGen    = false
+	flagSearchJSON   = false
+)
 
 var cmdSearch = &command{
 	name:            "search",
@@ -23,6 +35,31 @@ var cmdSearch = &command{
 		c.flags.BoolVar(&flagSearchIds, "ids", flagSearchIds,
 			"When set, only the atom identifiers of each search result "+
 				"will be printed.")
+		c.flags.BoolVar(&flagSearchOnline, "online", flagSearchOnline,
+			"When set, searches without results are looked up with the\n"+
+				"online provider in the configuration file. Results found\n"+
+				"online are cached in the database.")
+		c.flags.BoolVar(&flagSearchBatch, "batch", flagSearchBatch,
+			"When set, queries are read from stdin (one per line) and\n"+
+				"the best hit for each is printed on its own line, in the\n"+
+				"same order. Ambiguous queries are never prompted for.\n"+
+				"Queries without results print a line with '-'. With -ids,\n"+
+				"only atom identifiers are printed (0 when there's no hit).")
+		c.flags.BoolVar(&c.disambiguate, "disambiguate", c.disambiguate,
+			"When set, results with the same name and year are told\n"+
+				"apart by IMDb's numeral, type or country of release.\n"+
+				"(The same as the {disambiguate} directive.)")
+		c.flags.BoolVar(&c.provenance, "provenance", c.provenance,
+			"When set, the list (and the generation it was loaded in)\n"+
+				"that each field of a result came from is printed after it.\n"+
+				"(The same as the {provenance} directive.)")
+		c.flags.BoolVar(&flagSearchGen, "generation", flagSearchGen,
+			"When set, the generation of the data searched, when it was\n"+
+				"loaded and the date of its lists are printed to stderr.")
+		c.flags.BoolVar(&flagSearchJSON, "json", flagSearchJSON,
+			"When set, the results are printed as one JSON object in the\n"+
+				"stable format of the 'jsonapi' package. Errors are in the\n"+
+				"object too. Ambiguous queries are never prompted for.")
 	},
 }
 
@@ -132,10 +169,41 @@ All search directives
 }
 
 func cmd_search(c *command) bool {
-	c.assertLeastNArg(1)
+	if !flagSearchBatch {
+		c.assertLeastNArg(1)
+	}
 	db := openDb(c.dbinfo())
 	defer closeDb(db)
 
+	if flagSearchOnline {
+		provider, ok := c.onlineProvider()
+		if !ok {
+			return false
+		}
+		c.fallback = online.Fallback(db, provider)
+	}
+	if flagSearchGen {
+		snap, err := db.Snapshot()
+		if err != nil {
+			pef("Could not get database generation: %s", err)
+			return false
+		}
+		pef("Results from %s.", snap)
+	}
+	if flagSearchBatch {
+		if flagSearchJSON {
+			pef("The -batch and -json flags can't be used together.")
+			return false
+		}
+		return c.searchBatch(db)
+	}
+	if flagSearchJSON {
+		query := strings.Join(c.flags.Args(), " ")
+		resp := jsonapi.Search(db, jsonapi.SearchRequest{Query: query},
+			c.configureSearcher)
+		return writeJSON(resp) && len(resp.Error) == 0
+	}
+
 	template := c.tpl("search_result")
 	results, ok := c.results(db, false)
 	if !ok {
@@ -153,3 +221,120 @@ func cmd_search(c *command) bool {
 	}
 	return true
 }
+
+// searchBatch resolves each query read from stdin to its best hit.
+func (c *command) searchBatch(db *imdb.DB) bool {
+	var queries []string
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if q := strings.TrimSpace(scanner.Text()); len(q) > 0 {
+			queries = append(queries, q)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		pef("Error reading queries from stdin: %s", err)
+		return false
+	}
+
+	ok := true
+	for _, b := range c.batchSearch(db, queries) {
+		if b.Err != nil {
+			pef("%s: %s", b.Query, b.Err)
+			ok = false
+		}
+		switch {
+		case b.Best == nil:
+			if flagSearchIds {
+				pf("0\n")
+			} else {
+				pf("-\n")
+			}
+		case flagSearchIds:
+			pf("%d\n", b.Best.Id)
+		default:
+			pf("%s\n", b.Best)
+		}
+	}
+	return ok
+}
+
+// writeJSON writes the value given to stdout as JSON, on one line. Errors
+// are reported, in which case false is returned.
+func writeJSON(v interface{}) bool {
+	if err := json.NewEncoder(os.Stdout).Encode(v); err != nil {
+		pef("%s", err)
+		return false
+	}
+	return true
+}
+
+// onlineProvider returns the online provider specified in the configuration.
+func (c *command) onlineProvider() (online.Provider, bool) {
+	name, key, ok := c.onlineConfig()
+	if !ok {
+		return nil, false
+	}
+	provider, err := online.ProviderByName(name, key)
+	if err != nil {
+		pef("%s", err)
+		return nil, false
+	}
+	return provider, true
+}
+
+// onlineConfig returns the name of the online provider and its API key as
+// specified in the configuration. The API key may be overridden by the
+// GOIM_ONLINE_KEY environment variable.
+func (c *command) onlineConfig() (provider, key string, ok bool) {
+	fpath := ""
+	if strings.HasSuffix(flagDb, "toml") {
+		fpath = flagDb
+	}
+	conf, err := c.config(fpath)
+	if err != nil {
+		pef("Could not load configuration: %s", err)
+		return "", "", false
+	}
+	if key := os.Getenv("GOIM_ONLINE_KEY"); len(key) > 0 {
+		conf.OnlineKey = key
+	}
+	if len(conf.OnlineProvider) == 0 || len(conf.OnlineKey) == 0 {
+		pef("An online provider and API key must be set in the " +
+			"configuration file.")
+		return "", "", false
+	}
+	return strings.ToLower(conf.OnlineProvider), conf.OnlineKey, true
+}
+
+// defineMacros defines the search macros in the configuration file, if there
+// is one. Macros that use other macros are defined after the macros they use.
+// Macros that can't be defined are reported.
+func (c *command) defineMacros() {
+	fpath := ""
+	if strings.HasSuffix(flagDb, "toml") {
+		fpath = flagDb
+	}
+	conf, err := c.config(fpath)
+	if err != nil || len(conf.Macros) == 0 {
+		return
+	}
+	for len(conf.Macros) > 0 {
+		var errs []error
+		defined := 0
+		for name, query := range conf.Macros {
+			if err := search.DefineMacro(name, query); err != nil {
+				errs = append(errs, err)
+			} else {
+				delete(conf.Macros, name)
+				defined++
+			}
+		}
+		// Stop when no more macros can be defined.
+		if defined == 0 {
+			for _, err := range errs {
+				pef("%s", err)
+			}
+			return
+		}
+	}
+}
@@ -14,9 +14,14 @@ import (
 var cmdSize = &command{
 	name:      "size",
 	shortHelp: "lists size of tables and total size of database",
-	help:      "",
-	flags:     flag.NewFlagSet("size", flag.ExitOnError),
-	run:       cmd_size,
+	help: `
+Lists the number of rows in every table and the size of the database. The
+generation of the data is printed first, along with when it was loaded and the
+date of the lists it was loaded from, so that you can tell how fresh search
+results are.
+`,
+	flags: flag.NewFlagSet("size", flag.ExitOnError),
+	run:   cmd_size,
 }
 
 func cmd_size(c *command) bool {
@@ -28,6 +33,13 @@ func cmd_size(c *command) bool {
 		pef("%s", err)
 		return false
 	}
+	snap, err := db.Snapshot()
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	pf("Database is at %s.\n\n", snap)
+
 	tw := tabwriter.NewWriter(os.Stdout, 0, 2, 4, ' ', 0)
 	for _, table := range tables {
 		fmt.Fprintf(tw, "%s\t%s\n", table, tableSize(db, table))
@@ -46,7 +58,7 @@ func cmd_size(c *command) bool {
 // Note that 'name' is assumed to be SQL-safe.
 func tableSize(db *imdb.DB, name string) string {
 	count := csql.Count(db, sf("SELECT COUNT(*) AS count FROM %s", name))
-	if db.Driver == "sqlite3" {
+	if db.Driver != "postgres" {
 		return sf("%d rows", count)
 	}
 	var size string
@@ -58,7 +70,7 @@ func tableSize(db *imdb.DB, name string) string {
 // databaseSize returns a pretty string indicating the size of the entire
 // database on disk.
 func databaseSize(db *imdb.DB, dsn string) string {
-	if db.Driver == "sqlite3" {
+	if db.Driver != "postgres" {
 		fi, err := os.Stat(dsn)
 		csql.Panic(err)
 		return prettyFileSize(fi.Size())
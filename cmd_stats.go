@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var flagStatsCastBreakdown = false
+
+var cmdStats = &command{
+	name:      "stats",
+	shortHelp: "counts entities and credits by role or gender",
+	help: `
+The stats command prints the number of movies, TV shows, episodes and people
+in the database, along with the number of credits in each role.
+
+With '-cast-breakdown', cast credits are counted by the list they were loaded
+from instead: IMDb doesn't record the gender of people, but it splits cast
+members between the actors and actresses lists. Credits are grouped by the
+decade their media was released in, and the share of credits from the
+actresses list is given for all credits and for leading roles (billed first).
+Cast credits loaded by older versions of Goim don't record their list, and
+are counted separately. Load the 'actors' list again to record it.
+
+The same credits can be searched with '{role:actress}'. For example:
+
+    goim stats -cast-breakdown
+    goim search '{credits:the matrix {movie}} {role:actress}'
+`,
+	flags: flag.NewFlagSet("stats", flag.ExitOnError),
+	run:   cmd_stats,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.BoolVar(&flagStatsCastBreakdown, "cast-breakdown",
+			flagStatsCastBreakdown,
+			"When set, cast credits are counted by decade and by the list\n"+
+				"they were loaded from (actors or actresses).")
+	},
+}
+
+func cmd_stats(c *command) bool {
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	var err error
+	if flagStatsCastBreakdown {
+		err = castBreakdown(db)
+	} else {
+		err = entityStats(db)
+	}
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	return true
+}
+
+// entityStats prints the number of entities of each kind and the number of
+// credits in each role.
+func entityStats(db *imdb.DB) (err error) {
+	defer csql.Safe(&err)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 2, 4, ' ', 0)
+	for _, table := range []string{"movie", "tvshow", "episode", "actor"} {
+		fmt.Fprintf(tw, "%s\t%d\n", table, rowCount(db, table))
+	}
+	rows := csql.Query(db, `
+		SELECT role, COUNT(*) FROM credit GROUP BY role ORDER BY role
+	`)
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var role string
+		var count int
+		csql.Scan(s, &role, &count)
+		fmt.Fprintf(tw, "%s credits\t%d\n", role, count)
+	})
+	tw.Flush()
+	return
+}
+
+// castCounts is the number of cast credits from each list in one decade.
+type castCounts struct {
+	decade                     int
+	actors, actresses, unknown int
+	leadActors, leadActresses  int
+}
+
+// castBreakdown prints the number of cast credits from the actors and
+// actresses lists in each decade.
+func castBreakdown(db *imdb.DB) (err error) {
+	defer csql.Safe(&err)
+
+	// Integer division isn't the same everywhere (DuckDB's '/' returns a
+	// float), so decades are computed with the remainder instead.
+	rows := csql.Query(db, `
+		SELECT
+			COALESCE(m.year, t.year, e.year, 0)
+				- COALESCE(m.year, t.year, e.year, 0) % 10 AS decade,
+			SUM(CASE WHEN c.source = 'actors' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN c.source = 'actresses' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN c.source = '' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN c.source = 'actors' AND c.position = 1
+				THEN 1 ELSE 0 END),
+			SUM(CASE WHEN c.source = 'actresses' AND c.position = 1
+				THEN 1 ELSE 0 END)
+		FROM credit AS c
+		LEFT JOIN movie AS m ON c.media_atom_id = m.atom_id
+		LEFT JOIN tvshow AS t ON c.media_atom_id = t.atom_id
+		LEFT JOIN episode AS e ON c.media_atom_id = e.atom_id
+		WHERE c.role = 'actor'
+		GROUP BY decade
+		ORDER BY decade
+	`)
+	var counts []castCounts
+	var total castCounts
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var cc castCounts
+		csql.Scan(s, &cc.decade, &cc.actors, &cc.actresses, &cc.unknown,
+			&cc.leadActors, &cc.leadActresses)
+		counts = append(counts, cc)
+
+		total.actors += cc.actors
+		total.actresses += cc.actresses
+		total.unknown += cc.unknown
+		total.leadActors += cc.leadActors
+		total.leadActresses += cc.leadActresses
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "decade\tactors\tactresses\tshare\t"+
+		"lead actors\tlead actresses\tshare\t\n")
+	for _, cc := range counts {
+		decade := "unknown"
+		if cc.decade > 0 {
+			decade = sf("%ds", cc.decade)
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", decade, cc)
+	}
+	fmt.Fprintf(tw, "total\t%s\n", total)
+	tw.Flush()
+
+	if total.unknown > 0 {
+		pf("\n%d cast credits were loaded without recording their list. "+
+			"Load the 'actors' list again to count them.\n", total.unknown)
+	}
+	return
+}
+
+// String returns the counts as tab separated columns, with the share of
+// credits from the actresses list after each pair of counts.
+func (cc castCounts) String() string {
+	return sf("%d\t%d\t%s\t%d\t%d\t%s\t",
+		cc.actors, cc.actresses, share(cc.actresses, cc.actors),
+		cc.leadActors, cc.leadActresses,
+		share(cc.leadActresses, cc.leadActors))
+}
+
+// share returns the percentage of n out of n plus others.
+func share(n, others int) string {
+	if n+others == 0 {
+		return "-"
+	}
+	return sf("%.1f%%", 100*float64(n)/float64(n+others))
+}
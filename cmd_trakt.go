@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strconv"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var flagTraktNamespace = "trakt"
+
+var cmdTrakt = &command{
+	name: "trakt",
+	positionalUsage: "(import file [ file ... ] | " +
+		"export (watchlist | ratings))",
+	shortHelp: "imports or exports Trakt watchlists and ratings",
+	help: `
+The trakt command imports a Trakt.tv watchlist and ratings into an overlay
+(see 'goim overlay'), and exports them back in the format Trakt accepts.
+
+'import' reads the JSON files given, which are either the 'watchlist' and
+'ratings' files of a Trakt data export or the responses of Trakt's
+'/sync/watchlist' and '/sync/ratings' API. Every item on the watchlist gets a
+'watchlist' tag (whose value is the date it was added) and every rated item
+gets a 'rating' tag (whose value is the rating, from 1 to 10). Movies, TV
+shows and episodes are matched by their IMDb identifiers, which must be loaded
+as cross references first (see 'goim xref'). Items without one are matched by
+their title and year instead. Seasons are skipped.
+
+Like any overlay, importing replaces every tag in the namespace ('trakt',
+unless set with '-namespace'), so the watchlist and ratings should be imported
+together.
+
+'export' writes the tags of the namespace as JSON to stdout, in the format of
+the body of Trakt's '/sync/watchlist' (for 'watchlist') or '/sync/ratings'
+(for 'ratings') API. Any tags named 'watchlist' or 'rating' can be exported,
+so a watchlist kept in Goim can be sent to Trakt. For example:
+
+    goim trakt import watchlist.json ratings.json
+    goim search '{tag:watchlist} {genre:horror}'
+    goim overlay mine mine.csv
+    goim trakt -namespace mine export watchlist > watchlist.json
+`,
+	flags: flag.NewFlagSet("trakt", flag.ExitOnError),
+	run:   cmd_trakt,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagTraktNamespace, "namespace",
+			flagTraktNamespace,
+			"The overlay namespace that Trakt items are imported into or\n"+
+				"exported from.")
+		c.flags.BoolVar(&flagWarnings, "warn", flagWarnings,
+			"When set, warnings about skipped items will be shown.")
+	},
+}
+
+// traktIds are the identifiers of a Trakt item in other databases.
+type traktIds struct {
+	Imdb string `json:"imdb,omitempty"`
+}
+
+// traktMedia is a movie, TV show, season or episode on Trakt.
+type traktMedia struct {
+	Title string   `json:"title,omitempty"`
+	Year  int      `json:"year,omitempty"`
+	Ids   traktIds `json:"ids"`
+
+	// Rating is only set when exporting ratings.
+	Rating int `json:"rating,omitempty"`
+}
+
+// traktItem is an item on a Trakt watchlist or list of ratings.
+type traktItem struct {
+	Type     string      `json:"type"`
+	ListedAt string      `json:"listed_at"`
+	Rating   int         `json:"rating"`
+	Movie    *traktMedia `json:"movie"`
+	Show     *traktMedia `json:"show"`
+	Episode  *traktMedia `json:"episode"`
+}
+
+// traktSync is the body of a request to Trakt's sync API.
+type traktSync struct {
+	Movies   []traktMedia `json:"movies"`
+	Shows    []traktMedia `json:"shows"`
+	Episodes []traktMedia `json:"episodes"`
+}
+
+func cmd_trakt(c *command) bool {
+	c.assertLeastNArg(1)
+	switch c.flags.Arg(0) {
+	case "import":
+		c.assertLeastNArg(2)
+		var rows [][]string
+		for _, fpath := range c.flags.Args()[1:] {
+			items, err := readTraktFile(fpath)
+			if err != nil {
+				pef("%s", err)
+				return false
+			}
+			rows = append(rows, traktRows(items)...)
+		}
+		db := openDb(c.dbinfo())
+		defer closeDb(db)
+		if err := loadOverlay(db, flagTraktNamespace, rows); err != nil {
+			pef("%s", err)
+			return false
+		}
+	case "export":
+		c.assertNArg(2)
+		tag := map[string]string{
+			"watchlist": "watchlist",
+			"ratings":   "rating",
+		}[c.flags.Arg(1)]
+		if len(tag) == 0 {
+			pef("Unknown list '%s'. Use 'watchlist' or 'ratings'.",
+				c.flags.Arg(1))
+			return false
+		}
+		db := openDb(c.dbinfo())
+		defer closeDb(db)
+		sync, err := traktExport(db, flagTraktNamespace, tag)
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		bs, err := json.MarshalIndent(sync, "", "  ")
+		if err != nil {
+			pef("%s", err)
+			return false
+		}
+		os.Stdout.Write(append(bs, '\n'))
+	default:
+		pef("Unknown trakt command '%s'. Use 'import' or 'export'.",
+			c.flags.Arg(0))
+		return false
+	}
+	return true
+}
+
+// readTraktFile reads the items of a Trakt watchlist or list of ratings.
+func readTraktFile(fpath string) ([]traktItem, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []traktItem
+	if err := json.NewDecoder(f).Decode(&items); err != nil {
+		return nil, ef("Could not read Trakt items from '%s': %s", fpath, err)
+	}
+	return items, nil
+}
+
+// traktRows returns the overlay rows for the Trakt items given. Items are
+// on the watchlist when they have the date they were listed, and are rated
+// when they have a rating.
+func traktRows(items []traktItem) [][]string {
+	var rows [][]string
+	for _, item := range items {
+		ent, ok := item.entity()
+		if !ok {
+			warnf("Could not find an IMDb identifier, title or year for "+
+				"Trakt %s. Skipping.", item.Type)
+			continue
+		}
+		if len(item.ListedAt) > 0 {
+			date := item.ListedAt
+			if len(date) > 10 { // e.g., '2014-09-01T09:10:11.000Z'
+				date = date[:10]
+			}
+			rows = append(rows, []string{ent, "watchlist", date})
+		}
+		if item.Rating > 0 {
+			rows = append(rows,
+				[]string{ent, "rating", strconv.Itoa(item.Rating)})
+		}
+	}
+	return rows
+}
+
+// entity returns the IMDb identifier of the item, or its IMDb key string
+// (e.g., 'The Matrix (1999)' or '"Firefly" (2002)') when it doesn't have
+// one. Episodes must have an IMDb identifier.
+func (item traktItem) entity() (string, bool) {
+	var media *traktMedia
+	var key string
+	switch item.Type {
+	case "movie":
+		media = item.Movie
+		if media != nil {
+			key = sf("%s (%d)", media.Title, media.Year)
+		}
+	case "show":
+		media = item.Show
+		if media != nil {
+			key = sf("\"%s\" (%d)", media.Title, media.Year)
+		}
+	case "episode":
+		media = item.Episode
+	}
+	switch {
+	case media == nil:
+		return "", false
+	case len(media.Ids.Imdb) > 0:
+		return media.Ids.Imdb, true
+	case len(key) > 0 && len(media.Title) > 0 && media.Year > 0:
+		return key, true
+	}
+	return "", false
+}
+
+// traktExport returns the entities with the tag given in the namespace given
+// as the body of a request to Trakt's sync API. When the tag is 'rating',
+// its values are the ratings. Entities are identified by their title, year
+// and IMDb identifier, if one is known. Episodes without one are skipped.
+func traktExport(
+	db *imdb.DB,
+	namespace, tag string,
+) (sync traktSync, err error) {
+	defer csql.Safe(&err)
+
+	sync = traktSync{
+		Movies:   []traktMedia{},
+		Shows:    []traktMedia{},
+		Episodes: []traktMedia{},
+	}
+	rows := csql.Query(db, `
+		SELECT
+			o.atom_id, o.value, COALESCE(x.id, ''), COALESCE(n.name, ''),
+			COALESCE(m.year, t.year, e.year, 0),
+			CASE
+				WHEN m.atom_id IS NOT NULL THEN 'movie'
+				WHEN t.atom_id IS NOT NULL THEN 'tvshow'
+				WHEN e.atom_id IS NOT NULL THEN 'episode'
+				ELSE ''
+			END
+		FROM overlay AS o
+		LEFT JOIN xref AS x ON x.atom_id = o.atom_id AND x.source = 'imdb'
+		LEFT JOIN name AS n ON n.atom_id = o.atom_id
+		LEFT JOIN movie AS m ON m.atom_id = o.atom_id
+		LEFT JOIN tvshow AS t ON t.atom_id = o.atom_id
+		LEFT JOIN episode AS e ON e.atom_id = o.atom_id
+		WHERE o.namespace = $1 AND o.tag = $2
+		ORDER BY o.atom_id ASC
+	`, namespace, tag)
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var id imdb.Atom
+		var value, kind string
+		var media traktMedia
+		csql.Scan(s, &id, &value, &media.Ids.Imdb, &media.Title,
+			&media.Year, &kind)
+		if tag == "rating" {
+			rating, err := strconv.Atoi(value)
+			if err != nil || rating < 1 || rating > 10 {
+				warnf("Rating '%s' of atom %d is not from 1 to 10. "+
+					"Skipping.", value, id)
+				return
+			}
+			media.Rating = rating
+		}
+		switch kind {
+		case "movie":
+			sync.Movies = append(sync.Movies, media)
+		case "tvshow":
+			sync.Shows = append(sync.Shows, media)
+		case "episode":
+			if len(media.Ids.Imdb) == 0 {
+				warnf("Episode '%s' has no IMDb identifier. Skipping.",
+					media.Title)
+				return
+			}
+			// Trakt finds episodes by their identifiers alone.
+			media.Title, media.Year = "", 0
+			sync.Episodes = append(sync.Episodes, media)
+		default:
+			warnf("Atom %d is not a movie, TV show or episode. Skipping.", id)
+		}
+	})
+	return sync, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testTraktItems = `[
+  {"rank": 1, "listed_at": "2014-09-01T09:10:11.000Z", "type": "movie",
+   "movie": {"title": "The Matrix", "year": 1999,
+             "ids": {"trakt": 481, "imdb": "tt0133093", "tmdb": 603}}},
+  {"rated_at": "2015-01-01T00:00:00.000Z", "rating": 9, "type": "show",
+   "show": {"title": "Firefly", "year": 2002, "ids": {"tvdb": 78874}}},
+  {"listed_at": "2016-02-03T04:05:06.000Z", "rating": 7, "type": "episode",
+   "show": {"title": "Firefly", "year": 2002},
+   "episode": {"season": 1, "number": 1, "title": "Serenity",
+               "ids": {"imdb": "tt0579539"}}},
+  {"rating": 8, "type": "episode",
+   "episode": {"season": 1, "number": 2, "title": "The Train Job",
+               "ids": {}}},
+  {"listed_at": "2017-01-01T00:00:00.000Z", "type": "season",
+   "season": {"number": 1}}
+]`
+
+func TestTraktRows(t *testing.T) {
+	var items []traktItem
+	if err := json.Unmarshal([]byte(testTraktItems), &items); err != nil {
+		t.Fatal(err)
+	}
+	got := traktRows(items)
+	want := [][]string{
+		{"tt0133093", "watchlist", "2014-09-01"},
+		{`"Firefly" (2002)`, "rating", "9"},
+		{"tt0579539", "watchlist", "2016-02-03"},
+		{"tt0579539", "rating", "7"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\n got %q\nwant %q", got, want)
+	}
+}
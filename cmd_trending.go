@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
+)
+
+var cmdTrending = &command{
+	name:            "trending",
+	positionalUsage: "[ query ]",
+	shortHelp:       "lists titles that gained the most votes lately",
+	help: `
+The trending command lists the entities whose number of votes grew the most
+between the last two loads of the 'ratings' list, along with how many votes
+they gained. It needs the rating history, which is only kept once ratings are
+loaded with 'goim load -rating-history'. (So it's empty until the ratings
+have been loaded twice.)
+
+The query is optional, and may contain any search directives to narrow down
+the entities listed. For example, this lists the 10 movies with at least
+10,000 votes that gained the most votes:
+
+    goim trending {movie} {votes:10000-} {limit:10}
+
+This is the same as searching with '{trend:rising}'.
+`,
+	flags: flag.NewFlagSet("trending", flag.ExitOnError),
+	run:   cmd_trending,
+	other: true,
+}
+
+func cmd_trending(c *command) bool {
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	gens, err := ratingGenerations(db)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	if gens < 2 {
+		pef("The rating history has %d generation(s), but two are needed. "+
+			"Load the 'ratings' list with '-rating-history' (twice).", gens)
+		return false
+	}
+
+	query := "{trend:rising} " + strings.Join(c.flags.Args(), " ")
+	searcher, err := search.Query(db, query)
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	searcher.Chooser(c.chooser)
+	results, err := searcher.Results()
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	if len(results) == 0 {
+		pef("No trending results found.")
+		return false
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+	for i, r := range results {
+		fmt.Fprintf(tw, "%3d.\t+%d\t%s\t%s\n",
+			i+1, r.Growth, r.Entity, entityLabel(r))
+	}
+	tw.Flush()
+	return true
+}
+
+// ratingGenerations returns the number of generations in the rating history.
+func ratingGenerations(db *imdb.DB) (n int, err error) {
+	defer csql.Safe(&err)
+	n = csql.Count(db,
+		"SELECT COUNT(DISTINCT generation) FROM rating_history")
+	return
+}
+
+// entityLabel returns the name of a result along with its year and rank.
+func entityLabel(r search.Result) string {
+	label := r.Name
+	if r.Year > 0 {
+		label += sf(" (%d)", r.Year)
+	}
+	if !r.Rank.Unranked() {
+		label += sf(" (rank: %d/100, votes: %d)", r.Rank.Rank, r.Rank.Votes)
+	}
+	return label
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var (
+	flagWatchNamespace = ""
+	flagWatchTag       = "watchlist"
+	flagWatchCountry   = ""
+	flagWatchDays      = 90
+	flagWatchAddr      = "localhost:8080"
+)
+
+var cmdWatch = &command{
+	name:            "watch",
+	positionalUsage: "(ics | serve)",
+	shortHelp:       "writes upcoming episodes of watched shows as iCalendar",
+	help: `
+The watch command writes an iCalendar feed with the air dates of the upcoming
+episodes of the TV shows being watched, which any calendar application can
+import or subscribe to.
+
+The TV shows being watched are the TV shows with a 'watchlist' tag (or the tag
+set with '-tag') in an overlay (see 'goim overlay' and 'goim trakt'). Only the
+tags of one namespace are used when '-namespace' is set.
+
+Air dates are the release dates of episodes, so the 'release-dates' list must
+be loaded. An episode airs on the earliest of its release dates, or on its
+release date in the country set with '-country'. Episodes airing from today
+until '-days' days from now are in the calendar, with one all day event each.
+
+'ics' writes the calendar to stdout:
+
+    goim watch ics > shows.ics
+
+'serve' runs an HTTP server (on the address set with '-addr') that serves the
+calendar at '/watch.ics', so that calendar applications can subscribe to it.
+The calendar is built from the database on every request, so it's always as
+current as the database. It runs until interrupted.
+`,
+	flags: flag.NewFlagSet("watch", flag.ExitOnError),
+	run:   cmd_watch,
+	other: true,
+	addFlags: func(c *command) {
+		c.flags.StringVar(&flagWatchNamespace, "namespace",
+			flagWatchNamespace,
+			"When set, only the tags in this overlay namespace are used.")
+		c.flags.StringVar(&flagWatchTag, "tag", flagWatchTag,
+			"The overlay tag of the TV shows being watched.")
+		c.flags.StringVar(&flagWatchCountry, "country", flagWatchCountry,
+			"When set, only release dates in this country are used\n"+
+				"(e.g., 'USA' or 'UK').")
+		c.flags.IntVar(&flagWatchDays, "days", flagWatchDays,
+			"The number of days from today with episodes in the calendar.")
+		c.flags.StringVar(&flagWatchAddr, "addr", flagWatchAddr,
+			"The address that 'serve' listens on.")
+	},
+}
+
+// airing is an episode of a watched TV show and the date it airs on.
+type airing struct {
+	ep       imdb.Episode
+	show     string
+	showYear int
+	country  string
+	aired    time.Time
+}
+
+func cmd_watch(c *command) bool {
+	c.assertNArg(1)
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	switch c.flags.Arg(0) {
+	case "ics":
+		if err := writeWatchCalendar(db, os.Stdout); err != nil {
+			pef("%s", err)
+			return false
+		}
+	case "serve":
+		defer handleSignals()()
+		return serveWatchCalendar(db, flagWatchAddr)
+	default:
+		pef("Unknown watch command '%s'. Use 'ics' or 'serve'.",
+			c.flags.Arg(0))
+		return false
+	}
+	return true
+}
+
+// writeWatchCalendar writes the calendar of the upcoming episodes of watched
+// TV shows to w.
+func writeWatchCalendar(db *imdb.DB, w io.Writer) error {
+	airings, err := watchAirings(db, flagWatchNamespace, flagWatchTag)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	from := now.Format("2006-01-02")
+	to := now.AddDate(0, 0, flagWatchDays).Format("2006-01-02")
+	airings = upcomingAirings(airings, flagWatchCountry, from, to)
+	return writeICS(w, airings, now)
+}
+
+// serveWatchCalendar serves the calendar at '/watch.ics' on the address
+// given until the process is interrupted.
+func serveWatchCalendar(db *imdb.DB, addr string) bool {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/watch.ics", func(w http.ResponseWriter, r *http.Request) {
+		// The calendar is built before anything is written, so that errors
+		// can still be reported with a status.
+		buf := new(bytes.Buffer)
+		if err := writeWatchCalendar(db, buf); err != nil {
+			pef("%s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+	logf("Serving the calendar at http://%s/watch.ics", addr)
+	select {
+	case err := <-errs:
+		pef("%s", err)
+		return false
+	case <-interrupted:
+		srv.Close()
+		return true
+	}
+}
+
+// watchAirings returns every release date of every episode of the TV shows
+// with the tag given. When the namespace is empty, tags in every namespace
+// are used.
+func watchAirings(
+	db *imdb.DB,
+	namespace, tag string,
+) (airings []airing, err error) {
+	defer csql.Safe(&err)
+
+	args := []interface{}{tag}
+	cond := "o.tag = $1"
+	if len(namespace) > 0 {
+		args = append(args, namespace)
+		cond += " AND o.namespace = $2"
+	}
+	rows := csql.Query(db, sf(`
+		SELECT DISTINCT
+			e.atom_id, e.tvshow_atom_id, COALESCE(en.name, ''),
+			e.year, e.season, e.episode_num,
+			COALESCE(tn.name, ''), t.year, r.country, r.released
+		FROM overlay AS o
+		INNER JOIN tvshow AS t ON t.atom_id = o.atom_id
+		INNER JOIN episode AS e ON e.tvshow_atom_id = t.atom_id
+		INNER JOIN release_date AS r ON r.atom_id = e.atom_id
+		LEFT JOIN name AS tn ON tn.atom_id = t.atom_id
+		LEFT JOIN name AS en ON en.atom_id = e.atom_id
+		WHERE %s
+	`, cond), args...)
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var a airing
+		csql.Scan(s, &a.ep.Id, &a.ep.TvshowId, &a.ep.Title,
+			&a.ep.Year, &a.ep.Season, &a.ep.EpisodeNum,
+			&a.show, &a.showYear, &a.country, &a.aired)
+		airings = append(airings, a)
+	})
+	return airings, nil
+}
+
+// upcomingAirings returns the episodes that air from the date 'from' up to
+// (but not including) the date 'to', where dates are formatted like
+// '2006-01-02'. Each episode airs on its earliest release date, or on its
+// earliest release date in the country given, if one is given. Airings are
+// sorted by date, then by TV show, season and episode.
+func upcomingAirings(airings []airing, country, from, to string) []airing {
+	first := make(map[imdb.Atom]airing)
+	for _, a := range airings {
+		if len(country) > 0 && !strings.EqualFold(a.country, country) {
+			continue
+		}
+		if f, ok := first[a.ep.Id]; !ok || a.aired.Before(f.aired) {
+			first[a.ep.Id] = a
+		}
+	}
+
+	var upcoming []airing
+	for _, a := range first {
+		date := a.aired.Format("2006-01-02")
+		if date >= from && date < to {
+			upcoming = append(upcoming, a)
+		}
+	}
+	sort.Sort(airingsByDate(upcoming))
+	return upcoming
+}
+
+// airingsByDate sorts airings by date, then by TV show, season and episode.
+type airingsByDate []airing
+
+func (as airingsByDate) Len() int      { return len(as) }
+func (as airingsByDate) Swap(i, j int) { as[i], as[j] = as[j], as[i] }
+
+func (as airingsByDate) Less(i, j int) bool {
+	a, b := as[i], as[j]
+	switch {
+	case !a.aired.Equal(b.aired):
+		return a.aired.Before(b.aired)
+	case a.show != b.show:
+		return a.show < b.show
+	case a.ep.Season != b.ep.Season:
+		return a.ep.Season < b.ep.Season
+	case a.ep.EpisodeNum != b.ep.EpisodeNum:
+		return a.ep.EpisodeNum < b.ep.EpisodeNum
+	}
+	return a.ep.Id < b.ep.Id
+}
+
+// summary returns the title of the airing's event, e.g., 'Doctor Who S02E03:
+// School Reunion'.
+func (a airing) summary() string {
+	s := a.show
+	if a.ep.Season > 0 && a.ep.EpisodeNum > 0 {
+		s += sf(" S%02dE%02d", a.ep.Season, a.ep.EpisodeNum)
+	}
+	if len(a.ep.Title) > 0 {
+		s += ": " + a.ep.Title
+	}
+	return s
+}
+
+// writeICS writes the airings given as an iCalendar (RFC 5545) calendar with
+// an all day event for each. The time given is when the calendar was made.
+func writeICS(w io.Writer, airings []airing, now time.Time) error {
+	buf := new(bytes.Buffer)
+	line := func(format string, v ...interface{}) {
+		buf.WriteString(icsFold(sf(format, v...)))
+		buf.WriteString("\r\n")
+	}
+	stamp := now.UTC().Format("20060102T150405Z")
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//goim//watch//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:Goim")
+	for _, a := range airings {
+		line("BEGIN:VEVENT")
+		line("UID:episode-%d@goim", a.ep.Id)
+		line("DTSTAMP:%s", stamp)
+		line("DTSTART;VALUE=DATE:%s", a.aired.Format("20060102"))
+		line("DTEND;VALUE=DATE:%s", a.aired.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:%s", icsEscape(a.summary()))
+		if len(a.country) > 0 {
+			line("DESCRIPTION:%s", icsEscape(sf("%s (%d), airs in %s.",
+				a.show, a.showYear, a.country)))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// icsEscape escapes the special characters of an iCalendar text value.
+func icsEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`,
+	).Replace(s)
+}
+
+// icsFold folds a content line into lines of at most 75 octets, as required
+// by iCalendar. Continuation lines start with a space. Lines are never folded
+// in the middle of a UTF-8 character.
+func icsFold(s string) string {
+	const max = 75
+	var folded []string
+	for n := max; len(s) > n; n = max - 1 { // for the leading space
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		folded = append(folded, s[:n])
+		s = s[n:]
+	}
+	folded = append(folded, s)
+	return strings.Join(folded, "\r\n ")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+func testAiring(id imdb.Atom, season, num int, country, date string) airing {
+	aired, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		panic(err)
+	}
+	return airing{
+		ep: imdb.Episode{
+			Id: id, TvshowId: 1, Title: sf("Episode %d", num),
+			Season: season, EpisodeNum: num,
+		},
+		show:     "Doctor Who",
+		showYear: 2005,
+		country:  country,
+		aired:    aired,
+	}
+}
+
+func TestUpcomingAirings(t *testing.T) {
+	airings := []airing{
+		testAiring(4, 2, 4, "UK", "2006-04-29"),
+		testAiring(2, 2, 2, "UK", "2006-04-22"),
+		testAiring(2, 2, 2, "USA", "2006-04-15"),
+		testAiring(3, 2, 3, "UK", "2006-04-22"),
+		testAiring(5, 2, 5, "UK", "2006-05-13"),
+		testAiring(1, 2, 1, "UK", "2006-04-01"),
+	}
+	ids := func(as []airing) []imdb.Atom {
+		var ids []imdb.Atom
+		for _, a := range as {
+			ids = append(ids, a.ep.Id)
+		}
+		return ids
+	}
+	for _, test := range []struct {
+		country string
+		want    string
+	}{
+		{"", "[2 3 4]"},
+		{"uk", "[2 3 4]"},
+		{"USA", "[2]"},
+		{"Canada", "[]"},
+	} {
+		got := upcomingAirings(airings, test.country,
+			"2006-04-10", "2006-05-13")
+		if s := sf("%v", ids(got)); s != test.want {
+			t.Errorf("country %q: got %s, want %s", test.country, s, test.want)
+		}
+	}
+
+	// The USA airing is earlier, so episode 2 aired before April 20th.
+	got := upcomingAirings(airings, "", "2006-04-20", "2006-05-13")
+	if s := sf("%v", ids(got)); s != "[3 4]" {
+		t.Errorf("got %s, want [3 4]", s)
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	a := testAiring(7, 2, 3, "UK", "2006-04-29")
+	a.ep.Title = "School Reunion, Part 1; Again"
+	now := time.Date(2006, 4, 1, 12, 30, 0, 0, time.UTC)
+
+	buf := new(bytes.Buffer)
+	if err := writeICS(buf, []airing{a}, now); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//goim//watch//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:Goim",
+		"BEGIN:VEVENT",
+		"UID:episode-7@goim",
+		"DTSTAMP:20060401T123000Z",
+		"DTSTART;VALUE=DATE:20060429",
+		"DTEND;VALUE=DATE:20060430",
+		`SUMMARY:Doctor Who S02E03: School Reunion\, Part 1\; Again`,
+		"DESCRIPTION:Doctor Who (2005)\\, airs in UK.",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+	if got := buf.String(); got != want {
+		t.Errorf("\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestICSFold(t *testing.T) {
+	for _, long := range []string{
+		"SUMMARY:" + strings.Repeat("é", 80),
+		"DESCRIPTION:" + strings.Repeat("x", 138), // 150 octets
+		"DESCRIPTION:" + strings.Repeat("x", 188), // 200 octets
+	} {
+		folded := icsFold(long)
+		for _, line := range strings.Split(folded, "\r\n") {
+			if len(line) > 75 {
+				t.Errorf("line has %d octets: %q", len(line), line)
+			}
+			if !utf8.ValidString(line) {
+				t.Errorf("line splits a character: %q", line)
+			}
+		}
+		unfolded := strings.Replace(folded, "\r\n ", "", -1)
+		if unfolded != long {
+			t.Errorf("unfolded line is %q, want %q", unfolded, long)
+		}
+	}
+	if short := "SUMMARY:short"; icsFold(short) != short {
+		t.Errorf("short line was folded: %q", icsFold(short))
+	}
+}
@@ -6,17 +6,58 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/xdg"
 
+	"github.com/BurntSushi/goim/imdb"
 	"github.com/BurntSushi/goim/tpl"
 )
 
 var flagConfigOverwrite = false
 
 type config struct {
-	Driver     string
-	DataSource string `toml:"data_source"`
+	Driver         string
+	DataSource     string `toml:"data_source"`
+	OnlineProvider string `toml:"online_provider"`
+	OnlineKey      string `toml:"online_key"`
+	History        bool
+	Macros         map[string]string
+
+	MaxOpenConns    int      `toml:"max_open_conns"`
+	MaxIdleConns    int      `toml:"max_idle_conns"`
+	ConnMaxLifetime duration `toml:"conn_max_lifetime"`
+	StmtCacheSize   int      `toml:"stmt_cache_size"`
+	EntityCacheSize int      `toml:"entity_cache_size"`
+	ReadOnly        bool     `toml:"read_only"`
+	SQLiteProfile   string   `toml:"sqlite_profile"`
+
+	SaveDir   string `toml:"save_dir"`
+	ListStore string `toml:"list_store"`
+
+	Webhooks []string
+}
+
+// options returns the connection pool options in the configuration.
+func (conf config) options() imdb.Options {
+	return imdb.Options{
+		MaxOpenConns:    conf.MaxOpenConns,
+		MaxIdleConns:    conf.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(conf.ConnMaxLifetime),
+		StmtCacheSize:   conf.StmtCacheSize,
+		EntityCacheSize: conf.EntityCacheSize,
+		ReadOnly:        conf.ReadOnly,
+		SQLite:          imdb.SQLiteProfiles[conf.SQLiteProfile],
+	}
+}
+
+// duration is a time.Duration that can be decoded from a string like "5m".
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	dur, err := time.ParseDuration(string(text))
+	*d = duration(dur)
+	return err
 }
 
 var defaultConfig = `
@@ -24,6 +65,8 @@ var defaultConfig = `
 # Currently, goim has only been tested/optimized for SQLite and PostgreSQL.
 # For SQLite, the driver name is 'sqlite3'.
 # For PostgreSQL, the driver name is 'postgres'.
+# For DuckDB (a copy made for analytics with 'goim analytics'), the driver
+# name is 'duckdb'.
 driver = "sqlite3"
 
 # The data source specifies which database to connect to. For SQLite, this
@@ -41,6 +84,69 @@ driver = "sqlite3"
 # N.B. The 'sslmode=disable' appears to be required for a default PostgreSQL
 # installation. (At least on Archlinux, anyway.)
 data_source = "goim.sqlite"
+
+# An online service can be used as a fallback when a search doesn't find
+# anything in the database, which is useful for new releases that aren't in
+# the last dump of IMDb's lists. Set the provider to 'omdb' or 'tmdb' along with
+# your API key for the service, and then use 'goim search -online ...'.
+# The API key may also be set with the GOIM_ONLINE_KEY environment variable.
+# online_provider = "omdb"
+# online_key = ""
+
+# When enabled, every query run with 'search' (and the result chosen for
+# commands that pick a single result, like 'rename') is recorded in the
+# database. Use 'goim history' to review and re-run them.
+# history = false
+
+# The connection pool can be tuned for how goim is used. Zero leaves the
+# default alone. A negative number means no limit (or no idle connections).
+# A server should limit the number of open connections and recycle them
+# (e.g., conn_max_lifetime = "30m"). When the statement cache size is positive,
+# that many prepared statements are kept for queries that are run repeatedly.
+# max_open_conns = 0
+# max_idle_conns = 0
+# conn_max_lifetime = "0s"
+# stmt_cache_size = 0
+
+# When the entity cache size is positive, that many movies, TV shows, episodes
+# and actors are kept after they're looked up, which speeds up showing the same
+# entities over and over (e.g., in 'goim browse' or 'goim repl'). The cache is
+# emptied within a few seconds of a load finishing.
+# entity_cache_size = 0
+
+# When enabled, the database is opened such that nothing can change it, which
+# is useful for a pre-built database that is shared or shipped in a container.
+# Commands that write to the database (like 'load') fail, and search history
+# isn't recorded. The database's schema must already be up to date.
+# read_only = false
+
+# SQLite databases can be tuned for searching with the 'serve' profile, which
+# maps the database into memory. 'goim load' always uses the 'load' profile,
+# which turns off synchronous writes and uses a big page cache. (An
+# operating system crash while loading may corrupt the database, which must
+# then be loaded again.) The 'default' profile leaves SQLite's settings alone.
+# sqlite_profile = "default"
+
+# The directory that 'goim fetch' saves lists in, and that 'goim load cache'
+# loads them from. When empty, $XDG_DATA_HOME/goim/lists is used.
+# save_dir = ""
+
+# Where saved lists are copied to, so that 'goim load cache' can load them on
+# other machines. It may be a directory, 's3://bucket/prefix' or
+# 'gs://bucket/prefix'. See 'goim help fetch' for credentials. When empty,
+# lists are only kept in the save directory.
+# list_store = ""
+
+# URLs that a JSON summary of every load is posted to. See 'goim help load'.
+# webhooks = []
+
+# Macros are search directives that are shorthand for other directives. Each
+# macro is a name and the query it expands to. For example, with the macro
+# below, the query '{genre:horror} {good}' is the same as
+# '{genre:horror} {votes:10000-} {rank:70-}'. Macros may use other macros.
+# Every key after '[macros]' is a macro, so it must be the last section.
+# [macros]
+# good = "{votes:10000-} {rank:70-}"
 `
 
 var xdgPaths = xdg.Paths{XDGSuffix: "goim"}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"flag"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+var cmdXref = &command{
+	name:            "xref",
+	positionalUsage: "[ csv-file ]",
+	shortHelp:       "loads cross references to TMDb, Wikidata, etc.",
+	help: `
+The xref command loads a CSV file that maps entities in the database to
+identifiers in other databases, like TMDb or Wikidata. Each row of the CSV
+file must have the form:
+
+    entity,source,id
+
+Where 'source' is the name of the other database (e.g., 'tmdb' or 'wikidata')
+and 'id' is the identifier of the entity in that database (e.g., '603' or
+'Q83495').
+
+'entity' is either the IMDb key of a movie, TV show, episode or actor exactly
+as it appears in IMDb's lists (e.g., 'The Matrix (1999)'), or it is an IMDb
+identifier (e.g., 'tt0133093'). IMDb's plain text lists do not include IMDb
+identifiers, so they must be loaded first with rows whose source is 'imdb':
+
+    The Matrix (1999),imdb,tt0133093
+
+Once loaded, IMDb identifiers can be used to refer to entities in subsequent
+rows or files, which makes it easy to use mappings from other services that
+are keyed by IMDb identifiers.
+
+Loading a CSV file replaces all of the cross references for each source that
+appears in the file. Cross references are never touched by the load command,
+so they survive updates of IMDb's data.
+
+If no CSV file is given, then it is read from stdin.
+
+Rows with entities that cannot be found in the database are skipped (and
+reported with the -warn flag).
+`,
+	flags: flag.NewFlagSet("xref", flag.ExitOnError),
+	run:   cmd_xref,
+	addFlags: func(c *command) {
+		c.flags.BoolVar(&flagWarnings, "warn", flagWarnings,
+			"When set, warnings about skipped rows will be shown.")
+	},
+}
+
+func cmd_xref(c *command) bool {
+	if c.flags.NArg() > 1 {
+		c.showUsage()
+	}
+	db := openDb(c.dbinfo())
+	defer closeDb(db)
+
+	rows, err := readCSVFile(c.flags.Arg(0))
+	if err != nil {
+		pef("%s", err)
+		return false
+	}
+	if err := loadXrefs(db, rows); err != nil {
+		pef("%s", err)
+		return false
+	}
+	return true
+}
+
+// imdbIdent matches IMDb identifiers for titles and names.
+var imdbIdent = regexp.MustCompile("^(tt|nm)[0-9]+$")
+
+// loadXrefs replaces all cross references for each source in rows with the
+// cross references in rows. Each row must have three fields: an entity key
+// string (or an IMDb identifier), a source and an identifier.
+//
+// All rows with an "imdb" source are added first, so that IMDb identifiers
+// can be used as entities in the same set of rows.
+func loadXrefs(db *imdb.DB, rows [][]string) (err error) {
+	defer csql.Safe(&err)
+
+	for i, row := range rows {
+		if len(row) != 3 {
+			csql.Panic(ef("Row %d has %d fields, but cross references "+
+				"must have 3 fields: entity,source,id", i+1, len(row)))
+		}
+		for j := range row {
+			row[j] = strings.TrimSpace(row[j])
+		}
+		if len(row[1]) == 0 || len(row[2]) == 0 {
+			csql.Panic(ef("Row %d has an empty source or id.", i+1))
+		}
+		row[1] = strings.ToLower(row[1])
+	}
+
+	logf("Loading atoms...")
+	atoms, err := newAtomizer(db, nil)
+	csql.Panic(err)
+
+	csql.Panic(db.DropIndices("xref"))
+	defer func() { csql.Panic(db.CreateIndices("xref")) }()
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	sources := make(map[string]bool)
+	for _, row := range rows {
+		if !sources[row[1]] {
+			sources[row[1]] = true
+			csql.Exec(tx, "DELETE FROM xref WHERE source = $1", row[1])
+		}
+	}
+
+	// IMDb identifiers are resolved from memory, since the indices of the
+	// xref table are dropped while loading (and the inserter buffers rows).
+	// Existing identifiers are read first, unless they're being replaced.
+	imdbIds := make(map[string]imdb.Atom)
+	if !sources["imdb"] {
+		rs := csql.Query(tx,
+			"SELECT id, atom_id FROM xref WHERE source = $1", "imdb")
+		csql.ForRow(rs, func(scanner csql.RowScanner) {
+			var ident string
+			var id imdb.Atom
+			csql.Scan(scanner, &ident, &id)
+			imdbIds[ident] = id
+		})
+	}
+	resolve := func(ent string) (imdb.Atom, bool) {
+		if imdbIdent.MatchString(ent) {
+			id, ok := imdbIds[ent]
+			return id, ok
+		}
+		return atoms.AtomOnlyIfExist([]byte(ent))
+	}
+
+	ins, err := csql.NewInserter(tx, db.Driver, "xref",
+		"atom_id", "source", "id")
+	csql.Panic(err)
+
+	added, skipped := 0, 0
+	add := func(i int, row []string) {
+		id, ok := resolve(row[0])
+		if !ok {
+			warnf("Could not find entity '%s' (row %d). Skipping.", row[0], i+1)
+			skipped++
+			return
+		}
+		if row[1] == "imdb" {
+			imdbIds[row[2]] = id
+		}
+		csql.Panic(ins.Exec(id, row[1], row[2]))
+		added++
+	}
+	for i, row := range rows {
+		if row[1] == "imdb" {
+			add(i, row)
+		}
+	}
+	for i, row := range rows {
+		if row[1] != "imdb" {
+			add(i, row)
+		}
+	}
+	csql.Panic(ins.Exec())
+	csql.Panic(tx.Commit())
+	logf("Done. Added %d cross references (skipped %d).", added, skipped)
+	return
+}
+
+// resolveEntity returns the atom identifier of the entity given, which is
+// either an IMDb key string (like 'The Matrix (1999)') or an IMDb identifier
+// (like 'tt0133093') that was loaded with 'goim xref'. If the entity cannot
+// be found, then false is returned.
+func resolveEntity(db csql.Queryer, atoms *imdb.Atomizer, ent string) (
+	imdb.Atom, bool, error) {
+
+	if !imdbIdent.MatchString(ent) {
+		id, ok := atoms.AtomOnlyIfExist([]byte(ent))
+		return id, ok, nil
+	}
+	id, err := imdb.AtomFromXref(db, "imdb", ent)
+	return id, id > 0, err
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -24,6 +26,10 @@ var (
 	flagDb         = ""
 )
 
+// dbOptions configures the connection pool of databases opened with openDb.
+// It is set from the configuration file by dbinfo.
+var dbOptions imdb.Options
+
 var (
 	sf     = fmt.Sprintf
 	ef     = fmt.Errorf
@@ -54,6 +60,9 @@ type command struct {
 	run             func(*command) bool
 	tpls            *template.Template
 	other           bool
+	fallback        search.Fallback
+	disambiguate    bool
+	provenance      bool
 }
 
 func (c *command) showUsage() {
@@ -95,8 +104,8 @@ func (c *command) setCommonFlags() {
 	c.flags.StringVar(&flagDb, "db", flagDb,
 		"Overrides the database to be used. It should be a string of the "+
 			"form 'driver:dsn'.\n"+
-			"It may also be a 'sqlite3' file or a 'toml' file containing "+
-			"a Goim configuration.")
+			"It may also be a 'sqlite3' or 'duckdb' file or a 'toml' file "+
+			"containing a Goim configuration.")
 	c.flags.StringVar(&flagCpuProfile, "cpu-prof", flagCpuProfile,
 		"When set, a CPU profile will be written to the file path provided.")
 	c.flags.IntVar(&flagCpu, "cpu", flagCpu,
@@ -113,12 +122,16 @@ func (c *command) dbinfo() (driver, dsn string) {
 				strings.HasSuffix(flagDb, "sqlite3") {
 				driver = "sqlite3"
 				dsn = flagDb
+			} else if strings.HasSuffix(flagDb, "duckdb") {
+				driver = "duckdb"
+				dsn = flagDb
 			} else if strings.HasSuffix(flagDb, "toml") {
 				conf, err := c.config(flagDb)
 				if err != nil {
 					fatalf("Error loading '%s' as config file: %s", flagDb, err)
 				}
 				driver, dsn = conf.Driver, conf.DataSource
+				dbOptions = conf.options()
 			} else {
 				fatalf("Database must be of the form 'dirver:dsn'.")
 			}
@@ -134,6 +147,7 @@ func (c *command) dbinfo() (driver, dsn string) {
 				"Got this error when trying to read config: %s", err)
 		}
 		driver, dsn = conf.Driver, conf.DataSource
+		dbOptions = conf.options()
 	}
 	return
 }
@@ -149,6 +163,11 @@ func (c *command) config(fpath string) (conf config, err error) {
 		err = ef("Database driver '%s' or data source '%s' cannot be empty.",
 			conf.Driver, conf.DataSource)
 	}
+	if _, ok := imdb.SQLiteProfiles[conf.SQLiteProfile]; !ok &&
+		len(conf.SQLiteProfile) > 0 && err == nil {
+		err = ef("Unknown SQLite profile '%s'. Use 'default', 'load' or "+
+			"'serve'.", conf.SQLiteProfile)
+	}
 	return
 }
 
@@ -174,12 +193,24 @@ func (c *command) oneResult(db *imdb.DB) (*search.Result, bool) {
 }
 
 func (c *command) results(db *imdb.DB, one bool) ([]search.Result, bool) {
-	searcher, err := search.Query(db, strings.Join(c.flags.Args(), " "))
+	return c.queryResults(db, strings.Join(c.flags.Args(), " "), one)
+}
+
+// queryResults is like results, except the query is given instead of being
+// read from the positional arguments.
+func (c *command) queryResults(
+	db *imdb.DB,
+	query string,
+	one bool,
+) ([]search.Result, bool) {
+	searcher, err := search.Query(db, query)
 	if err != nil {
 		pef("%s", err)
 		return nil, false
 	}
 	searcher.Chooser(c.chooser)
+	searcher.MultiChooser(c.multiChooser)
+	c.configureSearcher(searcher)
 
 	results, err := searcher.Results()
 	if err != nil {
@@ -187,6 +218,7 @@ func (c *command) results(db *imdb.DB, one bool) ([]search.Result, bool) {
 		return nil, false
 	}
 	if len(results) == 0 {
+		c.recordHistory(db, query, nil)
 		pef("No results found.")
 		return nil, false
 	}
@@ -196,15 +228,86 @@ func (c *command) results(db *imdb.DB, one bool) ([]search.Result, bool) {
 			pef("%s", err)
 			return nil, false
 		}
+		c.recordHistory(db, query, r)
 		if r == nil {
 			pef("No results to pick from.")
 			return nil, false
 		}
 		return []search.Result{*r}, true
 	}
+	c.recordHistory(db, query, nil)
 	return results, true
 }
 
+// batchSearch returns the best hit for each query given, searched for with
+// the command's fallback.
+func (c *command) batchSearch(
+	db *imdb.DB,
+	queries []string,
+) []search.BatchResult {
+	return search.Batch(db, queries, func(s *search.Searcher) {
+		if c.fallback != nil {
+			s.Fallback(c.fallback)
+		}
+	})
+}
+
+// titleQuery returns a query for an entity of the kind given by its title,
+// within a year of the year given (unless it's 0). Braces are removed from
+// the title so that it can't be read as a directive.
+func titleQuery(title, kind string, year int) string {
+	title = strings.Map(func(r rune) rune {
+		if r == '{' || r == '}' {
+			return -1
+		}
+		return r
+	}, title)
+	q := sf("%s {%s}", title, kind)
+	if year > 0 {
+		q += sf(" {years:%d-%d}", year-1, year+1)
+	}
+	return q
+}
+
+// configureSearcher sets the options of the command that apply to every
+// search: its fallback and whether to disambiguate results or show their
+// provenance.
+func (c *command) configureSearcher(s *search.Searcher) {
+	if c.fallback != nil {
+		s.Fallback(c.fallback)
+	}
+	if c.disambiguate {
+		s.Disambiguate()
+	}
+	if c.provenance {
+		s.Provenance()
+	}
+}
+
+// recordHistory adds the query and chosen result (which may be nil) to the
+// search history if it's enabled in the configuration. Failures are only
+// reported as warnings, since the history is a convenience.
+func (c *command) recordHistory(db *imdb.DB, query string, r *search.Result) {
+	fpath := ""
+	if strings.HasSuffix(flagDb, "toml") {
+		fpath = flagDb
+	} else if len(flagDb) > 0 {
+		return
+	}
+	conf, err := c.config(fpath)
+	if err != nil || !conf.History || conf.ReadOnly {
+		return
+	}
+	var ent imdb.EntityKind
+	var chosen imdb.Atom
+	if r != nil && !r.External {
+		ent, chosen = r.Entity, r.Id
+	}
+	if err := db.AddHistory(query, ent, chosen); err != nil {
+		warnf("Could not record search history: %s", err)
+	}
+}
+
 func (c *command) chooser(
 	results []search.Result,
 	what string,
@@ -229,6 +332,62 @@ func (c *command) chooser(
 	return &results[choice], nil
 }
 
+// multiChooser is like chooser, except more than one result may be picked
+// by separating choices with commas.
+func (c *command) multiChooser(
+	results []search.Result,
+	what string,
+) ([]search.Result, error) {
+	pf("%s is ambiguous. Please choose one or more:\n", what)
+	template := c.tpl("search_result")
+	for i, result := range results {
+		c.tplExec(template, tpl.Args{E: result, A: tpl.Attrs{"Index": i + 1}})
+	}
+
+	pf("Choices [%d-%d, separated by commas]: ", 1, len(results))
+	answer, err := readLine(os.Stdin)
+	if err != nil {
+		return nil, ef("Error reading from stdin: %s", err)
+	}
+	var picked []search.Result
+	for _, field := range strings.Split(answer, ",") {
+		choice, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, ef("Invalid choice '%s'", field)
+		}
+		choice--
+		if choice == -1 {
+			return nil, nil
+		} else if choice < -1 || choice >= len(results) {
+			return nil, ef("Invalid choice %d", choice)
+		}
+		picked = append(picked, results[choice])
+	}
+	return picked, nil
+}
+
+// readLine reads a single line from r without reading past it (so that it is
+// safe to use with os.Stdin in between other reads).
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(string(line)), nil
+}
+
 func areYouSure(yesno string) bool {
 	var answer string
 	pf("%s [y/n]: ", yesno)
@@ -288,7 +447,7 @@ func createFile(fpath string) *os.File {
 }
 
 func openDb(driver, dsn string) *imdb.DB {
-	db, err := imdb.Open(driver, dsn)
+	db, err := imdb.OpenWith(driver, dsn, dbOptions)
 	if err != nil {
 		fatalf("Could not open %s database: %s", driver, err)
 	}
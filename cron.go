@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression with the five standard fields:
+// minute, hour, day of month, month and day of week. Each field is the set of
+// values that it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+
+	// Like cron, when both days of the month and days of the week are
+	// restricted, a day matches if either of them matches.
+	domStar, dowStar bool
+}
+
+// cronFields are the names and bounds of the fields of a cron expression.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 7 is Sunday, just like 0
+}
+
+// cronMacros are the shorthands accepted in place of a cron expression.
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// parseCron parses a cron expression like "0 4 * * 1" (every Monday at 4am).
+// Each field may be '*', a number, a range like '1-5', a step like '*/15' or
+// '0-30/10', or a comma separated list of any of those.
+func parseCron(expr string) (*cronSchedule, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, ef("Cron expression '%s' must have %d fields, but it "+
+			"has %d.", expr, len(cronFields), len(fields))
+	}
+	sets := make([]map[int]bool, len(fields))
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, ef("Bad %s in cron expression '%s': %s",
+				cronFields[i].name, expr, err)
+		}
+		sets[i] = set
+	}
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return &cronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3],
+		dow:     sets[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i > -1 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return nil, ef("bad step in '%s'", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return nil, ef("bad range '%s'", rng)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return nil, ef("bad value '%s'", rng)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = max // like '5/10', which means '5-max/10'
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, ef("'%s' is outside of %d-%d", rng, min, max)
+		}
+		for n := lo; n <= hi; n += step {
+			set[n] = true
+		}
+	}
+	return set, nil
+}
+
+// next returns the first time after the one given that the schedule matches.
+// Times are matched in the location of the time given. The zero time is
+// returned if nothing matches within five years (like '0 0 31 2 *').
+func (cs *cronSchedule) next(after time.Time) time.Time {
+	// Times are stepped through field by field with time.Date, since
+	// truncating a time works in absolute time, which doesn't line up with
+	// the hours of locations that are offset by a fraction of an hour.
+	loc := after.Location()
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(),
+		after.Minute()+1, 0, 0, loc)
+	limit := after.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		switch {
+		case !cs.month[int(m)]:
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+		case !cs.matchDay(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		case !cs.hour[t.Hour()]:
+			t = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+		case !cs.minute[t.Minute()]:
+			t = time.Date(y, m, d, t.Hour(), t.Minute()+1, 0, 0, loc)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (cs *cronSchedule) matchDay(t time.Time) bool {
+	dom, dow := cs.dom[t.Day()], cs.dow[int(t.Weekday())]
+	switch {
+	case cs.domStar && cs.dowStar:
+		return true
+	case cs.domStar:
+		return dow
+	case cs.dowStar:
+		return dom
+	}
+	return dom || dow
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	tests := []struct {
+		expr, after, next string
+	}{
+		{"0 4 * * 1", "2014-06-13 10:20", "2014-06-16 04:00"}, // Fri -> Mon
+		{"0 4 * * 1", "2014-06-16 04:00", "2014-06-23 04:00"},
+		{"*/15 * * * *", "2014-06-13 10:20", "2014-06-13 10:30"},
+		{"30 9-17/4 * * *", "2014-06-13 14:00", "2014-06-13 17:30"},
+		{"0 0 1 * *", "2014-12-15 00:00", "2015-01-01 00:00"},
+		{"0 0 29 2 *", "2014-03-01 00:00", "2016-02-29 00:00"},
+		{"0 12 13 * 5", "2014-06-01 00:00", "2014-06-06 12:00"}, // dom or dow
+		{"0 0 * * 7", "2014-06-13 10:20", "2014-06-15 00:00"},   // Sunday
+		{"@daily", "2014-06-13 10:20", "2014-06-14 00:00"},
+	}
+	for _, test := range tests {
+		cs, err := parseCron(test.expr)
+		if err != nil {
+			t.Fatalf("'%s': %s", test.expr, err)
+		}
+		got := cs.next(at(test.after))
+		if !got.Equal(at(test.next)) {
+			t.Fatalf("'%s' after %s: expected %s but got %s", test.expr,
+				test.after, test.next, got.Format("2006-01-02 15:04"))
+		}
+	}
+
+	cs, _ := parseCron("0 0 31 2 *")
+	if !cs.next(at("2014-01-01 00:00")).IsZero() {
+		t.Fatalf("expected no next time for February 31st")
+	}
+	for _, bad := range []string{"* * * *", "60 * * * *", "*/0 * * * *",
+		"5-1 * * * *", "a * * * *"} {
+		if _, err := parseCron(bad); err == nil {
+			t.Fatalf("expected an error for '%s'", bad)
+		}
+	}
+
+	// Schedules are matched in the location of the time given, even when
+	// it's offset from UTC by a fraction of an hour.
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("no time zone data: %s", err)
+	}
+	cs, _ = parseCron("0 4 * * 1")
+	after := time.Date(2014, 6, 13, 10, 20, 30, 0, kolkata)
+	want := time.Date(2014, 6, 16, 4, 0, 0, 0, kolkata)
+	if got := cs.next(after); !got.Equal(want) {
+		t.Fatalf("'0 4 * * 1' after %s: expected %s but got %s",
+			after, want, got)
+	}
+}
+
+func TestLockRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goim-cron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	unlock, err := lockRefresh(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockRefresh(dir); err == nil {
+		t.Fatalf("expected a second lock to fail")
+	}
+	unlock()
+
+	// A lock of a process that isn't running is taken over.
+	stale := path.Join(dir, "refresh.lock")
+	if err := ioutil.WriteFile(stale, []byte("999999999"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = lockRefresh(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+}
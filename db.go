@@ -1,8 +1,6 @@
 package main
 
 import (
-	"bytes"
-	"crypto/md5"
 	"database/sql"
 
 	"github.com/BurntSushi/csql"
@@ -49,123 +47,18 @@ func (tx *tx) Commit() error {
 	return nil
 }
 
-// atomMap stores a mapping from md5 hashes (in binary) to atom integer ids.
-type atomMap map[[md5.Size]byte]imdb.Atom
-
-// atomizer provides a readable/writable abstraction for accessing and creating
-// new atom identifiers.
-type atomizer struct {
-	db     *imdb.DB
-	atoms  atomMap
-	nextId imdb.Atom
-	ins    *csql.Inserter
-}
-
-// newAtomizer returns an atomizer that can be used to access or create new
-// atom identifiers. Note that if tx is nil, then the atomizer returned is
-// read-only (attempting to write will cause a panic).
-//
-// A read-only atomizer may be accessed from multiple goroutines
-// simultaneously, but a read/write atomizer may NOT.
-//
-// If a read/write atomizer is created, then the caller is responsible for
-// closing the transaction (which should be done immediately after a call to
-// atomizer.Close).
-//
-// Note that this function loads the entire set of atoms from the database
-// into memory, so it is costly.
-func newAtomizer(db *imdb.DB, tx *sql.Tx) (az *atomizer, err error) {
-	defer csql.Safe(&err)
-
-	az = &atomizer{db, make(atomMap, 1000000), 0, nil}
-	if tx != nil {
-		var err error
-		az.ins, err = csql.NewInserter(
-			tx, db.Driver, "atom", "id", "hash")
-		csql.Panic(err)
+// newAtomizer returns an atomizer with every atom in the database. If tx is
+// nil, then the atomizer returned is read-only. Otherwise, new atoms are
+// inserted in tx, which the caller must commit after calling Close.
+func newAtomizer(db *imdb.DB, tx *sql.Tx) (*imdb.Atomizer, error) {
+	if tx == nil {
+		return imdb.NewAtomizerSize(db, nil, atomMapSize)
 	}
-
-	rs := csql.Query(db, "SELECT id, hash FROM atom ORDER BY id ASC")
-	csql.ForRow(rs, az.readRow)
-	az.nextId++
-	return
-}
-
-// readRow scans a row from the atom table into an atomMap.
-func (az *atomizer) readRow(scanner csql.RowScanner) {
-	var id imdb.Atom
-	var rawBytes sql.RawBytes
-	csql.Scan(scanner, &id, &rawBytes)
-
-	var hash [md5.Size]byte
-	hashBytes := hash[:]
-	copy(hashBytes, rawBytes)
-	az.atoms[hash] = id
-	az.nextId = id
-}
-
-// atom returns the atom associated with the key string given, along with
-// whether it already existed or not. If it didn't exist, then a new atom is
-// created and returned (along with an error if there was a problem creating
-// the atom).
-func (az *atomizer) atom(key []byte) (imdb.Atom, bool, error) {
-	hash := hashKey(key)
-	if a, ok := az.atoms[hash]; ok {
-		return a, true, nil
+	ins, err := newInserter(tx, db.Driver, "atom", "id", "hash")
+	if err != nil {
+		return nil, err
 	}
-	a, err := az.add(hash)
-	return a, false, err
-}
-
-// atomOnlyIfExist returns an atom id for the key string given only if that
-// key string has already been atomized. If it doesn't exist, then the zero
-// atom is returned along with false. Otherwise, the atom id is returned along
-// with true.
-func (az *atomizer) atomOnlyIfExist(key []byte) (imdb.Atom, bool) {
-	hash := hashKey(key)
-	a, ok := az.atoms[hash]
-	return a, ok
-}
-
-// add always adds the given hash to the database with a fresh and unique
-// atom identifier. Will panic if this is called on a read-only atomizer.
-func (az *atomizer) add(hash [md5.Size]byte) (imdb.Atom, error) {
-	if az.ins == nil {
-		panic("cannot add atoms when opened read-only")
-	}
-	a := az.nextId
-	if err := az.ins.Exec(a, hash[:]); err != nil {
-		return 0, err
-	}
-	az.atoms[hash] = a
-	az.nextId++
-	return a, nil
-}
-
-// Close inserts any new atoms lingering in the buffer into the database.
-// This does NOT commit the transaction.
-// If the atomizer is read-only, this is a no-op.
-func (az *atomizer) Close() error {
-	if az.ins != nil {
-		ins := az.ins
-		az.ins = nil
-		return ins.Exec()
-	}
-	return nil
-}
-
-// hashKey returns a byte array corresponding to the md5 hash of the key
-// string given.
-func hashKey(s []byte) [md5.Size]byte {
-	h := md5.New()
-	h.Write(bytes.TrimSpace(s))
-	slice := h.Sum(nil)
-
-	var sum [md5.Size]byte
-	for i := 0; i < md5.Size; i++ {
-		sum[i] = slice[i]
-	}
-	return sum
+	return imdb.NewAtomizerSize(db, ins, atomMapSize)
 }
 
 // listTables itemizes the tables that are updated for each list name.
@@ -174,6 +67,7 @@ var listTables = map[string][]string{
 		"atom", "name", "movie", "tvshow", "episode",
 	},
 	"actors":               []string{"atom", "name", "actor", "credit"},
+	"crew":                 []string{"atom", "name", "actor", "credit"},
 	"sound-mix":            []string{"sound_mix"},
 	"genres":               []string{"genre"},
 	"language":             []string{"language"},
@@ -192,6 +86,7 @@ var listTables = map[string][]string{
 	"release-dates":        []string{"release_date"},
 	"quotes":               []string{"quote"},
 	"plot":                 []string{"plot"},
+	"biographies":          []string{"biography"},
 }
 
 // Returns the number of rows in the table given. This will panic with a
@@ -199,3 +94,10 @@ var listTables = map[string][]string{
 func rowCount(db *imdb.DB, table string) int {
 	return csql.Count(db, sf("SELECT COUNT(*) FROM %s", table))
 }
+
+// safeRowCount is just like rowCount, except errors are returned instead of
+// panicking (e.g., so that a broken load can still be reported).
+func safeRowCount(db *imdb.DB, table string) (n int, err error) {
+	defer csql.Safe(&err)
+	return rowCount(db, table), nil
+}
@@ -11,34 +11,64 @@ Use 'goim help {command}' for more details on {command}.
 
 A list of the main commands:
 
+    artwork   loads artwork URLs (posters, etc.) for media
+    browse    browse search results, cast and episodes interactively
+    history   review and re-run previous search queries
     load      creates/updates database with IMDb data
+    overlay   loads user provided tags for media into a namespace
     rename    renames files to match search results
+    repl      interactive shell for searching
+    saved     store and run named search queries
     search    search IMDb for movies, TV shows, episodes and actors
     size      lists size of tables and total size of database
     write     write default configuration or templates
+    xref      loads cross references to TMDb, Wikidata, etc.
 
 A list of other commands:
 
     aka-titles            show AKA titles for media
     alternate-versions    show alternate versions for media
+    analytics             copies the database to DuckDB for aggregate queries
+    atoms                 exports or imports the atom identifiers of entities
+    bench                 measures the latency of searches
+    cache                 verifies or prunes lists in the save directory
     color-info            show color info for media
+    copy                  copies every table of a database to another backend
     credits               show actor/media credits
+    cron                  refreshes the database on a schedule
+    export                writes a table or search results to a Parquet file
+    fetch                 downloads and verifies lists without loading them
     full                  show exhaustive information about an entity
+    gaps                  reports missing and unaired episodes of a TV show
     genres                show genres tags for media
+    get-prebuilt          downloads a pre-built SQLite database
     goofs                 show goofs for media
+    index                 lists, drops or creates the indices of tables
+    keys                  show every key that can be used to find an entity
     languages             show language information for media
+    letterboxd            imports the films of a Letterboxd export
+    library               compares a Plex or Jellyfin library to a search
     links                 show links (prequels, sequels, versions) of media
     literature            show literature references for media
     locations             show geography locations for media
     mpaa                  show MPAA rating for media
+    overlays              show user overlay tags for media
+    partition             partitions large tables on PostgreSQL
     plots                 show plot summaries for media
     quotes                show quotes for media
     rank                  show user rank/votes for media
     release-dates         show release dates (by region) for media
     running-times         show running times (by region) for media
+    scan                  matches the media files in a directory to IMDb
+    schema                shows or verifies the database schema
     short                 show selected information about an entity
     sound-mix             show sound mix information for media
+    stats                 counts entities and credits by role or gender
     taglines              show taglines for media
+    trakt                 imports or exports Trakt watchlists and ratings
+    trending              lists titles that gained the most votes lately
     trivia                show trivia for media
+    watch                 writes upcoming episodes of watched shows as iCalendar
+    xrefs                 show cross references (TMDb, Wikidata) for media
 */
 package main
@@ -1,15 +1,17 @@
 package main
 
 import (
-	"compress/gzip"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	path "path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/pgzip"
 )
 
 // fetcher provides an interface for retrieving IMDB data files.
@@ -35,11 +37,26 @@ func newGzipFetcher(uri string) fetcher {
 // preset FTP site ("berlin", "digital", "funet" or "uiuc"), a full FTP or
 // HTTP URL containing IMDB's list files, or a local directory containing
 // IMDB's list files.
+//
+// HTTPS is supported, along with FTPS using implicit TLS ("ftps://...") or
+// explicit TLS ("ftpes://..."). So are rsync URLs ("rsync://..."), which are
+// copied with the 'rsync' program. Lists can also be read from object storage
+// ("s3://..." or "gs://..."). (See objectStore.)
 func newFetcher(uri string) fetcher {
 	if v, ok := namedFtp[uri]; ok {
 		uri = v
 	}
-	if !strings.HasPrefix(uri, "http") && !strings.HasPrefix(uri, "ftp") {
+	if strings.HasPrefix(uri, "s3://") || strings.HasPrefix(uri, "gs://") {
+		store, err := newStore(uri)
+		if err != nil {
+			pef("%s", err)
+			return nil
+		}
+		return store
+	}
+	remote := strings.HasPrefix(uri, "http") ||
+		strings.HasPrefix(uri, "ftp") || strings.HasPrefix(uri, "rsync")
+	if !remote {
 		return dirFetcher(uri)
 	}
 
@@ -49,10 +66,12 @@ func newFetcher(uri string) fetcher {
 		return nil
 	}
 	switch loc.Scheme {
-	case "http":
+	case "http", "https":
 		return httpFetcher{loc}
-	case "ftp":
+	case "ftp", "ftps", "ftpes":
 		return ftpFetcher{loc}
+	case "rsync":
+		return rsyncFetcher{loc}
 	}
 	pef("Unsupported URL scheme '%s' in '%s'.", loc.Scheme, uri)
 	return nil
@@ -81,11 +100,15 @@ type httpFetcher struct {
 
 func (hf httpFetcher) list(name string) (io.ReadCloser, error) {
 	uri := hf.location(name)
-	resp, err := http.Get(uri)
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(uri)
 	if err != nil {
 		return nil, ef("Could not download '%s': %s", uri, err)
 	}
-	return resp.Body, nil
+	return throttled(resp.Body), nil
 }
 
 func (hf httpFetcher) location(name string) string {
@@ -113,6 +136,10 @@ func (r *ftpReadCloser) Close() error {
 	if r.cmd == nil {
 		return nil
 	}
+	if stopping() {
+		// Don't wait for the rest of the download.
+		r.cmd.Process.Kill()
+	}
 	if err := r.cmd.Wait(); err != nil {
 		logf("Could not close FTP download: %s", err)
 	}
@@ -126,19 +153,13 @@ type ftpFetcher struct {
 }
 
 func (ff ftpFetcher) list(name string) (io.ReadCloser, error) {
-	var goim string
-	var err error
-
-	if strings.Contains(os.Args[0], string(path.Separator)) {
-		goim, err = path.Abs(os.Args[0])
-		if err != nil {
-			return nil, ef("Could not find 'goim' executable: %s", err)
-		}
-	} else {
-		goim = "goim"
+	goim, err := goimPath()
+	if err != nil {
+		return nil, err
 	}
 
-	c := exec.Command(goim, "ftp", name, ff.URL.String())
+	args := append([]string{"ftp"}, tlsArgs()...)
+	c := exec.Command(goim, append(args, name, ff.URL.String())...)
 	stdout, err := c.StdoutPipe()
 	if err != nil {
 		return nil, err
@@ -150,16 +171,33 @@ func (ff ftpFetcher) list(name string) (io.ReadCloser, error) {
 	if err := c.Start(); err != nil {
 		return nil, err
 	}
-	return &ftpReadCloser{c, stdout, stderr}, nil
+	return throttled(&ftpReadCloser{c, stdout, stderr}), nil
 }
 
 func (ff ftpFetcher) location(name string) string {
 	return ftpUrl(ff.URL.String(), name)
 }
 
+// goimPath returns the path of the running goim executable, so that it can
+// run other goim commands in processes of their own.
+func goimPath() (string, error) {
+	if !strings.Contains(os.Args[0], string(path.Separator)) {
+		return "goim", nil
+	}
+	goim, err := path.Abs(os.Args[0])
+	if err != nil {
+		return "", ef("Could not find 'goim' executable: %s", err)
+	}
+	return goim, nil
+}
+
 // gzipFetcher wraps a value satisfying the fetcher interface with a gzip
 // reader. It also couples the closing of a gzip reader with closing the
 // underlying reader.
+//
+// Lists are decompressed in goroutines of their own, ahead of whatever is
+// reading them. (This is the first stage of loading a list. See
+// list_pipeline.go.)
 type gzipFetcher struct {
 	fetcher
 }
@@ -169,8 +207,9 @@ func (gf gzipFetcher) list(name string) (io.ReadCloser, error) {
 	if err != nil {
 		return nil, err
 	}
+	plain = interruptible(plain)
 
-	gzlist, err := gzip.NewReader(plain)
+	gzlist, err := pgzip.NewReaderN(plain, gzipBlockSize, pipelineDepth)
 	if err != nil {
 		return nil, ef("Could not create gzip reader for '%s': %s", name, err)
 	}
@@ -182,7 +221,7 @@ func (gf gzipFetcher) location(name string) string {
 }
 
 type gzipCloser struct {
-	*gzip.Reader
+	*pgzip.Reader
 	underlying io.ReadCloser
 }
 
@@ -206,3 +245,69 @@ func (gc *gzipCloser) Close() error {
 	}
 	return nil
 }
+
+// downloadLimit limits the combined rate of every download from HTTP and FTP
+// fetchers. It's nil when downloads aren't limited. (See setLimitRate.)
+var downloadLimit *throttle
+
+// setLimitRate limits downloads to the rate given, like "2M" for 2 megabytes
+// per second. An empty rate leaves downloads unlimited.
+func setLimitRate(rate string) error {
+	if len(rate) == 0 {
+		return nil
+	}
+	n, err := parseSize(rate)
+	if err != nil {
+		return err
+	}
+	downloadLimit = &throttle{rate: n}
+	return nil
+}
+
+// throttle limits the combined rate at which bytes are read by every reader
+// that uses it. Since lists are downloaded in parallel, this limits the
+// bandwidth used as a whole rather than per download.
+type throttle struct {
+	rate int64 // bytes per second
+
+	mu   sync.Mutex
+	next time.Time // when the bytes read so far are within the rate
+}
+
+// wait accounts for n bytes read, and sleeps until reading them is within the
+// rate.
+func (t *throttle) wait(n int) {
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	t.next = t.next.Add(time.Duration(int64(n) * int64(time.Second) / t.rate))
+	d := t.next.Sub(now)
+	t.mu.Unlock()
+	time.Sleep(d)
+}
+
+// throttled returns the reader given limited by downloadLimit, if set.
+func throttled(r io.ReadCloser) io.ReadCloser {
+	if downloadLimit == nil {
+		return r
+	}
+	return &throttledReader{r, downloadLimit}
+}
+
+type throttledReader struct {
+	io.ReadCloser
+	limit *throttle
+}
+
+func (tr *throttledReader) Read(bs []byte) (int, error) {
+	// Read at most a tenth of a second's worth at once, so that the rate
+	// stays smooth instead of coming in bursts.
+	if max := int(tr.limit.rate / 10); max > 0 && len(bs) > max {
+		bs = bs[:max]
+	}
+	n, err := tr.ReadCloser.Read(bs)
+	tr.limit.wait(n)
+	return n, err
+}
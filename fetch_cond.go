@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// listVersion identifies a version of a list file by the validators that an
+// HTTP server sends with it. When a list file is downloaded again, the
+// validators are sent back to the server, which only sends the list if it
+// changed. Lists from FTP servers don't have a version.
+type listVersion struct {
+	ETag         string
+	LastModified string
+}
+
+func (v listVersion) empty() bool {
+	return len(v.ETag) == 0 && len(v.LastModified) == 0
+}
+
+func (v listVersion) String() string {
+	if len(v.ETag) > 0 {
+		return v.ETag
+	}
+	return v.LastModified
+}
+
+// versionOf returns the version of the response given.
+func versionOf(resp *http.Response) listVersion {
+	return listVersion{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+}
+
+// currentVersion returns the current version of the list file given, which
+// is empty if it isn't known. Lists on HTTP servers are asked for their
+// version without downloading them, and lists in a directory have the
+// version they had when they were fetched. (See fetchList.)
+func currentVersion(f fetcher, name string) listVersion {
+	if gf, ok := f.(gzipFetcher); ok {
+		f = gf.fetcher
+	}
+	switch f := f.(type) {
+	case httpFetcher:
+		return f.version(name)
+	case dirFetcher:
+		return readVersion(f.location(name))
+	case savingFetcher:
+		return currentVersion(f.fetcher, name)
+	}
+	return listVersion{}
+}
+
+// version asks the server for the version of the list given with a HEAD
+// request.
+func (hf httpFetcher) version(name string) listVersion {
+	client, err := httpClient()
+	if err != nil {
+		return listVersion{}
+	}
+	resp, err := client.Head(hf.location(name))
+	if err != nil {
+		return listVersion{}
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return listVersion{}
+	}
+	return versionOf(resp)
+}
+
+// listIfChanged is just like list, except nothing is downloaded if the list
+// still has the version given. In that case, the reader returned is nil.
+// The version of the list downloaded is returned.
+func (hf httpFetcher) listIfChanged(
+	name string,
+	old listVersion,
+) (io.ReadCloser, listVersion, error) {
+	uri := hf.location(name)
+	client, err := httpClient()
+	if err != nil {
+		return nil, listVersion{}, err
+	}
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, listVersion{}, err
+	}
+	if len(old.ETag) > 0 {
+		req.Header.Set("If-None-Match", old.ETag)
+	}
+	if len(old.LastModified) > 0 {
+		req.Header.Set("If-Modified-Since", old.LastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, listVersion{}, ef("Could not download '%s': %s", uri, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		resp.Body.Close()
+		return nil, old, nil
+	case http.StatusOK:
+		return throttled(resp.Body), versionOf(resp), nil
+	}
+	resp.Body.Close()
+	return nil, listVersion{}, ef("Could not download '%s': %s",
+		uri, resp.Status)
+}
+
+// versionFile returns the file that stores the version of the list file
+// given.
+func versionFile(fpath string) string {
+	return fpath + ".version"
+}
+
+// readVersion returns the version stored for the list file given, which is
+// empty if no version was stored.
+func readVersion(fpath string) listVersion {
+	var v listVersion
+	f, err := os.Open(versionFile(fpath))
+	if err != nil {
+		return v
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ": ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "ETag":
+			v.ETag = fields[1]
+		case "Last-Modified":
+			v.LastModified = fields[1]
+		}
+	}
+	return v
+}
+
+// writeVersion stores the version of the list file given. If the version is
+// empty, any stored version is removed.
+func writeVersion(fpath string, v listVersion) error {
+	if v.empty() {
+		err := os.Remove(versionFile(fpath))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	s := sf("ETag: %s\nLast-Modified: %s\n", v.ETag, v.LastModified)
+	return ioutil.WriteFile(versionFile(fpath), []byte(s), 0644)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os/exec"
+	path "path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/ty/fun"
+	"github.com/jlaffaye/ftp"
+)
+
+// remoteFile describes a list file offered by a source. The size is negative
+// and the time is zero when they aren't known.
+type remoteFile struct {
+	name     string
+	size     int64
+	modified time.Time
+}
+
+// listingFetcher is satisfied by fetchers that can enumerate the list files
+// they offer. Only files with names ending in '.list.gz' are returned, sorted
+// by name.
+type listingFetcher interface {
+	files() ([]remoteFile, error)
+}
+
+func sortFiles(files []remoteFile) []remoteFile {
+	sort.Sort(filesByName(files))
+	return files
+}
+
+type filesByName []remoteFile
+
+func (fs filesByName) Len() int           { return len(fs) }
+func (fs filesByName) Swap(i, j int)      { fs[i], fs[j] = fs[j], fs[i] }
+func (fs filesByName) Less(i, j int) bool { return fs[i].name < fs[j].name }
+
+func isListFile(name string) bool {
+	return strings.HasSuffix(name, ".list.gz")
+}
+
+func (df dirFetcher) files() ([]remoteFile, error) {
+	infos, err := ioutil.ReadDir(string(df))
+	if err != nil {
+		return nil, err
+	}
+	var files []remoteFile
+	for _, fi := range infos {
+		if fi.IsDir() || !isListFile(fi.Name()) {
+			continue
+		}
+		files = append(files, remoteFile{fi.Name(), fi.Size(), fi.ModTime()})
+	}
+	return sortFiles(files), nil
+}
+
+func (ff ftpFetcher) files() ([]remoteFile, error) {
+	conn, loc, err := ftpConnect(ff.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Quit()
+
+	entries, err := conn.List(loc.Path)
+	if err != nil {
+		return nil, ef("Could not list '%s' on '%s': %s",
+			loc.Path, loc.Host, err)
+	}
+	var files []remoteFile
+	for _, e := range entries {
+		if e.Type != ftp.EntryTypeFile || !isListFile(e.Name) {
+			continue
+		}
+		files = append(files, remoteFile{e.Name, int64(e.Size), e.Time})
+	}
+	return sortFiles(files), nil
+}
+
+// hrefListFile matches links to list files in an HTML directory index.
+var hrefListFile = regexp.MustCompile(`(?i)href="([^"?#]+\.list\.gz)"`)
+
+// files reads the directory index that the server sends for the URL, and
+// asks for the size and date of each list file linked from it with a HEAD
+// request.
+func (hf httpFetcher) files() ([]remoteFile, error) {
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	uri := strings.TrimSuffix(hf.String(), "/") + "/"
+	resp, err := client.Get(uri)
+	if err != nil {
+		return nil, ef("Could not download '%s': %s", uri, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ef("Could not download '%s': %s", uri, resp.Status)
+	}
+	index, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ef("Could not download '%s': %s", uri, err)
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range hrefListFile.FindAllSubmatch(index, -1) {
+		href, err := url.QueryUnescape(string(m[1]))
+		if err != nil {
+			continue
+		}
+		name := path.Base(href)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	head := func(name string) remoteFile {
+		f := remoteFile{name: name, size: -1}
+		resp, err := client.Head(uri + name)
+		if err != nil {
+			return f
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return f
+		}
+		f.size = resp.ContentLength
+		modified := resp.Header.Get("Last-Modified")
+		if t, err := http.ParseTime(modified); err == nil {
+			f.modified = t
+		}
+		return f
+	}
+	files := fun.ParMapN(head, names, maxFtpConns).([]remoteFile)
+	return sortFiles(files), nil
+}
+
+// files parses the output of 'rsync --list-only', which has a line like
+//
+//	-rw-r--r--     12,345,678 2014/06/13 10:20:30 actors.list.gz
+//
+// for each file.
+func (rf rsyncFetcher) files() ([]remoteFile, error) {
+	uri := strings.TrimSuffix(rf.URL.String(), "/") + "/"
+	var stdout, stderr bytes.Buffer
+	c := exec.Command("rsync", "--list-only", uri)
+	c.Stdout, c.Stderr = &stdout, &stderr
+	if err := c.Run(); err != nil {
+		return nil, ef("Could not list '%s' with rsync: %s\n\nstderr:\n\n%s",
+			uri, err, stderr.String())
+	}
+
+	var files []remoteFile
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+		name := strings.Join(fields[4:], " ")
+		if !isListFile(name) {
+			continue
+		}
+		f := remoteFile{name: name, size: -1}
+		size := strings.Replace(fields[1], ",", "", -1)
+		if n, err := strconv.ParseInt(size, 10, 64); err == nil {
+			f.size = n
+		}
+		stamp := fields[2] + " " + fields[3]
+		if t, err := time.Parse("2006/01/02 15:04:05", stamp); err == nil {
+			f.modified = t
+		}
+		files = append(files, f)
+	}
+	return sortFiles(files), nil
+}
+
+// missingFiles returns the names of the list files that goim can load but
+// aren't in the files given.
+func missingFiles(files []remoteFile) []string {
+	have := make(map[string]bool, len(files))
+	for _, f := range files {
+		have[f.name] = true
+	}
+	var missing []string
+	for _, name := range listFiles(loadLists) {
+		if !have[name+".list.gz"] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHttpFiles(t *testing.T) {
+	index := `<html><body>
+<a href="../">Parent</a>
+<a href="movies.list.gz">movies.list.gz</a>
+<a href="/pub/actors.list.gz">actors.list.gz</a>
+<a href="README">README</a>
+<a href="movies.list.gz">again</a>
+</body></html>`
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/") {
+				fmt.Fprint(w, index)
+				return
+			}
+			w.Header().Set("Last-Modified", "Fri, 13 Jun 2014 10:20:30 GMT")
+			w.Header().Set("Content-Length", "1234")
+		}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL + "/pub")
+	files, err := httpFetcher{u}.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files but got %v", files)
+	}
+	if files[0].name != "actors.list.gz" || files[1].name != "movies.list.gz" {
+		t.Fatalf("expected actors and movies but got %v", files)
+	}
+	for _, f := range files {
+		if f.size != 1234 || f.modified.Year() != 2014 {
+			t.Fatalf("bad size or date for %s: %d, %s",
+				f.name, f.size, f.modified)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	path "path/filepath"
+	"strings"
+)
+
+// rsyncFetcher satisfies the fetcher interface by reading from an rsync URL.
+// Lists are copied with the 'rsync' program, which must be installed.
+//
+// When fetching, lists are copied straight into the save directory, so that
+// rsync only transfers the parts of a list that changed since it was saved.
+type rsyncFetcher struct {
+	*url.URL
+}
+
+func (rf rsyncFetcher) list(name string) (io.ReadCloser, error) {
+	dir, err := ioutil.TempDir("", "goim-rsync")
+	if err != nil {
+		return nil, ef("Could not create directory for '%s': %s", name, err)
+	}
+	fpath := path.Join(dir, sf("%s.list.gz", name))
+	if err := rf.sync(name, fpath); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &rsyncReadCloser{f, dir}, nil
+}
+
+func (rf rsyncFetcher) location(name string) string {
+	return sf("%s/%s.list.gz", strings.TrimSuffix(rf.URL.String(), "/"), name)
+}
+
+// sync copies the list given to dest with rsync. If dest already exists,
+// only the differences are transferred. rsync writes to a temporary file and
+// renames it, so dest is never left with part of a list.
+func (rf rsyncFetcher) sync(name, dest string) error {
+	args := []string{"--quiet", "--times"}
+	if downloadLimit != nil {
+		kbps := downloadLimit.rate / 1024
+		if kbps < 1 {
+			kbps = 1
+		}
+		args = append(args, sf("--bwlimit=%d", kbps))
+	}
+	args = append(args, rf.location(name), dest)
+
+	var stderr bytes.Buffer
+	c := exec.Command("rsync", args...)
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		return ef("Could not download '%s' with rsync: %s\n\nstderr:\n\n%s",
+			rf.location(name), err, stderr.String())
+	}
+	return nil
+}
+
+// rsyncReadCloser reads a list copied into a temporary directory, and removes
+// the directory when it's closed.
+type rsyncReadCloser struct {
+	*os.File
+	dir string
+}
+
+func (r *rsyncReadCloser) Close() error {
+	err := r.File.Close()
+	os.RemoveAll(r.dir)
+	return err
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// objectStore satisfies the listStore interface with a bucket in object
+// storage that speaks the S3 API. Both Amazon S3 ("s3://bucket/prefix") and
+// Google Cloud Storage ("gs://bucket/prefix", through its XML API with HMAC
+// keys) are supported. Requests are signed with AWS Signature Version 4.
+//
+// Credentials are read from the environment. For S3, they're
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and (optionally)
+// AWS_SESSION_TOKEN, and the region is AWS_REGION (or us-east-1). Other
+// S3 compatible services can be used by setting AWS_ENDPOINT_URL. For GCS,
+// they're GCS_ACCESS_KEY_ID and GCS_SECRET_ACCESS_KEY.
+type objectStore struct {
+	scheme   string
+	bucket   string
+	prefix   string // without leading or trailing slashes
+	endpoint string // like "https://s3.us-east-1.amazonaws.com"
+	region   string
+
+	keyId, secret, token string
+}
+
+func newObjectStore(loc *url.URL) (*objectStore, error) {
+	s := &objectStore{
+		scheme: loc.Scheme,
+		bucket: loc.Host,
+		prefix: strings.Trim(loc.Path, "/"),
+	}
+	if len(s.bucket) == 0 {
+		return nil, ef("No bucket in '%s'.", loc)
+	}
+	switch loc.Scheme {
+	case "s3":
+		s.region = os.Getenv("AWS_REGION")
+		if len(s.region) == 0 {
+			s.region = "us-east-1"
+		}
+		s.endpoint = os.Getenv("AWS_ENDPOINT_URL")
+		if len(s.endpoint) == 0 {
+			s.endpoint = sf("https://s3.%s.amazonaws.com", s.region)
+		}
+		s.keyId = os.Getenv("AWS_ACCESS_KEY_ID")
+		s.secret = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		s.token = os.Getenv("AWS_SESSION_TOKEN")
+	case "gs":
+		s.region = "auto"
+		s.endpoint = "https://storage.googleapis.com"
+		s.keyId = os.Getenv("GCS_ACCESS_KEY_ID")
+		s.secret = os.Getenv("GCS_SECRET_ACCESS_KEY")
+	default:
+		return nil, ef("Unsupported object storage '%s'.", loc.Scheme)
+	}
+	if len(s.keyId) == 0 || len(s.secret) == 0 {
+		return nil, ef("No credentials for '%s'. See 'goim help fetch'.", loc)
+	}
+	s.endpoint = strings.TrimSuffix(s.endpoint, "/")
+	return s, nil
+}
+
+// key returns the key of the object with the file name given.
+func (s *objectStore) key(name string) string {
+	if len(s.prefix) == 0 {
+		return name
+	}
+	return s.prefix + "/" + name
+}
+
+func (s *objectStore) list(name string) (io.ReadCloser, error) {
+	resp, err := s.do("GET", s.key(name+".list.gz"), nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, ef("Could not download '%s': %s",
+			s.location(name), resp.Status)
+	}
+	return throttled(resp.Body), nil
+}
+
+func (s *objectStore) location(name string) string {
+	return sf("%s://%s/%s", s.scheme, s.bucket, s.key(name+".list.gz"))
+}
+
+func (s *objectStore) put(name string, r io.Reader, size int64) error {
+	resp, err := s.do("PUT", s.key(name), nil, r, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ef("Could not upload '%s': %s", s.key(name), resp.Status)
+	}
+	return nil
+}
+
+func (s *objectStore) remove(name string) error {
+	resp, err := s.do("DELETE", s.key(name), nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return ef("Could not delete '%s': %s", s.key(name), resp.Status)
+}
+
+// listBucketResult is the part of the response to a ListObjectsV2 request
+// that is used.
+type listBucketResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *objectStore) files() ([]remoteFile, error) {
+	prefix := ""
+	if len(s.prefix) > 0 {
+		prefix = s.prefix + "/"
+	}
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", prefix)
+	query.Set("delimiter", "/")
+
+	var files []remoteFile
+	for {
+		resp, err := s.do("GET", "", query, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, ef("Could not list '%s://%s/%s': %s",
+				s.scheme, s.bucket, prefix, resp.Status)
+		}
+		if err != nil {
+			return nil, ef("Could not read list of '%s://%s/%s': %s",
+				s.scheme, s.bucket, prefix, err)
+		}
+		for _, obj := range result.Contents {
+			name := strings.TrimPrefix(obj.Key, prefix)
+			if isListFile(name) {
+				files = append(files,
+					remoteFile{name, obj.Size, obj.LastModified})
+			}
+		}
+		if !result.IsTruncated || len(result.NextContinuationToken) == 0 {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	return sortFiles(files), nil
+}
+
+// do sends a signed request for the object with the key given. If the key is
+// empty, the request is for the bucket.
+func (s *objectStore) do(
+	method, key string,
+	query url.Values,
+	body io.Reader,
+	size int64,
+) (*http.Response, error) {
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	uri := sf("%s/%s", s.endpoint, s.bucket)
+	if len(key) > 0 {
+		uri += "/" + key
+	}
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	req.URL.RawQuery = canonicalQuery(query)
+	s.sign(req, time.Now())
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, ef("Could not reach '%s': %s", s.endpoint, err)
+	}
+	return resp, nil
+}
+
+// sign adds an AWS Signature Version 4 authorization header to the request
+// given. The payload isn't signed, so that large lists can be uploaded
+// without reading them twice.
+func (s *objectStore) sign(req *http.Request, now time.Time) {
+	stamp := now.UTC().Format("20060102T150405Z")
+	day := stamp[:8]
+	req.Header.Set("x-amz-date", stamp)
+	req.Header.Set("x-amz-content-sha256", "UNSIGNED-PAYLOAD")
+	if len(s.token) > 0 {
+		req.Header.Set("x-amz-security-token", s.token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonHeaders []string
+	for _, name := range names {
+		canonHeaders = append(canonHeaders, name+":"+headers[name]+"\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		strings.Join(canonHeaders, ""),
+		signed,
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	scope := sf("%s/%s/s3/aws4_request", day, s.region)
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", stamp, scope, sha256Hex(canonical),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secret), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", sf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.keyId, scope, signed, signature))
+}
+
+// canonicalQuery encodes the query given as Signature Version 4 requires,
+// which sorts it by key and encodes spaces as %20.
+func canonicalQuery(query url.Values) string {
+	return strings.Replace(query.Encode(), "+", "%20", -1)
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an HTTP handler that stores objects in memory, just enough like
+// S3 to test objectStore.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := r.URL.Path
+	switch {
+	case r.Method == "GET" && r.URL.Query().Get("list-type") == "2":
+		prefix := "/bucket/" + r.URL.Query().Get("prefix")
+		fmt.Fprint(w, "<ListBucketResult>")
+		for k, v := range f.objects {
+			if strings.HasPrefix(k, prefix) {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size>"+
+					"<LastModified>2014-06-13T10:20:30.000Z</LastModified>"+
+					"</Contents>", strings.TrimPrefix(k, "/bucket/"), len(v))
+			}
+		}
+		fmt.Fprint(w, "</ListBucketResult>")
+	case r.Method == "GET":
+		v, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, v)
+	case r.Method == "PUT":
+		bs, _ := ioutil.ReadAll(r.Body)
+		f.objects[key] = string(bs)
+	case r.Method == "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestObjectStore(t *testing.T) {
+	srv := httptest.NewServer(&fakeS3{objects: make(map[string]string)})
+	defer srv.Close()
+
+	s := &objectStore{
+		scheme:   "s3",
+		bucket:   "bucket",
+		prefix:   "goim",
+		endpoint: srv.URL,
+		region:   "us-east-1",
+		keyId:    "key",
+		secret:   "secret",
+	}
+	names := []string{"movies.list.gz", "plot.list.gz", "MANIFEST"}
+	for _, name := range names {
+		err := s.put(name, strings.NewReader(name), int64(len(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.remove("plot.list.gz"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := s.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].name != "movies.list.gz" {
+		t.Fatalf("expected only movies.list.gz but got %v", files)
+	}
+	if files[0].size != int64(len("movies.list.gz")) {
+		t.Fatalf("expected size %d but got %d", len("movies.list.gz"),
+			files[0].size)
+	}
+
+	list, err := s.list("movies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+	bs, err := ioutil.ReadAll(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != "movies.list.gz" {
+		t.Fatalf("expected 'movies.list.gz' but got '%s'", bs)
+	}
+	if _, err := s.list("plot"); err == nil {
+		t.Fatalf("expected an error for a removed list")
+	}
+}
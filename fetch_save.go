@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"os"
+	path "path/filepath"
+)
+
+// savingFetcher satisfies the fetcher interface by saving each list to a
+// directory before reading it from there. Lists are streamed to disk rather
+// than held in memory, so lists of any size can be saved while loading them.
+// (See 'goim load -save'.)
+//
+// Lists are saved with fetchList, so they're verified and added to the
+// manifest of the directory just like lists saved with 'goim fetch'. Lists
+// from HTTP servers that are already saved aren't downloaded again unless
+// they changed.
+type savingFetcher struct {
+	fetcher
+	dir string
+}
+
+func (sv savingFetcher) list(name string) (io.ReadCloser, error) {
+	saveto := sv.saved(name)
+	var old listVersion
+	if verifyList(saveto) == nil {
+		old = readVersion(saveto)
+	}
+	if err := fetchList(sv.fetcher, name, saveto, old); err != nil {
+		return nil, err
+	}
+	return os.Open(saveto)
+}
+
+// saved returns the file that the list given is saved to.
+func (sv savingFetcher) saved(name string) string {
+	return path.Join(sv.dir, name+".list.gz")
+}
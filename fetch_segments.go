@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// minSegmentSize is the smallest segment that a list is split into when it's
+// downloaded in segments. Lists smaller than two segments are downloaded in
+// one piece, since the extra requests wouldn't save any time.
+const minSegmentSize = 8 << 20
+
+var flagSegments = 4
+
+// ranges asks the server whether the list given can be downloaded in
+// segments with a HEAD request. If it can, its size and version are returned.
+func (hf httpFetcher) ranges(name string) (int64, listVersion, bool) {
+	client, err := httpClient()
+	if err != nil {
+		return 0, listVersion{}, false
+	}
+	resp, err := client.Head(hf.location(name))
+	if err != nil {
+		return 0, listVersion{}, false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, listVersion{}, false
+	}
+	accept := strings.ToLower(resp.Header.Get("Accept-Ranges"))
+	if !strings.Contains(accept, "bytes") || resp.ContentLength <= 0 {
+		return 0, listVersion{}, false
+	}
+	return resp.ContentLength, versionOf(resp), true
+}
+
+// segmented downloads the list given, which has the size and version given,
+// in flagSegments segments at the same time. Each segment is written to w at
+// its own offset, so the list is whole once every segment is done.
+//
+// If the list changes on the server during the download, an error is
+// returned rather than a list made of segments from different versions.
+func (hf httpFetcher) segmented(
+	name string,
+	size int64,
+	version listVersion,
+	w io.WriterAt,
+) error {
+	client, err := httpClient()
+	if err != nil {
+		return err
+	}
+	segSize := (size + int64(flagSegments) - 1) / int64(flagSegments)
+	if segSize < minSegmentSize {
+		segSize = minSegmentSize
+	}
+
+	errs := make(chan error)
+	count := 0
+	for start := int64(0); start < size; start += segSize {
+		end := start + segSize
+		if end > size {
+			end = size
+		}
+		count++
+		go func(start, end int64) {
+			errs <- hf.segment(client, name, start, end, version, w)
+		}(start, end)
+	}
+	var first error
+	for i := 0; i < count; i++ {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// segment downloads the bytes in [start, end) of the list given and writes
+// them to w at the same offset.
+func (hf httpFetcher) segment(
+	client *http.Client,
+	name string,
+	start, end int64,
+	version listVersion,
+	w io.WriterAt,
+) error {
+	uri := hf.location(name)
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", sf("bytes=%d-%d", start, end-1))
+	if len(version.ETag) > 0 {
+		req.Header.Set("If-Range", version.ETag)
+	} else if len(version.LastModified) > 0 {
+		req.Header.Set("If-Range", version.LastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ef("Could not download '%s': %s", uri, err)
+	}
+	body := interruptible(throttled(resp.Body))
+	defer body.Close()
+
+	// Servers send the whole list instead of a segment when it changed since
+	// its version was asked for.
+	if resp.StatusCode != http.StatusPartialContent {
+		return ef("Could not download part of '%s': %s (it may have changed "+
+			"during the download)", uri, resp.Status)
+	}
+	n, err := io.Copy(&offsetWriter{w, start}, io.LimitReader(body, end-start))
+	if err != nil {
+		return ef("Could not download '%s': %s", uri, err)
+	}
+	if n != end-start {
+		return ef("Could not download '%s': segment at %d is short by %d "+
+			"bytes", uri, start, end-start-n)
+	}
+	return nil
+}
+
+// offsetWriter writes sequentially to a WriterAt, starting at an offset.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (ow *offsetWriter) Write(bs []byte) (int, error) {
+	n, err := ow.w.WriteAt(bs, ow.off)
+	ow.off += int64(n)
+	return n, err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	path "path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchSegmented(t *testing.T) {
+	// Random bytes don't compress, so the list is big enough to be split.
+	raw := make([]byte, 3*minSegmentSize)
+	rand.New(rand.NewSource(1)).Read(raw)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(raw)
+	w.Close()
+	list := gz.Bytes()
+
+	var ranged int32
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.Header.Get("Range"), "bytes=") {
+				atomic.AddInt32(&ranged, 1)
+			}
+			w.Header().Set("ETag", `"v1"`)
+			http.ServeContent(w, r, "plot.list.gz", time.Time{},
+				bytes.NewReader(list))
+		}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "goim-fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	u, _ := url.Parse(srv.URL)
+	saveto := path.Join(dir, "plot.list.gz")
+	err = fetchList(httpFetcher{u}, "plot", saveto, listVersion{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(saveto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, list) {
+		t.Fatalf("saved list differs from the list served")
+	}
+	if ranged < 2 {
+		t.Fatalf("expected the list in several segments but got %d", ranged)
+	}
+	if v := readVersion(saveto); v.ETag != `"v1"` {
+		t.Fatalf("expected version '\"v1\"' but got '%s'", v)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	path "path/filepath"
+	"strings"
+)
+
+// listStore is a place where saved list files are kept, like a directory or
+// a bucket in object storage. A list store is also a fetcher, so lists can be
+// loaded straight from it.
+//
+// Unlike list, the put and remove methods take file names (like
+// "movies.list.gz" or "MANIFEST") rather than list names, since the versions
+// and manifest of lists are stored along with them.
+type listStore interface {
+	fetcher
+	listingFetcher
+
+	// put stores size bytes read from r with the file name given, replacing
+	// any file with the same name. The file is replaced only once all of it
+	// is stored.
+	put(name string, r io.Reader, size int64) error
+
+	// remove deletes the file with the name given. It isn't an error if the
+	// file doesn't exist.
+	remove(name string) error
+}
+
+// newStore returns the list store at the location given, which is either a
+// local directory or a bucket in object storage ("s3://bucket/prefix" or
+// "gs://bucket/prefix").
+func newStore(uri string) (listStore, error) {
+	if !strings.HasPrefix(uri, "s3://") && !strings.HasPrefix(uri, "gs://") {
+		return dirFetcher(uri), nil
+	}
+	loc, err := url.Parse(uri)
+	if err != nil {
+		return nil, ef("Could not parse URL '%s': %s", uri, err)
+	}
+	return newObjectStore(loc)
+}
+
+// publishStore is the store that every list saved by fetchList is copied to,
+// along with its version and the manifest of the save directory. It's nil
+// when lists are only kept in the save directory. (See 'list_store' in the
+// configuration file.)
+var publishStore listStore
+
+// publishList copies the list file given, along with its version, to
+// publishStore. The manifest of its directory is copied last.
+func publishList(fpath string) error {
+	if publishStore == nil {
+		return nil
+	}
+	if df, ok := publishStore.(dirFetcher); ok {
+		if sameDir(string(df), path.Dir(fpath)) {
+			return nil
+		}
+	}
+
+	logf("Copying %s to the list store...", path.Base(fpath))
+	if err := putFile(publishStore, fpath); err != nil {
+		return err
+	}
+	vfile := versionFile(fpath)
+	if _, err := os.Stat(vfile); err == nil {
+		if err := putFile(publishStore, vfile); err != nil {
+			return err
+		}
+	} else if err := publishStore.remove(path.Base(vfile)); err != nil {
+		return err
+	}
+
+	// The manifest is copied while no other manifest can change, so the last
+	// copy always has every list.
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	return putFile(publishStore, path.Join(path.Dir(fpath), manifestName))
+}
+
+// putFile stores the local file given in the store given under its base
+// name.
+func putFile(store listStore, fpath string) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := store.put(path.Base(fpath), f, fi.Size()); err != nil {
+		return ef("Could not store '%s': %s", path.Base(fpath), err)
+	}
+	return nil
+}
+
+// sameDir returns true if the directories given are the same directory.
+func sameDir(dir1, dir2 string) bool {
+	fi1, err := os.Stat(dir1)
+	if err != nil {
+		return false
+	}
+	fi2, err := os.Stat(dir2)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fi1, fi2)
+}
+
+func (df dirFetcher) put(name string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(string(df), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(string(df), name+".part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails harmlessly after the rename
+	if _, err := io.CopyN(tmp, r, size); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path.Join(string(df), name))
+}
+
+func (df dirFetcher) remove(name string) error {
+	err := os.Remove(path.Join(string(df), name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+)
+
+var (
+	flagCAFile   = ""
+	flagInsecure = false
+)
+
+// addTLSFlags adds the flags that configure TLS for HTTPS and FTPS downloads
+// to the command given.
+func addTLSFlags(c *command) {
+	c.flags.StringVar(&flagCAFile, "ca-file", flagCAFile,
+		"A file of PEM encoded certificates that are trusted when\n"+
+			"downloading over HTTPS or FTPS, in addition to the system's.")
+	c.flags.BoolVar(&flagInsecure, "insecure", flagInsecure,
+		"When set, the certificates of HTTPS and FTPS servers aren't\n"+
+			"verified. This makes downloads vulnerable to tampering.")
+}
+
+// tlsArgs returns the TLS flags that are set, so that they can be passed on
+// to 'goim ftp'.
+func tlsArgs() []string {
+	var args []string
+	if len(flagCAFile) > 0 {
+		args = append(args, "-ca-file", flagCAFile)
+	}
+	if flagInsecure {
+		args = append(args, "-insecure")
+	}
+	return args
+}
+
+// tlsConfig returns the TLS configuration for the server name given
+// according to the TLS flags.
+func tlsConfig(serverName string) (*tls.Config, error) {
+	conf := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: flagInsecure,
+	}
+	if len(flagCAFile) > 0 {
+		pem, err := ioutil.ReadFile(flagCAFile)
+		if err != nil {
+			return nil, ef("Could not read CA file: %s", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ef("No certificates found in CA file '%s'.",
+				flagCAFile)
+		}
+		conf.RootCAs = pool
+	}
+	return conf, nil
+}
+
+// httpClient returns the client used to download lists over HTTP and HTTPS.
+func httpClient() (*http.Client, error) {
+	if len(flagCAFile) == 0 && !flagInsecure {
+		return http.DefaultClient, nil
+	}
+	conf, err := tlsConfig("")
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: conf,
+		},
+	}, nil
+}
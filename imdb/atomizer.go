@@ -0,0 +1,265 @@
+package imdb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/csql"
+)
+
+// RowInserter adds rows to a table, possibly in batches. Calling Exec with
+// no values inserts any rows that are still buffered. (An *Inserter is a
+// RowInserter.)
+type RowInserter interface {
+	Exec(values ...interface{}) error
+}
+
+// Atomizer maps the keys of entities (exactly as they appear in IMDb's
+// lists, e.g., 'The Matrix (1999)') to their atom identifiers, and creates
+// atoms for keys that don't have one yet. Only md5 hashes of keys are stored,
+// in the 'atom' table.
+//
+// A read-only Atomizer may be used by many goroutines at once, but one that
+// creates atoms may NOT.
+type Atomizer struct {
+	atoms  map[[md5.Size]byte]Atom
+	nextId Atom
+	ins    RowInserter
+
+	// ids is the set of atom identifiers in use. It's only built once an
+	// atom is assigned explicitly, since most atomizers never need it.
+	ids map[Atom]bool
+}
+
+// NewAtomizer returns an Atomizer with every atom in the database. New atoms
+// are added with the inserter given, which must insert rows with the columns
+// 'id' and 'hash' into the 'atom' table. If ins is nil, then the Atomizer is
+// read-only (and adding atoms to it will panic).
+//
+// The caller is responsible for committing the transaction of the inserter,
+// which should be done right after calling Close.
+//
+// Note that every atom is read into memory, so this is costly.
+func NewAtomizer(db csql.Queryer, ins RowInserter) (*Atomizer, error) {
+	return NewAtomizerSize(db, ins, 0)
+}
+
+// NewAtomizerSize is just like NewAtomizer, except room is made for the
+// number of atoms given before any are read.
+func NewAtomizerSize(
+	db csql.Queryer,
+	ins RowInserter,
+	size int,
+) (az *Atomizer, err error) {
+	defer csql.Safe(&err)
+
+	az = &Atomizer{atoms: make(map[[md5.Size]byte]Atom, size), ins: ins}
+	rs := csql.Query(db, "SELECT id, hash FROM atom ORDER BY id ASC")
+	csql.ForRow(rs, az.readRow)
+	az.nextId++
+	return
+}
+
+// readRow scans a row from the atom table into the atomizer.
+func (az *Atomizer) readRow(scanner csql.RowScanner) {
+	var id Atom
+	var rawBytes sql.RawBytes
+	csql.Scan(scanner, &id, &rawBytes)
+
+	var hash [md5.Size]byte
+	copy(hash[:], rawBytes)
+	az.atoms[hash] = id
+	az.nextId = id
+}
+
+// HashKey returns the md5 hash of the key given, as it's stored in the atom
+// table. Surrounding whitespace is ignored.
+func HashKey(key []byte) [md5.Size]byte {
+	return md5.Sum(bytes.TrimSpace(key))
+}
+
+// ParseAtomKey returns the hash of the key of an atom, which is either an
+// IMDb key or a hash of one written as 'md5:' followed by 32 hexadecimal
+// digits.
+func ParseAtomKey(key string) ([md5.Size]byte, error) {
+	var hash [md5.Size]byte
+	if !strings.HasPrefix(key, "md5:") {
+		return HashKey([]byte(key)), nil
+	}
+	digits := strings.TrimPrefix(key, "md5:")
+	bs, err := hex.DecodeString(digits)
+	if err != nil || len(bs) != md5.Size {
+		return hash, ef("'%s' is not an MD5 hash.", digits)
+	}
+	copy(hash[:], bs)
+	return hash, nil
+}
+
+// Atom returns the atom of the key given, along with whether it already
+// existed. If it didn't, a new atom is created and returned (along with an
+// error if it couldn't be added).
+func (az *Atomizer) Atom(key []byte) (Atom, bool, error) {
+	hash := HashKey(key)
+	if a, ok := az.atoms[hash]; ok {
+		return a, true, nil
+	}
+	a, err := az.add(hash)
+	return a, false, err
+}
+
+// AtomOnlyIfExist returns the atom of the key given only if the key already
+// has one. Otherwise, the zero atom and false are returned.
+func (az *Atomizer) AtomOnlyIfExist(key []byte) (Atom, bool) {
+	a, ok := az.atoms[HashKey(key)]
+	return a, ok
+}
+
+// add always adds the given hash with a fresh and unique atom identifier.
+func (az *Atomizer) add(hash [md5.Size]byte) (Atom, error) {
+	if az.ins == nil {
+		panic("cannot add atoms when opened read-only")
+	}
+	a := az.nextId
+	if err := az.ins.Exec(a, hash[:]); err != nil {
+		return 0, err
+	}
+	az.atoms[hash] = a
+	if az.ids != nil {
+		az.ids[a] = true
+	}
+	az.nextId++
+	return a, nil
+}
+
+// AssignExplicit makes the key given have the atom given instead of a fresh
+// one, so that entities keep their identifiers when they're moved from
+// another database. It returns true if the key already had that atom. It's
+// an error if the key already has another atom, or if the atom is used by
+// another key. It panics if the Atomizer is read-only.
+//
+// Fresh atoms are always greater than every atom assigned explicitly, so
+// atoms should be assigned before any entities are added.
+func (az *Atomizer) AssignExplicit(key []byte, a Atom) (bool, error) {
+	return az.AssignHash(HashKey(key), a)
+}
+
+// AssignHash is just like AssignExplicit, except it's given the hash of a key
+// instead of the key. (See HashKey.)
+func (az *Atomizer) AssignHash(hash [md5.Size]byte, a Atom) (bool, error) {
+	if az.ins == nil {
+		panic("cannot add atoms when opened read-only")
+	}
+	if err := az.conflict(hash, a); err != nil {
+		return false, err
+	}
+	if az.atoms[hash] == a {
+		return true, nil
+	}
+	if err := az.ins.Exec(a, hash[:]); err != nil {
+		return false, err
+	}
+	az.atoms[hash] = a
+	az.ids[a] = true
+	if a >= az.nextId {
+		az.nextId = a + 1
+	}
+	return false, nil
+}
+
+// conflict returns an error if the atom given can't be assigned to the key
+// with the hash given: when the key already has another atom, or the atom is
+// used by another key.
+func (az *Atomizer) conflict(hash [md5.Size]byte, a Atom) error {
+	if a <= 0 {
+		return ef("Atom identifiers must be positive, but got %d.", a)
+	}
+	if old, ok := az.atoms[hash]; ok {
+		if old == a {
+			return nil
+		}
+		return ef("The key already has atom %d.", old)
+	}
+	if az.ids == nil {
+		az.ids = make(map[Atom]bool, len(az.atoms))
+		for _, id := range az.atoms {
+			az.ids[id] = true
+		}
+	}
+	if az.ids[a] {
+		return ef("Atom %d is already used by another key.", a)
+	}
+	return nil
+}
+
+// Seed assigns the atoms in a mapping file to their keys (see AssignHash).
+// The file is CSV, and each row has the form 'atom,key', where the key is
+// given as it's accepted by ParseAtomKey.
+//
+// Rows whose atom can't be assigned, because the key already has another
+// atom or the atom is used by another key, are passed to skip (with their
+// row number, starting at 1) and skipped. skip may be nil. Any other problem
+// stops seeding, and since the rows before it were already assigned, the
+// transaction of the inserter should then be rolled back. The number of
+// atoms added and the number that were already assigned are returned.
+func (az *Atomizer) Seed(
+	r io.Reader,
+	skip func(row int, err error),
+) (added, existed int, err error) {
+	csvr := csv.NewReader(r)
+	csvr.FieldsPerRecord = -1
+	csvr.TrimLeadingSpace = true
+	for i := 1; ; i++ {
+		row, err := csvr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return added, existed, ef("Could not read CSV data: %s", err)
+		}
+		if len(row) != 2 {
+			return added, existed, ef("Row %d has %d fields, but atoms "+
+				"must have 2 fields: atom,key", i, len(row))
+		}
+		id, err := strconv.ParseInt(strings.TrimSpace(row[0]), 10, 32)
+		if err != nil {
+			return added, existed, ef("Row %d has an invalid atom '%s'.",
+				i, row[0])
+		}
+		hash, err := ParseAtomKey(row[1])
+		if err != nil {
+			return added, existed, ef("Row %d: %s", i, err)
+		}
+		if err := az.conflict(hash, Atom(id)); err != nil {
+			if skip != nil {
+				skip(i, err)
+			}
+			continue
+		}
+		had, err := az.AssignHash(hash, Atom(id))
+		if err != nil {
+			return added, existed, err
+		}
+		if had {
+			existed++
+		} else {
+			added++
+		}
+	}
+	return added, existed, nil
+}
+
+// Close inserts any new atoms still buffered by the inserter. It does NOT
+// commit the transaction. If the Atomizer is read-only, it does nothing.
+func (az *Atomizer) Close() error {
+	if az.ins != nil {
+		ins := az.ins
+		az.ins = nil
+		return ins.Exec()
+	}
+	return nil
+}
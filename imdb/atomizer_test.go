@@ -0,0 +1,87 @@
+package imdb
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseAtomKey(t *testing.T) {
+	key := "The Matrix (1999)"
+	want := HashKey([]byte(key))
+	for _, s := range []string{
+		key,
+		" " + key + " ",
+		"md5:" + hex.EncodeToString(want[:]),
+	} {
+		got, err := ParseAtomKey(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+		} else if got != want {
+			t.Errorf("%q: got %x, want %x", s, got, want)
+		}
+	}
+	for _, s := range []string{"md5:xyz", "md5:0123"} {
+		if _, err := ParseAtomKey(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+// atomRows is a RowInserter that keeps the atoms inserted.
+type atomRows []Atom
+
+func (rows *atomRows) Exec(values ...interface{}) error {
+	if len(values) > 0 {
+		*rows = append(*rows, values[0].(Atom))
+	}
+	return nil
+}
+
+func TestAtomizerSeed(t *testing.T) {
+	var rows atomRows
+	az, err := NewAtomizer(openFake(t, "sqlite3"), &rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brazil := HashKey([]byte("Brazil (1985)"))
+	mapping := "1,The Matrix (1999)\n" +
+		"2,md5:" + hex.EncodeToString(brazil[:]) + "\n" +
+		"1,The Matrix (1999)\n" + // already assigned
+		"3,The Matrix (1999)\n" + // the key has another atom
+		"2,Alien (1979)\n" // the atom is used by another key
+	var skipped []int
+	added, existed, err := az.Seed(strings.NewReader(mapping),
+		func(row int, err error) { skipped = append(skipped, row) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 2 || existed != 1 {
+		t.Errorf("added %d and found %d atoms, want 2 and 1", added, existed)
+	}
+	if len(skipped) != 2 || skipped[0] != 4 || skipped[1] != 5 {
+		t.Errorf("skipped rows %v, want [4 5]", skipped)
+	}
+
+	if had, err := az.AssignExplicit([]byte("Alien (1979)"), 10); err != nil {
+		t.Fatal(err)
+	} else if had {
+		t.Errorf("Alien (1979) already had atom 10")
+	}
+	if a, ok := az.AtomOnlyIfExist([]byte("Brazil (1985)")); !ok || a != 2 {
+		t.Errorf("Brazil (1985) has atom %d (%v), want 2", a, ok)
+	}
+	if a, had, err := az.Atom([]byte("Heat (1995)")); err != nil {
+		t.Fatal(err)
+	} else if had || a != 11 {
+		t.Errorf("Heat (1995) got atom %d (%v), want a new atom 11", a, had)
+	}
+	if want := "1 2 10 11"; fmt.Sprintf("%v", []Atom(rows)) != "["+want+"]" {
+		t.Errorf("inserted atoms %v, want [%s]", rows, want)
+	}
+
+	if _, _, err := az.Seed(strings.NewReader("x,Heat (1995)\n"), nil); err == nil {
+		t.Errorf("expected an error for an invalid atom")
+	}
+}
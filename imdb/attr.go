@@ -1,6 +1,7 @@
 package imdb
 
 import (
+	"database/sql"
 	"reflect"
 	"sort"
 	"strings"
@@ -625,6 +626,149 @@ func (as *Quotes) ForEntity(db csql.Queryer, e Entity) error {
 	return err
 }
 
+// Overlay represents a single user provided tag for an entity. Overlays are
+// not part of IMDb's data. They are loaded from files supplied by the user
+// and are grouped into namespaces, so that each file can be replaced
+// independently of the others (and of IMDb's data).
+//
+// The value of a tag is optional and free form. e.g., it may be a custom
+// rating or a note about where the media is available.
+type Overlay struct {
+	Namespace string
+	Tag       string
+	Value     string
+}
+
+func (o Overlay) String() string {
+	s := sf("%s/%s", o.Namespace, o.Tag)
+	if len(o.Value) > 0 {
+		s += sf(" = %s", o.Value)
+	}
+	return s
+}
+
+// Overlays corresponds to a list of overlay tags, usually for one particular
+// entity.
+// *Overlays satisfies the Attributer interface.
+type Overlays []Overlay
+
+func (as *Overlays) Len() int { return len(*as) }
+
+// ForEntity fills 'as' with all overlay tags corresponding to the entity
+// given. The tags are sorted by namespace and then by tag name.
+func (as *Overlays) ForEntity(db csql.Queryer, e Entity) error {
+	rows, err := attrs(new(Overlay), db, e, "overlay", "atom_id",
+		"ORDER BY namespace ASC, tag ASC")
+	*as = rows.([]Overlay)
+	return err
+}
+
+// Xref represents an identifier of an entity in another database, like
+// TMDb or Wikidata. Cross references are not part of IMDb's plain text data.
+// They are loaded from files supplied by the user.
+//
+// Source is the name of the other database (e.g., "tmdb", "wikidata" or
+// "imdb" for IMDb's own "tt" and "nm" identifiers) and Id is the
+// identifier of the entity in that database.
+type Xref struct {
+	Source string
+	Id     string
+}
+
+func (x Xref) String() string {
+	return sf("%s:%s", x.Source, x.Id)
+}
+
+// Xrefs corresponds to a list of cross references, usually for one particular
+// entity.
+// *Xrefs satisfies the Attributer interface.
+type Xrefs []Xref
+
+func (as *Xrefs) Len() int { return len(*as) }
+
+// ForEntity fills 'as' with all cross references corresponding to the entity
+// given. The cross references are sorted by source.
+func (as *Xrefs) ForEntity(db csql.Queryer, e Entity) error {
+	rows, err := attrs(new(Xref), db, e, "xref", "atom_id",
+		"ORDER BY source ASC, id ASC")
+	*as = rows.([]Xref)
+	return err
+}
+
+// Id returns the first identifier from the source given. If there is no
+// cross reference for that source, then an empty string is returned.
+func (as Xrefs) Id(source string) string {
+	for _, x := range as {
+		if x.Source == source {
+			return x.Id
+		}
+	}
+	return ""
+}
+
+// AtomFromXref returns the atom identifier of the entity with the cross
+// reference given. If no such entity exists, then the zero atom is returned
+// without an error.
+func AtomFromXref(db csql.Queryer, source, id string) (Atom, error) {
+	var atom Atom
+	err := db.QueryRow(
+		"SELECT atom_id FROM xref WHERE source = $1 AND id = $2",
+		source, id).Scan(&atom)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return atom, err
+}
+
+// Art represents the URL of a piece of artwork for an entity, like a poster
+// for a movie or a photo of an actor. Artwork is not part of IMDb's data.
+// It is loaded with 'goim artwork' from files supplied by the user or from
+// TMDb.
+type Art struct {
+	Kind   string // e.g., "poster", "backdrop" or "profile"
+	Url    string
+	Source string // where the URL came from, e.g., "tmdb" or "user"
+}
+
+func (a Art) String() string {
+	return sf("%s: %s (%s)", a.Kind, a.Url, a.Source)
+}
+
+// Artwork returns all artwork URLs for the entity with the atom identifier
+// given. Artwork is sorted by kind.
+func Artwork(db csql.Queryer, id Atom) (arts []Art, err error) {
+	defer csql.Safe(&err)
+
+	rs := csql.Query(db, `
+		SELECT kind, url, source
+		FROM artwork
+		WHERE atom_id = $1
+		ORDER BY kind ASC, source ASC
+		`, id)
+	csql.ForRow(rs, func(s csql.RowScanner) {
+		var a Art
+		csql.Scan(s, &a.Kind, &a.Url, &a.Source)
+		arts = append(arts, a)
+	})
+	return
+}
+
+// Poster returns the URL of a poster (or a profile photo for actors) for the
+// entity with the atom identifier given. If there is no such artwork, then an
+// empty string is returned.
+func Poster(db csql.Queryer, id Atom) (string, error) {
+	arts, err := Artwork(db, id)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range arts {
+		if a.Kind == "poster" || a.Kind == "profile" {
+			return a.Url, nil
+		}
+	}
+	return "", nil
+}
+
 // UserRank represents the rank and number votes by users of IMDb for a
 // particular entity. If there are no votes, then the entity is considered
 // unrated.
@@ -667,6 +811,14 @@ func (r *UserRank) ForEntity(db csql.Queryer, e Entity) error {
 // information like the character played and the billing position of the
 // actor.
 //
+// Role is the role of the person in the credit. It is one of the values in
+// EnumRoles. ('actor' for cast members, but also e.g. 'director'.)
+//
+// Source is the name of the list the credit was loaded from, e.g., 'actors',
+// 'actresses' or 'directors'. IMDb doesn't record the gender of people, but
+// cast members are split between the actors and actresses lists. Source is
+// empty for credits loaded before it was recorded.
+//
 // Note that Credit has no corresponding type that satisfies the Attributer
 // interface. This may change in the future.
 type Credit struct {
@@ -675,6 +827,8 @@ type Credit struct {
 	Character string
 	Position  int
 	Attrs     string
+	Role      string
+	Source    string
 }
 
 // Valid returns true if and only if this credit belong to a valid movie
@@ -688,6 +842,8 @@ func (c Credit) String() string {
 	var s string
 	if len(c.Character) > 0 {
 		s = sf("[%s]", c.Character)
+	} else if len(c.Role) > 0 && c.Role != "actor" {
+		s = sf("(%s)", c.Role)
 	} else {
 		s = "[unknown]"
 	}
@@ -766,6 +922,8 @@ func (r *Credits) ForEntity(db csql.Queryer, e Entity) error {
 		Character string
 		Position  int
 		Attrs     string
+		Role      string
+		Source    string
 	}
 
 	var idColumn string
@@ -785,7 +943,7 @@ func (r *Credits) ForEntity(db csql.Queryer, e Entity) error {
 	typedCredits := make([]Credit, len(credits))
 	for i, c := range credits {
 		if isActor {
-			med, err := fromAtomGuess(db, c.MediaId)
+			med, err := FromAtomGuess(db, c.MediaId)
 			if err != nil {
 				return err
 			}
@@ -795,6 +953,8 @@ func (r *Credits) ForEntity(db csql.Queryer, e Entity) error {
 				Character: c.Character,
 				Position:  c.Position,
 				Attrs:     c.Attrs,
+				Role:      c.Role,
+				Source:    c.Source,
 			}
 		} else {
 			act, err := FromAtom(db, EntityActor, c.ActorId)
@@ -807,6 +967,8 @@ func (r *Credits) ForEntity(db csql.Queryer, e Entity) error {
 				Character: c.Character,
 				Position:  c.Position,
 				Attrs:     c.Attrs,
+				Role:      c.Role,
+				Source:    c.Source,
 			}
 		}
 	}
@@ -0,0 +1,284 @@
+package imdb
+
+import (
+	"database/sql"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/BurntSushi/csql"
+)
+
+// ChangeKind is the way that an entity changed in a generation.
+type ChangeKind string
+
+// All possible kinds of changes.
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeUpdated ChangeKind = "updated"
+	ChangeRemoved ChangeKind = "removed"
+)
+
+// Changes are the entities that were added, updated or removed after one
+// generation through another, grouped by entity kind. Each atom appears at
+// most once, with its net change. (e.g., An entity that was added and then
+// updated is only added, and an entity that was added and then removed
+// doesn't appear at all.)
+type Changes struct {
+	Since, Through int
+	Added          map[EntityKind][]Atom
+	Updated        map[EntityKind][]Atom
+	Removed        map[EntityKind][]Atom
+}
+
+// Change tracking works by recording a checksum of every entity (its row
+// along with its name) in the 'entity_version' table. Each time entities are
+// loaded, RecordChanges compares new checksums with the recorded ones and
+// logs the differences in the 'change_log' table with the generation they
+// belong to. The generation that tracking started at for each entity kind is
+// in the 'change_tracking' table.
+
+// RecordChanges compares the entities of the kinds given with their versions
+// recorded before, and logs the differences as changes in the generation
+// given. This should be called after loading entities and before moving to
+// the generation given with NextGeneration.
+//
+// The first time changes are recorded for an entity kind, every entity is
+// recorded without logging any changes. Changes before then are unknown.
+// (See ChangesSince.)
+func (db *DB) RecordChanges(gen int, kinds ...EntityKind) (err error) {
+	defer csql.Safe(&err)
+
+	for _, kind := range kinds {
+		db.recordKindChanges(gen, kind)
+	}
+	return
+}
+
+func (db *DB) recordKindChanges(gen int, kind EntityKind) {
+	cur := db.entitySums(kind)
+	old := db.recordedSums(kind)
+	tracked := csql.Count(db,
+		"SELECT COUNT(*) FROM change_tracking WHERE entity = $1",
+		kind.String()) > 0
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	if tracked {
+		ins, err := csql.NewInserter(tx, db.Driver, "change_log",
+			"generation", "entity", "atom_id", "change")
+		csql.Panic(err)
+		for _, c := range diffSums(old, cur) {
+			csql.Panic(ins.Exec(gen, kind.String(), c.atom, string(c.kind)))
+		}
+		csql.Panic(ins.Exec())
+	} else {
+		csql.Exec(tx,
+			"INSERT INTO change_tracking (entity, since) VALUES ($1, $2)",
+			kind.String(), gen)
+	}
+
+	csql.Exec(tx, "DELETE FROM entity_version WHERE entity = $1",
+		kind.String())
+	ins, err := csql.NewInserter(tx, db.Driver, "entity_version",
+		"entity", "atom_id", "checksum")
+	csql.Panic(err)
+	for _, s := range cur {
+		csql.Panic(ins.Exec(kind.String(), s.atom, s.sum))
+	}
+	csql.Panic(ins.Exec())
+	csql.Panic(tx.Commit())
+}
+
+// ChangesSince returns the net changes to entities after the generation
+// given through the current generation. An error is returned if changes to a
+// kind of entity weren't tracked since that generation.
+func ChangesSince(db *DB, gen int) (changes *Changes, err error) {
+	defer csql.Safe(&err)
+
+	cur, err := db.Generation()
+	csql.Panic(err)
+	changes = &Changes{
+		Since:   gen,
+		Through: cur,
+		Added:   make(map[EntityKind][]Atom),
+		Updated: make(map[EntityKind][]Atom),
+		Removed: make(map[EntityKind][]Atom),
+	}
+
+	rows := csql.Query(db, "SELECT entity, since FROM change_tracking")
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var entity string
+		var since int
+		csql.Scan(s, &entity, &since)
+		if since > gen {
+			csql.Panic(ef("Changes to %s entities are only known after "+
+				"generation %d.", entity, since))
+		}
+	})
+
+	net := make(map[EntityKind]map[Atom]ChangeKind)
+	rows = csql.Query(db, `
+		SELECT entity, atom_id, change FROM change_log
+		WHERE generation > $1
+		ORDER BY generation ASC
+	`, gen)
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var entity, change string
+		var atom Atom
+		csql.Scan(s, &entity, &atom, &change)
+		kind := entityKindFromString(entity)
+		if net[kind] == nil {
+			net[kind] = make(map[Atom]ChangeKind)
+		}
+		if c, ok := netChange(net[kind][atom], ChangeKind(change)); ok {
+			net[kind][atom] = c
+		} else {
+			delete(net[kind], atom)
+		}
+	})
+	for kind, atoms := range net {
+		for atom, c := range atoms {
+			switch c {
+			case ChangeAdded:
+				changes.Added[kind] = append(changes.Added[kind], atom)
+			case ChangeUpdated:
+				changes.Updated[kind] = append(changes.Updated[kind], atom)
+			case ChangeRemoved:
+				changes.Removed[kind] = append(changes.Removed[kind], atom)
+			}
+		}
+	}
+	for _, m := range []map[EntityKind][]Atom{
+		changes.Added, changes.Updated, changes.Removed,
+	} {
+		for _, atoms := range m {
+			sort.Sort(atomsAsc(atoms))
+		}
+	}
+	return
+}
+
+// netChange combines an earlier change (which is empty if there was none)
+// with a later one. If the changes cancel each other out, false is
+// returned.
+func netChange(before, after ChangeKind) (ChangeKind, bool) {
+	switch {
+	case before == "":
+		return after, true
+	case before == ChangeAdded && after == ChangeRemoved:
+		return "", false
+	case before == ChangeAdded:
+		return ChangeAdded, true
+	case before == ChangeRemoved && after == ChangeAdded:
+		return ChangeUpdated, true
+	}
+	return after, true
+}
+
+// atomSum is the checksum of an entity.
+type atomSum struct {
+	atom Atom
+	sum  int32
+}
+
+type atomChange struct {
+	atom Atom
+	kind ChangeKind
+}
+
+// diffSums returns the changes from the old checksums to the new ones. Both
+// must be sorted by atom.
+func diffSums(old, cur []atomSum) []atomChange {
+	var changes []atomChange
+	i, j := 0, 0
+	for i < len(old) || j < len(cur) {
+		switch {
+		case j == len(cur) || (i < len(old) && old[i].atom < cur[j].atom):
+			changes = append(changes, atomChange{old[i].atom, ChangeRemoved})
+			i++
+		case i == len(old) || cur[j].atom < old[i].atom:
+			changes = append(changes, atomChange{cur[j].atom, ChangeAdded})
+			j++
+		default:
+			if old[i].sum != cur[j].sum {
+				changes = append(changes,
+					atomChange{cur[j].atom, ChangeUpdated})
+			}
+			i++
+			j++
+		}
+	}
+	return changes
+}
+
+// entitySums returns the checksums of every entity of the kind given, sorted
+// by atom. The checksum covers every column of the entity's row and its
+// name.
+func (db *DB) entitySums(kind EntityKind) []atomSum {
+	rows := csql.Query(db, sf(`
+		SELECT e.atom_id, n.name, e.*
+		FROM %s AS e
+		LEFT JOIN name AS n ON n.atom_id = e.atom_id
+	`, kind))
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	csql.Panic(err)
+	raw := make([]sql.RawBytes, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+
+	var sums []atomSum
+	h := fnv.New32a()
+	for rows.Next() {
+		csql.Panic(rows.Scan(dest...))
+		atom, err := strconv.ParseInt(string(raw[0]), 10, 32)
+		csql.Panic(err)
+
+		h.Reset()
+		for _, col := range raw[1:] {
+			// Columns are separated by their lengths, so that moving bytes
+			// from one column to the next changes the checksum.
+			h.Write([]byte(strconv.Itoa(len(col))))
+			h.Write([]byte{0})
+			h.Write(col)
+		}
+		sums = append(sums, atomSum{Atom(atom), int32(h.Sum32())})
+	}
+	csql.Panic(rows.Err())
+	sort.Sort(sumsByAtom(sums))
+	return sums
+}
+
+// recordedSums returns the checksums recorded for every entity of the kind
+// given, sorted by atom.
+func (db *DB) recordedSums(kind EntityKind) []atomSum {
+	var sums []atomSum
+	rows := csql.Query(db, `
+		SELECT atom_id, checksum FROM entity_version WHERE entity = $1
+	`, kind.String())
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var sum atomSum
+		csql.Scan(s, &sum.atom, &sum.sum)
+		sums = append(sums, sum)
+	})
+	sort.Sort(sumsByAtom(sums))
+	return sums
+}
+
+type sumsByAtom []atomSum
+
+func (ss sumsByAtom) Len() int           { return len(ss) }
+func (ss sumsByAtom) Swap(i, j int)      { ss[i], ss[j] = ss[j], ss[i] }
+func (ss sumsByAtom) Less(i, j int) bool { return ss[i].atom < ss[j].atom }
+
+type atomsAsc []Atom
+
+func (as atomsAsc) Len() int           { return len(as) }
+func (as atomsAsc) Swap(i, j int)      { as[i], as[j] = as[j], as[i] }
+func (as atomsAsc) Less(i, j int) bool { return as[i] < as[j] }
@@ -0,0 +1,49 @@
+package imdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSums(t *testing.T) {
+	old := []atomSum{{1, 10}, {2, 20}, {4, 40}, {6, 60}}
+	cur := []atomSum{{2, 20}, {3, 30}, {4, 41}, {7, 70}}
+	want := []atomChange{
+		{1, ChangeRemoved},
+		{3, ChangeAdded},
+		{4, ChangeUpdated},
+		{6, ChangeRemoved},
+		{7, ChangeAdded},
+	}
+	if got := diffSums(old, cur); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v but got %v", want, got)
+	}
+}
+
+func TestNetChange(t *testing.T) {
+	tests := []struct {
+		changes []ChangeKind
+		want    ChangeKind // empty when there's no net change
+	}{
+		{[]ChangeKind{ChangeAdded, ChangeUpdated}, ChangeAdded},
+		{[]ChangeKind{ChangeAdded, ChangeRemoved}, ""},
+		{[]ChangeKind{ChangeUpdated, ChangeRemoved}, ChangeRemoved},
+		{[]ChangeKind{ChangeRemoved, ChangeAdded}, ChangeUpdated},
+		{[]ChangeKind{ChangeUpdated, ChangeUpdated}, ChangeUpdated},
+		{[]ChangeKind{ChangeAdded, ChangeRemoved, ChangeAdded}, ChangeAdded},
+	}
+	for _, test := range tests {
+		var net ChangeKind
+		for _, c := range test.changes {
+			if n, ok := netChange(net, c); ok {
+				net = n
+			} else {
+				net = ""
+			}
+		}
+		if net != test.want {
+			t.Errorf("%v: expected '%s' but got '%s'",
+				test.changes, test.want, net)
+		}
+	}
+}
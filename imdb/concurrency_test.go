@@ -0,0 +1,315 @@
+package imdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// These tests are meant to be run with the race detector ('go test -race'),
+// which reports unsynchronized access to the state shared by goroutines using
+// the same DB.
+
+// fakeDriver is a database driver whose connections record the statements
+// run on them and return no rows. The values of INSERT statements are kept
+// (see exec), so that inserters can be tested with it too.
+type fakeDriver struct {
+	mu    sync.Mutex
+	conns []*fakeConn
+
+	rows      []string
+	saved     int // the number of rows when the savepoint was made
+	deadlocks int
+}
+
+type fakeConn struct {
+	d     *fakeDriver
+	mu    sync.Mutex
+	stmts []string
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+type fakeTx struct{}
+
+type fakeRows struct{}
+
+var testDriver = &fakeDriver{}
+
+func init() {
+	sql.Register("goim-fake", testDriver)
+}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := &fakeConn{d: d}
+	d.conns = append(d.conns, c)
+	return c, nil
+}
+
+// opened returns the connections opened after the first n.
+func (d *fakeDriver) opened(n int) []*fakeConn {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*fakeConn(nil), d.conns[n:]...)
+}
+
+func (d *fakeDriver) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.conns)
+}
+
+// reset forgets the rows inserted, and makes the next 'deadlocks' inserts
+// fail with a deadlock.
+func (d *fakeDriver) reset(deadlocks int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rows, d.saved, d.deadlocks = nil, 0, deadlocks
+}
+
+// inserted returns the values inserted since the last reset.
+func (d *fakeDriver) inserted() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.rows...)
+}
+
+// exec keeps the values of an INSERT statement, which must all be strings.
+// Values of "bad" are rejected, and savepoints are honored.
+func (d *fakeDriver) exec(query string, args []driver.Value) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case strings.HasPrefix(query, "SAVEPOINT"):
+		d.saved = len(d.rows)
+		return nil
+	case strings.HasPrefix(query, "ROLLBACK TO"):
+		d.rows = d.rows[:d.saved]
+		return nil
+	case !strings.HasPrefix(query, "INSERT"):
+		return nil
+	}
+	if d.deadlocks > 0 {
+		d.deadlocks--
+		return ef("pq: deadlock detected")
+	}
+	// Like PostgreSQL, a failed statement leaves the rows it inserted until
+	// the transaction (or savepoint) is rolled back.
+	for _, arg := range args {
+		if arg == "bad" {
+			return ef("bad row")
+		}
+		d.rows = append(d.rows, arg.(string))
+	}
+	return nil
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c, query}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+func (fakeTx) Commit() error                  { return nil }
+func (fakeTx) Rollback() error                { return nil }
+
+func (c *fakeConn) ran() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.stmts...)
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.record()
+	if err := s.conn.d.exec(s.query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(args)), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.record()
+	return fakeRows{}, nil
+}
+
+func (s *fakeStmt) record() {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+	s.conn.stmts = append(s.conn.stmts, s.query)
+}
+
+func (fakeRows) Columns() []string              { return nil }
+func (fakeRows) Close() error                   { return nil }
+func (fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+func openFake(t *testing.T, driverName string) *DB {
+	sqldb, err := sql.Open("goim-fake", "fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DB{DB: sqldb, Driver: driverName}
+}
+
+func TestSessionEveryConnection(t *testing.T) {
+	const conns = 5
+
+	db := openFake(t, "postgres")
+	if err := db.withSession("fake", Options{}); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	before := testDriver.count()
+
+	// Every connection is held until all of them are open, so that the pool
+	// has to open a new connection for each goroutine.
+	var opened, done sync.WaitGroup
+	opened.Add(conns)
+	done.Add(conns)
+	release := make(chan struct{})
+	for i := 0; i < conns; i++ {
+		go func() {
+			defer done.Done()
+			conn, err := db.DB.Conn(context.Background())
+			opened.Done()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			<-release
+			conn.Close()
+		}()
+	}
+	opened.Wait()
+	close(release)
+	done.Wait()
+
+	got := testDriver.opened(before)
+	if len(got) != conns {
+		t.Fatalf("expected %d connections but got %d", conns, len(got))
+	}
+	for i, c := range got {
+		ran := c.ran()
+		if len(ran) == 0 || ran[0] != "SET timezone = UTC" {
+			t.Errorf("connection %d wasn't set up: %v", i, ran)
+		}
+	}
+}
+
+func TestSessionStatements(t *testing.T) {
+	if stmts := sessionStatements("duckdb", Options{}); len(stmts) > 0 {
+		t.Errorf("duckdb has session statements: %v", stmts)
+	}
+	if stmts := sessionStatements("sqlite3", Options{}); len(stmts) > 0 {
+		t.Errorf("sqlite3 has session statements: %v", stmts)
+	}
+	ro := sessionStatements("sqlite3",
+		Options{ReadOnly: true, SQLite: SQLiteServe})
+	if len(ro) == 0 || ro[0] != "PRAGMA query_only = ON" {
+		t.Errorf("read-only sqlite3 isn't query only: %v", ro)
+	}
+	if len(ro) != 1+len(SQLiteServe.pragmas(true)) {
+		t.Errorf("read-only sqlite3 is missing its profile: %v", ro)
+	}
+}
+
+func TestStmtCacheConcurrent(t *testing.T) {
+	db := openFake(t, "sqlite3")
+	defer db.Close()
+	db.stmts = newStmtCache(2)
+
+	queries := []string{"SELECT 1", "SELECT 2", "SELECT 3", "SELECT 4"}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				q := queries[(g+i)%len(queries)]
+				rows, err := db.Query(q)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				rows.Close()
+				if _, err := db.Exec(q); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	db.stmts.mu.Lock()
+	defer db.stmts.mu.Unlock()
+	if n := db.stmts.lru.Len(); n > 2 {
+		t.Errorf("expected at most 2 cached statements but got %d", n)
+	}
+	for el := db.stmts.lru.Front(); el != nil; el = el.Next() {
+		if cs := el.Value.(*cachedStmt); cs.uses != 0 {
+			t.Errorf("statement '%s' is still in use %d times",
+				cs.query, cs.uses)
+		}
+	}
+}
+
+func TestEntityCacheConcurrent(t *testing.T) {
+	c := newEntityCache(10)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				id := Atom(i % 20)
+				c.add(&Movie{Id: id, Title: "The Matrix", Year: 1999})
+				if e, ok := c.get(id); ok {
+					e.(*Movie).Title = "Changed"
+				}
+				if i%25 == 0 {
+					c.setGeneration(g)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for id := Atom(0); id < 20; id++ {
+		if e, ok := c.get(id); ok && e.(*Movie).Title != "The Matrix" {
+			t.Errorf("cached movie %d was changed: %s", id, e)
+		}
+	}
+
+	// Only one of many concurrent lookups checks the generation.
+	c.clear()
+	due := make(chan bool, 10)
+	for g := 0; g < cap(due); g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			due <- c.due()
+		}()
+	}
+	wg.Wait()
+	close(due)
+	checks := 0
+	for d := range due {
+		if d {
+			checks++
+		}
+	}
+	if checks != 1 {
+		t.Errorf("expected 1 generation check but got %d", checks)
+	}
+}
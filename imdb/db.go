@@ -3,6 +3,9 @@ package imdb
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 
@@ -18,6 +21,15 @@ var (
 // DB represents a database containing information from the Internet
 // Movie DataBase. The underlying database connection is exposed so that
 // clients may run their own queries.
+//
+// A DB is safe for concurrent use by multiple goroutines, e.g., by the
+// handlers of a web server searching it at the same time. Everything about
+// it is decided when it's opened and never changes afterwards: settings that
+// apply to a connection (like PostgreSQL's time zone or SQLite's pragmas) are
+// applied to every connection of the pool as it's opened, and whether fuzzy
+// searching is available is checked once. The only state that changes is in
+// the statement and entity caches, which have locks of their own. Its fields
+// must not be changed once it's opened.
 type DB struct {
 	*sql.DB
 
@@ -26,33 +38,238 @@ type DB struct {
 	// For example, PostgreSQL supports simultaneous transactions updating the
 	// database but SQLite does not.
 	Driver string
+
+	fuzzy    bool         // whether pg_trgm was available when opened
+	stmts    *stmtCache   // nil unless Options.StmtCacheSize is positive
+	entities *entityCache // nil unless Options.EntityCacheSize is positive
 }
 
-// Open opens a connection to an IMDb relational database. The driver may
-// either be "sqlite3" or "postgres". The dsn (data source name) is dependent
+// Open opens a connection to an IMDb relational database. The driver may be
+// "sqlite3", "postgres" or "duckdb". The dsn (data source name) is dependent
 // upon the driver. For example, for the sqlite3 driver, the dsn is just a
 // path to a file (that may not exist).
 //
 // In general, the 'driver' and 'dsn' should be exactly the same as used in
 // the 'database/sql' package.
 //
+// The connection pool can be configured by opening the database with
+// OpenWith instead.
+//
 // Whenever an imdb database is opened, it is checked to make sure its schema
 // is up to date with the current library. If it isn't, it will be updated.
+//
+// SQLite databases are put in WAL mode, so that readers see a consistent
+// snapshot of the database while it is being loaded (instead of failing
+// because the database is locked).
+//
+// DuckDB databases store tables by column, which makes aggregate queries over
+// whole tables much faster. They can be searched, but they can't be loaded
+// with 'goim load'. Instead, they're copied from another database with 'goim
+// analytics'. The DuckDB driver is only built in with the 'duckdb' build tag.
 func Open(driver, dsn string) (*DB, error) {
+	return OpenWith(driver, dsn, Options{})
+}
+
+// openMigrated opens a database and brings its schema up to date.
+func openMigrated(driver, dsn string) (*DB, error) {
 	db, err := migration.Open(driver, dsn, migrations[driver])
 	if err != nil {
 		return nil, err
 	}
-	if driver == "postgres" {
-		if _, err := db.Exec("SET timezone = UTC"); err != nil {
-			return nil, fmt.Errorf("Could not set timezone to UTC: %s", err)
+	if driver == "sqlite3" {
+		// WAL mode is kept in the database file, so unlike most pragmas,
+		// it only needs to be set on one connection.
+		if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("Could not enable WAL mode: %s", err)
 		}
 	}
-	return &DB{db, driver}, nil
+	return &DB{DB: db, Driver: driver}, nil
+}
+
+// OpenReadOnly is like Open, except the database is opened such that nothing
+// can change it. This is useful for serving a pre-built database (e.g., one
+// shipped inside a container image) where the search path must never write.
+//
+// SQLite databases are opened with the 'mode=ro' and 'immutable=1' URI
+// parameters, which also means that SQLite assumes nobody else changes the
+// file while it is open. PostgreSQL connections are opened with
+// 'default_transaction_read_only' turned on.
+//
+// Since migrations can't be run, an error is returned if the database schema
+// isn't up to date.
+func OpenReadOnly(driver, dsn string) (*DB, error) {
+	return OpenWith(driver, dsn, Options{ReadOnly: true})
+}
+
+func openReadOnly(driver, dsn string) (*DB, error) {
+	dsn, err := readOnlyDsn(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	sqldb, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{DB: sqldb, Driver: driver}
+	if err := db.checkSchema(); err != nil {
+		sqldb.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// readOnlyDsn returns the data source name that opens the database given
+// read-only.
+func readOnlyDsn(driver, dsn string) (string, error) {
+	switch driver {
+	case "postgres":
+		return pgReadOnlyDsn(dsn), nil
+	case "sqlite3":
+		return sqliteReadOnlyDsn(dsn), nil
+	case "duckdb":
+		return duckdbReadOnlyDsn(dsn), nil
+	}
+	return "", ef("Unrecognized database driver: %s", driver)
+}
+
+// pgReadOnlyDsn adds the 'default_transaction_read_only' parameter to a
+// PostgreSQL connection string, which may be a URL or a list of key/value
+// pairs.
+func pgReadOnlyDsn(dsn string) string {
+	const param = "default_transaction_read_only"
+	if strings.HasPrefix(dsn, "postgres://") ||
+		strings.HasPrefix(dsn, "postgresql://") {
+		if strings.Contains(dsn, "?") {
+			return dsn + "&" + param + "=on"
+		}
+		return dsn + "?" + param + "=on"
+	}
+	return strings.TrimSpace(dsn) + " " + param + "=on"
+}
+
+// sqliteReadOnlyDsn turns the path of a SQLite database into a URI file name
+// that opens it read-only and immutable.
+func sqliteReadOnlyDsn(dsn string) string {
+	if strings.HasPrefix(dsn, "file:") {
+		if strings.Contains(dsn, "?") {
+			return dsn + "&mode=ro&immutable=1"
+		}
+		return dsn + "?mode=ro&immutable=1"
+	}
+	u := url.URL{Path: dsn}
+	return "file:" + u.EscapedPath() + "?mode=ro&immutable=1"
+}
+
+// duckdbReadOnlyDsn adds the 'access_mode' parameter to the path of a DuckDB
+// database, which opens it read-only.
+func duckdbReadOnlyDsn(dsn string) string {
+	if strings.Contains(dsn, "?") {
+		return dsn + "&access_mode=read_only"
+	}
+	return dsn + "?access_mode=read_only"
+}
+
+// checkSchema returns an error if the database's schema isn't the one
+// expected by this package. (The migration package records the number of
+// migrations applied in the 'migration_version' table.)
+func (db *DB) checkSchema() error {
+	var version int
+	row := db.QueryRow("SELECT version FROM migration_version")
+	if err := row.Scan(&version); err != nil {
+		return ef("Could not read schema version (the database may not "+
+			"have been created yet): %s", err)
+	}
+	if want := len(migrations[db.Driver]); version != want {
+		return ef("Database schema is at version %d, but version %d is "+
+			"required. Open it once without read-only mode to migrate it.",
+			version, want)
+	}
+	return nil
+}
+
+// Generation returns the generation of the data in the database. It starts
+// at 0 and is incremented each time 'goim load' finishes. Clients that cache
+// data from the database can compare generations to tell when their caches
+// are stale. Use Snapshot to also find out when the data was loaded and how
+// old it is.
+func (db *DB) Generation() (gen int, err error) {
+	defer csql.Safe(&err)
+	csql.Scan(db.QueryRow("SELECT number FROM generation"), &gen)
+	return
+}
+
+// Snapshot identifies the data in the database, so that users can tell how
+// fresh it is.
+type Snapshot struct {
+	Generation int
+
+	// Loaded is when the generation was stamped by NextGeneration. It is zero
+	// if no lists have been loaded.
+	Loaded time.Time
+
+	// Dataset is the date of the lists that were loaded, as reported by the
+	// server they were downloaded from. It is zero if it isn't known.
+	Dataset time.Time
+}
+
+func (s Snapshot) String() string {
+	str := sf("generation %d", s.Generation)
+	if !s.Loaded.IsZero() {
+		str += sf(", loaded %s", s.Loaded.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	if !s.Dataset.IsZero() {
+		str += sf(", data from %s", s.Dataset.Format("2006-01-02"))
+	}
+	return str
+}
+
+// Snapshot returns the generation of the data in the database along with
+// when it was loaded and the date of the data.
+func (db *DB) Snapshot() (snap Snapshot, err error) {
+	defer csql.Safe(&err)
+
+	var loaded, dataset *time.Time
+	csql.Scan(db.QueryRow("SELECT number, loaded, dataset FROM generation"),
+		&snap.Generation, &loaded, &dataset)
+	if loaded != nil {
+		snap.Loaded = *loaded
+	}
+	if dataset != nil {
+		snap.Dataset = *dataset
+	}
+	return
+}
+
+// NextGeneration increments the generation of the data in the database,
+// stamps it with the current time and the date of the data loaded, and
+// returns the new generation. It should be called after the database has
+// been updated. If the dataset date is zero, the date of the previous
+// generation is kept.
+func (db *DB) NextGeneration(dataset time.Time) (gen int, err error) {
+	defer csql.Safe(&err)
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+	csql.Exec(tx, "UPDATE generation SET number = number + 1, loaded = $1",
+		time.Now().UTC())
+	if !dataset.IsZero() {
+		y, m, d := dataset.UTC().Date()
+		csql.Exec(tx, "UPDATE generation SET dataset = $1",
+			time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
+	}
+	csql.Scan(tx.QueryRow("SELECT number FROM generation"), &gen)
+	csql.Panic(tx.Commit())
+	db.ClearEntityCache()
+	return
 }
 
 // Close closes the connection to the database.
 func (db *DB) Close() error {
+	if db.stmts != nil {
+		db.stmts.close()
+	}
 	return db.DB.Close()
 }
 
@@ -75,6 +292,12 @@ func (db *DB) Tables() (tables []string, err error) {
 			WHERE type = 'table'
 			ORDER BY tbl_name ASC
 		`
+	case "duckdb":
+		q = `
+			SELECT table_name FROM information_schema.tables
+			WHERE table_schema = current_schema()
+			ORDER BY table_name ASC
+		`
 	default:
 		return nil, ef("Unrecognized database driver: %s", db.Driver)
 	}
@@ -90,11 +313,18 @@ func (db *DB) Tables() (tables []string, err error) {
 }
 
 // IsFuzzyEnabled returns true if and only if the database is a Postgres
-// database with the 'pg_trgm' extension enabled.
+// database with the 'pg_trgm' extension enabled. This is checked when the
+// database is opened.
 func (db *DB) IsFuzzyEnabled() bool {
-	_, err := db.Exec("SELECT similarity('a', 'a')")
-	if err == nil {
-		return true
+	return db.fuzzy
+}
+
+// checkFuzzy returns true if the database is a Postgres database with the
+// 'pg_trgm' extension enabled.
+func (db *DB) checkFuzzy() bool {
+	if db.Driver != "postgres" {
+		return false
 	}
-	return false
+	_, err := db.Exec("SELECT similarity('a', 'a')")
+	return err == nil
 }
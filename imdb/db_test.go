@@ -0,0 +1,56 @@
+package imdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadOnlyDsn(t *testing.T) {
+	tests := []struct {
+		driver, dsn, want string
+	}{
+		{"sqlite3", "goim.sqlite", "file:goim.sqlite?mode=ro&immutable=1"},
+		{"sqlite3", "/tmp/goim db.sqlite",
+			"file:/tmp/goim%20db.sqlite?mode=ro&immutable=1"},
+		{"sqlite3", "file:goim.sqlite?cache=shared",
+			"file:goim.sqlite?cache=shared&mode=ro&immutable=1"},
+		{"postgres", "dbname=imdb sslmode=disable",
+			"dbname=imdb sslmode=disable default_transaction_read_only=on"},
+		{"postgres", "postgres://localhost/imdb",
+			"postgres://localhost/imdb?default_transaction_read_only=on"},
+		{"postgres", "postgres://localhost/imdb?sslmode=disable",
+			"postgres://localhost/imdb?sslmode=disable" +
+				"&default_transaction_read_only=on"},
+	}
+	for _, test := range tests {
+		var got string
+		if test.driver == "sqlite3" {
+			got = sqliteReadOnlyDsn(test.dsn)
+		} else {
+			got = pgReadOnlyDsn(test.dsn)
+		}
+		if got != test.want {
+			t.Errorf("%s: expected '%s' but got '%s'", test.dsn, test.want, got)
+		}
+	}
+}
+
+func TestSnapshotString(t *testing.T) {
+	loaded := time.Date(2014, 12, 20, 3, 4, 0, 0, time.UTC)
+	dataset := time.Date(2014, 12, 19, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		snap Snapshot
+		want string
+	}{
+		{Snapshot{}, "generation 0"},
+		{Snapshot{Generation: 3, Loaded: loaded},
+			"generation 3, loaded 2014-12-20 03:04 UTC"},
+		{Snapshot{Generation: 3, Loaded: loaded, Dataset: dataset},
+			"generation 3, loaded 2014-12-20 03:04 UTC, data from 2014-12-19"},
+	}
+	for _, test := range tests {
+		if got := test.snap.String(); got != test.want {
+			t.Errorf("expected '%s' but got '%s'", test.want, got)
+		}
+	}
+}
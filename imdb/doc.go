@@ -21,6 +21,15 @@ csql.Queryer can be a *imdb.DB, *sql.DB, *sql.Stmt or a *sql.Tx, etc.
 The central types of this package are DB, Entity, Movie, Tvshow, Episode and
 Actor. Most of the other types correspond to attributes of entities.
 
+Concurrency
+
+A DB may be shared by any number of goroutines, e.g., by every handler of a web
+server, without locking. Its configuration is fixed when it's opened, and each
+query only uses state of its own (plus the statement and entity caches, which
+are safe for concurrent use). Entities returned by this package belong to the
+caller. The exceptions are package variables like JSONSnakeCase, which should
+only be set before a DB is used.
+
 Beta
 
 Please consider this package as beta material. I've already refactored it a few
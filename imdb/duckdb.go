@@ -0,0 +1,10 @@
+// +build cgo,duckdb
+
+package imdb
+
+import (
+	_ "github.com/marcboeller/go-duckdb"
+)
+
+// duckdbEnabled is true when the DuckDB driver is built in.
+const duckdbEnabled = true
@@ -0,0 +1,7 @@
+// +build !cgo !duckdb
+
+package imdb
+
+// duckdbEnabled is false since the DuckDB driver is only built in with the
+// 'duckdb' build tag (and cgo), which keeps it out of most builds.
+const duckdbEnabled = false
@@ -1,6 +1,9 @@
 package imdb
 
 import (
+	"database/sql"
+	"strings"
+
 	"github.com/BurntSushi/csql"
 )
 
@@ -80,7 +83,21 @@ type Entity interface {
 }
 
 // FromAtom returns an entity given its type and its unique identifier.
+// Entities are looked up in the entity cache first when db is a *DB that has
+// one. (See Options.EntityCacheSize.)
 func FromAtom(db csql.Queryer, ent EntityKind, id Atom) (Entity, error) {
+	cache, _ := db.(*DB)
+	if e, ok := cache.cachedEntity(id); ok && e.Type() == ent {
+		return e, nil
+	}
+	e, err := fromAtom(db, ent, id)
+	if err == nil {
+		cache.cacheEntity(e)
+	}
+	return e, err
+}
+
+func fromAtom(db csql.Queryer, ent EntityKind, id Atom) (Entity, error) {
 	switch ent {
 	case EntityMovie:
 		return atomToMovie(db, id)
@@ -94,11 +111,21 @@ func FromAtom(db csql.Queryer, ent EntityKind, id Atom) (Entity, error) {
 	return nil, ef("Unrecognized entity type: %s", ent)
 }
 
-// fromAtomGuess is just like FromAtom, except it doesn't use an entity type
+// FromAtomGuess is just like FromAtom, except it doesn't use an entity type
 // as a hint for which table to select from. Therefore, it tries all entity
 // types until it gets a hit. If no entities could be found matching the
 // identifier given, an error is returned.
-func fromAtomGuess(db csql.Queryer, id Atom) (e Entity, err error) {
+func FromAtomGuess(db csql.Queryer, id Atom) (e Entity, err error) {
+	cache, _ := db.(*DB)
+	if e, ok := cache.cachedEntity(id); ok {
+		return e, nil
+	}
+	defer func() {
+		if err == nil {
+			cache.cacheEntity(e)
+		}
+	}()
+
 	e, err = atomToMovie(db, id)
 	if err == nil {
 		return e, nil
@@ -239,50 +266,169 @@ func (e *Actor) Scan(rs csql.RowScanner) error {
 
 func atomToMovie(db csql.Queryer, id Atom) (*Movie, error) {
 	e := new(Movie)
-	err := e.Scan(db.QueryRow(`
-		SELECT m.atom_id, n.name, m.year, m.sequence, m.tv, m.video
-		FROM movie AS m
-		LEFT JOIN name AS n ON n.atom_id = m.atom_id
-		WHERE m.atom_id = $1
-		`, id))
+	err := e.Scan(db.QueryRow(entitySQL(EntityMovie, "= $1"), id))
 	return e, err
 }
 
 func atomToTvshow(db csql.Queryer, id Atom) (*Tvshow, error) {
 	e := new(Tvshow)
-	err := e.Scan(db.QueryRow(`
-		SELECT t.atom_id, n.name, t.year, t.sequence, t.year_start, t.year_end
-		FROM tvshow AS t
-		LEFT JOIN name AS n ON n.atom_id = t.atom_id
-		WHERE t.atom_id = $1
-		`, id))
+	err := e.Scan(db.QueryRow(entitySQL(EntityTvshow, "= $1"), id))
 	return e, err
 }
 
 func atomToEpisode(db csql.Queryer, id Atom) (*Episode, error) {
 	e := new(Episode)
-	err := e.Scan(db.QueryRow(`
-		SELECT e.atom_id, e.tvshow_atom_id, n.name,
-			   e.year, e.season, e.episode_num
-		FROM episode AS e
-		LEFT JOIN name AS n ON n.atom_id = e.atom_id
-		WHERE e.atom_id = $1
-		`, id))
+	err := e.Scan(db.QueryRow(entitySQL(EntityEpisode, "= $1"), id))
 	return e, err
 }
 
 func atomToActor(db csql.Queryer, id Atom) (*Actor, error) {
 	e := new(Actor)
-	err := e.Scan(db.QueryRow(`
-		SELECT a.atom_id, n.name, a.sequence
-		FROM actor AS a
-		LEFT JOIN name AS n ON n.atom_id = a.atom_id
-		WHERE a.atom_id = $1
-		`, id))
+	err := e.Scan(db.QueryRow(entitySQL(EntityActor, "= $1"), id))
 	return e, err
 }
 
+// entitySQL returns a query for entities of the kind given whose atom
+// identifiers satisfy the condition given (e.g., '= $1'). Its columns are in
+// the order read by the entity's Scan method.
+func entitySQL(ent EntityKind, cond string) string {
+	switch ent {
+	case EntityMovie:
+		return sf(`
+			SELECT m.atom_id, n.name, m.year, m.sequence, m.tv, m.video
+			FROM movie AS m
+			LEFT JOIN name AS n ON n.atom_id = m.atom_id
+			WHERE m.atom_id %s
+			`, cond)
+	case EntityTvshow:
+		return sf(`
+			SELECT t.atom_id, n.name, t.year, t.sequence,
+				   t.year_start, t.year_end
+			FROM tvshow AS t
+			LEFT JOIN name AS n ON n.atom_id = t.atom_id
+			WHERE t.atom_id %s
+			`, cond)
+	case EntityEpisode:
+		return sf(`
+			SELECT e.atom_id, e.tvshow_atom_id, n.name,
+				   e.year, e.season, e.episode_num
+			FROM episode AS e
+			LEFT JOIN name AS n ON n.atom_id = e.atom_id
+			WHERE e.atom_id %s
+			`, cond)
+	case EntityActor:
+		return sf(`
+			SELECT a.atom_id, n.name, a.sequence
+			FROM actor AS a
+			LEFT JOIN name AS n ON n.atom_id = a.atom_id
+			WHERE a.atom_id %s
+			`, cond)
+	}
+	panic(sf("unrecognized entity %d", ent))
+}
+
+// newEntity returns an empty entity of the kind given, ready to be scanned.
+func newEntity(ent EntityKind) Entity {
+	switch ent {
+	case EntityMovie:
+		return new(Movie)
+	case EntityTvshow:
+		return new(Tvshow)
+	case EntityEpisode:
+		return new(Episode)
+	case EntityActor:
+		return new(Actor)
+	}
+	return nil
+}
+
+// FromAtoms is like FromAtom, except it returns every entity of the type
+// given with one of the identifiers given, keyed by identifier, using a
+// single query. Identifiers without such an entity are missing from the map.
+func FromAtoms(
+	db csql.Queryer,
+	ent EntityKind,
+	ids []Atom,
+) (ents map[Atom]Entity, err error) {
+	defer csql.Safe(&err)
+
+	if newEntity(ent) == nil {
+		return nil, ef("Unrecognized entity type: %d", ent)
+	}
+	cache, _ := db.(*DB)
+	ents = make(map[Atom]Entity, len(ids))
+	var missing []string
+	for _, id := range ids {
+		if e, ok := cache.cachedEntity(id); ok && e.Type() == ent {
+			ents[id] = e
+		} else {
+			missing = append(missing, id.String())
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	in := sf("IN (%s)", strings.Join(missing, ", "))
+	rows := csql.Query(db, entitySQL(ent, in))
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		e := newEntity(ent)
+		csql.Panic(e.Scan(s))
+		ents[e.Ident()] = e
+		cache.cacheEntity(e)
+	})
+	return
+}
+
 // Tvshow returns a TV show entity that corresponds to this episode.
 func (e *Episode) Tvshow(db csql.Queryer) (*Tvshow, error) {
 	return atomToTvshow(db, e.TvshowId)
 }
+
+// Next returns the episode that comes after this one in the same TV show,
+// ordered by season and then episode number. If this is the last episode, or
+// if this episode has no season or episode number, then a nil episode and a
+// nil error are returned.
+func (e *Episode) Next(db csql.Queryer) (*Episode, error) {
+	return e.adjacent(db, `
+		(e.season > $2 OR (e.season = $2 AND e.episode_num > $3))
+		ORDER BY e.season ASC, e.episode_num ASC
+		`)
+}
+
+// Previous returns the episode that comes before this one in the same TV
+// show, ordered by season and then episode number. If this is the first
+// episode, or if this episode has no season or episode number, then a nil
+// episode and a nil error are returned.
+func (e *Episode) Previous(db csql.Queryer) (*Episode, error) {
+	return e.adjacent(db, `
+		(e.season < $2 OR (e.season = $2 AND e.episode_num < $3))
+		ORDER BY e.season DESC, e.episode_num DESC
+		`)
+}
+
+// adjacent returns the first numbered episode in the same TV show that
+// satisfies the condition and order given. The condition may refer to the
+// season and episode number of this episode as $2 and $3.
+func (e *Episode) adjacent(db csql.Queryer, condOrder string) (*Episode, error) {
+	if e.Season <= 0 || e.EpisodeNum <= 0 {
+		return nil, nil
+	}
+	adj := new(Episode)
+	err := adj.Scan(db.QueryRow(`
+		SELECT e.atom_id, e.tvshow_atom_id, n.name,
+			   e.year, e.season, e.episode_num
+		FROM episode AS e
+		LEFT JOIN name AS n ON n.atom_id = e.atom_id
+		WHERE e.tvshow_atom_id = $1
+			AND e.season > 0 AND e.episode_num > 0
+			AND `+condOrder+`
+		LIMIT 1
+		`, e.TvshowId, e.Season, e.EpisodeNum))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return adj, nil
+}
@@ -0,0 +1,158 @@
+package imdb
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// entityCacheCheck is how often an entity cache compares the generation of
+// its entities with the generation of the database. Other programs (like
+// 'goim load') may change the database at any time, so cached entities can be
+// stale for at most this long.
+const entityCacheCheck = 5 * time.Second
+
+// entityCache is a bounded cache of entities looked up with FromAtom that
+// evicts the least recently used entity when it is full. Entities are
+// copied in and out of the cache, so callers may change the entities they
+// get. It is safe for concurrent use.
+type entityCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // most recently used at the front
+	ents    map[Atom]*list.Element
+	gen     int       // the generation of the cached entities
+	checked time.Time // when gen was last read from the database
+}
+
+func newEntityCache(size int) *entityCache {
+	return &entityCache{
+		size: size,
+		lru:  list.New(),
+		ents: make(map[Atom]*list.Element),
+	}
+}
+
+// get returns a copy of the cached entity with the atom given, if there is
+// one.
+func (c *entityCache) get(id Atom) (Entity, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.ents[id]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return copyEntity(el.Value.(Entity)), true
+}
+
+// add puts a copy of the entity given in the cache.
+func (c *entityCache) add(e Entity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e = copyEntity(e)
+	if el, ok := c.ents[e.Ident()]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.ents[e.Ident()] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		old := c.lru.Remove(c.lru.Back()).(Entity)
+		delete(c.ents, old.Ident())
+	}
+}
+
+// due returns true if the generation of the cached entities should be
+// compared with the database's. Only the first caller that finds the check
+// due is told so, so that concurrent lookups don't all read the generation
+// at once.
+func (c *entityCache) due() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checked) < entityCacheCheck {
+		return false
+	}
+	c.checked = time.Now()
+	return true
+}
+
+// setGeneration records that the database is at the generation given, and
+// empties the cache if its entities are from another generation.
+func (c *entityCache) setGeneration(gen int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checked = time.Now()
+	if gen != c.gen {
+		c.gen = gen
+		c.lru.Init()
+		c.ents = make(map[Atom]*list.Element)
+	}
+}
+
+// clear empties the cache.
+func (c *entityCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checked = time.Time{}
+	c.lru.Init()
+	c.ents = make(map[Atom]*list.Element)
+}
+
+// copyEntity returns a copy of an entity returned by FromAtom.
+func copyEntity(e Entity) Entity {
+	switch e := e.(type) {
+	case *Movie:
+		c := *e
+		return &c
+	case *Tvshow:
+		c := *e
+		return &c
+	case *Episode:
+		c := *e
+		return &c
+	case *Actor:
+		c := *e
+		return &c
+	}
+	return e
+}
+
+// cachedEntity returns the entity with the atom given from the entity cache
+// of the database, if it has one and the entity is in it.
+func (db *DB) cachedEntity(id Atom) (Entity, bool) {
+	if db == nil || db.entities == nil {
+		return nil, false
+	}
+	if db.entities.due() {
+		gen, err := db.Generation()
+		if err != nil {
+			// The lookup that follows reports what's wrong.
+			return nil, false
+		}
+		db.entities.setGeneration(gen)
+	}
+	return db.entities.get(id)
+}
+
+// cacheEntity adds an entity to the entity cache of the database, if it has
+// one.
+func (db *DB) cacheEntity(e Entity) {
+	if db == nil || db.entities == nil {
+		return
+	}
+	db.entities.add(e)
+}
+
+// ClearEntityCache removes every entity from the entity cache of the
+// database. (See Options.EntityCacheSize.) This is done by NextGeneration,
+// so it only needs to be called after changing entities some other way.
+func (db *DB) ClearEntityCache() {
+	if db.entities != nil {
+		db.entities.clear()
+	}
+}
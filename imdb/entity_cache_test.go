@@ -0,0 +1,37 @@
+package imdb
+
+import "testing"
+
+func TestEntityCache(t *testing.T) {
+	c := newEntityCache(2)
+	c.add(&Movie{Id: 1, Title: "The Matrix", Year: 1999})
+	c.add(&Actor{Id: 2, FullName: "Reeves, Keanu"})
+
+	// Entities are copied, so changing one doesn't change the cache.
+	e, ok := c.get(1)
+	if !ok {
+		t.Fatalf("expected movie 1 to be cached")
+	}
+	e.(*Movie).Title = "Changed"
+	if e, _ := c.get(1); e.(*Movie).Title != "The Matrix" {
+		t.Errorf("expected cached title 'The Matrix' but got '%s'",
+			e.(*Movie).Title)
+	}
+
+	// Movie 1 was used last, so actor 2 is evicted.
+	c.add(&Tvshow{Id: 3, Title: "The Simpsons", Year: 1989})
+	if _, ok := c.get(2); ok {
+		t.Errorf("expected actor 2 to be evicted")
+	}
+	for _, id := range []Atom{1, 3} {
+		if _, ok := c.get(id); !ok {
+			t.Errorf("expected atom %d to be cached", id)
+		}
+	}
+
+	// Moving to another generation empties the cache.
+	c.setGeneration(1)
+	if _, ok := c.get(1); ok {
+		t.Errorf("expected the cache to be empty in a new generation")
+	}
+}
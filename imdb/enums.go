@@ -5,6 +5,18 @@ package imdb
 // EnumMPAA lists all available MPAA rating values.
 var EnumMPAA = []string{"G", "PG", "PG-13", "R", "NC-17"}
 
+// EnumRoles lists all roles a person can have in a credit. People in the
+// actors and actresses lists have the 'actor' role.
+var EnumRoles = []string{
+	"actor",
+	"cinematographer",
+	"composer",
+	"director",
+	"editor",
+	"producer",
+	"writer",
+}
+
 // EnumGenres lists all available genre attribute values.
 var EnumGenres = []string{
 	"action",
@@ -0,0 +1,144 @@
+package imdb
+
+import (
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/csql"
+)
+
+// EpisodeGaps describes what's missing or incomplete in the episodes of a TV
+// show, as found by FindEpisodeGaps. It's meant to help validate a collection
+// of episodes against IMDb, so that missing episodes can be told apart from
+// episodes that IMDb doesn't know about (or that haven't aired yet).
+type EpisodeGaps struct {
+	// Episodes is the number of episodes of the TV show.
+	Episodes int
+
+	// MissingSeasons are the season numbers without any episodes between
+	// the first and last seasons. (Seasons don't always start at 1, e.g.,
+	// when they're numbered by year.)
+	MissingSeasons []int
+
+	// MissingEpisodes are the episode numbers missing from each season, up
+	// to its last episode, in order of season.
+	MissingEpisodes []SeasonGap
+
+	// Duplicates are episodes with the same season and episode number as an
+	// episode before them.
+	Duplicates []*Episode
+
+	// Unnumbered are episodes without a season or episode number.
+	Unnumbered []*Episode
+
+	// Unaired are episodes without a year, or with a year after the current
+	// year.
+	Unaired []*Episode
+
+	// Unrated are episodes without a rating.
+	Unrated []*Episode
+}
+
+// SeasonGap is the episode numbers missing from one season.
+type SeasonGap struct {
+	Season   int
+	Episodes []int
+}
+
+// Complete returns true if nothing is missing or incomplete.
+func (g *EpisodeGaps) Complete() bool {
+	return len(g.MissingSeasons) == 0 && len(g.MissingEpisodes) == 0 &&
+		len(g.Duplicates) == 0 && len(g.Unnumbered) == 0 &&
+		len(g.Unaired) == 0 && len(g.Unrated) == 0
+}
+
+// gapEpisode is an episode considered by findGaps.
+type gapEpisode struct {
+	ep    *Episode
+	rated bool
+}
+
+// FindEpisodeGaps returns the gaps in the episodes of the TV show given.
+func FindEpisodeGaps(db csql.Queryer, tv *Tvshow) (g *EpisodeGaps, err error) {
+	defer csql.Safe(&err)
+
+	var eps []gapEpisode
+	rows := csql.Query(db, `
+		SELECT
+			e.atom_id, e.tvshow_atom_id, n.name,
+			e.year, e.season, e.episode_num,
+			COALESCE(r.votes, 0)
+		FROM episode AS e
+		LEFT JOIN name AS n ON n.atom_id = e.atom_id
+		LEFT JOIN rating AS r ON r.atom_id = e.atom_id
+		WHERE e.tvshow_atom_id = $1
+		ORDER BY e.season ASC, e.episode_num ASC, e.atom_id ASC
+	`, tv.Id)
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		ep := new(Episode)
+		var votes int
+		csql.Scan(s, &ep.Id, &ep.TvshowId, &ep.Title,
+			&ep.Year, &ep.Season, &ep.EpisodeNum, &votes)
+		eps = append(eps, gapEpisode{ep, votes > 0})
+	})
+	return findGaps(eps, time.Now().Year()), nil
+}
+
+// findGaps finds the gaps in the episodes given, which must be sorted by
+// season and episode number. Episodes with a year after thisYear are
+// unaired.
+func findGaps(eps []gapEpisode, thisYear int) *EpisodeGaps {
+	gaps := &EpisodeGaps{Episodes: len(eps)}
+	numbers := make(map[int]map[int]bool) // season -> episode numbers
+	var seasons []int
+	for _, ge := range eps {
+		ep := ge.ep
+		if ep.Year == 0 || ep.Year > thisYear {
+			gaps.Unaired = append(gaps.Unaired, ep)
+		}
+		if !ge.rated {
+			gaps.Unrated = append(gaps.Unrated, ep)
+		}
+		if ep.Season == 0 || ep.EpisodeNum == 0 {
+			gaps.Unnumbered = append(gaps.Unnumbered, ep)
+			continue
+		}
+		if numbers[ep.Season] == nil {
+			numbers[ep.Season] = make(map[int]bool)
+			seasons = append(seasons, ep.Season)
+		}
+		if numbers[ep.Season][ep.EpisodeNum] {
+			gaps.Duplicates = append(gaps.Duplicates, ep)
+		}
+		numbers[ep.Season][ep.EpisodeNum] = true
+	}
+	if len(seasons) == 0 {
+		return gaps
+	}
+
+	sort.Ints(seasons)
+	for s := seasons[0]; s <= seasons[len(seasons)-1]; s++ {
+		if numbers[s] == nil {
+			gaps.MissingSeasons = append(gaps.MissingSeasons, s)
+		}
+	}
+	for _, s := range seasons {
+		last := 0
+		for n := range numbers[s] {
+			if n > last {
+				last = n
+			}
+		}
+		var missing []int
+		for n := 1; n < last; n++ {
+			if !numbers[s][n] {
+				missing = append(missing, n)
+			}
+		}
+		if len(missing) > 0 {
+			gaps.MissingEpisodes = append(gaps.MissingEpisodes,
+				SeasonGap{s, missing})
+		}
+	}
+	return gaps
+}
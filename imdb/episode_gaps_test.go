@@ -0,0 +1,66 @@
+package imdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindGaps(t *testing.T) {
+	ep := func(id Atom, year, season, num int, rated bool) gapEpisode {
+		return gapEpisode{&Episode{
+			Id: id, Year: year, Season: season, EpisodeNum: num,
+		}, rated}
+	}
+	eps := []gapEpisode{
+		ep(1, 2000, 0, 0, false), // unnumbered and unrated
+		ep(2, 2000, 1, 1, true),
+		ep(3, 2000, 1, 2, true),
+		ep(4, 2000, 1, 2, true), // duplicate
+		ep(5, 2000, 1, 5, true),
+		ep(6, 2002, 3, 2, true),
+		ep(7, 0, 3, 3, false),    // unaired and unrated
+		ep(8, 2015, 3, 4, false), // unaired and unrated
+	}
+	gaps := findGaps(eps, 2010)
+
+	ids := func(eps []*Episode) []Atom {
+		var ids []Atom
+		for _, e := range eps {
+			ids = append(ids, e.Id)
+		}
+		return ids
+	}
+	if gaps.Episodes != len(eps) {
+		t.Errorf("expected %d episodes but got %d", len(eps), gaps.Episodes)
+	}
+	if want := []int{2}; !reflect.DeepEqual(gaps.MissingSeasons, want) {
+		t.Errorf("missing seasons: expected %v but got %v",
+			want, gaps.MissingSeasons)
+	}
+	want := []SeasonGap{{1, []int{3, 4}}, {3, []int{1}}}
+	if !reflect.DeepEqual(gaps.MissingEpisodes, want) {
+		t.Errorf("missing episodes: expected %v but got %v",
+			want, gaps.MissingEpisodes)
+	}
+	tests := []struct {
+		name      string
+		got, want []Atom
+	}{
+		{"duplicates", ids(gaps.Duplicates), []Atom{4}},
+		{"unnumbered", ids(gaps.Unnumbered), []Atom{1}},
+		{"unaired", ids(gaps.Unaired), []Atom{7, 8}},
+		{"unrated", ids(gaps.Unrated), []Atom{1, 7, 8}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: expected %v but got %v",
+				test.name, test.want, test.got)
+		}
+	}
+	if gaps.Complete() {
+		t.Errorf("expected gaps to be incomplete")
+	}
+	if !findGaps(eps[1:3], 2010).Complete() {
+		t.Errorf("expected two numbered, rated episodes to be complete")
+	}
+}
@@ -0,0 +1,80 @@
+package imdb
+
+import (
+	"strings"
+	"unicode"
+)
+
+// FoldName returns a normalized version of a name that is suitable for
+// matching text typed in plain ASCII. Letters are lowercased, diacritics are
+// removed (e.g., "Amélie" becomes "amelie") and Greek and Cyrillic letters
+// are transliterated to Latin letters. Characters without a folding (like
+// punctuation, digits and the wildcards '%' and '_') are kept as they are.
+//
+// Folded names are stored in the 'name_fold' column of the 'name' table
+// when data is loaded. (Names loaded before the column existed have an empty
+// folded name until they are loaded again.)
+func FoldName(name string) string {
+	var buf []rune
+	changed := false
+	for _, r := range name {
+		if r < 0x80 {
+			if 'A' <= r && r <= 'Z' {
+				r += 'a' - 'A'
+				changed = true
+			}
+			buf = append(buf, r)
+			continue
+		}
+		changed = true
+		lower := unicode.ToLower(r)
+		if s, ok := foldings[lower]; ok {
+			buf = append(buf, []rune(s)...)
+		} else {
+			buf = append(buf, lower)
+		}
+	}
+	if !changed {
+		return name
+	}
+	return string(buf)
+}
+
+// foldings maps lowercase letters to their plain ASCII equivalents.
+var foldings = map[rune]string{}
+
+func init() {
+	// Each string has letters with diacritics followed by their folding.
+	latin := []string{
+		"àáâãäåāăą a", "çćĉċč c", "ďđ d", "èéêëēĕėęě e", "ĝğġģ g",
+		"ĥħ h", "ìíîïĩīĭįı i", "ĵ j", "ķ k", "ĺļľŀł l", "ñńņňŉ n",
+		"òóôõöøōŏő o", "ŕŗř r", "śŝşšș s", "ţťŧț t", "ùúûüũūŭůűų u",
+		"ŵ w", "ýÿŷ y", "źżž z",
+	}
+	for _, group := range latin {
+		fields := strings.Fields(group)
+		for _, r := range fields[0] {
+			foldings[r] = fields[1]
+		}
+	}
+	for r, s := range map[rune]string{
+		'æ': "ae", 'œ': "oe", 'ß': "ss", 'þ': "th", 'ð': "d",
+
+		'α': "a", 'ά': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e",
+		'έ': "e", 'ζ': "z", 'η': "i", 'ή': "i", 'θ': "th", 'ι': "i",
+		'ί': "i", 'ϊ': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n",
+		'ξ': "x", 'ο': "o", 'ό': "o", 'π': "p", 'ρ': "r", 'σ': "s",
+		'ς': "s", 'τ': "t", 'υ': "y", 'ύ': "y", 'ϋ': "y", 'φ': "f",
+		'χ': "ch", 'ψ': "ps", 'ω': "o", 'ώ': "o",
+
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e",
+		'ё': "e", 'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k",
+		'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+		'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+		'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+		'э': "e", 'ю': "yu", 'я': "ya", 'є': "ye", 'і': "i", 'ї': "yi",
+		'ґ': "g",
+	} {
+		foldings[r] = s
+	}
+}
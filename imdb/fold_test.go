@@ -0,0 +1,22 @@
+package imdb
+
+import (
+	"testing"
+)
+
+func TestFoldName(t *testing.T) {
+	tests := map[string]string{
+		"The Matrix":       "the matrix",
+		"Amélie":           "amelie",
+		"Å":                "a",
+		"Die Blechtrommel": "die blechtrommel",
+		"Straße %":         "strasse %",
+		"Солярис":          "solyaris",
+		"Ζορμπάς":          "zormpas",
+	}
+	for name, expect := range tests {
+		if got := FoldName(name); got != expect {
+			t.Errorf("FoldName(%q) = %q, expected %q", name, got, expect)
+		}
+	}
+}
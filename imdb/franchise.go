@@ -0,0 +1,254 @@
+package imdb
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/csql"
+)
+
+// Franchises are groups of movies in the same series (e.g., every James Bond
+// movie). IMDb has no such grouping, so it's guessed by BuildFranchises and
+// stored in the optional 'franchise' table, which has a row for every movie
+// in a franchise with the atom identifier of the franchise's first movie and
+// the name of the franchise.
+//
+// Movies are grouped when they're linked in the 'movie-links' list (one
+// follows or is a remake of the other), or when the title of one is the
+// title of another with a sequel number (e.g., 'Rocky II'), a part (e.g.,
+// 'Back to the Future Part II') or a subtitle (e.g., 'Star Wars: Episode V -
+// The Empire Strikes Back').
+
+// franchiseLinks are the types of links between movies in the same franchise.
+var franchiseLinks = []string{
+	"follows", "followed by", "remake of", "remade as",
+}
+
+// franchiseMovie is a movie considered by BuildFranchises.
+type franchiseMovie struct {
+	id    Atom
+	title string
+	year  int
+}
+
+// BuildFranchises fills the 'franchise' table with the movies in the
+// database, replacing anything already in it. It should be called after the
+// 'movies' or 'movie-links' lists are loaded. ('goim load' does this when the
+// table has been built before, or when asked to with '-franchises'.) It
+// returns the number of franchises found.
+func BuildFranchises(db *DB) (count int, err error) {
+	defer csql.Safe(&err)
+
+	var movies []franchiseMovie
+	rows := csql.Query(db, `
+		SELECT m.atom_id, name.name, m.year
+		FROM movie AS m
+		JOIN name ON m.atom_id = name.atom_id
+	`)
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var m franchiseMovie
+		csql.Scan(s, &m.id, &m.title, &m.year)
+		movies = append(movies, m)
+	})
+
+	var links [][2]Atom
+	var types []string
+	for _, t := range franchiseLinks {
+		types = append(types, "'"+t+"'")
+	}
+	rows = csql.Query(db, sf(`
+		SELECT atom_id, link_atom_id
+		FROM link
+		WHERE entity = 'movie' AND link_type IN (%s)
+	`, strings.Join(types, ", ")))
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var link [2]Atom
+		csql.Scan(s, &link[0], &link[1])
+		links = append(links, link)
+	})
+
+	franchises := clusterFranchises(movies, links)
+
+	csql.Panic(db.DropIndices("franchise"))
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	csql.Exec(tx, "DELETE FROM franchise")
+	ins, err := csql.NewInserter(tx, db.Driver, "franchise",
+		"atom_id", "franchise_id", "name")
+	csql.Panic(err)
+	for _, f := range franchises {
+		for _, id := range f.movies {
+			csql.Panic(ins.Exec(id, f.first, f.name))
+		}
+	}
+	csql.Panic(ins.Exec())
+	csql.Panic(tx.Commit())
+
+	csql.Panic(db.CreateIndices("franchise"))
+	return len(franchises), nil
+}
+
+// franchise is a group of movies found by clusterFranchises.
+type franchise struct {
+	first  Atom // the first movie released
+	name   string
+	movies []Atom
+}
+
+// clusterFranchises groups movies into franchises with the links given and
+// by their titles. Only groups with more than one movie are returned, in the
+// order of their first movie's atom identifier.
+func clusterFranchises(movies []franchiseMovie, links [][2]Atom) []franchise {
+	byId := make(map[Atom]franchiseMovie, len(movies))
+	parent := make(map[Atom]Atom, len(movies))
+	for _, m := range movies {
+		byId[m.id] = m
+		parent[m.id] = m.id
+	}
+	var find func(id Atom) Atom
+	find = func(id Atom) Atom {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+	union := func(a, b Atom) {
+		if _, ok := parent[a]; !ok {
+			return
+		}
+		if _, ok := parent[b]; !ok {
+			return
+		}
+		parent[find(a)] = find(b)
+	}
+
+	for _, link := range links {
+		union(link[0], link[1])
+	}
+
+	// A movie with a sequel number, part or subtitle belongs with the latest
+	// movie released before it whose title is the title without them. (The
+	// latest, since there may be many unrelated movies with the same title.)
+	bases := make(map[string][]franchiseMovie)
+	for _, m := range movies {
+		key := FoldName(strings.TrimSpace(m.title))
+		bases[key] = append(bases[key], m)
+	}
+	for _, m := range movies {
+		base, ok := seriesTitle(m.title)
+		if !ok || m.year == 0 {
+			continue
+		}
+		var found *franchiseMovie
+		for i, b := range bases[FoldName(base)] {
+			if b.year == 0 || b.year > m.year {
+				continue
+			}
+			if found == nil || b.year > found.year {
+				found = &bases[FoldName(base)][i]
+			}
+		}
+		if found != nil {
+			union(m.id, found.id)
+		}
+	}
+
+	groups := make(map[Atom][]Atom)
+	for _, m := range movies {
+		root := find(m.id)
+		groups[root] = append(groups[root], m.id)
+	}
+	var franchises []franchise
+	for _, ids := range groups {
+		if len(ids) < 2 {
+			continue
+		}
+		first := byId[ids[0]]
+		for _, id := range ids[1:] {
+			m := byId[id]
+			if firstReleased(m, first) {
+				first = m
+			}
+		}
+		name := first.title
+		if base, ok := seriesTitle(first.title); ok {
+			name = base
+		}
+		sort.Sort(atomsSorted(ids))
+		franchises = append(franchises, franchise{first.id, name, ids})
+	}
+	sort.Sort(franchisesSorted(franchises))
+	return franchises
+}
+
+// firstReleased returns true if m1 was released before m2. Movies without a
+// year come last, and ties are broken by atom identifier.
+func firstReleased(m1, m2 franchiseMovie) bool {
+	switch {
+	case m1.year == m2.year:
+		return m1.id < m2.id
+	case m1.year == 0:
+		return false
+	case m2.year == 0:
+		return true
+	}
+	return m1.year < m2.year
+}
+
+// seriesTitle returns the title of the series that a movie is part of, if its
+// title has a subtitle (after a colon), a sequel number (like '2' or 'II') or
+// a part (like 'Part 2'). Otherwise, it returns false.
+func seriesTitle(title string) (string, bool) {
+	title = strings.TrimSpace(title)
+	if i := strings.Index(title, ": "); i > 0 {
+		return strings.TrimSpace(title[:i]), true
+	}
+	fields := strings.Fields(title)
+	if len(fields) < 2 {
+		return "", false
+	}
+	last := fields[len(fields)-1]
+	if len(fields) >= 3 {
+		before := strings.ToLower(fields[len(fields)-2])
+		if before == "part" || before == "chapter" || before == "vol." {
+			return strings.Join(fields[:len(fields)-2], " "), true
+		}
+	}
+	if n, err := strconv.Atoi(last); err == nil && n >= 2 && n < 100 {
+		return strings.Join(fields[:len(fields)-1], " "), true
+	}
+	if romanSequel(last) {
+		return strings.Join(fields[:len(fields)-1], " "), true
+	}
+	return "", false
+}
+
+// romanSequel returns true if s is a Roman numeral from II to XX.
+func romanSequel(s string) bool {
+	for _, numeral := range []string{
+		"II", "III", "IV", "V", "VI", "VII", "VIII", "IX", "X",
+		"XI", "XII", "XIII", "XIV", "XV", "XVI", "XVII", "XVIII", "XIX", "XX",
+	} {
+		if s == numeral {
+			return true
+		}
+	}
+	return false
+}
+
+type atomsSorted []Atom
+
+func (as atomsSorted) Len() int           { return len(as) }
+func (as atomsSorted) Swap(i, j int)      { as[i], as[j] = as[j], as[i] }
+func (as atomsSorted) Less(i, j int) bool { return as[i] < as[j] }
+
+type franchisesSorted []franchise
+
+func (fs franchisesSorted) Len() int      { return len(fs) }
+func (fs franchisesSorted) Swap(i, j int) { fs[i], fs[j] = fs[j], fs[i] }
+func (fs franchisesSorted) Less(i, j int) bool {
+	return fs[i].first < fs[j].first
+}
@@ -0,0 +1,47 @@
+package imdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeriesTitle(t *testing.T) {
+	tests := []struct {
+		title, series string
+	}{
+		{"Rocky II", "Rocky"},
+		{"Saw 3", "Saw"},
+		{"Back to the Future Part II", "Back to the Future"},
+		{"Star Wars: Episode V - The Empire Strikes Back", "Star Wars"},
+		{"Rocky", ""},
+		{"Apollo 1000", ""},
+		{"The Godfather", ""},
+	}
+	for _, test := range tests {
+		series, ok := seriesTitle(test.title)
+		if ok != (len(test.series) > 0) || series != test.series {
+			t.Errorf("seriesTitle(%q): expected %q but got %q (%v)",
+				test.title, test.series, series, ok)
+		}
+	}
+}
+
+func TestClusterFranchises(t *testing.T) {
+	movies := []franchiseMovie{
+		{1, "Rocky", 1976},
+		{2, "Rocky II", 1979},
+		{3, "Rocky", 1950}, // an older movie with the same title
+		{4, "Dr. No", 1962},
+		{5, "From Russia with Love", 1963},
+		{6, "Goldfinger", 1964},
+		{7, "The Godfather", 1972},
+	}
+	links := [][2]Atom{{5, 4}, {6, 5}, {5, 99}}
+	want := []franchise{
+		{1, "Rocky", []Atom{1, 2}},
+		{4, "Dr. No", []Atom{4, 5, 6}},
+	}
+	if got := clusterFranchises(movies, links); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v but got %v", want, got)
+	}
+}
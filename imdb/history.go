@@ -0,0 +1,94 @@
+package imdb
+
+import (
+	"time"
+
+	"github.com/BurntSushi/csql"
+)
+
+// HistoryEntry is a search query that was executed and recorded with
+// AddHistory, along with the result that was chosen (if any).
+type HistoryEntry struct {
+	Id       int
+	Query    string
+	Searched time.Time
+
+	// Entity and Chosen identify the result that was chosen. When no result
+	// was chosen (e.g., when all results were listed), Chosen is 0.
+	Entity EntityKind
+	Chosen Atom
+}
+
+// AddHistory records the query given in the search history. If a result was
+// chosen, then its entity kind and atom identifier should be given.
+// Otherwise, chosen should be 0.
+func (db *DB) AddHistory(
+	query string,
+	ent EntityKind,
+	chosen Atom,
+) (err error) {
+	defer csql.Safe(&err)
+
+	var entity string
+	if chosen > 0 {
+		entity = ent.String()
+	}
+	csql.Exec(db, `
+		INSERT INTO search_history (query, entity, atom_id, searched)
+		VALUES ($1, $2, $3, $4)
+	`, query, entity, chosen, time.Now().UTC())
+	return
+}
+
+// History returns the most recent entries in the search history, starting
+// with the most recent. At most limit entries are returned. If limit is
+// negative, then all entries are returned.
+func (db *DB) History(limit int) (entries []HistoryEntry, err error) {
+	defer csql.Safe(&err)
+
+	q := `
+		SELECT id, query, entity, atom_id, searched
+		FROM search_history
+		ORDER BY id DESC
+	`
+	if limit >= 0 {
+		q += sf("LIMIT %d", limit)
+	}
+	rows := csql.Query(db, q)
+	csql.ForRow(rows, func(rs csql.RowScanner) {
+		var e HistoryEntry
+		var entity string
+		csql.Scan(rs, &e.Id, &e.Query, &entity, &e.Chosen, &e.Searched)
+		if e.Chosen > 0 {
+			e.Entity = entityKindFromString(entity)
+		}
+		entries = append(entries, e)
+	})
+	return
+}
+
+// HistoryEntry returns the entry in the search history with the identifier
+// given.
+func (db *DB) HistoryEntry(id int) (e HistoryEntry, err error) {
+	var entity string
+	r := db.QueryRow(`
+		SELECT id, query, entity, atom_id, searched
+		FROM search_history
+		WHERE id = $1
+	`, id)
+	err = r.Scan(&e.Id, &e.Query, &entity, &e.Chosen, &e.Searched)
+	if err != nil {
+		return e, ef("Could not find search history entry %d: %s", id, err)
+	}
+	if e.Chosen > 0 {
+		e.Entity = entityKindFromString(entity)
+	}
+	return
+}
+
+// ClearHistory removes every entry from the search history.
+func (db *DB) ClearHistory() (err error) {
+	defer csql.Safe(&err)
+	csql.Exec(db, "DELETE FROM search_history")
+	return
+}
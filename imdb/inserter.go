@@ -0,0 +1,354 @@
+package imdb
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// maxInsertParams is the number of parameters allowed in one statement by
+// older versions of SQLite. The default batch size of an Inserter keeps
+// below it.
+const maxInsertParams = 999
+
+// InsertOptions tunes an Inserter. The zero value uses the defaults.
+type InsertOptions struct {
+	// BatchSize is the number of rows sent to the database in each INSERT
+	// statement. When it's 0, as many rows as fit in 999 parameters are
+	// sent. With SQLite, it's never more than that.
+	BatchSize int
+
+	// Async makes full batches get inserted in a goroutine of their own, so
+	// that the caller can keep adding rows while the database works. At most
+	// one batch is inserted at a time, so rows are still inserted in order.
+	Async bool
+
+	// Retries is the number of times a batch is retried when it fails
+	// because of a deadlock or (for SQLite) a locked database. When it's 0,
+	// a batch is retried 5 times. A negative value means never.
+	Retries int
+}
+
+// Inserter adds rows to a table in batches, with one multi-row INSERT
+// statement per batch. It's meant for adding lots of rows at once (like
+// loading a list), where one bad row shouldn't stop the rest from being
+// added.
+//
+// When a batch fails because some of its rows are bad (e.g., they violate a
+// constraint), its rows are inserted one at a time so that the good rows are
+// kept, and the bad rows are returned in a *BatchError. The Inserter may
+// still be used after a *BatchError. Any other error (including the context
+// being canceled) is returned by every call after it.
+//
+// With PostgreSQL, each batch is inserted in a savepoint, since any failed
+// statement aborts the rest of a PostgreSQL transaction. SQLite only rolls
+// back the failed statement. DuckDB has neither, so every error from it is
+// final.
+//
+// An Inserter may not be used by more than one goroutine at a time, and its
+// transaction must not be used by anything else until Flush returns.
+type Inserter struct {
+	ctx     context.Context
+	tx      *sql.Tx
+	driver  string
+	table   string
+	columns []string
+	opts    InsertOptions
+
+	rows    [][]interface{}
+	pending chan error // the result of an asynchronous flush
+	err     error
+}
+
+// BatchError is returned by an Inserter when some rows couldn't be added to
+// its table. The rest of the rows in the same batch were added.
+type BatchError struct {
+	Table string
+	Rows  []BadRow
+}
+
+// BadRow is a row that couldn't be added, along with why.
+type BadRow struct {
+	Values []interface{}
+	Err    error
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Rows) == 1 {
+		return sf("1 row could not be added to %s: %s",
+			e.Table, e.Rows[0].Err)
+	}
+	return sf("%d rows could not be added to %s (first error: %s)",
+		len(e.Rows), e.Table, e.Rows[0].Err)
+}
+
+// NewInserter returns an Inserter that adds rows with the columns given to a
+// table in the transaction given. Once the context is done, nothing more is
+// inserted.
+func NewInserter(
+	ctx context.Context,
+	tx *sql.Tx,
+	driver, table string,
+	opts InsertOptions,
+	columns ...string,
+) (*Inserter, error) {
+	if len(columns) == 0 {
+		return nil, ef("An inserter for %s needs at least one column.", table)
+	}
+	maxRows := maxInsertParams / len(columns)
+	if maxRows == 0 {
+		maxRows = 1
+	}
+	if opts.BatchSize <= 0 ||
+		(driver == "sqlite3" && opts.BatchSize > maxRows) {
+		opts.BatchSize = maxRows
+	}
+	if opts.Retries == 0 {
+		opts.Retries = 5
+	}
+	return &Inserter{
+		ctx:     ctx,
+		tx:      tx,
+		driver:  driver,
+		table:   table,
+		columns: columns,
+		opts:    opts,
+		rows:    make([][]interface{}, 0, opts.BatchSize),
+	}, nil
+}
+
+// BatchSize returns the number of rows sent to the database in each INSERT
+// statement.
+func (ins *Inserter) BatchSize() int {
+	return ins.opts.BatchSize
+}
+
+// Exec adds a row to the buffer, and inserts the buffer once it's full. The
+// number of values given must match the number of columns. As with
+// csql.Inserter, calling Exec with no values is the same as calling Flush.
+//
+// When the buffer is inserted asynchronously, the error returned is from
+// inserting the previous batch. Either way, the row given is kept unless
+// the error is final.
+func (ins *Inserter) Exec(values ...interface{}) error {
+	if len(values) == 0 {
+		return ins.Flush()
+	}
+	if ins.err != nil {
+		return ins.err
+	}
+	if len(values) != len(ins.columns) {
+		return ef("Expected %d values for %s but got %d.",
+			len(ins.columns), ins.table, len(values))
+	}
+	ins.rows = append(ins.rows, values)
+	if len(ins.rows) < ins.opts.BatchSize {
+		return nil
+	}
+	if ins.opts.Async {
+		return ins.flushAsync()
+	}
+	return ins.flush()
+}
+
+// Flush inserts every row in the buffer, after waiting for an asynchronous
+// insert in progress (if any). Its error is that of the first insert that
+// failed.
+func (ins *Inserter) Flush() error {
+	err := ins.wait()
+	if ferr := ins.flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// flush inserts the rows in the buffer in the current goroutine.
+func (ins *Inserter) flush() error {
+	if ins.err != nil {
+		return ins.err
+	}
+	if len(ins.rows) == 0 {
+		return nil
+	}
+	rows := ins.rows
+	ins.rows = make([][]interface{}, 0, ins.opts.BatchSize)
+	return ins.finish(ins.insert(rows))
+}
+
+// flushAsync starts inserting the rows in the buffer in another goroutine,
+// once the previous asynchronous insert is done. It returns the error of the
+// previous insert.
+func (ins *Inserter) flushAsync() error {
+	err := ins.wait()
+	if ins.err != nil {
+		return ins.err
+	}
+	rows := ins.rows
+	ins.rows = make([][]interface{}, 0, ins.opts.BatchSize)
+	ins.pending = make(chan error, 1)
+	go func(pending chan<- error) {
+		pending <- ins.insert(rows)
+	}(ins.pending)
+	return err
+}
+
+// wait waits for an asynchronous insert in progress and returns its error.
+func (ins *Inserter) wait() error {
+	if ins.pending == nil {
+		return nil
+	}
+	err := <-ins.pending
+	ins.pending = nil
+	return ins.finish(err)
+}
+
+// finish records the error given if it's final, and returns it.
+func (ins *Inserter) finish(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*BatchError); !ok {
+		ins.err = err
+	}
+	return err
+}
+
+// insert adds the rows given. If the batch fails and its rows can be tried
+// on their own, the rows that fail again are returned in a *BatchError.
+func (ins *Inserter) insert(rows [][]interface{}) error {
+	err := ins.retry(rows)
+	if err == nil || ins.driver == "duckdb" || ins.ctx.Err() != nil {
+		return err
+	}
+	if isTransient(err) {
+		return ef("Could not add %d rows to %s: %s", len(rows), ins.table, err)
+	}
+	if len(rows) == 1 {
+		return &BatchError{ins.table, []BadRow{{rows[0], err}}}
+	}
+
+	berr := &BatchError{Table: ins.table}
+	for _, row := range rows {
+		err := ins.retry([][]interface{}{row})
+		if err == nil {
+			continue
+		}
+		if ins.ctx.Err() != nil || isTransient(err) {
+			return err
+		}
+		berr.Rows = append(berr.Rows, BadRow{row, err})
+	}
+	if len(berr.Rows) == 0 {
+		return nil
+	}
+	return berr
+}
+
+// retry inserts the rows given, and tries again with a growing delay when
+// the insert fails because of a deadlock or a locked database.
+func (ins *Inserter) retry(rows [][]interface{}) error {
+	delay := 50 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		if err := ins.ctx.Err(); err != nil {
+			return err
+		}
+		err := ins.execSaved(rows)
+		if err == nil || !isTransient(err) || attempt >= ins.opts.Retries {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ins.ctx.Done():
+			return ins.ctx.Err()
+		}
+	}
+}
+
+// execSaved inserts the rows given, in a savepoint when the database needs
+// one to recover from a failed statement.
+func (ins *Inserter) execSaved(rows [][]interface{}) error {
+	if ins.driver != "postgres" {
+		return ins.exec(rows)
+	}
+	_, err := ins.tx.ExecContext(ins.ctx, "SAVEPOINT goim_insert")
+	if err != nil {
+		return err
+	}
+	if err := ins.exec(rows); err != nil {
+		_, rerr := ins.tx.ExecContext(ins.ctx,
+			"ROLLBACK TO SAVEPOINT goim_insert")
+		if rerr != nil {
+			return ef("Could not recover from '%s': %s", err, rerr)
+		}
+		return err
+	}
+	_, err = ins.tx.ExecContext(ins.ctx, "RELEASE SAVEPOINT goim_insert")
+	return err
+}
+
+// exec inserts the rows given with one statement.
+func (ins *Inserter) exec(rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(rows)*len(ins.columns))
+	for _, row := range rows {
+		args = append(args, row...)
+	}
+	_, err := ins.tx.ExecContext(ins.ctx, ins.query(len(rows)), args...)
+	return err
+}
+
+// query returns the INSERT statement for a batch of n rows.
+func (ins *Inserter) query(n int) string {
+	var buf bytes.Buffer
+	buf.WriteString(sf("INSERT INTO %s (%s) VALUES ",
+		ins.table, strings.Join(ins.columns, ", ")))
+	param := 1
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteByte('(')
+		for j := range ins.columns {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			if ins.driver == "postgres" {
+				buf.WriteString(sf("$%d", param))
+			} else {
+				buf.WriteByte('?')
+			}
+			param++
+		}
+		buf.WriteByte(')')
+	}
+	return buf.String()
+}
+
+// isTransient returns true if the error given means that an insert may
+// succeed when it's tried again: a deadlock or serialization failure in
+// PostgreSQL, or a locked database in SQLite.
+func isTransient(err error) bool {
+	if state, ok := err.(interface {
+		SQLState() string
+	}); ok {
+		code := state.SQLState()
+		return code == "40P01" || code == "40001"
+	}
+	msg := err.Error()
+	for _, s := range []string{
+		"deadlock detected",
+		"could not serialize access",
+		"database is locked",
+		"database table is locked",
+	} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package imdb
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func testInserter(
+	t *testing.T,
+	ctx context.Context,
+	opts InsertOptions,
+) (*Inserter, *sql.Tx) {
+	db, err := sql.Open("goim-fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, err := NewInserter(ctx, tx, "postgres", "name", opts, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ins, tx
+}
+
+func TestInserterBadRows(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		testDriver.reset(0)
+		ins, tx := testInserter(t, context.Background(),
+			InsertOptions{BatchSize: 3, Async: async})
+
+		var bad []BadRow
+		check := func(err error) {
+			if err == nil {
+				return
+			}
+			berr, ok := err.(*BatchError)
+			if !ok {
+				t.Fatalf("expected a *BatchError but got %v", err)
+			}
+			bad = append(bad, berr.Rows...)
+		}
+		for _, v := range []string{"a", "bad", "b", "c", "d", "bad", "e"} {
+			check(ins.Exec(v))
+		}
+		check(ins.Exec())
+		tx.Commit()
+
+		got := strings.Join(testDriver.inserted(), " ")
+		if got != "a b c d e" {
+			t.Errorf("async %v: inserted %q, want %q", async, got, "a b c d e")
+		}
+		if len(bad) != 2 || bad[0].Values[0] != "bad" {
+			t.Errorf("async %v: expected 2 bad rows but got %v", async, bad)
+		}
+		if err := ins.Exec("f"); err != nil {
+			t.Errorf("async %v: inserter stopped after bad rows: %s",
+				async, err)
+		}
+	}
+}
+
+func TestInserterRetry(t *testing.T) {
+	testDriver.reset(2)
+	ins, tx := testInserter(t, context.Background(), InsertOptions{})
+	defer tx.Commit()
+	ins.Exec("a")
+	ins.Exec("b")
+	if err := ins.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := testDriver.inserted(); len(got) != 2 {
+		t.Errorf("expected 2 rows after retrying but got %v", got)
+	}
+
+	testDriver.reset(2)
+	ins, tx = testInserter(t, context.Background(),
+		InsertOptions{Retries: -1})
+	defer tx.Commit()
+	ins.Exec("a")
+	err := ins.Flush()
+	if err == nil || !isTransient(err) {
+		t.Fatalf("expected a deadlock but got %v", err)
+	}
+	if err2 := ins.Exec("b"); err2 != err {
+		t.Errorf("expected the deadlock to be final but got %v", err2)
+	}
+}
+
+func TestInserterCanceled(t *testing.T) {
+	testDriver.reset(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	ins, tx := testInserter(t, ctx, InsertOptions{BatchSize: 2})
+	defer tx.Rollback()
+	if err := ins.Exec("a"); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := ins.Exec("b"); err != context.Canceled {
+		t.Fatalf("expected context.Canceled but got %v", err)
+	}
+	if got := testDriver.inserted(); len(got) > 0 {
+		t.Errorf("rows were inserted after canceling: %v", got)
+	}
+}
+
+func TestInserterQuery(t *testing.T) {
+	ins := &Inserter{driver: "postgres", table: "movie",
+		columns: []string{"atom_id", "year"}}
+	want := "INSERT INTO movie (atom_id, year) VALUES ($1, $2), ($3, $4)"
+	if got := ins.query(2); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	ins.driver = "sqlite3"
+	want = "INSERT INTO movie (atom_id, year) VALUES (?, ?), (?, ?)"
+	if got := ins.query(2); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInserterBatchSize(t *testing.T) {
+	cols := []string{"atom_id", "name", "name_fold"}
+	tests := []struct {
+		driver    string
+		batchSize int
+		want      int
+	}{
+		{"sqlite3", 0, 333},
+		{"sqlite3", 100, 100},
+		{"sqlite3", 500, 333}, // 1500 parameters is too many for SQLite
+		{"postgres", 500, 500},
+	}
+	for _, test := range tests {
+		ins, err := NewInserter(context.Background(), nil, test.driver,
+			"name", InsertOptions{BatchSize: test.batchSize}, cols...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ins.BatchSize(); got != test.want {
+			t.Errorf("%s with %d rows: got batches of %d, want %d",
+				test.driver, test.batchSize, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package imdb
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+// JSONSnakeCase controls the keys used when entities and attributes in this
+// package (and search results) are encoded as JSON. By default, keys are in
+// camelCase (e.g., "episodeNum"). When JSONSnakeCase is true, keys are in
+// snake_case (e.g., "episode_num").
+//
+// The keys are fixed by this package and do not change when Go fields are
+// renamed, so they are safe to rely on in other languages.
+//
+// It should only be set before anything is encoded, since it isn't safe to
+// change while other goroutines encode entities.
+var JSONSnakeCase = false
+
+// MarshalFields encodes a JSON object from alternating keys and values. Keys
+// must be strings in camelCase; they are converted to snake_case when
+// JSONSnakeCase is true. Values are encoded with encoding/json.
+//
+// This is used to implement MarshalJSON for types in this package and may be
+// used by other packages to encode their own types consistently.
+func MarshalFields(keyvals ...interface{}) ([]byte, error) {
+	if len(keyvals)%2 != 0 {
+		return nil, ef("MarshalFields needs an even number of arguments")
+	}
+	obj := make(map[string]interface{}, len(keyvals)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok {
+			return nil, ef("JSON key %v is not a string", keyvals[i])
+		}
+		obj[jsonKey(key)] = keyvals[i+1]
+	}
+	return json.Marshal(obj)
+}
+
+// jsonKey converts a camelCase key to snake_case if JSONSnakeCase is set.
+func jsonKey(camel string) string {
+	if !JSONSnakeCase {
+		return camel
+	}
+	var buf []rune
+	for _, r := range camel {
+		if unicode.IsUpper(r) {
+			buf = append(buf, '_', unicode.ToLower(r))
+		} else {
+			buf = append(buf, r)
+		}
+	}
+	return strings.TrimPrefix(string(buf), "_")
+}
+
+// MarshalText encodes an entity kind as its name, e.g., "movie". This makes
+// entity kinds appear as strings in JSON.
+func (e EntityKind) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText decodes an entity kind from its name.
+func (e *EntityKind) UnmarshalText(text []byte) error {
+	ent, ok := Entities[string(text)]
+	if !ok {
+		return ef("Unrecognized entity '%s'", text)
+	}
+	*e = ent
+	return nil
+}
+
+func (e *Movie) MarshalJSON() ([]byte, error) {
+	return MarshalFields(
+		"entity", EntityMovie,
+		"id", e.Id,
+		"title", e.Title,
+		"year", e.Year,
+		"sequence", e.Sequence,
+		"tv", e.Tv,
+		"video", e.Video,
+	)
+}
+
+func (e *Tvshow) MarshalJSON() ([]byte, error) {
+	return MarshalFields(
+		"entity", EntityTvshow,
+		"id", e.Id,
+		"title", e.Title,
+		"year", e.Year,
+		"sequence", e.Sequence,
+		"yearStart", e.YearStart,
+		"yearEnd", e.YearEnd,
+	)
+}
+
+func (e *Episode) MarshalJSON() ([]byte, error) {
+	return MarshalFields(
+		"entity", EntityEpisode,
+		"id", e.Id,
+		"tvshowId", e.TvshowId,
+		"title", e.Title,
+		"year", e.Year,
+		"season", e.Season,
+		"episodeNum", e.EpisodeNum,
+	)
+}
+
+func (e *Actor) MarshalJSON() ([]byte, error) {
+	return MarshalFields(
+		"entity", EntityActor,
+		"id", e.Id,
+		"fullName", e.FullName,
+		"sequence", e.Sequence,
+	)
+}
+
+func (r UserRank) MarshalJSON() ([]byte, error) {
+	return MarshalFields("votes", r.Votes, "rank", r.Rank)
+}
+
+func (s RatingSnapshot) MarshalJSON() ([]byte, error) {
+	return MarshalFields(
+		"generation", s.Generation,
+		"recorded", s.Recorded,
+		"rank", s.Rank,
+	)
+}
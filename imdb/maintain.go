@@ -0,0 +1,53 @@
+package imdb
+
+import (
+	"github.com/BurntSushi/csql"
+)
+
+// The methods in this file run maintenance that databases need after large
+// changes, like loading lists. They bypass the statement cache (see Options),
+// since maintenance commands can't always be prepared.
+
+// Analyze updates the statistics that the database uses to plan queries for
+// the tables given, or for every table if none are given. Without current
+// statistics, queries on freshly loaded tables can be very slow.
+func (db *DB) Analyze(tables ...string) (err error) {
+	defer csql.Safe(&err)
+
+	if len(tables) == 0 {
+		csql.Exec(db.DB, "ANALYZE")
+		return
+	}
+	for _, table := range tables {
+		csql.Exec(db.DB, "ANALYZE "+table)
+	}
+	return
+}
+
+// Vacuum reclaims the space left behind by deleted rows. On SQLite, this
+// rebuilds the entire database file (which temporarily needs up to twice
+// its size in disk space). On PostgreSQL, this also updates the visibility
+// map of each table, which lets queries use index-only scans.
+func (db *DB) Vacuum() (err error) {
+	defer csql.Safe(&err)
+	csql.Exec(db.DB, "VACUUM")
+	return
+}
+
+// Reindex rebuilds every index on the tables given. This is useful for
+// tables that were changed a lot without dropping their indices first, which
+// leaves indices bloated.
+func (db *DB) Reindex(tables ...string) (err error) {
+	defer csql.Safe(&err)
+
+	for _, table := range tables {
+		if db.Driver == "postgres" {
+			for _, t := range db.reindexTables(table) {
+				csql.Exec(db.DB, "REINDEX TABLE "+t)
+			}
+		} else {
+			csql.Exec(db.DB, "REINDEX "+table)
+		}
+	}
+	return
+}
@@ -161,6 +161,189 @@ var migrations = map[string][]migration.Migrator{
 				`)
 			return err
 		},
+		exec(`
+				CREATE TABLE overlay (
+					namespace TEXT NOT NULL,
+					atom_id INTEGER NOT NULL,
+					tag TEXT NOT NULL,
+					value TEXT NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE xref (
+					atom_id INTEGER NOT NULL,
+					source TEXT NOT NULL,
+					id TEXT NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE external (
+					source TEXT NOT NULL,
+					query TEXT NOT NULL,
+					entity TEXT NOT NULL,
+					id TEXT NOT NULL,
+					title TEXT NOT NULL,
+					year INTEGER NOT NULL,
+					imdb_id TEXT NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE artwork (
+					atom_id INTEGER NOT NULL,
+					kind TEXT NOT NULL,
+					url TEXT NOT NULL,
+					source TEXT NOT NULL
+				);
+			`),
+		exec(`
+				ALTER TABLE credit ADD COLUMN role TEXT NOT NULL DEFAULT 'actor';
+			`),
+		exec(`
+				ALTER TABLE episode ADD COLUMN abs_num INTEGER NOT NULL DEFAULT 0;
+			`),
+		exec(`
+				CREATE TABLE generation (
+					number INTEGER NOT NULL
+				);
+				INSERT INTO generation (number) VALUES (0);
+			`),
+		exec(`
+				CREATE TABLE saved_search (
+					name TEXT PRIMARY KEY,
+					query TEXT NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE search_history (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					query TEXT NOT NULL,
+					entity TEXT NOT NULL,
+					atom_id INTEGER NOT NULL,
+					searched TIMESTAMP NOT NULL
+				);
+			`),
+		exec(`
+				ALTER TABLE name ADD COLUMN name_fold TEXT NOT NULL DEFAULT '';
+			`),
+		exec(`
+				CREATE TABLE search_index (
+					atom_id INTEGER NOT NULL,
+					entity TEXT NOT NULL,
+					name TEXT NOT NULL,
+					name_fold TEXT NOT NULL,
+					year INTEGER NOT NULL,
+					attrs TEXT NOT NULL,
+					votes INTEGER,
+					rank INTEGER
+				);
+			`),
+		exec(`
+				CREATE TABLE load_checkpoint (
+					name TEXT PRIMARY KEY,
+					row_count INTEGER NOT NULL,
+					updated TIMESTAMP NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE load_state (
+					name TEXT PRIMARY KEY,
+					etag TEXT NOT NULL,
+					last_modified TEXT NOT NULL,
+					loaded TIMESTAMP NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE entity_version (
+					entity TEXT NOT NULL,
+					atom_id INTEGER NOT NULL,
+					checksum INTEGER NOT NULL,
+					PRIMARY KEY (entity, atom_id)
+				);
+				CREATE TABLE change_log (
+					generation INTEGER NOT NULL,
+					entity TEXT NOT NULL,
+					atom_id INTEGER NOT NULL,
+					change TEXT NOT NULL
+						CHECK (change = 'added'
+						       OR change = 'updated'
+						       OR change = 'removed')
+				);
+				CREATE INDEX IF NOT EXISTS idx_change_log_generation
+					ON change_log (generation);
+				CREATE TABLE change_tracking (
+					entity TEXT PRIMARY KEY,
+					since INTEGER NOT NULL
+				);
+			`),
+		exec(`
+				ALTER TABLE generation ADD COLUMN loaded TIMESTAMP;
+				ALTER TABLE generation ADD COLUMN dataset DATE;
+			`),
+		exec(`
+				CREATE TABLE biography (
+					atom_id INTEGER NOT NULL,
+					birth_year SMALLINT NOT NULL,
+					born TEXT NOT NULL,
+					death_year SMALLINT NOT NULL,
+					died TEXT NOT NULL,
+					PRIMARY KEY (atom_id)
+				);
+			`),
+		exec(`
+				ALTER TABLE credit ADD COLUMN source TEXT NOT NULL DEFAULT '';
+			`),
+		exec(`
+				CREATE TABLE franchise (
+					atom_id INTEGER NOT NULL,
+					franchise_id INTEGER NOT NULL,
+					name TEXT NOT NULL,
+					PRIMARY KEY (atom_id)
+				);
+			`),
+		exec(`
+				CREATE TABLE list_generation (
+					name TEXT PRIMARY KEY,
+					generation INTEGER NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE rating_history (
+					generation INTEGER NOT NULL,
+					atom_id INTEGER NOT NULL,
+					votes INTEGER NOT NULL,
+					rank INTEGER NOT NULL,
+					recorded TIMESTAMP NOT NULL,
+					PRIMARY KEY (atom_id, generation)
+				);
+			`),
+		// Unlike PostgreSQL, the name and rating tables were created without
+		// primary keys. SQLite can't add a primary key to a table, so the
+		// tables are rebuilt with one.
+		func(tx migration.LimitedTx) error {
+			err := sqliteRebuild(tx, "name", `
+				atom_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				name_fold TEXT NOT NULL DEFAULT '',
+				PRIMARY KEY (atom_id)
+			`)
+			if err != nil {
+				return err
+			}
+			return sqliteRebuild(tx, "rating", `
+				atom_id INTEGER NOT NULL,
+				votes INTEGER NOT NULL,
+				rank INTEGER NOT NULL,
+				PRIMARY KEY (atom_id)
+			`)
+		},
+		exec(`
+				CREATE INDEX IF NOT EXISTS idx_rating_history_generation
+					ON rating_history (generation);
+			`),
+		exec(`
+				ALTER TABLE load_checkpoint
+					ADD COLUMN version TEXT NOT NULL DEFAULT '';
+			`),
 	},
 	"postgres": {
 		func(tx migration.LimitedTx) error {
@@ -309,7 +492,239 @@ var migrations = map[string][]migration.Migrator{
 				`)
 			return err
 		},
+		exec(`
+				CREATE TABLE overlay (
+					namespace TEXT NOT NULL,
+					atom_id INTEGER NOT NULL,
+					tag TEXT NOT NULL,
+					value TEXT NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE xref (
+					atom_id INTEGER NOT NULL,
+					source TEXT NOT NULL,
+					id TEXT NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE external (
+					source TEXT NOT NULL,
+					query TEXT NOT NULL,
+					entity TEXT NOT NULL,
+					id TEXT NOT NULL,
+					title TEXT NOT NULL,
+					year INTEGER NOT NULL,
+					imdb_id TEXT NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE artwork (
+					atom_id INTEGER NOT NULL,
+					kind TEXT NOT NULL,
+					url TEXT NOT NULL,
+					source TEXT NOT NULL
+				);
+			`),
+		exec(`
+				ALTER TABLE credit ADD COLUMN role TEXT NOT NULL DEFAULT 'actor';
+			`),
+		exec(`
+				ALTER TABLE episode ADD COLUMN abs_num INTEGER NOT NULL DEFAULT 0;
+			`),
+		exec(`
+				CREATE TABLE generation (
+					number INTEGER NOT NULL
+				);
+				INSERT INTO generation (number) VALUES (0);
+			`),
+		exec(`
+				CREATE TABLE saved_search (
+					name TEXT PRIMARY KEY,
+					query TEXT NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE search_history (
+					id SERIAL PRIMARY KEY,
+					query TEXT NOT NULL,
+					entity TEXT NOT NULL,
+					atom_id INTEGER NOT NULL,
+					searched TIMESTAMP WITH TIME ZONE NOT NULL
+				);
+			`),
+		exec(`
+				ALTER TABLE name ADD COLUMN name_fold TEXT NOT NULL DEFAULT '';
+			`),
+		exec(`
+				CREATE TABLE search_index (
+					atom_id INTEGER NOT NULL,
+					entity TEXT NOT NULL,
+					name TEXT NOT NULL,
+					name_fold TEXT NOT NULL,
+					year INTEGER NOT NULL,
+					attrs TEXT NOT NULL,
+					votes INTEGER,
+					rank INTEGER
+				);
+			`),
+		exec(`
+				CREATE TABLE load_checkpoint (
+					name TEXT PRIMARY KEY,
+					row_count INTEGER NOT NULL,
+					updated TIMESTAMP WITH TIME ZONE NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE load_state (
+					name TEXT PRIMARY KEY,
+					etag TEXT NOT NULL,
+					last_modified TEXT NOT NULL,
+					loaded TIMESTAMP WITH TIME ZONE NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE entity_version (
+					entity TEXT NOT NULL,
+					atom_id INTEGER NOT NULL,
+					checksum INTEGER NOT NULL,
+					PRIMARY KEY (entity, atom_id)
+				);
+				CREATE TABLE change_log (
+					generation INTEGER NOT NULL,
+					entity TEXT NOT NULL,
+					atom_id INTEGER NOT NULL,
+					change TEXT NOT NULL
+						CHECK (change = 'added'
+						       OR change = 'updated'
+						       OR change = 'removed')
+				);
+				CREATE INDEX IF NOT EXISTS idx_change_log_generation
+					ON change_log (generation);
+				CREATE TABLE change_tracking (
+					entity TEXT PRIMARY KEY,
+					since INTEGER NOT NULL
+				);
+			`),
+		exec(`
+				ALTER TABLE generation ADD COLUMN loaded TIMESTAMP WITH TIME ZONE;
+				ALTER TABLE generation ADD COLUMN dataset DATE;
+			`),
+		exec(`
+				CREATE TABLE biography (
+					atom_id INTEGER NOT NULL,
+					birth_year SMALLINT NOT NULL,
+					born TEXT NOT NULL,
+					death_year SMALLINT NOT NULL,
+					died TEXT NOT NULL,
+					PRIMARY KEY (atom_id)
+				);
+			`),
+		exec(`
+				ALTER TABLE credit ADD COLUMN source TEXT NOT NULL DEFAULT '';
+			`),
+		exec(`
+				CREATE TABLE franchise (
+					atom_id INTEGER NOT NULL,
+					franchise_id INTEGER NOT NULL,
+					name TEXT NOT NULL,
+					PRIMARY KEY (atom_id)
+				);
+			`),
+		exec(`
+				CREATE TABLE list_generation (
+					name TEXT PRIMARY KEY,
+					generation INTEGER NOT NULL
+				);
+			`),
+		exec(`
+				CREATE TABLE rating_history (
+					generation INTEGER NOT NULL,
+					atom_id INTEGER NOT NULL,
+					votes INTEGER NOT NULL,
+					rank INTEGER NOT NULL,
+					recorded TIMESTAMP NOT NULL,
+					PRIMARY KEY (atom_id, generation)
+				);
+			`),
+		exec(`
+				CREATE INDEX IF NOT EXISTS idx_rating_history_generation
+					ON rating_history (generation);
+			`),
+		exec(`
+				ALTER TABLE load_checkpoint
+					ADD COLUMN version TEXT NOT NULL DEFAULT '';
+			`),
 	},
+	// DuckDB databases are copies of other databases made for analytics (see
+	// 'goim analytics'), so they're created with the current schema instead
+	// of being migrated. They should be made again when the schema changes.
+	"duckdb": {
+		func(tx migration.LimitedTx) error {
+			for _, stmt := range schemaStmts("duckdb") {
+				if _, err := tx.Exec(stmt); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec("INSERT INTO generation (number) VALUES (0)")
+			return err
+		},
+	},
+}
+
+// exec returns a migration that executes the given SQL. It is used for
+// migrations whose only job is to run some DDL.
+func exec(q string) migration.Migrator {
+	return func(tx migration.LimitedTx) error {
+		_, err := tx.Exec(q)
+		return err
+	}
+}
+
+// sqliteRebuild replaces a SQLite table with a new table with the column
+// definitions given, which must have the same columns in the same order. Rows
+// are copied (a row replaces earlier rows with the same primary key) and the
+// indices of the table are created again. This is how a SQLite table is
+// changed in ways that ALTER TABLE can't, like adding a primary key.
+func sqliteRebuild(tx migration.LimitedTx, table, defs string) error {
+	rows, err := tx.Query(`
+		SELECT sql FROM sqlite_master
+		WHERE type = 'index' AND tbl_name = $1 AND sql IS NOT NULL
+	`, table)
+	if err != nil {
+		return err
+	}
+	var idxs []string
+	for rows.Next() {
+		var q string
+		if err := rows.Scan(&q); err != nil {
+			rows.Close()
+			return err
+		}
+		idxs = append(idxs, q)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	tmp := table + "_rebuild"
+	_, err = tx.Exec(sf(`
+		CREATE TABLE %s (%s);
+		INSERT OR REPLACE INTO %s SELECT * FROM %s;
+		DROP TABLE %s;
+		ALTER TABLE %s RENAME TO %s;
+	`, tmp, defs, tmp, table, table, tmp, table))
+	if err != nil {
+		return err
+	}
+	for _, q := range idxs {
+		if _, err := tx.Exec(q); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type index struct {
@@ -318,36 +733,22 @@ type index struct {
 	name     string
 	fulltext string // empty, "gin" or "gist"
 	columns  []string
+	where    string // condition of a partial index
 }
 
-var indices = []index{
-	{true, "atom", "", "", []string{"hash"}},
-	{false, "episode", "tv", "", []string{"tvshow_atom_id"}},
-	{false, "episode", "tvseason", "", []string{"tvshow_atom_id", "season"}},
-
-	{false, "release_date", "", "", []string{"atom_id"}},
-	{false, "running_time", "", "", []string{"atom_id"}},
-	{false, "aka_title", "", "", []string{"atom_id"}},
-	{false, "alternate_version", "", "", []string{"atom_id"}},
-	{false, "color_info", "", "", []string{"atom_id"}},
-	{false, "mpaa_rating", "", "", []string{"atom_id"}},
-	{false, "sound_mix", "", "", []string{"atom_id"}},
-	{false, "genre", "", "", []string{"atom_id"}},
-	{false, "tagline", "", "", []string{"atom_id"}},
-	{false, "trivia", "", "", []string{"atom_id"}},
-	{false, "goof", "", "", []string{"atom_id"}},
-	{false, "language", "", "", []string{"atom_id"}},
-	{false, "literature", "", "", []string{"atom_id"}},
-	{false, "location", "", "", []string{"atom_id"}},
-	{false, "link", "", "", []string{"atom_id"}},
-	{false, "plot", "", "", []string{"atom_id"}},
-	{false, "quote", "", "", []string{"atom_id"}},
-	{false, "rating", "", "", []string{"atom_id"}},
-	{false, "credit", "", "", []string{"actor_atom_id"}},
-	{false, "credit", "", "", []string{"media_atom_id"}},
+// indices is every index in Schema.
+var indices = schemaIndices()
 
-	{false, "name", "trgm_name", "gist", []string{"name"}},
-	{false, "aka_title", "trgm_title", "gist", []string{"title"}},
+func schemaIndices() []index {
+	var idxs []index
+	for _, t := range Schema() {
+		for _, in := range t.Indices {
+			idxs = append(idxs,
+				index{in.Unique, t.Name, in.Name, in.Fulltext, in.Columns,
+					in.Where})
+		}
+	}
+	return idxs
 }
 
 func (in index) sqlName() string {
@@ -381,9 +782,13 @@ func (in index) sqlCreate(db *DB) string {
 			panic(sf("unrecognized fulltext index type: %s", in.fulltext))
 		}
 	}
-	return sf("CREATE %s INDEX %s ON %s %s (%s%s)",
+	where := ""
+	if len(in.where) > 0 {
+		where = " WHERE " + in.where
+	}
+	return sf("CREATE %s INDEX IF NOT EXISTS %s ON %s %s (%s%s)%s",
 		uni, in.sqlName(), in.table, using,
-		strings.Join(in.columns, ", "), class)
+		strings.Join(in.columns, ", "), class, where)
 }
 
 func (in index) isFulltext() bool {
@@ -426,7 +831,13 @@ func doIndices(
 
 // CreateIndices creates indices for each of the tables specified. This is
 // automatically done for you if you're using 'goim load'.
+//
+// Indices of partitioned tables (see Partition) are built on each partition
+// in parallel.
 func (db *DB) CreateIndices(tables ...string) error {
+	if err := db.createPartitionIndices(tables...); err != nil {
+		return err
+	}
 	return doIndices(db, index.sqlCreate, tables...)
 }
 
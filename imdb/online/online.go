@@ -0,0 +1,386 @@
+/*
+Package online provides an optional fallback for searches that return no
+results from a Goim database. It looks up entities with an online service,
+like OMDb (http://www.omdbapi.com) or TMDb (https://www.themoviedb.org), which
+are typically more up to date than the last dump of IMDb's plain text lists.
+Both services require an API key.
+
+Results from online services are cached in the 'external' table of the
+database, so that repeating a search does not query the service again. Use
+Fallback to plug a provider into a searcher:
+
+	s := search.New(db).Text("some new movie")
+	s.Fallback(online.Fallback(db, online.OMDb(apiKey)))
+
+Results found online are marked as external and have no atom identifier.
+*/
+package online
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
+)
+
+var (
+	sf = fmt.Sprintf
+	ef = fmt.Errorf
+)
+
+// Timeout is the maximum amount of time to wait for a response from an
+// online service.
+var Timeout = 10 * time.Second
+
+// Media represents a single entity found by an online service.
+type Media struct {
+	Entity imdb.EntityKind
+	Id     string // identifier of the entity in the online service
+	Title  string
+	Year   int
+	ImdbId string // IMDb identifier (e.g., "tt0133093"), if known
+}
+
+// Provider describes an online service that can look up entities.
+type Provider interface {
+	// Name returns a short name of the service (e.g., "omdb"). It is used
+	// to identify cached results.
+	Name() string
+
+	// Lookup searches the service for entities with the title and
+	// entity type given. If year is 0, then it is not used to restrict the
+	// search.
+	Lookup(title string, year int, ent imdb.EntityKind) ([]Media, error)
+}
+
+// Fallback returns a search fallback that looks up entities with the provider
+// given. Results are cached in the database, so that each distinct search is
+// only sent to the provider once.
+//
+// If the search is restricted to entity types, then each type is looked up.
+// Otherwise, only movies are looked up.
+func Fallback(db *imdb.DB, p Provider) search.Fallback {
+	return func(name string, year int, ents []imdb.EntityKind) (
+		[]search.Result, error) {
+
+		if len(ents) == 0 {
+			ents = []imdb.EntityKind{imdb.EntityMovie}
+		}
+		var rs []search.Result
+		for _, ent := range ents {
+			ms, err := Lookup(db, p, name, year, ent)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range ms {
+				rs = append(rs, search.Result{
+					Entity:     m.Entity,
+					Name:       m.Title,
+					Year:       m.Year,
+					Similarity: -1,
+					ExternalId: sf("%s:%s", p.Name(), m.Id),
+					External:   true,
+				})
+			}
+		}
+		return rs, nil
+	}
+}
+
+// Lookup is like p.Lookup, except results are retrieved from the cache in the
+// database if possible. Results from the provider are added to the cache.
+// (Searches without results are cached too.)
+func Lookup(db *imdb.DB, p Provider, title string, year int,
+	ent imdb.EntityKind) (ms []Media, err error) {
+
+	defer csql.Safe(&err)
+
+	query := cacheKey(title, year, ent)
+	cached := false
+	rows := csql.Query(db, `
+		SELECT entity, id, title, year, imdb_id
+		FROM external
+		WHERE source = $1 AND query = $2
+		`, p.Name(), query)
+	csql.ForRow(rows, func(scanner csql.RowScanner) {
+		var m Media
+		var ent string
+		csql.Scan(scanner, &ent, &m.Id, &m.Title, &m.Year, &m.ImdbId)
+		cached = true
+		if len(m.Id) > 0 { // empty ids mark searches without results
+			m.Entity = imdb.Entities[ent]
+			ms = append(ms, m)
+		}
+	})
+	if cached {
+		return ms, nil
+	}
+
+	ms, err = p.Lookup(title, year, ent)
+	csql.Panic(err)
+	csql.Panic(cache(db, p.Name(), query, ent, ms))
+	return ms, nil
+}
+
+// cache adds the results of a lookup to the cache.
+func cache(db *imdb.DB, source, query string, ent imdb.EntityKind,
+	ms []Media) (err error) {
+
+	defer csql.Safe(&err)
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+	ins := func(m Media) {
+		csql.Exec(tx, `
+			INSERT INTO external
+				(source, query, entity, id, title, year, imdb_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			`, source, query, m.Entity.String(), m.Id, m.Title, m.Year,
+			m.ImdbId)
+	}
+	if len(ms) == 0 {
+		ins(Media{Entity: ent})
+	}
+	for _, m := range ms {
+		ins(m)
+	}
+	return tx.Commit()
+}
+
+func cacheKey(title string, year int, ent imdb.EntityKind) string {
+	return sf("%s|%d|%s", strings.ToLower(strings.TrimSpace(title)), year, ent)
+}
+
+// getJSON decodes the JSON response of a GET request to the URL given into
+// v.
+func getJSON(uri string, v interface{}) error {
+	client := &http.Client{Timeout: Timeout}
+	resp, err := client.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ef("Got status '%s' from %s.", resp.Status, redact(uri))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return ef("Could not decode response from %s: %s", redact(uri), err)
+	}
+	return nil
+}
+
+// redact removes API keys from a URL so that it is safe to show in errors.
+func redact(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	u.RawQuery = ""
+	return u.String()
+}
+
+// parseYear returns the first four digit year at the beginning of s.
+// e.g., "2005-2012" or "2005-03-01" both return 2005.
+// If there is no year, 0 is returned.
+func parseYear(s string) int {
+	if len(s) < 4 {
+		return 0
+	}
+	n, err := strconv.Atoi(s[0:4])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+type omdb struct {
+	key string
+}
+
+// OMDb returns a provider that searches the OMDb API with the API key given.
+// Identifiers returned by OMDb are IMDb identifiers.
+func OMDb(apiKey string) Provider {
+	return omdb{apiKey}
+}
+
+func (p omdb) Name() string { return "omdb" }
+
+func (p omdb) Lookup(title string, year int, ent imdb.EntityKind) (
+	[]Media, error) {
+
+	v := url.Values{}
+	v.Set("apikey", p.key)
+	v.Set("s", title)
+	if year > 0 {
+		v.Set("y", strconv.Itoa(year))
+	}
+	switch ent {
+	case imdb.EntityMovie:
+		v.Set("type", "movie")
+	case imdb.EntityTvshow:
+		v.Set("type", "series")
+	case imdb.EntityEpisode:
+		v.Set("type", "episode")
+	default:
+		return nil, nil // OMDb doesn't know about people
+	}
+
+	var resp struct {
+		Response string
+		Error    string
+		Search   []struct {
+			Title  string
+			Year   string
+			ImdbID string `json:"imdbID"`
+		}
+	}
+	uri := "https://www.omdbapi.com/?" + v.Encode()
+	if err := getJSON(uri, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Response != "True" {
+		// OMDb reports searches without results as errors.
+		if strings.HasSuffix(resp.Error, "not found!") {
+			return nil, nil
+		}
+		return nil, ef("OMDb error: %s", resp.Error)
+	}
+	var ms []Media
+	for _, r := range resp.Search {
+		ms = append(ms, Media{
+			Entity: ent,
+			Id:     r.ImdbID,
+			Title:  r.Title,
+			Year:   parseYear(r.Year),
+			ImdbId: r.ImdbID,
+		})
+	}
+	return ms, nil
+}
+
+type tmdb struct {
+	key string
+}
+
+// TMDb returns a provider that searches the TMDb API with the API key given.
+// Episodes cannot be looked up with TMDb.
+func TMDb(apiKey string) Provider {
+	return tmdb{apiKey}
+}
+
+func (p tmdb) Name() string { return "tmdb" }
+
+func (p tmdb) Lookup(title string, year int, ent imdb.EntityKind) (
+	[]Media, error) {
+
+	v := url.Values{}
+	v.Set("api_key", p.key)
+	v.Set("query", title)
+	var kind string
+	switch ent {
+	case imdb.EntityMovie:
+		kind = "movie"
+		if year > 0 {
+			v.Set("year", strconv.Itoa(year))
+		}
+	case imdb.EntityTvshow:
+		kind = "tv"
+		if year > 0 {
+			v.Set("first_air_date_year", strconv.Itoa(year))
+		}
+	case imdb.EntityActor:
+		kind = "person"
+	default:
+		return nil, nil
+	}
+
+	var resp struct {
+		Results []struct {
+			Id           int64  `json:"id"`
+			Title        string `json:"title"`
+			Name         string `json:"name"`
+			ReleaseDate  string `json:"release_date"`
+			FirstAirDate string `json:"first_air_date"`
+		} `json:"results"`
+	}
+	uri := sf("https://api.themoviedb.org/3/search/%s?%s", kind, v.Encode())
+	if err := getJSON(uri, &resp); err != nil {
+		return nil, err
+	}
+	var ms []Media
+	for _, r := range resp.Results {
+		m := Media{Entity: ent, Id: strconv.FormatInt(r.Id, 10)}
+		if ent == imdb.EntityMovie {
+			m.Title, m.Year = r.Title, parseYear(r.ReleaseDate)
+		} else {
+			m.Title, m.Year = r.Name, parseYear(r.FirstAirDate)
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// TMDbImageBase is the base URL prepended to image paths returned by TMDb.
+var TMDbImageBase = "https://image.tmdb.org/t/p/original"
+
+// TMDbArtwork returns the artwork for the TMDb entity with the identifier
+// and entity type given. The map returned is keyed by the kind of artwork
+// ("poster", "backdrop" or "profile") and its values are full URLs.
+// Episodes are not supported.
+func TMDbArtwork(apiKey string, ent imdb.EntityKind, id string) (
+	map[string]string, error) {
+
+	var kind string
+	switch ent {
+	case imdb.EntityMovie:
+		kind = "movie"
+	case imdb.EntityTvshow:
+		kind = "tv"
+	case imdb.EntityActor:
+		kind = "person"
+	default:
+		return nil, ef("TMDb does not have artwork for %s entities.", ent)
+	}
+
+	var resp struct {
+		PosterPath   string `json:"poster_path"`
+		BackdropPath string `json:"backdrop_path"`
+		ProfilePath  string `json:"profile_path"`
+	}
+	uri := sf("https://api.themoviedb.org/3/%s/%s?api_key=%s",
+		kind, url.QueryEscape(id), url.QueryEscape(apiKey))
+	if err := getJSON(uri, &resp); err != nil {
+		return nil, err
+	}
+	arts := make(map[string]string)
+	add := func(kind, path string) {
+		if len(path) > 0 {
+			arts[kind] = TMDbImageBase + path
+		}
+	}
+	add("poster", resp.PosterPath)
+	add("backdrop", resp.BackdropPath)
+	add("profile", resp.ProfilePath)
+	return arts, nil
+}
+
+// ProviderByName returns the provider with the name given ("omdb" or "tmdb")
+// that uses the API key given.
+func ProviderByName(name, apiKey string) (Provider, error) {
+	switch strings.ToLower(name) {
+	case "omdb":
+		return OMDb(apiKey), nil
+	case "tmdb":
+		return TMDb(apiKey), nil
+	}
+	return nil, ef("Unknown online provider '%s'. Use 'omdb' or 'tmdb'.", name)
+}
@@ -0,0 +1,259 @@
+package imdb
+
+import (
+	"container/list"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Options tunes the connection pool of a database opened with OpenWith. The
+// zero value of each field leaves the corresponding default of the
+// 'database/sql' package alone.
+//
+// The defaults suit neither bulk loading nor long running servers well: a
+// load benefits from a few long lived connections that are never closed,
+// while a server should cap the number of connections and recycle them
+// periodically (e.g., so that PostgreSQL can reclaim their memory).
+type Options struct {
+	// MaxOpenConns is the maximum number of open connections to the
+	// database. A negative value means no limit.
+	MaxOpenConns int
+
+	// MaxIdleConns is the maximum number of idle connections kept in the
+	// pool. A negative value means that no idle connections are kept.
+	MaxIdleConns int
+
+	// ConnMaxLifetime is the maximum amount of time a connection may be
+	// reused. A negative value means that connections are reused forever.
+	ConnMaxLifetime time.Duration
+
+	// StmtCacheSize is the number of prepared statements kept by the
+	// database. When it is positive, queries run with the Query, QueryRow
+	// and Exec methods of DB are prepared once and the least recently used
+	// statements are closed when the cache is full. This helps programs that
+	// run the same queries over and over (like a server looking up entities),
+	// but slows down programs that mostly run one-off queries. (Queries run
+	// in transactions are never cached.)
+	StmtCacheSize int
+
+	// EntityCacheSize is the number of entities kept by the database. When
+	// it is positive, entities looked up with FromAtom (e.g., to show every
+	// result of a search) are kept, and the least recently used entities
+	// are dropped when the cache is full. The cache is emptied when the
+	// database moves to another generation: right away by NextGeneration,
+	// and within a few seconds when another program loads the database.
+	EntityCacheSize int
+
+	// ReadOnly opens the database such that it can't be changed. See
+	// OpenReadOnly.
+	ReadOnly bool
+
+	// SQLite is the profile of pragmas applied to every connection to a
+	// SQLite database: SQLiteLoad while loading and SQLiteServe while
+	// searching. (See SQLiteProfile.)
+	SQLite SQLiteProfile
+}
+
+// OpenWith is like Open, except the connection pool is configured with the
+// options given.
+func OpenWith(driver, dsn string, opts Options) (*DB, error) {
+	if driver == "duckdb" && !duckdbEnabled {
+		return nil, ef("DuckDB isn't supported by this build of goim. " +
+			"Build it with '-tags duckdb' (and cgo enabled).")
+	}
+	open := openMigrated
+	if opts.ReadOnly {
+		open = openReadOnly
+	}
+	db, err := open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.withSession(dsn, opts); err != nil {
+		db.Close()
+		return nil, err
+	}
+	db.fuzzy = db.checkFuzzy()
+	if opts.MaxOpenConns != 0 {
+		db.SetMaxOpenConns(max0(opts.MaxOpenConns))
+	}
+	if opts.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(max0(opts.MaxIdleConns))
+	}
+	if d := opts.ConnMaxLifetime; d != 0 {
+		if d < 0 {
+			d = 0
+		}
+		db.SetConnMaxLifetime(d)
+	}
+	if opts.StmtCacheSize > 0 {
+		db.stmts = newStmtCache(opts.StmtCacheSize)
+	}
+	if opts.EntityCacheSize > 0 {
+		db.entities = newEntityCache(opts.EntityCacheSize)
+	}
+	return db, nil
+}
+
+// max0 returns n, or 0 if n is negative. (Zero means "no limit" to the
+// 'database/sql' package.)
+func max0(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// Query executes a query that returns rows. The statement is cached when
+// the database has a statement cache. (See Options.StmtCacheSize.)
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if db.stmts == nil {
+		return db.DB.Query(query, args...)
+	}
+	cs, err := db.stmts.get(db.DB, query)
+	if err != nil {
+		return nil, err
+	}
+	defer db.stmts.release(cs)
+	return cs.stmt.Query(args...)
+}
+
+// QueryRow executes a query that returns at most one row. The statement is
+// cached when the database has a statement cache. (See
+// Options.StmtCacheSize.)
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	if db.stmts == nil {
+		return db.DB.QueryRow(query, args...)
+	}
+	cs, err := db.stmts.get(db.DB, query)
+	if err != nil {
+		// The error is reported when the row is scanned.
+		return db.DB.QueryRow(query, args...)
+	}
+	defer db.stmts.release(cs)
+	return cs.stmt.QueryRow(args...)
+}
+
+// Exec executes a query that doesn't return rows. The statement is cached
+// when the database has a statement cache. (See Options.StmtCacheSize.)
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if db.stmts == nil {
+		return db.DB.Exec(query, args...)
+	}
+	cs, err := db.stmts.get(db.DB, query)
+	if err != nil {
+		return nil, err
+	}
+	defer db.stmts.release(cs)
+	return cs.stmt.Exec(args...)
+}
+
+// stmtCache is a bounded cache of prepared statements that evicts the least
+// recently used statement when it is full. It is safe for concurrent use.
+type stmtCache struct {
+	mu    sync.Mutex
+	size  int
+	lru   *list.List // most recently used at the front
+	stmts map[string]*list.Element
+}
+
+// cachedStmt is a prepared statement in a cache. A statement evicted from
+// the cache is closed once it is no longer in use.
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	uses    int
+	evicted bool
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:  size,
+		lru:   list.New(),
+		stmts: make(map[string]*list.Element),
+	}
+}
+
+// get returns the prepared statement for the query given, preparing it if it
+// isn't in the cache. The statement must be released when the caller is done
+// with it.
+func (c *stmtCache) get(db *sql.DB, query string) (*cachedStmt, error) {
+	if cs := c.use(query); cs != nil {
+		return cs, nil
+	}
+
+	// Preparing a statement may take a round trip to the server, so other
+	// queries aren't kept waiting for it. If the same query was prepared in
+	// the meantime, that statement is used instead.
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cs := c.useLocked(query); cs != nil {
+		stmt.Close()
+		return cs, nil
+	}
+	cs := &cachedStmt{query: query, stmt: stmt, uses: 1}
+	c.stmts[query] = c.lru.PushFront(cs)
+	for c.lru.Len() > c.size {
+		old := c.lru.Remove(c.lru.Back()).(*cachedStmt)
+		delete(c.stmts, old.query)
+		old.evicted = true
+		if old.uses == 0 {
+			old.stmt.Close()
+		}
+	}
+	return cs, nil
+}
+
+// use returns the cached statement for the query given, marked as in use, or
+// nil if it isn't in the cache.
+func (c *stmtCache) use(query string) *cachedStmt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.useLocked(query)
+}
+
+// useLocked is like use, except the cache must already be locked.
+func (c *stmtCache) useLocked(query string) *cachedStmt {
+	el, ok := c.stmts[query]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	cs := el.Value.(*cachedStmt)
+	cs.uses++
+	return cs
+}
+
+// release marks a statement returned by get as no longer in use. (Rows
+// returned by a statement may outlive it; the 'database/sql' package keeps
+// the statement open until they are closed.)
+func (c *stmtCache) release(cs *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cs.uses--
+	if cs.evicted && cs.uses == 0 {
+		cs.stmt.Close()
+	}
+}
+
+// close closes every statement in the cache.
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, el := range c.stmts {
+		cs := el.Value.(*cachedStmt)
+		cs.evicted = true
+		if cs.uses == 0 {
+			cs.stmt.Close()
+		}
+	}
+	c.lru.Init()
+	c.stmts = make(map[string]*list.Element)
+}
@@ -0,0 +1,172 @@
+package imdb
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/csql"
+	"github.com/BurntSushi/ty/fun"
+)
+
+// Very large PostgreSQL databases can partition the 'name' and 'credit'
+// tables by hashing their atom identifiers. Queries and loading work the same
+// regardless, but indices on a partitioned table are built on every partition
+// in parallel (see CreateIndices), which is much faster than building one
+// huge index.
+
+// partitionKeys maps tables that can be partitioned to their partition key.
+var partitionKeys = map[string]string{
+	"name":   "atom_id",
+	"credit": "actor_atom_id",
+}
+
+// Partition splits the table given into the number of partitions given by
+// hashing its atom identifiers ('atom_id' for 'name' and 'actor_atom_id' for
+// 'credit'). If parts is less than 2, a partitioned table is turned back into
+// a regular table. Existing rows are copied, so this can take a while, and
+// the table's indices are rebuilt.
+//
+// Only the 'name' and 'credit' tables can be partitioned, and only on
+// PostgreSQL (version 11 or newer).
+func (db *DB) Partition(table string, parts int) (err error) {
+	defer csql.Safe(&err)
+
+	if db.Driver != "postgres" {
+		return ef("Only PostgreSQL databases can be partitioned.")
+	}
+	key, ok := partitionKeys[table]
+	if !ok {
+		return ef("Table '%s' cannot be partitioned.", table)
+	}
+	pkey := primaryKey(table)
+	old, err := db.Partitions(table)
+	csql.Panic(err)
+	if parts < 2 && len(old) == 0 {
+		return nil // already a regular table
+	}
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	tmp := table + "_repartition"
+	if parts < 2 {
+		csql.Exec(tx, sf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)",
+			tmp, table))
+	} else {
+		csql.Exec(tx, sf(`
+			CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)
+			PARTITION BY HASH (%s)`, tmp, table, key))
+		for i := 0; i < parts; i++ {
+			csql.Exec(tx, sf(`
+				CREATE TABLE %s_p%d PARTITION OF %s
+				FOR VALUES WITH (MODULUS %d, REMAINDER %d)`,
+				tmp, i, tmp, parts, i))
+		}
+	}
+	csql.Exec(tx, sf("INSERT INTO %s SELECT * FROM %s", tmp, table))
+	csql.Exec(tx, sf("DROP TABLE %s", table)) // and its partitions
+	csql.Exec(tx, sf("ALTER TABLE %s RENAME TO %s", tmp, table))
+	for i := 0; i < parts && parts >= 2; i++ {
+		csql.Exec(tx, sf("ALTER TABLE %s_p%d RENAME TO %s_p%d",
+			tmp, i, table, i))
+	}
+	if len(pkey) > 0 {
+		csql.Exec(tx, sf("ALTER TABLE %s ADD PRIMARY KEY (%s)",
+			table, strings.Join(pkey, ", ")))
+	}
+	csql.Panic(tx.Commit())
+
+	// Indices were dropped along with the old table.
+	csql.Panic(db.CreateIndices(table))
+	return
+}
+
+// Partitions returns the names of the partitions of the table given, which
+// is empty if the table isn't partitioned. (SQLite tables are never
+// partitioned.)
+func (db *DB) Partitions(table string) (parts []string, err error) {
+	defer csql.Safe(&err)
+
+	if db.Driver != "postgres" {
+		return nil, nil
+	}
+	rows := csql.Query(db, `
+		SELECT c.relname
+		FROM pg_inherits
+		JOIN pg_class AS c ON c.oid = pg_inherits.inhrelid
+		JOIN pg_class AS p ON p.oid = pg_inherits.inhparent
+		WHERE p.relname = $1
+		ORDER BY c.relname ASC
+	`, table)
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var part string
+		csql.Scan(s, &part)
+		parts = append(parts, part)
+	})
+	return
+}
+
+// createPartitionIndices creates the indices of partitioned tables on each
+// of their partitions in parallel. Creating the index on the partitioned
+// table afterwards attaches the indices on its partitions instead of
+// building them again.
+func (db *DB) createPartitionIndices(tables ...string) (err error) {
+	defer csql.Safe(&err)
+
+	if db.Driver != "postgres" {
+		return
+	}
+	trgmEnabled := db.IsFuzzyEnabled()
+	var wg sync.WaitGroup
+	errs := make(chan error, 1)
+	for table := range partitionKeys {
+		if len(tables) > 0 && !fun.In(table, tables) {
+			continue
+		}
+		parts, perr := db.Partitions(table)
+		csql.Panic(perr)
+		for _, part := range parts {
+			var q string
+			for _, idx := range indices {
+				if idx.table != table || (idx.isFulltext() && !trgmEnabled) {
+					continue
+				}
+				idx.table = part
+				q += idx.sqlCreate(db) + "; "
+			}
+			if len(q) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func(q string) {
+				defer wg.Done()
+				if _, err := db.DB.Exec(q); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+				}
+			}(q)
+		}
+	}
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// reindexTables returns the tables to reindex in place of the table given,
+// which are its partitions if it is partitioned. (Partitioned tables can't
+// be reindexed directly before PostgreSQL 14.)
+func (db *DB) reindexTables(table string) []string {
+	parts, err := db.Partitions(table)
+	csql.Panic(err)
+	if len(parts) > 0 {
+		return parts
+	}
+	return []string{table}
+}
@@ -0,0 +1,195 @@
+package imdb
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/csql"
+)
+
+// The generation that each list file was last loaded in is recorded in the
+// 'list_generation' table, keyed by the name of the list file (e.g.,
+// 'movies' or 'actresses'). This tells where data came from when some lists
+// are loaded more often than others.
+
+// Source identifies where a piece of data came from.
+type Source struct {
+	// List is the name of the list file that the data was loaded from (e.g.,
+	// 'movies' or 'actresses'), or the name of the online service that it
+	// was found with (e.g., 'omdb').
+	List string
+
+	// Generation is the generation that the list was last loaded in. It is 0
+	// when it isn't known, e.g., for lists loaded by older versions of Goim
+	// and for data found online.
+	Generation int
+}
+
+func (s Source) String() string {
+	if s.Generation == 0 {
+		return s.List
+	}
+	return sf("%s@%d", s.List, s.Generation)
+}
+
+// MarshalJSON encodes a source as an object with its list and generation.
+func (s Source) MarshalJSON() ([]byte, error) {
+	return MarshalFields("list", s.List, "generation", s.Generation)
+}
+
+// Provenance maps the JSON keys of the fields of an entity or a search result
+// (e.g., 'title' or 'rank') to the source of their data. Fields without data
+// are missing.
+type Provenance map[string]Source
+
+// String returns the sources of each field, sorted by field.
+func (p Provenance) String() string {
+	var fields []string
+	for field := range p {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for i, field := range fields {
+		fields[i] = sf("%s: %s", field, p[field])
+	}
+	return strings.Join(fields, ", ")
+}
+
+// MarshalJSON encodes the sources of each field, with the fields as keys in
+// the same case as the other keys. (See JSONSnakeCase.)
+func (p Provenance) MarshalJSON() ([]byte, error) {
+	if p == nil {
+		return []byte("null"), nil
+	}
+	obj := make(map[string]Source, len(p))
+	for field, source := range p {
+		obj[jsonKey(field)] = source
+	}
+	return json.Marshal(obj)
+}
+
+// EntityLists maps each kind of media entity to the list that it is loaded
+// from. Actors are missing, since they come from the actors, actresses or a
+// crew list. (See ActorLists.)
+var EntityLists = map[EntityKind]string{
+	EntityMovie:   "movies",
+	EntityTvshow:  "movies",
+	EntityEpisode: "movies",
+}
+
+// entityFields are the JSON keys of the fields of each kind of entity that
+// have data (i.e., not its kind or identifier).
+var entityFields = map[EntityKind][]string{
+	EntityMovie:   {"title", "year", "sequence", "tv", "video"},
+	EntityTvshow:  {"title", "year", "sequence", "yearStart", "yearEnd"},
+	EntityEpisode: {"tvshowId", "title", "year", "season", "episodeNum"},
+	EntityActor:   {"fullName", "sequence"},
+}
+
+// ActorLists returns the list that each of the actors given was loaded from,
+// which is found from the sources of their credits. Actors are added by the
+// first list that has them, and the actresses list is loaded first, then
+// the actors list and then crew lists. Actors whose credits don't record
+// their source (i.e., that were loaded by older versions of Goim) are
+// missing.
+func ActorLists(db csql.Queryer, actors []Atom) (lists map[Atom]string,
+	err error) {
+
+	defer csql.Safe(&err)
+
+	lists = make(map[Atom]string)
+	if len(actors) == 0 {
+		return
+	}
+	var ids []string
+	for _, id := range actors {
+		ids = append(ids, id.String())
+	}
+	rank := func(list string) int {
+		switch list {
+		case "actresses":
+			return 0
+		case "actors":
+			return 1
+		}
+		return 2
+	}
+	rows := csql.Query(db, sf(`
+		SELECT DISTINCT actor_atom_id, source
+		FROM credit
+		WHERE actor_atom_id IN (%s) AND source != ''
+		`, strings.Join(ids, ", ")))
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var id Atom
+		var list string
+		csql.Scan(s, &id, &list)
+		old, ok := lists[id]
+		if !ok || rank(list) < rank(old) ||
+			(rank(list) == rank(old) && list < old) {
+			lists[id] = list
+		}
+	})
+	return
+}
+
+// EntityProvenance returns the source of each field of the entity given,
+// which is the list that the entity was loaded from. It is empty for actors
+// whose list isn't known. (See ActorLists.)
+func (db *DB) EntityProvenance(e Entity) (p Provenance, err error) {
+	defer csql.Safe(&err)
+
+	list := EntityLists[e.Type()]
+	if e.Type() == EntityActor {
+		lists, err := ActorLists(db, []Atom{e.Ident()})
+		csql.Panic(err)
+		list = lists[e.Ident()]
+	}
+	p = make(Provenance)
+	if len(list) == 0 {
+		return
+	}
+	gens, err := db.ListGenerations()
+	csql.Panic(err)
+	for _, field := range entityFields[e.Type()] {
+		p[field] = Source{List: list, Generation: gens[list]}
+	}
+	return
+}
+
+// RecordListGenerations records that the list files given were loaded in the
+// generation given. It should be called with the generation returned by
+// NextGeneration.
+func (db *DB) RecordListGenerations(gen int, lists ...string) (err error) {
+	defer csql.Safe(&err)
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	for _, list := range lists {
+		csql.Exec(tx, "DELETE FROM list_generation WHERE name = $1", list)
+		csql.Exec(tx, `
+			INSERT INTO list_generation (name, generation) VALUES ($1, $2)
+		`, list, gen)
+	}
+	csql.Panic(tx.Commit())
+	return
+}
+
+// ListGenerations returns the generation that each list file was last loaded
+// in. Lists that were never loaded, or were last loaded by older versions of
+// Goim, are missing.
+func (db *DB) ListGenerations() (gens map[string]int, err error) {
+	defer csql.Safe(&err)
+
+	gens = make(map[string]int)
+	rows := csql.Query(db, "SELECT name, generation FROM list_generation")
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var name string
+		var gen int
+		csql.Scan(s, &name, &gen)
+		gens[name] = gen
+	})
+	return
+}
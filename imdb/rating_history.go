@@ -0,0 +1,82 @@
+package imdb
+
+import (
+	"time"
+
+	"github.com/BurntSushi/csql"
+)
+
+// Rating history is kept in the optional 'rating_history' table, which has a
+// copy of every row of the 'rating' table for each generation that the
+// 'ratings' list was loaded in. ('goim load' records it when the table has
+// been recorded before, or when asked to with '-rating-history'.) This makes
+// it possible to chart how the rating of a title changed over time.
+
+// RatingSnapshot is the rating of an entity in one generation.
+type RatingSnapshot struct {
+	Generation int
+
+	// Recorded is when the rating was copied into the history, which is
+	// roughly when the 'ratings' list was loaded.
+	Recorded time.Time
+
+	Rank UserRank
+}
+
+// RecordRatingHistory copies the ratings of every entity into the rating
+// history, as the ratings of the generation given. Ratings already recorded
+// for that generation are replaced. It should be called after the 'ratings'
+// list is loaded, with the generation that's about to begin (one more than
+// the current generation). It returns the number of ratings recorded.
+func RecordRatingHistory(db *DB, gen int) (count int, err error) {
+	defer csql.Safe(&err)
+
+	type rating struct {
+		id   Atom
+		rank UserRank
+	}
+	var ratings []rating
+	rows := csql.Query(db, "SELECT atom_id, votes, rank FROM rating")
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var r rating
+		csql.Scan(s, &r.id, &r.rank.Votes, &r.rank.Rank)
+		ratings = append(ratings, r)
+	})
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	csql.Exec(tx, "DELETE FROM rating_history WHERE generation = $1", gen)
+	ins, err := csql.NewInserter(tx, db.Driver, "rating_history",
+		"generation", "atom_id", "votes", "rank", "recorded")
+	csql.Panic(err)
+	recorded := time.Now().UTC()
+	for _, r := range ratings {
+		csql.Panic(ins.Exec(gen, r.id, r.rank.Votes, r.rank.Rank, recorded))
+	}
+	csql.Panic(ins.Exec())
+	csql.Panic(tx.Commit())
+	return len(ratings), nil
+}
+
+// RatingHistory returns the ratings of the entity given in every generation
+// that they were recorded in, oldest first. Generations in which the entity
+// had no rating are missing.
+func RatingHistory(db csql.Queryer, id Atom) (h []RatingSnapshot, err error) {
+	defer csql.Safe(&err)
+
+	rows := csql.Query(db, `
+		SELECT generation, recorded, votes, rank
+		FROM rating_history
+		WHERE atom_id = $1
+		ORDER BY generation ASC
+	`, id)
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var snap RatingSnapshot
+		csql.Scan(s, &snap.Generation, &snap.Recorded,
+			&snap.Rank.Votes, &snap.Rank.Rank)
+		h = append(h, snap)
+	})
+	return
+}
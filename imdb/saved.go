@@ -0,0 +1,70 @@
+package imdb
+
+import (
+	"database/sql"
+
+	"github.com/BurntSushi/csql"
+)
+
+// SavedSearch is a search query stored in the database under a name, so that
+// recurring queries can be run without retyping them. The query is a search
+// query string as accepted by the search package.
+type SavedSearch struct {
+	Name  string
+	Query string
+}
+
+// SaveSearch stores the query given under the name given. If a search with
+// that name already exists, its query is replaced.
+func (db *DB) SaveSearch(name, query string) (err error) {
+	defer csql.Safe(&err)
+
+	if len(name) == 0 {
+		return ef("The name of a saved search cannot be empty.")
+	}
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+	csql.Exec(tx, "DELETE FROM saved_search WHERE name = $1", name)
+	csql.Exec(tx,
+		"INSERT INTO saved_search (name, query) VALUES ($1, $2)", name, query)
+	csql.Panic(tx.Commit())
+	return
+}
+
+// SavedSearch returns the query of the saved search with the name given. If
+// there is no such search, then an error is returned.
+func (db *DB) SavedSearch(name string) (query string, err error) {
+	r := db.QueryRow("SELECT query FROM saved_search WHERE name = $1", name)
+	err = r.Scan(&query)
+	if err == sql.ErrNoRows {
+		return "", ef("There is no saved search named '%s'.", name)
+	}
+	return
+}
+
+// SavedSearches returns all saved searches sorted by name.
+func (db *DB) SavedSearches() (saved []SavedSearch, err error) {
+	defer csql.Safe(&err)
+
+	rows := csql.Query(db,
+		"SELECT name, query FROM saved_search ORDER BY name ASC")
+	csql.ForRow(rows, func(rs csql.RowScanner) {
+		var s SavedSearch
+		csql.Scan(rs, &s.Name, &s.Query)
+		saved = append(saved, s)
+	})
+	return
+}
+
+// DeleteSavedSearch removes the saved search with the name given. If there is
+// no such search, then an error is returned.
+func (db *DB) DeleteSavedSearch(name string) (err error) {
+	defer csql.Safe(&err)
+
+	res := csql.Exec(db, "DELETE FROM saved_search WHERE name = $1", name)
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ef("There is no saved search named '%s'.", name)
+	}
+	return
+}
@@ -0,0 +1,605 @@
+package imdb
+
+import (
+	"strings"
+
+	"github.com/BurntSushi/csql"
+)
+
+// Table describes a table in the database, as it is after every migration
+// has been applied.
+type Table struct {
+	Name       string
+	Columns    []Column
+	PrimaryKey []string // may be empty
+	Indices    []Index
+}
+
+// Column describes a column of a table.
+type Column struct {
+	Name string
+
+	// Type is one of INTEGER, SMALLINT, TEXT, BOOLEAN, DATE, TIMESTAMP,
+	// BLOB, SERIAL (an auto-incrementing integer) or MPAA (one of the MPAA
+	// ratings in the MPAA type). Each is translated to the corresponding type
+	// of the database. (See Column.SQLType.)
+	Type string
+
+	// Null is true when the column may contain NULL values.
+	Null bool
+
+	// Default is an SQL expression for the default value of the column, if
+	// it has one.
+	Default string
+
+	// Check is an SQL condition that values of the column must satisfy, if
+	// it has one.
+	Check string
+}
+
+// Index describes an index on one or more columns of a table. Indices are
+// dropped and created by CreateIndices and DropIndices, which 'goim load'
+// uses to speed up loading.
+type Index struct {
+	// Name is used to name the index in the database. It may be empty for
+	// indices with a single column, in which case the column name is used.
+	Name    string
+	Columns []string
+	Unique  bool
+
+	// Fulltext is empty for a regular index, or the kind of trigram index
+	// ("gin" or "gist") for fuzzy searching. Trigram indices are only
+	// created on PostgreSQL databases with the 'pg_trgm' extension.
+	Fulltext string
+
+	// Where is a condition on the rows of the table for a partial index,
+	// which only indexes the rows satisfying it. Partial indices are small,
+	// but are only used by queries whose conditions imply this one.
+	Where string
+}
+
+// PopularVotes is the number of votes that makes an entity popular. Partial
+// indices cover only popular entities, which makes searches restricted to
+// them (e.g., with the '{popular}' search directive) fast even on the
+// largest databases.
+const PopularVotes = 1000
+
+// Schema returns a description of every table in the database. Tables are
+// created and changed by migrations when a database is opened, so Schema
+// describes the database after every migration has been applied.
+//
+// The value returned is a fresh copy, so it may be changed by the caller.
+func Schema() []Table {
+	col := func(name, typ string) Column {
+		return Column{Name: name, Type: typ}
+	}
+	idx := func(columns ...string) Index { return Index{Columns: columns} }
+	atomId := col("atom_id", "INTEGER")
+	popular := sf("votes >= %d", PopularVotes)
+	return []Table{
+		{
+			Name:       "atom",
+			Columns:    []Column{col("id", "INTEGER"), col("hash", "BLOB")},
+			PrimaryKey: []string{"id"},
+			Indices:    []Index{{Columns: []string{"hash"}, Unique: true}},
+		},
+		{
+			Name: "name",
+			Columns: []Column{
+				atomId, col("name", "TEXT"),
+				{Name: "name_fold", Type: "TEXT", Default: "''"},
+			},
+			PrimaryKey: []string{"atom_id"},
+			Indices: []Index{
+				idx("name_fold"),
+				{Name: "trgm_name", Columns: []string{"name"},
+					Fulltext: "gist"},
+			},
+		},
+		{
+			Name:       "actor",
+			Columns:    []Column{atomId, col("sequence", "TEXT")},
+			PrimaryKey: []string{"atom_id"},
+		},
+		{
+			Name: "credit",
+			Columns: []Column{
+				col("actor_atom_id", "INTEGER"),
+				col("media_atom_id", "INTEGER"),
+				col("character", "TEXT"),
+				col("position", "INTEGER"),
+				col("attrs", "TEXT"),
+				{Name: "role", Type: "TEXT", Default: "'actor'"},
+				{Name: "source", Type: "TEXT", Default: "''"},
+			},
+			Indices: []Index{
+				idx("actor_atom_id"), idx("media_atom_id"), idx("role"),
+			},
+		},
+		{
+			Name: "movie",
+			Columns: []Column{
+				atomId, col("year", "SMALLINT"), col("sequence", "TEXT"),
+				col("tv", "BOOLEAN"), col("video", "BOOLEAN"),
+			},
+			PrimaryKey: []string{"atom_id"},
+		},
+		{
+			Name: "tvshow",
+			Columns: []Column{
+				atomId, col("year", "SMALLINT"), col("sequence", "TEXT"),
+				col("year_start", "SMALLINT"), col("year_end", "SMALLINT"),
+			},
+			PrimaryKey: []string{"atom_id"},
+		},
+		{
+			Name: "episode",
+			Columns: []Column{
+				atomId, col("tvshow_atom_id", "INTEGER"),
+				col("year", "SMALLINT"), col("season", "SMALLINT"),
+				col("episode_num", "INTEGER"),
+				{Name: "abs_num", Type: "INTEGER", Default: "0"},
+			},
+			PrimaryKey: []string{"atom_id"},
+			Indices: []Index{
+				{Name: "tv", Columns: []string{"tvshow_atom_id"}},
+				{Name: "tvseason",
+					Columns: []string{"tvshow_atom_id", "season"}},
+			},
+		},
+		{
+			Name: "release_date",
+			Columns: []Column{
+				atomId, col("country", "TEXT"), col("released", "DATE"),
+				{Name: "attrs", Type: "TEXT", Null: true},
+			},
+			Indices: []Index{idx("atom_id")},
+		},
+		{
+			Name: "running_time",
+			Columns: []Column{
+				atomId, col("country", "TEXT"), col("minutes", "SMALLINT"),
+				{Name: "attrs", Type: "TEXT", Null: true},
+			},
+			Indices: []Index{idx("atom_id")},
+		},
+		{
+			Name: "aka_title",
+			Columns: []Column{
+				atomId, col("title", "TEXT"), col("attrs", "TEXT"),
+			},
+			Indices: []Index{
+				idx("atom_id"),
+				{Name: "trgm_title", Columns: []string{"title"},
+					Fulltext: "gist"},
+			},
+		},
+		attrTable("alternate_version", col("about", "TEXT")),
+		attrTable("color_info",
+			col("color", "BOOLEAN"), col("attrs", "TEXT")),
+		attrTable("mpaa_rating",
+			col("rating", "MPAA"), col("reason", "TEXT")),
+		attrTable("sound_mix", col("mix", "TEXT"), col("attrs", "TEXT")),
+		attrTable("genre", col("name", "TEXT")),
+		attrTable("tagline", col("tag", "TEXT")),
+		attrTable("trivia", col("entry", "TEXT")),
+		attrTable("goof", col("goof_type", "TEXT"), col("entry", "TEXT")),
+		attrTable("language", col("name", "TEXT"), col("attrs", "TEXT")),
+		attrTable("literature",
+			col("lit_type", "TEXT"), col("ref", "TEXT")),
+		attrTable("location", col("place", "TEXT"), col("attrs", "TEXT")),
+		attrTable("link",
+			col("link_type", "TEXT"), col("link_atom_id", "INTEGER"),
+			Column{Name: "entity", Type: "TEXT",
+				Check: "entity IN ('movie', 'tvshow', 'episode')"}),
+		attrTable("plot", col("entry", "TEXT"), col("by", "TEXT")),
+		attrTable("quote", col("entry", "TEXT")),
+		{
+			Name: "biography",
+			Columns: []Column{
+				atomId, col("birth_year", "SMALLINT"), col("born", "TEXT"),
+				col("death_year", "SMALLINT"), col("died", "TEXT"),
+			},
+			PrimaryKey: []string{"atom_id"},
+		},
+		{
+			Name: "rating",
+			Columns: []Column{
+				atomId, col("votes", "INTEGER"), col("rank", "INTEGER"),
+			},
+			PrimaryKey: []string{"atom_id"},
+			Indices: []Index{
+				idx("atom_id"),
+				{Name: "popular", Columns: []string{"atom_id"},
+					Where: popular},
+			},
+		},
+		{
+			Name: "rating_history",
+			Columns: []Column{
+				col("generation", "INTEGER"), atomId,
+				col("votes", "INTEGER"), col("rank", "INTEGER"),
+				col("recorded", "TIMESTAMP"),
+			},
+			PrimaryKey: []string{"atom_id", "generation"},
+			Indices:    []Index{idx("generation")},
+		},
+		{
+			Name: "overlay",
+			Columns: []Column{
+				col("namespace", "TEXT"), atomId,
+				col("tag", "TEXT"), col("value", "TEXT"),
+			},
+			Indices: []Index{idx("atom_id"), idx("tag")},
+		},
+		{
+			Name: "xref",
+			Columns: []Column{
+				atomId, col("source", "TEXT"), col("id", "TEXT"),
+			},
+			Indices: []Index{
+				idx("atom_id"),
+				{Name: "source_id", Columns: []string{"source", "id"}},
+			},
+		},
+		{
+			Name: "external",
+			Columns: []Column{
+				col("source", "TEXT"), col("query", "TEXT"),
+				col("entity", "TEXT"), col("id", "TEXT"),
+				col("title", "TEXT"), col("year", "INTEGER"),
+				col("imdb_id", "TEXT"),
+			},
+			Indices: []Index{
+				{Name: "source_query", Columns: []string{"source", "query"}},
+			},
+		},
+		{
+			Name: "artwork",
+			Columns: []Column{
+				atomId, col("kind", "TEXT"),
+				col("url", "TEXT"), col("source", "TEXT"),
+			},
+			Indices: []Index{idx("atom_id")},
+		},
+		{
+			Name: "generation",
+			Columns: []Column{
+				col("number", "INTEGER"),
+				{Name: "loaded", Type: "TIMESTAMP", Null: true},
+				{Name: "dataset", Type: "DATE", Null: true},
+			},
+		},
+		{
+			Name:       "saved_search",
+			Columns:    []Column{col("name", "TEXT"), col("query", "TEXT")},
+			PrimaryKey: []string{"name"},
+		},
+		{
+			Name: "search_history",
+			Columns: []Column{
+				col("id", "SERIAL"), col("query", "TEXT"),
+				col("entity", "TEXT"), atomId,
+				col("searched", "TIMESTAMP"),
+			},
+			PrimaryKey: []string{"id"},
+		},
+		{
+			Name: "search_index",
+			Columns: []Column{
+				atomId, col("entity", "TEXT"), col("name", "TEXT"),
+				col("name_fold", "TEXT"), col("year", "INTEGER"),
+				col("attrs", "TEXT"),
+				{Name: "votes", Type: "INTEGER", Null: true},
+				{Name: "rank", Type: "INTEGER", Null: true},
+			},
+			Indices: []Index{
+				idx("atom_id"), idx("name"), idx("name_fold"),
+				{Name: "trgm_search_name", Columns: []string{"name"},
+					Fulltext: "gist"},
+				{Name: "popular_name", Columns: []string{"name"},
+					Where: popular},
+				{Name: "popular_name_fold", Columns: []string{"name_fold"},
+					Where: popular},
+				{Name: "trgm_search_popular", Columns: []string{"name"},
+					Fulltext: "gist", Where: popular},
+			},
+		},
+		{
+			Name: "franchise",
+			Columns: []Column{
+				atomId, col("franchise_id", "INTEGER"), col("name", "TEXT"),
+			},
+			PrimaryKey: []string{"atom_id"},
+			Indices:    []Index{idx("franchise_id")},
+		},
+		{
+			Name: "load_checkpoint",
+			Columns: []Column{
+				col("name", "TEXT"), col("row_count", "INTEGER"),
+				col("updated", "TIMESTAMP"),
+				{Name: "version", Type: "TEXT", Default: "''"},
+			},
+			PrimaryKey: []string{"name"},
+		},
+		{
+			Name: "load_state",
+			Columns: []Column{
+				col("name", "TEXT"), col("etag", "TEXT"),
+				col("last_modified", "TEXT"), col("loaded", "TIMESTAMP"),
+			},
+			PrimaryKey: []string{"name"},
+		},
+		{
+			Name: "list_generation",
+			Columns: []Column{
+				col("name", "TEXT"), col("generation", "INTEGER"),
+			},
+			PrimaryKey: []string{"name"},
+		},
+		{
+			Name: "entity_version",
+			Columns: []Column{
+				col("entity", "TEXT"), atomId, col("checksum", "INTEGER"),
+			},
+			PrimaryKey: []string{"entity", "atom_id"},
+		},
+		{
+			Name: "change_log",
+			Columns: []Column{
+				col("generation", "INTEGER"), col("entity", "TEXT"), atomId,
+				Column{Name: "change", Type: "TEXT",
+					Check: "change IN ('added', 'updated', 'removed')"},
+			},
+			Indices: []Index{idx("generation")},
+		},
+		{
+			Name: "change_tracking",
+			Columns: []Column{
+				col("entity", "TEXT"), col("since", "INTEGER"),
+			},
+			PrimaryKey: []string{"entity"},
+		},
+	}
+}
+
+// attrTable returns the description of a table of attributes, which has an
+// 'atom_id' column followed by the columns given, and an index on 'atom_id'.
+func attrTable(name string, columns ...Column) Table {
+	atomId := Column{Name: "atom_id", Type: "INTEGER"}
+	return Table{
+		Name:    name,
+		Columns: append([]Column{atomId}, columns...),
+		Indices: []Index{{Columns: []string{"atom_id"}}},
+	}
+}
+
+// IndexName returns the name of an index of the table in the database.
+func (t Table) IndexName(idx Index) string {
+	in := index{idx.Unique, t.Name, idx.Name, idx.Fulltext, idx.Columns,
+		idx.Where}
+	return in.sqlName()
+}
+
+// IndexNames returns the names of every index in the database, including
+// indices that aren't in Schema.
+func (db *DB) IndexNames() (names []string, err error) {
+	defer csql.Safe(&err)
+
+	q := "SELECT name FROM sqlite_master WHERE type = 'index'"
+	switch db.Driver {
+	case "postgres":
+		q = "SELECT indexname FROM pg_indexes " +
+			"WHERE schemaname = current_schema()"
+	case "duckdb":
+		q = "SELECT index_name FROM duckdb_indexes()"
+	}
+	rows := csql.Query(db, q)
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var name string
+		csql.Scan(s, &name)
+		names = append(names, name)
+	})
+	return
+}
+
+// SQLType returns the type of the column in a database with the driver given.
+func (c Column) SQLType(driver string) string {
+	switch {
+	case c.Type == "BLOB" && driver == "postgres":
+		return "BYTEA"
+	case c.Type == "TIMESTAMP" && driver != "sqlite3":
+		return "TIMESTAMP WITH TIME ZONE"
+	case c.Type == "SERIAL" && driver != "postgres":
+		return "INTEGER"
+	case c.Type == "MPAA" && driver == "postgres":
+		return "mpaa"
+	case c.Type == "MPAA":
+		return "TEXT"
+	}
+	return c.Type
+}
+
+// SchemaSQL returns the statements that create every table in Schema (but not
+// their indices) for a database with the driver given. This is the schema
+// that migrations produce, although details that don't affect Goim (like the
+// order of columns) may differ.
+func SchemaSQL(driver string) string {
+	return strings.Join(schemaStmts(driver), "\n")
+}
+
+// schemaStmts returns the statements of SchemaSQL one at a time.
+func schemaStmts(driver string) []string {
+	var stmts []string
+	switch driver {
+	case "postgres":
+		stmts = append(stmts,
+			"CREATE TYPE mpaa AS ENUM ('G', 'PG', 'PG-13', 'R', 'NC-17');")
+	case "duckdb":
+		// DuckDB has no auto-incrementing columns, so they draw from a
+		// sequence instead.
+		for _, t := range Schema() {
+			for _, c := range t.Columns {
+				if c.Type == "SERIAL" {
+					stmts = append(stmts,
+						sf("CREATE SEQUENCE %s;", t.sequence(c)))
+				}
+			}
+		}
+	}
+	for _, t := range Schema() {
+		stmts = append(stmts, t.SQL(driver))
+	}
+	return stmts
+}
+
+// sequence returns the name of the sequence that numbers the SERIAL column
+// given in a DuckDB database.
+func (t Table) sequence(c Column) string {
+	return sf("%s_%s_seq", t.Name, c.Name)
+}
+
+// SQL returns the statement that creates the table in a database with the
+// driver given.
+func (t Table) SQL(driver string) string {
+	var defs []string
+	for _, c := range t.Columns {
+		def := c.Name + " " + c.SQLType(driver)
+		if c.Type == "SERIAL" && driver == "sqlite3" {
+			// SQLite only auto-increments an INTEGER PRIMARY KEY.
+			def += " PRIMARY KEY AUTOINCREMENT"
+		} else if c.Type == "SERIAL" && driver == "duckdb" {
+			def += sf(" DEFAULT nextval('%s')", t.sequence(c))
+		}
+		if !c.Null {
+			def += " NOT NULL"
+		}
+		if len(c.Default) > 0 {
+			def += " DEFAULT " + c.Default
+		}
+		if len(c.Check) > 0 {
+			def += " CHECK (" + c.Check + ")"
+		} else if c.Type == "MPAA" && driver != "postgres" {
+			def += " CHECK (" + c.Name +
+				" IN ('G', 'PG', 'PG-13', 'R', 'NC-17'))"
+		}
+		defs = append(defs, "\t"+def)
+	}
+	if len(t.PrimaryKey) > 0 && !t.autoIncrements(driver) {
+		defs = append(defs,
+			"\tPRIMARY KEY ("+strings.Join(t.PrimaryKey, ", ")+")")
+	}
+	return sf("CREATE TABLE %s (\n%s\n);", t.Name, strings.Join(defs, ",\n"))
+}
+
+// autoIncrements returns true if the table's primary key is declared with
+// its column, which SQLite requires for auto-incrementing columns.
+func (t Table) autoIncrements(driver string) bool {
+	if driver != "sqlite3" {
+		return false
+	}
+	for _, c := range t.Columns {
+		if c.Type == "SERIAL" {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifySchema compares the tables in the database with Schema and returns a
+// description of each difference found: a missing table, a missing column,
+// or a column with the wrong type or nullability. Tables and columns that
+// aren't in Schema (e.g., added by users) are ignored, as are indices (which
+// are dropped while loading) and primary keys (which differ between
+// databases created by different versions of Goim).
+//
+// An empty list means the database has the schema that Goim expects.
+func (db *DB) VerifySchema() (problems []string, err error) {
+	defer csql.Safe(&err)
+
+	for _, t := range Schema() {
+		cols := db.tableColumns(t.Name)
+		if len(cols) == 0 {
+			problems = append(problems, sf("table '%s' is missing", t.Name))
+			continue
+		}
+		for _, want := range t.Columns {
+			got, ok := cols[want.Name]
+			if !ok {
+				problems = append(problems,
+					sf("column '%s.%s' is missing", t.Name, want.Name))
+				continue
+			}
+			if !db.sameType(want, got.typ) {
+				problems = append(problems,
+					sf("column '%s.%s' has type '%s' (expected '%s')",
+						t.Name, want.Name, got.typ,
+						want.SQLType(db.Driver)))
+			}
+			if got.null != want.Null && want.Type != "SERIAL" {
+				problems = append(problems,
+					sf("column '%s.%s' has nullability %v (expected %v)",
+						t.Name, want.Name, got.null, want.Null))
+			}
+		}
+	}
+	return
+}
+
+type dbColumn struct {
+	typ  string
+	null bool
+}
+
+// tableColumns returns the columns of the table given in the database, keyed
+// by name. The map is empty if the table doesn't exist.
+func (db *DB) tableColumns(table string) map[string]dbColumn {
+	cols := make(map[string]dbColumn)
+	if db.Driver != "sqlite3" {
+		rows := csql.Query(db, `
+			SELECT column_name, data_type, is_nullable
+			FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = $1
+		`, table)
+		csql.ForRow(rows, func(s csql.RowScanner) {
+			var name, typ, nullable string
+			csql.Scan(s, &name, &typ, &nullable)
+			cols[name] = dbColumn{typ, nullable == "YES"}
+		})
+		return cols
+	}
+
+	// PRAGMA doesn't accept parameters, but table names come from Schema.
+	rows := csql.Query(db, sf("PRAGMA table_info(%s)", table))
+	csql.ForRow(rows, func(s csql.RowScanner) {
+		var cid, notnull, pk int
+		var name, typ string
+		var dflt *string
+		csql.Scan(s, &cid, &name, &typ, &notnull, &dflt, &pk)
+		// Primary keys are implicitly not null.
+		cols[name] = dbColumn{typ, notnull == 0 && pk == 0}
+	})
+	return cols
+}
+
+// sameType returns true if a column type reported by the database is the
+// type expected by the column.
+func (db *DB) sameType(c Column, typ string) bool {
+	switch db.Driver {
+	case "sqlite3":
+		return strings.EqualFold(c.SQLType(db.Driver), typ)
+	case "duckdb":
+		// DuckDB calls TEXT columns VARCHAR.
+		if want := c.SQLType(db.Driver); want != "TEXT" {
+			return strings.EqualFold(want, typ)
+		}
+		return strings.EqualFold(typ, "VARCHAR")
+	}
+	switch c.Type {
+	case "SERIAL":
+		return typ == "integer"
+	case "MPAA":
+		return typ == "USER-DEFINED"
+	}
+	return strings.EqualFold(c.SQLType(db.Driver), typ)
+}
@@ -0,0 +1,145 @@
+package imdb
+
+import (
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/csql"
+)
+
+func TestSchema(t *testing.T) {
+	names := make(map[string]bool)
+	for _, table := range Schema() {
+		if names[table.Name] {
+			t.Errorf("table '%s' is described more than once", table.Name)
+		}
+		names[table.Name] = true
+
+		cols := make(map[string]bool)
+		for _, col := range table.Columns {
+			cols[col.Name] = true
+		}
+		for _, pk := range table.PrimaryKey {
+			if !cols[pk] {
+				t.Errorf("%s: primary key column '%s' doesn't exist",
+					table.Name, pk)
+			}
+		}
+		for _, idx := range table.Indices {
+			if len(idx.Name) == 0 && len(idx.Columns) != 1 {
+				t.Errorf("%s: index on %v needs a name", table.Name,
+					idx.Columns)
+			}
+			for _, col := range idx.Columns {
+				if !cols[col] {
+					t.Errorf("%s: index column '%s' doesn't exist",
+						table.Name, col)
+				}
+			}
+		}
+	}
+	for _, in := range indices {
+		in.sqlName() // panics if an index is malformed
+	}
+}
+
+// TestMigrations migrates a fresh SQLite database and checks that it has
+// the tables described by Schema, including their primary keys.
+func TestMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goim-schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := Open("sqlite3", path.Join(dir, "goim.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	problems, err := db.VerifySchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range problems {
+		t.Error(problem)
+	}
+	for _, table := range Schema() {
+		pk := make([]string, len(table.PrimaryKey))
+		rows := csql.Query(db, sf("PRAGMA table_info(%s)", table.Name))
+		csql.ForRow(rows, func(s csql.RowScanner) {
+			var cid, notnull, n int
+			var name, typ string
+			var dflt *string
+			csql.Scan(s, &cid, &name, &typ, &notnull, &dflt, &n)
+			if n > len(pk) {
+				pk = append(pk, make([]string, n-len(pk))...)
+			}
+			if n > 0 {
+				pk[n-1] = name
+			}
+		})
+		if got, want := strings.Join(pk, ", "),
+			strings.Join(table.PrimaryKey, ", "); got != want {
+			t.Errorf("%s: primary key is (%s) but Schema has (%s)",
+				table.Name, got, want)
+		}
+	}
+}
+
+func TestPartialIndex(t *testing.T) {
+	db := &DB{Driver: "sqlite3"}
+	for _, in := range indices {
+		if in.table != "rating" || in.name != "popular" {
+			continue
+		}
+		want := "CREATE  INDEX IF NOT EXISTS idx_rating_popular ON rating  " +
+			"(atom_id) WHERE votes >= 1000"
+		if got := in.sqlCreate(db); got != want {
+			t.Fatalf("expected '%s' but got '%s'", want, got)
+		}
+		return
+	}
+	t.Fatal("partial index on rating not found")
+}
+
+func TestSchemaSQL(t *testing.T) {
+	tests := []struct {
+		driver string
+		want   []string
+	}{
+		{"sqlite3", []string{
+			"id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL",
+			"hash BLOB NOT NULL",
+			"rating TEXT NOT NULL CHECK (rating IN (",
+			"\tattrs TEXT\n",
+		}},
+		{"postgres", []string{
+			"CREATE TYPE mpaa",
+			"id SERIAL NOT NULL",
+			"PRIMARY KEY (id)",
+			"hash BYTEA NOT NULL",
+			"rating mpaa NOT NULL",
+			"searched TIMESTAMP WITH TIME ZONE NOT NULL",
+		}},
+		{"duckdb", []string{
+			"CREATE SEQUENCE search_history_id_seq;",
+			"id INTEGER DEFAULT nextval('search_history_id_seq') NOT NULL",
+			"PRIMARY KEY (id)",
+			"rating TEXT NOT NULL CHECK (rating IN (",
+			"searched TIMESTAMP WITH TIME ZONE NOT NULL",
+		}},
+	}
+	for _, test := range tests {
+		q := SchemaSQL(test.driver)
+		for _, want := range test.want {
+			if !strings.Contains(q, want) {
+				t.Errorf("%s: expected '%s' in:\n%s", test.driver, want, q)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package search
+
+import (
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// BatchResult is the resolution of a single query in a batch.
+type BatchResult struct {
+	// Query is the query string exactly as it was given.
+	Query string
+
+	// Best is the best hit for the query, as chosen by Searcher.Pick. It is
+	// nil when the query has no results.
+	Best *Result
+
+	// Err is set when the query could not be parsed or executed. Errors do
+	// not stop the rest of the batch.
+	Err error
+}
+
+// Batch resolves each of the query strings given to its best hit. This is
+// useful for matching an entire library of files (or a list exported from
+// another service) without asking the user about each one: every search
+// automatically picks its first result when ambiguous (see
+// Searcher.AutoPick).
+//
+// If configure is not nil, then it is called with each searcher before its
+// search is executed. It may be used to set options like a fallback or a
+// minimum number of votes.
+//
+// The results are returned in the same order as the queries given.
+func Batch(
+	db *imdb.DB,
+	queries []string,
+	configure func(*Searcher),
+) []BatchResult {
+	batch := make([]BatchResult, len(queries))
+	for i, query := range queries {
+		batch[i].Query = query
+		s, err := Query(db, query)
+		if err != nil {
+			batch[i].Err = err
+			continue
+		}
+		s.AutoPick()
+		if configure != nil {
+			configure(s)
+		}
+		rs, err := s.Results()
+		if err != nil {
+			batch[i].Err = err
+			continue
+		}
+		batch[i].Best, batch[i].Err = s.Pick(rs)
+	}
+	return batch
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// The benchmarks in this file run searches against a loaded database, which
+// is given in the GOIM_BENCH_DB environment variable as 'driver:dsn'. For
+// example:
+//
+//	GOIM_BENCH_DB=sqlite3:/tmp/goim.sqlite go test -run X -bench .
+//
+// They are skipped when it isn't set. ('goim bench' reports latency
+// percentiles for the same kinds of searches.)
+
+var benchDB *imdb.DB
+
+func benchOpen(b *testing.B) *imdb.DB {
+	if benchDB != nil {
+		return benchDB
+	}
+	info := os.Getenv("GOIM_BENCH_DB")
+	sep := strings.Index(info, ":")
+	if sep == -1 {
+		b.Skip("GOIM_BENCH_DB is not set to 'driver:dsn'")
+	}
+	db, err := imdb.Open(info[:sep], info[sep+1:])
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchDB = db
+	return db
+}
+
+func benchSearch(b *testing.B, query string) {
+	db := benchOpen(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s, err := Query(db, query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := s.Results(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExact(b *testing.B) {
+	benchSearch(b, "the matrix {movie} {years:1999}")
+}
+
+func BenchmarkWildcard(b *testing.B) {
+	benchSearch(b, "%matrix% {movie}")
+}
+
+func BenchmarkFuzzy(b *testing.B) {
+	benchSearch(b, "the matirx")
+}
+
+func BenchmarkSorted(b *testing.B) {
+	benchSearch(b, "{movie} {votes:10000-} {sort:bayes} {limit:20}")
+}
+
+func BenchmarkSubSearch(b *testing.B) {
+	benchSearch(b, "{show:the simpsons} {seasons:1} {sort:episode asc}")
+}
+
+func BenchmarkCast(b *testing.B) {
+	benchSearch(b, "{cast:keanu reeves} {movie} {sort:year asc}")
+}
+
+func BenchmarkCredits(b *testing.B) {
+	benchSearch(b, "{credits:the matrix} {billed:1-10}")
+}
+
+// benchResults returns the results of a search, for benchmarks that use them.
+func benchResults(b *testing.B, query string) []Result {
+	s, err := Query(benchOpen(b), query)
+	if err != nil {
+		b.Fatal(err)
+	}
+	rs, err := s.Results()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return rs
+}
+
+func BenchmarkGetEntity(b *testing.B) {
+	rs := benchResults(b, "{movie} {votes:10000-} {limit:100}")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, r := range rs {
+			if _, err := r.GetEntity(benchDB); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkHydrateEntities(b *testing.B) {
+	rs := benchResults(b, "{movie} {votes:10000-} {limit:100}")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := HydrateEntities(benchDB, rs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// openTestMovies returns a new SQLite database with the movies given (by
+// name), and a function that removes it.
+func openTestMovies(t *testing.T, names ...string) (*imdb.DB, func()) {
+	dir, err := ioutil.TempDir("", "goim-search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := imdb.Open("sqlite3", path.Join(dir, "goim.sqlite"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	exec := func(query string, args ...interface{}) {
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, name := range names {
+		exec("INSERT INTO atom (id, hash) VALUES ($1, $2)", i+1, []byte(name))
+		exec("INSERT INTO movie (atom_id, year, sequence, tv, video) "+
+			"VALUES ($1, 1999, '', 0, 0)", i+1)
+		exec("INSERT INTO name (atom_id, name, name_fold) VALUES ($1, $2, $3)",
+			i+1, name, imdb.FoldName(name))
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCaseSensitive(t *testing.T) {
+	db, done := openTestMovies(t, "The Matrix", "THE MATRIX", "100% Arabica")
+	defer done()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"{case} The Matrix", []string{"The Matrix"}},
+		{"{case} the matrix", nil},
+		{"{case} THE %", []string{"THE MATRIX"}},
+		{"{case} The Matri_", []string{"The Matrix"}},
+		{"{case} 100[%] Arabica", nil}, // brackets are not wildcards
+		{"the matrix {nocase}", []string{"The Matrix", "THE MATRIX"}},
+		{"{case} the matrix {nocase}", []string{"The Matrix", "THE MATRIX"}},
+	}
+	for _, test := range tests {
+		s, err := Query(db, test.query)
+		if err != nil {
+			t.Fatalf("%s: %s", test.query, err)
+		}
+		rs, err := s.Results()
+		if err != nil {
+			t.Errorf("%s: %s", test.query, err)
+			continue
+		}
+		got := make(map[string]bool)
+		for _, r := range rs {
+			got[r.Name] = true
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.query, got, test.want)
+			continue
+		}
+		for _, name := range test.want {
+			if !got[name] {
+				t.Errorf("%s: got %v, want %v", test.query, got, test.want)
+			}
+		}
+	}
+}
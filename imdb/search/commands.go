@@ -16,10 +16,73 @@ var Commands []Command
 // Command represents a single search directive available in a search query
 // string. Each command has a canonical name, a list of possibly empty
 // synonyms and a brief description describing what the directive does.
+//
+// The kind of value a command accepts is described by Value, so that user
+// interfaces can build a widget for each directive without parsing its
+// description. For ValueEnum, Values lists every accepted value. For
+// ValueSort, Values lists every field that can be sorted on. Example is a
+// complete directive using the command, e.g., '{years:1990-1999}'.
 type Command struct {
 	Name        string
 	Synonyms    []string
 	Description string
+	Value       ValueKind
+	Values      []string
+	Example     string
+}
+
+// ValueKind describes the kind of value that a search directive accepts.
+type ValueKind int
+
+const (
+	// ValueNone is for directives without a value, e.g., '{movie}'.
+	ValueNone ValueKind = iota
+
+	// ValueInt is a single integer, e.g., '{limit:10}'.
+	ValueInt
+
+	// ValueFloat is a single number, e.g., '{similar:0.5}'.
+	ValueFloat
+
+	// ValueRange is an inclusive range of integers of the form 'x', 'x-y',
+	// 'x-' or '-y', e.g., '{years:1990-1999}'.
+	ValueRange
+
+	// ValueEnum is one of a fixed set of strings, e.g., '{genre:comedy}'.
+	ValueEnum
+
+	// ValueString is arbitrary text, e.g., '{tag:favorites}'.
+	ValueString
+
+	// ValueSubQuery is an entire search query (which may contain its own
+	// directives), e.g., '{show:simpsons}'.
+	ValueSubQuery
+
+	// ValueSort is a sort field followed by 'asc' or 'desc', e.g.,
+	// '{sort:year desc}'.
+	ValueSort
+)
+
+func (k ValueKind) String() string {
+	switch k {
+	case ValueNone:
+		return "none"
+	case ValueInt:
+		return "int"
+	case ValueFloat:
+		return "float"
+	case ValueRange:
+		return "int-range"
+	case ValueEnum:
+		return "enum"
+	case ValueString:
+		return "string"
+	case ValueSubQuery:
+		return "sub-query"
+	case ValueSort:
+		return "sort"
+	}
+	panic(sf("unrecognized value kind %d", k))
 }
 
 // A command is a directive included in a string representation of a search.
@@ -31,14 +94,33 @@ type Command struct {
 type command struct {
 	name        string
 	synonyms    []string
-	hasArg      bool
+	arg         argument
 	description string
 	add         func(s *Searcher, value string) error
 }
 
+func (c command) hasArg() bool {
+	return c.arg.kind != ValueNone
+}
+
+// argument describes the value a command accepts.
+type argument struct {
+	kind    ValueKind
+	values  []string // for ValueEnum and ValueSort
+	example string
+}
+
+func flagArg(example string) argument {
+	return argument{ValueNone, nil, example}
+}
+
+func enumArg(values []string, example string) argument {
+	return argument{ValueEnum, values, example}
+}
+
 func addRange(v string, add func(mn, mx int) *Searcher) error {
 	if mn, mx, err := intRange(v); err != nil {
-		return err
+		return &ErrBadRange{Value: v}
 	} else {
 		var min, max int = -1, -1
 		if mn != nil {
@@ -79,10 +161,13 @@ func init() {
 	sortFields := strings.Join(fields, ", ")
 	genres := strings.Join(imdb.EnumGenres, ", ")
 	mpaas := strings.Join(imdb.EnumMPAA, ", ")
+	roles := strings.Join(Roles, ", ")
+	similarities := strings.Join(SimilarityFuncs, ", ")
+	trends := strings.Join(Trends, ", ")
 
 	commands = []command{
 		{
-			"movie", nil, false,
+			"movie", nil, flagArg("{movie}"),
 			"Restricts results to only include movies. Note that this may " +
 				"be combined with other entity types to form a disjunction.",
 			func(s *Searcher, v string) error {
@@ -91,7 +176,7 @@ func init() {
 			},
 		},
 		{
-			"tvshow", nil, false,
+			"tvshow", nil, flagArg("{tvshow}"),
 			"Restricts results to only include TV shows. Note that this may " +
 				"be combined with other entity types to form a disjunction.",
 			func(s *Searcher, v string) error {
@@ -100,7 +185,7 @@ func init() {
 			},
 		},
 		{
-			"episode", nil, false,
+			"episode", nil, flagArg("{episode}"),
 			"Restricts results to only include episodes. Note that this may " +
 				"be combined with other entity types to form a disjunction.",
 			func(s *Searcher, v string) error {
@@ -109,8 +194,10 @@ func init() {
 			},
 		},
 		{
-			"actor", nil, false,
-			"Restricts results to only include actors. Note that this may " +
+			"actor", []string{"person"}, flagArg("{actor}"),
+			"Restricts results to only include people (actors, but also " +
+				"directors, writers, etc.). Use {role:...} to restrict " +
+				"people to a particular role. Note that this may " +
 				"be combined with other entity types to form a disjunction.",
 			func(s *Searcher, v string) error {
 				s.Entity(imdb.EntityActor)
@@ -118,7 +205,7 @@ func init() {
 			},
 		},
 		{
-			"genre", nil, true,
+			"genre", nil, enumArg(imdb.EnumGenres, "{genre:comedy}"),
 			"Restricts results to only include entities matching the genre " +
 				"given. Multiple genres will be combined disjunctively. " +
 				"Available genres: " + genres,
@@ -128,7 +215,7 @@ func init() {
 			},
 		},
 		{
-			"mpaa", nil, true,
+			"mpaa", nil, enumArg(imdb.EnumMPAA, "{mpaa:PG-13}"),
 			"Restricts results to only include entities with the MPAA rating " +
 				"given. Multiple MPAA ratings will be combined " +
 				"disjunctively. Available MPAA ratings: " + mpaas,
@@ -138,7 +225,59 @@ func init() {
 			},
 		},
 		{
-			"credits", nil, true,
+			"role", nil, enumArg(Roles, "{role:director}"),
+			"Restricts credits to the role given. With {cast:...} or " +
+				"{credits:...}, only credits in the role are returned " +
+				"(e.g., '{cast:nolan} {role:director}' returns the movies " +
+				"directed by Christopher Nolan). Otherwise, only people " +
+				"with a credit in the role are returned. The 'actress' " +
+				"role is the 'actor' credits from IMDb's actresses list. " +
+				"Multiple roles will be combined disjunctively. " +
+				"Available roles: " + roles,
+			func(s *Searcher, v string) error {
+				if !fun.In(strings.ToLower(v), Roles) {
+					return &ErrBadValue{Value: v,
+						Reason: "available roles: " + roles}
+				}
+				s.Role(v)
+				return nil
+			},
+		},
+		{
+			"tag", nil, argument{ValueString, nil, "{tag:favorites}"},
+			"Restricts results to only include entities with the overlay " +
+				"tag given. Overlay tags are loaded with 'goim overlay'. " +
+				"Multiple tags will be combined disjunctively.",
+			func(s *Searcher, v string) error {
+				s.Tag(v)
+				return nil
+			},
+		},
+		{
+			"list", nil, argument{ValueString, nil, "{list:letterboxd}"},
+			"Restricts results to only include entities with a tag in the " +
+				"overlay namespace given, like a list imported with 'goim " +
+				"letterboxd' or 'goim trakt'. Multiple lists will be " +
+				"combined disjunctively.",
+			func(s *Searcher, v string) error {
+				s.List(v)
+				return nil
+			},
+		},
+		{
+			"franchise", nil, argument{ValueString, nil, "{franchise:james bond}"},
+			"Restricts results to movies in a franchise whose name (or the " +
+				"title of any of its movies) contains the text given, " +
+				"sorted by year unless {sort:...} is given. Franchises are " +
+				"built with 'goim load -franchises'. Multiple franchises " +
+				"will be combined disjunctively.",
+			func(s *Searcher, v string) error {
+				s.Franchise(v)
+				return nil
+			},
+		},
+		{
+			"credits", nil, argument{ValueSubQuery, nil, "{credits:the matrix {movie}}"},
 			"A sub-search for media entities that restricts results to " +
 				"only actors media item returned from this sub-search.",
 			func(s *Searcher, v string) error {
@@ -146,15 +285,16 @@ func init() {
 			},
 		},
 		{
-			"cast", nil, true,
-			"A sub-search for cast entities that restricts results to " +
-				"only media entities in which the cast member appeared.",
+			"cast", nil, argument{ValueSubQuery, nil, "{cast:keanu reeves}"},
+			"A sub-search for people that restricts results to " +
+				"only media entities in which the person has a credit, " +
+				"in any role unless {role:...} is given.",
 			func(s *Searcher, v string) error {
 				return addSub(s, "cast", v, s.Cast)
 			},
 		},
 		{
-			"show", nil, true,
+			"show", nil, argument{ValueSubQuery, nil, "{show:simpsons}"},
 			"A sub-search for TV shows that restricts results to " +
 				"only episodes in the TV show.",
 			func(s *Searcher, v string) error {
@@ -162,7 +302,7 @@ func init() {
 			},
 		},
 		{
-			"debug", nil, false,
+			"debug", nil, flagArg("{debug}"),
 			"When enabled, the SQL queries used in the search will be logged " +
 				"to stderr.",
 			func(s *Searcher, v string) error {
@@ -171,7 +311,7 @@ func init() {
 			},
 		},
 		{
-			"id", []string{"atom"}, true,
+			"id", []string{"atom"}, argument{ValueInt, nil, "{id:123}"},
 			"Precisely selects a single identity with the atom identifier " +
 				"given. e.g., {id:123} returns the entity with id 123." +
 				"Note that one SHOULD NOT rely on any specific atom " +
@@ -180,14 +320,14 @@ func init() {
 			func(s *Searcher, v string) error {
 				n, err := strconv.Atoi(v)
 				if err != nil {
-					return ef("Invalid integer '%s' for atom id: %s", v, err)
+					return &ErrBadValue{Value: v, Reason: "not an integer"}
 				}
 				s.Atom(imdb.Atom(n))
 				return nil
 			},
 		},
 		{
-			"years", []string{"year"}, true,
+			"years", []string{"year"}, argument{ValueRange, nil, "{years:1990-1999}"},
 			"Only show search results for the year or years specified. " +
 				"e.g., {1990-1999} only shows movies in the 90s.",
 			func(s *Searcher, v string) error {
@@ -195,7 +335,23 @@ func init() {
 			},
 		},
 		{
-			"rank", nil, true,
+			"decade", nil, argument{ValueString, nil, "{decade:80s}"},
+			"Only show search results from the decade specified. This is " +
+				"shorthand for a range of years, e.g., {decade:80s} and " +
+				"{decade:1980s} are the same as {years:1980-1989}. Two " +
+				"digit decades from 00s to 20s are in the 2000s.",
+			expand(expandDecade),
+		},
+		{
+			"era", nil, enumArg(Eras, "{era:classic}"),
+			"Only show search results from the era specified. This is " +
+				"shorthand for a range of years: silent is 1929 and " +
+				"earlier, classic is 1930 to 1969 and modern is 1970 and " +
+				"later.",
+			expand(expandEra),
+		},
+		{
+			"rank", nil, argument{ValueRange, nil, "{rank:70-}"},
 			"Only show search results with the rank or ranks specified. " +
 				"e.g., {70-} only shows entities with a rank of 70 or " +
 				"better. Ranks are on a scale of 0 to 100, where 100 is the " +
@@ -205,7 +361,7 @@ func init() {
 			},
 		},
 		{
-			"votes", nil, true,
+			"votes", nil, argument{ValueRange, nil, "{votes:10000-}"},
 			"Only show search results with ranks that have the vote count " +
 				"specified. e.g., {10000-} only shows entities with a rank " +
 				"that has 10,000 or more votes.",
@@ -214,7 +370,7 @@ func init() {
 			},
 		},
 		{
-			"billing", []string{"billed"}, true,
+			"billing", []string{"billed"}, argument{ValueRange, nil, "{billing:1-5}"},
 			"Only show search results with credits with the billing position " +
 				"specified. e.g., {1-5} only shows movies where the actor " +
 				"was in the top 5 billing order (or only shows actors of a " +
@@ -224,7 +380,21 @@ func init() {
 			},
 		},
 		{
-			"seasons", []string{"s"}, true,
+			"ageatrelease", []string{"age"},
+			argument{ValueRange, nil, "{ageatrelease:-25}"},
+			"Only show search results with credits where the actor's age " +
+				"in the year of release is in the range specified. e.g., " +
+				"{credits:...} {ageatrelease:-25} only shows actors of a " +
+				"movie who were 25 or younger when it was released (or " +
+				"with {cast:...}, only movies made before the actor turned " +
+				"26). Ages come from the 'biographies' list, so credits of " +
+				"actors without a known year of birth are never shown.",
+			func(s *Searcher, v string) error {
+				return addRange(v, s.AgeAtRelease)
+			},
+		},
+		{
+			"seasons", []string{"s"}, argument{ValueRange, nil, "{seasons:1}"},
 			"Only show search results for the season or seasons specified. " +
 				"e.g., {seasons:1} only shows episodes from the first season " +
 				"of a TV show. Note that this only filters episodes---movies " +
@@ -234,7 +404,7 @@ func init() {
 			},
 		},
 		{
-			"episodes", []string{"e"}, true,
+			"episodes", []string{"e"}, argument{ValueRange, nil, "{episodes:1-5}"},
 			"Only show search results for the season or seasons specified. " +
 				"e.g., {episodes:1-5} only shows the first five episodes of " +
 				"a of a season. Note that this only filters " +
@@ -244,7 +414,90 @@ func init() {
 			},
 		},
 		{
-			"notv", nil, false,
+			"absolute", []string{"abs"}, argument{ValueRange, nil, "{abs:125}"},
+			"Only show search results for the absolute episode number or " +
+				"numbers specified, where episodes are numbered from 1 " +
+				"across all seasons of a TV show (as is common for anime). " +
+				"e.g., {show:one piece} {abs:125} shows the 125th episode. " +
+				"Note that this only filters episodes---movies and TV " +
+				"shows are still returned otherwise.",
+			func(s *Searcher, v string) error {
+				return addRange(v, s.AbsoluteEpisodes)
+			},
+		},
+		{
+			"special", []string{"specials"}, flagArg("{special}"),
+			"Only show episodes that are specials, i.e., episodes without " +
+				"a season or episode number. Note that this only filters " +
+				"episodes---movies and TV shows are still returned otherwise.",
+			func(s *Searcher, v string) error {
+				s.Specials()
+				return nil
+			},
+		},
+		{
+			"combine", nil, flagArg("{combine}"),
+			"Combines consecutive episodes of the same season into a " +
+				"single result, which is useful for multi-part episodes. " +
+				"e.g., {show:...} {s:1} {e:5-6} {combine} returns one " +
+				"result for episodes 5 and 6.",
+			func(s *Searcher, v string) error {
+				s.CombineEpisodes()
+				return nil
+			},
+		},
+		{
+			"disambiguate", nil, flagArg("{disambiguate}"),
+			"Tells apart results with the same name and year by adding " +
+				"IMDb's numeral (e.g., 'II'), the type of entity (e.g., " +
+				"'TV movie') or the country of first release, whichever " +
+				"are needed, so that no two results look the same.",
+			func(s *Searcher, v string) error {
+				s.Disambiguate()
+				return nil
+			},
+		},
+		{
+			"provenance", nil, flagArg("{provenance}"),
+			"Records the list that each field of a result was loaded from, " +
+				"along with the generation that the list was last loaded " +
+				"in. Results found online record the service instead.",
+			func(s *Searcher, v string) error {
+				s.Provenance()
+				return nil
+			},
+		},
+		{
+			"trend", nil, enumArg(Trends, "{trend:rising}"),
+			"Restricts results to entities that are trending and sorts them " +
+				"by how much, unless another sort is given. 'rising' " +
+				"finds entities whose number of votes grew between the " +
+				"last two loads of the 'ratings' list, sorted by the " +
+				"votes gained (the 'growth' sort field). This needs the " +
+				"rating history, which is kept with 'goim load " +
+				"-rating-history'. Available trends: " + trends,
+			func(s *Searcher, v string) error {
+				if !fun.In(strings.ToLower(v), Trends) {
+					return &ErrBadValue{Value: v,
+						Reason: "available trends: " + trends}
+				}
+				s.Trend(v)
+				return nil
+			},
+		},
+		{
+			"popular", nil, flagArg("{popular}"),
+			sf("Restricts results to popular entities (with at least %d "+
+				"votes). This is much faster than '{votes:%d-}' on "+
+				"large databases, since only popular entities are searched.",
+				imdb.PopularVotes, imdb.PopularVotes),
+			func(s *Searcher, v string) error {
+				s.Popular()
+				return nil
+			},
+		},
+		{
+			"notv", nil, flagArg("{notv}"),
 			"Removes 'made for TV' movies from the search results.",
 			func(s *Searcher, v string) error {
 				s.NoTvMovies()
@@ -252,7 +505,7 @@ func init() {
 			},
 		},
 		{
-			"novideo", nil, false,
+			"novideo", nil, flagArg("{novideo}"),
 			"Removes 'made for video' movies from the search results.",
 			func(s *Searcher, v string) error {
 				s.NoVideoMovies()
@@ -260,48 +513,216 @@ func init() {
 			},
 		},
 		{
-			"similar", nil, true,
+			"similar", []string{"threshold"}, argument{ValueFloat, nil, "{similar:0.5}"},
 			"Sets the threshold at which to return results from a fuzzy text " +
 				"search. Results scoring below this threshold are omitted. " +
+				"Raising it trades recall for precision. The default is 0.4. " +
 				"Note that setting this value too low can dramatically " +
 				"increase the search time.",
 			func(s *Searcher, v string) error {
 				n, err := strconv.ParseFloat(v, 64)
 				if err != nil {
-					return ef("Invalid float '%s' for similar: %s", v, err)
+					return &ErrBadValue{Value: v, Reason: "not a number"}
+				}
+				if n < 0 || n > 1 {
+					return &ErrBadValue{Value: v,
+						Reason: "must be in the range [0, 1]"}
 				}
 				s.SimilarThreshold(n)
 				return nil
 			},
 		},
 		{
-			"limit", nil, true,
+			"goodthreshold", []string{"good"},
+			argument{ValueFloat, nil, "{goodthreshold:0.5}"},
+			"Sets the difference in similarity between the first and " +
+				"second results of a sub-search (like {show:...}) at which " +
+				"the first result is picked automatically. Otherwise, you " +
+				"are asked to choose one. The default is 0.25. Set it to 1 " +
+				"to always choose.",
+			func(s *Searcher, v string) error {
+				n, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return &ErrBadValue{Value: v, Reason: "not a number"}
+				}
+				s.GoodThreshold(n)
+				return nil
+			},
+		},
+		{
+			"autopick", nil, flagArg("{autopick}"),
+			"Always picks the first result of a sub-search (like " +
+				"{show:...}) instead of asking you to choose one when the " +
+				"result is ambiguous. This is useful in scripts.",
+			func(s *Searcher, v string) error {
+				s.AutoPick()
+				return nil
+			},
+		},
+		{
+			"similarity", []string{"sim"},
+			enumArg(SimilarityFuncs, "{similarity:jaro}"),
+			"Sets the function used to rank results by their similarity " +
+				"with the text of the search. The default is 'trigram', " +
+				"which requires PostgreSQL with the 'pg_trgm' extension. " +
+				"Other functions are computed after retrieving candidates " +
+				"from the database: " + similarities + ".",
+			func(s *Searcher, v string) error {
+				if !fun.In(strings.ToLower(v), SimilarityFuncs) {
+					return &ErrBadValue{Value: v,
+						Reason: "available functions: " + similarities}
+				}
+				s.Similarity(v)
+				return nil
+			},
+		},
+		{
+			"regex", []string{"re"},
+			argument{ValueString, nil, "{regex:^Star (Wars|Trek)}"},
+			"Only show search results with names that match the regular " +
+				"expression given. This may be used more than once. " +
+				"Matching is case insensitive unless {case} is used. This " +
+				"is only supported on PostgreSQL and DuckDB, since SQLite " +
+				"has no regular expressions. Searches with regular " +
+				"expressions check every name in the database, so they " +
+				"can be slow.",
+			func(s *Searcher, v string) error {
+				if s.db != nil && s.db.Driver == "sqlite3" {
+					return &ErrBadValue{Value: v, Reason: errRegexSQLite}
+				}
+				if err := validRegex(v); err != nil {
+					return &ErrBadValue{Value: v, Reason: err.Error()}
+				}
+				s.Regex(v)
+				return nil
+			},
+		},
+		{
+			"case", nil, flagArg("{case}"),
+			"Makes matching the text of the search case sensitive. e.g., " +
+				"'Alien' {case} doesn't match 'ALIEN'. Matching is case " +
+				"insensitive by default on every database.",
+			func(s *Searcher, v string) error {
+				s.CaseSensitive(true)
+				return nil
+			},
+		},
+		{
+			"nocase", nil, flagArg("{nocase}"),
+			"Makes matching the text of the search case insensitive. " +
+				"This is the default, but it may be used to undo {case} " +
+				"(e.g., from a macro).",
+			func(s *Searcher, v string) error {
+				s.CaseSensitive(false)
+				return nil
+			},
+		},
+		{
+			"rankwild", nil, flagArg("{rankwild}"),
+			"Ranks the results of a search with wildcards by their " +
+				"similarity with the text of the search. Normally, " +
+				"wildcards disable fuzzy searching and results are " +
+				"returned in an arbitrary order. e.g., " +
+				"'star wars%' {rankwild} returns the results closest to " +
+				"'star wars' first.",
+			func(s *Searcher, v string) error {
+				s.RankWildcards()
+				return nil
+			},
+		},
+		{
+			"prefer-lang", []string{"lang"}, argument{ValueString, nil,
+				"{prefer-lang:de}"},
+			"Replaces the name of each result with its AKA title for the " +
+				"language or country given, when there is one. The value " +
+				"may be a two letter language or country code (like de or " +
+				"fr) or the name of a country as it appears in IMDb's AKA " +
+				"titles (like Germany). This does not change which results " +
+				"are found.",
+			func(s *Searcher, v string) error {
+				s.PreferLang(v)
+				return nil
+			},
+		},
+		{
+			"columns", []string{"select"},
+			argument{ValueString, nil, "{columns:rank,votes}"},
+			"Restricts the data retrieved for each result to the " +
+				"comma separated columns given, which makes large searches " +
+				"faster. The entity, name and year are always retrieved. " +
+				"Valid columns: " + strings.Join(Columns, ", ") + ".",
+			func(s *Searcher, v string) error {
+				var cols []string
+				for _, col := range strings.Split(v, ",") {
+					col = strings.TrimSpace(col)
+					switch col {
+					case "", "entity", "id", "atom_id", "name", "year":
+						continue
+					}
+					if !fun.In(col, Columns) {
+						return &ErrBadValue{Value: col, Reason: "valid " +
+							"columns: " + strings.Join(Columns, ", ")}
+					}
+					cols = append(cols, col)
+				}
+				s.Select(cols...)
+				return nil
+			},
+		},
+		{
+			"limit", nil, argument{ValueInt, nil, "{limit:10}"},
 			"Specifies a limit on the total number of search results returned.",
 			func(s *Searcher, v string) error {
 				n, err := strconv.Atoi(v)
 				if err != nil {
-					return ef("Invalid integer '%s' for limit: %s", v, err)
+					return &ErrBadValue{Value: v, Reason: "not an integer"}
 				}
 				s.Limit(int(n))
 				return nil
 			},
 		},
 		{
-			"sort", nil, true,
+			"sort", nil, argument{ValueSort, fields, "{sort:year desc}"},
 			"Sorts the search results according to the field given. It may " +
 				"be specified multiple times for more specific sorting. Note " +
 				"that this doesn't really work with fuzzy searching, since " +
 				"results are always sorted by their similarity with the " +
 				"query in a fuzzy search. e.g., {sort:episode desc} sorts " +
-				"episode in descending (biggest to smallest) order. " +
+				"episode in descending (biggest to smallest) order. If the " +
+				"order is omitted, it is descending for rank, votes and " +
+				"bayes and ascending for everything else. The bayes field " +
+				"is a rank weighted by votes, so that titles with only a " +
+				"few votes don't outrank well known ones (see bayesvotes). " +
 				"Valid sort fields: " + sortFields + ".",
 			func(s *Searcher, v string) error {
 				fields := strings.Fields(v)
-				if len(fields) != 2 {
-					return ef("Invalid sort format "+
-						"(must have field and order): '%s'", v)
+				switch len(fields) {
+				case 1:
+					s.Sort(fields[0], defaultOrder(fields[0]))
+				case 2:
+					s.Sort(fields[0], fields[1])
+				default:
+					return &ErrBadValue{Value: v,
+						Reason: "must have a field and an optional order"}
 				}
-				s.Sort(fields[0], fields[1])
+				return nil
+			},
+		},
+		{
+			"bayesvotes", nil, argument{ValueInt, nil, "{bayesvotes:5000}"},
+			"Sets the number of votes used to weight ranks when sorting by " +
+				"bayes. Each rank is pulled toward the average rank of all " +
+				"titles as if it had this many extra votes at the average, " +
+				"so a larger number favors titles with more votes. The " +
+				"default is 1000.",
+			func(s *Searcher, v string) error {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return &ErrBadValue{Value: v, Reason: "not an integer"}
+				} else if n < 1 {
+					return &ErrBadValue{Value: v, Reason: "must be at least 1"}
+				}
+				s.BayesVotes(n)
 				return nil
 			},
 		},
@@ -309,16 +730,25 @@ func init() {
 
 	// Add synonyms of commands to the map of commands.
 	for _, cmd := range commands {
-		allCommands[cmd.name] = cmd
-		for _, synonym := range cmd.synonyms {
-			allCommands[synonym] = cmd
-		}
-		Commands = append(Commands, Command{
-			Name:        cmd.name,
-			Synonyms:    cmd.synonyms,
-			Description: cmd.description,
-		})
+		exportCommand(cmd)
+	}
+}
+
+// exportCommand adds the command given to allCommands and Commands. (It
+// must already be in commands.) Commands is kept sorted by name.
+func exportCommand(cmd command) {
+	allCommands[cmd.name] = cmd
+	for _, synonym := range cmd.synonyms {
+		allCommands[synonym] = cmd
 	}
+	Commands = append(Commands, Command{
+		Name:        cmd.name,
+		Synonyms:    cmd.synonyms,
+		Description: cmd.description,
+		Value:       cmd.arg.kind,
+		Values:      cmd.arg.values,
+		Example:     cmd.arg.example,
+	})
 	fun.Sort(func(c1, c2 Command) bool { return c1.Name < c2.Name }, Commands)
 }
 
@@ -0,0 +1,118 @@
+package search
+
+import (
+	"strings"
+)
+
+// Suggestion is a possible completion of a partial query string returned by
+// Complete.
+type Suggestion struct {
+	// Text replaces the bytes in the interval [Start, End) of the partial
+	// query to apply the suggestion, e.g., '{genre:comedy}'.
+	Text       string
+	Start, End int
+
+	// Description is a brief description of the suggestion. It is only
+	// set when suggesting a directive.
+	Description string
+}
+
+// Complete returns suggestions for completing the directive that the cursor
+// is in, where pos is a byte offset into partial. When the cursor is in the
+// name of a directive, directive names (and synonyms) are suggested. When
+// it's in the argument of a directive, the valid values of the directive are
+// suggested if there is a fixed set of them (like genres, MPAA ratings,
+// roles or sort fields and orders).
+//
+// Nothing is suggested when the cursor isn't in a directive or when the
+// argument of the directive is free-form (like the query of a sub-search,
+// although directives inside of sub-searches are completed).
+func Complete(partial string, pos int) []Suggestion {
+	if pos < 0 || pos > len(partial) {
+		pos = len(partial)
+	}
+	var opens []int
+	for i, r := range partial[:pos] {
+		switch r {
+		case '{':
+			opens = append(opens, i)
+		case '}':
+			if len(opens) > 0 {
+				opens = opens[:len(opens)-1]
+			}
+		}
+	}
+	if len(opens) == 0 {
+		return nil
+	}
+	start := opens[len(opens)-1]
+	body := partial[start+1 : pos]
+	suggest := func(text, desc string) Suggestion {
+		return Suggestion{Text: text, Start: start, End: pos, Description: desc}
+	}
+
+	var sugs []Suggestion
+	sep := strings.Index(body, ":")
+	if sep == -1 {
+		prefix := strings.TrimSpace(body)
+		for _, cmd := range commands {
+			for _, name := range append([]string{cmd.name}, cmd.synonyms...) {
+				if !strings.HasPrefix(name, prefix) {
+					continue
+				}
+				if cmd.hasArg() {
+					sugs = append(sugs, suggest("{"+name+":", cmd.description))
+				} else {
+					sugs = append(sugs, suggest("{"+name+"}", cmd.description))
+				}
+			}
+		}
+		return sugs
+	}
+
+	name, val := strings.TrimSpace(body[:sep]), strings.TrimLeft(body[sep+1:], " ")
+	cmd, ok := allCommands[name]
+	if !ok {
+		return nil
+	}
+	switch cmd.arg.kind {
+	case ValueEnum:
+		for _, v := range completeValues(cmd.arg.values, val) {
+			sugs = append(sugs, suggest(sf("{%s:%s}", name, v), ""))
+		}
+	case ValueSort:
+		fields := strings.Fields(val)
+		switch {
+		case len(fields) == 0 || (len(fields) == 1 && !strings.HasSuffix(val, " ")):
+			prefix := ""
+			if len(fields) == 1 {
+				prefix = fields[0]
+			}
+			for _, v := range completeValues(cmd.arg.values, prefix) {
+				sugs = append(sugs, suggest(sf("{%s:%s ", name, v), ""))
+			}
+		case len(fields) <= 2:
+			prefix := ""
+			if len(fields) == 2 {
+				prefix = fields[1]
+			}
+			for _, v := range completeValues([]string{"asc", "desc"}, prefix) {
+				sugs = append(sugs, suggest(sf("{%s:%s %s}", name, fields[0], v), ""))
+			}
+		}
+	}
+	return sugs
+}
+
+// completeValues returns the values that start with the prefix given,
+// ignoring case.
+func completeValues(values []string, prefix string) []string {
+	var matches []string
+	prefix = strings.ToLower(prefix)
+	for _, v := range values {
+		if strings.HasPrefix(strings.ToLower(v), prefix) {
+			matches = append(matches, v)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,34 @@
+package search
+
+import (
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		partial string
+		expect  []string
+	}{
+		{"the matrix", nil},
+		{"the matrix {mo", []string{"{movie}"}},
+		{"{yea", []string{"{years:", "{year:"}},
+		{"{mpaa:pg", []string{"{mpaa:PG}", "{mpaa:PG-13}"}},
+		{"{sort:ye", []string{"{sort:year "}},
+		{"{sort:year d", []string{"{sort:year desc}"}},
+		{"{show:simpsons {seas", []string{"{seasons:"}},
+		{"{show:simp", nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, sug := range Complete(test.partial, len(test.partial)) {
+			if sug.End != len(test.partial) {
+				t.Errorf("%q: suggestion %q ends at %d", test.partial,
+					sug.Text, sug.End)
+			}
+			got = append(got, sug.Text)
+		}
+		if sf("%q", got) != sf("%q", test.expect) {
+			t.Errorf("%q: expected %q but got %q", test.partial, test.expect, got)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package search
+
+import (
+	"math"
+	"strings"
+)
+
+// These thresholds are suggestions for interpreting Result.Confidence.
+// Results with a confidence of at least ConfidenceAccept can usually be
+// accepted automatically, results below ConfidenceReject can usually be
+// rejected and a user should be asked about everything in between.
+const (
+	ConfidenceAccept = 0.8
+	ConfidenceReject = 0.4
+)
+
+// The weights of each component of the confidence score. They sum to 1.
+const (
+	confidenceSimilarity = 0.6
+	confidenceYear       = 0.25
+	confidencePopularity = 0.15
+)
+
+// confidence computes the confidence that the result given is the entity
+// being searched for. It is a weighted sum of three scores, each in the
+// interval [0, 1]:
+//
+// Name similarity (weight 0.6) is the similarity of the result with the text
+// of the search. When the database didn't compute a similarity (e.g., with
+// SQLite), Jaro-Winkler similarity is used. If the search has no text, this
+// score is 0.5.
+//
+// Year agreement (weight 0.25) is 1 when the search has no year range or
+// when the result's year is inside of it. Otherwise, it decreases linearly
+// with the distance from the middle of the range. If the result has no year,
+// this score is 0.5.
+//
+// Popularity (weight 0.15) is based on the number of IMDb votes, on a
+// logarithmic scale where 100,000 votes or more score 1.
+func (s *Searcher) confidence(r Result) float64 {
+	return confidenceSimilarity*s.similarityScore(r) +
+		confidenceYear*s.yearScore(r) +
+		confidencePopularity*popularityScore(r)
+}
+
+func (s *Searcher) similarityScore(r Result) float64 {
+	if r.Similarity >= 0 {
+		return math.Min(1, r.Similarity)
+	}
+	if len(s.name) == 0 {
+		return 0.5
+	}
+	query := strings.NewReplacer("%", "", "_", "").Replace(
+		strings.Join(s.name, " "))
+	return jaroWinkler(strings.ToLower(strings.TrimSpace(query)),
+		strings.ToLower(r.Name))
+}
+
+func (s *Searcher) yearScore(r Result) float64 {
+	if s.year == nil || (s.year.min == nil && s.year.max == nil) {
+		return 1
+	}
+	if r.Year <= 0 {
+		return 0.5
+	}
+	min, max := r.Year, r.Year
+	if s.year.min != nil {
+		min = *s.year.min
+	}
+	if s.year.max != nil {
+		max = *s.year.max
+	}
+	if r.Year >= min && r.Year <= max {
+		return 1
+	}
+	mid := float64(min+max) / 2
+	halfWidth := float64(max-min) / 2
+	dist := math.Abs(float64(r.Year) - mid)
+	return math.Max(0, 1-(dist-halfWidth)/5)
+}
+
+func popularityScore(r Result) float64 {
+	if r.Rank.Votes <= 0 {
+		return 0
+	}
+	return math.Min(1, math.Log10(float64(r.Rank.Votes)+1)/5)
+}
@@ -0,0 +1,199 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// Disambiguate specifies that results sharing a name and year with other
+// results should be told apart. Each of them gets a Disambiguation with just
+// enough of IMDb's numeral (e.g., 'II' for 'Hamlet (1990/II)'), its type
+// (e.g., 'TV movie') and the country it was first released in to be unique.
+// If those aren't enough, the atom identifier is used. Other results are
+// unaffected.
+func (s *Searcher) Disambiguate() *Searcher {
+	s.disambiguate = true
+	return s
+}
+
+// ambiguityKey is what results that can't be told apart have in common.
+type ambiguityKey struct {
+	name string
+	year int
+}
+
+// disambiguateResults sets the Disambiguation of every result that shares a
+// name and year with another result.
+func (s *Searcher) disambiguateResults(rs []Result) (err error) {
+	defer csql.Safe(&err)
+
+	groups := ambiguousGroups(rs)
+	if len(groups) == 0 {
+		return nil
+	}
+	var atoms []imdb.Atom
+	for _, group := range groups {
+		for _, i := range group {
+			atoms = append(atoms, rs[i].Id)
+		}
+	}
+	labelAmbiguous(rs, groups, s.numerals(atoms), s.countries(atoms))
+	return nil
+}
+
+// ambiguousGroups returns the indices of results that share a name and year,
+// in groups of at least two. External results are never ambiguous, since
+// they don't have the data to tell them apart.
+func ambiguousGroups(rs []Result) [][]int {
+	byKey := make(map[ambiguityKey][]int)
+	var keys []ambiguityKey // in order of their first result
+	for i, r := range rs {
+		if r.External {
+			continue
+		}
+		key := ambiguityKey{imdb.FoldName(r.Name), r.Year}
+		if len(byKey[key]) == 0 {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], i)
+	}
+	var groups [][]int
+	for _, key := range keys {
+		if len(byKey[key]) > 1 {
+			groups = append(groups, byKey[key])
+		}
+	}
+	return groups
+}
+
+// labelAmbiguous sets the Disambiguation of the results in each group with
+// the numerals and countries given. Each kind of label is only used when it
+// varies within the group, and only until every label in the group is
+// unique. If they still aren't, atom identifiers are added to them.
+func labelAmbiguous(
+	rs []Result,
+	groups [][]int,
+	numerals, countries map[imdb.Atom]string,
+) {
+	dims := []func(r Result) string{
+		func(r Result) string { return numerals[r.Id] },
+		resultType,
+		func(r Result) string { return countries[r.Id] },
+	}
+	for _, group := range groups {
+		labels := make([][]string, len(group))
+		for _, dim := range dims {
+			if unique(labels) {
+				break
+			}
+			values := make([]string, len(group))
+			for j, i := range group {
+				values[j] = dim(rs[i])
+			}
+			if !varies(values) {
+				continue
+			}
+			for j, v := range values {
+				if len(v) > 0 {
+					labels[j] = append(labels[j], v)
+				}
+			}
+		}
+		if !unique(labels) {
+			for j, i := range group {
+				labels[j] = append(labels[j], sf("#%d", rs[i].Id))
+			}
+		}
+		for j, i := range group {
+			rs[i].Disambiguation = strings.Join(labels[j], ", ")
+		}
+	}
+}
+
+// numerals returns the IMDb numeral (e.g., 'II') of each of the atoms given
+// that has one.
+func (s *Searcher) numerals(atoms []imdb.Atom) map[imdb.Atom]string {
+	in := atomList(atoms)
+	numerals := make(map[imdb.Atom]string, len(atoms))
+	rows := csql.Query(s.db, sf(`
+		SELECT atom_id, sequence FROM movie WHERE atom_id IN (%s)
+		UNION ALL
+		SELECT atom_id, sequence FROM tvshow WHERE atom_id IN (%s)
+		UNION ALL
+		SELECT atom_id, sequence FROM actor WHERE atom_id IN (%s)
+		`, in, in, in))
+	csql.ForRow(rows, func(scanner csql.RowScanner) {
+		var id imdb.Atom
+		var seq string
+		csql.Scan(scanner, &id, &seq)
+		numerals[id] = seq
+	})
+	return numerals
+}
+
+// countries returns the country of the earliest release of each of the atoms
+// given that has a release date.
+func (s *Searcher) countries(atoms []imdb.Atom) map[imdb.Atom]string {
+	countries := make(map[imdb.Atom]string, len(atoms))
+	rows := csql.Query(s.db, sf(`
+		SELECT atom_id, country FROM release_date
+		WHERE atom_id IN (%s) AND country != ''
+		ORDER BY released DESC
+		`, atomList(atoms)))
+	csql.ForRow(rows, func(scanner csql.RowScanner) {
+		var id imdb.Atom
+		var country string
+		csql.Scan(scanner, &id, &country)
+		countries[id] = country // the earliest release comes last
+	})
+	return countries
+}
+
+// resultType returns the kind of entity of a result, distinguishing TV and
+// video movies from other movies.
+func resultType(r Result) string {
+	if r.Entity == imdb.EntityMovie {
+		switch {
+		case strings.Contains(r.Attrs, "(TV)"):
+			return "TV movie"
+		case strings.Contains(r.Attrs, "(V)"):
+			return "video"
+		}
+	}
+	return r.Entity.String()
+}
+
+// atomList returns the atoms given as a comma separated list for SQL.
+func atomList(atoms []imdb.Atom) string {
+	ids := make([]string, len(atoms))
+	for i, id := range atoms {
+		ids[i] = sf("%d", id)
+	}
+	return strings.Join(ids, ", ")
+}
+
+// varies returns true if not every value is the same.
+func varies(values []string) bool {
+	for _, v := range values[1:] {
+		if v != values[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// unique returns true if every label is different.
+func unique(labels [][]string) bool {
+	seen := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		key := strings.Join(label, "\x00")
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+	}
+	return true
+}
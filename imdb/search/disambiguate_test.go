@@ -0,0 +1,35 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+func TestDisambiguate(t *testing.T) {
+	rs := []Result{
+		{Entity: imdb.EntityMovie, Id: 1, Name: "Hamlet", Year: 1990},
+		{Entity: imdb.EntityMovie, Id: 2, Name: "Hamlet", Year: 1990},
+		{Entity: imdb.EntityMovie, Id: 3, Name: "Hamlet", Year: 1990},
+		{Entity: imdb.EntityMovie, Id: 4, Name: "Hamlet", Year: 1996},
+		{Entity: imdb.EntityMovie, Id: 5, Name: "Crash", Year: 2004},
+		{Entity: imdb.EntityMovie, Id: 6, Name: "crash", Year: 2004},
+		{Entity: imdb.EntityMovie, Id: 7, Name: "Heat", Year: 1995},
+		{Entity: imdb.EntityMovie, Id: 8, Name: "Heat", Year: 1995},
+		{Entity: imdb.EntityMovie, Id: 9, Name: "Dune", Year: 2000,
+			Attrs: "(TV)"},
+		{Entity: imdb.EntityTvshow, Id: 10, Name: "Dune", Year: 2000},
+	}
+	numerals := map[imdb.Atom]string{1: "I", 2: "II", 3: "III"}
+	countries := map[imdb.Atom]string{5: "USA", 6: "Canada"}
+	labelAmbiguous(rs, ambiguousGroups(rs), numerals, countries)
+
+	want := []string{"I", "II", "III", "", "USA", "Canada", "#7", "#8",
+		"TV movie", "tvshow"}
+	for i, r := range rs {
+		if r.Disambiguation != want[i] {
+			t.Errorf("result %d: expected '%s' but got '%s'",
+				r.Id, want[i], r.Disambiguation)
+		}
+	}
+}
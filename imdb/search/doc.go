@@ -20,6 +20,10 @@ Reeves was on the cast.) There are more elaborate examples included in this
 package. There are even more examples in Goim, which can be seen in the usage
 information for the search command.  See 'goim help search'.
 
+Searches may run concurrently on the same database, as long as each Searcher
+is only used by one goroutine. Macros (see DefineMacro) and package variables
+like RegexTimeout should be set before searching.
+
 Beta
 
 Please consider this package as beta material. I am reasonably happy with what
@@ -0,0 +1,122 @@
+package search
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// Specials restricts episodes in the results to specials. A special is an
+// episode that isn't numbered in its TV show, i.e., it has a season or an
+// episode number of 0. Movies and TV shows are unaffected.
+func (s *Searcher) Specials() *Searcher {
+	s.specials = true
+	return s
+}
+
+// CombineEpisodes specifies that consecutive episodes of the same season of a
+// TV show in the results should be combined into a single result. This is
+// useful for multi-part episodes, which are frequently distributed in a
+// single file. e.g., '{show:...} {s:1} {e:5-6} {combine}' returns one result
+// for both episodes. See Result.Parts.
+func (s *Searcher) CombineEpisodes() *Searcher {
+	s.combine = true
+	return s
+}
+
+// episodePart is an episode result along with the episode it refers to.
+type episodePart struct {
+	r  Result
+	ep *imdb.Episode
+}
+
+type episodeParts []episodePart
+
+func (ps episodeParts) Len() int      { return len(ps) }
+func (ps episodeParts) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
+func (ps episodeParts) Less(i, j int) bool {
+	return ps[i].ep.EpisodeNum < ps[j].ep.EpisodeNum
+}
+
+// combineEpisodes combines runs of consecutive episodes from the same season
+// of a TV show into one result. Each combined result is placed where the
+// first of its episodes appeared in the results. Results that aren't
+// numbered episodes are not changed.
+func (s *Searcher) combineEpisodes(rs []Result) ([]Result, error) {
+	type season struct {
+		tv     imdb.Atom
+		season int
+	}
+	var episodes []Result
+	for _, r := range rs {
+		if r.Entity == imdb.EntityEpisode && !r.External {
+			episodes = append(episodes, r)
+		}
+	}
+	ents, err := HydrateEntities(s.db, episodes)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[season]episodeParts)
+	var order []interface{} // either a season or a Result
+	for _, r := range rs {
+		if r.Entity != imdb.EntityEpisode || r.External {
+			order = append(order, r)
+			continue
+		}
+		ep := ents[0].(*imdb.Episode)
+		ents = ents[1:]
+		if ep.Season == 0 || ep.EpisodeNum == 0 {
+			order = append(order, r)
+			continue
+		}
+		k := season{ep.TvshowId, ep.Season}
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], episodePart{r, ep})
+	}
+
+	var combined []Result
+	for _, item := range order {
+		if r, ok := item.(Result); ok {
+			combined = append(combined, r)
+			continue
+		}
+		parts := groups[item.(season)]
+		sort.Sort(parts)
+		for start := 0; start < len(parts); {
+			end := start + 1
+			for end < len(parts) &&
+				parts[end].ep.EpisodeNum == parts[end-1].ep.EpisodeNum+1 {
+				end++
+			}
+			combined = append(combined, s.combineRun(parts[start:end]))
+			start = end
+		}
+	}
+	return combined, nil
+}
+
+// combineRun returns a single result for a run of consecutive episodes. The
+// result has the identifier of the first episode.
+func (s *Searcher) combineRun(run episodeParts) Result {
+	if len(run) == 1 {
+		return run[0].r
+	}
+	first, last := run[0], run[len(run)-1]
+	r := first.r
+	var titles []string
+	for _, p := range run {
+		titles = append(titles, p.ep.Title)
+		r.Parts = append(r.Parts, p.ep.Id)
+	}
+	r.Name = strings.Join(titles, " / ")
+	if tv, err := first.ep.Tvshow(s.db); err == nil {
+		r.Attrs = sf("(TV show: %s, #%d.%d-%d)",
+			tv.Title, first.ep.Season, first.ep.EpisodeNum, last.ep.EpisodeNum)
+	}
+	return r
+}
@@ -0,0 +1,80 @@
+package search
+
+// The error types in this file are returned by Query (and Searcher.Query)
+// when a query string can't be parsed, and by Searcher.Results when a
+// sub-search fails. Callers can inspect them with a type switch (or
+// errors.As) to report problems more precisely than with the error message.
+
+// ErrUnknownDirective is returned when a query contains a directive that
+// doesn't exist, e.g., '{nosuchthing}'.
+type ErrUnknownDirective struct {
+	Name string
+}
+
+func (e *ErrUnknownDirective) Error() string {
+	return sf("Unrecognized search option: %s", e.Name)
+}
+
+// ErrDirectiveArgument is returned when a directive is given an argument
+// but doesn't take one, or vice versa.
+type ErrDirectiveArgument struct {
+	Name   string
+	HasArg bool // whether the directive takes an argument
+}
+
+func (e *ErrDirectiveArgument) Error() string {
+	if e.HasArg {
+		return sf("The %s command requires an argument.", e.Name)
+	}
+	return sf("The %s command does not have an argument.", e.Name)
+}
+
+// ErrBadRange is returned when the argument of a directive that takes a
+// range of integers (like '{years:1990-1999}') can't be parsed.
+type ErrBadRange struct {
+	Directive string
+	Value     string
+}
+
+func (e *ErrBadRange) Error() string {
+	return sf("Invalid range '%s' for %s. Ranges have the form 'x', "+
+		"'x-y', 'x-' or '-y', where x and y are integers.",
+		e.Value, e.Directive)
+}
+
+// ErrBadValue is returned when the argument of a directive is invalid, e.g.,
+// an unknown role or a threshold that isn't a number.
+type ErrBadValue struct {
+	Directive string
+	Value     string
+	Reason    string
+}
+
+func (e *ErrBadValue) Error() string {
+	return sf("Invalid value '%s' for %s: %s", e.Value, e.Directive, e.Reason)
+}
+
+// ErrSubSearchEmpty is returned when a sub-search directive (like
+// '{show:...}') has no query.
+type ErrSubSearchEmpty struct {
+	Kind string
+}
+
+func (e *ErrSubSearchEmpty) Error() string {
+	return sf("No query found for '%s'.", e.Kind)
+}
+
+// ErrSubSearch wraps an error from parsing or executing a sub-search. The
+// underlying error is available with Unwrap (or the Err field).
+type ErrSubSearch struct {
+	Kind string
+	Err  error
+}
+
+func (e *ErrSubSearch) Error() string {
+	return sf("Error with %s sub-search: %s", e.Kind, e.Err)
+}
+
+func (e *ErrSubSearch) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,50 @@
+package search
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQueryErrors(t *testing.T) {
+	s := &Searcher{}
+
+	var unknown *ErrUnknownDirective
+	if err := s.Query("{nosuchthing}"); !errors.As(err, &unknown) {
+		t.Fatalf("expected an unknown directive error but got %v", err)
+	} else if unknown.Name != "nosuchthing" {
+		t.Errorf("expected directive 'nosuchthing' but got '%s'", unknown.Name)
+	}
+
+	var badRange *ErrBadRange
+	if err := s.Query("{year:19x9}"); !errors.As(err, &badRange) {
+		t.Fatalf("expected a bad range error but got %v", err)
+	} else if badRange.Directive != "year" || badRange.Value != "19x9" {
+		t.Errorf("unexpected bad range error: %#v", badRange)
+	}
+
+	var empty *ErrSubSearchEmpty
+	if _, err := s.subSearcher("show", ""); !errors.As(err, &empty) {
+		t.Fatalf("expected an empty sub-search error but got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	issues := Validate("the matrix {movie} {years:1999-2003}")
+	if len(issues) > 0 {
+		t.Fatalf("expected a valid query but got %v", issues)
+	}
+	issues = Validate("{nope} {years:x} {sort:name sideways} " +
+		"{show:simpsons {rank:a-b}}")
+	if len(issues) != 4 {
+		t.Fatalf("expected 4 issues but got %d: %v", len(issues), issues)
+	}
+	var sub *ErrSubSearch
+	if !errors.As(issues[3].Err, &sub) {
+		t.Fatalf("expected a sub-search error but got %v", issues[3].Err)
+	}
+	var badRange *ErrBadRange
+	if !errors.As(issues[3].Err, &badRange) || badRange.Directive != "rank" {
+		t.Errorf("expected a bad range in the sub-search but got %v",
+			issues[3].Err)
+	}
+}
@@ -0,0 +1,101 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Some directives are shorthand for other directives. For example,
+// '{decade:80s}' is the same as '{years:1980-1989}'. These directives are
+// defined in the command table like any other, except their 'add' function
+// is created with expand, which parses the query they expand to.
+
+// expand returns a function suitable for the 'add' field of a command that
+// adds the query returned by f to the searcher. If f returns an error, it is
+// returned instead.
+func expand(f func(v string) (string, error)) func(*Searcher, string) error {
+	return func(s *Searcher, v string) error {
+		query, err := f(v)
+		if err != nil {
+			return err
+		}
+		return s.Query(query)
+	}
+}
+
+// Eras lists the names of the eras accepted by the '{era:...}' directive, in
+// chronological order.
+var Eras = []string{"silent", "classic", "modern"}
+
+// eras maps each era to the query it expands to.
+var eras = map[string]string{
+	"silent":  "{years:-1929}",
+	"classic": "{years:1930-1969}",
+	"modern":  "{years:1970-}",
+}
+
+func expandEra(v string) (string, error) {
+	q, ok := eras[strings.ToLower(v)]
+	if !ok {
+		return "", &ErrBadValue{Value: v,
+			Reason: "must be one of " + strings.Join(Eras, ", ")}
+	}
+	return q, nil
+}
+
+// expandDecade expands a decade like '80s', '1980s' or '1980' to a year
+// range. Two digit decades from '00s' to '20s' are in the 2000s, and the rest
+// are in the 1900s.
+func expandDecade(v string) (string, error) {
+	bad := &ErrBadValue{Value: v,
+		Reason: "must be a decade like '80s' or '1980s'"}
+	digits := strings.TrimSuffix(strings.TrimPrefix(v, "'"), "s")
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 || n%10 != 0 {
+		return "", bad
+	}
+	switch len(digits) {
+	case 2:
+		if n <= 20 {
+			n += 2000
+		} else {
+			n += 1900
+		}
+	case 4:
+	default:
+		return "", bad
+	}
+	return sf("{years:%d-%d}", n, n+9), nil
+}
+
+// DefineMacro adds a directive, '{name}', that is shorthand for the query
+// given. For example, after DefineMacro("good", "{votes:10000-} {rank:70-}"),
+// the query 'the matrix {good}' is the same as
+// 'the matrix {votes:10000-} {rank:70-}'. The directive is added to Commands.
+//
+// An error is returned if the name is already used by a directive or if the
+// query has problems (as reported by Validate). A macro may use other macros,
+// as long as they are defined first.
+//
+// Macros should be defined before any searches are run, since the table of
+// directives is not safe to change concurrently.
+func DefineMacro(name, query string) error {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 || strings.ContainsAny(name, "{}: \t\r\n") {
+		return ef("Invalid macro name '%s'.", name)
+	}
+	if _, ok := allCommands[name]; ok {
+		return ef("Macro '%s' has the same name as a directive.", name)
+	}
+	if issues := Validate(query); len(issues) > 0 {
+		return ef("Invalid query for macro '%s': %s", name, issues[0])
+	}
+	cmd := command{
+		name, nil, flagArg("{" + name + "}"),
+		sf("A macro for '%s'.", query),
+		expand(func(string) (string, error) { return query, nil }),
+	}
+	commands = append(commands, cmd)
+	exportCommand(cmd)
+	return nil
+}
@@ -0,0 +1,55 @@
+package search
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		query    string
+		min, max int
+	}{
+		{"{decade:80s}", 1980, 1989},
+		{"{decade:1950s}", 1950, 1959},
+		{"{decade:'00s}", 2000, 2009},
+		{"{era:classic}", 1930, 1969},
+	}
+	for _, test := range tests {
+		s := New(nil)
+		if err := s.Query(test.query); err != nil {
+			t.Errorf("%s: %s", test.query, err)
+			continue
+		}
+		if *s.year.min != test.min || *s.year.max != test.max {
+			t.Errorf("%s: expected %d-%d but got %d-%d", test.query,
+				test.min, test.max, *s.year.min, *s.year.max)
+		}
+	}
+
+	var bad *ErrBadValue
+	if err := New(nil).Query("{decade:85s}"); !errors.As(err, &bad) {
+		t.Fatalf("expected a bad value error but got %v", err)
+	} else if bad.Directive != "decade" {
+		t.Errorf("expected directive 'decade' but got '%s'", bad.Directive)
+	}
+}
+
+func TestDefineMacro(t *testing.T) {
+	if err := DefineMacro("testgood", "{votes:10000-} {rank:70-}"); err != nil {
+		t.Fatal(err)
+	}
+	s := New(nil)
+	if err := s.Query("the matrix {testgood}"); err != nil {
+		t.Fatal(err)
+	}
+	if *s.votes.min != 10000 || *s.rating.min != 70 {
+		t.Errorf("macro was not expanded: %v %v", s.votes, s.rating)
+	}
+	if err := DefineMacro("movie", "{tvshow}"); err == nil {
+		t.Errorf("expected an error when redefining a directive")
+	}
+	if err := DefineMacro("testbad", "{nosuchthing}"); err == nil {
+		t.Errorf("expected an error for a macro with an invalid query")
+	}
+}
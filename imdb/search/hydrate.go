@@ -0,0 +1,46 @@
+package search
+
+import (
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// HydrateEntities returns the entity of every result given, in the same
+// order. It's like calling GetEntity on each result, except that entities
+// are retrieved with one query for each kind of entity instead of one query
+// for each result. External results have no entity, so their entities are
+// nil.
+//
+// An error is returned if any result that isn't external has no entity in
+// the database.
+func HydrateEntities(db csql.Queryer, rs []Result) ([]imdb.Entity, error) {
+	ids := make(map[imdb.EntityKind][]imdb.Atom)
+	for _, r := range rs {
+		if !r.External {
+			ids[r.Entity] = append(ids[r.Entity], r.Id)
+		}
+	}
+	byKind := make(map[imdb.EntityKind]map[imdb.Atom]imdb.Entity, len(ids))
+	for kind, kindIds := range ids {
+		ents, err := imdb.FromAtoms(db, kind, kindIds)
+		if err != nil {
+			return nil, err
+		}
+		byKind[kind] = ents
+	}
+
+	ents := make([]imdb.Entity, len(rs))
+	for i, r := range rs {
+		if r.External {
+			continue
+		}
+		ent, ok := byKind[r.Entity][r.Id]
+		if !ok {
+			return nil, ef("Could not find %s with atom %d for '%s'.",
+				r.Entity, r.Id, r.Name)
+		}
+		ents[i] = ent
+	}
+	return ents, nil
+}
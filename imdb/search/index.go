@@ -0,0 +1,163 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/BurntSushi/csql"
+	"github.com/BurntSushi/ty/fun"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// The search index is an optional table ('search_index') with one row for
+// every movie, TV show, episode and actor. Each row has a copy of the
+// entity's name, folded name, year, attributes and rating. Simple searches
+// (see indexable) read from this one table instead of joining the 'name'
+// table with the tables of each kind of entity and the 'rating' table, which
+// is much faster for large databases at the cost of some disk space.
+//
+// The index is built with BuildIndex. Until then, it is empty and every
+// search uses the regular query.
+
+// indexColumns is the set of columns that a search may be sorted by and still
+// use the search index.
+var indexColumns = []string{
+	"entity", "atom_id", "name", "year", "attrs", "similarity",
+	"rank", "votes", "bayes",
+}
+
+// BuildIndex fills the search index with the current contents of the
+// database, replacing anything already in it. It should be called after
+// movies, actors or ratings are loaded. ('goim load' does this when the
+// index has been built before, or when asked to with '-search-index'.)
+//
+// Searches that use the index return stale results if the data it is built
+// from changes and the index isn't rebuilt.
+func BuildIndex(db *imdb.DB) (err error) {
+	defer csql.Safe(&err)
+
+	csql.Panic(db.DropIndices("search_index"))
+	defer func() { csql.Panic(db.CreateIndices("search_index")) }()
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	s := New(db)
+	csql.Exec(tx, "DELETE FROM search_index")
+	csql.Exec(tx, sf(`
+		INSERT INTO search_index
+			(entity, atom_id, name, name_fold, year, attrs, votes, rank)
+		SELECT
+			%s,
+			COALESCE(m.atom_id, t.atom_id, e.atom_id, a.atom_id),
+			name.name,
+			name.name_fold,
+			COALESCE(m.year, t.year, e.year, 0),
+			%s,
+			rating.votes,
+			rating.rank
+		FROM name
+		LEFT JOIN movie AS m ON name.atom_id = m.atom_id
+		LEFT JOIN tvshow AS t ON name.atom_id = t.atom_id
+		LEFT JOIN episode AS e ON name.atom_id = e.atom_id
+		LEFT JOIN actor AS a ON name.atom_id = a.atom_id
+		LEFT JOIN name AS et ON e.tvshow_atom_id = et.atom_id
+		LEFT JOIN rating ON name.atom_id = rating.atom_id
+		WHERE
+			COALESCE(m.atom_id, t.atom_id, e.atom_id, a.atom_id) IS NOT NULL
+		`, s.entityColumn(), s.attrsColumn()))
+	csql.Panic(tx.Commit())
+	return
+}
+
+// indexBuilt returns true if the search index has any rows.
+func indexBuilt(q csql.Queryer) bool {
+	return csql.Count(q, "SELECT COUNT(*) FROM "+
+		"(SELECT 1 FROM search_index LIMIT 1) AS built") > 0
+}
+
+// indexable returns true if the search only refers to data in the search
+// index: text, regular expressions, entity kinds, an atom identifier, years,
+// ranks and votes.
+func (s *Searcher) indexable() bool {
+	if s.subTvshow != nil || s.subCredits != nil || s.subCast != nil {
+		return false
+	}
+	if len(s.genres) > 0 || len(s.mpaas) > 0 || len(s.tags) > 0 ||
+		len(s.lists) > 0 || len(s.roles) > 0 || len(s.franchises) > 0 || len(s.trend) > 0 {
+		return false
+	}
+	if s.season != nil || s.episode != nil || s.absolute != nil ||
+		s.billing != nil || s.ageAtRelease != nil {
+		return false
+	}
+	if s.specials || s.noTvMovie || s.noVideoMovie {
+		return false
+	}
+	for _, ord := range s.order {
+		if !fun.In(ord.column, indexColumns) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexSQL returns the query for a search that uses the search index. The
+// index is aliased as 'name' so that conditions on names are the same as in
+// the regular query.
+func (s *Searcher) indexSQL() string {
+	var conj []string
+	entString := func(e imdb.EntityKind) string { return e.String() }
+	ents := fun.Map(entString, s.entities).([]string)
+	conj = append(conj, s.inStrs("name.entity", ents))
+	if s.atom > 0 {
+		conj = append(conj, sf("name.atom_id = %d", s.atom))
+	}
+	if s.year != nil {
+		conj = append(conj, s.year.cond("name.year"))
+	}
+	if s.rating != nil {
+		conj = append(conj, s.rating.cond("name.rank"))
+	}
+	if s.votes != nil {
+		conj = append(conj, s.votes.cond("name.votes"))
+	}
+	if s.popular {
+		conj = append(conj, popularCond("name"))
+	}
+	conj = append(conj, s.regexConds()...)
+	conj = append(conj, s.nameConds()...)
+
+	attrs := "'' AS attrs"
+	if s.selected("attrs") || s.sortsBy("attrs") {
+		attrs = "name.attrs AS attrs"
+	}
+	ranks := "0 AS votes, 0 AS rank"
+	if s.selected("rank") || s.selected("votes") {
+		ranks = "COALESCE(name.votes, 0) AS votes, " +
+			"COALESCE(name.rank, 0) AS rank"
+	}
+	q := sf(`
+		SELECT
+			name.entity AS entity,
+			name.atom_id AS atom_id,
+			name.name AS name,
+			name.year AS year,
+			%s,
+			%s,
+			%s,
+			%s,
+			0 AS growth
+		FROM search_index AS name
+		WHERE %s
+		%s
+		%s
+		`,
+		s.similarColumn("name.name"), attrs, ranks, s.creditAttrs(),
+		strings.Join(conj, " AND "), s.orderby(), s.limitClause())
+	if s.debug {
+		pef("%s\n", q)
+	}
+	return q
+}
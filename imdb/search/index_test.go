@@ -0,0 +1,96 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/ty/fun"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+func TestIndexable(t *testing.T) {
+	tests := []struct {
+		query     string
+		indexable bool
+	}{
+		{"the matrix", true},
+		{"the matrix {movie} {years:1999-2003}", true},
+		{"{rank:70-} {votes:10000-} {sort:bayes}", true},
+		{"{re:^the} {limit:5} {columns:attrs}", true},
+		{"the matrix {popular}", true},
+		{"the matrix {genre:action}", false},
+		{"the matrix {mpaa:R}", false},
+		{"{role:director}", false},
+		{"{episode} {seasons:1-2}", false},
+		{"{movie} {notv}", false},
+		{"{episode} {sort:season asc}", false},
+	}
+	for _, test := range tests {
+		s := New(nil)
+		s.db = &imdb.DB{Driver: "postgres"} // {re} fails on SQLite
+		if err := s.Query(test.query); err != nil {
+			t.Fatalf("%s: %s", test.query, err)
+		}
+		if got := s.indexable(); got != test.indexable {
+			t.Errorf("%s: expected indexable to be %v but got %v",
+				test.query, test.indexable, got)
+			continue
+		}
+		if !test.indexable {
+			continue
+		}
+
+		s.indexed = true
+		q := s.sql()
+		if !strings.Contains(q, "FROM search_index AS name") {
+			t.Errorf("%s: expected search index in query:\n%s", test.query, q)
+		}
+		if strings.Contains(q, "JOIN") || strings.Contains(q, "rating.") {
+			t.Errorf("%s: unexpected join in query:\n%s", test.query, q)
+		}
+	}
+}
+
+func TestBuildIndexRestoresIndices(t *testing.T) {
+	db, done := openTestMovies(t, "The Matrix")
+	defer done()
+
+	var want []string
+	for _, table := range imdb.Schema() {
+		if table.Name == "search_index" {
+			for _, idx := range table.Indices {
+				if len(idx.Fulltext) > 0 {
+					continue // only on PostgreSQL
+				}
+				want = append(want, table.IndexName(idx))
+			}
+		}
+	}
+	check := func(when string) {
+		names, err := db.IndexNames()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range want {
+			if !fun.In(name, names) {
+				t.Errorf("%s: index %s is missing", when, name)
+			}
+		}
+	}
+
+	if err := BuildIndex(db); err != nil {
+		t.Fatal(err)
+	}
+	check("after building")
+
+	// Building fails without the tvshow table, but the indices that were
+	// dropped must still be created again.
+	if _, err := db.Exec("DROP TABLE tvshow"); err != nil {
+		t.Fatal(err)
+	}
+	if err := BuildIndex(db); err == nil {
+		t.Fatal("expected building the index to fail")
+	}
+	check("after failing")
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+func TestResultJSON(t *testing.T) {
+	r := Result{Entity: imdb.EntityEpisode, Id: 5, Name: "HOMR", Year: 2001}
+	r.ExternalId = "x"
+	defer func() { imdb.JSONSnakeCase = false }()
+	for _, snake := range []bool{false, true} {
+		imdb.JSONSnakeCase = snake
+		bs, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(bs, &got); err != nil {
+			t.Fatal(err)
+		}
+		key := "externalId"
+		if snake {
+			key = "external_id"
+		}
+		if got[key] != "x" || got["entity"] != "episode" {
+			t.Errorf("unexpected JSON (snake case: %v): %s", snake, bs)
+		}
+	}
+}
+
+// protoFields returns the names of the fields of each message in
+// proto/goim.proto.
+func protoFields(t *testing.T) map[string][]string {
+	bs, err := ioutil.ReadFile("../../proto/goim.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := regexp.MustCompile(`^message (\w+) {`)
+	field := regexp.MustCompile(`^\s*(?:repeated )?[\w.<>, ]+ (\w+) = \d+;`)
+	fields := make(map[string][]string)
+	var name string
+	for _, line := range strings.Split(string(bs), "\n") {
+		if m := message.FindStringSubmatch(line); m != nil {
+			name = m[1]
+		} else if m := field.FindStringSubmatch(line); m != nil {
+			fields[name] = append(fields[name], m[1])
+		}
+	}
+	return fields
+}
+
+// TestProtoFields checks that the messages in proto/goim.proto have the same
+// fields as the JSON keys of the values they mirror.
+func TestProtoFields(t *testing.T) {
+	values := map[string]interface{}{
+		"Movie":          &imdb.Movie{},
+		"Tvshow":         &imdb.Tvshow{},
+		"Episode":        &imdb.Episode{},
+		"Actor":          &imdb.Actor{},
+		"UserRank":       imdb.UserRank{},
+		"RatingSnapshot": imdb.RatingSnapshot{},
+		"Source":         imdb.Source{},
+		"Credit":         Credit{},
+		"Result":         Result{},
+	}
+	defer func() { imdb.JSONSnakeCase = false }()
+	imdb.JSONSnakeCase = true
+
+	fields := protoFields(t)
+	for name, v := range values {
+		bs, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var obj map[string]interface{}
+		if err := json.Unmarshal(bs, &obj); err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		want := append([]string(nil), fields[name]...)
+		sort.Strings(keys)
+		sort.Strings(want)
+		if strings.Join(keys, " ") != strings.Join(want, " ") {
+			t.Errorf("message %s has fields %v, but its JSON keys are %v",
+				name, want, keys)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// langCountries maps two letter language and country codes to the names of
+// countries used in the attributes of IMDb's AKA titles. When a code is both
+// a language and a country code, the more common use wins (e.g., 'de' is
+// German and 'uk' is the United Kingdom). Countries are listed in order of
+// preference.
+var langCountries = map[string][]string{
+	"ar": {"Egypt", "Saudi Arabia", "Lebanon"},
+	"br": {"Brazil"},
+	"cs": {"Czech Republic", "Czechoslovakia"},
+	"cz": {"Czech Republic", "Czechoslovakia"},
+	"da": {"Denmark"},
+	"de": {"Germany", "West Germany", "Austria", "Switzerland"},
+	"dk": {"Denmark"},
+	"el": {"Greece"},
+	"en": {"USA", "UK", "Canada", "Australia", "Ireland", "New Zealand"},
+	"es": {"Spain", "Mexico", "Argentina"},
+	"fi": {"Finland"},
+	"fr": {"France", "Canada", "Belgium", "Switzerland"},
+	"gr": {"Greece"},
+	"he": {"Israel"},
+	"hu": {"Hungary"},
+	"it": {"Italy"},
+	"ja": {"Japan"},
+	"jp": {"Japan"},
+	"ko": {"South Korea"},
+	"kr": {"South Korea"},
+	"mx": {"Mexico"},
+	"nl": {"Netherlands", "Belgium"},
+	"no": {"Norway"},
+	"pl": {"Poland"},
+	"pt": {"Portugal", "Brazil"},
+	"ro": {"Romania"},
+	"ru": {"Russia", "Soviet Union"},
+	"sv": {"Sweden"},
+	"se": {"Sweden"},
+	"tr": {"Turkey"},
+	"uk": {"UK"},
+	"us": {"USA"},
+	"zh": {"China", "Taiwan", "Hong Kong"},
+}
+
+// PreferLang specifies that the name of each result should be replaced by
+// its AKA title for the language or country given, when there is one. The
+// original name is kept in Result.OriginalName. The language may be a two
+// letter language or country code (e.g., "de") or the name of a country as
+// it appears in the attributes of IMDb's AKA titles (e.g., "Germany").
+//
+// This only changes the names of results, not which results are found.
+// Actors and results from a fallback are never changed.
+func (s *Searcher) PreferLang(lang string) *Searcher {
+	if countries, ok := langCountries[strings.ToLower(lang)]; ok {
+		s.preferLang = countries
+	} else {
+		s.preferLang = []string{lang}
+	}
+	return s
+}
+
+// localize replaces the name of each result with its preferred AKA title.
+// See PreferLang.
+func (s *Searcher) localize(rs []Result) {
+	var ids []string
+	for _, r := range rs {
+		if r.Entity != imdb.EntityActor && !r.External {
+			ids = append(ids, sf("%d", r.Id))
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	type aka struct {
+		title string
+		score int
+	}
+	best := make(map[imdb.Atom]aka)
+	rows := csql.Query(s.db, sf(`
+		SELECT atom_id, title, attrs FROM aka_title WHERE atom_id IN (%s)
+	`, strings.Join(ids, ", ")))
+	csql.ForRow(rows, func(scanner csql.RowScanner) {
+		var id imdb.Atom
+		var title, attrs string
+		csql.Scan(scanner, &id, &title, &attrs)
+		if score := s.akaScore(attrs); score > best[id].score {
+			best[id] = aka{title, score}
+		}
+	})
+	for i := range rs {
+		if a, ok := best[rs[i].Id]; ok {
+			rs[i].OriginalName = rs[i].Name
+			rs[i].Name = a.title
+		}
+	}
+}
+
+// akaScore returns how well the attributes of an AKA title match the
+// preferred countries. Bigger is better and 0 means no match. Titles for
+// earlier countries are preferred, and titles whose attributes are only the
+// country are preferred over those with other notes (like
+// '(working title)').
+func (s *Searcher) akaScore(attrs string) int {
+	attrs = strings.ToLower(strings.TrimSpace(attrs))
+	for i, country := range s.preferLang {
+		paren := "(" + strings.ToLower(country) + ")"
+		base := 2 * (len(s.preferLang) - i)
+		if attrs == paren {
+			return base
+		} else if strings.Contains(attrs, paren) &&
+			!strings.Contains(attrs, "working title") {
+			return base - 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,21 @@
+package search
+
+import (
+	"testing"
+)
+
+func TestAkaScore(t *testing.T) {
+	s := New(nil).PreferLang("de")
+	if s.akaScore("(Germany)") <= s.akaScore("(Austria)") {
+		t.Errorf("expected Germany to be preferred over Austria")
+	}
+	if s.akaScore("(Germany)") <= s.akaScore("(Germany) (TV title)") {
+		t.Errorf("expected a plain AKA to be preferred")
+	}
+	if s.akaScore("(Germany) (working title)") != 0 {
+		t.Errorf("expected working titles to be ignored")
+	}
+	if s.akaScore("(France)") != 0 {
+		t.Errorf("expected France not to match")
+	}
+}
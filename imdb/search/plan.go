@@ -0,0 +1,187 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// Every search joins the 'name' table with the tables of each kind of entity
+// (movie, tvshow, episode and actor). All other tables are only joined when
+// something in the search refers to them: a column that is selected, a
+// filter or a sort criterion. Joining fewer tables makes a big difference
+// with SQLite, which doesn't optimize away unused LEFT JOINs.
+
+// optionalJoin is a table that is only joined when a search needs it.
+type optionalJoin struct {
+	// alias is the name used to refer to the joined table in queries.
+	alias string
+
+	// needed returns true when the search refers to the joined table.
+	needed func(s *Searcher) bool
+
+	// sql returns the join clause.
+	sql func(s *Searcher) string
+}
+
+// optionalJoins lists every table that is only joined when needed, in the
+// order they are joined.
+var optionalJoins = []optionalJoin{
+	{
+		"et",
+		func(s *Searcher) bool {
+			return (s.selected("attrs") || s.sortsBy("attrs")) &&
+				s.mayReturn(imdb.EntityEpisode)
+		},
+		func(s *Searcher) string {
+			return "LEFT JOIN name AS et ON e.tvshow_atom_id = et.atom_id"
+		},
+	},
+	{
+		"rating",
+		func(s *Searcher) bool {
+			return s.selected("rank") || s.selected("votes") ||
+				s.rating != nil || s.votes != nil || s.popular ||
+				s.sortsBy("rank") || s.sortsBy("votes") || s.sortsBy("bayes")
+		},
+		func(s *Searcher) string {
+			return "LEFT JOIN rating ON name.atom_id = rating.atom_id"
+		},
+	},
+	{
+		"trend",
+		func(s *Searcher) bool {
+			return len(s.trend) > 0 || s.sortsBy("growth")
+		},
+		func(s *Searcher) string {
+			// Growth is the difference in votes between the two most recent
+			// generations in the rating history, which are found once.
+			return `
+		LEFT JOIN (
+			SELECT cur.atom_id, cur.votes - prev.votes AS growth
+			FROM (
+				SELECT latest, (
+					SELECT MAX(generation) FROM rating_history
+					WHERE generation < latest
+				) AS previous
+				FROM (
+					SELECT MAX(generation) AS latest FROM rating_history
+				) AS l
+			) AS gen
+			JOIN rating_history AS cur ON cur.generation = gen.latest
+			JOIN rating_history AS prev
+				ON prev.atom_id = cur.atom_id
+				AND prev.generation = gen.previous
+		) AS trend ON name.atom_id = trend.atom_id
+		`
+		},
+	},
+	{
+		"mpaa_rating",
+		func(s *Searcher) bool { return len(s.mpaas) > 0 },
+		func(s *Searcher) string {
+			return "LEFT JOIN mpaa_rating " +
+				"ON name.atom_id = mpaa_rating.atom_id"
+		},
+	},
+	{
+		"c_actor",
+		func(s *Searcher) bool { return !s.subCast.empty() },
+		func(s *Searcher) string {
+			return sf(`
+		LEFT JOIN credit AS c_actor ON
+			%s
+		`, s.creditJoin(s.subCast, "c_actor", "actor_atom_id",
+				"media_atom_id", "name.atom_id"))
+		},
+	},
+	{
+		"c_media",
+		func(s *Searcher) bool { return !s.subCredits.empty() },
+		func(s *Searcher) string {
+			return sf(`
+		LEFT JOIN credit AS c_media ON
+			%s
+		`, s.creditJoin(s.subCredits, "c_media", "media_atom_id",
+				"actor_atom_id", "a.atom_id"))
+		},
+	},
+	{
+		"c_bio",
+		func(s *Searcher) bool {
+			credits := !s.subCast.empty() || !s.subCredits.empty()
+			return credits && (s.selected("credit") || s.ageAtRelease != nil)
+		},
+		func(s *Searcher) string {
+			join := sf(`
+		LEFT JOIN biography AS c_bio ON
+			%s = c_bio.atom_id
+		`, s.creditColumn("actor_atom_id"))
+			if s.subCredits.empty() {
+				return join
+			}
+			// The media of credits found by '{credits:...}' aren't the
+			// results, so their years are joined separately.
+			media := s.creditColumn("media_atom_id")
+			return join + sf(`
+		LEFT JOIN movie AS c_m ON %s = c_m.atom_id
+		LEFT JOIN tvshow AS c_t ON %s = c_t.atom_id
+		LEFT JOIN episode AS c_e ON %s = c_e.atom_id
+		`, media, media, media)
+		},
+	},
+}
+
+// joins returns the join clauses for every optional table needed by the
+// search.
+func (s *Searcher) joins() string {
+	var joins []string
+	for _, j := range optionalJoins {
+		if j.needed(s) {
+			joins = append(joins, j.sql(s))
+		}
+	}
+	return strings.Join(joins, "\n\t\t")
+}
+
+// joined returns true if the optional table with the alias given is joined
+// in the search.
+func (s *Searcher) joined(alias string) bool {
+	for _, j := range optionalJoins {
+		if j.alias == alias {
+			return j.needed(s)
+		}
+	}
+	return false
+}
+
+// orderable returns true if the qualified column given can be used to sort
+// the search, i.e., if its table is joined. Columns of tables that aren't
+// optional are always orderable.
+func (s *Searcher) orderable(qualified string) bool {
+	dot := strings.Index(qualified, ".")
+	if dot == -1 {
+		return true
+	}
+	alias := qualified[:dot]
+	for _, j := range optionalJoins {
+		if j.alias == alias {
+			return j.needed(s)
+		}
+	}
+	return true
+}
+
+// mayReturn returns true if results of the entity kind given may be returned
+// by the search.
+func (s *Searcher) mayReturn(ent imdb.EntityKind) bool {
+	if len(s.entities) == 0 {
+		return true
+	}
+	for _, e := range s.entities {
+		if e == ent {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+package search
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+func TestJoinPlanner(t *testing.T) {
+	tests := []struct {
+		query       string
+		joined, not []string
+		setup       func(s *Searcher)
+	}{
+		{
+			query:  "the matrix",
+			joined: []string{"AS et", "JOIN rating"},
+			not:    []string{"JOIN mpaa_rating", "credit AS c_actor", "credit AS c_media"},
+		},
+		{
+			query:  "the matrix {movie}",
+			joined: []string{"JOIN rating"},
+			not:    []string{"AS et", "JOIN mpaa_rating"},
+		},
+		{
+			query:  "the matrix {mpaa:R}",
+			joined: []string{"JOIN mpaa_rating"},
+		},
+		{
+			query: "the matrix {columns:attrs}",
+			not:   []string{"JOIN rating"},
+		},
+		{
+			query:  "the matrix {columns:attrs} {rank:70-}",
+			joined: []string{"JOIN rating"},
+		},
+		{
+			query:  "the matrix {columns:attrs} {popular}",
+			joined: []string{"JOIN rating", "rating.votes >= 1000"},
+		},
+		{
+			query:  "{columns:credit} {sort:bayes}",
+			joined: []string{"JOIN rating"},
+			not:    []string{"AS et"},
+		},
+		{
+			query: "{sort:billing asc}",
+			not:   []string{"c_media.position"},
+		},
+		{
+			query:  "{sort:billing asc}",
+			joined: []string{"JOIN credit AS c_media", "c_media.position"},
+			setup: func(s *Searcher) {
+				s.subCredits = &subsearch{New(nil), []imdb.Atom{1}}
+			},
+		},
+		{
+			query:  "{ageatrelease:-25}",
+			joined: []string{"JOIN biography AS c_bio", "JOIN movie AS c_m"},
+			setup: func(s *Searcher) {
+				s.subCredits = &subsearch{New(nil), []imdb.Atom{1}}
+			},
+		},
+		{
+			query:  "{ageatrelease:-25} {columns:attrs}",
+			joined: []string{"JOIN biography AS c_bio", "<= 25"},
+			not:    []string{"JOIN movie AS c_m"},
+			setup: func(s *Searcher) {
+				s.subCast = &subsearch{New(nil), []imdb.Atom{1}}
+			},
+		},
+		{
+			query: "{ageatrelease:-25}",
+			not:   []string{"JOIN biography"},
+		},
+		{
+			query:  "{columns:credit}",
+			joined: []string{"c_actor.actor_atom_id = 1"},
+			not:    []string{"MIN(dup.actor_atom_id)"},
+			setup: func(s *Searcher) {
+				s.subCast = &subsearch{New(nil), []imdb.Atom{1}}
+			},
+		},
+		{
+			query: "{columns:credit} {billing:1-3}",
+			joined: []string{
+				"c_actor.actor_atom_id IN (1, 2)",
+				"MIN(dup.actor_atom_id)",
+				"dup.position",
+			},
+			setup: func(s *Searcher) {
+				s.subCast = &subsearch{New(nil), []imdb.Atom{1, 2}}
+			},
+		},
+		{
+			query:  "{franchise:james bond}",
+			joined: []string{"FROM franchise", "ORDER BY COALESCE(m.year"},
+		},
+		{
+			query: "{franchise:james bond} {sort:rank desc}",
+			not:   []string{"ORDER BY COALESCE(m.year"},
+		},
+		{
+			query: "{trend:rising} {movie}",
+			joined: []string{"AS trend", "trend.growth > 0",
+				"ORDER BY trend.growth DESC",
+				"COALESCE(trend.growth, 0) AS growth"},
+		},
+		{
+			query:  "{movie} {sort:year asc}",
+			joined: []string{"0 AS growth"},
+			not:    []string{"AS trend"},
+		},
+		{
+			query:  "{list:letterboxd} {tag:watchlist}",
+			joined: []string{"SELECT namespace FROM overlay", "SELECT tag FROM overlay"},
+		},
+		{
+			query:  "{role:actress} {role:director}",
+			joined: []string{"source = 'actresses'", "role IN('director')"},
+		},
+	}
+	for _, test := range tests {
+		s := New(nil)
+		s.db = &imdb.DB{Driver: "sqlite3"}
+		if err := s.Query(test.query); err != nil {
+			t.Fatalf("%s: %s", test.query, err)
+		}
+		if test.setup != nil {
+			test.setup(s)
+		}
+		q := s.sql()
+		for _, want := range test.joined {
+			if !strings.Contains(q, want) {
+				t.Errorf("%s: expected '%s' in query:\n%s", test.query, want, q)
+			}
+		}
+		for _, notWant := range test.not {
+			if strings.Contains(q, notWant) {
+				t.Errorf("%s: unexpected '%s' in query:\n%s",
+					test.query, notWant, q)
+			}
+		}
+	}
+}
+
+// TestPlanConcurrent plans the same queries in many goroutines sharing one
+// database, which the race detector checks for shared state.
+func TestPlanConcurrent(t *testing.T) {
+	db := &imdb.DB{Driver: "sqlite3"}
+	queries := []string{
+		"the matrix {years:1999-2003} {cast:keanu reeves}",
+		"{show:simpsons} {sort:rank desc} {limit:10} {votes:500-}",
+		"{list:letterboxd} {tag:watchlist} {genre:horror}",
+		"{role:actress} {role:director}",
+	}
+	plan := func(q string) (string, error) {
+		s := New(nil)
+		s.db = db
+		if err := s.Query(q); err != nil {
+			return "", err
+		}
+		return s.sql(), nil
+	}
+	want := make([]string, len(queries))
+	for i, q := range queries {
+		var err error
+		if want[i], err = plan(q); err != nil {
+			t.Fatalf("%s: %s", q, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, q := range queries {
+				got, err := plan(q)
+				if err != nil {
+					t.Errorf("%s: %s", q, err)
+				} else if got != want[i] {
+					t.Errorf("%s: planned differently:\n%s", q, got)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRegexConds(t *testing.T) {
+	tests := []struct {
+		driver        string
+		caseSensitive bool
+		want          string
+	}{
+		{"postgres", false, "name.name ~* '^Star (Wars|Trek)'"},
+		{"postgres", true, "name.name ~ '^Star (Wars|Trek)'"},
+		{"sqlite3", false, "name.name REGEXP '^Star (Wars|Trek)'"},
+		{"sqlite3", true, "name.name REGEXP '^Star (Wars|Trek)'"},
+		{"duckdb", false,
+			"regexp_matches(name.name, '^Star (Wars|Trek)', 'i')"},
+		{"duckdb", true, "regexp_matches(name.name, '^Star (Wars|Trek)')"},
+	}
+	for _, test := range tests {
+		s := New(nil)
+		s.db = &imdb.DB{Driver: test.driver}
+		s.Regex("^Star (Wars|Trek)").CaseSensitive(test.caseSensitive)
+		if q := s.sql(); !strings.Contains(q, test.want) {
+			t.Errorf("%s (case sensitive: %v): expected '%s' in query:\n%s",
+				test.driver, test.caseSensitive, test.want, q)
+		}
+	}
+
+	s := New(nil)
+	s.db = &imdb.DB{Driver: "sqlite3"}
+	if err := s.Query("{regex:^Star}"); err == nil {
+		t.Errorf("expected {regex} to fail on SQLite")
+	}
+	s.db = &imdb.DB{Driver: "postgres"}
+	if err := s.Query("{regex:^Star}"); err != nil {
+		t.Errorf("{regex} on PostgreSQL: %s", err)
+	}
+}
+
+func TestBayesVotes(t *testing.T) {
+	for _, v := range []string{"0", "-5"} {
+		if err := New(nil).Query("{bayesvotes:" + v + "}"); err == nil {
+			t.Errorf("expected an error for {bayesvotes:%s}", v)
+		}
+	}
+
+	s := New(nil)
+	s.db = &imdb.DB{Driver: "sqlite3"}
+	if err := s.Query("{sort:bayes} {bayesvotes:1}"); err != nil {
+		t.Fatal(err)
+	}
+	s.BayesVotes(0) // ignored
+	if q := s.sql(); !strings.Contains(q, "/ (rating.votes + 1.0)") {
+		t.Errorf("expected 1 vote to weight ranks in query:\n%s", q)
+	}
+}
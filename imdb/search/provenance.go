@@ -0,0 +1,128 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// Provenance maps the JSON keys of the fields of a result (e.g., 'name' or
+// 'rank') to the source of their data. Fields without data are missing.
+type Provenance = imdb.Provenance
+
+// Provenance specifies that every result should record where its data came
+// from in its Provenance: the list each field was loaded from and the
+// generation that list was last loaded in, or the online service that an
+// external result was found with. This helps tell apart data from lists that
+// are loaded at different times, and from online services.
+func (s *Searcher) Provenance() *Searcher {
+	s.provenance = true
+	return s
+}
+
+// creditKey identifies the credit of a result.
+type creditKey struct {
+	actor, media    imdb.Atom
+	role, character string
+}
+
+// annotate sets the Provenance of every result.
+func (s *Searcher) annotate(rs []Result) (err error) {
+	defer csql.Safe(&err)
+
+	gens, err := s.db.ListGenerations()
+	csql.Panic(err)
+	source := func(list string) imdb.Source {
+		return imdb.Source{List: list, Generation: gens[list]}
+	}
+	credits := s.creditSources(rs)
+	actors, err := imdb.ActorLists(s.db, s.actorIds(rs))
+	csql.Panic(err)
+	for i := range rs {
+		r := &rs[i]
+		if r.External {
+			// External identifiers start with the name of the service.
+			service := strings.SplitN(r.ExternalId, ":", 2)[0]
+			r.Provenance = Provenance{
+				"name": {List: service},
+				"year": {List: service},
+			}
+			continue
+		}
+
+		list := imdb.EntityLists[r.Entity]
+		if r.Entity == imdb.EntityActor {
+			list = actors[r.Id]
+		}
+		p := Provenance{}
+		if len(list) > 0 {
+			ent := source(list)
+			p["name"] = ent
+			if r.Year > 0 {
+				p["year"] = ent
+			}
+			if len(r.Attrs) > 0 {
+				p["attrs"] = ent
+			}
+			if len(r.OriginalName) > 0 {
+				p["name"] = source("aka-titles")
+				p["originalName"] = ent
+			}
+		}
+		if !r.Rank.Unranked() {
+			p["rank"] = source("ratings")
+		}
+		if r.Credit.Valid() {
+			c := r.Credit
+			key := creditKey{c.ActorId, c.MediaId, c.Role, c.Character}
+			if list := credits[key]; len(list) > 0 {
+				p["credit"] = source(list)
+			}
+		}
+		r.Provenance = p
+	}
+	return
+}
+
+// actorIds returns the identifiers of the actors in the results given.
+func (s *Searcher) actorIds(rs []Result) []imdb.Atom {
+	var ids []imdb.Atom
+	for _, r := range rs {
+		if r.Entity == imdb.EntityActor && !r.External {
+			ids = append(ids, r.Id)
+		}
+	}
+	return ids
+}
+
+// creditSources returns the list that the credit of each result was loaded
+// from, when it's known.
+func (s *Searcher) creditSources(rs []Result) map[creditKey]string {
+	var actors, media []imdb.Atom
+	for _, r := range rs {
+		if r.Credit.Valid() {
+			actors = append(actors, r.Credit.ActorId)
+			media = append(media, r.Credit.MediaId)
+		}
+	}
+	sources := make(map[creditKey]string)
+	if len(actors) == 0 {
+		return sources
+	}
+	rows := csql.Query(s.db, sf(`
+		SELECT actor_atom_id, media_atom_id, role, character, source
+		FROM credit
+		WHERE actor_atom_id IN (%s) AND media_atom_id IN (%s)
+			AND source != ''
+		`, atomList(actors), atomList(media)))
+	csql.ForRow(rows, func(scanner csql.RowScanner) {
+		var key creditKey
+		var source string
+		csql.Scan(scanner, &key.actor, &key.media, &key.role,
+			&key.character, &source)
+		sources[key] = source
+	})
+	return sources
+}
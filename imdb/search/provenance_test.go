@@ -0,0 +1,20 @@
+package search
+
+import "testing"
+
+func TestProvenanceString(t *testing.T) {
+	p := Provenance{
+		"rank": {List: "ratings", Generation: 4},
+		"name": {List: "movies", Generation: 3},
+		"year": {List: "omdb"},
+	}
+	want := "name: movies@3, rank: ratings@4, year: omdb"
+	if got := p.String(); got != want {
+		t.Errorf("expected '%s' but got '%s'", want, got)
+	}
+
+	var empty Provenance
+	if got := empty.String(); got != "" {
+		t.Errorf("expected no sources but got '%s'", got)
+	}
+}
@@ -0,0 +1,99 @@
+package search
+
+import (
+	"database/sql"
+	"regexp"
+	"time"
+
+	"github.com/BurntSushi/csql"
+)
+
+// RegexTimeout is the longest that a search with regular expressions may run
+// on PostgreSQL before it is canceled. Regular expressions can't use
+// indices, so every name in the database is checked. (SQLite has no
+// statement timeout.) It should only be set before searching.
+var RegexTimeout = 30 * time.Second
+
+// maxRegexLen is the longest regular expression accepted by Regex.
+const maxRegexLen = 256
+
+// Regex adds a regular expression that names in the results must match. If
+// Regex is called more than once, then names must match every expression.
+//
+// On PostgreSQL, the '~*' operator is used (or '~' when the search is case
+// sensitive, see CaseSensitive), and on DuckDB, regexp_matches is used. So
+// matching is case insensitive unless the search is case sensitive.
+//
+// On SQLite, the REGEXP operator is used, which needs a 'regexp' function
+// to be installed in SQLite (e.g., with its regexp extension). The SQLite
+// driver used by Goim can't install one, so searching fails with an error
+// unless the driver was built with one. Matching is then always case
+// sensitive. (The {regex} directive always fails on SQLite.)
+//
+// Expressions that Go's regexp package can't parse or that are longer than
+// 256 bytes are silently ignored. (Most expressions accepted by Go are
+// accepted by PostgreSQL and SQLite.)
+func (s *Searcher) Regex(pattern string) *Searcher {
+	if validRegex(pattern) == nil {
+		s.regexes = append(s.regexes, pattern)
+	}
+	return s
+}
+
+// errRegexSQLite is the reason that the {regex} directive fails on SQLite.
+const errRegexSQLite = "regular expressions are not supported on SQLite " +
+	"(it has no 'regexp' function)"
+
+// validRegex returns an error if the pattern given is not acceptable to
+// Regex.
+func validRegex(pattern string) error {
+	if len(pattern) > maxRegexLen {
+		return ef("longer than %d bytes", maxRegexLen)
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return err
+	}
+	return nil
+}
+
+// regexConds returns a condition for each regular expression in the search.
+func (s *Searcher) regexConds() []string {
+	var conj []string
+	for _, pat := range s.regexes {
+		switch {
+		case s.db.Driver == "duckdb" && s.caseSensitive:
+			conj = append(conj,
+				sf("regexp_matches(name.name, %s)", sqlString(pat)))
+		case s.db.Driver == "duckdb":
+			conj = append(conj,
+				sf("regexp_matches(name.name, %s, 'i')", sqlString(pat)))
+		case s.db.Driver != "postgres":
+			conj = append(conj, sf("name.name REGEXP %s", sqlString(pat)))
+		case s.caseSensitive:
+			conj = append(conj, sf("name.name ~ %s", sqlString(pat)))
+		default:
+			conj = append(conj, sf("name.name ~* %s", sqlString(pat)))
+		}
+	}
+	return conj
+}
+
+// prepareRegex sets up the transaction given for a search with regular
+// expressions. On PostgreSQL, a statement timeout is set. On SQLite, an error
+// is returned if the REGEXP operator isn't available. DuckDB always has
+// regular expressions.
+func (s *Searcher) prepareRegex(tx *sql.Tx) error {
+	if len(s.regexes) == 0 || s.db.Driver == "duckdb" {
+		return nil
+	}
+	if s.db.Driver == "postgres" {
+		csql.Exec(tx, sf("SET LOCAL statement_timeout = %d",
+			RegexTimeout/time.Millisecond))
+		return nil
+	}
+	if _, err := tx.Exec("SELECT 'a' REGEXP 'a'"); err != nil {
+		return ef("Regular expressions are not supported on SQLite unless "+
+			"a 'regexp' function is installed. %s", err)
+	}
+	return nil
+}
@@ -44,6 +44,44 @@ type Result struct {
 
 	// If the search accesses credit information, then it will be stored here.
 	Credit Credit
+
+	// Growth is the number of votes that the entity gained between the two
+	// most recent generations of the rating history, when the search has a
+	// trend (see Searcher.Trend) or is sorted by growth. Otherwise, it is 0.
+	Growth int
+
+	// Confidence is an estimate in the interval [0, 1] of how likely it is
+	// that this result is the entity being searched for. It combines the
+	// similarity of the name, agreement with the years searched and
+	// popularity. See ConfidenceAccept and ConfidenceReject for suggested
+	// ways to act on it.
+	Confidence float64
+
+	// External is true when the result was not found in the database but by
+	// a fallback (see Searcher.Fallback), e.g., an online service.
+	// External results have no atom identifier, so they cannot be used to
+	// retrieve entities from the database.
+	External   bool
+	ExternalId string
+
+	// Parts is set when consecutive episodes were combined into this result
+	// (see Searcher.CombineEpisodes). It contains the atom identifiers of
+	// every episode in order. The result's Id is the first episode.
+	Parts []imdb.Atom
+
+	// OriginalName is set to the name of the entity when Name has been
+	// replaced by an AKA title in a preferred language (see
+	// Searcher.PreferLang). Otherwise, it is empty.
+	OriginalName string
+
+	// Disambiguation tells this result apart from other results with the
+	// same name and year (e.g., 'II, TV movie'), when asked for with
+	// Searcher.Disambiguate. Otherwise, it is empty.
+	Disambiguation string
+
+	// Provenance is the source of each field of this result, when asked for
+	// with Searcher.Provenance. Otherwise, it is nil.
+	Provenance Provenance
 }
 
 // Credit represents the credit information available in a search result.
@@ -55,6 +93,12 @@ type Credit struct {
 	Character string
 	Position  int
 	Attrs     string
+	Role      string
+
+	// Age is the age of the actor in the year the media was released, which
+	// is -1 when either the actor's year of birth (from the 'biographies'
+	// list) or the media's year is unknown.
+	Age int
 }
 
 // Valid returns true if and only if this credit belongs to a valid movie
@@ -67,17 +111,75 @@ func (c Credit) Valid() bool {
 // to the search result. The Entity returned should correspond to the entity
 // type in the search result.
 func (sr Result) GetEntity(db csql.Queryer) (imdb.Entity, error) {
+	if sr.External {
+		return nil, ef("'%s' is an external result (%s) and is not in "+
+			"the database.", sr.Name, sr.ExternalId)
+	}
 	return imdb.FromAtom(db, sr.Entity, sr.Id)
 }
 
+// MarshalJSON encodes a search result with the same key conventions as the
+// entities in the imdb package. (See imdb.JSONSnakeCase.)
+func (sr Result) MarshalJSON() ([]byte, error) {
+	var credit interface{}
+	if sr.Credit.Valid() {
+		credit = sr.Credit
+	}
+	return imdb.MarshalFields(
+		"entity", sr.Entity,
+		"id", sr.Id,
+		"name", sr.Name,
+		"year", sr.Year,
+		"attrs", sr.Attrs,
+		"similarity", sr.Similarity,
+		"rank", sr.Rank,
+		"credit", credit,
+		"growth", sr.Growth,
+		"confidence", sr.Confidence,
+		"external", sr.External,
+		"externalId", sr.ExternalId,
+		"parts", sr.Parts,
+		"originalName", sr.OriginalName,
+		"disambiguation", sr.Disambiguation,
+		"provenance", sr.Provenance,
+	)
+}
+
+// MarshalJSON encodes the credit of a search result.
+func (c Credit) MarshalJSON() ([]byte, error) {
+	return imdb.MarshalFields(
+		"actorId", c.ActorId,
+		"mediaId", c.MediaId,
+		"character", c.Character,
+		"position", c.Position,
+		"attrs", c.Attrs,
+		"role", c.Role,
+		"age", c.Age,
+	)
+}
+
 func (sr Result) String() string {
-	return sf("(%s) %s (%d) (%s)", sr.Entity, sr.Name, sr.Year, sr.Attrs)
+	s := sf("(%s) %s (%d) (%s)", sr.Entity, sr.Name, sr.Year, sr.Attrs)
+	if len(sr.Disambiguation) > 0 {
+		s += sf(" (%s)", sr.Disambiguation)
+	}
+	return s
 }
 
 // Searcher represents the parameters of a search.
+//
+// A Searcher is not safe for concurrent use, but any number of Searchers
+// (each used by one goroutine) may search the same database at once.
 type Searcher struct {
 	db                              *imdb.DB
 	fuzzy                           bool     // whether to use fuzzy searching
+	trigram                         bool     // whether pg_trgm is available
+	rankWild                        bool     // rank wildcard searches
+	caseSensitive                   bool     // case sensitive text matching
+	regexes                         []string // regular expressions on names
+	similarity                      string   // similarity function for ranking
+	bayesVotes                      int      // 'm' in the bayes sort
+	preferLang                      []string // countries of preferred AKAs
 	name                            []string // text to search in name table
 	what                            string   // used to identify sub-searches
 	debug                           bool     // whether to output SQL query
@@ -85,15 +187,31 @@ type Searcher struct {
 	entities                        []imdb.EntityKind
 	genres                          []string
 	mpaas                           []string
+	tags                            []string
+	lists                           []string
+	roles                           []string
+	franchises                      []string
+	trend                           string
 	order                           []searchOrder
 	limit                           int
 	goodThreshold, similarThreshold float64
 	chooser                         Chooser
+	multiChooser                    MultiChooser
+	autopick                        bool
+	fallback                        Fallback
+	postFilters                     []PostFilter
 
 	subTvshow, subCredits, subCast                *subsearch
 	year, rating, votes, season, episode, billing *irange
+	absolute, ageAtRelease                        *irange
+
+	noTvMovie, noVideoMovie  bool
+	specials, combine        bool
+	disambiguate, provenance bool
+	indexed                  bool // whether search_index is used
 
-	noTvMovie, noVideoMovie bool
+	columns map[string]bool // selected columns (nil for all of them)
+	popular bool            // only entities with imdb.PopularVotes
 }
 
 // Chooser corresponds to a function called by the searcher in this
@@ -115,6 +233,39 @@ type Searcher struct {
 // represents the thing being searched. (e.g., "TV show".)
 type Chooser func([]Result, string) (*Result, error)
 
+// MultiChooser is like Chooser, except it may pick any number of results.
+// When a MultiChooser is set on a searcher, it is used instead of the Chooser
+// to resolve ambiguous sub-searches. The parent search is then restricted to
+// all of the entities picked. For example, a search for episodes with
+// '{show:the office}' can include episodes from both the US and UK shows.
+//
+// If the slice returned is empty and the error is nil, then the search will
+// return no results without error.
+type MultiChooser func([]Result, string) ([]Result, error)
+
+// Fallback corresponds to a function called by the searcher when a search
+// with text returns no results from the database. It is given the text of
+// the search, a year (or 0 if the search has no year) and the entity types
+// the search is restricted to (which may be empty).
+//
+// Every result returned is marked as external. Results should set
+// ExternalId to an identifier that is meaningful to the fallback (e.g.,
+// "omdb:tt0133093").
+//
+// See the imdb/online package for a fallback that searches online services.
+type Fallback func(string, int, []imdb.EntityKind) ([]Result, error)
+
+// PostFilter corresponds to a function called by the searcher on the results
+// of a search after they have been retrieved from the database (and from the
+// fallback, if there is one). It returns the results that should be kept, in
+// the order they should be returned. A post-filter may remove, reorder or
+// change results, which makes it possible to apply rules (like blocklists or
+// deduplication) that can't be expressed in a search query.
+//
+// Note that post-filters run after the limit is applied, so a search may
+// return fewer results than its limit.
+type PostFilter func([]Result) []Result
+
 // searchOrder represents a sorting criteria along with an order. The sorting
 // criteria is a SQL column while the order is either ascending or descending.
 type searchOrder struct {
@@ -129,12 +280,12 @@ type irange struct {
 // subsearch represents an optionally empty sub-search. A sub-search is just
 // like a regular search, except it filters the results of its parent search.
 // Every sub-search (just like a regular search) returns results of entities
-// which are shrunk to either 0 or 1 entities. If 0, then the entire search
-// will fail. If 1, then the 'id' field is filled in with the corresponding
-// atom identifier.
+// which are shrunk to 0 or more entities (only one unless a MultiChooser is
+// used). If 0, then the entire search will fail. Otherwise, the 'ids' field
+// is filled in with the corresponding atom identifiers.
 type subsearch struct {
 	*Searcher
-	id imdb.Atom // -1 will cause the parent search to fail.
+	ids []imdb.Atom // [-1] will cause the parent search to fail.
 }
 
 // New returns a bare-bones searcher with no text to search. Once all options
@@ -142,13 +293,19 @@ type subsearch struct {
 // returned corresponds to precisely one entity in the database.
 //
 // (A bare-bones searcher can still have text to search with the Query method.)
+//
+// The database may be nil, in which case the searcher can parse queries but
+// cannot execute them. (See Validate.)
 func New(db *imdb.DB) *Searcher {
+	trigram := db != nil && db.IsFuzzyEnabled()
 	return &Searcher{
 		db:               db,
-		fuzzy:            db.IsFuzzyEnabled(),
+		fuzzy:            trigram,
+		trigram:          trigram,
 		limit:            30,
 		goodThreshold:    0.25,
 		similarThreshold: 0.4,
+		bayesVotes:       1000,
 		what:             "entity",
 	}
 }
@@ -210,15 +367,26 @@ func (s *Searcher) Text(text string) *Searcher {
 func (s *Searcher) addToken(arg string) error {
 	name, val := argOption(arg)
 	if cmd, ok := allCommands[name]; ok {
-		if cmd.hasArg && len(val) == 0 {
-			return ef("The %s command requires an argument.", name)
-		} else if !cmd.hasArg && len(val) > 0 {
-			return ef("The %s command does not have an argument.", name)
+		if cmd.hasArg() != (len(val) > 0) {
+			return &ErrDirectiveArgument{Name: name, HasArg: cmd.hasArg()}
+		}
+		// Directives don't know the name they were called by, so fill it
+		// in here.
+		switch err := cmd.add(s, val).(type) {
+		case nil:
+			return nil
+		case *ErrBadRange:
+			err.Directive = name
+			return err
+		case *ErrBadValue:
+			err.Directive = name
+			return err
+		default:
+			return err
 		}
-		return cmd.add(s, val)
 	} else {
 		if len(name) > 0 {
-			return ef("Unrecognized search option: %s", name)
+			return &ErrUnknownDirective{Name: name}
 		}
 		s.Text(arg)
 		return nil
@@ -227,11 +395,11 @@ func (s *Searcher) addToken(arg string) error {
 
 func (s *Searcher) subSearcher(name, query string) (*Searcher, error) {
 	if len(query) == 0 {
-		return nil, ef("No query found for '%s'.", name)
+		return nil, &ErrSubSearchEmpty{Kind: name}
 	}
 	sub, err := Query(s.db, query)
 	if err != nil {
-		return nil, ef("Error with sub-search for %s: %s", name, err)
+		return nil, &ErrSubSearch{Kind: name, Err: err}
 	}
 	return sub, nil
 }
@@ -240,11 +408,6 @@ func (s *Searcher) subSearcher(name, query string) (*Searcher, error) {
 func (s *Searcher) Results() (rs []Result, err error) {
 	defer csql.Safe(&err)
 
-	// Set the similarity threshold first.
-	if s.db.IsFuzzyEnabled() {
-		csql.Exec(s.db, "SELECT set_limit($1)", s.similarThreshold)
-	}
-
 	if s.subTvshow != nil {
 		if err := s.subTvshow.choose(s, s.chooser); err != nil {
 			return nil, err
@@ -261,11 +424,25 @@ func (s *Searcher) Results() (rs []Result, err error) {
 		}
 	}
 
+	// The similarity threshold is a setting of the connection, so the query
+	// must be run in the same transaction that sets it. (Otherwise, the
+	// connection pool may run the query on a different connection.)
+	tx, err := s.db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback() // read only, so there is nothing to commit
+	if err := s.prepareRegex(tx); err != nil {
+		return nil, err
+	}
+	s.indexed = s.indexable() && indexBuilt(tx)
+	if s.db.IsFuzzyEnabled() {
+		csql.Exec(tx, "SELECT set_limit($1)", s.similarThreshold)
+	}
+
 	var rows *sql.Rows
 	if len(s.name) == 0 {
-		rows = csql.Query(s.db, s.sql())
+		rows = csql.Query(tx, s.sql())
 	} else {
-		rows = csql.Query(s.db, s.sql(), strings.Join(s.name, " "))
+		rows = csql.Query(tx, s.sql(), s.nameArg())
 	}
 	csql.ForRow(rows, func(scanner csql.RowScanner) {
 		var r Result
@@ -274,10 +451,50 @@ func (s *Searcher) Results() (rs []Result, err error) {
 			&r.Similarity, &r.Attrs,
 			&r.Rank.Votes, &r.Rank.Rank,
 			&r.Credit.ActorId, &r.Credit.MediaId, &r.Credit.Character,
-			&r.Credit.Position, &r.Credit.Attrs)
+			&r.Credit.Position, &r.Credit.Attrs, &r.Credit.Role,
+			&r.Credit.Age, &r.Growth)
 		r.Entity = imdb.Entities[ent]
 		rs = append(rs, r)
 	})
+	tx.Rollback()
+
+	if s.reranked() {
+		rs = s.rerank(rs)
+	}
+	if s.combine {
+		if rs, err = s.combineEpisodes(rs); err != nil {
+			return nil, err
+		}
+	}
+	if len(rs) == 0 && s.fallback != nil && len(s.name) > 0 {
+		year := 0
+		if s.year != nil && s.year.min != nil {
+			year = *s.year.min
+		}
+		rs, err = s.fallback(strings.Join(s.name, " "), year, s.entities)
+		for i := range rs {
+			rs[i].External = true
+		}
+	}
+	for i := range rs {
+		rs[i].Confidence = s.confidence(rs[i])
+	}
+	if len(s.preferLang) > 0 {
+		s.localize(rs)
+	}
+	for _, filter := range s.postFilters {
+		rs = filter(rs)
+	}
+	if s.disambiguate {
+		if err = s.disambiguateResults(rs); err != nil {
+			return nil, err
+		}
+	}
+	if s.provenance {
+		if err = s.annotate(rs); err != nil {
+			return nil, err
+		}
+	}
 	return
 }
 
@@ -295,14 +512,10 @@ func (s *Searcher) Results() (rs []Result, err error) {
 func (s *Searcher) Pick(rs []Result) (*Result, error) {
 	if len(rs) == 0 {
 		return nil, nil
-	} else if len(rs) == 1 {
+	} else if s.goodHit(rs) {
 		return &rs[0], nil
-	} else if ft, sd := rs[0].Similarity, rs[1].Similarity; ft > -1 && sd > -1 {
-		if ft-sd >= s.goodThreshold {
-			return &rs[0], nil
-		}
 	}
-	if s.chooser == nil {
+	if s.chooser == nil || s.autopick {
 		return &rs[0], nil
 	}
 	r, err := s.chooser(rs, s.what)
@@ -315,29 +528,76 @@ func (s *Searcher) Pick(rs []Result) (*Result, error) {
 	return r, nil
 }
 
+// goodHit returns true if the first of the results given is the only result
+// or is more similar to the search than the second by at least the good
+// threshold.
+func (s *Searcher) goodHit(rs []Result) bool {
+	if len(rs) == 1 {
+		return true
+	} else if len(rs) > 1 {
+		ft, sd := rs[0].Similarity, rs[1].Similarity
+		return ft > -1 && sd > -1 && ft-sd >= s.goodThreshold
+	}
+	return false
+}
+
+// PickMany is like Pick, except it uses the searcher's MultiChooser (if one
+// is set) when there is no good hit, which may pick any number of results.
+func (s *Searcher) PickMany(rs []Result) ([]Result, error) {
+	if s.multiChooser == nil || s.autopick || s.goodHit(rs) {
+		r, err := s.Pick(rs)
+		if err != nil || r == nil {
+			return nil, err
+		}
+		return []Result{*r}, nil
+	}
+	return s.multiChooser(rs, s.what)
+}
+
 func (sub *subsearch) choose(parent *Searcher, chooser Chooser) error {
 	sub.goodThreshold = parent.goodThreshold
 	sub.chooser = parent.chooser
+	sub.autopick = sub.autopick || parent.autopick
 	sub.debug = parent.debug
 
+	if sub.multiChooser == nil {
+		sub.multiChooser = parent.multiChooser
+	}
+
 	rs, err := sub.Results()
 	if err != nil {
-		return ef("Error with %s sub-search: %s", sub.what, err)
+		return &ErrSubSearch{Kind: sub.what, Err: err}
 	}
-	r, err := sub.Pick(rs)
+	picked, err := sub.PickMany(rs)
 	if err != nil {
 		return ef("Error picking %s result: %s", sub.what, err)
 	}
-	if r == nil {
-		sub.id = -1 // force search to fail.
+	if len(picked) == 0 {
+		sub.ids = []imdb.Atom{-1} // force search to fail.
 		return nil
 	}
-	sub.id = r.Id
+	sub.ids = nil
+	for _, r := range picked {
+		sub.ids = append(sub.ids, r.Id)
+	}
 	return nil
 }
 
 func (sub *subsearch) empty() bool {
-	return sub == nil || sub.id == 0
+	return sub == nil || len(sub.ids) == 0
+}
+
+// cond returns a SQL condition that is true when the column given is equal to
+// any of the entities picked in the sub-search.
+func (sub *subsearch) cond(col string) string {
+	if len(sub.ids) == 1 {
+		return sf("%s = %d", col, sub.ids[0])
+	}
+	var ids []string
+	for _, id := range sub.ids {
+		ids = append(ids, sf("%d", id))
+	}
+	return sf("%s IN (%s)", col, strings.Join(ids, ", "))
 }
 
 // GoodThreshold sets the threshold at which a result is considered "good"
@@ -354,6 +614,14 @@ func (s *Searcher) GoodThreshold(diff float64) *Searcher {
 	return s
 }
 
+// AutoPick makes Pick always return the first result instead of invoking the
+// chooser when the first result isn't a good hit. This applies to
+// sub-searches too.
+func (s *Searcher) AutoPick() *Searcher {
+	s.autopick = true
+	return s
+}
+
 // SimilarThreshold sets the similarity threshold at which results from a fuzzy
 // text search are cutoff. Results with a similarity threshold lower than
 // what's given won't be returned. The value should be in the inclusive inteval
@@ -384,6 +652,138 @@ func (s *Searcher) Genre(name string) *Searcher {
 	return s
 }
 
+// RoleActress is a role that can be given to Role but isn't the role of any
+// credit. It matches cast credits loaded from IMDb's actresses list, since
+// IMDb splits cast members between the actors and actresses lists. (See
+// imdb.Credit.)
+const RoleActress = "actress"
+
+// Roles lists every role that can be given to Role: the roles in
+// imdb.EnumRoles and RoleActress.
+var Roles = append(append([]string{}, imdb.EnumRoles...), RoleActress)
+
+// Role adds the named role to the search. When the search is restricted to
+// the credits of a person (with Cast) or the credits of a media item (with
+// Credits), only credits with the role given are returned. Otherwise, only
+// people with at least one credit in the role given are returned (and other
+// entities are unaffected). If multiple roles are specified in the search,
+// then they are combined disjunctively.
+// The role name must correspond to one of the names in Roles (case
+// insensitive). Otherwise, it will be silently ignored.
+func (s *Searcher) Role(name string) *Searcher {
+	name = strings.ToLower(name)
+	if fun.In(name, Roles) {
+		s.roles = append(s.roles, name)
+	}
+	return s
+}
+
+// CaseSensitive specifies whether the text of the search is matched against
+// names with case sensitivity. By default, matching is case insensitive with
+// every database (including for letters outside of ASCII, by way of folded
+// names; see imdb.FoldName). When matching is case sensitive, results from a
+// fuzzy search are still ranked by similarity, but only names that match the
+// text exactly (with wildcards) are returned.
+func (s *Searcher) CaseSensitive(yes bool) *Searcher {
+	s.caseSensitive = yes
+	return s
+}
+
+// RankWildcards specifies that a search with wildcards in its text should
+// still be ranked by similarity. Normally, a wildcard disables fuzzy
+// searching, so the results are only filtered with LIKE and come back in an
+// arbitrary order. With RankWildcards, the wildcards still filter the
+// results, but they are ranked by trigram similarity with the text (without
+// the wildcards) when PostgreSQL's 'pg_trgm' extension is enabled. Otherwise,
+// they are re-ranked in Go with the function set by Similarity, or
+// Jaro-Winkler similarity if none is set.
+//
+// For example, with RankWildcards, 'star wars%' returns the Star Wars movies
+// closest to 'star wars' first.
+func (s *Searcher) RankWildcards() *Searcher {
+	s.rankWild = true
+	return s
+}
+
+// Similarity sets the function used to rank results by their similarity with
+// the text of the search. The name must be one of SimilarityFuncs. Otherwise,
+// it will be silently ignored.
+//
+// The default, "trigram", is computed by PostgreSQL (when the 'pg_trgm'
+// extension is enabled). The others are computed in Go by re-ranking
+// candidates retrieved from the database (which also works with SQLite).
+// Trigram similarity tends to rank short titles poorly, which "jaro"
+// (Jaro-Winkler) and "levenshtein" do better with.
+func (s *Searcher) Similarity(name string) *Searcher {
+	name = strings.ToLower(name)
+	if name == "trigram" {
+		s.similarity = ""
+	} else if _, ok := similarityFuncs[name]; ok {
+		s.similarity = name
+	}
+	return s
+}
+
+// Tag adds the named overlay tag to the search. Results only with the tag
+// given (in any overlay namespace) are returned. If multiple tags are
+// specified in the search, then they are combined disjunctively.
+// Overlay tags are user provided and loaded with 'goim overlay'.
+func (s *Searcher) Tag(name string) *Searcher {
+	name = strings.TrimSpace(name)
+	if len(name) > 0 {
+		s.tags = append(s.tags, name)
+	}
+	return s
+}
+
+// List adds the named overlay namespace to the search. Results only with a
+// tag in the namespace given (e.g., a list imported with 'goim letterboxd')
+// are returned. If multiple lists are specified in the search, then they are
+// combined disjunctively.
+func (s *Searcher) List(namespace string) *Searcher {
+	namespace = strings.TrimSpace(namespace)
+	if len(namespace) > 0 {
+		s.lists = append(s.lists, namespace)
+	}
+	return s
+}
+
+// Franchise restricts results to movies in a franchise whose name, or the
+// title or AKA title of any of its movies, contains the text given (case
+// insensitive). Franchises are guessed from movie links and titles by
+// imdb.BuildFranchises, and no movies are returned until it is called. Unless
+// the search is sorted some other way, results are sorted by year, so that
+// the whole series is in order. If multiple franchises are specified in the
+// search, then they are combined disjunctively.
+func (s *Searcher) Franchise(name string) *Searcher {
+	name = strings.TrimSpace(name)
+	if len(name) > 0 {
+		s.franchises = append(s.franchises, name)
+	}
+	return s
+}
+
+// TrendRising is the trend of entities whose number of votes grew between the
+// two most recent generations in the rating history.
+const TrendRising = "rising"
+
+// Trends lists every trend that can be given to Searcher.Trend.
+var Trends = []string{TrendRising}
+
+// Trend restricts results to entities with the trend given, and sorts them by
+// how much they're trending unless the search is sorted otherwise. With
+// TrendRising, the only trend, results are entities whose number of votes
+// grew between the two most recent generations in the rating history (see
+// imdb.RatingHistory), sorted by how many votes they gained ('growth').
+// Unrecognized trends are ignored.
+func (s *Searcher) Trend(name string) *Searcher {
+	name = strings.ToLower(name)
+	if fun.In(name, Trends) {
+		s.trend = name
+	}
+	return s
+}
+
 // MPAA adds the MPAA rating to the search. Only results with the given MPAA
 // rating are returned. If multiple MPAA ratings are specified in the search,
 // then they are combined disjunctively.
@@ -429,6 +829,18 @@ func (s *Searcher) Episodes(min, max int) *Searcher {
 	return s
 }
 
+// AbsoluteEpisodes specifies that the results must be in the range of
+// absolute episode numbers given. An episode's absolute number is its
+// position in its TV show when ordered by season and episode number (which
+// is how anime is commonly numbered). Episodes without a season or episode
+// number have no absolute number and never match.
+// The range is inclusive.
+// Either min or max can be disabled with a value of -1.
+func (s *Searcher) AbsoluteEpisodes(min, max int) *Searcher {
+	s.absolute = newIrange(min, max)
+	return s
+}
+
 // NoTvMovies filters out "made for TV" movies from a search.
 func (s *Searcher) NoTvMovies() *Searcher {
 	s.noTvMovie = true
@@ -458,6 +870,23 @@ func (s *Searcher) Votes(min, max int) *Searcher {
 	return s
 }
 
+// Popular restricts the results to popular entities, i.e., those with at
+// least imdb.PopularVotes votes. This is like calling Votes with that
+// minimum, except that the search can use partial indices that only cover
+// popular entities, which makes it much faster on large databases
+// (particularly when the search index is built).
+func (s *Searcher) Popular() *Searcher {
+	s.popular = true
+	return s
+}
+
+// popularCond returns the condition for popular entities on the votes column
+// of the table given. It must match the condition of the partial indices in
+// imdb.Schema for them to be used.
+func popularCond(table string) string {
+	return sf("%s.votes >= %d", table, imdb.PopularVotes)
+}
+
 // Billed specifies that the results---when they correspond to credits---must
 // be in the billed range provided. For example, when showing credits for an
 // actor, this will restrict the results to movies where the actor has a billed
@@ -469,16 +898,28 @@ func (s *Searcher) Billed(min, max int) *Searcher {
 	return s
 }
 
+// AgeAtRelease specifies that the results---when they correspond to
+// credits---must be credits where the actor's age in the year the media was
+// released is in the range provided. Ages are computed from the years of
+// birth in the 'biographies' list, so credits of actors without one are
+// excluded. Like Billed, this only applies to searches with credits.
+// The range is inclusive.
+// Either min or max can be disabled with a value of -1.
+func (s *Searcher) AgeAtRelease(min, max int) *Searcher {
+	s.ageAtRelease = newIrange(min, max)
+	return s
+}
+
 // Tvshow specifies a sub-search that will be performed when Results is called.
 // The TV show returned by this sub-search will be used to filter the results
 // of its parent search. If no TV show is found, then the search quits and
 // returns no results. If more than one good matching TV show is found, then
-// the searcher's "chooser" is called. (See the documentation for the
-// Chooser type.)
+// the searcher's "chooser" (or "multi-chooser") is called. (See the
+// documentation for the Chooser and MultiChooser types.)
 func (s *Searcher) Tvshow(tvs *Searcher) *Searcher {
 	tvs.Entity(imdb.EntityTvshow)
 	tvs.what = "TV show"
-	s.subTvshow = &subsearch{tvs, 0}
+	s.subTvshow = &subsearch{tvs, nil}
 	return s
 }
 
@@ -489,19 +930,20 @@ func (s *Searcher) Tvshow(tvs *Searcher) *Searcher {
 // If no entity is found, then the parent search quits and returns no results.
 func (s *Searcher) Credits(credits *Searcher) *Searcher {
 	credits.what = "credits"
-	s.subCredits = &subsearch{credits, 0}
+	s.subCredits = &subsearch{credits, nil}
 	return s
 }
 
 // Cast specifies a sub-search that will be performed when Results is called.
 // The cast member returned restricts the results of the parent search to only
-// include credits for the cast member.
+// include credits for the cast member. Credits in every role (e.g., director)
+// are included unless the parent search has a Role.
 // If no cast member is found, then the parent search quits and returns no
 // results.
 func (s *Searcher) Cast(cast *Searcher) *Searcher {
 	cast.what = "actor"
 	cast.Entity(imdb.EntityActor)
-	s.subCast = &subsearch{cast, 0}
+	s.subCast = &subsearch{cast, nil}
 	return s
 }
 
@@ -517,11 +959,29 @@ func (s *Searcher) Limit(n int) *Searcher {
 // Sort specifies the order in which to return the results.
 // Note that Sort can be called multiple times. Each call adds the column and
 // order to the current sort criteria.
+// Unknown columns and orders other than 'asc' or 'desc' are silently ignored.
 func (s *Searcher) Sort(column, order string) *Searcher {
 	s.order = append(s.order, searchOrder{column, order})
 	return s
 }
 
+// BayesVotes sets the number of votes (usually called 'm') used to compute the
+// Bayesian rating when sorting by 'bayes'. The Bayesian rating of a title is
+//
+//	(v / (v + m)) * R + (m / (v + m)) * C
+//
+// where v is the number of votes, R is the rank of the title and C is the
+// average rank of all titles in the database. Titles with few votes are
+// pulled toward the average, so they don't outrank titles with many votes.
+// The default is 1000. m must be at least 1 (otherwise, titles without votes
+// would divide by zero), so smaller values are ignored.
+func (s *Searcher) BayesVotes(m int) *Searcher {
+	if m >= 1 {
+		s.bayesVotes = m
+	}
+	return s
+}
+
 // Chooser specifies the function to call when a sub-search returns 2 or more
 // good hits. See the documentation for the Chooser type for details.
 func (s *Searcher) Chooser(chooser Chooser) *Searcher {
@@ -529,6 +989,31 @@ func (s *Searcher) Chooser(chooser Chooser) *Searcher {
 	return s
 }
 
+// MultiChooser specifies the function to call when a sub-search returns 2 or
+// more good hits, which may pick more than one of them. It takes precedence
+// over the Chooser for sub-searches. See the documentation for the
+// MultiChooser type for details.
+func (s *Searcher) MultiChooser(chooser MultiChooser) *Searcher {
+	s.multiChooser = chooser
+	return s
+}
+
+// Fallback specifies the function to call when a search returns no results.
+// See the documentation for the Fallback type for details.
+func (s *Searcher) Fallback(fallback Fallback) *Searcher {
+	s.fallback = fallback
+	return s
+}
+
+// PostFilter adds a function to call on the results of a search before they
+// are returned. Post-filters are called in the order they were added, each
+// with the results returned by the previous one. Post-filters are not used
+// by sub-searches. See the documentation for the PostFilter type for details.
+func (s *Searcher) PostFilter(filter PostFilter) *Searcher {
+	s.postFilters = append(s.postFilters, filter)
+	return s
+}
+
 // queryTokens breaks a search query into tokens. Namely, a token is whitespace
 // delimited, except when curly braces ('{' and '}') are presents. For example,
 // in the string "a b {x y z} c", there are exactly four tokens: "a", "b",
@@ -589,6 +1074,9 @@ func argOption(arg string) (name, val string) {
 }
 
 func (s *Searcher) sql() string {
+	if s.indexed {
+		return s.indexSQL()
+	}
 	q := sf(`
 		SELECT
 			%s AS entity,
@@ -596,6 +1084,84 @@ func (s *Searcher) sql() string {
 			name.name AS name,
 			COALESCE(m.year, t.year, e.year, 0) AS year,
 			%s,
+			%s,
+			%s,
+			%s,
+			%s
+		FROM name
+		LEFT JOIN movie AS m ON name.atom_id = m.atom_id
+		LEFT JOIN tvshow AS t ON name.atom_id = t.atom_id
+		LEFT JOIN episode AS e ON name.atom_id = e.atom_id
+		LEFT JOIN actor AS a ON name.atom_id = a.atom_id
+		%s
+		WHERE
+			COALESCE(m.atom_id, t.atom_id, e.atom_id, a.atom_id) IS NOT NULL
+			AND
+			%s
+		%s
+		%s
+		`,
+		s.entityColumn(), s.similarColumn("name.name"), s.attrsColumn(),
+		s.rankColumns(), s.creditAttrs(), s.growthColumn(),
+		s.joins(), s.where(), s.orderby(), s.limitClause())
+	if s.debug {
+		pef("%s\n", q)
+	}
+	return q
+}
+
+// Columns lists the names of the columns that can be given to Select.
+var Columns = []string{"attrs", "rank", "votes", "credit"}
+
+// Select restricts the data retrieved for each result to the columns given,
+// which must be in Columns. Fields of results for columns that aren't
+// selected are left empty (e.g., Result.Rank is 0 when neither 'rank' nor
+// 'votes' are selected). The entity, atom identifier, name and year of each
+// result are always retrieved, along with the similarity when it's used to
+// rank results.
+//
+// By default, every column is selected. Selecting fewer columns makes the
+// query simpler, which speeds up large searches (like exports). Filters and
+// sort criteria work regardless of the columns selected.
+//
+// Unknown columns are silently ignored. Select may be called with no columns
+// to select only the columns that are always retrieved.
+func (s *Searcher) Select(columns ...string) *Searcher {
+	s.columns = make(map[string]bool)
+	for _, col := range columns {
+		if fun.In(col, Columns) {
+			s.columns[col] = true
+		}
+	}
+	return s
+}
+
+// selected returns true if the column given should be retrieved.
+func (s *Searcher) selected(column string) bool {
+	return s.columns == nil || s.columns[column]
+}
+
+// sortsBy returns true if the search is sorted by the column given.
+func (s *Searcher) sortsBy(column string) bool {
+	for _, ord := range s.order {
+		if ord.column == column {
+			return true
+		}
+	}
+	return false
+}
+
+// attrsColumn returns the expression for the 'attrs' column, which is empty
+// when the column isn't selected. (See Select.)
+func (s *Searcher) attrsColumn() string {
+	if !s.selected("attrs") && !s.sortsBy("attrs") {
+		return "'' AS attrs"
+	}
+	showName := "''"
+	if s.joined("et") {
+		showName = "et.name"
+	}
+	return sf(`
 			CASE
 				WHEN m.atom_id IS NOT NULL THEN
 					trim(
@@ -614,7 +1180,7 @@ func (s *Searcher) sql() string {
 						ELSE '????'
 					END
 				WHEN e.atom_id IS NOT NULL THEN
-					'(TV show: ' || et.name
+					'(TV show: ' || %s
 					||
 					CASE
 						WHEN e.season > 0 AND e.episode_num > 0 THEN
@@ -627,100 +1193,128 @@ func (s *Searcher) sql() string {
 				WHEN a.atom_id IS NOT NULL THEN ''
 				ELSE ''
 			END
-			AS attrs,
-			COALESCE(rating.votes, 0) AS votes,
-			COALESCE(rating.rank, 0) AS rank,
-			%s
-		FROM name
-		LEFT JOIN movie AS m ON name.atom_id = m.atom_id
-		LEFT JOIN tvshow AS t ON name.atom_id = t.atom_id
-		LEFT JOIN episode AS e ON name.atom_id = e.atom_id
-		LEFT JOIN name AS et ON e.tvshow_atom_id = et.atom_id
-		LEFT JOIN actor AS a ON name.atom_id = a.atom_id
-		LEFT JOIN rating ON name.atom_id = rating.atom_id
-		LEFT JOIN mpaa_rating ON name.atom_id = mpaa_rating.atom_id
-		%s
-		WHERE
-			COALESCE(m.atom_id, t.atom_id, e.atom_id, a.atom_id) IS NOT NULL
-			AND
-			%s
-		%s
-		%s
-		`,
-		s.entityColumn(), s.similarColumn("name.name"), s.creditAttrs(),
-		s.creditJoin(), s.where(), s.orderby(), s.limitClause())
-	if s.debug {
-		pef("%s\n", q)
+			AS attrs`, showName)
+}
+
+// rankColumns returns the expressions for the 'votes' and 'rank' columns,
+// which are 0 when they aren't selected. (See Select.)
+func (s *Searcher) rankColumns() string {
+	if !s.selected("rank") && !s.selected("votes") {
+		return "0 AS votes, 0 AS rank"
 	}
-	return q
+	return "COALESCE(rating.votes, 0) AS votes, COALESCE(rating.rank, 0) AS rank"
+}
+
+// growthColumn returns the expression for the growth of each result, which
+// is 0 unless the rating history is joined. (See Result.Growth.)
+func (s *Searcher) growthColumn() string {
+	if !s.joined("trend") {
+		return "0 AS growth"
+	}
+	return "COALESCE(trend.growth, 0) AS growth"
 }
 
 func (s *Searcher) limitClause() string {
 	if s.limit < 0 {
 		return ""
+	} else if s.reranked() {
+		// Get more candidates so that re-ranking has something to work with.
+		return sf("LIMIT %d", s.limit*candidateFactor)
 	} else {
 		return sf("LIMIT %d", s.limit)
 	}
 }
 
-func (s *Searcher) creditJoin() string {
-	var joins string
-	if !s.subCast.empty() {
-		joins += sf(`
-		LEFT JOIN credit AS c_actor ON
-			name.atom_id = c_actor.media_atom_id
-			AND c_actor.actor_atom_id = %d
-		`, s.subCast.id)
-	}
-	if !s.subCredits.empty() {
-		joins += sf(`
-		LEFT JOIN credit AS c_media ON
-			a.atom_id = c_media.actor_atom_id
-			AND c_media.media_atom_id = %d
-		`, s.subCredits.id)
+// reranked returns true when results are ranked in Go after they are
+// retrieved from the database.
+func (s *Searcher) reranked() bool {
+	if len(s.name) == 0 {
+		return false
 	}
-	return joins
+	return len(s.similarity) > 0 || (s.rankWild && !s.fuzzy && !s.trigram)
+}
+
+// rankedWildcards returns true when a search with wildcards is ranked by
+// trigram similarity in the database. (See RankWildcards.)
+func (s *Searcher) rankedWildcards() bool {
+	return s.rankWild && !s.fuzzy && s.trigram && len(s.name) > 0
 }
 
 func (s *Searcher) creditAttrs() string {
 	act, med := !s.subCast.empty(), !s.subCredits.empty()
 	switch {
-	case !act && !med:
+	case (!act && !med) || !s.selected("credit"):
 		return `
 		0 AS c_actor_id,
 		0 AS c_media_id,
 		'' AS c_character,
 		0 AS c_position,
-		'' AS c_attrs
+		'' AS c_attrs,
+		'' AS c_role,
+		-1 AS c_age
 		`
 	case !act && med:
-		return `
+		return sf(`
 		COALESCE(c_media.actor_atom_id, 0) AS c_actor_id,
 		COALESCE(c_media.media_atom_id, 0) AS c_media_id,
 		COALESCE(c_media.character, '') AS c_character,
 		COALESCE(c_media.position, 0) AS c_position,
-		COALESCE(c_media.attrs, '') AS c_attrs
-		`
+		COALESCE(c_media.attrs, '') AS c_attrs,
+		COALESCE(c_media.role, '') AS c_role,
+		COALESCE(%s, -1) AS c_age
+		`, s.creditAge())
 	case act && !med:
-		return `
+		return sf(`
 		COALESCE(c_actor.actor_atom_id, 0) AS c_actor_id,
 		COALESCE(c_actor.media_atom_id, 0) AS c_media_id,
 		COALESCE(c_actor.character, '') AS c_character,
 		COALESCE(c_actor.position, 0) AS c_position,
-		COALESCE(c_actor.attrs, '') AS c_attrs
-		`
+		COALESCE(c_actor.attrs, '') AS c_attrs,
+		COALESCE(c_actor.role, '') AS c_role,
+		COALESCE(%s, -1) AS c_age
+		`, s.creditAge())
 	case act && med:
-		return `
+		return sf(`
 		COALESCE(c_actor.actor_atom_id, c_media.actor_atom_id) AS c_actor_id,
 		COALESCE(c_actor.media_atom_id, c_media.media_atom_id) AS c_media_id,
 		COALESCE(c_actor.character, c_media.character) AS c_character,
 		COALESCE(c_actor.position, c_media.position) AS c_position,
-		COALESCE(c_actor.attrs, c_media.attrs) AS c_attrs
-		`
+		COALESCE(c_actor.attrs, c_media.attrs) AS c_attrs,
+		COALESCE(c_actor.role, c_media.role) AS c_role,
+		COALESCE(%s, -1) AS c_age
+		`, s.creditAge())
 	}
 	panic("unreachable")
 }
 
+// creditAge returns the expression for the age of the actor of a credit in
+// the year its media was released, which is NULL when either year is
+// unknown. It may only be used when a credit table is joined. (See the
+// 'c_bio' join.)
+func (s *Searcher) creditAge() string {
+	year := "COALESCE(c_m.year, c_t.year, c_e.year, 0)"
+	if s.subCredits.empty() {
+		// The media of every credit is the result itself.
+		year = "COALESCE(m.year, t.year, e.year, 0)"
+	}
+	return sf("CASE WHEN c_bio.birth_year > 0 AND %s > 0 "+
+		"THEN %s - c_bio.birth_year END", year, year)
+}
+
+// creditColumn returns the expression for a column of the credit table
+// joined by sub-searches, which may be 'c_actor', 'c_media' or both.
+func (s *Searcher) creditColumn(column string) string {
+	act, med := !s.subCast.empty(), !s.subCredits.empty()
+	switch {
+	case act && med:
+		return sf("COALESCE(c_actor.%s, c_media.%s)", column, column)
+	case med:
+		return sf("c_media.%s", column)
+	default:
+		return sf("c_actor.%s", column)
+	}
+}
+
 func (s *Searcher) where() string {
 	var conj []string
 	conj = append(conj, s.whereCredits()...)
@@ -731,9 +1325,15 @@ func (s *Searcher) where() string {
 
 	conj = append(conj, s.inStrs("mpaa_rating.rating", s.mpaas))
 	conj = append(conj, s.inSubquery("genre", "name", s.genres))
+	conj = append(conj, s.inSubquery("overlay", "tag", s.tags))
+	conj = append(conj, s.inSubquery("overlay", "namespace", s.lists))
+	conj = append(conj, s.franchiseCond())
+	if s.trend == TrendRising {
+		conj = append(conj, "trend.growth > 0")
+	}
 
 	if !s.subTvshow.empty() {
-		conj = append(conj, sf("e.tvshow_atom_id = %d", s.subTvshow.id))
+		conj = append(conj, s.subTvshow.cond("e.tvshow_atom_id"))
 	}
 	if s.atom > 0 {
 		conj = append(conj, sf("name.atom_id = %d", s.atom))
@@ -747,6 +1347,9 @@ func (s *Searcher) where() string {
 	if s.votes != nil {
 		conj = append(conj, s.votes.cond("rating.votes"))
 	}
+	if s.popular {
+		conj = append(conj, popularCond("rating"))
+	}
 	if s.season != nil {
 		cond := sf("(e.atom_id IS NULL OR %s)", s.season.cond("e.season"))
 		conj = append(conj, cond)
@@ -755,6 +1358,15 @@ func (s *Searcher) where() string {
 		cond := sf("(e.atom_id IS NULL OR %s)", s.episode.cond("e.episode_num"))
 		conj = append(conj, cond)
 	}
+	if s.absolute != nil {
+		cond := sf("(e.atom_id IS NULL OR (e.abs_num > 0 AND %s))",
+			s.absolute.cond("e.abs_num"))
+		conj = append(conj, cond)
+	}
+	if s.specials {
+		conj = append(conj,
+			"(e.atom_id IS NULL OR e.season = 0 OR e.episode_num = 0)")
+	}
 	if s.noTvMovie {
 		conj = append(conj, "(m.atom_id IS NULL OR m.tv = cast(0 as boolean))")
 	}
@@ -762,33 +1374,99 @@ func (s *Searcher) where() string {
 		conj = append(conj,
 			"(m.atom_id IS NULL OR m.video = cast(0 as boolean))")
 	}
-	if len(s.name) > 0 {
-		if s.fuzzy {
-			conj = append(conj, "name.name % $1")
-		} else {
-			if s.db.Driver == "postgres" {
-				conj = append(conj, sf("name.name ILIKE $1"))
-			} else {
-				conj = append(conj, sf("name.name LIKE $1"))
-			}
+	conj = append(conj, s.regexConds()...)
+	conj = append(conj, s.nameConds()...)
+	return strings.Join(conj, " AND ")
+}
+
+// nameConds returns the conditions matching the text of the search against
+// the 'name' and 'name_fold' columns of the table aliased as 'name'.
+func (s *Searcher) nameConds() []string {
+	if len(s.name) == 0 {
+		return nil
+	}
+	if s.caseSensitive {
+		return []string{s.caseSensitiveCond()}
+	} else if s.fuzzy {
+		// The '%' operator can use the trigram index, but its threshold
+		// is per connection. So the threshold is applied explicitly too.
+		return []string{
+			"name.name % $1",
+			sf("similarity(name.name, $1) >= %f", s.similarThreshold),
 		}
 	}
-	return strings.Join(conj, " AND ")
+	like := "LIKE"
+	if s.db.Driver != "sqlite3" {
+		like = "ILIKE"
+	}
+	// The folded name lets plain ASCII text match names with
+	// diacritics or in other scripts. (See imdb.FoldName.)
+	fold := imdb.FoldName(strings.Join(s.name, " "))
+	return []string{sf("(name.name %s $1 OR name.name_fold %s %s)",
+		like, like, sqlString(fold))}
+}
+
+// caseSensitiveCond returns a condition matching the text of the search
+// against names with case sensitivity. SQLite's LIKE is always case
+// insensitive, so GLOB is used instead. (See nameArg.)
+func (s *Searcher) caseSensitiveCond() string {
+	if s.db.Driver != "sqlite3" {
+		return "name.name LIKE $1"
+	}
+	return "name.name GLOB $1"
+}
+
+// nameArg returns the argument bound to $1 in the query of the search, which
+// is its text. For case sensitive searches in SQLite, the text is turned
+// into a GLOB pattern, where the LIKE wildcards '%' and '_' become '*' and
+// '?' and GLOB's own wildcards match themselves.
+func (s *Searcher) nameArg() string {
+	text := strings.Join(s.name, " ")
+	if !s.caseSensitive || s.db.Driver != "sqlite3" {
+		return text
+	}
+	return strings.NewReplacer(
+		"[", "[[]", "*", "[*]", "?", "[?]", "%", "*", "_", "?",
+	).Replace(text)
 }
 
-// assumes that the strings in vals are safe for SQL.
+// Strings in vals are quoted, so they may contain any text.
 func (s *Searcher) inStrs(col string, vals []string) string {
 	if len(vals) == 0 {
 		return "1 = 1"
 	}
 	var elems []string
 	for _, v := range vals {
-		elems = append(elems, sf("'%s'", v))
+		elems = append(elems, sqlString(v))
 	}
 	return sf("%s IN(%s)", col, strings.Join(elems, ", "))
 }
 
-// assumes that the strings in vals are safe for SQL.
+// franchiseCond returns the condition matching movies in the franchises of
+// the search. (See Franchise.)
+func (s *Searcher) franchiseCond() string {
+	if len(s.franchises) == 0 {
+		return "1 = 1"
+	}
+	var matches []string
+	for _, name := range s.franchises {
+		like := sqlString("%" + imdb.FoldName(name) + "%")
+		matches = append(matches, sf(`
+			SELECT f.franchise_id FROM franchise AS f
+			JOIN name AS fn ON f.atom_id = fn.atom_id
+			WHERE lower(f.name) LIKE %s OR fn.name_fold LIKE %s
+			UNION
+			SELECT f.franchise_id FROM franchise AS f
+			JOIN aka_title AS fa ON f.atom_id = fa.atom_id
+			WHERE lower(fa.title) LIKE %s`, like, like, like))
+	}
+	return sf(`
+		name.atom_id IN (
+			SELECT atom_id FROM franchise WHERE franchise_id IN (%s)
+		)`, strings.Join(matches, "\n\t\t\tUNION"))
+}
+
+// Strings in vals are quoted, so they may contain any text.
 func (s *Searcher) inSubquery(table, col string, vals []string) string {
 	if len(vals) == 0 {
 		return "1 = 1"
@@ -796,7 +1474,7 @@ func (s *Searcher) inSubquery(table, col string, vals []string) string {
 
 	var unions []string
 	for _, v := range vals {
-		unions = append(unions, sf("SELECT '%s'", v))
+		unions = append(unions, sf("SELECT %s", sqlString(v)))
 	}
 	return sf(`
 		EXISTS (
@@ -806,6 +1484,50 @@ func (s *Searcher) inSubquery(table, col string, vals []string) string {
 		)`, strings.Join(unions, " UNION "), col, table)
 }
 
+// sqlString returns v as a quoted SQL string literal.
+func sqlString(v string) string {
+	return sf("'%s'", strings.Replace(v, "'", "''", -1))
+}
+
+// creditJoin returns the condition for joining the credit table (with the
+// alias given) to the results, such that the column given matches the
+// entities picked in a sub-search and the other column matches the result.
+//
+// When a sub-search picked more than one entity, a result may have a credit
+// for several of them, which would repeat the result once for each. So only
+// the credit of the entity with the smallest atom identifier (among those
+// with credits matching the billing and roles of the search) is joined.
+func (s *Searcher) creditJoin(
+	sub *subsearch,
+	alias, col, other, result string,
+) string {
+	cond := sf("%s.%s = %s AND %s",
+		alias, other, result, sub.cond(sf("%s.%s", alias, col)))
+	if len(sub.ids) <= 1 {
+		return cond
+	}
+
+	conj := []string{
+		sf("dup.%s = %s", other, result),
+		sub.cond(sf("dup.%s", col)),
+	}
+	// Billing and roles are only checked against one credit table. (See
+	// whereCredits.)
+	if alias == "c_actor" || s.subCast.empty() {
+		if s.billing != nil {
+			conj = append(conj, s.billing.cond("dup.position"))
+		}
+		if len(s.roles) > 0 {
+			conj = append(conj, s.rolesCond("dup."))
+		}
+	}
+	return sf(`%s
+			AND %s.%s = (
+				SELECT MIN(dup.%s) FROM credit AS dup
+				WHERE %s
+			)`, cond, alias, col, col, strings.Join(conj, " AND "))
+}
+
 func (s *Searcher) whereCredits() []string {
 	var conj []string
 	var joined string
@@ -820,23 +1542,74 @@ func (s *Searcher) whereCredits() []string {
 	if len(joined) > 0 && s.billing != nil {
 		conj = append(conj, s.billing.cond(sf("%s.position", joined)))
 	}
+	if len(joined) > 0 && s.ageAtRelease != nil {
+		// Credits with an unknown age never match, since it's NULL.
+		age := sf("(%s)", s.creditAge())
+		conj = append(conj, s.ageAtRelease.cond(age))
+	}
+	if len(s.roles) > 0 {
+		if len(joined) > 0 {
+			conj = append(conj, s.rolesCond(joined+"."))
+		} else {
+			conj = append(conj, sf(`
+				(a.atom_id IS NULL OR EXISTS (
+					SELECT 1 FROM credit
+					WHERE actor_atom_id = a.atom_id AND %s
+				))`, s.rolesCond("")))
+		}
+	}
 	return conj
 }
 
+// rolesCond returns the condition matching credits in any of the roles of
+// the search. The prefix qualifies the columns of the credit table.
+func (s *Searcher) rolesCond(prefix string) string {
+	var roles, disj []string
+	for _, role := range s.roles {
+		if role == RoleActress {
+			disj = append(disj, sf("(%srole = 'actor' AND %ssource = %s)",
+				prefix, prefix, sqlString("actresses")))
+		} else {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) > 0 {
+		disj = append(disj, s.inStrs(prefix+"role", roles))
+	}
+	return "(" + strings.Join(disj, " OR ") + ")"
+}
+
 func (s *Searcher) orderby() string {
 	q, prefix := "", ""
 	for _, ord := range s.order {
 		qualed := orderColumnQualified(ord.column)
-		if len(qualed) == 0 {
+		if len(qualed) == 0 || !validOrder(ord.order) {
 			continue
 		}
+		if !s.orderable(qualed) {
+			continue
+		}
+		if qualed == "bayes" {
+			qualed = s.bayesColumn()
+		}
+		if s.indexed {
+			// The search index has its own copy of each rating.
+			qualed = strings.Replace(qualed, "rating.", "name.", -1)
+		}
 		q += s.orderbyColumn(prefix+qualed, ord.order)
 		prefix = ", "
 	}
-	if s.fuzzy && len(s.name) > 0 {
+	if (s.fuzzy && len(s.name) > 0) || s.rankedWildcards() {
 		return sf("ORDER BY %s %s %s",
 			s.orderbyColumn("similarity", "DESC"), prefix, q)
 	}
+	if len(q) == 0 && len(s.franchises) > 0 {
+		// A franchise is shown in the order its movies were released.
+		q = s.orderbyColumn("COALESCE(m.year, t.year, e.year, 0)", "ASC")
+	}
+	if len(q) == 0 && len(s.trend) > 0 {
+		q = s.orderbyColumn("trend.growth", "DESC")
+	}
 	if len(q) == 0 {
 		return ""
 	}
@@ -844,13 +1617,21 @@ func (s *Searcher) orderby() string {
 }
 
 func (s *Searcher) orderbyColumn(column, order string) string {
-	if s.db.Driver == "postgres" {
+	if s.db.Driver != "sqlite3" {
 		return sf("%s %s NULLS LAST", column, order)
 	} else {
 		return sf("%s %s", column, order)
 	}
 }
 
+// bayesColumn returns an expression computing the Bayesian rating of each
+// result. See BayesVotes. Results without a rank have a NULL rating.
+func (s *Searcher) bayesColumn() string {
+	return sf(`
+		(rating.votes * rating.rank + %d * (SELECT AVG(rank) FROM rating))
+		/ (rating.votes + %d.0)`, s.bayesVotes, s.bayesVotes)
+}
+
 func (s *Searcher) entityColumn() string {
 	return `
 			CASE
@@ -863,7 +1644,7 @@ func (s *Searcher) entityColumn() string {
 }
 
 func (s *Searcher) similarColumn(col string) string {
-	if len(s.name) > 0 && s.fuzzy {
+	if (len(s.name) > 0 && s.fuzzy) || s.rankedWildcards() {
 		return sf("COALESCE(similarity(%s, $1), 0) AS similarity", col)
 	} else {
 		return "-1 AS similarity"
@@ -906,15 +1687,39 @@ var qualifiedColumns = map[string]string{
 	"attrs":      "attrs",
 	"similarity": "similarity",
 
-	"season":  "e.season",
-	"episode": "e.episode_num",
+	"season":   "e.season",
+	"episode":  "e.episode_num",
+	"absolute": "e.abs_num",
 
 	"rank":  "rating.rank",
 	"votes": "rating.votes",
 
 	"billing": "c_media.position",
+
+	"growth": "trend.growth",
+
+	// Computed in the query. See bayesColumn.
+	"bayes": "bayes",
+}
+
+// defaultOrder returns the sort order used for the column given when a sort
+// directive has no order. Columns where bigger is better are sorted in
+// descending order.
+func defaultOrder(column string) string {
+	switch column {
+	case "rank", "votes", "bayes", "growth":
+		return "desc"
+	}
+	return "asc"
 }
 
 func orderColumnQualified(column string) string {
 	return qualifiedColumns[column]
 }
+
+// validOrder returns true if the sort order given is 'asc' or 'desc' (case
+// insensitive).
+func validOrder(order string) bool {
+	order = strings.ToLower(order)
+	return order == "asc" || order == "desc"
+}
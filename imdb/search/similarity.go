@@ -0,0 +1,174 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+// similarityFuncs maps the names of the similarity functions that can be used
+// to rank search results to their implementations. Each function returns a
+// value in the interval [0, 1], where 1 means the strings are identical.
+//
+// Trigram similarity (the default) is not included since it is computed by
+// PostgreSQL.
+var similarityFuncs = map[string]func(a, b string) float64{
+	"levenshtein": levenshteinSimilarity,
+	"jaro":        jaroWinkler,
+}
+
+// SimilarityFuncs is the list of names accepted by Searcher.Similarity.
+var SimilarityFuncs = []string{"trigram", "levenshtein", "jaro"}
+
+// candidateFactor is the number of candidates retrieved from the database
+// for each result requested when results are re-ranked in Go.
+const candidateFactor = 10
+
+// rerank recomputes the similarity of each result with the similarity
+// function of the searcher and sorts the results by it (from most to least
+// similar). Results with equal similarity retain their order from the
+// database. At most s.limit results are returned.
+func (s *Searcher) rerank(rs []Result) []Result {
+	f, ok := similarityFuncs[s.similarity]
+	if !ok {
+		// Wildcard searches are re-ranked without a similarity function.
+		f = jaroWinkler
+	}
+	query := strings.NewReplacer("%", "", "_", "").Replace(
+		strings.Join(s.name, " "))
+	query = strings.ToLower(strings.TrimSpace(query))
+	for i := range rs {
+		rs[i].Similarity = f(query, strings.ToLower(rs[i].Name))
+	}
+	sort.Stable(bySimilarity(rs))
+	if s.limit >= 0 && len(rs) > s.limit {
+		rs = rs[0:s.limit]
+	}
+	return rs
+}
+
+type bySimilarity []Result
+
+func (rs bySimilarity) Len() int      { return len(rs) }
+func (rs bySimilarity) Swap(i, j int) { rs[i], rs[j] = rs[j], rs[i] }
+func (rs bySimilarity) Less(i, j int) bool {
+	return rs[i].Similarity > rs[j].Similarity
+}
+
+// levenshteinSimilarity returns the Levenshtein (edit) distance between a and
+// b normalized to a similarity in [0, 1].
+func levenshteinSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein returns the minimum number of single character insertions,
+// deletions and substitutions required to turn a into b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of a and b, which favors
+// strings that share a common prefix. This tends to work better than trigram
+// similarity for short titles.
+func jaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	sim := jaro(ra, rb)
+	prefix := 0
+	for prefix < len(ra) && prefix < len(rb) && prefix < 4 {
+		if ra[prefix] != rb[prefix] {
+			break
+		}
+		prefix++
+	}
+	return sim + float64(prefix)*0.1*(1-sim)
+}
+
+// jaro returns the Jaro similarity of a and b.
+func jaro(a, b []rune) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	window := len(a)
+	if len(b) > window {
+		window = len(b)
+	}
+	window = window/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	amatch, bmatch := make([]bool, len(a)), make([]bool, len(b))
+	matches := 0
+	for i := range a {
+		lo, hi := i-window, i+window+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(b) {
+			hi = len(b)
+		}
+		for j := lo; j < hi; j++ {
+			if !bmatch[j] && a[i] == b[j] {
+				amatch[i], bmatch[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range a {
+		if !amatch[i] {
+			continue
+		}
+		for !bmatch[j] {
+			j++
+		}
+		if a[i] != b[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	t := float64(transpositions) / 2
+	return (m/float64(len(a)) + m/float64(len(b)) + (m-t)/m) / 3
+}
@@ -0,0 +1,53 @@
+package search
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		f        func(a, b string) float64
+		a, b     string
+		expected float64
+	}{
+		{levenshteinSimilarity, "", "", 1},
+		{levenshteinSimilarity, "up", "up", 1},
+		{levenshteinSimilarity, "kitten", "sitting", 1 - 3.0/7.0},
+		{levenshteinSimilarity, "abc", "xyz", 0},
+		{jaroWinkler, "", "", 1},
+		{jaroWinkler, "up", "", 0},
+		{jaroWinkler, "martha", "marhta", 0.961},
+		{jaroWinkler, "dwayne", "duane", 0.84},
+		{jaroWinkler, "dixon", "dicksonx", 0.813},
+	}
+	for _, test := range tests {
+		got := test.f(test.a, test.b)
+		if math.Abs(got-test.expected) > 0.001 {
+			t.Errorf("similarity of '%s' and '%s': expected %0.3f but got %0.3f",
+				test.a, test.b, test.expected, got)
+		}
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	year := func(mn, mx int) *Searcher {
+		s := &Searcher{name: []string{"the matrix"}}
+		s.year = newIrange(mn, mx)
+		return s
+	}
+	matrix := Result{Name: "The Matrix", Year: 1999, Similarity: -1}
+	matrix.Rank.Votes = 1000000
+	if c := year(1998, 2000).confidence(matrix); c < ConfidenceAccept {
+		t.Errorf("expected a confident match but got %0.3f", c)
+	}
+	if c := year(2010, 2012).confidence(matrix); c >= ConfidenceAccept {
+		t.Errorf("expected year disagreement to lower confidence, got %0.3f",
+			c)
+	}
+
+	other := Result{Name: "Mean Girls", Year: 2004, Similarity: -1}
+	if c := year(2010, 2012).confidence(other); c >= ConfidenceReject {
+		t.Errorf("expected an unconfident match but got %0.3f", c)
+	}
+}
@@ -0,0 +1,219 @@
+package search
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// The methods in this file accept search queries in forms that are easier to
+// generate from other programs than the '{NAME:ARGUMENT}' syntax. Each form
+// is translated to directives, so the same names and arguments are accepted
+// (with a few conveniences described below).
+
+// QueryKeyValue is like Query, except the query is a list of whitespace
+// separated pairs of the form 'key=value'. For example:
+//
+//	name="the matrix" entity=movie year=1999..2005 sort="rank desc"
+//
+// Values may be double quoted (with Go string escapes) to include
+// whitespace. Each key is the name (or synonym) of a directive, except for
+// the following special keys:
+//
+// 'name' (or 'text') is text to search the names of entities.
+//
+// 'entity' is the kind of entity to search for, e.g., 'entity=movie' is the
+// same as '{movie}'.
+//
+// Directives that don't take an argument are set with 'true', e.g.,
+// 'notv=true'. (A value of 'false' is ignored.)
+//
+// Ranges may be written as 'x..y' in addition to 'x-y'.
+//
+// Tokens without a '=' are searched as text.
+func (s *Searcher) QueryKeyValue(query string) error {
+	pairs, err := keyValuePairs(query)
+	if err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		if len(pair[0]) == 0 {
+			s.Text(pair[1])
+			continue
+		}
+		if err := s.addPair(pair[0], pair[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryJSON is like QueryKeyValue, except the query is a JSON object. Each
+// key of the object is interpreted like a key in QueryKeyValue. Values may
+// be strings, numbers or booleans. A value may also be a list, in which case
+// each element is added as a separate directive (e.g.,
+// '"genre": ["comedy", "drama"]'), or an object, in which case it is
+// translated to a query for a sub-search (e.g.,
+// '"show": {"name": "the office", "year": 2005}'). Since the keys of an
+// object have no order, multiple sort criteria must be given as a list,
+// e.g., '"sort": ["season asc", "episode asc"]'. For example:
+//
+//	{"name": "the matrix", "entity": "movie", "year": "1999..2005"}
+func (s *Searcher) QueryJSON(query []byte) error {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(query, &obj); err != nil {
+		return ef("Could not parse JSON query: %s", err)
+	}
+	return s.addJSONObject(obj)
+}
+
+func (s *Searcher) addJSONObject(obj map[string]interface{}) error {
+	for key, val := range obj {
+		vals, ok := val.([]interface{})
+		if !ok {
+			vals = []interface{}{val}
+		}
+		for _, v := range vals {
+			str, err := jsonQueryValue(v)
+			if err != nil {
+				return &ErrBadValue{Directive: key, Value: sf("%v", v),
+					Reason: err.Error()}
+			}
+			if err := s.addPair(key, str); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonQueryValue converts a JSON value to a value in a key=value query.
+// Objects are converted to a query string in the '{NAME:ARGUMENT}' syntax.
+func jsonQueryValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case map[string]interface{}:
+		var tokens []string
+		for key, val := range v {
+			vals, ok := val.([]interface{})
+			if !ok {
+				vals = []interface{}{val}
+			}
+			for _, elem := range vals {
+				str, err := jsonQueryValue(elem)
+				if err != nil {
+					return "", err
+				}
+				if tok := pairToken(key, str); len(tok) > 0 {
+					tokens = append(tokens, tok)
+				}
+			}
+		}
+		return strings.Join(tokens, " "), nil
+	}
+	return "", ef("unsupported JSON value")
+}
+
+// addPair adds a single key and value to the search.
+func (s *Searcher) addPair(key, val string) error {
+	switch key {
+	case "name", "text":
+		s.Text(val)
+		return nil
+	}
+	if _, ok := allCommands[key]; !ok && key != "entity" {
+		return &ErrUnknownDirective{Name: key}
+	}
+	if tok := pairToken(key, val); len(tok) > 0 {
+		return s.addToken(tok)
+	}
+	return nil
+}
+
+// pairToken converts a key and value to a single token in the
+// '{NAME:ARGUMENT}' syntax. An empty string is returned when the pair has no
+// effect (e.g., a flag set to false).
+func pairToken(key, val string) string {
+	switch key {
+	case "name", "text":
+		return val
+	case "entity":
+		// An unknown entity is reported as an unknown directive.
+		return "{" + val + "}"
+	}
+	cmd, ok := allCommands[key]
+	if ok && !cmd.hasArg() {
+		if b, err := strconv.ParseBool(val); err == nil {
+			if b {
+				return "{" + key + "}"
+			}
+			return ""
+		}
+	}
+	if ok && cmd.arg.kind == ValueRange {
+		val = strings.Replace(val, "..", "-", 1)
+	}
+	return sf("{%s:%s}", key, val)
+}
+
+// keyValuePairs splits a key=value query into pairs. Text without a key has
+// an empty key.
+func keyValuePairs(query string) ([][2]string, error) {
+	var pairs [][2]string
+	rest := strings.TrimSpace(query)
+	for len(rest) > 0 {
+		var key, val string
+		end := strings.IndexAny(rest, " \t\r\n=")
+		if end == -1 || rest[end] != '=' {
+			if end == -1 {
+				end = len(rest)
+			}
+			pairs = append(pairs, [2]string{"", rest[:end]})
+			rest = strings.TrimSpace(rest[end:])
+			continue
+		}
+		key, rest = rest[:end], rest[end+1:]
+		if strings.HasPrefix(rest, `"`) {
+			end = closingQuote(rest)
+			var err error
+			if end == -1 {
+				err = ef("unterminated quoted value")
+			} else {
+				val, err = strconv.Unquote(rest[:end+1])
+			}
+			if err != nil {
+				return nil, &ErrBadValue{Directive: key, Value: rest,
+					Reason: err.Error()}
+			}
+			rest = rest[end+1:]
+		} else {
+			end = strings.IndexAny(rest, " \t\r\n")
+			if end == -1 {
+				end = len(rest)
+			}
+			val, rest = rest[:end], rest[end:]
+		}
+		pairs = append(pairs, [2]string{key, val})
+		rest = strings.TrimSpace(rest)
+	}
+	return pairs, nil
+}
+
+// closingQuote returns the index of the double quote that ends the quoted
+// string at the start of s, or -1 if there isn't one.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
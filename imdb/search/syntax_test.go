@@ -0,0 +1,51 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+func TestQueryKeyValue(t *testing.T) {
+	s := New(nil)
+	err := s.QueryKeyValue(
+		`name="the matrix" entity=movie year=1999..2005 notv=true sort=rank`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.name) != 1 || s.name[0] != "the matrix" {
+		t.Errorf("unexpected text: %q", s.name)
+	}
+	if len(s.entities) != 1 || s.entities[0] != imdb.EntityMovie {
+		t.Errorf("unexpected entities: %v", s.entities)
+	}
+	if *s.year.min != 1999 || *s.year.max != 2005 {
+		t.Errorf("unexpected years: %d-%d", *s.year.min, *s.year.max)
+	}
+	if !s.noTvMovie || len(s.order) != 1 {
+		t.Errorf("unexpected searcher: %#v", s)
+	}
+
+	if err := New(nil).QueryKeyValue("nosuchthing=1"); err == nil {
+		t.Errorf("expected an error for an unknown key")
+	}
+}
+
+func TestQueryJSON(t *testing.T) {
+	s := New(nil)
+	err := s.QueryJSON([]byte(`{
+		"name": "the matrix",
+		"entity": "movie",
+		"genre": ["action", "sci-fi"],
+		"limit": 5
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.name) != 1 || len(s.entities) != 1 || len(s.genres) != 2 {
+		t.Errorf("unexpected searcher: %#v", s)
+	}
+	if s.limit != 5 {
+		t.Errorf("expected a limit of 5 but got %d", s.limit)
+	}
+}
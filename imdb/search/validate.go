@@ -0,0 +1,81 @@
+package search
+
+import (
+	"strings"
+)
+
+// Issue is a single problem found in a query string by Validate.
+type Issue struct {
+	// Token is the part of the query with the problem, e.g., '{years:abc}'.
+	Token string
+
+	// Err describes the problem. It is one of the error types in this
+	// package, like *ErrUnknownDirective or *ErrBadRange.
+	Err error
+}
+
+func (i Issue) String() string {
+	return sf("%s: %s", i.Token, i.Err)
+}
+
+// Validate parses the query string given and returns every problem with it,
+// instead of stopping at the first problem like Query does. Sub-searches
+// (like '{show:...}') are validated too. An empty slice means the query is
+// valid.
+//
+// Validate does not need a database, so it is suitable for checking queries
+// as they are typed. Since it doesn't run the query, it can't know whether
+// sub-searches will find anything.
+//
+// Validate is stricter than Query about sort directives: unknown sort fields
+// and orders other than 'asc' or 'desc' are reported, even though a search
+// silently ignores them.
+func Validate(query string) []Issue {
+	var issues []Issue
+	for _, token := range queryTokens(query) {
+		issues = append(issues, validateToken(token)...)
+	}
+	return issues
+}
+
+func validateToken(token string) []Issue {
+	issue := func(err error) []Issue {
+		return []Issue{{token, err}}
+	}
+	name, val := argOption(token)
+	cmd, ok := allCommands[name]
+	if !ok {
+		if len(name) > 0 {
+			return issue(&ErrUnknownDirective{Name: name})
+		}
+		return nil
+	}
+	if cmd.name == "sort" {
+		if fields := strings.Fields(val); len(fields) == 2 {
+			if len(orderColumnQualified(fields[0])) == 0 {
+				return issue(&ErrBadValue{Directive: name, Value: fields[0],
+					Reason: "unknown sort field"})
+			}
+			if !validOrder(fields[1]) {
+				return issue(&ErrBadValue{Directive: name, Value: fields[1],
+					Reason: "sort order must be 'asc' or 'desc'"})
+			}
+		}
+	}
+
+	err := New(nil).addToken(token)
+	if sub, ok := err.(*ErrSubSearch); ok {
+		// Report every problem in the sub-search, not just the first.
+		var issues []Issue
+		for _, is := range Validate(val) {
+			issues = append(issues, Issue{
+				Token: sf("%s in %s", is.Token, token),
+				Err:   &ErrSubSearch{Kind: sub.Kind, Err: is.Err},
+			})
+		}
+		return issues
+	} else if err != nil {
+		return issue(err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package imdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+)
+
+// sessionStatements returns the statements that set up every connection to
+// a database opened with the options given. They're run on each connection
+// as it's opened, since settings like these only apply to the connection
+// they're run on. (Running them once on the pool would only set up whichever
+// connection happened to run them, and concurrent searches open more.)
+func sessionStatements(driver string, opts Options) []string {
+	var stmts []string
+	switch driver {
+	case "postgres":
+		stmts = append(stmts, "SET timezone = UTC")
+	case "sqlite3":
+		if opts.ReadOnly {
+			// In case the SQLite driver doesn't understand URI file names.
+			stmts = append(stmts, "PRAGMA query_only = ON")
+		}
+		stmts = append(stmts, opts.SQLite.pragmas(opts.ReadOnly)...)
+	}
+	return stmts
+}
+
+// withSession reopens the connection pool of the database such that the
+// session statements for the options given are run on every connection.
+func (db *DB) withSession(dsn string, opts Options) error {
+	stmts := sessionStatements(db.Driver, opts)
+	if len(stmts) == 0 {
+		return nil
+	}
+	if opts.ReadOnly {
+		var err error
+		if dsn, err = readOnlyDsn(db.Driver, dsn); err != nil {
+			return err
+		}
+	}
+	conn := sessionConnector{db.DB.Driver(), dsn, stmts}
+	if err := db.DB.Close(); err != nil {
+		return err
+	}
+	db.DB = sql.OpenDB(conn)
+	return nil
+}
+
+// sessionConnector opens connections to a database and runs statements on
+// each one.
+type sessionConnector struct {
+	drv   driver.Driver
+	dsn   string
+	stmts []string
+}
+
+func (c sessionConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.drv.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range c.stmts {
+		if err := execConn(conn, stmt); err != nil {
+			conn.Close()
+			return nil, ef("Could not run '%s': %s",
+				strings.TrimPrefix(stmt, "PRAGMA "), err)
+		}
+	}
+	return conn, nil
+}
+
+func (c sessionConnector) Driver() driver.Driver {
+	return c.drv
+}
+
+// execConn runs a statement without arguments on a driver connection.
+func execConn(conn driver.Conn, q string) error {
+	stmt, err := conn.Prepare(q)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	// Pragmas that set a value also return it, which is ignored.
+	rows, err := stmt.Query(nil)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
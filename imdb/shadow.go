@@ -0,0 +1,136 @@
+package imdb
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/BurntSushi/csql"
+)
+
+// Loading a list rebuilds its tables from scratch. On PostgreSQL, new rows
+// are inserted into a shadow copy of each table (the name of the table with
+// a '_shadow' suffix), and the shadows replace their tables in a single
+// transaction once the list is loaded. Until then, readers keep seeing the
+// old rows instead of waiting on a table that is being rebuilt. Other
+// databases rebuild tables in place. (SQLite readers still see a consistent
+// snapshot, since SQLite databases are opened in WAL mode.)
+
+// ShadowTable prepares the table given to be rebuilt in the transaction
+// given, and returns the name of the table that its new rows should be
+// inserted into. On PostgreSQL, that's a new and empty shadow table, which
+// must replace the table with SwapShadows once every row is committed.
+// Otherwise, it's the table itself, which is emptied.
+//
+// If resume is true, then the rows already in the shadow table are kept, so
+// that an interrupted load can pick up where it stopped. (If there is no
+// shadow table, then the rows committed so far are in the table itself, so
+// they're copied into a new shadow table.)
+func (db *DB) ShadowTable(
+	tx *sql.Tx,
+	table string,
+	resume bool,
+) (name string, err error) {
+	defer csql.Safe(&err)
+
+	if db.Driver != "postgres" {
+		if !resume {
+			csql.Truncate(tx, db.Driver, table)
+		}
+		return table, nil
+	}
+
+	shadow := table + "_shadow"
+	if resume {
+		var exists bool
+		csql.Scan(tx.QueryRow("SELECT to_regclass($1) IS NOT NULL", shadow),
+			&exists)
+		if exists {
+			return shadow, nil
+		}
+	}
+	parts, err := db.Partitions(table)
+	csql.Panic(err)
+
+	csql.Exec(tx, "DROP TABLE IF EXISTS "+shadow) // and its partitions
+	like := sf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS "+
+		"INCLUDING CONSTRAINTS)", shadow, table)
+	if len(parts) == 0 {
+		csql.Exec(tx, like)
+	} else {
+		csql.Exec(tx, sf("%s PARTITION BY HASH (%s)",
+			like, partitionKeys[table]))
+		for i := range parts {
+			csql.Exec(tx, sf(`
+				CREATE TABLE %s_p%d PARTITION OF %s
+				FOR VALUES WITH (MODULUS %d, REMAINDER %d)`,
+				shadow, i, shadow, len(parts), i))
+		}
+	}
+	if pkey := primaryKey(table); len(pkey) > 0 {
+		csql.Exec(tx, sf("ALTER TABLE %s ADD PRIMARY KEY (%s)",
+			shadow, strings.Join(pkey, ", ")))
+	}
+	if resume {
+		csql.Exec(tx, sf("INSERT INTO %s SELECT * FROM %s", shadow, table))
+	}
+	return shadow, nil
+}
+
+// SwapShadows replaces each of the tables given with its shadow table (see
+// ShadowTable) in a single transaction, so that readers see either all of
+// the old rows or all of the new rows. It does nothing on databases other
+// than PostgreSQL.
+//
+// The indices of the old tables are dropped along with them, so they should
+// be created again with CreateIndices.
+func (db *DB) SwapShadows(tables ...string) (err error) {
+	defer csql.Safe(&err)
+
+	if db.Driver != "postgres" || len(tables) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	// Primary keys are named after the table they were created on, so
+	// they're renamed too. Otherwise, the next shadow table couldn't use
+	// the same name.
+	renameKey := func(table, old string) {
+		csql.Exec(tx, sf("ALTER TABLE %s RENAME CONSTRAINT %s_pkey TO %s_pkey",
+			table, old, table))
+	}
+	for _, table := range tables {
+		shadow := table + "_shadow"
+		parts, err := db.Partitions(shadow)
+		csql.Panic(err)
+		haskey := len(primaryKey(table)) > 0
+
+		csql.Exec(tx, "DROP TABLE "+table) // and its partitions
+		csql.Exec(tx, sf("ALTER TABLE %s RENAME TO %s", shadow, table))
+		if haskey {
+			renameKey(table, shadow)
+		}
+		for i := range parts {
+			part := sf("%s_p%d", table, i)
+			csql.Exec(tx, sf("ALTER TABLE %s_p%d RENAME TO %s",
+				shadow, i, part))
+			if haskey {
+				renameKey(part, sf("%s_p%d", shadow, i))
+			}
+		}
+	}
+	csql.Panic(tx.Commit())
+	return
+}
+
+// primaryKey returns the columns of the primary key of the table given,
+// according to Schema.
+func primaryKey(table string) []string {
+	for _, t := range Schema() {
+		if t.Name == table {
+			return t.PrimaryKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package imdb
+
+import (
+	"strings"
+	"testing"
+)
+
+// shadowStmts runs f and returns every statement it ran on a fake database.
+func shadowStmts(t *testing.T, f func()) []string {
+	n := testDriver.count()
+	f()
+	var stmts []string
+	for _, c := range testDriver.opened(n) {
+		for _, q := range c.ran() {
+			stmts = append(stmts, strings.Join(strings.Fields(q), " "))
+		}
+	}
+	return stmts
+}
+
+func hasStmt(stmts []string, prefix string) bool {
+	for _, q := range stmts {
+		if strings.HasPrefix(q, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestShadowTable(t *testing.T) {
+	tests := []struct {
+		driver string
+		resume bool
+		name   string
+		want   []string
+	}{
+		{"postgres", false, "movie_shadow", []string{
+			"DROP TABLE IF EXISTS movie_shadow",
+			"CREATE TABLE movie_shadow (LIKE movie INCLUDING DEFAULTS",
+			"ALTER TABLE movie_shadow ADD PRIMARY KEY (atom_id)",
+			"DROP TABLE movie",
+			"ALTER TABLE movie_shadow RENAME TO movie",
+			"ALTER TABLE movie RENAME CONSTRAINT movie_shadow_pkey TO movie_pkey",
+		}},
+		{"sqlite3", false, "movie", []string{"DELETE FROM movie"}},
+		{"sqlite3", true, "movie", nil},
+	}
+	for _, test := range tests {
+		db := openFake(t, test.driver)
+		var name string
+		stmts := shadowStmts(t, func() {
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name, err = db.ShadowTable(tx, "movie", test.resume); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.SwapShadows("movie"); err != nil {
+				t.Fatal(err)
+			}
+		})
+		db.Close()
+
+		if name != test.name {
+			t.Errorf("%s: rows go in %s, want %s", test.driver, name, test.name)
+		}
+		for _, want := range test.want {
+			if !hasStmt(stmts, want) {
+				t.Errorf("%s: did not run '%s' in %q", test.driver, want, stmts)
+			}
+		}
+		if len(test.want) == 0 && len(stmts) > 0 {
+			t.Errorf("%s: ran %q, want nothing", test.driver, stmts)
+		}
+	}
+}
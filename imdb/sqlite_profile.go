@@ -0,0 +1,67 @@
+package imdb
+
+// SQLiteProfile is a set of pragmas that tune a SQLite database for one kind
+// of work. SQLite's defaults are safe but make loading slow and leave most of
+// the memory of a server unused. Profiles are ignored by other databases.
+type SQLiteProfile int
+
+const (
+	// SQLiteDefault leaves SQLite's settings alone, except for WAL mode.
+	// (See Open.)
+	SQLiteDefault SQLiteProfile = iota
+
+	// SQLiteLoad turns off synchronous writes and uses a big page cache,
+	// which makes loading much faster. The database stays in WAL mode, so
+	// other programs can still read it while it's being loaded. If the
+	// operating system crashes or the power fails while the database is
+	// being changed, the database may be corrupted and must be loaded again
+	// from scratch.
+	SQLiteLoad
+
+	// SQLiteServe uses WAL mode (so that readers aren't blocked while the
+	// database is loaded) and maps the database into memory, which makes
+	// repeated searches faster.
+	SQLiteServe
+)
+
+// SQLiteProfiles maps the name of each profile to the profile.
+var SQLiteProfiles = map[string]SQLiteProfile{
+	"default": SQLiteDefault,
+	"load":    SQLiteLoad,
+	"serve":   SQLiteServe,
+}
+
+func (p SQLiteProfile) String() string {
+	for name, profile := range SQLiteProfiles {
+		if profile == p {
+			return name
+		}
+	}
+	return sf("SQLiteProfile(%d)", int(p))
+}
+
+// pragmas returns the statements that apply the profile to a connection.
+// The journal mode can't be changed in read-only databases.
+func (p SQLiteProfile) pragmas(readOnly bool) []string {
+	var pragmas []string
+	switch p {
+	case SQLiteLoad:
+		if !readOnly {
+			pragmas = append(pragmas, "PRAGMA journal_mode = WAL")
+		}
+		pragmas = append(pragmas,
+			"PRAGMA synchronous = OFF",
+			"PRAGMA cache_size = -1048576", // 1GB, in kilobytes
+		)
+	case SQLiteServe:
+		if !readOnly {
+			pragmas = append(pragmas, "PRAGMA journal_mode = WAL")
+		}
+		pragmas = append(pragmas,
+			"PRAGMA mmap_size = 1073741824", // 1GB
+			"PRAGMA cache_size = -65536",    // 64MB, in kilobytes
+			"PRAGMA temp_store = MEMORY",
+		)
+	}
+	return pragmas
+}
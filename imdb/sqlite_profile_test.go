@@ -0,0 +1,31 @@
+package imdb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSQLiteProfilePragmas(t *testing.T) {
+	if pragmas := SQLiteDefault.pragmas(false); len(pragmas) > 0 {
+		t.Errorf("default profile has pragmas: %v", pragmas)
+	}
+	journal := func(pragmas []string) bool {
+		for _, pragma := range pragmas {
+			if strings.Contains(pragma, "journal_mode") {
+				if !strings.HasSuffix(pragma, "= WAL") {
+					t.Errorf("%s turns off WAL mode", pragma)
+				}
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range []SQLiteProfile{SQLiteLoad, SQLiteServe} {
+		if !journal(p.pragmas(false)) {
+			t.Errorf("%s: journal mode isn't set", p)
+		}
+		if journal(p.pragmas(true)) {
+			t.Errorf("%s: journal mode is set for read-only databases", p)
+		}
+	}
+}
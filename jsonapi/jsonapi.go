@@ -0,0 +1,187 @@
+/*
+Package jsonapi is the JSON interface to Goim that other programs can rely on.
+It's used by the '-json' flag of the 'search' and 'short' commands and by the
+C shared library built from the 'libgoim' directory, so that tools in other
+languages (like Python or Node) can use Goim without parsing its text output
+or running a server.
+
+Every request and response is a JSON object. Responses have a 'version' key,
+which is the version of this interface (see Version), and an 'error' key when
+the request failed. Keys are never renamed or removed within a version, and
+new keys may be added, so clients should ignore keys they don't know.
+
+A search request is
+
+	{"query": "the matrix {years:1999}"}
+
+and its response has the query and its results, each encoded like a search
+result of the 'imdb/search' package (with camelCase keys):
+
+	{"version": 1, "query": "...", "results": [{"entity": "movie", ...}]}
+
+An entity request has one of an atom identifier (with an optional entity type,
+one of 'movie', 'tvshow', 'episode' or 'actor'), an IMDb identifier (which must
+be loaded as a cross reference) or a query, whose best result is used:
+
+	{"id": 1234, "entity": "movie"}
+	{"imdb": "tt0133093"}
+	{"query": "the matrix {years:1999}"}
+
+and its response has the entity, encoded like the entities of the 'imdb'
+package, or null when the query has no results:
+
+	{"version": 1, "entity": {"entity": "movie", "id": 1234, ...}}
+
+When an entity request has '"provenance": true', its response also has the
+list that each field of the entity was loaded from (and the generation it was
+last loaded in), keyed by the field (see imdb.Provenance):
+
+	{"version": 1, "entity": {...}, "provenance": {"title": {...}, ...}}
+
+Since keys follow imdb.JSONSnakeCase, programs that promise this interface
+must leave it false.
+*/
+package jsonapi
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
+)
+
+// Version is the version of the JSON interface. It's incremented whenever a
+// key of a request or response is renamed or removed, or its meaning changes.
+const Version = 1
+
+var ef = fmt.Errorf
+
+// SearchRequest asks for the results of a search query.
+type SearchRequest struct {
+	Query string `json:"query"`
+}
+
+// SearchResponse is the response to a SearchRequest. Results is empty (but
+// not null) when there are no results or the search failed.
+type SearchResponse struct {
+	Version int             `json:"version"`
+	Query   string          `json:"query"`
+	Results []search.Result `json:"results"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// EntityRequest asks for one entity. Only one of Id, Imdb and Query should be
+// set. Entity is the type of the entity with the Id given, which is guessed
+// when it's empty.
+type EntityRequest struct {
+	Id     imdb.Atom `json:"id,omitempty"`
+	Entity string    `json:"entity,omitempty"`
+	Imdb   string    `json:"imdb,omitempty"`
+	Query  string    `json:"query,omitempty"`
+
+	// Provenance asks for the source of each field of the entity.
+	Provenance bool `json:"provenance,omitempty"`
+}
+
+// EntityResponse is the response to an EntityRequest. Entity is nil when the
+// request's query has no results or the request failed. Provenance is only
+// set when the request asks for it.
+type EntityResponse struct {
+	Version    int             `json:"version"`
+	Entity     imdb.Entity     `json:"entity"`
+	Provenance imdb.Provenance `json:"provenance,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// Search runs the search in the request. The searcher is passed to
+// configure (if it isn't nil) before it runs, e.g., to set a fallback.
+// Errors are reported in the response.
+func Search(
+	db *imdb.DB,
+	req SearchRequest,
+	configure func(*search.Searcher),
+) *SearchResponse {
+	resp := &SearchResponse{
+		Version: Version,
+		Query:   req.Query,
+		Results: []search.Result{},
+	}
+	results, err := runSearch(db, req.Query, configure)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.Results = append(resp.Results, results...)
+	return resp
+}
+
+// GetEntity returns the entity in the request. The searcher of a request with
+// a query is passed to configure (if it isn't nil) before it runs. Errors are
+// reported in the response.
+func GetEntity(
+	db *imdb.DB,
+	req EntityRequest,
+	configure func(*search.Searcher),
+) *EntityResponse {
+	resp := &EntityResponse{Version: Version}
+	ent, err := getEntity(db, req, configure)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.Entity = ent
+	if req.Provenance && ent != nil {
+		if resp.Provenance, err = db.EntityProvenance(ent); err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	return resp
+}
+
+func getEntity(
+	db *imdb.DB,
+	req EntityRequest,
+	configure func(*search.Searcher),
+) (imdb.Entity, error) {
+	switch {
+	case req.Id > 0 && len(req.Entity) > 0:
+		ent, ok := imdb.Entities[req.Entity]
+		if !ok {
+			return nil, ef("Unrecognized entity '%s'", req.Entity)
+		}
+		return imdb.FromAtom(db, ent, req.Id)
+	case req.Id > 0:
+		return imdb.FromAtomGuess(db, req.Id)
+	case len(req.Imdb) > 0:
+		id, err := imdb.AtomFromXref(db, "imdb", req.Imdb)
+		if err != nil {
+			return nil, err
+		}
+		if id == 0 {
+			return nil, ef("No entity has the IMDb identifier '%s'", req.Imdb)
+		}
+		return imdb.FromAtomGuess(db, id)
+	case len(req.Query) > 0:
+		results, err := runSearch(db, req.Query, configure)
+		if err != nil || len(results) == 0 {
+			return nil, err
+		}
+		return results[0].GetEntity(db)
+	}
+	return nil, ef("An entity request needs an id, an IMDb id or a query")
+}
+
+func runSearch(
+	db *imdb.DB,
+	query string,
+	configure func(*search.Searcher),
+) ([]search.Result, error) {
+	s, err := search.Query(db, query)
+	if err != nil {
+		return nil, err
+	}
+	if configure != nil {
+		configure(s)
+	}
+	return s.Results()
+}
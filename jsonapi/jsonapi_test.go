@@ -0,0 +1,118 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
+)
+
+// The encoding of responses is the contract with other programs, so these
+// tests must only change when Version does.
+
+func TestSearchResponse(t *testing.T) {
+	resp := &SearchResponse{
+		Version: Version,
+		Query:   "the matrix",
+		Results: []search.Result{{
+			Entity: imdb.EntityMovie,
+			Id:     42,
+			Name:   "The Matrix",
+			Year:   1999,
+		}},
+	}
+	got := encode(t, resp)
+	for _, key := range []string{"version", "query", "results"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("missing key '%s' in %v", key, got)
+		}
+	}
+	if _, ok := got["error"]; ok {
+		t.Errorf("unexpected key 'error' in %v", got)
+	}
+	result := got["results"].([]interface{})[0].(map[string]interface{})
+	for key, want := range map[string]interface{}{
+		"entity": "movie",
+		"id":     42.0,
+		"name":   "The Matrix",
+		"year":   1999.0,
+	} {
+		if result[key] != want {
+			t.Errorf("result key '%s' is %v, want %v", key, result[key], want)
+		}
+	}
+
+	empty := encode(t, &SearchResponse{Version: Version, Error: "oops"})
+	if empty["error"] != "oops" {
+		t.Errorf("error is %v, want 'oops'", empty["error"])
+	}
+}
+
+func TestEntityResponse(t *testing.T) {
+	got := encode(t, &EntityResponse{
+		Version: Version,
+		Entity: &imdb.Episode{
+			Id: 7, TvshowId: 3, Title: "Rose", Year: 2005,
+			Season: 1, EpisodeNum: 1,
+		},
+	})
+	ent := got["entity"].(map[string]interface{})
+	for key, want := range map[string]interface{}{
+		"entity":     "episode",
+		"id":         7.0,
+		"tvshowId":   3.0,
+		"episodeNum": 1.0,
+	} {
+		if ent[key] != want {
+			t.Errorf("entity key '%s' is %v, want %v", key, ent[key], want)
+		}
+	}
+
+	none := encode(t, &EntityResponse{Version: Version})
+	if v, ok := none["entity"]; !ok || v != nil {
+		t.Errorf("entity is %v, want null", v)
+	}
+	if _, ok := none["provenance"]; ok {
+		t.Errorf("provenance is set without being asked for")
+	}
+
+	sourced := encode(t, &EntityResponse{
+		Version: Version,
+		Entity:  &imdb.Actor{Id: 9, FullName: "Rigg, Diana"},
+		Provenance: imdb.Provenance{
+			"fullName": {List: "actresses", Generation: 2},
+		},
+	})
+	prov := sourced["provenance"].(map[string]interface{})
+	name := prov["fullName"].(map[string]interface{})
+	if name["list"] != "actresses" || name["generation"] != 2.0 {
+		t.Errorf("provenance of 'fullName' is %v, want actresses@2", name)
+	}
+}
+
+func TestEntityRequest(t *testing.T) {
+	var req EntityRequest
+	err := json.Unmarshal([]byte(`{"id": 5, "entity": "tvshow"}`), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Id != 5 || req.Entity != "tvshow" {
+		t.Errorf("got %#v", req)
+	}
+}
+
+func encode(t *testing.T, v interface{}) map[string]interface{} {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(bs, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["version"] != float64(Version) {
+		t.Errorf("version is %v, want %d", m["version"], Version)
+	}
+	return m
+}
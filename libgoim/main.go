@@ -0,0 +1,143 @@
+/*
+Command libgoim is a C shared library for using Goim from other languages. It
+is built with
+
+	go build -buildmode=c-shared -o libgoim.so ./libgoim
+
+which also writes the C header 'libgoim.h'. (Use 'libgoim.dylib' or
+'libgoim.dll' on macOS and Windows.) It exports these functions:
+
+	char *GoimSearch(char *request);
+	char *GoimGetEntity(char *request);
+	void GoimFree(char *response);
+	void GoimClose(void);
+
+GoimSearch and GoimGetEntity take a request as a JSON string and return a
+response as a JSON string, in the format of the 'jsonapi' package. Requests
+also have the 'driver' (which defaults to 'sqlite3') and 'dsn' keys of the
+database to use, and optionally 'readOnly' (see imdb.OpenReadOnly), e.g.,
+
+	{"driver": "sqlite3", "dsn": "goim.sqlite", "query": "the matrix"}
+
+Databases are opened by the first request that uses them and stay open until
+GoimClose is called. Every response must be freed with GoimFree.
+
+For example, in Python:
+
+	import ctypes, json
+	goim = ctypes.CDLL("./libgoim.so")
+	goim.GoimSearch.restype = ctypes.c_void_p
+	req = {"dsn": "goim.sqlite", "query": "the matrix"}
+	p = goim.GoimSearch(json.dumps(req).encode())
+	resp = json.loads(ctypes.string_at(p))
+	goim.GoimFree(ctypes.c_void_p(p))
+*/
+package main
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"encoding/json"
+	"sync"
+	"unsafe"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
+	"github.com/BurntSushi/goim/jsonapi"
+)
+
+// dbRequest is the database that a request uses.
+type dbRequest struct {
+	Driver   string `json:"driver"`
+	Dsn      string `json:"dsn"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+var (
+	// dbs are the databases opened by requests, keyed by how they were opened.
+	dbs   = make(map[dbRequest]*imdb.DB)
+	dbsMu sync.Mutex
+)
+
+//export GoimSearch
+func GoimSearch(request *C.char) *C.char {
+	var req jsonapi.SearchRequest
+	db, err := decode(C.GoString(request), &req)
+	if err != nil {
+		return respond(&jsonapi.SearchResponse{
+			Version: jsonapi.Version,
+			Query:   req.Query,
+			Results: []search.Result{},
+			Error:   err.Error(),
+		})
+	}
+	return respond(jsonapi.Search(db, req, nil))
+}
+
+//export GoimGetEntity
+func GoimGetEntity(request *C.char) *C.char {
+	var req jsonapi.EntityRequest
+	db, err := decode(C.GoString(request), &req)
+	if err != nil {
+		return respond(&jsonapi.EntityResponse{
+			Version: jsonapi.Version,
+			Error:   err.Error(),
+		})
+	}
+	return respond(jsonapi.GetEntity(db, req, nil))
+}
+
+//export GoimFree
+func GoimFree(response *C.char) {
+	C.free(unsafe.Pointer(response))
+}
+
+//export GoimClose
+func GoimClose() {
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	for key, db := range dbs {
+		db.Close()
+		delete(dbs, key)
+	}
+}
+
+// decode decodes the request into req and returns the database it uses,
+// which is opened if it isn't open already.
+func decode(request string, req interface{}) (*imdb.DB, error) {
+	if err := json.Unmarshal([]byte(request), req); err != nil {
+		return nil, err
+	}
+	dbreq := dbRequest{Driver: "sqlite3"}
+	if err := json.Unmarshal([]byte(request), &dbreq); err != nil {
+		return nil, err
+	}
+
+	dbsMu.Lock()
+	defer dbsMu.Unlock()
+	if db, ok := dbs[dbreq]; ok {
+		return db, nil
+	}
+	db, err := imdb.OpenWith(dbreq.Driver, dbreq.Dsn,
+		imdb.Options{ReadOnly: dbreq.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	dbs[dbreq] = db
+	return db, nil
+}
+
+// respond encodes a response as a C string, which must be freed by GoimFree.
+func respond(resp interface{}) *C.char {
+	bs, err := json.Marshal(resp)
+	if err != nil {
+		bs, _ = json.Marshal(map[string]interface{}{
+			"version": jsonapi.Version,
+			"error":   err.Error(),
+		})
+	}
+	return C.CString(string(bs))
+}
+
+func main() {}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// libraryItem is a movie or TV show in a Plex or Jellyfin library.
+type libraryItem struct {
+	Title  string
+	Year   int
+	Entity imdb.EntityKind
+
+	// Ids are the identifiers of the item in other databases, keyed by the
+	// same sources as cross references (e.g., 'imdb' or 'tmdb').
+	Ids map[string]string
+}
+
+// xrefSources are the sources of library identifiers that are looked up in
+// the cross references of the database, in order of preference.
+var xrefSources = []string{"imdb", "tmdb", "tvdb"}
+
+// readLibrary reads the movies and TV shows in a Plex library (as the XML
+// returned by '/library/sections/N/all') or a Jellyfin library (as the JSON
+// returned by '/Items'). Which one it is is guessed from its first character.
+func readLibrary(r io.Reader) ([]libraryItem, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, ef("Could not read library: %s", err)
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n', 0xEF, 0xBB, 0xBF: // including a BOM
+			continue
+		case '<':
+			br.UnreadByte()
+			return readPlexLibrary(br)
+		case '{':
+			br.UnreadByte()
+			return readJellyfinLibrary(br)
+		}
+		return nil, ef("Library is neither Plex XML nor Jellyfin JSON.")
+	}
+}
+
+// readPlexLibrary reads the XML of a Plex library section. Identifiers are
+// read from the 'guid' of each item, and from its 'Guid' elements when the
+// library was requested with 'includeGuids=1'.
+func readPlexLibrary(r io.Reader) ([]libraryItem, error) {
+	type plexItem struct {
+		Type  string `xml:"type,attr"`
+		Title string `xml:"title,attr"`
+		Year  string `xml:"year,attr"`
+		Guid  string `xml:"guid,attr"`
+		Guids []struct {
+			Id string `xml:"id,attr"`
+		} `xml:"Guid"`
+	}
+	var container struct {
+		Videos      []plexItem `xml:"Video"`
+		Directories []plexItem `xml:"Directory"`
+	}
+	if err := xml.NewDecoder(r).Decode(&container); err != nil {
+		return nil, ef("Could not read Plex library: %s", err)
+	}
+
+	var items []libraryItem
+	for _, pi := range append(container.Videos, container.Directories...) {
+		item := libraryItem{Title: pi.Title, Ids: make(map[string]string)}
+		switch pi.Type {
+		case "movie":
+			item.Entity = imdb.EntityMovie
+		case "show":
+			item.Entity = imdb.EntityTvshow
+		default:
+			continue
+		}
+		item.Year, _ = strconv.Atoi(pi.Year)
+		guids := []string{pi.Guid}
+		for _, g := range pi.Guids {
+			guids = append(guids, g.Id)
+		}
+		for _, guid := range guids {
+			if source, id := plexGuid(guid); len(source) > 0 {
+				item.Ids[source] = id
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// plexGuid returns the source and identifier of a Plex GUID, e.g., 'imdb' and
+// 'tt0133093' for 'imdb://tt0133093' or for the GUIDs of Plex's older agents
+// like 'com.plexapp.agents.imdb://tt0133093?lang=en'. Plex's own GUIDs (e.g.,
+// 'plex://movie/...') have no source.
+func plexGuid(guid string) (source, id string) {
+	i := strings.Index(guid, "://")
+	if i == -1 {
+		return "", ""
+	}
+	agent, id := guid[:i], guid[i+3:]
+	agent = strings.TrimPrefix(agent, "com.plexapp.agents.")
+	if j := strings.IndexAny(id, "?/"); j > -1 {
+		id = id[:j]
+	}
+	switch agent {
+	case "imdb":
+		return "imdb", id
+	case "tmdb", "themoviedb":
+		return "tmdb", id
+	case "tvdb", "thetvdb":
+		return "tvdb", id
+	}
+	return "", ""
+}
+
+// readJellyfinLibrary reads the JSON of a Jellyfin (or Emby) item query.
+// Identifiers are read from the 'ProviderIds' of each item, which are only
+// included when the query has 'Fields=ProviderIds'.
+func readJellyfinLibrary(r io.Reader) ([]libraryItem, error) {
+	var result struct {
+		Items []struct {
+			Name           string
+			ProductionYear int
+			Type           string
+			ProviderIds    map[string]string
+		}
+	}
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return nil, ef("Could not read Jellyfin library: %s", err)
+	}
+
+	var items []libraryItem
+	for _, ji := range result.Items {
+		item := libraryItem{
+			Title: ji.Name,
+			Year:  ji.ProductionYear,
+			Ids:   make(map[string]string),
+		}
+		switch ji.Type {
+		case "Movie":
+			item.Entity = imdb.EntityMovie
+		case "Series":
+			item.Entity = imdb.EntityTvshow
+		default:
+			continue
+		}
+		for source, id := range ji.ProviderIds {
+			if len(id) > 0 {
+				item.Ids[strings.ToLower(source)] = id
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
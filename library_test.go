@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/goim/imdb"
+	"github.com/BurntSushi/goim/imdb/search"
+)
+
+const testPlexLibrary = `<?xml version="1.0" encoding="UTF-8"?>
+<MediaContainer size="3" librarySectionTitle="Movies">
+  <Video type="movie" title="The Matrix" year="1999"
+    guid="plex://movie/5d776825880197001ec967c6">
+    <Guid id="imdb://tt0133093" />
+    <Guid id="tmdb://603" />
+  </Video>
+  <Video type="movie" title="Brazil" year="1985"
+    guid="com.plexapp.agents.themoviedb://68?lang=en" />
+  <Video type="episode" title="Pilot" />
+  <Directory type="show" title="Firefly" year="2002"
+    guid="com.plexapp.agents.thetvdb://78874?lang=en" />
+</MediaContainer>
+`
+
+const testJellyfinLibrary = `{
+  "Items": [
+    {"Name": "The Matrix", "ProductionYear": 1999, "Type": "Movie",
+     "ProviderIds": {"Imdb": "tt0133093", "Tmdb": "603"}},
+    {"Name": "Firefly", "ProductionYear": 2002, "Type": "Series",
+     "ProviderIds": {"Tvdb": "78874", "Imdb": ""}},
+    {"Name": "Extras", "Type": "Folder"},
+    {"Name": "Primer", "Type": "Movie"}
+  ],
+  "TotalRecordCount": 4
+}`
+
+func TestReadLibrary(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		library string
+		want    []libraryItem
+	}{
+		{"plex", testPlexLibrary, []libraryItem{
+			{"The Matrix", 1999, imdb.EntityMovie,
+				map[string]string{"imdb": "tt0133093", "tmdb": "603"}},
+			{"Brazil", 1985, imdb.EntityMovie,
+				map[string]string{"tmdb": "68"}},
+			{"Firefly", 2002, imdb.EntityTvshow,
+				map[string]string{"tvdb": "78874"}},
+		}},
+		{"jellyfin", "\xEF\xBB\xBF" + testJellyfinLibrary, []libraryItem{
+			{"The Matrix", 1999, imdb.EntityMovie,
+				map[string]string{"imdb": "tt0133093", "tmdb": "603"}},
+			{"Firefly", 2002, imdb.EntityTvshow,
+				map[string]string{"tvdb": "78874"}},
+			{"Primer", 0, imdb.EntityMovie, map[string]string{}},
+		}},
+	} {
+		got, err := readLibrary(strings.NewReader(test.library))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\n got %#v\nwant %#v", test.name, got, test.want)
+		}
+	}
+	if _, err := readLibrary(strings.NewReader("title,year\n")); err == nil {
+		t.Errorf("expected an error for a CSV library")
+	}
+}
+
+func TestDiffLibrary(t *testing.T) {
+	items := []libraryItem{
+		{"The Matrix", 1999, imdb.EntityMovie,
+			map[string]string{"imdb": "tt0133093"}},
+		{"Brazil", 1985, imdb.EntityMovie, nil},
+		{"Unknown", 0, imdb.EntityMovie, nil},
+	}
+	atoms := []imdb.Atom{1, 2, 0}
+	results := []search.Result{
+		{Entity: imdb.EntityMovie, Id: 1, Name: "The Matrix", Year: 1999},
+		{Entity: imdb.EntityMovie, Id: 3, Name: "Heat", Year: 1995},
+		{Entity: imdb.EntityMovie, Id: 3, Name: "Heat", Year: 1995},
+	}
+	got := diffLibrary(items, atoms, results)
+	want := []libraryDiff{
+		{"both", "The Matrix", 1999, "movie", 1, "imdb:tt0133093"},
+		{"library-only", "Brazil", 1985, "movie", 2, ""},
+		{"unmatched", "Unknown", 0, "movie", 0, ""},
+		{"search-only", "Heat", 1995, "movie", 3, ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\n got %#v\nwant %#v", got, want)
+	}
+}
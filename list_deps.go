@@ -0,0 +1,121 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/ty/fun"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// listDeps maps the name of each list to the lists that must be loaded
+// before it. Together, they form a directed acyclic graph that determines the
+// order in which lists are loaded. Lists registered with RegisterList depend
+// on the 'movies' list unless they're added here with other dependencies.
+//
+// A dependency is satisfied either by loading it along with the list that
+// depends on it, or by having loaded it before. (See listLoaded.)
+var listDeps = map[string][]string{
+	"movies": nil,
+	"actors": {"movies"},
+	"crew":   {"movies"},
+
+	// Biographies describe actors, so their atoms must exist.
+	"biographies": {"actors"},
+}
+
+// listLoaded returns true if the list given has been loaded into the
+// database before, which is the case when the first table it fills (other
+// than 'atom' and 'name', which are shared) has any rows.
+func listLoaded(db *imdb.DB, name string) bool {
+	for _, table := range listTables[name] {
+		if table == "atom" || table == "name" {
+			continue
+		}
+		return rowCount(db, table) > 0
+	}
+	return true // nothing to check, so assume it's fine
+}
+
+// orderLists returns the lists given in the order they must be loaded. Lists
+// are only ever loaded after their dependencies, and ties are broken by the
+// order in loadLists, so the order is always the same for the same lists.
+//
+// An error is returned if a list depends on a list that isn't given and
+// hasn't been loaded before, according to the loaded function.
+func orderLists(
+	lists []string,
+	loaded func(name string) bool,
+) ([]string, error) {
+	for _, name := range lists {
+		for _, dep := range listDeps[name] {
+			if fun.In(dep, lists) || loaded(dep) {
+				continue
+			}
+			return nil, ef("The '%s' list requires the '%s' list, which "+
+				"hasn't been loaded. Load them together with "+
+				"'-lists %s,%s'.", name, dep, dep, name)
+		}
+	}
+
+	var ordered []string
+	levels, err := listLevels(lists)
+	if err != nil {
+		return nil, err
+	}
+	for _, level := range levels {
+		ordered = append(ordered, level...)
+	}
+	return ordered, nil
+}
+
+// listLevels groups the lists given into levels, where every list only
+// depends on lists in earlier levels (or lists not given). Lists in the same
+// level may be loaded in parallel. Each level is in the order of loadLists.
+func listLevels(lists []string) ([][]string, error) {
+	var levels [][]string
+	done := make(map[string]bool, len(lists))
+	for len(done) < len(lists) {
+		var level []string
+		for _, name := range lists {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, dep := range listDeps[name] {
+				if fun.In(dep, lists) && !done[dep] {
+					ready = false
+				}
+			}
+			if ready {
+				level = append(level, name)
+			}
+		}
+		if len(level) == 0 {
+			var stuck []string
+			for _, name := range lists {
+				if !done[name] {
+					stuck = append(stuck, name)
+				}
+			}
+			return nil, ef("BUG: The dependencies of lists %s form a cycle.",
+				strings.Join(stuck, ", "))
+		}
+		sort.Sort(loadOrder(level))
+		for _, name := range level {
+			done[name] = true
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// loadOrder sorts list names by their position in loadLists.
+type loadOrder []string
+
+func (lo loadOrder) Len() int      { return len(lo) }
+func (lo loadOrder) Swap(i, j int) { lo[i], lo[j] = lo[j], lo[i] }
+func (lo loadOrder) Less(i, j int) bool {
+	return loaderIndex(lo[i], loadLists) < loaderIndex(lo[j], loadLists)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOrderLists(t *testing.T) {
+	never := func(string) bool { return false }
+	got, err := orderLists([]string{"quotes", "crew", "movies", "genres"},
+		never)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "movies crew genres quotes"; strings.Join(got, " ") != want {
+		t.Fatalf("expected order '%s' but got '%s'", want, got)
+	}
+
+	if _, err := orderLists([]string{"quotes"}, never); err == nil {
+		t.Fatal("expected an error for a missing dependency")
+	}
+	always := func(string) bool { return true }
+	if _, err := orderLists([]string{"quotes"}, always); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListLevels(t *testing.T) {
+	levels, err := listLevels([]string{"genres", "actors", "movies"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(levels) != 2 || strings.Join(levels[0], " ") != "movies" {
+		t.Fatalf("expected 'movies' alone in the first level: %v", levels)
+	}
+
+	listDeps["test-a"] = []string{"test-b"}
+	listDeps["test-b"] = []string{"test-a"}
+	defer delete(listDeps, "test-a")
+	defer delete(listDeps, "test-b")
+	if _, err := listLevels([]string{"test-a", "test-b"}); err == nil {
+		t.Fatal("expected an error for a cycle")
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"io"
 	"strconv"
@@ -18,6 +17,13 @@ var (
 	openHash = []byte{'(', '#'}
 )
 
+// addName adds a name for the atom given to the 'name' table, along with its
+// folded version for matching plain ASCII text. (See imdb.FoldName.) The
+// inserter must have the columns 'atom_id', 'name' and 'name_fold'.
+func addName(ins inserter, id imdb.Atom, name string) error {
+	return ins.Exec(id, name, imdb.FoldName(name))
+}
+
 // listPrefixItems is a convenience function for reading IMDb lists of the
 // format:
 //
@@ -41,7 +47,7 @@ var (
 // any non-empty line.
 func listPrefixItems(
 	list io.ReadCloser,
-	atoms *atomizer,
+	atoms *imdb.Atomizer,
 	entPrefix, itemPrefix []byte,
 	do func(id imdb.Atom, item []byte),
 ) {
@@ -66,7 +72,7 @@ func listPrefixItems(
 		if bytes.HasPrefix(line, entPrefix) {
 			add()
 			entity := bytes.TrimSpace(line[len(entPrefix):])
-			if curAtom, ok = atoms.atomOnlyIfExist(entity); !ok {
+			if curAtom, ok = atoms.AtomOnlyIfExist(entity); !ok {
 				warnf("Could not find id for '%s'. Skipping.", entity)
 				curAtom, curItem = 0, nil
 			}
@@ -116,11 +122,11 @@ func listPrefixItems(
 // 'parseNamedAttr' useful.)
 func listAttrRowIds(
 	list io.ReadCloser,
-	atoms *atomizer,
+	atoms *imdb.Atomizer,
 	do func(id imdb.Atom, line, entity, row []byte),
 ) {
 	listAttrRows(list, atoms, func(line, id, row []byte) {
-		if curAtom, ok := atoms.atomOnlyIfExist(id); !ok {
+		if curAtom, ok := atoms.AtomOnlyIfExist(id); !ok {
 			warnf("Could not find id for '%s'. Skipping.", id)
 		} else {
 			do(curAtom, line, id, row)
@@ -132,7 +138,7 @@ func listAttrRowIds(
 // atomized. Instead, the bytes are passed directly to the 'do' function.
 func listAttrRows(
 	list io.ReadCloser,
-	atoms *atomizer,
+	atoms *imdb.Atomizer,
 	do func(line, id, row []byte),
 ) {
 	curAtom := make([]byte, 0, 20)
@@ -206,6 +212,8 @@ func listLines(list io.ReadCloser, do func([]byte)) {
 // disable filtering lines with '{{SUSPENDED}}' in them. This is useful when
 // it's necessary to record suspended lines as resetting state associated with
 // an existing entity.
+//
+// Lines are read from the list in a separate goroutine. (See readLines.)
 func listLinesSuspended(list io.ReadCloser, suspended bool, do func([]byte)) {
 	seenListName := false
 	nameSuffix := []byte(" LIST")
@@ -213,34 +221,37 @@ func listLinesSuspended(list io.ReadCloser, suspended bool, do func([]byte)) {
 	nameSuffix3 := []byte(" RATINGS REPORT")
 	dataStart, dataEnd := []byte("====="), []byte("----------")
 	dataSection := false
-	scanner := bufio.NewScanner(list)
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if !seenListName {
-			if bytes.HasSuffix(line, nameSuffix) ||
-				bytes.HasSuffix(line, nameSuffix2) {
-				seenListName = true
-			} else if bytes.HasSuffix(line, nameSuffix3) {
-				seenListName = true
-				dataSection = true
+
+	quit := make(chan struct{})
+	defer close(quit)
+	for batch := range readLines(list, quit) {
+		csql.Panic(batch.err)
+		for _, line := range batch.lines {
+			if !seenListName {
+				if bytes.HasSuffix(line, nameSuffix) ||
+					bytes.HasSuffix(line, nameSuffix2) {
+					seenListName = true
+				} else if bytes.HasSuffix(line, nameSuffix3) {
+					seenListName = true
+					dataSection = true
+				}
+				continue
 			}
-			continue
-		}
-		if !dataSection {
-			if bytes.HasPrefix(line, dataStart) {
-				dataSection = true
+			if !dataSection {
+				if bytes.HasPrefix(line, dataStart) {
+					dataSection = true
+				}
+				continue
 			}
-			continue
-		}
-		if dataSection && bytes.HasPrefix(line, dataEnd) {
-			continue
-		}
-		if !suspended && bytes.Contains(line, attrSuspended) {
-			continue
+			if dataSection && bytes.HasPrefix(line, dataEnd) {
+				continue
+			}
+			if !suspended && bytes.Contains(line, attrSuspended) {
+				continue
+			}
+			do(line)
 		}
-		do(line)
 	}
-	csql.Panic(scanner.Err())
 	if err := list.Close(); err != nil {
 		logf("Error closing list: %s", err)
 	}
@@ -335,8 +346,8 @@ func parseNamedAttr(namedAttr []byte) ([]byte, []byte, bool) {
 //
 // If there was an error, it is returned and the atom is considered to not
 // have existed.
-func parseId(az *atomizer, idStr []byte, id *imdb.Atom) (bool, error) {
-	atom, existed, err := az.atom(idStr)
+func parseId(az *imdb.Atomizer, idStr []byte, id *imdb.Atom) (bool, error) {
+	atom, existed, err := az.Atom(idStr)
 	if err != nil {
 		return false, ef("Could not atomize '%s': %s", idStr, err)
 	}
@@ -8,7 +8,35 @@ import (
 	"github.com/BurntSushi/goim/imdb"
 )
 
-func listActors(db *imdb.DB, ractor, ractress io.ReadCloser) (err error) {
+// crewLists maps the names of IMDb lists of people who aren't cast members
+// to the role they have in their credits. These lists are loaded by the
+// 'crew' list, and have the same format as the actors list.
+var crewLists = []struct {
+	role, list string
+}{
+	{"director", "directors"},
+	{"writer", "writers"},
+	{"producer", "producers"},
+	{"composer", "composers"},
+	{"cinematographer", "cinematographers"},
+	{"editor", "editors"},
+}
+
+// crewList is an open crew list along with its name and the role of its
+// credits.
+type crewList struct {
+	role, name string
+	list       io.ReadCloser
+}
+
+// listActors loads the actors and actresses lists, along with any crew lists
+// given. Since all of them store people in the actor table, and the actor and
+// credit tables are rebuilt from scratch, they must be loaded together.
+func listActors(
+	db *imdb.DB,
+	ractor, ractress io.ReadCloser,
+	crew []crewList,
+) (err error) {
 	defer csql.Safe(&err)
 
 	logf("Reading actors list...")
@@ -24,44 +52,65 @@ func listActors(db *imdb.DB, ractor, ractress io.ReadCloser) (err error) {
 	txname := txactor.another()
 	txatom := txactor.another()
 
-	// Drop data from the actor and credit tables. They will be rebuilt below.
+	// Drop data from the actor and credit tables. They will be rebuilt below
+	// (in shadow tables on PostgreSQL, which replace them once everything is
+	// committed).
 	// The key here is to leave the atom and name tables alone. Invariably,
 	// they will contain stale data. But the only side effect, I think, is
 	// taking up space.
 	// (Stale data can be removed with 'goim clean'.)
-	csql.Truncate(txactor, db.Driver, "actor")
-	csql.Truncate(txcredit.Tx, db.Driver, "credit")
+	actor, err := db.ShadowTable(txactor.Tx, "actor", false)
+	csql.Panic(err)
+	credit, err := db.ShadowTable(txcredit.Tx, "credit", false)
+	csql.Panic(err)
 
-	actIns, err := csql.NewInserter(txactor.Tx, db.Driver, "actor",
+	stage := newInsertStage()
+	defer stage.Close() // in case of a panic
+	actIns, err := stage.newInserter(txactor.Tx, db.Driver, actor,
 		"atom_id", "sequence")
 	csql.Panic(err)
-	credIns, err := csql.NewInserter(txcredit.Tx, db.Driver, "credit",
-		"actor_atom_id", "media_atom_id", "character", "position", "attrs")
+	credIns, err := stage.newInserter(txcredit.Tx, db.Driver, credit,
+		"actor_atom_id", "media_atom_id", "character", "position", "attrs",
+		"role", "source")
 	csql.Panic(err)
-	nameIns, err := csql.NewInserter(txname.Tx, db.Driver, "name",
-		"atom_id", "name")
+	nameIns, err := stage.newInserter(txname.Tx, db.Driver, "name",
+		"atom_id", "name", "name_fold")
 	csql.Panic(err)
-	atoms, err := newAtomizer(db, txatom.Tx)
+	atoms, err := stage.newAtomizer(db, txatom.Tx)
 	csql.Panic(err)
 
 	// Unfortunately, it looks like credits for an actor can appear in
 	// multiple locations. (Or there are different actors that erroneously
 	// have the same name.)
 	added := make(map[imdb.Atom]struct{}, 3000000)
-	n1, nc1 := listActs(db, ractress, atoms, added, actIns, credIns, nameIns)
-	n2, nc2 := listActs(db, ractor, atoms, added, actIns, credIns, nameIns)
+	n1, nc1 := listActs(db, ractress, "actor", "actresses", atoms, added,
+		actIns, credIns, nameIns)
+	n2, nc2 := listActs(db, ractor, "actor", "actors", atoms, added,
+		actIns, credIns, nameIns)
+	n3, nc3 := 0, 0
+	for _, c := range crew {
+		logf("Reading %ss list...", c.role)
+		n, nc := listActs(db, c.list, c.role, c.name, atoms, added,
+			actIns, credIns, nameIns)
+		n3, nc3 = n3+n, nc3+nc
+	}
 
 	csql.Panic(actIns.Exec())
 	csql.Panic(credIns.Exec())
 	csql.Panic(nameIns.Exec())
 	csql.Panic(atoms.Close())
+	csql.Panic(stage.Close())
 
 	csql.Panic(txactor.Commit())
 	csql.Panic(txcredit.Commit())
 	csql.Panic(txname.Commit())
 	csql.Panic(txatom.Commit())
+	csql.Panic(db.SwapShadows("actor", "credit"))
 
 	logf("Done. Added %d actors/actresses and %d credits.", n1+n2, nc1+nc2)
+	if len(crew) > 0 {
+		logf("Added %d other people and %d crew credits.", n3, nc3)
+	}
 	return
 }
 
@@ -71,14 +120,19 @@ type credit struct {
 	Character string
 	Position  int
 	Attrs     string
+	Role      string
+	Source    string
 }
 
+// listActs loads the people and credits of one list, whose credits all have
+// the role given. The name of the list is stored with each credit.
 func listActs(
 	db *imdb.DB,
 	r io.ReadCloser,
-	atoms *atomizer,
+	role, source string,
+	atoms *imdb.Atomizer,
 	added map[imdb.Atom]struct{},
-	actIns, credIns, nameIns *csql.Inserter,
+	actIns, credIns, nameIns inserter,
 ) (addedActors, addedCredits int) {
 	bunkName, bunkTitles := []byte("Name"), []byte("Titles")
 	bunkLines1, bunkLines2 := []byte("----"), []byte("------")
@@ -103,7 +157,7 @@ func listActs(
 			}
 
 			// We only add a name when we've added an atom.
-			if err := nameIns.Exec(a.Id, a.FullName); err != nil {
+			if err := addName(nameIns, a.Id, a.FullName); err != nil {
 				csql.Panic(ef("Could not add actor name '%s' from '%s': %s",
 					idstr, line, err))
 			}
@@ -128,13 +182,15 @@ func listActs(
 		// Reading this list always refreshes the credits.
 		var c credit
 		c.ActorId = a.Id
+		c.Role = role
+		c.Source = source
 		if !parseCredit(atoms, row, &c) {
 			// messages are emitted in parseCredit if something is worth
 			// reporting
 			return
 		}
 		err = credIns.Exec(c.ActorId, c.MediaId,
-			c.Character, c.Position, c.Attrs)
+			c.Character, c.Position, c.Attrs, c.Role, c.Source)
 		if err != nil {
 			csql.Panic(ef("Could not add credit '%s' for '%s': %s",
 				row, idstr, err))
@@ -173,10 +229,10 @@ func parseActorName(idstr []byte, a *imdb.Actor) bool {
 	return true
 }
 
-func parseCredit(atoms *atomizer, row []byte, c *credit) bool {
+func parseCredit(atoms *imdb.Atomizer, row []byte, c *credit) bool {
 	pieces := bytes.Split(row, []byte{' ', ' '})
 	ent := bytes.TrimSpace(pieces[0])
-	if id, ok := atoms.atomOnlyIfExist(ent); !ok {
+	if id, ok := atoms.AtomOnlyIfExist(ent); !ok {
 		warnf("Could not find media id for '%s'. Skipping.", ent)
 		return false
 	} else {
@@ -189,7 +245,13 @@ func parseCredit(atoms *atomizer, row []byte, c *credit) bool {
 		}
 		switch {
 		case f[0] == '<' && f[len(f)-1] == '>':
-			if err := parseInt(f[1:len(f)-1], &c.Position); err != nil {
+			// The writers list has positions like '<1,2,1>'. Only the
+			// first number is the billing position.
+			pos := f[1 : len(f)-1]
+			if i := bytes.IndexByte(pos, ','); i > -1 {
+				pos = pos[0:i]
+			}
+			if err := parseInt(pos, &c.Position); err != nil {
 				pef("Could not parse '%s' as integer in '%s': %s", f, row, err)
 				return false
 			}
@@ -15,29 +15,83 @@ import (
 	"github.com/BurntSushi/goim/imdb"
 )
 
+// simpleLoad loads the rows parsed from a list into a single table. Rows are
+// committed every flagLoadCheckpoint rows along with a checkpoint, so that
+// a load that fails part way through can be resumed with '-resume'.
+//
+// On PostgreSQL, rows are inserted into a shadow of the table (see
+// imdb.ShadowTable), which replaces the table once the list is done.
 type simpleLoad struct {
-	db    *imdb.DB
-	tx    *sql.Tx
-	table string
-	count int
-	ins   *csql.Inserter
-	atoms *atomizer
+	db      *imdb.DB
+	tx      *sql.Tx
+	table   string
+	into    string
+	columns []string
+	version listVersion
+	count   int
+	skip    int
+	bad     int
+	ins     inserter
+	stage   *insertStage
+	atoms   *imdb.Atomizer
 }
 
-func startSimpleLoad(db *imdb.DB, table string, columns ...string) *simpleLoad {
+func startSimpleLoad(
+	db *imdb.DB,
+	atoms *imdb.Atomizer,
+	table string,
+	columns ...string,
+) *simpleLoad {
 	logf("Reading list to populate table %s...", table)
 
+	sl := &simpleLoad{db: db, table: table, columns: columns, atoms: atoms,
+		version: tableVersion(table)}
+	if flagLoadResume {
+		sl.skip = checkpointRows(db, table, sl.version)
+	}
 	tx, err := db.Begin()
 	csql.Panic(err)
-	csql.Truncate(tx, db.Driver, table)
-	ins, err := csql.NewInserter(tx, db.Driver, table, columns...)
+	sl.into, err = db.ShadowTable(tx, table, sl.skip > 0)
 	csql.Panic(err)
-	atoms, err := newAtomizer(db, nil) // read only
+	sl.begin(tx)
+	if sl.skip > 0 {
+		logf("Resuming table %s after %d rows.", table, sl.skip)
+	} else {
+		clearCheckpoint(sl.tx, table)
+	}
+	return sl
+}
+
+// begin starts an inserter that uses the transaction given.
+func (sl *simpleLoad) begin(tx *sql.Tx) {
+	var err error
+	sl.tx = tx
+	sl.stage = newInsertStage()
+	sl.stage.bad = sl.bad
+	sl.ins, err = sl.stage.newInserter(tx, sl.db.Driver, sl.into,
+		sl.columns...)
 	csql.Panic(err)
-	return &simpleLoad{db, tx, table, 0, ins, atoms}
+}
+
+// commit inserts anything left in the buffer and commits the transaction.
+// Unless the list is done, a checkpoint is committed with it.
+func (sl *simpleLoad) commit(done bool) {
+	csql.Panic(sl.ins.Exec())
+	csql.Panic(sl.stage.Close())
+	sl.bad = sl.stage.bad
+	if done {
+		clearCheckpoint(sl.tx, sl.table)
+	} else {
+		setCheckpoint(sl.tx, sl.table, sl.count, sl.version)
+	}
+	csql.Panic(sl.tx.Commit())
 }
 
 func (sl *simpleLoad) add(line []byte, args ...interface{}) {
+	if sl.count < sl.skip {
+		sl.count++ // committed before the last load stopped
+		return
+	}
 	if err := sl.ins.Exec(args...); err != nil {
 		toStr := func(v interface{}) string { return sf("%#v", v) }
 		logf("Full %s info (that failed to add): %s",
@@ -46,17 +100,35 @@ func (sl *simpleLoad) add(line []byte, args ...interface{}) {
 		csql.Panic(ef("Error adding to %s table: %s", sl.table, err))
 	}
 	sl.count++
+	if flagLoadCheckpoint > 0 && sl.count%flagLoadCheckpoint == 0 {
+		sl.commit(false)
+		tx, err := sl.db.Begin()
+		csql.Panic(err)
+		sl.begin(tx)
+	}
 }
 
+// done commits the rest of the rows. It must be deferred, since when loading
+// fails, everything since the last checkpoint is rolled back instead.
 func (sl *simpleLoad) done() {
-	csql.Panic(sl.ins.Exec()) // inserts anything left in the buffer
-	csql.Panic(sl.tx.Commit())
-	logf("Done with table %s. Inserted %d rows.", sl.table, sl.count)
+	if r := recover(); r != nil {
+		sl.stage.Close()
+		sl.tx.Rollback()
+		panic(r)
+	}
+	sl.commit(true)
+	csql.Panic(sl.db.SwapShadows(sl.table))
+	if sl.bad > 0 {
+		logf("Done with table %s. Inserted %d rows and skipped %d bad rows.",
+			sl.table, sl.count-sl.bad, sl.bad)
+	} else {
+		logf("Done with table %s. Inserted %d rows.", sl.table, sl.count)
+	}
 }
 
-func listSoundMixes(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listSoundMixes(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "sound_mix", "atom_id", "mix", "attrs")
+	table := startSimpleLoad(db, atoms, "sound_mix", "atom_id", "mix", "attrs")
 	defer table.done()
 
 	listAttrRowIds(r, table.atoms, func(id imdb.Atom, line, ent, row []byte) {
@@ -74,9 +146,9 @@ func listSoundMixes(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 	return
 }
 
-func listGenres(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listGenres(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "genre", "atom_id", "name")
+	table := startSimpleLoad(db, atoms, "genre", "atom_id", "name")
 	defer table.done()
 
 	listAttrRowIds(r, table.atoms, func(id imdb.Atom, line, ent, row []byte) {
@@ -89,9 +161,9 @@ func listGenres(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 	return
 }
 
-func listLanguages(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listLanguages(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "language", "atom_id", "name", "attrs")
+	table := startSimpleLoad(db, atoms, "language", "atom_id", "name", "attrs")
 	defer table.done()
 
 	listAttrRowIds(r, table.atoms, func(id imdb.Atom, line, ent, row []byte) {
@@ -108,9 +180,9 @@ func listLanguages(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 	return
 }
 
-func listLocations(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listLocations(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "location", "atom_id", "place", "attrs")
+	table := startSimpleLoad(db, atoms, "location", "atom_id", "place", "attrs")
 	defer table.done()
 
 	listAttrRowIds(r, table.atoms, func(id imdb.Atom, line, ent, row []byte) {
@@ -127,9 +199,9 @@ func listLocations(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 	return
 }
 
-func listTrivia(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listTrivia(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "trivia", "atom_id", "entry")
+	table := startSimpleLoad(db, atoms, "trivia", "atom_id", "entry")
 	defer table.done()
 
 	do := func(id imdb.Atom, item []byte) {
@@ -141,11 +213,11 @@ func listTrivia(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 
 func listAlternateVersions(
 	db *imdb.DB,
-	atoms *atomizer,
+	atoms *imdb.Atomizer,
 	r io.ReadCloser,
 ) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "alternate_version", "atom_id", "about")
+	table := startSimpleLoad(db, atoms, "alternate_version", "atom_id", "about")
 	defer table.done()
 
 	do := func(id imdb.Atom, item []byte) {
@@ -155,9 +227,9 @@ func listAlternateVersions(
 	return
 }
 
-func listTaglines(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listTaglines(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "tagline", "atom_id", "tag")
+	table := startSimpleLoad(db, atoms, "tagline", "atom_id", "tag")
 	defer table.done()
 
 	do := func(id imdb.Atom, item []byte) {
@@ -167,9 +239,9 @@ func listTaglines(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 	return
 }
 
-func listGoofs(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listGoofs(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "goof", "atom_id", "goof_type", "entry")
+	table := startSimpleLoad(db, atoms, "goof", "atom_id", "goof_type", "entry")
 	defer table.done()
 
 	do := func(id imdb.Atom, item []byte) {
@@ -186,9 +258,10 @@ func listGoofs(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 	return
 }
 
-func listLiterature(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listLiterature(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "literature", "atom_id", "lit_type", "ref")
+	table := startSimpleLoad(db, atoms, "literature",
+		"atom_id", "lit_type", "ref")
 	defer table.done()
 
 	do := func(id imdb.Atom, item []byte) {
@@ -207,11 +280,11 @@ func listLiterature(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 
 func listRunningTimes(
 	db *imdb.DB,
-	atoms *atomizer,
+	atoms *imdb.Atomizer,
 	r io.ReadCloser,
 ) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "running_time",
+	table := startSimpleLoad(db, atoms, "running_time",
 		"atom_id", "country", "minutes", "attrs")
 	defer table.done()
 
@@ -259,9 +332,9 @@ func listRunningTimes(
 	return
 }
 
-func listRatings(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listRatings(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "rating", "atom_id", "votes", "rank")
+	table := startSimpleLoad(db, atoms, "rating", "atom_id", "votes", "rank")
 	defer table.done()
 
 	done := false
@@ -289,7 +362,7 @@ func listRatings(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 		}
 
 		entity := bytes.Join(fields[3:], []byte{' '})
-		if id, ok = table.atoms.atomOnlyIfExist(entity); !ok {
+		if id, ok = table.atoms.AtomOnlyIfExist(entity); !ok {
 			warnf("Could not find id for '%s'. Skipping.", entity)
 			return
 		}
@@ -306,9 +379,10 @@ func listRatings(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 	return
 }
 
-func listAkaTitles(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listAkaTitles(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "aka_title", "atom_id", "title", "attrs")
+	table := startSimpleLoad(db, atoms, "aka_title",
+		"atom_id", "title", "attrs")
 	defer table.done()
 
 	parseAkaTitle := func(text []byte, title *string) bool {
@@ -351,14 +425,14 @@ func listAkaTitles(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 	return
 }
 
-func listMovieLinks(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listMovieLinks(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "link", "atom_id",
+	table := startSimpleLoad(db, atoms, "link", "atom_id",
 		"link_type", "link_atom_id", "entity")
 	defer table.done()
 
 	parseMovieLink := func(
-		atoms *atomizer,
+		atoms *imdb.Atomizer,
 		text []byte,
 		linkType *string,
 		linkAtom *imdb.Atom,
@@ -369,7 +443,7 @@ func listMovieLinks(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 			logf("Could not parse named attribute '%s'. Skipping.", text)
 			return false
 		}
-		id, ok := atoms.atomOnlyIfExist(data)
+		id, ok := atoms.AtomOnlyIfExist(data)
 		if !ok {
 			warnf("Could not find id for '%s'. Skipping.", data)
 			return false
@@ -409,9 +483,9 @@ func listMovieLinks(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 	return
 }
 
-func listColorInfo(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listColorInfo(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "color_info",
+	table := startSimpleLoad(db, atoms, "color_info",
 		"atom_id", "color", "attrs")
 	defer table.done()
 
@@ -456,11 +530,12 @@ func listColorInfo(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 
 func listMPAARatings(
 	db *imdb.DB,
-	atoms *atomizer,
+	atoms *imdb.Atomizer,
 	r io.ReadCloser,
 ) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "mpaa_rating", "atom_id", "rating", "reason")
+	table := startSimpleLoad(db, atoms, "mpaa_rating",
+		"atom_id", "rating", "reason")
 	defer table.done()
 
 	var curAtom imdb.Atom
@@ -484,7 +559,7 @@ func listMPAARatings(
 		if bytes.HasPrefix(line, []byte("MV: ")) {
 			add(line)
 			entity := bytes.TrimSpace(line[3:])
-			if curAtom, ok = table.atoms.atomOnlyIfExist(entity); !ok {
+			if curAtom, ok = table.atoms.AtomOnlyIfExist(entity); !ok {
 				warnf("Could not find id for '%s'. Skipping.", entity)
 				reset()
 			}
@@ -538,11 +613,11 @@ func listMPAARatings(
 
 func listReleaseDates(
 	db *imdb.DB,
-	atoms *atomizer,
+	atoms *imdb.Atomizer,
 	r io.ReadCloser,
 ) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "release_date",
+	table := startSimpleLoad(db, atoms, "release_date",
 		"atom_id", "country", "released", "attrs")
 	defer table.done()
 
@@ -599,9 +674,9 @@ func listReleaseDates(
 	return
 }
 
-func listQuotes(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listQuotes(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "quote", "atom_id", "entry")
+	table := startSimpleLoad(db, atoms, "quote", "atom_id", "entry")
 	defer table.done()
 
 	var curAtom imdb.Atom
@@ -617,7 +692,7 @@ func listQuotes(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 		if bytes.HasPrefix(line, []byte{'#'}) {
 			add(line)
 			entity := bytes.TrimSpace(line[1:])
-			if curAtom, ok = table.atoms.atomOnlyIfExist(entity); !ok {
+			if curAtom, ok = table.atoms.AtomOnlyIfExist(entity); !ok {
 				warnf("Could not find id for '%s'. Skipping.", entity)
 				curAtom, curQuote = 0, nil
 			}
@@ -640,9 +715,9 @@ func listQuotes(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 	return
 }
 
-func listPlots(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
+func listPlots(db *imdb.DB, atoms *imdb.Atomizer, r io.ReadCloser) (err error) {
 	defer csql.Safe(&err)
-	table := startSimpleLoad(db, "plot", "atom_id", "entry", "by")
+	table := startSimpleLoad(db, atoms, "plot", "atom_id", "entry", "by")
 	defer table.done()
 
 	var curAtom imdb.Atom
@@ -663,7 +738,7 @@ func listPlots(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 				add(line)
 			}
 			entity := bytes.TrimSpace(line[3:])
-			if curAtom, ok = table.atoms.atomOnlyIfExist(entity); !ok {
+			if curAtom, ok = table.atoms.AtomOnlyIfExist(entity); !ok {
 				warnf("Could not find id for '%s'. Skipping.", entity)
 				curAtom, curPlot, curBy = 0, nil, nil
 			}
@@ -686,3 +761,63 @@ func listPlots(db *imdb.DB, atoms *atomizer, r io.ReadCloser) (err error) {
 	add([]byte("UNKNOWN (last line?)"))
 	return
 }
+
+func listBiographies(
+	db *imdb.DB,
+	atoms *imdb.Atomizer,
+	r io.ReadCloser,
+) (err error) {
+	defer csql.Safe(&err)
+	table := startSimpleLoad(db, atoms, "biography",
+		"atom_id", "birth_year", "born", "death_year", "died")
+	defer table.done()
+
+	var curAtom imdb.Atom
+	var born, died string
+	var ok bool
+	add := func(line []byte) {
+		if curAtom > 0 && (len(born) > 0 || len(died) > 0) {
+			table.add(line, curAtom, bioYear(born), born, bioYear(died), died)
+		}
+		curAtom, born, died = 0, "", ""
+	}
+	listLines(r, func(line []byte) {
+		if bytes.HasPrefix(line, []byte("NM:")) {
+			add(line)
+			actor := bytes.TrimSpace(line[3:])
+			if curAtom, ok = table.atoms.AtomOnlyIfExist(actor); !ok {
+				warnf("Could not find id for '%s'. Skipping.", actor)
+				curAtom = 0
+			}
+			return
+		}
+		if bytes.HasPrefix(line, []byte("DB:")) {
+			born = unicode(bytes.TrimSpace(line[3:]))
+			return
+		}
+		if bytes.HasPrefix(line, []byte("DD:")) {
+			died = unicode(bytes.TrimSpace(line[3:]))
+			return
+		}
+	})
+	add([]byte("UNKNOWN (last line?)"))
+	return
+}
+
+// bioYear returns the year of a birth or death in the biographies list, which
+// looks like '10 May 1899, Omaha, Nebraska, USA' (the day, month and place are
+// optional). It returns 0 if there is no year.
+func bioYear(text string) int {
+	if comma := strings.IndexByte(text, ','); comma > -1 {
+		text = text[:comma]
+	}
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return 0
+	}
+	year, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || year < 1000 || year > 9999 {
+		return 0
+	}
+	return year
+}
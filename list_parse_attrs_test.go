@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestBioYear(t *testing.T) {
+	tests := []struct {
+		text string
+		year int
+	}{
+		{"10 May 1899, Omaha, Nebraska, USA", 1899},
+		{"May 1899", 1899},
+		{"1899", 1899},
+		{"c. 1899, Omaha, Nebraska, USA", 1899},
+		{"22 June 1987, Los Angeles, California, USA (pneumonia)", 1987},
+		{"Omaha, Nebraska, USA", 0},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if got := bioYear(test.text); got != test.year {
+			t.Errorf("bioYear(%q): expected %d but got %d",
+				test.text, test.year, got)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"io"
+	"sort"
 	"strconv"
 
 	"github.com/BurntSushi/csql"
@@ -33,28 +34,34 @@ func listMovies(db *imdb.DB, movies io.ReadCloser) (err error) {
 	txatom := txmovie.another()
 
 	// Drop data from the movie, tvshow and episode tables. They will be
-	// rebuilt below.
+	// rebuilt below (in shadow tables on PostgreSQL, which replace them
+	// once everything is committed).
 	// The key here is to leave the atom and name tables alone. Invariably,
 	// they will contain stale data. But the only side effect, I think, is
 	// taking up space.
 	// (Stale data can be removed with 'goim clean'.)
-	csql.Truncate(txmovie, db.Driver, "movie")
-	csql.Truncate(txtv, db.Driver, "tvshow")
-	csql.Truncate(txepisode, db.Driver, "episode")
+	movie, err := db.ShadowTable(txmovie.Tx, "movie", false)
+	csql.Panic(err)
+	tvshow, err := db.ShadowTable(txtv.Tx, "tvshow", false)
+	csql.Panic(err)
+	episode, err := db.ShadowTable(txepisode.Tx, "episode", false)
+	csql.Panic(err)
 
-	mvIns, err := csql.NewInserter(txmovie.Tx, db.Driver, "movie",
+	stage := newInsertStage()
+	mvIns, err := stage.newInserter(txmovie.Tx, db.Driver, movie,
 		"atom_id", "year", "sequence", "tv", "video")
 	csql.Panic(err)
-	tvIns, err := csql.NewInserter(txtv.Tx, db.Driver, "tvshow",
+	tvIns, err := stage.newInserter(txtv.Tx, db.Driver, tvshow,
 		"atom_id", "year", "sequence", "year_start", "year_end")
 	csql.Panic(err)
-	epIns, err := csql.NewInserter(txepisode.Tx, db.Driver, "episode",
-		"atom_id", "tvshow_atom_id", "year", "season", "episode_num")
+	epIns, err := stage.newInserter(txepisode.Tx, db.Driver, episode,
+		"atom_id", "tvshow_atom_id", "year", "season", "episode_num",
+		"abs_num")
 	csql.Panic(err)
-	nameIns, err := csql.NewInserter(txname.Tx, db.Driver, "name",
-		"atom_id", "name")
+	nameIns, err := stage.newInserter(txname.Tx, db.Driver, "name",
+		"atom_id", "name", "name_fold")
 	csql.Panic(err)
-	atoms, err := newAtomizer(db, txatom.Tx)
+	atoms, err := stage.newAtomizer(db, txatom.Tx)
 	csql.Panic(err)
 
 	defer func() {
@@ -63,17 +70,22 @@ func listMovies(db *imdb.DB, movies io.ReadCloser) (err error) {
 		csql.Panic(epIns.Exec())
 		csql.Panic(nameIns.Exec())
 		csql.Panic(atoms.Close())
+		csql.Panic(stage.Close())
 
 		csql.Panic(txmovie.Commit())
 		csql.Panic(txtv.Commit())
 		csql.Panic(txepisode.Commit())
 		csql.Panic(txname.Commit())
 		csql.Panic(txatom.Commit())
+		csql.Panic(db.SwapShadows("movie", "tvshow", "episode"))
 
 		logf("Done. Added %d movies, %d tv shows and %d episodes.",
 			addedMovies, addedTvshows, addedEpisodes)
 	}()
 
+	// Episodes are inserted after the whole list has been read, since their
+	// absolute numbers depend on every other episode in the same TV show.
+	var episodes []episodeRow
 	listLines(movies, func(line []byte) {
 		line = bytes.TrimSpace(line)
 		fields := splitListLine(line)
@@ -91,7 +103,7 @@ func listMovies(db *imdb.DB, movies io.ReadCloser) (err error) {
 				csql.Panic(err)
 			} else if !existed {
 				// We only add a name when we add an atom.
-				if err = nameIns.Exec(m.Id, m.Title); err != nil {
+				if err = addName(nameIns, m.Id, m.Title); err != nil {
 					logf("Full movie info (that failed to add): %#v", m)
 					csql.Panic(ef("Could not add name '%s': %s", m, err))
 				}
@@ -114,7 +126,7 @@ func listMovies(db *imdb.DB, movies io.ReadCloser) (err error) {
 				csql.Panic(err)
 			} else if !existed {
 				// We only add a name when we add an atom.
-				if err = nameIns.Exec(tv.Id, tv.Title); err != nil {
+				if err = addName(nameIns, tv.Id, tv.Title); err != nil {
 					logf("Full tvshow info (that failed to add): %#v", tv)
 					csql.Panic(ef("Could not add name '%s': %s", tv, err))
 				}
@@ -138,25 +150,89 @@ func listMovies(db *imdb.DB, movies io.ReadCloser) (err error) {
 				csql.Panic(err)
 			} else if !existed {
 				// We only add a name when we add an atom.
-				if err = nameIns.Exec(ep.Id, ep.Title); err != nil {
+				if err = addName(nameIns, ep.Id, ep.Title); err != nil {
 					logf("Full episode info (that failed to add): %#v", ep)
 					csql.Panic(ef("Could not add name '%s': %s", ep, err))
 				}
 			}
-			err := epIns.Exec(ep.Id, ep.TvshowId, ep.Year,
-				ep.Season, ep.EpisodeNum)
-			if err != nil {
-				logf("Full episode info (that failed to add): %#v", ep)
-				csql.Panic(ef("Could not add episode '%s': %s", ep, err))
-			}
-			addedEpisodes++
+			episodes = append(episodes, episodeRow{
+				Id:         ep.Id,
+				TvshowId:   ep.TvshowId,
+				Year:       ep.Year,
+				Season:     ep.Season,
+				EpisodeNum: ep.EpisodeNum,
+			})
 		default:
 			csql.Panic(ef("Unrecognized entity %s", ent))
 		}
 	})
+
+	absoluteNumbers(episodes)
+	for _, ep := range episodes {
+		err := epIns.Exec(ep.Id, ep.TvshowId, ep.Year,
+			ep.Season, ep.EpisodeNum, ep.AbsNum)
+		if err != nil {
+			logf("Full episode info (that failed to add): %#v", ep)
+			csql.Panic(ef("Could not add episode with atom %d: %s", ep.Id, err))
+		}
+		addedEpisodes++
+	}
 	return
 }
 
+// episodeRow is the subset of an episode that is stored in the episode table.
+// (It omits the title to keep memory usage down, since every episode is kept
+// in memory while the movies list is read.)
+type episodeRow struct {
+	Id, TvshowId       imdb.Atom
+	Year               int
+	Season, EpisodeNum int
+	AbsNum             int
+}
+
+// absoluteNumbers sets the absolute number of each episode given. Episodes
+// in each TV show are numbered from 1 in order of season and then episode
+// number. Episodes without a season or episode number (like specials) are
+// skipped and have an absolute number of 0. Episodes with the same season and
+// episode number share the same absolute number.
+//
+// The order of the episodes given is changed.
+func absoluteNumbers(eps []episodeRow) {
+	sort.Sort(episodeOrder(eps))
+	var tv imdb.Atom
+	abs, prevSeason, prevEpisode := 0, 0, 0
+	for i := range eps {
+		ep := &eps[i]
+		if ep.TvshowId != tv {
+			tv = ep.TvshowId
+			abs, prevSeason, prevEpisode = 0, 0, 0
+		}
+		if ep.Season <= 0 || ep.EpisodeNum <= 0 {
+			continue
+		}
+		if ep.Season != prevSeason || ep.EpisodeNum != prevEpisode {
+			abs++
+			prevSeason, prevEpisode = ep.Season, ep.EpisodeNum
+		}
+		ep.AbsNum = abs
+	}
+}
+
+type episodeOrder []episodeRow
+
+func (eps episodeOrder) Len() int      { return len(eps) }
+func (eps episodeOrder) Swap(i, j int) { eps[i], eps[j] = eps[j], eps[i] }
+func (eps episodeOrder) Less(i, j int) bool {
+	e1, e2 := eps[i], eps[j]
+	if e1.TvshowId != e2.TvshowId {
+		return e1.TvshowId < e2.TvshowId
+	}
+	if e1.Season != e2.Season {
+		return e1.Season < e2.Season
+	}
+	return e1.EpisodeNum < e2.EpisodeNum
+}
+
 func parseTvshow(tvshow []byte, tv *imdb.Tvshow) bool {
 	var field []byte
 	fields := bytes.Fields(tvshow)
@@ -191,7 +267,7 @@ func parseTvshowRange(years []byte, tv *imdb.Tvshow) bool {
 	return true
 }
 
-func parseEpisode(az *atomizer, episode []byte, ep *imdb.Episode) bool {
+func parseEpisode(az *imdb.Atomizer, episode []byte, ep *imdb.Episode) bool {
 	if episode[len(episode)-1] != '}' {
 		pef("Episodes must end with '}' but '%s' does not.", episode)
 		return false
@@ -204,7 +280,7 @@ func parseEpisode(az *atomizer, episode []byte, ep *imdb.Episode) bool {
 
 	if az != nil {
 		var err error
-		ep.TvshowId, _, err = az.atom(episode[0:openBrace])
+		ep.TvshowId, _, err = az.Atom(episode[0:openBrace])
 		if err != nil {
 			pef("Could not atomize TV show '%s' from episode '%s': %s",
 				episode[0:openBrace], episode, err)
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"io"
+	"sync"
+
+	"github.com/BurntSushi/ty/fun"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// Loading a list happens in three stages, each running in goroutines of its
+// own and connected by channels with bounded buffers:
+//
+//	1) Decompression. (See gzipFetcher.)
+//	2) Parsing, which splits a list into lines (see readLines) that are
+//	   parsed by the caller of listLines.
+//	3) Insertion, which sends the rows produced by parsing to the database.
+//	   (See insertStage.)
+//
+// This way, loading a list keeps more than one CPU busy, which matters when
+// the disk or network is fast enough that parsing a list would otherwise be
+// the bottleneck.
+
+var (
+	// pipelineDepth is the number of batches buffered between two stages.
+	pipelineDepth = 16
+
+	// pipelineBatch is the number of lines or rows sent from one stage to
+	// the next at once. Sending values individually would spend more time
+	// synchronizing than working.
+	pipelineBatch = 1024
+
+	// gzipBlockSize is the number of decompressed bytes in each block that
+	// is decompressed ahead of the parsing stage.
+	gzipBlockSize = 1 << 20
+)
+
+// lineBatch is a batch of lines read from a list. The last batch sent
+// carries the error from reading the list, if there was one.
+type lineBatch struct {
+	lines [][]byte
+	err   error
+}
+
+// readLines reads lines from the list given in a separate goroutine, and
+// sends them in batches on the channel returned. The channel is closed once
+// every line has been read. The lines are copies, so they may be retained
+// by the caller.
+//
+// Reading stops early when quit is closed.
+func readLines(list io.Reader, quit <-chan struct{}) <-chan lineBatch {
+	batches := make(chan lineBatch, pipelineDepth)
+	go func() {
+		defer close(batches)
+
+		send := func(b lineBatch) bool {
+			select {
+			case batches <- b:
+				return true
+			case <-quit:
+				return false
+			}
+		}
+		var buf []byte
+		lines := make([][]byte, 0, pipelineBatch)
+		scanner := bufio.NewScanner(list)
+		for scanner.Scan() {
+			// Lines share one buffer until it's full, which saves an
+			// allocation per line.
+			line := scanner.Bytes()
+			if len(buf)+len(line) > cap(buf) {
+				buf = make([]byte, 0, 64*1024+len(line))
+			}
+			start := len(buf)
+			buf = append(buf, line...)
+			lines = append(lines, buf[start:len(buf):len(buf)])
+			if len(lines) == pipelineBatch {
+				if !send(lineBatch{lines: lines}) {
+					return
+				}
+				lines = make([][]byte, 0, pipelineBatch)
+			}
+		}
+		send(lineBatch{lines: lines, err: scanner.Err()})
+	}()
+	return batches
+}
+
+// inserter is satisfied by *imdb.Inserter and by the inserters of an
+// insertStage. As with imdb.Inserter, calling Exec with no arguments inserts
+// any rows left in the buffer.
+type inserter interface {
+	Exec(args ...interface{}) error
+}
+
+// newInserter returns an imdb.Inserter that stops once the process has been
+// asked to stop. The number of values in each INSERT statement is
+// insertBatchParams when it's set.
+func newInserter(
+	tx *sql.Tx,
+	driver, table string,
+	columns ...string,
+) (*imdb.Inserter, error) {
+	var opts imdb.InsertOptions
+	if insertBatchParams > 0 && len(columns) > 0 {
+		opts.BatchSize = insertBatchParams / len(columns)
+		if opts.BatchSize == 0 {
+			opts.BatchSize = 1
+		}
+	}
+	return imdb.NewInserter(interruptedCtx, tx, driver, table, opts,
+		columns...)
+}
+
+// insertStage runs the inserts for a list in a goroutine of its own, so that
+// parsing a list overlaps with sending its rows to the database. Rows are
+// inserted in the order they're given, regardless of which inserter they're
+// for. (So that atoms are still inserted before the rows that use them.)
+//
+// Errors are returned by the first call to Exec after the failed insert, or
+// by Close. Rows that the database rejects are logged and skipped instead,
+// until more than flagLoadMaxBad of them have been skipped.
+type insertStage struct {
+	rows    chan []stagedRow
+	batch   []stagedRow
+	stopped chan struct{}
+	closed  bool
+	bad     int
+
+	mu  sync.Mutex
+	err error
+}
+
+// stagedRow is a row waiting to be inserted by an insertStage.
+type stagedRow struct {
+	ins  inserter
+	args []interface{}
+}
+
+// newInsertStage starts a new insertion stage. Close must be called before
+// committing the transactions of any inserters wrapped by the stage.
+func newInsertStage() *insertStage {
+	s := &insertStage{
+		rows:    make(chan []stagedRow, pipelineDepth),
+		batch:   make([]stagedRow, 0, pipelineBatch),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *insertStage) run() {
+	defer close(s.stopped)
+	for rows := range s.rows {
+		if s.failed() != nil {
+			continue // drain, so that senders aren't blocked
+		}
+		for _, row := range rows {
+			err := s.skipBad(row.ins.Exec(row.args...))
+			if err != nil {
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+				break
+			}
+		}
+	}
+}
+
+// skipBad logs the rows of an *imdb.BatchError and returns nil, unless too
+// many rows have been skipped. Any other error is returned as is.
+func (s *insertStage) skipBad(err error) error {
+	berr, ok := err.(*imdb.BatchError)
+	if !ok {
+		return err
+	}
+	s.bad += len(berr.Rows)
+	toStr := func(v interface{}) string { return sf("%#v", v) }
+	for _, row := range berr.Rows {
+		logf("Skipping %s row %s: %s", berr.Table,
+			fun.Map(toStr, row.Values).([]string), row.Err)
+	}
+	if flagLoadMaxBad >= 0 && s.bad > flagLoadMaxBad {
+		return ef("Too many bad rows (%d). Last error: %s", s.bad, berr)
+	}
+	return nil
+}
+
+func (s *insertStage) failed() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// newInserter is just like the function newInserter, except the rows of the
+// inserter returned are inserted by the stage.
+func (s *insertStage) newInserter(
+	tx *sql.Tx,
+	driver, table string,
+	columns ...string,
+) (inserter, error) {
+	ins, err := newInserter(tx, driver, table, columns...)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(ins), nil
+}
+
+// newAtomizer is just like the function newAtomizer, except new atoms are
+// inserted by the stage, so that they're inserted in order with the rows
+// that refer to them.
+func (s *insertStage) newAtomizer(
+	db *imdb.DB,
+	tx *sql.Tx,
+) (*imdb.Atomizer, error) {
+	ins, err := s.newInserter(tx, db.Driver, "atom", "id", "hash")
+	if err != nil {
+		return nil, err
+	}
+	return imdb.NewAtomizerSize(db, ins, atomMapSize)
+}
+
+// wrap returns an inserter whose rows are inserted by the stage.
+func (s *insertStage) wrap(ins inserter) inserter {
+	return stageInserter{s, ins}
+}
+
+func (s *insertStage) add(ins inserter, args []interface{}) error {
+	if err := s.failed(); err != nil {
+		return err
+	}
+	s.batch = append(s.batch, stagedRow{ins, args})
+	if len(s.batch) == pipelineBatch {
+		s.rows <- s.batch
+		s.batch = make([]stagedRow, 0, pipelineBatch)
+	}
+	return nil
+}
+
+// Close waits for every row given to the stage to be inserted, and returns
+// the first error that occurred. It does not flush the buffers of the
+// inserters wrapped by the stage. (Call Exec with no arguments on each of
+// them before calling Close.)
+func (s *insertStage) Close() error {
+	if s.closed {
+		return s.failed()
+	}
+	s.closed = true
+	if len(s.batch) > 0 {
+		s.rows <- s.batch
+		s.batch = nil
+	}
+	close(s.rows)
+	<-s.stopped
+	return s.failed()
+}
+
+// stageInserter is an inserter whose rows are inserted by an insertStage.
+type stageInserter struct {
+	stage *insertStage
+	ins   inserter
+}
+
+func (si stageInserter) Exec(args ...interface{}) error {
+	return si.stage.add(si.ins, args)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadLines(t *testing.T) {
+	var want []string
+	for i := 0; i < 3*pipelineBatch+7; i++ {
+		want = append(want, strings.Repeat("x", i%100))
+	}
+	list := strings.NewReader(strings.Join(want, "\n"))
+
+	var got [][]byte
+	for batch := range readLines(list, make(chan struct{})) {
+		if batch.err != nil {
+			t.Fatal(batch.err)
+		}
+		got = append(got, batch.lines...)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d lines but got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], []byte(want[i])) {
+			t.Fatalf("line %d: expected '%s' but got '%s'", i, want[i], got[i])
+		}
+	}
+}
+
+// recorder is an inserter that records the rows given to it.
+type recorder struct {
+	name string
+	rows *[]string
+}
+
+func (r recorder) Exec(args ...interface{}) error {
+	if len(args) > 0 {
+		*r.rows = append(*r.rows, sf("%s %v", r.name, args[0]))
+	}
+	return nil
+}
+
+func TestInsertStage(t *testing.T) {
+	var rows, want []string
+	stage := newInsertStage()
+	a := stage.wrap(recorder{"a", &rows})
+	b := stage.wrap(recorder{"b", &rows})
+	for i := 0; i < 2*pipelineBatch+3; i++ {
+		ins, name := a, "a"
+		if i%3 == 0 {
+			ins, name = b, "b"
+		}
+		if err := ins.Exec(i); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, sf("%s %d", name, i))
+	}
+	if err := stage.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(rows, ",") != strings.Join(want, ",") {
+		t.Fatalf("rows were inserted out of order:\n%v", rows)
+	}
+}
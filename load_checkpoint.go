@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// Checkpoints record how many rows of a table have been committed while its
+// list is loaded. They're stored in the 'load_checkpoint' table, keyed by the
+// name of the table being loaded, and are removed once a list is completely
+// loaded. (So any checkpoint left behind belongs to a load that failed.)
+//
+// Only lists loaded into a single table (i.e., every list but 'movies',
+// 'actors' and 'crew') are checkpointed. The others always start over.
+//
+// Checkpoints also record the version of the list being loaded (see
+// listVersion), so that a load isn't resumed with a list that changed since.
+
+// loadingVersions are the versions of the list files being loaded, keyed by
+// the name of the list file. They're set by 'goim load' before any list is
+// loaded.
+var loadingVersions = map[string]listVersion{}
+
+// tableVersion returns the version of the list being loaded into the table
+// given, which is empty if it isn't known.
+func tableVersion(table string) listVersion {
+	for list, tables := range listTables {
+		if len(tables) == 1 && tables[0] == table {
+			return loadingVersions[list]
+		}
+	}
+	return listVersion{}
+}
+
+// checkpointRows returns the number of rows of the table given that were
+// committed by a load that didn't finish, or 0 if there is no checkpoint.
+// It's an error if the checkpoint was made while loading a different version
+// of the list than v.
+func checkpointRows(db *imdb.DB, table string, v listVersion) int {
+	var rows int
+	var version string
+	err := db.QueryRow(
+		"SELECT row_count, version FROM load_checkpoint WHERE name = $1", table,
+	).Scan(&rows, &version)
+	if err == sql.ErrNoRows {
+		return 0
+	}
+	csql.Panic(err)
+	if version != v.String() {
+		csql.Panic(ef("The list for table %s has changed since its load was "+
+			"interrupted (it was '%s' and is now '%s'), so it can't be "+
+			"resumed. Load it again without '-resume'.",
+			table, version, v))
+	}
+	return rows
+}
+
+// setCheckpoint records the number of rows of the table given that will be
+// committed along with the transaction given, and the version of the list
+// that they were loaded from.
+func setCheckpoint(tx *sql.Tx, table string, rows int, v listVersion) {
+	clearCheckpoint(tx, table)
+	csql.Exec(tx, `
+		INSERT INTO load_checkpoint (name, row_count, updated, version)
+		VALUES ($1, $2, $3, $4)
+	`, table, rows, time.Now().UTC(), v.String())
+}
+
+// clearCheckpoint removes the checkpoint of the table given, if there is one.
+func clearCheckpoint(tx *sql.Tx, table string) {
+	csql.Exec(tx, "DELETE FROM load_checkpoint WHERE name = $1", table)
+}
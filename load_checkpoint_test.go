@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/csql"
+)
+
+func TestCheckpointVersion(t *testing.T) {
+	v := listVersion{ETag: `"abc"`}
+	tx, err := testDB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	setCheckpoint(tx, "genre", 500, v)
+
+	rows := func(v listVersion) (n int, err error) {
+		defer csql.Safe(&err)
+		return checkpointRows(testDB, "genre", v), nil
+	}
+	// The checkpoint isn't visible until it's committed.
+	if n, err := rows(listVersion{}); err != nil || n != 0 {
+		t.Fatalf("got %d rows (%v) before committing, want 0", n, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	defer csql.Exec(testDB, "DELETE FROM load_checkpoint")
+
+	if n, err := rows(v); err != nil || n != 500 {
+		t.Errorf("got %d rows (%v), want 500", n, err)
+	}
+	if _, err := rows(listVersion{ETag: `"xyz"`}); err == nil {
+		t.Errorf("expected an error resuming a different version")
+	}
+	if _, err := rows(listVersion{}); err == nil {
+		t.Errorf("expected an error resuming an unknown version")
+	}
+}
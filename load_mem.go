@@ -0,0 +1,115 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fullMemBudget is the memory budget (in bytes) at which loading uses its
+// default settings. Smaller budgets scale the settings down.
+const fullMemBudget = 4 << 30
+
+var (
+	// atomMapSize is the number of atoms that room is made for before any
+	// atoms are read into an atomizer. Every atom is read regardless, so
+	// making it smaller only avoids reserving memory that isn't needed yet.
+	atomMapSize = 1000000
+
+	// insertBatchParams is the number of values sent to the database in each
+	// INSERT statement, so that rows with more columns are sent in smaller
+	// batches. If it's 0, the default of imdb.NewInserter is used.
+	insertBatchParams = 0
+
+	// maxLoadConcurrent is the most lists that are loaded at the same time
+	// after the movies and actors lists. If it's 0, flagCpu is used.
+	maxLoadConcurrent = 0
+)
+
+// parseSize parses a size in bytes with an optional suffix of K, M or G
+// (with or without a trailing B, in any case). Fractions are allowed, e.g.,
+// "1.5G".
+func parseSize(s string) (int64, error) {
+	num := strings.ToUpper(strings.TrimSpace(s))
+	num = strings.TrimSuffix(num, "B")
+	mult := float64(1)
+	if len(num) > 0 {
+		switch num[len(num)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		}
+		if mult > 1 {
+			num = num[:len(num)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || n <= 0 {
+		return 0, ef("Could not parse '%s' as a size. "+
+			"Try something like '512M' or '2G'.", s)
+	}
+	return int64(n * mult), nil
+}
+
+// setMemBudget scales the sizes of the buffers used while loading lists to
+// the number of bytes given. Budgets as large as fullMemBudget leave the
+// defaults alone. The garbage collector is also made to run more often, so
+// that less memory is used between collections.
+//
+// The atoms read from the database must fit in memory regardless, which
+// needs a few hundred megabytes for all of IMDb's lists.
+func setMemBudget(budget int64) {
+	if budget >= fullMemBudget {
+		return
+	}
+	scale := float64(budget) / fullMemBudget
+	scaled := func(n int, min int) int {
+		if m := int(float64(n) * scale); m > min {
+			return m
+		}
+		return min
+	}
+	atomMapSize = scaled(atomMapSize, 10000)
+	pipelineDepth = scaled(pipelineDepth, 2)
+	pipelineBatch = scaled(pipelineBatch, 128)
+	gzipBlockSize = scaled(gzipBlockSize, 256*1024)
+	insertBatchParams = scaled(999, 50)
+	maxLoadConcurrent = scaled(flagCpu, 1)
+	debug.SetGCPercent(50)
+}
+
+// reportMemory logs how much memory is in use every interval given until the
+// function returned is called. When more memory than the budget is in use,
+// memory that's no longer used is returned to the operating system.
+func reportMemory(budget int64, every time.Duration) (stop func()) {
+	quit := make(chan struct{})
+	go func() {
+		tick := time.NewTicker(every)
+		defer tick.Stop()
+
+		var stats runtime.MemStats
+		for {
+			select {
+			case <-tick.C:
+			case <-quit:
+				return
+			}
+			runtime.ReadMemStats(&stats)
+			used := int64(stats.Sys - stats.HeapReleased)
+			logf("Memory: %s in use (%s heap) of %s budget.",
+				prettyFileSize(used), prettyFileSize(int64(stats.HeapAlloc)),
+				prettyFileSize(budget))
+			if used > budget {
+				logf("Memory in use exceeds the budget. Releasing unused " +
+					"memory.")
+				debug.FreeOSMemory()
+			}
+		}
+	}()
+	return func() { close(quit) }
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+	}{
+		{"1024", 1024},
+		{"512k", 512 << 10},
+		{"512M", 512 << 20},
+		{"2G", 2 << 30},
+		{"2GB", 2 << 30},
+		{"1.5g", 3 << 29},
+	}
+	for _, test := range tests {
+		got, err := parseSize(test.size)
+		if err != nil {
+			t.Errorf("%s: %s", test.size, err)
+		} else if got != test.want {
+			t.Errorf("%s: expected %d but got %d", test.size, test.want, got)
+		}
+	}
+	for _, bad := range []string{"", "G", "-1G", "two gigs"} {
+		if _, err := parseSize(bad); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestMemBudgetBatchSize(t *testing.T) {
+	defer func(atoms, depth, batch, block, params, conc, gc int) {
+		atomMapSize, pipelineDepth, pipelineBatch = atoms, depth, batch
+		gzipBlockSize, insertBatchParams = block, params
+		maxLoadConcurrent = conc
+		debug.SetGCPercent(gc)
+	}(atomMapSize, pipelineDepth, pipelineBatch, gzipBlockSize,
+		insertBatchParams, maxLoadConcurrent, debug.SetGCPercent(100))
+
+	full, err := newInserter(nil, "sqlite3", "name", "a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setMemBudget(2 << 30)
+	ins, err := newInserter(nil, "sqlite3", "name", "a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := ins.BatchSize(); n*3 > 999 {
+		t.Errorf("batches of %d rows have %d parameters, but SQLite only "+
+			"allows 999", n, n*3)
+	}
+	if n, max := ins.BatchSize(), full.BatchSize(); n >= max {
+		t.Errorf("batches of %d rows with a 2G budget aren't smaller than "+
+			"the %d rows without one", n, max)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// loadReport summarizes a load for webhooks, so that caches downstream can be
+// invalidated or people can be told about new data. (See 'goim help load'.)
+type loadReport struct {
+	// Status is 'succeeded', 'partial' (some lists failed to load),
+	// 'failed' or 'interrupted'.
+	Status     string                `json:"status"`
+	Lists      []string              `json:"lists"`
+	Failed     []string              `json:"failed"`
+	Tables     map[string]tableDelta `json:"tables"`
+	Started    time.Time             `json:"started"`
+	Finished   time.Time             `json:"finished"`
+	Duration   float64               `json:"duration_seconds"`
+	Errors     []string              `json:"errors"`
+	Generation int                   `json:"generation,omitempty"`
+	Dataset    string                `json:"dataset,omitempty"`
+
+	hooks []string
+	mu    sync.Mutex // protects Errors
+}
+
+// tableDelta is the number of rows in a table before and after a load.
+type tableDelta struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
+	Delta  int `json:"delta"`
+}
+
+// newLoadReport starts a report that is posted to the webhooks given when
+// it's sent. Error messages printed with errorf until then are recorded in
+// it. If there are no webhooks, nothing is recorded or posted.
+func newLoadReport(hooks []string) *loadReport {
+	return &loadReport{
+		Started: time.Now(),
+		Tables:  make(map[string]tableDelta),
+		hooks:   hooks,
+	}
+}
+
+// errorf prints an error message, and records it in the report if there are
+// webhooks to send it to. It may be called from any goroutine.
+func (r *loadReport) errorf(format string, v ...interface{}) {
+	pef(format, v...)
+	if len(r.hooks) == 0 {
+		return
+	}
+	r.mu.Lock()
+	r.Errors = append(r.Errors, sf(format, v...))
+	r.mu.Unlock()
+}
+
+// begin records the lists being loaded and the number of rows in the tables
+// that they change.
+func (r *loadReport) begin(db *imdb.DB, lists []string) {
+	if len(r.hooks) == 0 {
+		return
+	}
+	r.Lists = append([]string(nil), lists...)
+	for _, table := range loadedTables(lists) {
+		if n, err := safeRowCount(db, table); err == nil {
+			r.Tables[table] = tableDelta{Before: n}
+		}
+	}
+}
+
+// send finishes the report and posts it to the webhooks. A report is only
+// posted if loading began.
+func (r *loadReport) send(db *imdb.DB, ok bool, failed map[string]bool) {
+	if len(r.hooks) == 0 || r.Lists == nil {
+		return
+	}
+	r.Finished = time.Now()
+	r.Duration = r.Finished.Sub(r.Started).Seconds()
+	for name := range failed {
+		r.Failed = append(r.Failed, name)
+	}
+	sort.Strings(r.Failed)
+	for table, delta := range r.Tables {
+		n, err := safeRowCount(db, table)
+		if err != nil {
+			delete(r.Tables, table)
+			continue
+		}
+		delta.After, delta.Delta = n, n-delta.Before
+		r.Tables[table] = delta
+	}
+	switch {
+	case stopping():
+		r.Status = "interrupted"
+	case !ok:
+		r.Status = "failed"
+	case len(r.Failed) > 0:
+		r.Status = "partial"
+	default:
+		r.Status = "succeeded"
+	}
+	logf("Sending load summary to %d webhook(s)...", len(r.hooks))
+	postJSON(r.hooks, r)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadReport(t *testing.T) {
+	got := make(chan *loadReport, 1)
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			report := new(loadReport)
+			if err := json.NewDecoder(r.Body).Decode(report); err != nil {
+				t.Error(err)
+			}
+			got <- report
+		}))
+	defer srv.Close()
+
+	orig := pef
+	pef = func(f string, v ...interface{}) {}
+	defer func() { pef = orig }()
+
+	r := newLoadReport([]string{srv.URL})
+	r.Lists = []string{"movies", "plot"}
+	r.errorf("Could not store %s list: %s", "plot", "oops")
+	r.send(nil, true, map[string]bool{"plot": true})
+
+	report := <-got
+	if report.Status != "partial" {
+		t.Fatalf("expected status 'partial' but got '%s'", report.Status)
+	}
+	if len(report.Failed) != 1 || report.Failed[0] != "plot" {
+		t.Fatalf("expected 'plot' to fail but got %v", report.Failed)
+	}
+	want := "Could not store plot list: oops"
+	if len(report.Errors) != 1 || report.Errors[0] != want {
+		t.Fatalf("expected error '%s' but got %v", want, report.Errors)
+	}
+	pef("not recorded")
+	if len(r.Errors) != 1 {
+		t.Fatalf("errors printed with pef were recorded")
+	}
+}
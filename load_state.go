@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/BurntSushi/csql"
+
+	"github.com/BurntSushi/goim/imdb"
+)
+
+// The load state records the version (see listVersion) of each list file
+// that was last loaded into the database. It's stored in the 'load_state'
+// table, keyed by the name of the list file. With 'goim load -changed', lists
+// whose files still have the version that was last loaded are skipped.
+
+// loadedVersion returns the version of the list file given that was last
+// loaded, which is empty if it isn't known.
+func loadedVersion(db *imdb.DB, name string) listVersion {
+	var v listVersion
+	err := db.QueryRow(
+		"SELECT etag, last_modified FROM load_state WHERE name = $1", name,
+	).Scan(&v.ETag, &v.LastModified)
+	if err != nil && err != sql.ErrNoRows {
+		csql.Panic(err)
+	}
+	return v
+}
+
+// setLoadedVersion records the version of the list file given as loaded. An
+// empty version removes the record, since the file loaded can't be compared
+// with others.
+func setLoadedVersion(db *imdb.DB, name string, v listVersion) (err error) {
+	defer csql.Safe(&err)
+
+	tx, err := db.Begin()
+	csql.Panic(err)
+	defer tx.Rollback()
+
+	csql.Exec(tx, "DELETE FROM load_state WHERE name = $1", name)
+	if !v.empty() {
+		csql.Exec(tx, `
+			INSERT INTO load_state (name, etag, last_modified, loaded)
+			VALUES ($1, $2, $3, $4)
+		`, name, v.ETag, v.LastModified, time.Now().UTC())
+	}
+	return tx.Commit()
+}
+
+// unchangedList returns true if every file of the list given has a known
+// version that is the same as the version last loaded. The current versions
+// of the files are added to versions.
+func unchangedList(
+	db *imdb.DB,
+	fetch fetcher,
+	list string,
+	versions map[string]listVersion,
+) bool {
+	unchanged := true
+	for _, name := range listFiles([]string{list}) {
+		v := currentVersion(fetch, name)
+		versions[name] = v
+		if v.empty() || v != loadedVersion(db, name) {
+			unchanged = false
+		}
+	}
+	return unchanged
+}
+
+// datasetDate returns the date of the newest list file loaded according to
+// the Last-Modified dates that servers sent with them. It is zero when no
+// list file has a date.
+func datasetDate(versions map[string]listVersion, loaded []string) time.Time {
+	var newest time.Time
+	for _, name := range listFiles(loaded) {
+		date, err := http.ParseTime(versions[name].LastModified)
+		if err == nil && date.After(newest) {
+			newest = date
+		}
+	}
+	return newest
+}
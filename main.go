@@ -15,10 +15,38 @@ var commands = []*command{
 	cmdFull,
 	cmdShort,
 	cmdLoad,
+	cmdFetch,
+	cmdAnalytics,
+	cmdCopy,
+	cmdExport,
+	cmdGetPrebuilt,
+	cmdCache,
+	cmdCron,
 	cmdSearch,
 	cmdSize,
+	cmdStats,
+	cmdTrending,
+	cmdGaps,
+	cmdScan,
+	cmdLibrary,
+	cmdTrakt,
+	cmdLetterboxd,
+	cmdWatch,
+	cmdBench,
+	cmdSchema,
+	cmdIndex,
+	cmdPartition,
 	cmdWrite,
 	cmdRename,
+	cmdOverlay,
+	cmdSaved,
+	cmdXref,
+	cmdArtwork,
+	cmdKeys,
+	cmdAtoms,
+	cmdRepl,
+	cmdHistory,
+	cmdBrowse,
 	cmdFtp,
 }
 
@@ -92,7 +120,12 @@ func main() {
 					defer pprof.StopCPUProfile()
 				}
 
-				if !c.run(c) {
+				c.defineMacros()
+				ok := c.run(c)
+				if stopping() {
+					os.Exit(exitStatus(interruptedBy))
+				}
+				if !ok {
 					os.Exit(1)
 				}
 				return
@@ -0,0 +1,298 @@
+/*
+Package parsefile guesses what a movie or episode file is from its name. It
+understands the naming schemes that are common for scene releases and media
+libraries, e.g.,
+
+	The.Matrix.1999.1080p.BluRay.x264-GROUP.mkv
+	Brazil (1985).avi
+	The.Simpsons.S02E05.720p.HDTV.x264-GROUP.mkv
+	Doctor Who (2005) - 1x01 - Rose.mp4
+
+and extracts the title, the year, season and episode numbers, and the quality
+tags (resolution, source, codec, audio, edition and release group) from them.
+
+Nothing is looked up, so the title is only a guess: it's whatever comes before
+the year, episode numbers or the first quality tag, with separators replaced by
+spaces. Search for it to find the entity (see the 'rename' and 'scan' commands
+of Goim).
+*/
+package parsefile
+
+import (
+	"fmt"
+	path "path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Default regular expressions of a Parser. They're exported so that they can
+// be used as the default values of flags.
+const (
+	DefaultEpisode      = `\b[Ss]([0-9]+)[Ee]([0-9]+)\b`
+	DefaultMultiEpisode = `\b[Ss]([0-9]+)[Ee]([0-9]+)(?:-?[Ee]|-)([0-9]+)\b`
+	DefaultYear         = `\b([0-9]{4})\b`
+)
+
+// crossEpisode matches episode numbers of the form '1x02', which are tried
+// after a Parser's Episode expression. The number of digits is limited so
+// that video dimensions like '1920x1080' aren't mistaken for them.
+var crossEpisode = regexp.MustCompile(`\b([0-9]{1,2})[Xx]([0-9]{2,3})\b`)
+
+// Years outside of this range are never taken for the year of a release.
+const (
+	minYear = 1870
+	maxYear = 2099
+)
+
+// Name is what was found in a file name.
+type Name struct {
+	// Title is the title of the movie, or the name of the TV show of an
+	// episode.
+	Title string
+
+	// Year is the year of the movie or TV show. It is 0 when the name doesn't
+	// have one.
+	Year int
+
+	// Season and Episode are the season and episode numbers of an episode.
+	// LastEpisode is the number of the last episode in a file with more than
+	// one episode (e.g., 'S01E05E06'), and is otherwise the same as Episode.
+	Season, Episode, LastEpisode int
+
+	// Tags are the quality tags after the title.
+	Tags Tags
+
+	// Ext is the extension of the file name, without the dot.
+	Ext string
+
+	episodic bool
+}
+
+// IsEpisode returns true if the name has season and episode numbers.
+func (n Name) IsEpisode() bool {
+	return n.episodic
+}
+
+// IsMultiEpisode returns true if the name has more than one episode.
+func (n Name) IsMultiEpisode() bool {
+	return n.episodic && n.LastEpisode > n.Episode
+}
+
+func (n Name) String() string {
+	s := n.Title
+	if n.Year > 0 {
+		s += fmt.Sprintf(" (%d)", n.Year)
+	}
+	if n.IsMultiEpisode() {
+		s += fmt.Sprintf(" S%02dE%02d-E%02d",
+			n.Season, n.Episode, n.LastEpisode)
+	} else if n.episodic {
+		s += fmt.Sprintf(" S%02dE%02d", n.Season, n.Episode)
+	}
+	if tags := n.Tags.String(); len(tags) > 0 {
+		s += " [" + tags + "]"
+	}
+	return s
+}
+
+// Parser extracts names with regular expressions for years and episode
+// numbers, which may be changed to read unusual naming schemes.
+type Parser struct {
+	// Episode matches the season and episode numbers of an episode. It must
+	// have two capturing groups: the season number and the episode number.
+	Episode *regexp.Regexp
+
+	// MultiEpisode matches the numbers of a file with more than one episode,
+	// and is tried before Episode. It must have three capturing groups: the
+	// season number, the first episode number and the last episode number.
+	MultiEpisode *regexp.Regexp
+
+	// Year matches a year. It must have one capturing group for the year.
+	Year *regexp.Regexp
+}
+
+// Default is the parser used by Parse.
+var Default = MustNew(DefaultEpisode, DefaultMultiEpisode, DefaultYear)
+
+// New returns a parser with the regular expressions given (in RE2 syntax),
+// or an error if any of them don't compile or don't have the capturing
+// groups described in Parser.
+func New(episode, multiEpisode, year string) (*Parser, error) {
+	var p Parser
+	for _, re := range []struct {
+		dst    **regexp.Regexp
+		expr   string
+		groups int
+	}{
+		{&p.Episode, episode, 2},
+		{&p.MultiEpisode, multiEpisode, 3},
+		{&p.Year, year, 1},
+	} {
+		compiled, err := regexp.Compile(re.expr)
+		if err != nil {
+			return nil, fmt.Errorf("Could not compile regex '%s': %s",
+				re.expr, err)
+		}
+		if compiled.NumSubexp() != re.groups {
+			return nil, fmt.Errorf("Regex '%s' must have %d capturing "+
+				"group(s), but it has %d.",
+				re.expr, re.groups, compiled.NumSubexp())
+		}
+		*re.dst = compiled
+	}
+	return &p, nil
+}
+
+// MustNew is like New, except it panics if the parser can't be created.
+func MustNew(episode, multiEpisode, year string) *Parser {
+	p, err := New(episode, multiEpisode, year)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Parse extracts a name from the file name given with the default parser.
+func Parse(fname string) Name {
+	return Default.Parse(fname)
+}
+
+// Parse extracts a name from the file name given. Directories in fname are
+// ignored.
+func (p *Parser) Parse(fname string) Name {
+	var n Name
+	name := path.Base(fname)
+	if ext := path.Ext(name); isExt(ext) {
+		n.Ext = ext[1:]
+		name = name[:len(name)-len(ext)]
+	}
+	// Underscores are word characters, so they'd hide word boundaries.
+	name = strings.Replace(name, "_", " ", -1)
+
+	// The title ends where the episode numbers or year start. Otherwise, it
+	// ends at the first quality tag.
+	end := -1
+	if start, ok := p.episode(name, &n); ok {
+		n.episodic = true
+		end = start
+		// The season number may be preceded by an 'S'.
+		if end > 0 && (name[end-1] == 'S' || name[end-1] == 's') {
+			end--
+		}
+	}
+	yearIn := name
+	if end > -1 {
+		yearIn = name[:end]
+	}
+	// Years after quality tags are usually about the release (e.g., the year
+	// of a remaster), but titles can look like tags too (e.g., 'Web').
+	year, start, ok := 0, 0, false
+	if tag := firstTag(yearIn); tag > 0 {
+		year, start, ok = p.year(yearIn[:tag])
+	}
+	if !ok {
+		year, start, ok = p.year(yearIn)
+	}
+	if ok {
+		n.Year, end = year, start
+	}
+	if end == -1 {
+		end = len(name)
+		if start := firstTag(name); start > 0 {
+			end = start
+		}
+	}
+	n.Title = cleanTitle(name[:end])
+	n.Tags = findTags(name[end:])
+	return n
+}
+
+// episode finds the season and episode numbers in name and returns where
+// they start.
+func (p *Parser) episode(name string, n *Name) (int, bool) {
+	if nums, start, ok := numbers(p.MultiEpisode, name); ok {
+		if nums[2] > nums[1] {
+			n.Season, n.Episode, n.LastEpisode = nums[0], nums[1], nums[2]
+			return start, true
+		}
+	}
+	for _, re := range []*regexp.Regexp{p.Episode, crossEpisode} {
+		if nums, start, ok := numbers(re, name); ok {
+			n.Season, n.Episode, n.LastEpisode = nums[0], nums[1], nums[1]
+			return start, true
+		}
+	}
+	return 0, false
+}
+
+// year returns the last plausible year in name and where it starts. A year
+// at the very start of a name is part of the title (e.g., '2001 A Space
+// Odyssey'), so it's never used.
+func (p *Parser) year(name string) (year, start int, ok bool) {
+	for _, groups := range p.Year.FindAllStringSubmatchIndex(name, -1) {
+		if groups[2] <= 0 {
+			continue
+		}
+		y, err := strconv.Atoi(name[groups[2]:groups[3]])
+		if err != nil || y < minYear || y > maxYear {
+			continue
+		}
+		year, start, ok = y, groups[2], true
+	}
+	return
+}
+
+// numbers returns the integers in the capturing groups of the first match of
+// re in name, along with where the first group starts.
+func numbers(re *regexp.Regexp, name string) ([]int, int, bool) {
+	groups := re.FindStringSubmatchIndex(name)
+	if groups == nil {
+		return nil, 0, false
+	}
+	nums := make([]int, re.NumSubexp())
+	for i := range nums {
+		start, end := groups[2*i+2], groups[2*i+3]
+		if start == -1 {
+			return nil, 0, false
+		}
+		n, err := strconv.Atoi(name[start:end])
+		if err != nil {
+			return nil, 0, false
+		}
+		nums[i] = n
+	}
+	return nums, groups[2], true
+}
+
+// isExt returns true if ext (with its dot) is the extension of a media,
+// subtitle or info file, rather than the end of a name without one (e.g.,
+// '.1999' or '.x264').
+func isExt(ext string) bool {
+	return knownExts[strings.ToLower(ext)]
+}
+
+var knownExts = map[string]bool{
+	".avi": true, ".divx": true, ".flv": true, ".iso": true, ".m2ts": true,
+	".m4v": true, ".mkv": true, ".mov": true, ".mp4": true, ".mpeg": true,
+	".mpg": true, ".ogm": true, ".ts": true, ".vob": true, ".webm": true,
+	".wmv": true,
+	".ass": true, ".idx": true, ".srt": true, ".sub": true, ".ssa": true,
+	".nfo": true,
+}
+
+// cleanTitle replaces the separators in a title with spaces, and removes
+// brackets and dashes at its end.
+func cleanTitle(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '_':
+			return ' '
+		case '{', '}':
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.TrimSpace(strings.TrimRight(s, " -([,"))
+}
@@ -0,0 +1,190 @@
+package parsefile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		fname string
+		want  Name
+	}{
+		// Movies.
+		{
+			"The.Matrix.1999.1080p.BluRay.x264-SPARKS.mkv",
+			Name{Title: "The Matrix", Year: 1999, Ext: "mkv", Tags: Tags{
+				Resolution: "1080p", Source: "BluRay", Codec: "x264",
+				Group: "SPARKS",
+			}},
+		},
+		{
+			"/media/movies/Brazil (1985)/Brazil (1985).avi",
+			Name{Title: "Brazil", Year: 1985, Ext: "avi"},
+		},
+		{
+			"Primer.mp4",
+			Name{Title: "Primer", Ext: "mp4"},
+		},
+		{
+			"Heat [1995] [720p].mkv",
+			Name{Title: "Heat", Year: 1995, Ext: "mkv",
+				Tags: Tags{Resolution: "720p"}},
+		},
+		{
+			"2001.A.Space.Odyssey.1968.2160p.UHD.BluRay.HDR.HEVC.mkv",
+			Name{Title: "2001 A Space Odyssey", Year: 1968, Ext: "mkv",
+				Tags: Tags{Resolution: "2160p", Source: "BluRay",
+					HDR: "HDR", Codec: "HEVC"}},
+		},
+		{
+			"1917.2019.1080p.WEB-DL.DDP5.1.H.264-GRP.mkv",
+			Name{Title: "1917", Year: 2019, Ext: "mkv", Tags: Tags{
+				Resolution: "1080p", Source: "WEB-DL", Codec: "H.264",
+				Audio: "EAC3", Group: "GRP",
+			}},
+		},
+		{
+			"Blade.Runner.2049.2017.2160p.WEBRip.x265.mkv",
+			Name{Title: "Blade Runner 2049", Year: 2017, Ext: "mkv",
+				Tags: Tags{Resolution: "2160p", Source: "WEBRip",
+					Codec: "x265"}},
+		},
+		{
+			"Aliens.1986.Special.Edition.REMASTERED.1080p.BluRay.DTS-HD.MA" +
+				".5.1.x264-GROUP.mkv",
+			Name{Title: "Aliens", Year: 1986, Ext: "mkv", Tags: Tags{
+				Resolution: "1080p", Source: "BluRay", Codec: "x264",
+				Audio:    "DTS-HD",
+				Editions: []string{"Special Edition", "Remastered"},
+				Group:    "GROUP",
+			}},
+		},
+		{
+			"Charlotte's.Web.2006.DVDRip.XviD.PROPER.avi",
+			Name{Title: "Charlotte's Web", Year: 2006, Ext: "avi",
+				Tags: Tags{Source: "DVDRip", Codec: "XviD", Proper: true}},
+		},
+		{
+			"Spider-Man.2002.mkv",
+			Name{Title: "Spider-Man", Year: 2002, Ext: "mkv"},
+		},
+		{
+			"Spider-Man.720p.WEB.mkv",
+			Name{Title: "Spider-Man", Ext: "mkv",
+				Tags: Tags{Resolution: "720p", Source: "WEB"}},
+		},
+		{
+			"Mad.Max.Fury.Road.2015.1080p.BluRay.AAC5.1 [YTS.MX].mp4",
+			Name{Title: "Mad Max Fury Road", Year: 2015, Ext: "mp4",
+				Tags: Tags{Resolution: "1080p", Source: "BluRay",
+					Audio: "AAC", Group: "YTS.MX"}},
+		},
+		{
+			"Movie.2010.REMASTERED.2020.1080p.mkv",
+			Name{Title: "Movie", Year: 2010, Ext: "mkv", Tags: Tags{
+				Resolution: "1080p", Editions: []string{"Remastered"},
+			}},
+		},
+		{
+			"Some_Movie_1984_DVD.avi",
+			Name{Title: "Some Movie", Year: 1984, Ext: "avi",
+				Tags: Tags{Source: "DVD"}},
+		},
+		{
+			"The.Matrix.1999",
+			Name{Title: "The Matrix", Year: 1999},
+		},
+		{
+			"Movie.2019.1920x1080.mkv",
+			Name{Title: "Movie", Year: 2019, Ext: "mkv"},
+		},
+
+		// Episodes.
+		{
+			"The.Simpsons.S02E05.720p.HDTV.x264-LOL.mkv",
+			Name{Title: "The Simpsons", Season: 2, Episode: 5,
+				LastEpisode: 5, Ext: "mkv", episodic: true, Tags: Tags{
+					Resolution: "720p", Source: "HDTV", Codec: "x264",
+					Group: "LOL",
+				}},
+		},
+		{
+			"Doctor_Who_2005_s01e01e02.mkv",
+			Name{Title: "Doctor Who", Year: 2005, Season: 1, Episode: 1,
+				LastEpisode: 2, Ext: "mkv", episodic: true},
+		},
+		{
+			"Doctor Who (2005) - 1x01 - Rose.mp4",
+			Name{Title: "Doctor Who", Year: 2005, Season: 1, Episode: 1,
+				LastEpisode: 1, Ext: "mp4", episodic: true},
+		},
+		{
+			"Lost - S01E01-02 - Pilot.avi",
+			Name{Title: "Lost", Season: 1, Episode: 1, LastEpisode: 2,
+				Ext: "avi", episodic: true},
+		},
+		{
+			"Show.Name.S03E10.Part-Two.mkv",
+			Name{Title: "Show Name", Season: 3, Episode: 10,
+				LastEpisode: 10, Ext: "mkv", episodic: true},
+		},
+		{
+			"Fargo.S01E01.iNTERNAL.REPACK.1080p.WEB.h264-GRP.mkv",
+			Name{Title: "Fargo", Season: 1, Episode: 1, LastEpisode: 1,
+				Ext: "mkv", episodic: true, Tags: Tags{
+					Resolution: "1080p", Source: "WEB", Codec: "H.264",
+					Proper: true, Group: "GRP",
+				}},
+		},
+		{
+			"show.s10e100.srt",
+			Name{Title: "show", Season: 10, Episode: 100,
+				LastEpisode: 100, Ext: "srt", episodic: true},
+		},
+	} {
+		got := Parse(test.fname)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\n got %#v\nwant %#v", test.fname, got, test.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	p, err := New(`(\d+)\.(\d+)`, DefaultMultiEpisode, `\[(\d{4})\]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := p.Parse("Show [2005] 3.07.mkv")
+	want := Name{Title: "Show", Year: 2005, Season: 3, Episode: 7,
+		LastEpisode: 7, Ext: "mkv", episodic: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	for _, exprs := range [][3]string{
+		{`(\d+)`, DefaultMultiEpisode, DefaultYear},
+		{DefaultEpisode, DefaultEpisode, DefaultYear},
+		{DefaultEpisode, DefaultMultiEpisode, `\d{4}`},
+		{DefaultEpisode, DefaultMultiEpisode, `(\d{4}`},
+	} {
+		if _, err := New(exprs[0], exprs[1], exprs[2]); err == nil {
+			t.Errorf("%q: expected an error", exprs)
+		}
+	}
+}
+
+func TestNameString(t *testing.T) {
+	for _, test := range []struct {
+		fname, want string
+	}{
+		{"The.Matrix.1999.1080p.BluRay.x264-SPARKS.mkv",
+			"The Matrix (1999) [1080p BluRay x264 -SPARKS]"},
+		{"Lost.S01E01E02.mkv", "Lost S01E01-E02"},
+		{"Primer.mp4", "Primer"},
+	} {
+		if got := Parse(test.fname).String(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.fname, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package parsefile
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Tags are the quality tags of a release. Each one is given in its usual
+// spelling (e.g., 'WEB-DL' for 'WEBDL' or 'web.dl'), and is empty when the
+// name doesn't have it.
+type Tags struct {
+	Resolution string   // e.g., '1080p' or '2160p' (for '4K' and 'UHD')
+	Source     string   // e.g., 'BluRay', 'WEB-DL' or 'HDTV'
+	HDR        string   // e.g., 'HDR10' or 'Dolby Vision'
+	Codec      string   // e.g., 'x264' or 'HEVC'
+	Audio      string   // e.g., 'DTS-HD' or 'AAC'
+	Editions   []string // e.g., 'Extended' and 'Remastered'
+	Proper     bool     // when the release is a 'PROPER' or 'REPACK'
+	Group      string   // the release group, e.g., 'SPARKS'
+}
+
+// String returns the tags separated by spaces, with the release group last.
+func (t Tags) String() string {
+	var fields []string
+	for _, s := range []string{
+		t.Resolution, t.Source, t.HDR, t.Codec, t.Audio,
+	} {
+		if len(s) > 0 {
+			fields = append(fields, s)
+		}
+	}
+	fields = append(fields, t.Editions...)
+	if t.Proper {
+		fields = append(fields, "Proper")
+	}
+	if len(t.Group) > 0 {
+		fields = append(fields, "-"+t.Group)
+	}
+	return strings.Join(fields, " ")
+}
+
+// tag is a quality tag with its usual spelling and a regular expression that
+// matches every spelling of it.
+type tag struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// newTag returns a tag that matches the pattern given, case insensitively,
+// as a whole word.
+func newTag(name, pattern string) tag {
+	return tag{name, regexp.MustCompile(
+		`(?i)(?:^|[^a-z0-9])(` + pattern + `)(?:[^a-z0-9]|$)`)}
+}
+
+// tagKind is a kind of quality tag. Its tags are in order of preference,
+// since only the first one found is used, unless all is set.
+type tagKind struct {
+	set  func(t *Tags, name string)
+	all  bool
+	tags []tag
+}
+
+var tagKinds = []tagKind{
+	{
+		func(t *Tags, name string) { t.Resolution = name },
+		false,
+		[]tag{
+			newTag("2160p", `2160p|4k|uhd`),
+			newTag("1080p", `1080p`),
+			newTag("1080i", `1080i`),
+			newTag("720p", `720p`),
+			newTag("576p", `576[pi]`),
+			newTag("480p", `480[pi]`),
+		},
+	},
+	{
+		func(t *Tags, name string) { t.Source = name },
+		false,
+		[]tag{
+			newTag("BluRay", `blu[ .-]?ray|bd(?:25|50)`),
+			newTag("BDRip", `bdrip|brrip`),
+			newTag("Remux", `(?:bd)?remux`),
+			newTag("WEB-DL", `web[ .-]?dl`),
+			newTag("WEBRip", `web[ .-]?rip`),
+			newTag("WEB", `web`),
+			newTag("HDTV", `hdtv`),
+			newTag("PDTV", `pdtv`),
+			newTag("DVDRip", `dvd[ .-]?rip`),
+			newTag("DVD", `dvd(?:[59]|r)?`),
+			newTag("HDRip", `hdrip`),
+			newTag("Screener", `(?:dvd)?scr|screener`),
+			newTag("Telesync", `telesync|hdts`),
+			newTag("CAM", `cam(?:rip)?|hdcam`),
+		},
+	},
+	{
+		func(t *Tags, name string) { t.HDR = name },
+		false,
+		[]tag{
+			newTag("HDR10+", `hdr10(?:\+|plus)`),
+			newTag("HDR10", `hdr10`),
+			newTag("Dolby Vision", `dv|dovi|dolby[ .-]?vision`),
+			newTag("HDR", `hdr`),
+		},
+	},
+	{
+		func(t *Tags, name string) { t.Codec = name },
+		false,
+		[]tag{
+			newTag("x265", `x265`),
+			newTag("HEVC", `hevc|h[ .]?265`),
+			newTag("x264", `x264`),
+			newTag("H.264", `avc|h[ .]?264`),
+			newTag("AV1", `av1`),
+			newTag("VP9", `vp9`),
+			newTag("XviD", `xvid`),
+			newTag("DivX", `divx`),
+		},
+	},
+	{
+		func(t *Tags, name string) { t.Audio = name },
+		false,
+		[]tag{
+			newTag("TrueHD", `truehd`),
+			newTag("DTS-HD", `dts[ .-]?hd(?:[ .-]?ma)?`),
+			newTag("DTS", `dts`),
+			newTag("EAC3", `e[ .-]?ac3|ddp(?:[ .]?[257][ .][01])?|dd\+`),
+			newTag("AC3", `ac3|dd[ .]?[257][ .][01]`),
+			newTag("AAC", `aac(?:[ .]?[1-7][ .][01])?`),
+			newTag("FLAC", `flac`),
+			newTag("Opus", `opus`),
+			newTag("MP3", `mp3`),
+		},
+	},
+	{
+		func(t *Tags, name string) { t.Editions = append(t.Editions, name) },
+		true,
+		[]tag{
+			newTag("Extended", `extended(?:[ .-]cut|[ .-]edition)?`),
+			newTag("Unrated", `unrated`),
+			newTag("Uncut", `uncut`),
+			newTag("Director's Cut", `directors?[ .-]?cut`),
+			newTag("Theatrical", `theatrical(?:[ .-]cut)?`),
+			newTag("Special Edition", `special[ .-]edition`),
+			newTag("Remastered", `remastered`),
+			newTag("Criterion", `criterion`),
+			newTag("IMAX", `imax`),
+		},
+	},
+	{
+		func(t *Tags, name string) { t.Proper = true },
+		false,
+		[]tag{newTag("Proper", `proper|repack|rerip`)},
+	},
+}
+
+// releaseGroup matches the release group at the end of a name, e.g.,
+// '-SPARKS' or '[YTS.MX]'.
+var releaseGroup = regexp.MustCompile(
+	`(?:-([A-Za-z0-9]+)|\[([A-Za-z0-9.]+)\])$`)
+
+// findTags returns the quality tags in s.
+func findTags(s string) Tags {
+	var t Tags
+	found := false
+	for _, kind := range tagKinds {
+		for _, tag := range kind.tags {
+			if tag.re.MatchString(s) {
+				kind.set(&t, tag.name)
+				found = true
+				if !kind.all {
+					break
+				}
+			}
+		}
+	}
+	// Without other tags, a dash at the end is more likely to be part of an
+	// episode's title than a release group.
+	if found {
+		// The group must not be part of a tag, e.g., 'DL' in 'WEB-DL'.
+		groups := releaseGroup.FindStringSubmatchIndex(s)
+		if groups != nil && !inTag(s, groups[0]+1) {
+			t.Group = strings.Trim(s[groups[0]:], "-[]")
+		}
+	}
+	return t
+}
+
+// firstTag returns where the first quality tag in s starts, or -1 if it has
+// none.
+func firstTag(s string) int {
+	first := -1
+	for _, kind := range tagKinds {
+		for _, tag := range kind.tags {
+			groups := tag.re.FindStringSubmatchIndex(s)
+			if groups != nil && (first == -1 || groups[2] < first) {
+				first = groups[2]
+			}
+		}
+	}
+	return first
+}
+
+// inTag returns true if the byte at index i of s is part of a quality tag.
+func inTag(s string, i int) bool {
+	for _, kind := range tagKinds {
+		for _, tag := range kind.tags {
+			for _, groups := range tag.re.FindAllStringSubmatchIndex(s, -1) {
+				if groups[2] <= i && i < groups[3] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+)
+
+// checkReportFormat reports an error and returns false if the format given
+// isn't one that writeReport knows.
+func checkReportFormat(format string) bool {
+	if format != "csv" && format != "json" {
+		pef("Unknown format '%s'. Use 'csv' or 'json'.", format)
+		return false
+	}
+	return true
+}
+
+// writeReport writes a report to stdout in the format given. As JSON, v is
+// written as an indented value (so it should be an empty slice rather than
+// nil when there's nothing to report). As CSV, the header is written followed
+// by the rows.
+func writeReport(
+	format string,
+	v interface{},
+	header []string,
+	rows [][]string,
+) error {
+	if format == "json" {
+		bs, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(append(bs, '\n'))
+		return err
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Write(header)
+	for _, row := range rows {
+		w.Write(row)
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// errInterrupted is returned by reads from lists after the process has been
+// asked to stop. (See interruptible.)
+var errInterrupted = ef("interrupted")
+
+var (
+	// interrupted is closed once the process has been asked to stop.
+	interrupted = make(chan struct{})
+
+	// interruptedBy is the signal that asked the process to stop.
+	interruptedBy os.Signal
+
+	// interruptedCtx is canceled once the process has been asked to stop,
+	// which stops database work that takes a context (like inserting rows).
+	interruptedCtx, cancelInterrupted = context.WithCancel(
+		context.Background())
+
+	interruptOnce sync.Once
+)
+
+// handleSignals makes SIGINT and SIGTERM stop long operations gracefully
+// rather than killing the process. Once a signal arrives, stopping returns
+// true and lists being read return errInterrupted, so that commands stop
+// starting new work and roll back the work in flight. A second signal exits
+// immediately.
+//
+// The function returned stops handling signals (after finishing with a
+// signal that has arrived, if any). In either case, main exits with
+// exitStatus when the process was interrupted.
+func handleSignals() (stop func()) {
+	sigs := make(chan os.Signal, 2)
+	done, exited := make(chan struct{}), make(chan struct{})
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case sig := <-sigs:
+				if stopping() {
+					pef("Interrupted again. Exiting now.")
+					os.Exit(exitStatus(sig))
+				}
+				pef("Interrupted. Stopping after cleaning up (interrupt " +
+					"again to exit now)...")
+				interruptOnce.Do(func() {
+					interruptedBy = sig
+					close(interrupted)
+					cancelInterrupted()
+				})
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+		<-exited
+	}
+}
+
+// stopping returns true if the process has been asked to stop.
+func stopping() bool {
+	select {
+	case <-interrupted:
+		return true
+	default:
+		return false
+	}
+}
+
+// exitStatus returns the status that the process exits with when it's
+// interrupted by the signal given, which is 128 plus the signal's number
+// (like a shell reports for a process killed by a signal).
+func exitStatus(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 128
+}
+
+// interruptible returns the reader given, except reads fail with
+// errInterrupted once the process has been asked to stop.
+func interruptible(r io.ReadCloser) io.ReadCloser {
+	return interruptibleReader{r}
+}
+
+type interruptibleReader struct {
+	io.ReadCloser
+}
+
+func (ir interruptibleReader) Read(bs []byte) (int, error) {
+	if stopping() {
+		return 0, errInterrupted
+	}
+	return ir.ReadCloser.Read(bs)
+}
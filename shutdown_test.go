@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestInterruptible(t *testing.T) {
+	r := interruptible(ioutil.NopCloser(strings.NewReader("abc")))
+	bs := make([]byte, 1)
+	if _, err := r.Read(bs); err != nil {
+		t.Fatal(err)
+	}
+
+	// The state is reset after the signal handler stops, so that it isn't
+	// changed while the handler still uses it.
+	defer func() {
+		interrupted = make(chan struct{})
+		interruptedBy = nil
+		interruptOnce = sync.Once{}
+		interruptedCtx, cancelInterrupted = context.WithCancel(
+			context.Background())
+	}()
+	stop := handleSignals()
+	defer stop()
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	<-interrupted
+	<-interruptedCtx.Done()
+	if _, err := r.Read(bs); err != errInterrupted {
+		t.Fatalf("expected errInterrupted but got %v", err)
+	}
+	if s := exitStatus(interruptedBy); s != 143 {
+		t.Fatalf("expected exit status 143 but got %d", s)
+	}
+}
@@ -61,9 +61,15 @@ successive new lines (LF) are replaced with two new lines (LF).
 	{{ if .E.Attrs }}
 		{{ printf " %s" .E.Attrs }}
 	{{ end }}
+	{{ if .E.Disambiguation }}
+		{{ printf " (%s)" .E.Disambiguation }}
+	{{ end }}
 	{{ if not .E.Rank.Unranked }}
 		{{ printf " (rank: %d/100, votes: %d)" .E.Rank.Rank .E.Rank.Votes }}
 	{{ end }}
+	{{ if .E.External }}
+		{{ printf " [external: %s]" .E.ExternalId }}
+	{{ end }}
 	{{ if .E.Credit.Valid }}
 		{{ if gt (len .E.Credit.Character) 0 }}
 			{{ printf " [%s]" .E.Credit.Character }}
@@ -71,6 +77,15 @@ successive new lines (LF) are replaced with two new lines (LF).
 		{{ if gt .E.Credit.Position 0 }}
 			{{ printf " <%d>" .E.Credit.Position }}
 		{{ end }}
+		{{ if and .E.Credit.Role (ne "actor" .E.Credit.Role) }}
+			{{ printf " (%s)" .E.Credit.Role }}
+		{{ end }}
+		{{ if ge .E.Credit.Age 0 }}
+			{{ printf " (age %d)" .E.Credit.Age }}
+		{{ end }}
+	{{ end }}
+	{{ if .E.Provenance }}
+		{{ printf "\n     sources: %s" .E.Provenance }}
 	{{ end }}
 
 {{ end }}
@@ -110,6 +125,25 @@ successive new lines (LF) are replaced with two new lines (LF).
 	{{ end }}
 {{ end }}
 
+{{ define "rename_multi_episode" }}
+	{{ $nums := printf "S%02dE%02d-E%02d" .E.Season .E.EpisodeNum .E.LastNum }}
+	{{ if .E.Titles }}
+		{{ if .A.ShowTv }}
+			{{ $tv := tvshow .E.Episode }}
+			{{ printf "%s - %s - %s%s" $tv.Title $nums .E.Titles .A.Ext }}
+		{{ else }}
+			{{ printf "%s - %s%s" $nums .E.Titles .A.Ext }}
+		{{ end }}
+	{{ else }}
+		{{ if .A.ShowTv }}
+			{{ $tv := tvshow .E.Episode }}
+			{{ printf "%s - %s%s" $tv.Title $nums .A.Ext }}
+		{{ else }}
+			{{ printf "%s%s" $nums .A.Ext }}
+		{{ end }}
+	{{ end }}
+{{ end }}
+
 {{ define "short_movie" }}
 
 	{{ printf "%s (%d)" .E.Title .E.Year | underlined "=" }}
@@ -518,6 +552,40 @@ successive new lines (LF) are replaced with two new lines (LF).
 	{{ end }}
 {{ end }}
 
+{{ define "overlays" }}
+
+	{{ printf "Overlay tags for %s" .E | underlined "=" }}
+
+	{{ $tags := overlays .E }}
+	{{ if not (len $tags) }}
+		None found.
+
+	{{ else }}
+		{{ range $tag := $tags }}
+			{{ $tag }}
+
+		{{ end }}
+
+	{{ end }}
+{{ end }}
+
+{{ define "xrefs" }}
+
+	{{ printf "Cross references for %s" .E | underlined "=" }}
+
+	{{ $xrefs := xrefs .E }}
+	{{ if not (len $xrefs) }}
+		None found.
+
+	{{ else }}
+		{{ range $xref := $xrefs }}
+			{{ $xref }}
+
+		{{ end }}
+
+	{{ end }}
+{{ end }}
+
 {{ define "credits" }}
 
 	{{ printf "Credits for %s" .E | underlined "=" }}
@@ -42,6 +42,9 @@ var (
 // The "tvshow" function takes one parameter that is an episode and returns
 // its corresponding TV show.
 //
+// The "artwork" function takes one parameter that is an entity and returns
+// a list of its artwork URLs (see imdb.Artwork).
+//
 // The list of functions starting with "running_times" retrieve attribute
 // values given an entity. All functions accept one argument that must satisfy
 // the imdb.Entity interface and return a list of attribute values.
@@ -53,6 +56,7 @@ var Functions = template.FuncMap{
 	"count_seasons":  countSeasons,
 	"count_episodes": countEpisodes,
 	"tvshow":         tvshow,
+	"artwork":        artwork,
 
 	"running_times":      attrGetter(new(imdb.RunningTimes)),
 	"release_dates":      attrGetter(new(imdb.ReleaseDates)),
@@ -73,6 +77,8 @@ var Functions = template.FuncMap{
 	"quotes":             attrGetter(new(imdb.Quotes)),
 	"rank":               attrGetter(new(imdb.UserRank)),
 	"credits":            attrGetter(new(imdb.Credits)),
+	"overlays":           attrGetter(new(imdb.Overlays)),
+	"xrefs":              attrGetter(new(imdb.Xrefs)),
 
 	"eq": func(a, b interface{}) bool { return a == b },
 	"ne": func(a, b interface{}) bool { return a != b },
@@ -204,3 +210,11 @@ func tvshow(e imdb.Entity) *imdb.Tvshow {
 	assert(err)
 	return tv
 }
+
+// artwork returns the artwork URLs for the entity given.
+func artwork(e imdb.Entity) []imdb.Art {
+	assertDB()
+	arts, err := imdb.Artwork(tplDB, e.Ident())
+	assert(err)
+	return arts
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// postJSON posts the value given, encoded as JSON, to each of the URLs
+// given. Failures are reported but otherwise ignored, since notifications
+// never change the outcome of a command.
+func postJSON(urls []string, v interface{}) {
+	if len(urls) == 0 {
+		return
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		pef("Could not encode webhook notification: %s", err)
+		return
+	}
+	client, err := httpClient()
+	if err != nil {
+		pef("%s", err)
+		return
+	}
+	for _, url := range urls {
+		resp, err := client.Post(url, "application/json",
+			bytes.NewReader(body))
+		if err != nil {
+			pef("Could not notify webhook '%s': %s", url, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			pef("Could not notify webhook '%s': %s", url, resp.Status)
+		}
+	}
+}
+
+// splitURLs splits a comma separated list of URLs, ignoring empty ones.
+func splitURLs(s string) []string {
+	var urls []string
+	for _, url := range strings.Split(s, ",") {
+		if url = strings.TrimSpace(url); len(url) > 0 {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}